@@ -11,6 +11,7 @@ require (
 	github.com/shirou/gopsutil v0.0.0-20190601025009-5335e3fd506d
 	github.com/snapserv/nagopher v0.1.6
 	github.com/stretchr/objx v0.2.0 // indirect
+	github.com/stretchr/testify v1.3.0
 	golang.org/x/crypto v0.0.0-20190621222207-cc06ce4a13d4 // indirect
 	golang.org/x/net v0.0.0-20190628185345-da137c7871d7 // indirect
 	golang.org/x/sys v0.0.0-20190626221950-04f50cda93cb // indirect
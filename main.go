@@ -19,11 +19,27 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/snapserv/nagocheck/mod-asterisk"
+	"github.com/snapserv/nagocheck/mod-backup"
+	"github.com/snapserv/nagocheck/mod-cups"
+	"github.com/snapserv/nagocheck/mod-expiry"
 	"github.com/snapserv/nagocheck/mod-frrouting"
+	"github.com/snapserv/nagocheck/mod-kerberos"
+	"github.com/snapserv/nagocheck/mod-ldap"
+	"github.com/snapserv/nagocheck/mod-mqtt"
+	"github.com/snapserv/nagocheck/mod-netdevice"
+	"github.com/snapserv/nagocheck/mod-openbgpd"
+	"github.com/snapserv/nagocheck/mod-query"
+	"github.com/snapserv/nagocheck/mod-routeros"
+	"github.com/snapserv/nagocheck/mod-snmp"
 	"github.com/snapserv/nagocheck/mod-system"
+	"github.com/snapserv/nagocheck/mod-tls"
+	"github.com/snapserv/nagocheck/mod-windows"
 	"github.com/snapserv/nagocheck/nagocheck"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
 	"runtime"
 	"strings"
 )
@@ -33,25 +49,157 @@ var (
 	BuildVersion = "SNAPSHOT"
 	BuildCommit  = "N/A"
 	BuildDate    = "N/A"
+
+	// UpdatePublicKey is the base64-encoded ed25519 public key used by self-update for verifying releases
+	UpdatePublicKey = ""
 )
 
+// nagiosUsageWriter buffers usage and error output of kingpin, so that usage errors can be rendered as a single line
+// with an UNKNOWN state, which is the only sensible output when being executed by a monitoring system. Usage which has
+// been requested explicitly, e.g. using --help, is being printed unchanged.
+type nagiosUsageWriter struct {
+	usage  bytes.Buffer
+	errors bytes.Buffer
+}
+
+func (w *nagiosUsageWriter) Write(data []byte) (int, error) {
+	return w.usage.Write(data)
+}
+
+func (w *nagiosUsageWriter) terminate(status int) {
+	const unknownExitCode = 3
+
+	if w.errors.Len() > 0 {
+		message := strings.SplitN(strings.TrimSpace(w.errors.String()), "\n", 2)[0]
+		if index := strings.Index(message, ": error: "); index != -1 {
+			message = message[index+len(": error: "):]
+		}
+
+		fmt.Printf("UNKNOWN - %s\n", strings.TrimSuffix(message, ", try --help"))
+		os.Exit(unknownExitCode)
+	}
+
+	// Usage requested explicitly, e.g. using --help, exits successfully and is printed as-is
+	if status != 0 || w.commandMissing() {
+		message := strings.SplitN(strings.TrimSpace(w.usage.String()), "\n", 2)[0]
+		fmt.Printf("UNKNOWN - %s\n", message)
+		os.Exit(unknownExitCode)
+	}
+
+	fmt.Print(w.usage.String())
+	os.Exit(status)
+}
+
+// commandMissing returns true if kingpin prints the usage due to a missing command instead of the usage or version
+// being requested explicitly, as kingpin exits successfully in both cases
+func (w *nagiosUsageWriter) commandMissing() bool {
+	context, err := kingpin.CommandLine.ParseContext(os.Args[1:])
+	if err != nil || context.SelectedCommand != nil {
+		return false
+	}
+
+	for _, element := range context.Elements {
+		flag, ok := element.Clause.(*kingpin.FlagClause)
+		if ok && (strings.HasPrefix(flag.Model().Name, "help") || flag.Model().Name == "version") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isTerminal(file *os.File) bool {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
+// newModuleFactory discovers all external modules and returns a factory, which registers all built-in modules together
+// with fresh copies of the external modules, alongside the errors of external modules which had to be skipped
+func newModuleFactory() (func() map[string]nagocheck.Module, []error) {
+	externalModules, errs := nagocheck.ExternalModuleFactory(nagocheck.ExternalModuleDirectories()...)
+
+	return func() map[string]nagocheck.Module {
+		// External modules are registered first, so that built-in modules with the same name take precedence
+		return nagocheck.RegisterModules(append(externalModules(),
+			modasterisk.NewAsteriskModule(),
+			modbackup.NewBackupModule(),
+			modcups.NewCUPSModule(),
+			modexpiry.NewExpiryModule(),
+			modfrrouting.NewFrroutingModule(),
+			modkerberos.NewKerberosModule(),
+			modldap.NewLDAPModule(),
+			modmqtt.NewMQTTModule(),
+			modnetdevice.NewNetdeviceModule(),
+			modopenbgpd.NewOpenbgpdModule(),
+			modquery.NewQueryModule(),
+			modrouteros.NewRouterOSModule(),
+			modsnmp.NewSNMPModule(),
+			modsystem.NewSystemModule(),
+			modtls.NewTLSModule(),
+			modwindows.NewWindowsModule(),
+		)...)
+	}, errs
+}
+
 func main() {
-	modules := nagocheck.RegisterModules(
-		modfrrouting.NewFrroutingModule(),
-		modsystem.NewSystemModule(),
+	newModules, discoveryErrors := newModuleFactory()
+	modules := newModules()
+	tools := nagocheck.RegisterTools(
+		nagocheck.NewAckTool(),
+		nagocheck.NewAgentTool(newModules),
+		nagocheck.NewBatchTool(),
+		nagocheck.NewCompletionTool(),
+		nagocheck.NewDescribeTool(),
+		nagocheck.NewDiscoverTool(),
+		nagocheck.NewGenerateTool(),
+		nagocheck.NewInventoryTool(),
+		nagocheck.NewManPageTool(),
+		nagocheck.NewScaffoldTool(),
+		nagocheck.NewSelfUpdateTool(BuildVersion, UpdatePublicKey),
+		nagocheck.NewServeTool(),
+		nagocheck.NewValidateTool(newModules),
 	)
 
+	nagocheck.SetBuildInfo(nagocheck.BuildInfo{Version: BuildVersion, Commit: BuildCommit, Date: BuildDate})
 	kingpin.Version(fmt.Sprintf("nagocheck, version %s (commit: %s)\nbuild date: %s, runtime: %s",
 		BuildVersion, BuildCommit, BuildDate, runtime.Version()))
 	kingpin.CommandLine.HelpFlag.Short('h')
 	kingpin.CommandLine.VersionFlag.Short('V')
+	nagocheck.DefineGlobalFlags(kingpin.CommandLine)
+
+	if !isTerminal(os.Stdout) {
+		usageWriter := &nagiosUsageWriter{}
+		kingpin.CommandLine.UsageWriter(usageWriter)
+		kingpin.CommandLine.ErrorWriter(&usageWriter.errors)
+		kingpin.CommandLine.Terminate(usageWriter.terminate)
+	}
 
 	for _, module := range modules {
-		moduleNode := module.DefineCommand()
+		moduleNode := module.DefineCommand(kingpin.CommandLine)
 		module.DefineFlags(moduleNode)
 	}
+	nagocheck.DefineEnvars(kingpin.CommandLine, modules)
+
+	for _, tool := range tools {
+		tool.DefineCommand(kingpin.CommandLine)
+	}
 
 	commandParts := strings.Split(kingpin.Parse(), " ")
+	for _, err := range discoveryErrors {
+		nagocheck.NewLogger("main").Debugf("skipped external module: %s", err.Error())
+	}
+
+	if tool, ok := tools[commandParts[0]]; ok {
+		if err := tool.Execute(modules); err != nil {
+			panic(fmt.Sprintf("execution of [%s] failed: %s", commandParts[0], err.Error()))
+		}
+		return
+	}
+
 	module, ok := modules[commandParts[0]]
 	if !ok {
 		panic(fmt.Sprintf("module not found with name [%s]", commandParts[0]))
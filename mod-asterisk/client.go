@@ -0,0 +1,167 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modasterisk
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// amiClient implements the text-based Asterisk Manager Interface, which consists of blocks of 'Key: Value' lines
+// terminated by an empty line. List actions respond with a series of events, which are being collected until the
+// event marking the end of the list has been received.
+type amiClient struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	actionID int
+}
+
+type amiOptions struct {
+	address  string
+	username string
+	secret   string
+	timeout  time.Duration
+}
+
+// amiMessage represents a response or event sent by Asterisk, where keys are case-sensitive as sent by Asterisk
+type amiMessage map[string]string
+
+const maxAMIEvents = 100000
+
+// dialAMI connects to the manager interface of Asterisk and logs in with the given credentials
+func dialAMI(options amiOptions) (*amiClient, error) {
+	conn, err := net.DialTimeout("tcp", options.address, options.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to AMI: %s", err.Error())
+	}
+
+	client := &amiClient{conn: conn, reader: bufio.NewReader(conn)}
+	if err := conn.SetDeadline(time.Now().Add(options.timeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	banner, err := client.reader.ReadString('\n')
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("could not read AMI banner: %s", err.Error())
+	}
+	if !strings.HasPrefix(banner, "Asterisk Call Manager") {
+		_ = conn.Close()
+		return nil, fmt.Errorf("unexpected AMI banner: %s", strings.TrimSpace(banner))
+	}
+
+	if _, _, err := client.Action("Login", "Username", options.username, "Secret", options.secret,
+		"Events", "off"); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Action sends the given action with additional headers given as key-value pairs and returns the response. For list
+// actions, all events belonging to the action are being returned as well.
+func (c *amiClient) Action(name string, headers ...string) (amiMessage, []amiMessage, error) {
+	c.actionID++
+	actionID := strconv.Itoa(c.actionID)
+
+	var request strings.Builder
+	request.WriteString("Action: " + name + "\r\nActionID: " + actionID + "\r\n")
+	for index := 0; index+1 < len(headers); index += 2 {
+		request.WriteString(headers[index] + ": " + headers[index+1] + "\r\n")
+	}
+	request.WriteString("\r\n")
+
+	if _, err := c.conn.Write([]byte(request.String())); err != nil {
+		return nil, nil, fmt.Errorf("could not send action: %s", err.Error())
+	}
+
+	response, err := c.receive(actionID, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.EqualFold(response["Response"], "Success") {
+		return nil, nil, fmt.Errorf("%s failed: %s", name, response["Message"])
+	}
+	if !strings.EqualFold(response["EventList"], "start") {
+		return response, nil, nil
+	}
+
+	var events []amiMessage
+	for len(events) < maxAMIEvents {
+		event, err := c.receive(actionID, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		if strings.EqualFold(event["EventList"], "Complete") {
+			return response, events, nil
+		}
+		events = append(events, event)
+	}
+
+	return nil, nil, fmt.Errorf("%s returned too many events", name)
+}
+
+// Close logs off from the manager interface and closes the connection
+func (c *amiClient) Close() error {
+	_, _ = c.conn.Write([]byte("Action: Logoff\r\n\r\n"))
+	return c.conn.Close()
+}
+
+// receive returns the next response or event with the given action ID, skipping all other messages like unsolicited
+// events which are sent regardless of 'Events: off' by some versions
+func (c *amiClient) receive(actionID string, event bool) (amiMessage, error) {
+	for {
+		message, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		_, isEvent := message["Event"]
+		if message["ActionID"] == actionID && isEvent == event {
+			return message, nil
+		}
+	}
+}
+
+func (c *amiClient) readMessage() (amiMessage, error) {
+	message := make(amiMessage)
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("could not receive AMI message: %s", err.Error())
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if len(message) == 0 {
+				continue
+			}
+			return message, nil
+		}
+
+		if parts := strings.SplitN(line, ":", 2); len(parts) == 2 {
+			message[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+}
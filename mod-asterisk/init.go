@@ -0,0 +1,73 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modasterisk
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+	"net"
+	"strconv"
+	"time"
+)
+
+type asteriskModule struct {
+	nagocheck.Module
+
+	host     string
+	port     uint16
+	username string
+	secret   string
+	timeout  time.Duration
+}
+
+// NewAsteriskModule instantiates asteriskModule and all contained plugins
+func NewAsteriskModule() nagocheck.Module {
+	return &asteriskModule{
+		Module: nagocheck.NewModule("asterisk",
+			nagocheck.ModuleDescription("Asterisk (AMI)"),
+			nagocheck.ModulePlugin(newSIPPlugin()),
+		),
+	}
+}
+
+func (m *asteriskModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("host", "Specifies the hostname or address of the Asterisk manager interface.").
+		Short('H').Default("127.0.0.1").StringVar(&m.host)
+
+	node.Flag("port", "Specifies the port of the Asterisk manager interface.").
+		Short('p').Default("5038").Uint16Var(&m.port)
+
+	node.Flag("username", "Specifies the name of the manager user as configured in manager.conf, which requires "+
+		"read access to the 'system' and 'reporting' classes.").
+		Short('u').Required().StringVar(&m.username)
+
+	node.Flag("secret", "Specifies the secret of the manager user.").
+		Envar("NAGOCHECK_ASTERISK_SECRET").StringVar(&m.secret)
+
+	node.Flag("timeout", "Specifies the timeout for the whole session against the manager interface.").
+		Short('t').Default("10s").DurationVar(&m.timeout)
+}
+
+// options returns the connection options of the AMI client based on the module flags
+func (m *asteriskModule) options() amiOptions {
+	return amiOptions{
+		address:  net.JoinHostPort(m.host, strconv.Itoa(int(m.port))),
+		username: m.username,
+		secret:   m.secret,
+		timeout:  m.timeout,
+	}
+}
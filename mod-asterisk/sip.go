@@ -0,0 +1,320 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modasterisk
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"sort"
+	"strings"
+)
+
+type sipPlugin struct {
+	nagocheck.Plugin
+
+	Driver         string
+	Trunks         []string
+	OptionalTrunks []string
+}
+
+type sipResource struct {
+	nagocheck.Resource
+
+	trunks           []sipTrunk
+	peersReachable   int
+	peersUnreachable int
+	channels         int
+}
+
+type sipSummarizer struct {
+	nagocheck.Summarizer
+}
+
+// sipTrunk contains the state of a single trunk, which is either the state of its outbound registration or whether
+// the endpoint is reachable, in case the trunk does not register itself
+type sipTrunk struct {
+	name     string
+	state    string
+	optional bool
+}
+
+// sipPeer contains the name and reachability of an endpoint (PJSIP) or peer (chan_sip)
+type sipPeer struct {
+	name      string
+	reachable bool
+}
+
+func newSIPPlugin() *sipPlugin {
+	return &sipPlugin{
+		Plugin: nagocheck.NewPlugin("sip",
+			nagocheck.PluginDescription("SIP Trunks"),
+			nagocheck.PluginHysteresis(true),
+		),
+	}
+}
+
+func (p *sipPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("driver", "Specifies the SIP channel driver used by Asterisk, either 'pjsip' or 'sip' (chan_sip).").
+		Default("pjsip").EnumVar(&p.Driver, "pjsip", "sip")
+
+	node.Flag("trunk", "Name of a trunk which results in a critical state if it is not registered or reachable. "+
+		"Can be repeated and defaults to all outbound registrations.").
+		StringsVar(&p.Trunks)
+
+	node.Flag("optional-trunk", "Name of a trunk which only results in a warning state if it is not registered or "+
+		"reachable, e.g. for backup lines. Can be repeated.").
+		StringsVar(&p.OptionalTrunks)
+}
+
+func (p *sipPlugin) DefineCheck() nagopher.Check {
+	okStates := []string{"REGISTERED", "REACHABLE"}
+
+	check := nagopher.NewCheck("sip", newSIPSummarizer(p))
+	check.AttachResources(newSIPResource(p))
+	check.AttachContexts(
+		nagopher.NewStringMatchContext("trunk", nagopher.StateCritical(), okStates),
+		nagopher.NewStringMatchContext("optional_trunk", nagopher.StateWarning(), okStates),
+		nagopher.NewScalarContext("peers", nil, nil),
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"channels",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+	)
+
+	return check
+}
+
+func (p *sipPlugin) ThisModule() *asteriskModule {
+	return p.Plugin.Module().(*asteriskModule)
+}
+
+func newSIPResource(plugin *sipPlugin) *sipResource {
+	return &sipResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *sipResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(math.Inf(1)))
+
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	for _, trunk := range r.trunks {
+		contextName := "trunk"
+		if trunk.optional {
+			contextName = "optional_trunk"
+		}
+
+		metrics = append(metrics, r.Section(trunk.name,
+			nagopher.MustNewStringMetric(trunk.name+"_trunk", trunk.state, contextName),
+		)...)
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("peers_reachable", float64(r.peersReachable), "", &valueRange, "peers"),
+		nagopher.MustNewNumericMetric("peers_unreachable", float64(r.peersUnreachable), "", &valueRange, "peers"),
+		nagopher.MustNewNumericMetric("channels", float64(r.channels), "", &valueRange, "channels"),
+	)
+
+	return metrics, nil
+}
+
+// Collect fetches the outbound registrations, the reachability of all peers and the amount of active channels within
+// a single AMI session. Trunks which neither have a registration nor a peer are being reported as 'MISSING'.
+func (r *sipResource) Collect() (rerr error) {
+	plugin := r.ThisPlugin()
+	client, err := dialAMI(plugin.ThisModule().options())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := client.Close(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	registrations, peers, err := r.collectSIP(client)
+	if err != nil {
+		return err
+	}
+
+	r.peersReachable, r.peersUnreachable = 0, 0
+	for _, peer := range peers {
+		if peer.reachable {
+			r.peersReachable++
+		} else {
+			r.peersUnreachable++
+		}
+	}
+
+	trunkNames := plugin.Trunks
+	if len(trunkNames) == 0 && len(plugin.OptionalTrunks) == 0 {
+		for name := range registrations {
+			trunkNames = append(trunkNames, name)
+		}
+		sort.Strings(trunkNames)
+	}
+
+	r.trunks = nil
+	for _, name := range trunkNames {
+		r.trunks = append(r.trunks, sipTrunk{name: name, state: trunkState(name, registrations, peers)})
+	}
+	for _, name := range plugin.OptionalTrunks {
+		r.trunks = append(r.trunks, sipTrunk{name: name, state: trunkState(name, registrations, peers), optional: true})
+	}
+
+	_, channels, err := client.Action("CoreShowChannels")
+	if err != nil {
+		return err
+	}
+	r.channels = len(channels)
+
+	return nil
+}
+
+// collectSIP returns the states of all outbound registrations keyed by their lower-cased name and all peers, using the
+// AMI actions of the selected channel driver
+func (r *sipResource) collectSIP(client *amiClient) (map[string]string, []sipPeer, error) {
+	registrations := make(map[string]string)
+	var peers []sipPeer
+
+	if r.ThisPlugin().Driver == "sip" {
+		_, events, err := client.Action("SIPshowregistry")
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, event := range events {
+			registrations[strings.ToLower(event["Host"])] = amiState(event["State"])
+		}
+
+		_, events, err = client.Action("SIPpeers")
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, event := range events {
+			status := strings.ToUpper(event["Status"])
+			reachable := strings.HasPrefix(status, "OK") || strings.HasPrefix(status, "UNMONITORED")
+			peers = append(peers, sipPeer{name: event["ObjectName"], reachable: reachable})
+		}
+
+		return registrations, peers, nil
+	}
+
+	_, events, err := client.Action("PJSIPShowRegistrationsOutbound")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, event := range events {
+		if event["Event"] == "OutboundRegistrationDetail" {
+			registrations[strings.ToLower(event["ObjectName"])] = amiState(event["Status"])
+		}
+	}
+
+	_, events, err = client.Action("PJSIPShowEndpoints")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, event := range events {
+		if event["Event"] == "EndpointList" {
+			reachable := !strings.EqualFold(event["DeviceState"], "Unavailable")
+			peers = append(peers, sipPeer{name: event["ObjectName"], reachable: reachable})
+		}
+	}
+
+	return registrations, peers, nil
+}
+
+func (r *sipResource) ThisPlugin() *sipPlugin {
+	return r.Resource.Plugin().(*sipPlugin)
+}
+
+// trunkState returns the state of the outbound registration with the given name if present, otherwise whether the
+// peer with the given name is reachable
+func trunkState(name string, registrations map[string]string, peers []sipPeer) string {
+	if state, ok := registrations[strings.ToLower(name)]; ok {
+		return state
+	}
+
+	for _, peer := range peers {
+		if strings.EqualFold(peer.name, name) {
+			if peer.reachable {
+				return "REACHABLE"
+			}
+			return "UNREACHABLE"
+		}
+	}
+
+	return "MISSING"
+}
+
+// amiState normalizes states reported by Asterisk like 'Registered' or 'Auth. Sent' to 'REGISTERED' and 'AUTH_SENT'
+func amiState(state string) string {
+	fields := strings.FieldsFunc(strings.ToUpper(state), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	if len(fields) == 0 {
+		return "UNKNOWN"
+	}
+
+	return strings.Join(fields, "_")
+}
+
+func newSIPSummarizer(plugin *sipPlugin) *sipSummarizer {
+	return &sipSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *sipSummarizer) Ok(check nagopher.Check) string {
+	trunks, reachable, unreachable, channels := 0, 0.0, 0.0, 0.0
+	for _, result := range check.Results().Get() {
+		metric, err := result.Metric().Get()
+		if err != nil {
+			continue
+		}
+
+		numericMetric, _ := metric.(nagopher.NumericMetric)
+		switch metric.Name() {
+		case "peers_reachable":
+			reachable = numericMetric.Value()
+		case "peers_unreachable":
+			unreachable = numericMetric.Value()
+		case "channels":
+			channels = numericMetric.Value()
+		default:
+			if metric.ContextName() == "trunk" || metric.ContextName() == "optional_trunk" {
+				trunks++
+			}
+		}
+	}
+
+	trunkNoun := "trunks"
+	if trunks == 1 {
+		trunkNoun = "trunk"
+	}
+
+	return fmt.Sprintf("%d %s up, %.0f/%.0f peers reachable, %.0f active channels", trunks, trunkNoun,
+		reachable, reachable+unreachable, channels)
+}
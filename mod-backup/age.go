@@ -0,0 +1,118 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modbackup
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"time"
+)
+
+// ageContext evaluates the age of the newest backup in seconds against duration thresholds like '26h', describing the
+// backup using the given subject function as it is only known after probing
+type ageContext struct {
+	nagocheck.Context
+
+	subject           func() string
+	warningThreshold  nagopher.OptionalBounds
+	criticalThreshold nagopher.OptionalBounds
+}
+
+func newAgeContext(plugin nagocheck.Plugin, subject func() string, warningThreshold *nagopher.Bounds, criticalThreshold *nagopher.Bounds) *ageContext {
+	ageContext := &ageContext{
+		Context: nagocheck.NewContext(plugin, nagopher.NewBaseContext("age", "%<value>s")),
+		subject: subject,
+	}
+
+	if warningThreshold != nil {
+		ageContext.warningThreshold = nagopher.NewOptionalBounds(*warningThreshold)
+	}
+	if criticalThreshold != nil {
+		ageContext.criticalThreshold = nagopher.NewOptionalBounds(*criticalThreshold)
+	}
+
+	return ageContext
+}
+
+func (c *ageContext) Describe(metric nagopher.Metric) string {
+	numericMetric, ok := metric.(nagopher.NumericMetric)
+	if !ok {
+		return c.Context.Describe(metric)
+	}
+
+	age := time.Duration(numericMetric.Value()) * time.Second
+	return fmt.Sprintf("%s is %s old", c.subject(), nagocheck.DurationString(age))
+}
+
+func (c *ageContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	numericMetric, ok := metric.(nagopher.NumericMetric)
+	if !ok {
+		return nagocheck.NewInvalidMetricTypeResult(c, metric, resource)
+	}
+
+	emptyBounds := nagopher.NewBounds()
+	warningThreshold := c.warningThreshold.OrElse(emptyBounds)
+	criticalThreshold := c.criticalThreshold.OrElse(emptyBounds)
+
+	if !criticalThreshold.Match(numericMetric.Value()) {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateCritical()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint(c.violationHint(criticalThreshold)),
+		)
+	} else if !warningThreshold.Match(numericMetric.Value()) {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateWarning()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint(c.violationHint(warningThreshold)),
+		)
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(nagopher.StateOk()),
+		nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+	)
+}
+
+func (c *ageContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	perfData, err := nagopher.NewPerfData(
+		metric,
+		nagopher.OptionalBoundsPtr(c.warningThreshold),
+		nagopher.OptionalBoundsPtr(c.criticalThreshold),
+	)
+
+	if err != nil {
+		return nagopher.OptionalPerfData{}, err
+	}
+
+	return nagopher.NewOptionalPerfData(perfData), nil
+}
+
+func (c *ageContext) violationHint(threshold nagopher.Bounds) string {
+	upperBounds := threshold.Upper().OrElse(math.NaN())
+	lowerBounds := threshold.Lower().OrElse(math.NaN())
+
+	if !math.IsInf(upperBounds, 1) && !math.IsNaN(upperBounds) && (math.IsNaN(lowerBounds) || lowerBounds == 0) {
+		return fmt.Sprintf("more than %s", nagocheck.DurationString(time.Duration(upperBounds)*time.Second))
+	}
+
+	return threshold.ViolationHint()
+}
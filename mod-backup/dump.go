@@ -0,0 +1,344 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modbackup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type dumpPlugin struct {
+	nagocheck.Plugin
+
+	Directory string
+	Pattern   string
+	MinSize   float64
+	Tables    []string
+}
+
+type dumpResource struct {
+	nagocheck.Resource
+
+	dumpCount     int
+	newest        os.FileInfo
+	compressed    bool
+	integrityErr  error
+	missingTables map[string]bool
+}
+
+type dumpSizeContext struct {
+	nagocheck.Context
+
+	minSize float64
+}
+
+type dumpSummarizer struct {
+	nagocheck.Summarizer
+
+	resource *dumpResource
+}
+
+// dumpCreateTableRE matches the table name of CREATE TABLE statements as written by mysqldump and pg_dump, optionally
+// qualified with a schema and quoted using backticks or double quotes
+var dumpCreateTableRE = regexp.MustCompile("(?i)^CREATE TABLE (?:IF NOT EXISTS )?(?:[`\"]?[^`\". (]+[`\"]?\\.)?[`\"]?([^`\". (]+)")
+
+// gzipMagic contains the first two bytes of every gzip-compressed file
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func newDumpPlugin() *dumpPlugin {
+	return &dumpPlugin{
+		Plugin: nagocheck.NewPlugin("dump",
+			nagocheck.PluginDescription("Database Dump"),
+			nagocheck.PluginDurationThresholds(true),
+		),
+	}
+}
+
+func (p *dumpPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("directory", "Directory containing the database dumps, of which only the newest one gets verified.").
+		Required().ExistingDirVar(&p.Directory)
+
+	node.Flag("pattern", "Only consider files within the directory matching the given shell pattern.").
+		Short('p').Default("*").StringVar(&p.Pattern)
+
+	nagocheck.SizeVar(node.Flag("min-size", "Return CRITICAL if the newest dump is smaller than the given size, "+
+		"e.g. 10MB. The size of compressed dumps is checked before decompressing them.").
+		Default("1B"), &p.MinSize)
+
+	node.Flag("table", "Return CRITICAL if the newest dump does not create the given table, which requires plain SQL "+
+		"dumps (optionally gzip-compressed). Can be specified multiple times.").
+		Short('T').StringsVar(&p.Tables)
+}
+
+func (p *dumpPlugin) DefineCheck() nagopher.Check {
+	minimumDumps := nagopher.NewBounds(nagopher.LowerBound(1), nagopher.UpperBound(math.Inf(1)))
+	resource := newDumpResource(p)
+
+	check := nagopher.NewCheck("dump", newDumpSummarizer(p, resource))
+	check.AttachResources(resource)
+	check.AttachContexts(
+		newAgeContext(p, resource.describeNewest,
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		),
+		newDumpSizeContext(p, p.MinSize),
+		nagocheck.NewHiddenScalarContext(p, "dumps", nil, &minimumDumps),
+		nagopher.NewStringMatchContext("integrity", nagopher.StateCritical(), []string{"VALID"}),
+		nagopher.NewStringMatchContext("table", nagopher.StateCritical(), []string{"PRESENT"}),
+	)
+
+	return check
+}
+
+func newDumpResource(plugin *dumpPlugin) *dumpResource {
+	return &dumpResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *dumpResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	metrics = append(metrics, nagopher.MustNewNumericMetric("dumps", float64(r.dumpCount), "", nil, ""))
+	if r.newest == nil {
+		return metrics, nil
+	}
+
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0))
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("age", math.Max(0, math.Floor(time.Since(r.newest.ModTime()).Seconds())),
+			"s", &valueRange, ""),
+		nagopher.MustNewNumericMetric("size", float64(r.newest.Size()), "B", &valueRange, ""),
+	)
+
+	if r.compressed {
+		integrity := "VALID"
+		if r.integrityErr != nil {
+			integrity = "CORRUPT"
+			warnings.Add(nagopher.NewWarning("%s is corrupt: %s", r.newest.Name(), r.integrityErr.Error()))
+		}
+		metrics = append(metrics, nagopher.MustNewStringMetric("integrity", integrity, ""))
+	}
+
+	for _, table := range r.ThisPlugin().Tables {
+		presence := "PRESENT"
+		if r.missingTables[table] {
+			presence = "MISSING"
+		}
+		metrics = append(metrics, nagopher.MustNewStringMetric(table+"_table", presence, "table"))
+	}
+
+	return metrics, nil
+}
+
+func (r *dumpResource) Collect() error {
+	plugin := r.ThisPlugin()
+
+	paths, err := filepath.Glob(filepath.Join(plugin.Directory, plugin.Pattern))
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %s", err.Error())
+	}
+
+	var newestPath string
+	for _, path := range paths {
+		fileInfo, err := os.Stat(path)
+		if err != nil || !fileInfo.Mode().IsRegular() {
+			continue
+		}
+
+		r.dumpCount++
+		if r.newest == nil || fileInfo.ModTime().After(r.newest.ModTime()) {
+			r.newest, newestPath = fileInfo, path
+		}
+	}
+
+	if r.newest == nil {
+		return nil
+	}
+
+	return r.verify(newestPath)
+}
+
+// verify reads the given dump once, which verifies the checksum of gzip-compressed dumps and searches for all expected
+// tables at the same time. Dumps are only read if either of both is required.
+func (r *dumpResource) verify(path string) (rerr error) {
+	tables := r.ThisPlugin().Tables
+	r.missingTables = make(map[string]bool, len(tables))
+	for _, table := range tables {
+		r.missingTables[table] = true
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open dump: %s", err.Error())
+	}
+	defer func() {
+		if err := file.Close(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	magic, _ := reader.Peek(len(gzipMagic))
+	r.compressed = string(magic) == string(gzipMagic)
+	if !r.compressed && len(tables) == 0 {
+		return nil
+	}
+
+	var content io.Reader = reader
+	if r.compressed {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			r.integrityErr = err
+			return nil
+		}
+		content = gzipReader
+	}
+
+	if err := r.scanTables(content); err != nil {
+		if !r.compressed {
+			return fmt.Errorf("could not read dump: %s", err.Error())
+		}
+		r.integrityErr = err
+	}
+
+	return nil
+}
+
+// scanTables reads the whole dump and marks all tables being created as present. Only the beginning of each line gets
+// inspected, as the lines of extended inserts can easily exceed any reasonable buffer size.
+func (r *dumpResource) scanTables(content io.Reader) error {
+	reader := bufio.NewReaderSize(content, 64*1024)
+	lineStart := true
+
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if lineStart && len(r.missingTables) > 0 {
+			if match := dumpCreateTableRE.FindSubmatch(chunk); match != nil {
+				delete(r.missingTables, string(match[1]))
+			}
+		}
+		lineStart = !isPrefix
+	}
+}
+
+// describeNewest returns the subject of the age metric, which is the newest dump
+func (r *dumpResource) describeNewest() string {
+	return "newest dump " + r.newest.Name()
+}
+
+func (r *dumpResource) ThisPlugin() *dumpPlugin {
+	return r.Resource.Plugin().(*dumpPlugin)
+}
+
+func newDumpSizeContext(plugin *dumpPlugin, minSize float64) *dumpSizeContext {
+	return &dumpSizeContext{
+		Context: nagocheck.NewContext(plugin, nagopher.NewBaseContext("size", "%<value>s")),
+		minSize: minSize,
+	}
+}
+
+func (c *dumpSizeContext) Describe(metric nagopher.Metric) string {
+	numericMetric, ok := metric.(nagopher.NumericMetric)
+	if !ok {
+		return c.Context.Describe(metric)
+	}
+
+	return fmt.Sprintf("size is %s", nagocheck.FormatBinarySize(numericMetric.Value()))
+}
+
+func (c *dumpSizeContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	numericMetric, ok := metric.(nagopher.NumericMetric)
+	if !ok {
+		return nagocheck.NewInvalidMetricTypeResult(c, metric, resource)
+	}
+
+	if numericMetric.Value() < c.minSize {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateCritical()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint(fmt.Sprintf("less than %s", nagocheck.FormatBinarySize(c.minSize))),
+		)
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(nagopher.StateOk()),
+		nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+	)
+}
+
+func (c *dumpSizeContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	perfData, err := nagopher.NewPerfData(metric, nil, nil)
+	if err != nil {
+		return nagopher.OptionalPerfData{}, err
+	}
+
+	return nagopher.NewOptionalPerfData(perfData), nil
+}
+
+func newDumpSummarizer(plugin *dumpPlugin, resource *dumpResource) *dumpSummarizer {
+	return &dumpSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+		resource: resource,
+	}
+}
+
+func (s *dumpSummarizer) Ok(check nagopher.Check) string {
+	newest := s.resource.newest
+	var checks []string
+	if s.resource.compressed {
+		checks = append(checks, "gzip intact")
+	}
+	if tables := len(s.ThisPlugin().Tables); tables > 0 {
+		checks = append(checks, fmt.Sprintf("%d tables present", tables))
+	}
+
+	summary := fmt.Sprintf("newest dump %s is %s old with %s", newest.Name(),
+		nagocheck.DurationString(time.Since(newest.ModTime()).Truncate(time.Second)),
+		nagocheck.FormatBinarySize(float64(newest.Size())))
+	if len(checks) > 0 {
+		summary += " (" + strings.Join(checks, ", ") + ")"
+	}
+
+	return summary
+}
+
+func (s *dumpSummarizer) ThisPlugin() *dumpPlugin {
+	return s.Summarizer.Plugin().(*dumpPlugin)
+}
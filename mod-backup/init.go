@@ -0,0 +1,161 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modbackup
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBorgCommand   = "/usr/bin/borg"
+	defaultResticCommand = "/usr/bin/restic"
+	defaultLockWait      = 30 * time.Second
+)
+
+type backupModule struct {
+	nagocheck.Module
+
+	borgCommand   string
+	resticCommand string
+	timeout       time.Duration
+	lockWait      time.Duration
+	lockedState   string
+}
+
+// NewBackupModule instantiates backupModule and all contained plugins
+func NewBackupModule() nagocheck.Module {
+	return &backupModule{
+		Module: nagocheck.NewModule("backup",
+			nagocheck.ModuleDescription("Backup"),
+			nagocheck.ModulePlugin(newSnapshotPlugin("borg", "Borg Repository Freshness")),
+			nagocheck.ModulePlugin(newDumpPlugin()),
+			nagocheck.ModulePlugin(newSnapshotPlugin("restic", "Restic Repository Freshness")),
+		),
+	}
+}
+
+func (m *backupModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("borg-cmd", "[borg] Specifies the command with optional arguments to be used for executing borg. Use "+
+		"comma to separate command and arguments. Repository passphrases are passed using the environment, e.g. "+
+		"BORG_PASSCOMMAND.").
+		Default(defaultBorgCommand).StringVar(&m.borgCommand)
+
+	node.Flag("restic-cmd", "[restic] Specifies the command with optional arguments to be used for executing "+
+		"restic. Use comma to separate command and arguments. Repository passwords are passed using the "+
+		"environment, e.g. RESTIC_PASSWORD_FILE.").
+		Default(defaultResticCommand).StringVar(&m.resticCommand)
+
+	node.Flag("timeout", "Specifies the timeout for each execution of the backup tool, not including the time "+
+		"spent waiting for a locked repository.").
+		Short('t').Default("60s").DurationVar(&m.timeout)
+
+	node.Flag("lock-wait", "Specifies how long the backup tool waits for a repository locked by a running backup or "+
+		"prune. The command timeout gets extended accordingly. Disabled when set to zero.").
+		Default(defaultLockWait.String()).DurationVar(&m.lockWait)
+
+	node.Flag("locked-state", "State being returned when the repository is still locked after waiting.").
+		Default("warning").EnumVar(&m.lockedState, nagocheck.StateNames...)
+}
+
+// commandTimeout returns the timeout for executing the backup tool, which includes the time the tool may spend on
+// waiting for a locked repository, so that it does not get killed while legitimately waiting
+func (m *backupModule) commandTimeout() time.Duration {
+	return m.timeout + m.lockWait
+}
+
+// SudoTemplates returns the templates for listing and checking repositories without any filters. As module flags are
+// not available when generating sudoers entries, the templates are based on the default flags.
+func (m *backupModule) SudoTemplates() []nagocheck.SudoTemplate {
+	defaults := &backupModule{
+		borgCommand:   defaultBorgCommand,
+		resticCommand: defaultResticCommand,
+		lockWait:      defaultLockWait,
+	}
+
+	return []nagocheck.SudoTemplate{
+		defaults.borgListTemplate(""),
+		defaults.borgCheckTemplate(),
+		defaults.resticSnapshotsTemplate(nil, nil),
+		defaults.resticCheckTemplate(),
+	}
+}
+
+// borgListTemplate returns the template for listing all archives of a borg repository, optionally limited to archives
+// matching the given glob pattern
+func (m *backupModule) borgListTemplate(globArchives string) nagocheck.SudoTemplate {
+	command := append(strings.Split(m.borgCommand, ","), "list", "--json")
+	command = append(command, m.borgLockArgs()...)
+	if globArchives != "" {
+		command = append(command, "--glob-archives", globArchives)
+	}
+
+	return nagocheck.NewSudoTemplate("borg-list", command, "*")
+}
+
+// borgCheckTemplate returns the template for checking the consistency of a borg repository, which skips verifying the
+// archives as this would take way too long for being executed by a monitoring system
+func (m *backupModule) borgCheckTemplate() nagocheck.SudoTemplate {
+	command := append(strings.Split(m.borgCommand, ","), "check", "--repository-only")
+	command = append(command, m.borgLockArgs()...)
+
+	return nagocheck.NewSudoTemplate("borg-check", command, "*")
+}
+
+func (m *backupModule) borgLockArgs() []string {
+	if m.lockWait <= 0 {
+		return nil
+	}
+
+	return []string{"--lock-wait", strconv.Itoa(int(math.Ceil(m.lockWait.Seconds())))}
+}
+
+// resticSnapshotsTemplate returns the template for listing all snapshots of a restic repository, optionally limited to
+// snapshots of the given hosts and tags
+func (m *backupModule) resticSnapshotsTemplate(hosts []string, tags []string) nagocheck.SudoTemplate {
+	command := append(strings.Split(m.resticCommand, ","), "snapshots", "--json")
+	command = append(command, m.resticLockArgs()...)
+	for _, host := range hosts {
+		command = append(command, "--host", host)
+	}
+	for _, tag := range tags {
+		command = append(command, "--tag", tag)
+	}
+
+	return nagocheck.NewSudoTemplate("restic-snapshots", append(command, "--repo"), "*")
+}
+
+// resticCheckTemplate returns the template for checking the consistency of a restic repository
+func (m *backupModule) resticCheckTemplate() nagocheck.SudoTemplate {
+	command := append(strings.Split(m.resticCommand, ","), "check")
+	command = append(command, m.resticLockArgs()...)
+
+	return nagocheck.NewSudoTemplate("restic-check", append(command, "--repo"), "*")
+}
+
+func (m *backupModule) resticLockArgs() []string {
+	if m.lockWait <= 0 {
+		return nil
+	}
+
+	return []string{"--retry-lock", m.lockWait.String()}
+}
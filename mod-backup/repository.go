@@ -0,0 +1,182 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modbackup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagocheck/nagocheck/transport"
+	"strings"
+	"time"
+)
+
+// Repository represents a backup repository, which is accessed by executing the respective backup tool
+type Repository interface {
+	Snapshots() ([]Snapshot, error)
+	Check() error
+}
+
+// Snapshot contains the metadata of a single snapshot (restic) or archive (borg) within a repository
+type Snapshot struct {
+	Name string
+	Time time.Time
+}
+
+type toolRepository struct {
+	transport       transport.Transport
+	timeout         time.Duration
+	location        string
+	listCommand     nagocheck.SudoTemplate
+	checkCommand    nagocheck.SudoTemplate
+	parseSnapshots  func(output string) ([]Snapshot, error)
+	jsonStartMarker string
+}
+
+// errRepositoryLocked is returned when the backup tool could not acquire the repository lock within the lock wait time
+var errRepositoryLocked = errors.New("repository is locked")
+
+// repositoryLockMessages contains the messages of borg and restic indicating that the repository lock could not be
+// acquired, e.g. due to a running backup or prune
+var repositoryLockMessages = []string{
+	"failed to create/acquire the lock",
+	"repository is already locked",
+	"unable to create lock",
+}
+
+// borgTimeLayout is used by borg for archive timestamps, which are given in local time without time zone
+const borgTimeLayout = "2006-01-02T15:04:05.999999"
+
+// NewBorgRepository instantiates a Repository which uses borg for accessing the repository at the given location
+func NewBorgRepository(transport transport.Transport, timeout time.Duration, location string,
+	listCommand nagocheck.SudoTemplate, checkCommand nagocheck.SudoTemplate) Repository {
+	return &toolRepository{
+		transport:       transport,
+		timeout:         timeout,
+		location:        location,
+		listCommand:     listCommand,
+		checkCommand:    checkCommand,
+		parseSnapshots:  parseBorgArchives,
+		jsonStartMarker: "{",
+	}
+}
+
+// NewResticRepository instantiates a Repository which uses restic for accessing the repository at the given location
+func NewResticRepository(transport transport.Transport, timeout time.Duration, location string,
+	listCommand nagocheck.SudoTemplate, checkCommand nagocheck.SudoTemplate) Repository {
+	return &toolRepository{
+		transport:       transport,
+		timeout:         timeout,
+		location:        location,
+		listCommand:     listCommand,
+		checkCommand:    checkCommand,
+		parseSnapshots:  parseResticSnapshots,
+		jsonStartMarker: "[",
+	}
+}
+
+func (r *toolRepository) Snapshots() ([]Snapshot, error) {
+	output, err := r.execute(r.listCommand)
+	if err != nil {
+		return nil, err
+	}
+
+	// Warnings of the backup tool are written to stderr, which precede the JSON output
+	if index := strings.Index(output, r.jsonStartMarker); index != -1 {
+		output = output[index:]
+	}
+
+	snapshots, err := r.parseSnapshots(output)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse snapshots: %s", err.Error())
+	}
+
+	return snapshots, nil
+}
+
+func (r *toolRepository) Check() error {
+	_, err := r.execute(r.checkCommand)
+	return err
+}
+
+func (r *toolRepository) execute(template nagocheck.SudoTemplate) (string, error) {
+	command, err := template.Build(r.location)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := r.transport.Execute(r.timeout, command)
+	if err != nil {
+		lowerOutput := strings.ToLower(output)
+		for _, message := range repositoryLockMessages {
+			if strings.Contains(lowerOutput, message) {
+				return output, errRepositoryLocked
+			}
+		}
+
+		sanitizedOutput := strings.Replace(strings.TrimSpace(output), "\n", " ", -1)
+		return output, fmt.Errorf("command execution failed: %s (%s)", err.Error(), sanitizedOutput)
+	}
+
+	return output, nil
+}
+
+func parseBorgArchives(output string) (snapshots []Snapshot, _ error) {
+	var data struct {
+		Archives []struct {
+			Name  string `json:"name"`
+			Start string `json:"start"`
+		} `json:"archives"`
+	}
+	if err := json.Unmarshal([]byte(output), &data); err != nil {
+		return nil, err
+	}
+
+	for _, archive := range data.Archives {
+		// Newer borg releases include the time zone, while older ones use local time
+		timestamp, err := time.Parse(time.RFC3339Nano, archive.Start)
+		if err != nil {
+			timestamp, err = time.ParseInLocation(borgTimeLayout, archive.Start, time.Local)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp of archive [%s]: %s", archive.Name, err.Error())
+		}
+
+		snapshots = append(snapshots, Snapshot{Name: archive.Name, Time: timestamp})
+	}
+
+	return snapshots, nil
+}
+
+func parseResticSnapshots(output string) (snapshots []Snapshot, _ error) {
+	var data []struct {
+		ShortID string    `json:"short_id"`
+		Time    time.Time `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(output), &data); err != nil {
+		return nil, err
+	}
+
+	for _, snapshot := range data {
+		snapshots = append(snapshots, Snapshot{Name: snapshot.ShortID, Time: snapshot.Time})
+	}
+
+	return snapshots, nil
+}
@@ -0,0 +1,232 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modbackup
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"time"
+)
+
+type snapshotPlugin struct {
+	nagocheck.Plugin
+
+	tool string
+
+	Repository   string
+	Check        bool
+	GlobArchives string
+	Hosts        []string
+	Tags         []string
+}
+
+type snapshotResource struct {
+	nagocheck.Resource
+
+	// snapshots is nil if they could not be listed due to a locked repository
+	locked      bool
+	snapshots   []Snapshot
+	newest      Snapshot
+	checkResult string
+}
+
+type snapshotSummarizer struct {
+	nagocheck.Summarizer
+
+	resource *snapshotResource
+}
+
+func newSnapshotPlugin(tool string, description string) *snapshotPlugin {
+	return &snapshotPlugin{
+		Plugin: nagocheck.NewPlugin(tool,
+			nagocheck.PluginDescription(description),
+			nagocheck.PluginDurationThresholds(true),
+		),
+		tool: tool,
+	}
+}
+
+func (p *snapshotPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("repository", "Location of the repository as understood by "+p.tool+".").
+		Required().StringVar(&p.Repository)
+
+	node.Flag("check", "Additionally verify the consistency of the repository, which may take a while for large "+
+		"repositories and therefore should be scheduled less frequently.").
+		BoolVar(&p.Check)
+
+	switch p.tool {
+	case "borg":
+		node.Flag("glob-archives", "Only consider archives whose name matches the given shell pattern.").
+			Short('a').StringVar(&p.GlobArchives)
+	case "restic":
+		node.Flag("host", "Only consider snapshots of the given host. Can be specified multiple times.").
+			StringsVar(&p.Hosts)
+		node.Flag("tag", "Only consider snapshots with the given tag. Can be specified multiple times.").
+			StringsVar(&p.Tags)
+	}
+}
+
+func (p *snapshotPlugin) DefineCheck() nagopher.Check {
+	lockedState, err := nagocheck.ParseState(p.ThisModule().lockedState)
+	if err != nil {
+		lockedState = nagopher.StateWarning()
+	}
+
+	minimumSnapshots := nagopher.NewBounds(nagopher.LowerBound(1), nagopher.UpperBound(math.Inf(1)))
+	resource := newSnapshotResource(p)
+
+	check := nagopher.NewCheck("backup", newSnapshotSummarizer(p, resource))
+	check.AttachResources(resource)
+	check.AttachContexts(
+		newAgeContext(p, resource.describeNewest,
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		),
+		nagocheck.NewHiddenScalarContext(p, "snapshots", nil, &minimumSnapshots),
+		nagopher.NewStringMatchContext("check", nagopher.StateCritical(), []string{"PASSED"}),
+		nagopher.NewStringMatchContext("lock", lockedState, []string{"UNLOCKED"}),
+	)
+
+	return check
+}
+
+// repository instantiates the repository using the backup tool of this plugin
+func (p *snapshotPlugin) repository() Repository {
+	module := p.ThisModule()
+	transport := nagocheck.NewTransport(p.tool)
+
+	if p.tool == "borg" {
+		return NewBorgRepository(transport, module.commandTimeout(), p.Repository,
+			module.borgListTemplate(p.GlobArchives), module.borgCheckTemplate())
+	}
+
+	return NewResticRepository(transport, module.commandTimeout(), p.Repository,
+		module.resticSnapshotsTemplate(p.Hosts, p.Tags), module.resticCheckTemplate())
+}
+
+func (p *snapshotPlugin) ThisModule() *backupModule {
+	return p.Plugin.Module().(*backupModule)
+}
+
+func newSnapshotResource(plugin *snapshotPlugin) *snapshotResource {
+	return &snapshotResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *snapshotResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(warnings); err != nil {
+		return metrics, err
+	}
+
+	if r.locked {
+		metrics = append(metrics, nagopher.MustNewStringMetric("lock", "LOCKED", ""))
+	}
+	if r.snapshots == nil {
+		return metrics, nil
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("snapshots", float64(len(r.snapshots)), "", nil, ""),
+	)
+	if len(r.snapshots) > 0 {
+		valueRange := nagopher.NewBounds(nagopher.LowerBound(0))
+		metrics = append(metrics,
+			nagopher.MustNewNumericMetric("age", math.Max(0, math.Floor(time.Since(r.newest.Time).Seconds())),
+				"s", &valueRange, ""),
+		)
+	}
+	if r.checkResult != "" {
+		metrics = append(metrics, nagopher.MustNewStringMetric("check", r.checkResult, ""))
+	}
+
+	return metrics, nil
+}
+
+func (r *snapshotResource) Collect(warnings nagopher.WarningCollection) error {
+	plugin := r.ThisPlugin()
+	repository := plugin.repository()
+
+	snapshots, err := repository.Snapshots()
+	if err == errRepositoryLocked {
+		r.locked = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	r.snapshots = append([]Snapshot{}, snapshots...)
+
+	for _, snapshot := range r.snapshots {
+		if snapshot.Time.After(r.newest.Time) {
+			r.newest = snapshot
+		}
+	}
+
+	if plugin.Check {
+		r.checkResult = "PASSED"
+		if err := repository.Check(); err == errRepositoryLocked {
+			r.locked = true
+		} else if err != nil {
+			r.checkResult = "FAILED"
+			warnings.Add(nagopher.NewWarning("repository check failed: %s", err.Error()))
+		}
+	}
+
+	return nil
+}
+
+// describeNewest returns the subject of the age metric, which is the newest snapshot
+func (r *snapshotResource) describeNewest() string {
+	return "newest snapshot " + r.newest.Name
+}
+
+func (r *snapshotResource) ThisPlugin() *snapshotPlugin {
+	return r.Resource.Plugin().(*snapshotPlugin)
+}
+
+func newSnapshotSummarizer(plugin *snapshotPlugin, resource *snapshotResource) *snapshotSummarizer {
+	return &snapshotSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+		resource: resource,
+	}
+}
+
+func (s *snapshotSummarizer) Ok(check nagopher.Check) string {
+	if s.resource.snapshots == nil {
+		return fmt.Sprintf("%s is locked by another process", s.ThisPlugin().Repository)
+	}
+
+	age := check.Results().GetNumericMetricValue("age").OrElse(0)
+	summary := fmt.Sprintf("newest of %d snapshots in %s is %s old", len(s.resource.snapshots),
+		s.ThisPlugin().Repository, nagocheck.DurationString(time.Duration(age)*time.Second))
+	if s.resource.checkResult != "" {
+		summary += ", check passed"
+	}
+
+	return summary
+}
+
+func (s *snapshotSummarizer) ThisPlugin() *snapshotPlugin {
+	return s.Summarizer.Plugin().(*snapshotPlugin)
+}
@@ -0,0 +1,296 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modcups
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	ippOperationGetJobs         = 0x000a
+	ippOperationCUPSGetPrinters = 0x4002
+
+	ippTagOperation    = 0x01
+	ippTagJob          = 0x02
+	ippTagEnd          = 0x03
+	ippTagPrinter      = 0x04
+	ippTagInteger      = 0x21
+	ippTagBoolean      = 0x22
+	ippTagEnum         = 0x23
+	ippTagDateTime     = 0x31
+	ippTagKeyword      = 0x44
+	ippTagURI          = 0x45
+	ippTagCharset      = 0x47
+	ippTagLanguage     = 0x48
+	ippStatusNotFound  = 0x0406
+	maxIPPResponseSize = 16 * 1024 * 1024
+)
+
+type ippClient struct {
+	url        string
+	printerURI string
+	client     *http.Client
+	requestID  uint32
+}
+
+type ippOptions struct {
+	host     string
+	port     uint16
+	useTLS   bool
+	insecure bool
+	timeout  time.Duration
+}
+
+// ippAttribute represents a named attribute of an IPP response with all of its values
+type ippAttribute struct {
+	Tag    byte
+	Values [][]byte
+}
+
+// ippGroup contains the attributes of a single object of an IPP response, e.g. a printer or a job
+type ippGroup map[string]ippAttribute
+
+// ippRequest builds the binary encoding of an IPP request as specified by RFC 8010
+type ippRequest struct {
+	buffer bytes.Buffer
+}
+
+func newIPPClient(options ippOptions) *ippClient {
+	scheme := "http"
+	if options.useTLS {
+		scheme = "https"
+	}
+	hostPort := net.JoinHostPort(options.host, strconv.Itoa(int(options.port)))
+
+	return &ippClient{
+		url:        scheme + "://" + hostPort + "/",
+		printerURI: "ipp://" + hostPort + "/",
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: options.insecure}},
+			Timeout:   options.timeout,
+		},
+	}
+}
+
+// GetPrinters returns the attributes of all printers and classes known to the CUPS server
+func (c *ippClient) GetPrinters(attributes ...string) ([]ippGroup, error) {
+	request := c.newRequest(ippOperationCUPSGetPrinters)
+	request.Add(ippTagKeyword, "requested-attributes", attributes...)
+
+	return c.do(request, ippTagPrinter)
+}
+
+// GetJobs returns the attributes of all jobs on all printers which have not been completed yet
+func (c *ippClient) GetJobs(attributes ...string) ([]ippGroup, error) {
+	request := c.newRequest(ippOperationGetJobs)
+	request.Add(ippTagURI, "printer-uri", c.printerURI)
+	request.Add(ippTagKeyword, "which-jobs", "not-completed")
+	request.Add(ippTagKeyword, "requested-attributes", attributes...)
+
+	return c.do(request, ippTagJob)
+}
+
+func (c *ippClient) newRequest(operation uint16) *ippRequest {
+	c.requestID++
+
+	request := &ippRequest{}
+	request.buffer.Write([]byte{2, 0})
+	_ = binary.Write(&request.buffer, binary.BigEndian, operation)
+	_ = binary.Write(&request.buffer, binary.BigEndian, c.requestID)
+	request.buffer.WriteByte(ippTagOperation)
+	request.Add(ippTagCharset, "attributes-charset", "utf-8")
+	request.Add(ippTagLanguage, "attributes-natural-language", "en")
+
+	return request
+}
+
+// Add appends an attribute with the given values to the request, where additional values have an empty name
+func (r *ippRequest) Add(tag byte, name string, values ...string) {
+	for index, value := range values {
+		if index > 0 {
+			name = ""
+		}
+
+		r.buffer.WriteByte(tag)
+		_ = binary.Write(&r.buffer, binary.BigEndian, uint16(len(name)))
+		r.buffer.WriteString(name)
+		_ = binary.Write(&r.buffer, binary.BigEndian, uint16(len(value)))
+		r.buffer.WriteString(value)
+	}
+}
+
+func (c *ippClient) do(request *ippRequest, groupTag byte) ([]ippGroup, error) {
+	request.buffer.WriteByte(ippTagEnd)
+
+	response, err := c.client.Post(c.url, "application/ipp", bytes.NewReader(request.buffer.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("could not query CUPS server: %s", err.Error())
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxIPPResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("could not read response: %s", err.Error())
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CUPS server responded with HTTP status %d", response.StatusCode)
+	}
+
+	status, groups, err := parseIPPResponse(body)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse IPP response: %s", err.Error())
+	}
+
+	// CUPS reports a missing object instead of an empty list, e.g. if no printers have been added yet
+	if status == ippStatusNotFound {
+		return nil, nil
+	}
+	if status >= 0x0100 {
+		message := ""
+		if operation, ok := groups[ippTagOperation]; ok && len(operation) > 0 {
+			message = operation[0].String("status-message")
+		}
+		return nil, fmt.Errorf("CUPS server responded with IPP status 0x%04x: %s", status, message)
+	}
+
+	return groups[groupTag], nil
+}
+
+// parseIPPResponse parses the binary encoding of an IPP response and returns its status code and all attribute groups
+// by their delimiter tag
+func parseIPPResponse(data []byte) (status uint16, groups map[byte][]ippGroup, _ error) {
+	if len(data) < 8 {
+		return 0, nil, fmt.Errorf("response is too short")
+	}
+
+	status = binary.BigEndian.Uint16(data[2:4])
+	groups = make(map[byte][]ippGroup)
+	data = data[8:]
+
+	var group ippGroup
+	var lastName string
+	for len(data) > 0 {
+		tag := data[0]
+		data = data[1:]
+
+		// Delimiter tags start a new group of attributes
+		if tag < 0x10 {
+			if tag == ippTagEnd {
+				return status, groups, nil
+			}
+
+			group = make(ippGroup)
+			groups[tag] = append(groups[tag], group)
+			lastName = ""
+			continue
+		}
+
+		if len(data) < 2 {
+			return 0, nil, fmt.Errorf("truncated attribute")
+		}
+		nameLength := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+nameLength+2 {
+			return 0, nil, fmt.Errorf("truncated attribute")
+		}
+		name := string(data[2 : 2+nameLength])
+		data = data[2+nameLength:]
+
+		valueLength := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+valueLength {
+			return 0, nil, fmt.Errorf("truncated attribute")
+		}
+		value := data[2 : 2+valueLength]
+		data = data[2+valueLength:]
+
+		if group == nil {
+			return 0, nil, fmt.Errorf("attribute outside of group")
+		}
+
+		// Attributes without name are additional values of the previous attribute
+		if name == "" {
+			name = lastName
+		}
+		attribute := group[name]
+		if len(attribute.Values) == 0 {
+			attribute.Tag = tag
+		}
+		attribute.Values = append(attribute.Values, value)
+		group[name] = attribute
+		lastName = name
+	}
+
+	return 0, nil, fmt.Errorf("missing end of attributes")
+}
+
+// String returns the first value of the given attribute as string or an empty string, if it does not exist
+func (g ippGroup) String(name string) string {
+	if attribute, ok := g[name]; ok && len(attribute.Values) > 0 {
+		return string(attribute.Values[0])
+	}
+
+	return ""
+}
+
+// Integer returns the first value of the given integer or enum attribute, if it exists
+func (g ippGroup) Integer(name string) (int32, bool) {
+	attribute, ok := g[name]
+	if !ok || len(attribute.Values) == 0 || len(attribute.Values[0]) != 4 ||
+		(attribute.Tag != ippTagInteger && attribute.Tag != ippTagEnum) {
+		return 0, false
+	}
+
+	return int32(binary.BigEndian.Uint32(attribute.Values[0])), true
+}
+
+// Boolean returns the first value of the given boolean attribute, if it exists
+func (g ippGroup) Boolean(name string) (bool, bool) {
+	attribute, ok := g[name]
+	if !ok || len(attribute.Values) == 0 || len(attribute.Values[0]) != 1 || attribute.Tag != ippTagBoolean {
+		return false, false
+	}
+
+	return attribute.Values[0][0] != 0, true
+}
+
+// Time returns the first value of the given dateTime attribute as specified by RFC 2579, if it exists
+func (g ippGroup) Time(name string) (time.Time, bool) {
+	attribute, ok := g[name]
+	if !ok || len(attribute.Values) == 0 || len(attribute.Values[0]) != 11 || attribute.Tag != ippTagDateTime {
+		return time.Time{}, false
+	}
+
+	value := attribute.Values[0]
+	offset := (int(value[9])*60 + int(value[10])) * 60
+	if value[8] == '-' {
+		offset = -offset
+	}
+
+	return time.Date(int(binary.BigEndian.Uint16(value)), time.Month(value[2]), int(value[3]), int(value[4]),
+		int(value[5]), int(value[6]), int(value[7])*int(100*time.Millisecond), time.FixedZone("", offset)), true
+}
@@ -0,0 +1,71 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modcups
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+	"time"
+)
+
+type cupsModule struct {
+	nagocheck.Module
+
+	host     string
+	port     uint16
+	useTLS   bool
+	insecure bool
+	timeout  time.Duration
+}
+
+// NewCUPSModule instantiates cupsModule and all contained plugins
+func NewCUPSModule() nagocheck.Module {
+	return &cupsModule{
+		Module: nagocheck.NewModule("cups",
+			nagocheck.ModuleDescription("CUPS / IPP"),
+			nagocheck.ModulePlugin(newQueuePlugin()),
+		),
+	}
+}
+
+func (m *cupsModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("host", "Specifies the hostname or address of the CUPS server.").
+		Short('H').Default("localhost").StringVar(&m.host)
+
+	node.Flag("port", "Specifies the port of the CUPS server.").
+		Short('p').Default("631").Uint16Var(&m.port)
+
+	node.Flag("tls", "Connect to the CUPS server using IPP over HTTPS.").
+		BoolVar(&m.useTLS)
+
+	node.Flag("insecure", "Skip verification of the TLS certificate presented by the CUPS server.").
+		BoolVar(&m.insecure)
+
+	node.Flag("timeout", "Specifies the timeout for each request against the CUPS server.").
+		Short('t').Default("10s").DurationVar(&m.timeout)
+}
+
+// options returns the connection options of the IPP client based on the module flags
+func (m *cupsModule) options() ippOptions {
+	return ippOptions{
+		host:     m.host,
+		port:     m.port,
+		useTLS:   m.useTLS,
+		insecure: m.insecure,
+		timeout:  m.timeout,
+	}
+}
@@ -0,0 +1,273 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modcups
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type queuePlugin struct {
+	nagocheck.Plugin
+
+	PrinterNames []string
+	Exclude      *regexp.Regexp
+	AgeWarning   nagopher.OptionalBounds
+	AgeCritical  nagopher.OptionalBounds
+}
+
+type queueResource struct {
+	nagocheck.Resource
+
+	printers []cupsPrinter
+}
+
+type queueSummarizer struct {
+	nagocheck.Summarizer
+}
+
+// cupsPrinter contains the state and job backlog of a single printer or class
+type cupsPrinter struct {
+	name      string
+	state     string
+	message   string
+	jobs      int
+	oldestJob time.Time
+}
+
+// printerStates maps the values of the IPP attribute printer-state to their names
+var printerStates = map[int32]string{3: "IDLE", 4: "PROCESSING", 5: "STOPPED"}
+
+func newQueuePlugin() *queuePlugin {
+	return &queuePlugin{
+		Plugin: nagocheck.NewPlugin("queue",
+			nagocheck.PluginDescription("Printer Queues"),
+			nagocheck.PluginHysteresis(true),
+		),
+	}
+}
+
+func (p *queuePlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("printer", "Names of the printers or classes which should be checked. Defaults to all printers known "+
+		"to the CUPS server.").
+		StringsVar(&p.PrinterNames)
+
+	node.Flag("exclude", "Regular expression matching the names of printers which should be ignored. Only applies "+
+		"when no printer names have been given.").
+		RegexpVar(&p.Exclude)
+
+	nagocheck.DurationBoundsVar(node.Flag("age-warning", "Warning threshold for the age of the oldest pending job "+
+		"per printer, formatted as Nagios range specifier using durations like 30m.").
+		Default("30m"), &p.AgeWarning)
+
+	nagocheck.DurationBoundsVar(node.Flag("age-critical", "Critical threshold for the age of the oldest pending job "+
+		"per printer, formatted as Nagios range specifier using durations like 2h.").
+		Default("2h"), &p.AgeCritical)
+}
+
+func (p *queuePlugin) DefineCheck() nagopher.Check {
+	check := nagopher.NewCheck("queue", newQueueSummarizer(p))
+	check.AttachResources(newQueueResource(p))
+	check.AttachContexts(
+		nagopher.NewStringMatchContext("state", nagopher.StateCritical(), []string{"IDLE", "PROCESSING"}),
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"jobs",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+		nagopher.NewScalarContext("job_age",
+			nagopher.OptionalBoundsPtr(p.AgeWarning),
+			nagopher.OptionalBoundsPtr(p.AgeCritical),
+		),
+	)
+
+	return check
+}
+
+func (p *queuePlugin) ThisModule() *cupsModule {
+	return p.Plugin.Module().(*cupsModule)
+}
+
+func newQueueResource(plugin *queuePlugin) *queueResource {
+	return &queueResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *queueResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(math.Inf(1)))
+
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	for _, printer := range r.printers {
+		if printer.state == "STOPPED" && printer.message != "" {
+			warnings.Add(nagopher.NewWarning("printer %s stopped: %s", printer.name, printer.message))
+		}
+
+		age := 0.0
+		if !printer.oldestJob.IsZero() {
+			age = math.Max(0, nagocheck.Round(time.Since(printer.oldestJob).Seconds(), 0))
+		}
+
+		metrics = append(metrics, r.Section(printer.name,
+			nagopher.MustNewStringMetric(printer.name+"_state", printer.state, "state"),
+			nagopher.MustNewNumericMetric(printer.name+"_jobs", float64(printer.jobs), "", &valueRange, "jobs"),
+			nagopher.MustNewNumericMetric(printer.name+"_oldest_job", age, "s", &valueRange, "job_age"),
+		)...)
+	}
+
+	return metrics, nil
+}
+
+// Collect fetches the state of all requested printers and their pending jobs, where printers which do not exist are
+// being reported with the state 'MISSING' and printers rejecting new jobs with the state 'REJECTING'
+func (r *queueResource) Collect() error {
+	plugin := r.ThisPlugin()
+	client := newIPPClient(plugin.ThisModule().options())
+
+	printerGroups, err := client.GetPrinters("printer-name", "printer-state", "printer-state-message",
+		"printer-is-accepting-jobs")
+	if err != nil {
+		return err
+	}
+
+	r.printers = nil
+	indexes := make(map[string]int)
+	for _, group := range printerGroups {
+		printer := cupsPrinter{name: group.String("printer-name"), message: group.String("printer-state-message")}
+		if !r.isRequested(printer.name) {
+			continue
+		}
+
+		state, _ := group.Integer("printer-state")
+		if printer.state = printerStates[state]; printer.state == "" {
+			printer.state = fmt.Sprintf("STATE_%d", state)
+		}
+		if accepting, ok := group.Boolean("printer-is-accepting-jobs"); ok && !accepting && printer.state != "STOPPED" {
+			printer.state = "REJECTING"
+		}
+
+		indexes[strings.ToLower(printer.name)] = len(r.printers)
+		r.printers = append(r.printers, printer)
+	}
+
+	for _, printerName := range plugin.PrinterNames {
+		if _, ok := indexes[strings.ToLower(printerName)]; !ok {
+			indexes[strings.ToLower(printerName)] = len(r.printers)
+			r.printers = append(r.printers, cupsPrinter{name: printerName, state: "MISSING"})
+		}
+	}
+
+	if len(r.printers) == 0 {
+		return fmt.Errorf("no printers available")
+	}
+
+	jobGroups, err := client.GetJobs("job-id", "job-printer-uri", "time-at-creation", "date-time-at-creation")
+	if err != nil {
+		return err
+	}
+
+	for _, group := range jobGroups {
+		index, ok := indexes[strings.ToLower(path.Base(group.String("job-printer-uri")))]
+		if !ok {
+			continue
+		}
+
+		// CUPS reports time-at-creation as UNIX timestamp, while it is relative to the printer uptime per RFC 8011
+		createdAt, ok := group.Time("date-time-at-creation")
+		if !ok {
+			if seconds, ok := group.Integer("time-at-creation"); ok {
+				createdAt = time.Unix(int64(seconds), 0)
+			}
+		}
+
+		printer := &r.printers[index]
+		printer.jobs++
+		if !createdAt.IsZero() && (printer.oldestJob.IsZero() || createdAt.Before(printer.oldestJob)) {
+			printer.oldestJob = createdAt
+		}
+	}
+
+	return nil
+}
+
+func (r *queueResource) isRequested(name string) bool {
+	plugin := r.ThisPlugin()
+	if len(plugin.PrinterNames) == 0 {
+		return plugin.Exclude == nil || !plugin.Exclude.MatchString(name)
+	}
+
+	for _, printerName := range plugin.PrinterNames {
+		if strings.EqualFold(printerName, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *queueResource) ThisPlugin() *queuePlugin {
+	return r.Resource.Plugin().(*queuePlugin)
+}
+
+func newQueueSummarizer(plugin *queuePlugin) *queueSummarizer {
+	return &queueSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *queueSummarizer) Ok(check nagopher.Check) string {
+	printers, jobs, oldestJob := 0, 0.0, 0.0
+	for _, result := range check.Results().Get() {
+		metric, err := result.Metric().Get()
+		if err != nil {
+			continue
+		}
+
+		numericMetric, _ := metric.(nagopher.NumericMetric)
+		switch metric.ContextName() {
+		case "state":
+			printers++
+		case "jobs":
+			jobs += numericMetric.Value()
+		case "job_age":
+			oldestJob = math.Max(oldestJob, numericMetric.Value())
+		}
+	}
+
+	printerNoun := "printers"
+	if printers == 1 {
+		printerNoun = "printer"
+	}
+	if jobs == 0 {
+		return fmt.Sprintf("%d %s ready without pending jobs", printers, printerNoun)
+	}
+
+	return fmt.Sprintf("%d %s ready with %.0f pending jobs, oldest waiting for %s", printers, printerNoun, jobs,
+		nagocheck.DurationString(time.Duration(oldestJob)*time.Second))
+}
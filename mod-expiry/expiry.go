@@ -0,0 +1,232 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modexpiry
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"time"
+)
+
+// expiryItem represents a single token, license or certificate which expires at the given point in time
+type expiryItem struct {
+	name   string
+	expiry time.Time
+}
+
+// expiryPlugin is implemented by all plugins of this module, which only differ in the source of their expiry items
+type expiryPlugin interface {
+	nagocheck.Plugin
+	Items() ([]expiryItem, error)
+}
+
+type expiryResource struct {
+	nagocheck.Resource
+
+	items map[string]expiryItem
+}
+
+type expiryContext struct {
+	nagocheck.Context
+
+	resource          *expiryResource
+	warningThreshold  nagopher.OptionalBounds
+	criticalThreshold nagopher.OptionalBounds
+}
+
+type expirySummarizer struct {
+	nagocheck.Summarizer
+
+	resource *expiryResource
+}
+
+// newExpiryCheck defines the check shared by all plugins of this module, which evaluates the remaining lifetime of
+// each item against the duration thresholds of the plugin. Expired items are always considered CRITICAL.
+func newExpiryCheck(plugin expiryPlugin) nagopher.Check {
+	resource := newExpiryResource(plugin)
+
+	check := nagopher.NewCheck("expiry", newExpirySummarizer(plugin, resource))
+	check.AttachResources(resource)
+	check.AttachContexts(
+		newExpiryContext(plugin, resource,
+			nagopher.OptionalBoundsPtr(plugin.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(plugin.CriticalThreshold()),
+		),
+	)
+
+	return check
+}
+
+func newExpiryResource(plugin expiryPlugin) *expiryResource {
+	return &expiryResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *expiryResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	items, err := r.Resource.Plugin().(expiryPlugin).Items()
+	if err != nil {
+		return metrics, err
+	}
+
+	if len(items) == 0 {
+		return metrics, fmt.Errorf("no expiry dates found")
+	}
+
+	r.items = make(map[string]expiryItem, len(items))
+	for _, item := range items {
+		metricName := item.name + "_remaining"
+		r.items[metricName] = item
+
+		metrics = append(metrics, r.Section(item.name,
+			nagopher.MustNewNumericMetric(metricName, math.Floor(time.Until(item.expiry).Seconds()), "s", nil, "remaining"),
+		)...)
+	}
+
+	return metrics, nil
+}
+
+// nextItem returns the item which expires first
+func (r *expiryResource) nextItem() (next expiryItem) {
+	for _, item := range r.items {
+		if next.expiry.IsZero() || item.expiry.Before(next.expiry) {
+			next = item
+		}
+	}
+
+	return next
+}
+
+func newExpiryContext(plugin expiryPlugin, resource *expiryResource, warningThreshold *nagopher.Bounds, criticalThreshold *nagopher.Bounds) *expiryContext {
+	expiryContext := &expiryContext{
+		Context:  nagocheck.NewContext(plugin, nagopher.NewBaseContext("remaining", "%<value>s")),
+		resource: resource,
+	}
+
+	if warningThreshold != nil {
+		expiryContext.warningThreshold = nagopher.NewOptionalBounds(*warningThreshold)
+	}
+	if criticalThreshold != nil {
+		expiryContext.criticalThreshold = nagopher.NewOptionalBounds(*criticalThreshold)
+	}
+
+	return expiryContext
+}
+
+func (c *expiryContext) Describe(metric nagopher.Metric) string {
+	item, ok := c.resource.items[metric.Name()]
+	if !ok {
+		return c.Context.Describe(metric)
+	}
+
+	return fmt.Sprintf("%s %s", item.name, describeExpiry(item.expiry))
+}
+
+func (c *expiryContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	numericMetric, ok := metric.(nagopher.NumericMetric)
+	if !ok {
+		return nagocheck.NewInvalidMetricTypeResult(c, metric, resource)
+	}
+
+	emptyBounds := nagopher.NewBounds()
+	warningThreshold := c.warningThreshold.OrElse(emptyBounds)
+	criticalThreshold := c.criticalThreshold.OrElse(emptyBounds)
+
+	if numericMetric.Value() < 0 {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateCritical()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+		)
+	} else if !criticalThreshold.Match(numericMetric.Value()) {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateCritical()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint(c.violationHint(criticalThreshold)),
+		)
+	} else if !warningThreshold.Match(numericMetric.Value()) {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateWarning()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint(c.violationHint(warningThreshold)),
+		)
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(nagopher.StateOk()),
+		nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+	)
+}
+
+func (c *expiryContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	perfData, err := nagopher.NewPerfData(
+		metric,
+		nagopher.OptionalBoundsPtr(c.warningThreshold),
+		nagopher.OptionalBoundsPtr(c.criticalThreshold),
+	)
+
+	if err != nil {
+		return nagopher.OptionalPerfData{}, err
+	}
+
+	return nagopher.NewOptionalPerfData(perfData), nil
+}
+
+func (c *expiryContext) violationHint(threshold nagopher.Bounds) string {
+	upperBounds := threshold.Upper().OrElse(math.NaN())
+	lowerBounds := threshold.Lower().OrElse(math.NaN())
+
+	if math.IsInf(upperBounds, 1) && !math.IsNaN(lowerBounds) {
+		return fmt.Sprintf("less than %s", nagocheck.DurationString(time.Duration(lowerBounds)*time.Second))
+	}
+
+	return threshold.ViolationHint()
+}
+
+func newExpirySummarizer(plugin expiryPlugin, resource *expiryResource) *expirySummarizer {
+	return &expirySummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+		resource: resource,
+	}
+}
+
+func (s *expirySummarizer) Ok(check nagopher.Check) string {
+	next := s.resource.nextItem()
+	if len(s.resource.items) == 1 {
+		return fmt.Sprintf("%s %s", next.name, describeExpiry(next.expiry))
+	}
+
+	return fmt.Sprintf("%d items valid, next: %s %s", len(s.resource.items), next.name, describeExpiry(next.expiry))
+}
+
+// describeExpiry returns a human-readable description of the given expiry date relative to now, which is used by both
+// the summaries and the long output to stay consistent across all plugins
+func describeExpiry(expiry time.Time) string {
+	remaining := time.Until(expiry).Truncate(time.Second)
+	date := expiry.Format("2006-01-02")
+
+	if remaining < 0 {
+		return fmt.Sprintf("expired %s ago (%s)", nagocheck.DurationString(-remaining), date)
+	}
+
+	return fmt.Sprintf("expires in %s (%s)", nagocheck.DurationString(remaining), date)
+}
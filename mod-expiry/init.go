@@ -0,0 +1,39 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modexpiry
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+)
+
+type expiryModule struct {
+	nagocheck.Module
+}
+
+// NewExpiryModule instantiates expiryModule and all contained plugins
+func NewExpiryModule() nagocheck.Module {
+	return &expiryModule{
+		Module: nagocheck.NewModule("expiry",
+			nagocheck.ModuleDescription("Expiry"),
+			nagocheck.ModulePlugin(newJwtPlugin()),
+			nagocheck.ModulePlugin(newLicensePlugin()),
+			nagocheck.ModulePlugin(newKubeconfigPlugin()),
+		),
+	}
+}
@@ -0,0 +1,153 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modexpiry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type jwtPlugin struct {
+	nagocheck.Plugin
+
+	Paths []string
+	Claim string
+}
+
+// jwtExpiryFields and jwtTokenFields contain the fields of JSON token files, e.g. as written by OAuth clients, which either contain the
+// expiry date directly or a JWT carrying it as a claim
+var (
+	jwtExpiryFields = []string{"expiry", "expires_at"}
+	jwtTokenFields  = []string{"access_token", "id_token"}
+)
+
+func newJwtPlugin() *jwtPlugin {
+	return &jwtPlugin{
+		Plugin: nagocheck.NewPlugin("jwt",
+			nagocheck.PluginDescription("JWT/OAuth Token"),
+			nagocheck.PluginDurationThresholds(true),
+		),
+	}
+}
+
+func (p *jwtPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("path", "Path to a file containing either a raw JWT or an OAuth token as JSON object, which carries "+
+		"the expiry date as expiry/expires_at field or within the claims of access_token/id_token.").
+		Required().ExistingFilesVar(&p.Paths)
+
+	node.Flag("claim", "Name of the JWT claim containing the expiry date as UNIX timestamp.").
+		Default("exp").StringVar(&p.Claim)
+}
+
+func (p *jwtPlugin) DefineCheck() nagopher.Check {
+	return newExpiryCheck(p)
+}
+
+func (p *jwtPlugin) Items() (items []expiryItem, _ error) {
+	for _, path := range p.Paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read token file: %s", err.Error())
+		}
+
+		expiry, err := parseTokenExpiry(strings.TrimSpace(string(data)), p.Claim)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse token file [%s]: %s", path, err.Error())
+		}
+
+		items = append(items, expiryItem{name: filepath.Base(path), expiry: expiry})
+	}
+
+	return items, nil
+}
+
+// parseTokenExpiry returns the expiry date of a raw JWT or a JSON token file
+func parseTokenExpiry(content string, claim string) (time.Time, error) {
+	if !strings.HasPrefix(content, "{") {
+		return parseJwtExpiry(content, claim)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &fields); err != nil {
+		return time.Time{}, fmt.Errorf("invalid JSON: %s", err.Error())
+	}
+
+	for _, field := range jwtExpiryFields {
+		if value, ok := fields[field]; ok {
+			return parseTimestamp(value)
+		}
+	}
+
+	for _, field := range jwtTokenFields {
+		if token, ok := fields[field].(string); ok {
+			return parseJwtExpiry(token, claim)
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("neither expiry date nor token found")
+}
+
+// parseJwtExpiry decodes the payload of the given JWT without verifying its signature and returns the given claim
+func parseJwtExpiry(token string, claim string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("invalid JWT: expected 3 parts, got %d", len(parts))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not decode JWT payload: %s", err.Error())
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("could not parse JWT claims: %s", err.Error())
+	}
+
+	value, ok := claims[claim]
+	if !ok {
+		return time.Time{}, fmt.Errorf("JWT does not contain claim [%s]", claim)
+	}
+
+	return parseTimestamp(value)
+}
+
+// parseTimestamp parses a JSON value as either UNIX timestamp or RFC3339 date
+func parseTimestamp(value interface{}) (time.Time, error) {
+	switch value := value.(type) {
+	case float64:
+		return time.Unix(int64(value), 0), nil
+	case string:
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Unix(seconds, 0), nil
+		}
+
+		return time.Parse(time.RFC3339, value)
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported timestamp: %v", value)
+}
@@ -0,0 +1,203 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modexpiry
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type kubeconfigPlugin struct {
+	nagocheck.Plugin
+
+	Path  string
+	Users []string
+}
+
+// kubeconfigUser contains the client certificate of a single user within a kubeconfig file, which is either embedded
+// as base64-encoded PEM data or referenced as a path relative to the kubeconfig file
+type kubeconfigUser struct {
+	name            string
+	certificateData string
+	certificatePath string
+}
+
+var (
+	kubeconfigSectionRE = regexp.MustCompile(`^([A-Za-z-]+):`)
+	kubeconfigNameRE    = regexp.MustCompile(`^\s*-\s+name:\s*(.+?)\s*$`)
+	kubeconfigFieldRE   = regexp.MustCompile(`^\s+(client-certificate(?:-data)?):\s*(.+?)\s*$`)
+)
+
+func newKubeconfigPlugin() *kubeconfigPlugin {
+	return &kubeconfigPlugin{
+		Plugin: nagocheck.NewPlugin("kubeconfig",
+			nagocheck.PluginDescription("Kubeconfig Client Certificates"),
+			nagocheck.PluginDurationThresholds(true),
+		),
+	}
+}
+
+func (p *kubeconfigPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("path", "Path to the kubeconfig file, defaults to the first file of $KUBECONFIG or ~/.kube/config.").
+		StringVar(&p.Path)
+
+	node.Flag("user", "Only check the client certificate of the given kubeconfig user. Can be specified multiple "+
+		"times, defaults to all users with client certificates.").
+		Short('u').StringsVar(&p.Users)
+}
+
+func (p *kubeconfigPlugin) DefineCheck() nagopher.Check {
+	return newExpiryCheck(p)
+}
+
+func (p *kubeconfigPlugin) Items() (items []expiryItem, _ error) {
+	path := p.kubeconfigPath()
+	users, err := parseKubeconfigUsers(path)
+	if err != nil {
+		return nil, err
+	}
+
+	selectedUsers := make(map[string]bool, len(p.Users))
+	for _, user := range p.Users {
+		selectedUsers[user] = true
+	}
+
+	for _, user := range users {
+		if len(selectedUsers) > 0 && !selectedUsers[user.name] {
+			continue
+		}
+
+		certificate, err := user.certificate(filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate of user [%s]: %s", user.name, err.Error())
+		}
+
+		items = append(items, expiryItem{name: user.name, expiry: certificate.NotAfter})
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no client certificates found in kubeconfig [%s]", path)
+	}
+
+	return items, nil
+}
+
+func (p *kubeconfigPlugin) kubeconfigPath() string {
+	if p.Path != "" {
+		return p.Path
+	}
+
+	for _, path := range filepath.SplitList(os.Getenv("KUBECONFIG")) {
+		if path != "" {
+			return path
+		}
+	}
+
+	return filepath.Join(os.Getenv("HOME"), ".kube", "config")
+}
+
+// parseKubeconfigUsers extracts all users with client certificates from a kubeconfig file. As kubeconfig files follow
+// a fixed layout as written by kubectl, a line-based parser is sufficient and avoids depending on a YAML library.
+func parseKubeconfigUsers(path string) (users []kubeconfigUser, rerr error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open kubeconfig: %s", err.Error())
+	}
+	defer func() {
+		if err := file.Close(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	var section string
+	var user *kubeconfigUser
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := kubeconfigSectionRE.FindStringSubmatch(line); match != nil {
+			section = match[1]
+			continue
+		}
+		if section != "users" {
+			continue
+		}
+
+		if match := kubeconfigNameRE.FindStringSubmatch(line); match != nil {
+			users = append(users, kubeconfigUser{name: strings.Trim(match[1], `"'`)})
+			user = &users[len(users)-1]
+		} else if match := kubeconfigFieldRE.FindStringSubmatch(line); match != nil && user != nil {
+			value := strings.Trim(match[2], `"'`)
+			if match[1] == "client-certificate-data" {
+				user.certificateData = value
+			} else {
+				user.certificatePath = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read kubeconfig: %s", err.Error())
+	}
+
+	var result []kubeconfigUser
+	for _, user := range users {
+		if user.certificateData != "" || user.certificatePath != "" {
+			result = append(result, user)
+		}
+	}
+
+	return result, nil
+}
+
+// certificate returns the parsed client certificate of the user, resolving relative paths against the given directory
+func (u kubeconfigUser) certificate(directory string) (*x509.Certificate, error) {
+	var data []byte
+	var err error
+
+	if u.certificateData != "" {
+		data, err = base64.StdEncoding.DecodeString(u.certificateData)
+	} else {
+		path := u.certificatePath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(directory, path)
+		}
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM-encoded certificate found")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
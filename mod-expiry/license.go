@@ -0,0 +1,110 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modexpiry
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type licensePlugin struct {
+	nagocheck.Plugin
+
+	Paths   []string
+	Pattern *regexp.Regexp
+	Format  string
+}
+
+func newLicensePlugin() *licensePlugin {
+	return &licensePlugin{
+		Plugin: nagocheck.NewPlugin("license",
+			nagocheck.PluginDescription("License File"),
+			nagocheck.PluginDurationThresholds(true),
+		),
+	}
+}
+
+func (p *licensePlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("path", "Path to the license file.").
+		Required().ExistingFilesVar(&p.Paths)
+
+	node.Flag("pattern", "Regular expression matching the expiry date within the license file. Uses the capture "+
+		"group named 'date' or otherwise the first capture group, e.g. 'Valid-Until: (\\S+)'.").
+		Short('p').Required().RegexpVar(&p.Pattern)
+
+	node.Flag("format", "Format of the expiry date as Go reference time layout, e.g. 02.01.2006, or 'unix' for "+
+		"UNIX timestamps. Dates without time zone are interpreted as local time.").
+		Short('f').Default("2006-01-02").StringVar(&p.Format)
+}
+
+func (p *licensePlugin) DefineCheck() nagopher.Check {
+	return newExpiryCheck(p)
+}
+
+func (p *licensePlugin) Items() (items []expiryItem, _ error) {
+	for _, path := range p.Paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read license file: %s", err.Error())
+		}
+
+		expiry, err := p.parseExpiry(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse license file [%s]: %s", path, err.Error())
+		}
+
+		items = append(items, expiryItem{name: filepath.Base(path), expiry: expiry})
+	}
+
+	return items, nil
+}
+
+func (p *licensePlugin) parseExpiry(content string) (time.Time, error) {
+	match := p.Pattern.FindStringSubmatch(content)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("pattern did not match")
+	}
+
+	value := match[0]
+	if len(match) > 1 {
+		value = match[1]
+	}
+	for index, name := range p.Pattern.SubexpNames() {
+		if name == "date" {
+			value = match[index]
+		}
+	}
+
+	if p.Format == "unix" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid UNIX timestamp [%s]", value)
+		}
+
+		return time.Unix(seconds, 0), nil
+	}
+
+	return time.ParseInLocation(p.Format, value, time.Local)
+}
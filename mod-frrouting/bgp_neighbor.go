@@ -24,7 +24,8 @@ import (
 	"github.com/snapserv/nagopher"
 	"math"
 	"net"
-	"time"
+	"sort"
+	"strings"
 )
 
 type bgpNeighborPlugin struct {
@@ -35,27 +36,27 @@ type bgpNeighborPlugin struct {
 	IsCritical       bool
 	PrefixLimitRange nagopher.OptionalBounds
 	UptimeRange      nagopher.OptionalBounds
+
+	PrefixHistorySize    int
+	PrefixDeviationRange nagopher.OptionalBounds
+	ReceivedRoutesRange  nagopher.OptionalBounds
 }
 
 type bgpNeighborResource struct {
-	nagocheck.Resource
+	nagocheck.Resource `json:"-"`
 
 	neighbor *BgpNeighbor
-}
-
-type bgpNeighborSummarizer struct {
-	nagocheck.Summarizer
-}
 
-type uptimeContext struct {
-	nagopher.Context
+	PrefixCountHistory []float64 `json:"prefixCountHistory"`
 }
 
 func newBgpNeighborPlugin() *bgpNeighborPlugin {
 	return &bgpNeighborPlugin{
 		Plugin: nagocheck.NewPlugin("bgp-neighbor",
 			nagocheck.PluginDescription("BGP Neighbor"),
+			nagocheck.PluginFlapDetection(true),
 			nagocheck.PluginDefaultThresholds(false),
+			nagocheck.PluginCapacityContexts("prefix_count", "prefix_limit_usage"),
 		),
 	}
 }
@@ -75,10 +76,26 @@ func (p *bgpNeighborPlugin) DefineFlags(node nagocheck.KingpinNode) {
 		"check gets ignored.").
 		Short('l'), &p.PrefixLimitRange)
 
-	nagocheck.NagopherBoundsVar(node.Flag("uptime", "Range for neighbor uptime (state=ESTABLISHED) given as Nagios range "+
-		"specifier. Plugin will return WARNING state in case the range does not match. This allows to alert when a "+
-		"session was recently established.").
+	nagocheck.DurationBoundsVar(node.Flag("uptime", "Range for neighbor uptime (state=ESTABLISHED) given as Nagios range "+
+		"specifier using durations like 15m: or 1d: (seconds by default). Plugin will return WARNING state in case the "+
+		"range does not match. This allows to alert when a session was recently established.").
 		Short('u'), &p.UptimeRange)
+
+	node.Flag("prefix-history", "Amount of previous runs for which the prefix count of an established session is "+
+		"being remembered, used for reporting the minimum/maximum prefix count and the deviation from their mean. "+
+		"Set to zero for disabling the history.").
+		Default("12").IntVar(&p.PrefixHistorySize)
+
+	nagocheck.NagopherBoundsVar(node.Flag("prefix-deviation", "Range for the deviation of the current prefix count "+
+		"from the mean of previous runs in percent, given as Nagios range specifier (e.g. -20:20). Plugin will return "+
+		"WARNING state in case the range does not match, catching route leaks below the prefix limit.").
+		Short('d'), &p.PrefixDeviationRange)
+
+	nagocheck.NagopherBoundsVar(node.Flag("received-routes", "Range for the amount of routes received from the "+
+		"neighbor before applying inbound policies (adj-RIB-in) given as Nagios range specifier. Plugin will return "+
+		"WARNING state in case the range does not match, catching floods of routes which are being filtered by policy "+
+		"but still consume memory. Requires soft-reconfiguration inbound, queried only if specified.").
+		Short('r'), &p.ReceivedRoutesRange)
 }
 
 func (p *bgpNeighborPlugin) DefineCheck() nagopher.Check {
@@ -87,7 +104,7 @@ func (p *bgpNeighborPlugin) DefineCheck() nagopher.Check {
 		problemState = nagopher.StateCritical()
 	}
 
-	check := nagopher.NewCheck("bgp_neighbor", newBgpNeighborSummarizer(p))
+	check := nagopher.NewCheck("bgp_neighbor", nagocheck.NewNeighborSummarizer(p))
 	check.AttachResources(newBgpNeighborResource(p))
 	check.AttachContexts(
 		nagopher.NewStringInfoContext("info_description"),
@@ -97,12 +114,20 @@ func (p *bgpNeighborPlugin) DefineCheck() nagopher.Check {
 		nagopher.NewStringInfoContext("info_reset_reason"),
 		nagopher.NewStringInfoContext("info_notification_reason"),
 
-		nagopher.NewStringMatchContext("state", problemState, []string{"ESTABLISHED"}),
+		nagocheck.NewFlapDetectionContext(p, nagopher.NewStringMatchContext(
+			"state", problemState, []string{"ESTABLISHED"},
+		)),
 		nagopher.NewScalarContext("last_state_change", nil, nil),
 		nagopher.NewScalarContext("prefix_limit_usage", nagopher.OptionalBoundsPtr(p.PrefixLimitRange), nil),
 		nagopher.NewScalarContext("prefix_count", nil, nil),
-
-		newUptimeContext("uptime", nagopher.OptionalBoundsPtr(p.UptimeRange), nil),
+		nagopher.NewScalarContext("prefix_count_min", nil, nil),
+		nagopher.NewScalarContext("prefix_count_max", nil, nil),
+		nagopher.NewScalarContext("prefix_count_deviation", nagopher.OptionalBoundsPtr(p.PrefixDeviationRange), nil),
+		nagopher.NewScalarContext("received_count", nagopher.OptionalBoundsPtr(p.ReceivedRoutesRange), nil),
+		nagopher.NewScalarContext("filtered_count", nil, nil),
+		nagopher.NewStringInfoContext("info_received_routes"),
+
+		nagocheck.NewNeighborUptimeContext("uptime", nagopher.OptionalBoundsPtr(p.UptimeRange), nil),
 	)
 
 	return check
@@ -113,9 +138,12 @@ func (p *bgpNeighborPlugin) ThisModule() *frroutingModule {
 }
 
 func newBgpNeighborResource(plugin *bgpNeighborPlugin) *bgpNeighborResource {
-	return &bgpNeighborResource{
-		Resource: nagocheck.NewResource(plugin),
-	}
+	resource := &bgpNeighborResource{}
+	resource.Resource = nagocheck.NewResource(plugin,
+		nagocheck.ResourcePersistence(plugin.NeighborIP.String(), resource, &resource),
+	)
+
+	return resource
 }
 
 func (r *bgpNeighborResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
@@ -147,9 +175,11 @@ func (r *bgpNeighborResource) Probe(warnings nagopher.WarningCollection) (metric
 		metrics = append(metrics, nagopher.MustNewNumericMetric("prefix_limit_usage", percentage, "%", nil, ""))
 	}
 
-	// Only add uptime metric (redundant with last state change metric) if state=='ESTABLISHED'
+	// Only add uptime metric (redundant with last state change metric) and prefix history if state=='ESTABLISHED'
 	if r.neighbor.OperationalState == "ESTABLISHED" {
 		metrics = append(metrics, nagopher.MustNewNumericMetric("uptime", lastStateChangeSeconds, "s", nil, ""))
+		metrics = append(metrics, r.updatePrefixHistory()...)
+		metrics = append(metrics, r.receivedRoutes(warnings)...)
 	}
 
 	// Display additional information about prefix usage
@@ -176,66 +206,103 @@ func (r *bgpNeighborResource) Probe(warnings nagopher.WarningCollection) (metric
 	return metrics, nil
 }
 
-func (r *bgpNeighborResource) Collect() error {
-	var err error
+// updatePrefixHistory appends the current prefix count to the history and returns the minimum and maximum of all
+// remembered prefix counts as well as the deviation of the current prefix count from the mean of previous runs
+func (r *bgpNeighborResource) updatePrefixHistory() (metrics []nagopher.Metric) {
+	historySize := r.ThisPlugin().PrefixHistorySize
+	if historySize <= 0 {
+		r.PrefixCountHistory = nil
+		return metrics
+	}
 
-	r.neighbor, err = r.Session().GetBgpNeighbor(r.ThisPlugin().NeighborIP.String())
-	return err
-}
+	previous := r.PrefixCountHistory
+	if len(previous) > historySize {
+		previous = previous[len(previous)-historySize:]
+	}
 
-func (r *bgpNeighborResource) Session() Session {
-	return r.ThisPlugin().ThisModule().session
-}
+	current := float64(r.neighbor.PrefixUsageTotal)
+	minimum, maximum, sum := current, current, float64(0)
+	for _, value := range previous {
+		minimum = math.Min(minimum, value)
+		maximum = math.Max(maximum, value)
+		sum += value
+	}
 
-func (r *bgpNeighborResource) ThisPlugin() *bgpNeighborPlugin {
-	return r.Resource.Plugin().(*bgpNeighborPlugin)
-}
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("prefix_count_min", minimum, "", nil, ""),
+		nagopher.MustNewNumericMetric("prefix_count_max", maximum, "", nil, ""),
+	)
+	if mean := sum / float64(len(previous)); len(previous) > 0 && mean > 0 {
+		deviation := nagocheck.Round((current-mean)/mean*100, 2)
+		metrics = append(metrics, nagopher.MustNewNumericMetric("prefix_count_deviation", deviation, "%", nil, ""))
+	}
 
-func newBgpNeighborSummarizer(plugin *bgpNeighborPlugin) *bgpNeighborSummarizer {
-	return &bgpNeighborSummarizer{
-		Summarizer: nagocheck.NewSummarizer(plugin),
+	r.PrefixCountHistory = append(previous, current)
+	if len(r.PrefixCountHistory) > historySize {
+		r.PrefixCountHistory = r.PrefixCountHistory[len(r.PrefixCountHistory)-historySize:]
 	}
+
+	return metrics
 }
 
-func (s *bgpNeighborSummarizer) Ok(check nagopher.Check) string {
-	resultCollection := check.Results()
-
-	lastStateChange := resultCollection.GetNumericMetricValue("last_state_change").OrElse(math.NaN())
-	lastStateChangeString := "N/A"
-	if !math.IsNaN(lastStateChange) {
-		if lastStateChange > 0 {
-			duration, err := time.ParseDuration(fmt.Sprintf("%ds", int(lastStateChange)))
-			if err == nil {
-				lastStateChangeString = nagocheck.DurationString(duration)
-			}
-		} else {
-			lastStateChangeString = "always"
+// receivedRoutes returns the amount of routes received from the neighbor before applying inbound policies, summed up
+// across all address families with soft-reconfiguration inbound, as well as the amount of routes filtered by policy
+func (r *bgpNeighborResource) receivedRoutes(warnings nagopher.WarningCollection) (metrics []nagopher.Metric) {
+	if nagopher.OptionalBoundsPtr(r.ThisPlugin().ReceivedRoutesRange) == nil {
+		return metrics
+	}
+
+	var addressFamilies []string
+	for addressFamily, addressFamilyInfo := range r.neighbor.AddressFamilies {
+		if _, ok := addressFamilyNames[addressFamily]; ok && addressFamilyInfo.SoftReconfigInbound {
+			addressFamilies = append(addressFamilies, addressFamily)
 		}
 	}
+	if len(addressFamilies) == 0 {
+		warnings.Add(nagopher.NewWarning("received routes unavailable, soft-reconfiguration inbound not enabled"))
+		return metrics
+	}
+	sort.Strings(addressFamilies)
+
+	var receivedCount, acceptedCount uint64
+	var familyNames []string
+	for _, addressFamily := range addressFamilies {
+		count, err := r.Session().GetBgpReceivedRouteCount(r.ThisPlugin().NeighborIP.String(), addressFamily)
+		if err != nil {
+			warnings.Add(nagopher.NewWarning("%s", err.Error()))
+			return metrics
+		}
+
+		receivedCount += count
+		acceptedCount += r.neighbor.AddressFamilies[addressFamily].PrefixCount
+		familyNames = append(familyNames, addressFamilyNames[addressFamily])
+	}
+
+	var filteredCount uint64
+	if receivedCount > acceptedCount {
+		filteredCount = receivedCount - acceptedCount
+	}
 
-	return fmt.Sprintf(
-		"state is %s since %s",
-		resultCollection.GetStringMetricValue("state").OrElse("N/A"),
-		lastStateChangeString,
+	return append(metrics,
+		nagopher.MustNewNumericMetric("received_count", float64(receivedCount), "", nil, ""),
+		nagopher.MustNewNumericMetric("filtered_count", float64(filteredCount), "", nil, ""),
+		nagopher.MustNewStringMetric("info_received_routes", fmt.Sprintf(
+			"received routes: %d received, %d filtered by policy (%s)",
+			receivedCount, filteredCount, strings.Join(familyNames, ", ")), ""),
 	)
 }
 
-func (s *bgpNeighborSummarizer) Problem(check nagopher.Check) string {
-	result, err := check.Results().MostSignificantResult().Get()
-	if err == nil && result != nil {
-		metric, err := result.Metric().Get()
-		if err == nil && metric != nil && metric.Name() == "state" {
-			return s.Ok(check)
-		}
-	}
+func (r *bgpNeighborResource) Collect() error {
+	var err error
 
-	return s.Summarizer.Problem(check)
+	r.neighbor, err = r.Session().GetBgpNeighbor(r.ThisPlugin().NeighborIP.String())
+	return err
 }
 
-func newUptimeContext(name string, warningThreshold *nagopher.Bounds, criticalThreshold *nagopher.Bounds) nagopher.Context {
-	return &uptimeContext{nagopher.NewScalarContext(name, warningThreshold, criticalThreshold)}
+func (r *bgpNeighborResource) Session() Session {
+	return r.ThisPlugin().ThisModule().session
 }
 
-func (c *uptimeContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
-	return nagopher.OptionalPerfData{}, nil
+func (r *bgpNeighborResource) ThisPlugin() *bgpNeighborPlugin {
+	return r.Resource.Plugin().(*bgpNeighborPlugin)
 }
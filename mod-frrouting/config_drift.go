@@ -0,0 +1,312 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modfrrouting
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// configDriftMaxDiffLines limits the amount of changed lines shown within the long output
+const configDriftMaxDiffLines = 10
+
+// configBaselineVersion is the version of the layout of persisted baselines, which must be increased on changes
+const configBaselineVersion = 1
+
+type configDriftPlugin struct {
+	nagocheck.Plugin
+
+	ReferenceFile  string
+	UpdateBaseline bool
+	IsCritical     bool
+}
+
+type configDriftResource struct {
+	nagocheck.Resource
+
+	hash         string
+	baselineHash string
+	state        string
+	added        []string
+	removed      []string
+}
+
+type configBaseline struct {
+	Hash  string   `json:"hash"`
+	Lines []string `json:"lines"`
+}
+
+type configDriftSummarizer struct {
+	nagocheck.Summarizer
+}
+
+func newConfigDriftPlugin() *configDriftPlugin {
+	return &configDriftPlugin{
+		Plugin: nagocheck.NewPlugin("config-drift",
+			nagocheck.PluginDescription("Configuration Drift"),
+			nagocheck.PluginDefaultThresholds(false),
+		),
+	}
+}
+
+func (p *configDriftPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("reference", "Compare the running configuration against the given reference file instead of a "+
+		"baseline, which gets recorded within the persistence backend during the first execution.").
+		Short('r').ExistingFileVar(&p.ReferenceFile)
+
+	node.Flag("update-baseline", "Accept the current running configuration as new baseline.").
+		BoolVar(&p.UpdateBaseline)
+
+	node.Flag("critical", "Return CRITICAL instead of WARNING when the running configuration has drifted.").
+		Short('c').BoolVar(&p.IsCritical)
+}
+
+func (p *configDriftPlugin) DefineCheck() nagopher.Check {
+	problemState := nagopher.StateWarning()
+	if p.IsCritical {
+		problemState = nagopher.StateCritical()
+	}
+
+	check := nagopher.NewCheck("config_drift", newConfigDriftSummarizer(p))
+	check.AttachResources(newConfigDriftResource(p))
+	check.AttachContexts(
+		nagopher.NewStringInfoContext("info_hash"),
+		nagopher.NewStringInfoContext("info_diff"),
+
+		nagopher.NewStringMatchContext("drift", problemState, []string{"NONE", "BASELINED"}),
+		nagopher.NewScalarContext("lines_added", nil, nil),
+		nagopher.NewScalarContext("lines_removed", nil, nil),
+	)
+
+	return check
+}
+
+func (p *configDriftPlugin) ThisModule() *frroutingModule {
+	return p.Plugin.Module().(*frroutingModule)
+}
+
+func newConfigDriftResource(plugin *configDriftPlugin) *configDriftResource {
+	return &configDriftResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *configDriftResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewStringMetric("drift", r.state, ""),
+		nagopher.MustNewNumericMetric("lines_added", float64(len(r.added)), "", nil, ""),
+		nagopher.MustNewNumericMetric("lines_removed", float64(len(r.removed)), "", nil, ""),
+		nagopher.MustNewStringMetric("info_hash", fmt.Sprintf("running config: sha256 %s, expected %s",
+			shortHash(r.hash), shortHash(r.baselineHash)), ""),
+	)
+
+	if r.state == "DRIFTED" {
+		var diff []string
+		for _, line := range r.removed {
+			diff = append(diff, "-"+line)
+		}
+		for _, line := range r.added {
+			diff = append(diff, "+"+line)
+		}
+		if len(diff) == 0 {
+			diff = append(diff, "order of lines changed")
+		} else if len(diff) > configDriftMaxDiffLines {
+			diff = append(diff[:configDriftMaxDiffLines], fmt.Sprintf("... %d more", len(diff)-configDriftMaxDiffLines))
+		}
+
+		metrics = append(metrics, nagopher.MustNewStringMetric("info_diff",
+			fmt.Sprintf("changes: %s", strings.Join(diff, ", ")), ""))
+	}
+
+	return metrics, nil
+}
+
+// Collect compares the normalized running configuration against the reference file or the persisted baseline. The
+// baseline is stored independently of resource persistence, as it must not be discarded after reboots.
+func (r *configDriftResource) Collect() error {
+	plugin := r.ThisPlugin()
+	rawConfig, err := plugin.ThisModule().session.GetRunningConfig()
+	if err != nil {
+		return err
+	}
+
+	lines := normalizeConfig(rawConfig)
+	r.hash = hashConfig(lines)
+
+	var baseline *configBaseline
+	if plugin.ReferenceFile != "" {
+		data, err := ioutil.ReadFile(plugin.ReferenceFile)
+		if err != nil {
+			return fmt.Errorf("could not read reference file: %s", err.Error())
+		}
+
+		referenceLines := normalizeConfig(string(data))
+		baseline = &configBaseline{Hash: hashConfig(referenceLines), Lines: referenceLines}
+	} else {
+		backend, err := nagocheck.SelectedPersistenceBackend()
+		if err != nil {
+			return err
+		}
+
+		key := strings.ToLower(".nagocheck-" + plugin.Name() + "-baseline")
+		if !plugin.UpdateBaseline {
+			if baseline, err = loadConfigBaseline(backend, key); err != nil {
+				return err
+			}
+		}
+
+		if baseline == nil {
+			baseline = &configBaseline{Hash: r.hash, Lines: lines}
+			if err := storeConfigBaseline(backend, key, baseline); err != nil {
+				return err
+			}
+
+			r.state, r.baselineHash = "BASELINED", r.hash
+			return nil
+		}
+	}
+
+	r.baselineHash = baseline.Hash
+	r.added, r.removed = diffConfig(baseline.Lines, lines)
+	r.state = "NONE"
+	if r.hash != baseline.Hash {
+		r.state = "DRIFTED"
+	}
+
+	return nil
+}
+
+func (r *configDriftResource) ThisPlugin() *configDriftPlugin {
+	return r.Resource.Plugin().(*configDriftPlugin)
+}
+
+func loadConfigBaseline(backend nagocheck.PersistenceBackend, key string) (*configBaseline, error) {
+	var baseline configBaseline
+	found, err := nagocheck.LoadVersionedData(backend, key, configBaselineVersion, &baseline)
+	if err != nil {
+		return nil, fmt.Errorf("could not load baseline: %s", err.Error())
+	} else if !found {
+		return nil, nil
+	}
+
+	return &baseline, nil
+}
+
+func storeConfigBaseline(backend nagocheck.PersistenceBackend, key string, baseline *configBaseline) error {
+	if err := nagocheck.StoreVersionedData(backend, key, configBaselineVersion, baseline); err != nil {
+		return fmt.Errorf("could not store baseline: %s", err.Error())
+	}
+
+	return nil
+}
+
+// normalizeConfig strips everything from the output of 'show running-config' which changes without the configuration
+// being modified, like the header, comment separators, empty lines and trailing whitespace
+func normalizeConfig(config string) (lines []string) {
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		trimmedLine := strings.TrimSpace(line)
+
+		switch {
+		case trimmedLine == "", trimmedLine == "!", strings.HasPrefix(trimmedLine, "! "):
+			continue
+		case strings.HasPrefix(trimmedLine, "Building configuration"),
+			strings.HasPrefix(trimmedLine, "Current configuration"):
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func hashConfig(lines []string) string {
+	hash := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(hash[:])
+}
+
+// diffConfig returns all lines which have been added to or removed from the expected configuration, treating both as
+// multisets so that the result does not depend on the order of lines
+func diffConfig(expected []string, actual []string) (added []string, removed []string) {
+	counts := make(map[string]int)
+	for _, line := range expected {
+		counts[line]++
+	}
+	for _, line := range actual {
+		if counts[line] > 0 {
+			counts[line]--
+			continue
+		}
+
+		added = append(added, strings.TrimSpace(line))
+	}
+
+	for line, count := range counts {
+		for i := 0; i < count; i++ {
+			removed = append(removed, strings.TrimSpace(line))
+		}
+	}
+	sort.Strings(removed)
+
+	return added, removed
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+
+	return hash
+}
+
+func newConfigDriftSummarizer(plugin *configDriftPlugin) *configDriftSummarizer {
+	return &configDriftSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin),
+	}
+}
+
+func (s *configDriftSummarizer) Ok(check nagopher.Check) string {
+	if check.Results().GetStringMetricValue("drift").OrElse("") == "BASELINED" {
+		return "recorded running configuration as baseline"
+	}
+
+	return "running configuration matches baseline"
+}
+
+func (s *configDriftSummarizer) Problem(check nagopher.Check) string {
+	resultCollection := check.Results()
+	if resultCollection.GetStringMetricValue("drift").OrElse("") != "DRIFTED" {
+		return s.Summarizer.Problem(check)
+	}
+
+	return fmt.Sprintf("running configuration drifted from baseline: %d lines added, %d lines removed",
+		int(resultCollection.GetNumericMetricValue("lines_added").OrElse(0)),
+		int(resultCollection.GetNumericMetricValue("lines_removed").OrElse(0)))
+}
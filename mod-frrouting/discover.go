@@ -0,0 +1,45 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modfrrouting
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+	"sort"
+)
+
+// DiscoverServices enumerates all configured BGP neighbors using the default vtysh command, as module flags are not
+// available outside of plugin invocations
+func (m *frroutingModule) DiscoverServices() ([]nagocheck.DiscoveredService, error) {
+	session := NewVtyshSession(nagocheck.NewTransport("vtysh"), m.vtyshTemplate())
+	neighbors, err := session.GetBgpNeighbors()
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]nagocheck.DiscoveredService, 0, len(neighbors))
+	for _, neighbor := range neighbors {
+		services = append(services, nagocheck.DiscoveredService{
+			Plugin: "bgp-neighbor", Name: neighbor.RemoteHost, Args: []string{neighbor.RemoteHost},
+		})
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+
+	return services, nil
+}
@@ -22,21 +22,43 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"os/exec"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagocheck/nagocheck/transport"
+	"net"
+	"regexp"
 	"strings"
 	"time"
 )
 
 const timeout = 10 * time.Second
 
+var versionRE = regexp.MustCompile(`(?m)^FRRouting (\S+)`)
+
+// addressFamilyNames maps the address family keys of the neighbor JSON output to their vtysh command syntax
+var addressFamilyNames = map[string]string{
+	"ipv4Unicast":   "ipv4 unicast",
+	"ipv4Multicast": "ipv4 multicast",
+	"ipv6Unicast":   "ipv6 unicast",
+	"ipv6Multicast": "ipv6 multicast",
+}
+
 // Session represents an active connection for communicating with FRRouting
 type Session interface {
+	GetVersion() (string, error)
 	GetBgpNeighbors() ([]*BgpNeighbor, error)
 	GetBgpNeighbor(neighborAddress string) (*BgpNeighbor, error)
+	GetBgpReceivedRouteCount(neighborAddress string, addressFamily string) (uint64, error)
+	GetRoutes(prefix *net.IPNet) ([]*Route, error)
+	GetStaticRoutes(family string) ([]*Route, error)
+	GetLdpNeighbors() ([]*LdpNeighbor, error)
+	GetLdpAdjacencies() ([]*LdpAdjacency, error)
+	GetLdpBindings() ([]*LdpBinding, error)
+	GetRunningConfig() (string, error)
 }
 
 type vtyshSession struct {
-	vtyshCommand []string
+	transport    transport.Transport
+	vtyshCommand nagocheck.SudoTemplate
 }
 
 // BgpNeighbor contains config and operational data about a BGP neighbor/peer
@@ -69,18 +91,84 @@ type BgpNeighbor struct {
 
 // BgpNeighborAddressFamily contains config and operational data about a specific address family of a neighbor/peer
 type BgpNeighborAddressFamily struct {
-	PeerGroup   string `json:"peerGroupMember"`
-	PrefixCount uint64 `json:"acceptedPrefixCounter"`
-	PrefixLimit uint64 `json:"prefixAllowedMax"`
+	PeerGroup           string `json:"peerGroupMember"`
+	PrefixCount         uint64 `json:"acceptedPrefixCounter"`
+	PrefixLimit         uint64 `json:"prefixAllowedMax"`
+	SoftReconfigInbound bool   `json:"inboundSoftConfigPermit"`
+}
+
+// Route contains the zebra RIB entry of a prefix as learned from a specific protocol
+type Route struct {
+	Prefix         string          `json:"prefix"`
+	Protocol       string          `json:"protocol"`
+	Selected       bool            `json:"selected"`
+	Installed      bool            `json:"installed"`
+	NexthopGroupID uint32          `json:"nexthopGroupId"`
+	Nexthops       []*RouteNexthop `json:"nexthops"`
+}
+
+// RouteNexthop contains a single nexthop of a route including its egress interface
+type RouteNexthop struct {
+	IP            string `json:"ip"`
+	InterfaceName string `json:"interfaceName"`
+	Active        bool   `json:"active"`
+	FIB           bool   `json:"fib"`
+	Recursive     bool   `json:"recursive"`
+	Resolver      bool   `json:"resolver"`
+}
+
+// LdpNeighbor contains operational data about a LDP session with a neighbor as reported by ldpd
+type LdpNeighbor struct {
+	AddressFamily    string `json:"addressFamily"`
+	NeighborID       string `json:"neighborId"`
+	State            string `json:"state"`
+	TransportAddress string `json:"transportAddress"`
+	UpTime           string `json:"upTime"`
 }
 
-// NewVtyshSession instantiates a new Session which will use vtysh to communicate with FRRouting
-func NewVtyshSession(vtyshCommand []string) Session {
+// LdpAdjacency contains a single LDP discovery adjacency, which is either a link or a targeted adjacency
+type LdpAdjacency struct {
+	AddressFamily string `json:"addressFamily"`
+	NeighborID    string `json:"neighborId"`
+	Type          string `json:"type"`
+	Interface     string `json:"interface"`
+	Peer          string `json:"peer"`
+	HelloHoldtime uint32 `json:"helloHoldtime"`
+}
+
+// LdpBinding contains a single label binding of a prefix, which has been advertised by a LDP neighbor
+type LdpBinding struct {
+	AddressFamily string `json:"addressFamily"`
+	Prefix        string `json:"prefix"`
+	NeighborID    string `json:"neighborId"`
+	LocalLabel    string `json:"localLabel"`
+	RemoteLabel   string `json:"remoteLabel"`
+	InUse         int    `json:"inUse"`
+}
+
+// NewVtyshSession instantiates a new Session which will use vtysh to communicate with FRRouting. The given transport
+// allows executing vtysh on a remote host.
+func NewVtyshSession(transport transport.Transport, vtyshCommand nagocheck.SudoTemplate) Session {
 	return &vtyshSession{
+		transport:    transport,
 		vtyshCommand: vtyshCommand,
 	}
 }
 
+func (s *vtyshSession) GetVersion() (string, error) {
+	output, err := s.execute("show version")
+	if err != nil {
+		return "", fmt.Errorf("could not fetch version: %s", err.Error())
+	}
+
+	match := versionRE.FindStringSubmatch(output)
+	if match == nil {
+		return "", fmt.Errorf("could not parse version from output: %s", strings.TrimSpace(output))
+	}
+
+	return match[1], nil
+}
+
 func (s *vtyshSession) GetBgpNeighbors() ([]*BgpNeighbor, error) {
 	jsonData, err := s.executeJSON("show bgp neighbor json")
 	if err != nil {
@@ -119,6 +207,145 @@ func (s *vtyshSession) GetBgpNeighbor(neighborAddress string) (*BgpNeighbor, err
 	return neighbor, nil
 }
 
+// GetStaticRoutes returns all static routes of the given address family, which is either 'ip' or 'ipv6'. This includes
+// static routes which are inactive, e.g. as their nexthop can not be resolved.
+func (s *vtyshSession) GetStaticRoutes(family string) ([]*Route, error) {
+	jsonData, err := s.executeJSON("show %s route static json", family)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch static routes: %s", err.Error())
+	}
+
+	routesMap := make(map[string][]*Route)
+	if err := json.Unmarshal([]byte(jsonData), &routesMap); err != nil {
+		return nil, fmt.Errorf("could not unmarshal JSON route data: %s", err.Error())
+	}
+
+	var routes []*Route
+	for _, prefixRoutes := range routesMap {
+		for _, route := range prefixRoutes {
+			if route.Protocol == "static" {
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	return routes, nil
+}
+
+// GetBgpReceivedRouteCount returns the amount of routes received from a neighbor within the given address family before
+// applying any inbound policy, which is only available when soft-reconfiguration inbound has been enabled
+func (s *vtyshSession) GetBgpReceivedRouteCount(neighborAddress string, addressFamily string) (uint64, error) {
+	familyName, ok := addressFamilyNames[addressFamily]
+	if !ok {
+		return 0, fmt.Errorf("unsupported address family [%s]", addressFamily)
+	}
+
+	jsonData, err := s.executeJSON("show bgp %s neighbors %s received-routes json", familyName, neighborAddress)
+	if err != nil {
+		return 0, fmt.Errorf("could not fetch received routes: %s", err.Error())
+	}
+
+	var receivedRoutes struct {
+		Warning       string  `json:"warning"`
+		TotalPrefixes *uint64 `json:"totalPrefixCounter"`
+	}
+	if err := json.Unmarshal([]byte(jsonData), &receivedRoutes); err != nil {
+		return 0, fmt.Errorf("could not unmarshal JSON received routes: %s", err.Error())
+	}
+
+	if receivedRoutes.TotalPrefixes == nil {
+		if receivedRoutes.Warning != "" {
+			return 0, fmt.Errorf("could not fetch received routes: %s", receivedRoutes.Warning)
+		}
+
+		// FRRouting omits all counters when no routes have been received
+		return 0, nil
+	}
+
+	return *receivedRoutes.TotalPrefixes, nil
+}
+
+func (s *vtyshSession) GetRoutes(prefix *net.IPNet) ([]*Route, error) {
+	family := "ip"
+	if prefix.IP.To4() == nil {
+		family = "ipv6"
+	}
+
+	jsonData, err := s.executeJSON("show %s route %s json", family, prefix.String())
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch route data: %s", err.Error())
+	}
+
+	routes := make(map[string][]*Route)
+	if err := json.Unmarshal([]byte(jsonData), &routes); err != nil {
+		return nil, fmt.Errorf("could not unmarshal JSON route data: %s", err.Error())
+	}
+
+	return routes[prefix.String()], nil
+}
+
+func (s *vtyshSession) GetLdpNeighbors() ([]*LdpNeighbor, error) {
+	var data struct {
+		Neighbors []*LdpNeighbor `json:"neighbors"`
+	}
+
+	if err := s.executeLdpJSON(&data, "show mpls ldp neighbor json"); err != nil {
+		return nil, fmt.Errorf("could not fetch LDP neighbors: %s", err.Error())
+	}
+
+	for _, neighbor := range data.Neighbors {
+		neighbor.State = strings.ToUpper(neighbor.State)
+	}
+
+	return data.Neighbors, nil
+}
+
+func (s *vtyshSession) GetLdpAdjacencies() ([]*LdpAdjacency, error) {
+	var data struct {
+		Adjacencies []*LdpAdjacency `json:"adjacencies"`
+	}
+
+	if err := s.executeLdpJSON(&data, "show mpls ldp discovery json"); err != nil {
+		return nil, fmt.Errorf("could not fetch LDP adjacencies: %s", err.Error())
+	}
+
+	return data.Adjacencies, nil
+}
+
+func (s *vtyshSession) GetLdpBindings() ([]*LdpBinding, error) {
+	var data struct {
+		Bindings []*LdpBinding `json:"bindings"`
+	}
+
+	if err := s.executeLdpJSON(&data, "show mpls ldp binding json"); err != nil {
+		return nil, fmt.Errorf("could not fetch LDP bindings: %s", err.Error())
+	}
+
+	return data.Bindings, nil
+}
+
+func (s *vtyshSession) executeLdpJSON(target interface{}, commandFmt string, args ...interface{}) error {
+	jsonData, err := s.executeJSON(commandFmt, args...)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(jsonData), target); err != nil {
+		return fmt.Errorf("could not unmarshal JSON data: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (s *vtyshSession) GetRunningConfig() (string, error) {
+	output, err := s.execute("show running-config")
+	if err != nil {
+		return "", fmt.Errorf("could not fetch running config: %s (%s)", err.Error(), strings.TrimSpace(output))
+	}
+
+	return output, nil
+}
+
 func (s *vtyshSession) parseBgpNeighbors(jsonData []byte) (map[string]*BgpNeighbor, error) {
 	neighbors := make(map[string]*BgpNeighbor)
 	if err := json.Unmarshal(jsonData, &neighbors); err != nil {
@@ -149,18 +376,13 @@ func (s *vtyshSession) parseBgpNeighbors(jsonData []byte) (map[string]*BgpNeighb
 	return neighbors, nil
 }
 
-func (s *vtyshSession) execute(commandFmt string, args ...interface{}) (_ string, err error) {
-	cmdArgs := append(s.vtyshCommand, "-c", fmt.Sprintf(commandFmt, args...))
-	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-
-	timer := time.AfterFunc(timeout, func() {
-		err = fmt.Errorf("command execution timed out after %f seconds", timeout.Seconds())
-		_ = cmd.Process.Kill()
-	})
-	output, err := cmd.CombinedOutput()
-	timer.Stop()
+func (s *vtyshSession) execute(commandFmt string, args ...interface{}) (string, error) {
+	cmdArgs, err := s.vtyshCommand.Build(fmt.Sprintf(commandFmt, args...))
+	if err != nil {
+		return "", err
+	}
 
-	return string(output), err
+	return s.transport.Execute(timeout, cmdArgs)
 }
 
 func (s *vtyshSession) executeJSON(commandFmt string, args ...interface{}) (_ string, err error) {
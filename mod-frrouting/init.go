@@ -24,6 +24,8 @@ import (
 	"strings"
 )
 
+const defaultVtyshCommand = "/usr/bin/vtysh"
+
 type frroutingModule struct {
 	nagocheck.Module
 
@@ -39,6 +41,10 @@ func NewFrroutingModule() nagocheck.Module {
 		Module: nagocheck.NewModule("frrouting",
 			nagocheck.ModuleDescription("FRRouting"),
 			nagocheck.ModulePlugin(newBgpNeighborPlugin()),
+			nagocheck.ModulePlugin(newConfigDriftPlugin()),
+			nagocheck.ModulePlugin(newLdpNeighborPlugin()),
+			nagocheck.ModulePlugin(newRoutePlugin()),
+			nagocheck.ModulePlugin(newStaticRoutePlugin()),
 		),
 	}
 }
@@ -48,16 +54,44 @@ func (m *frroutingModule) DefineFlags(node nagocheck.KingpinNode) {
 		Short('m').Default("vtysh").EnumVar(&m.connectionMode, "vtysh")
 
 	node.Flag("vtysh-cmd", "[vtysh] Specifies the command with optional arguments to be used for executing vtysh. "+
-		"Use comma to separate command and arguments. Example when using sudo: sudo,-n,/usr/bin/vtysh,-u").
-		Default("/usr/bin/vtysh").StringVar(&m.vtyshCommand)
+		"Use comma to separate command and arguments. Specify the global --sudo flag for executing vtysh with "+
+		"elevated privileges.").
+		Default(defaultVtyshCommand).StringVar(&m.vtyshCommand)
 }
 
 func (m *frroutingModule) ExecutePlugin(plugin nagocheck.Plugin) error {
 	if m.connectionMode == "vtysh" {
-		m.session = NewVtyshSession(strings.Split(m.vtyshCommand, ","))
+		m.session = NewVtyshSession(nagocheck.NewTransport("vtysh"), m.vtyshTemplate())
 	} else {
 		return fmt.Errorf("unknown connection mode: " + m.connectionMode)
 	}
 
 	return m.Module.ExecutePlugin(plugin)
 }
+
+// Inventory reports the version of the running FRRouting daemons using the default vtysh command, as module flags are
+// not available outside of plugin invocations
+func (m *frroutingModule) Inventory() (interface{}, error) {
+	session := NewVtyshSession(nagocheck.NewTransport("vtysh"), m.vtyshTemplate())
+	version, err := session.GetVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"version": version}, nil
+}
+
+func (m *frroutingModule) SudoTemplates() []nagocheck.SudoTemplate {
+	return []nagocheck.SudoTemplate{m.vtyshTemplate()}
+}
+
+// vtyshTemplate returns the allow-listed template for executing vtysh, which only permits running show commands
+func (m *frroutingModule) vtyshTemplate() nagocheck.SudoTemplate {
+	vtyshCommand := m.vtyshCommand
+	if vtyshCommand == "" {
+		vtyshCommand = defaultVtyshCommand
+	}
+
+	command := append(strings.Split(vtyshCommand, ","), "-c")
+	return nagocheck.NewSudoTemplate("vtysh", command, "show *")
+}
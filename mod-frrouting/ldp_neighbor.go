@@ -0,0 +1,249 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modfrrouting
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"net"
+	"sort"
+	"strings"
+)
+
+type ldpNeighborPlugin struct {
+	nagocheck.Plugin
+
+	NeighborID       net.IP
+	IsCritical       bool
+	AdjacenciesRange nagopher.OptionalBounds
+	BindingsRange    nagopher.OptionalBounds
+}
+
+type ldpNeighborResource struct {
+	nagocheck.Resource
+
+	neighbor    *LdpNeighbor
+	adjacencies []*LdpAdjacency
+	bindings    []*LdpBinding
+}
+
+type ldpNeighborSummarizer struct {
+	nagocheck.Summarizer
+}
+
+func newLdpNeighborPlugin() *ldpNeighborPlugin {
+	return &ldpNeighborPlugin{
+		Plugin: nagocheck.NewPlugin("ldp-neighbor",
+			nagocheck.PluginDescription("LDP Neighbor"),
+			nagocheck.PluginDefaultThresholds(false),
+		),
+	}
+}
+
+func (p *ldpNeighborPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("neighbor", "Specifies the LSR ID of the LDP neighbor, which usually equals its router ID.").
+		Required().IPVar(&p.NeighborID)
+
+	node.Flag("critical", "Toggles if the given neighbor is critical or not. This will influence the resulting check "+
+		"state if the session of the given neighbor is not operational by either returning WARNING or CRITICAL as the "+
+		"result.").
+		Short('c').BoolVar(&p.IsCritical)
+
+	nagocheck.NagopherBoundsVar(node.Flag("adjacencies", "Range for the amount of discovery adjacencies with the "+
+		"neighbor given as Nagios range specifier (e.g. 2: for two redundant links). Plugin will return WARNING state "+
+		"in case the range does not match.").
+		Short('a'), &p.AdjacenciesRange)
+
+	nagocheck.NagopherBoundsVar(node.Flag("bindings", "Range for the amount of label bindings received from the "+
+		"neighbor given as Nagios range specifier. Plugin will return WARNING state in case the range does not match.").
+		Short('b'), &p.BindingsRange)
+}
+
+func (p *ldpNeighborPlugin) DefineCheck() nagopher.Check {
+	problemState := nagopher.StateWarning()
+	if p.IsCritical {
+		problemState = nagopher.StateCritical()
+	}
+
+	check := nagopher.NewCheck("ldp_neighbor", newLdpNeighborSummarizer(p))
+	check.AttachResources(newLdpNeighborResource(p))
+	check.AttachContexts(
+		nagopher.NewStringInfoContext("info_session"),
+		nagopher.NewStringInfoContext("info_adjacencies"),
+
+		nagopher.NewStringMatchContext("state", problemState, []string{"OPERATIONAL"}),
+		nagopher.NewScalarContext("adjacencies", nagopher.OptionalBoundsPtr(p.AdjacenciesRange), nil),
+		nagopher.NewScalarContext("bindings", nagopher.OptionalBoundsPtr(p.BindingsRange), nil),
+		nagopher.NewScalarContext("bindings_in_use", nil, nil),
+	)
+
+	return check
+}
+
+func (p *ldpNeighborPlugin) ThisModule() *frroutingModule {
+	return p.Plugin.Module().(*frroutingModule)
+}
+
+func newLdpNeighborResource(plugin *ldpNeighborPlugin) *ldpNeighborResource {
+	return &ldpNeighborResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *ldpNeighborResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	var adjacencies []string
+	for _, adjacency := range r.adjacencies {
+		if adjacency.Interface != "" {
+			adjacencies = append(adjacencies, fmt.Sprintf("%s (%s)", adjacency.Interface, adjacency.Type))
+		} else {
+			adjacencies = append(adjacencies, fmt.Sprintf("%s (%s)", adjacency.Peer, adjacency.Type))
+		}
+	}
+	sort.Strings(adjacencies)
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("adjacencies", float64(len(r.adjacencies)), "", nil, ""),
+	)
+	if len(adjacencies) > 0 {
+		metrics = append(metrics, nagopher.MustNewStringMetric("info_adjacencies", fmt.Sprintf(
+			"adjacencies: %s", strings.Join(adjacencies, ", ")), ""))
+	}
+
+	if r.neighbor == nil {
+		return append(metrics, nagopher.MustNewStringMetric("state", "MISSING", "")), nil
+	}
+
+	bindingsInUse := 0
+	for _, binding := range r.bindings {
+		if binding.InUse > 0 {
+			bindingsInUse++
+		}
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewStringMetric("state", r.neighbor.State, ""),
+		nagopher.MustNewStringMetric("info_session", fmt.Sprintf("session: %s via %s, up %s",
+			r.neighbor.AddressFamily, r.neighbor.TransportAddress, r.neighbor.UpTime), ""),
+	)
+
+	// Label bindings are only being exchanged while the session is operational
+	if r.neighbor.State == "OPERATIONAL" {
+		metrics = append(metrics,
+			nagopher.MustNewNumericMetric("bindings", float64(len(r.bindings)), "", nil, ""),
+			nagopher.MustNewNumericMetric("bindings_in_use", float64(bindingsInUse), "", nil, ""),
+		)
+	}
+
+	return metrics, nil
+}
+
+// Collect fetches the session, all discovery adjacencies and all label bindings of the neighbor. ldpd lists a neighbor
+// only while a session exists, so a missing neighbor is not treated as error.
+func (r *ldpNeighborResource) Collect() error {
+	neighborID := r.ThisPlugin().NeighborID.String()
+
+	neighbors, err := r.Session().GetLdpNeighbors()
+	if err != nil {
+		return err
+	}
+
+	r.neighbor = nil
+	for _, neighbor := range neighbors {
+		if neighbor.NeighborID == neighborID {
+			r.neighbor = neighbor
+			break
+		}
+	}
+
+	adjacencies, err := r.Session().GetLdpAdjacencies()
+	if err != nil {
+		return err
+	}
+
+	r.adjacencies = nil
+	for _, adjacency := range adjacencies {
+		if adjacency.NeighborID == neighborID {
+			r.adjacencies = append(r.adjacencies, adjacency)
+		}
+	}
+
+	if r.neighbor == nil || r.neighbor.State != "OPERATIONAL" {
+		return nil
+	}
+
+	bindings, err := r.Session().GetLdpBindings()
+	if err != nil {
+		return err
+	}
+
+	r.bindings = nil
+	for _, binding := range bindings {
+		if binding.NeighborID == neighborID {
+			r.bindings = append(r.bindings, binding)
+		}
+	}
+
+	return nil
+}
+
+func (r *ldpNeighborResource) Session() Session {
+	return r.ThisPlugin().ThisModule().session
+}
+
+func (r *ldpNeighborResource) ThisPlugin() *ldpNeighborPlugin {
+	return r.Resource.Plugin().(*ldpNeighborPlugin)
+}
+
+func newLdpNeighborSummarizer(plugin *ldpNeighborPlugin) *ldpNeighborSummarizer {
+	return &ldpNeighborSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin),
+	}
+}
+
+func (s *ldpNeighborSummarizer) Ok(check nagopher.Check) string {
+	resultCollection := check.Results()
+
+	return fmt.Sprintf("session with %s is %s with %d adjacencies and %d label bindings",
+		s.ThisPlugin().NeighborID.String(),
+		resultCollection.GetStringMetricValue("state").OrElse("N/A"),
+		int(resultCollection.GetNumericMetricValue("adjacencies").OrElse(0)),
+		int(resultCollection.GetNumericMetricValue("bindings").OrElse(0)))
+}
+
+func (s *ldpNeighborSummarizer) Problem(check nagopher.Check) string {
+	result, err := check.Results().MostSignificantResult().Get()
+	if err == nil && result != nil {
+		metric, err := result.Metric().Get()
+		if err == nil && metric != nil && metric.Name() == "state" {
+			return fmt.Sprintf("session with %s is %s", s.ThisPlugin().NeighborID.String(),
+				check.Results().GetStringMetricValue("state").OrElse("N/A"))
+		}
+	}
+
+	return s.Summarizer.Problem(check)
+}
+
+func (s *ldpNeighborSummarizer) ThisPlugin() *ldpNeighborPlugin {
+	return s.Summarizer.Plugin().(*ldpNeighborPlugin)
+}
@@ -0,0 +1,221 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modfrrouting
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type routePlugin struct {
+	nagocheck.Plugin
+
+	Prefix               string
+	ExpectedInterfaces   []string
+	ExpectedNexthopGroup uint32
+	IsCritical           bool
+}
+
+type routeResource struct {
+	nagocheck.Resource
+
+	route *Route
+}
+
+type routeSummarizer struct {
+	nagocheck.Summarizer
+}
+
+func newRoutePlugin() *routePlugin {
+	return &routePlugin{
+		Plugin: nagocheck.NewPlugin("route",
+			nagocheck.PluginDescription("Zebra Route"),
+			nagocheck.PluginDefaultThresholds(false),
+		),
+	}
+}
+
+func (p *routePlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("prefix", "Specifies the prefix of the route in CIDR notation, e.g. 192.0.2.0/24 or 2001:db8::/32. Both "+
+		"IPv4 and IPv6 are supported without specifying the address family explicitly.").
+		Required().StringVar(&p.Prefix)
+
+	node.Flag("interface", "Expected egress interface of the route. Plugin will return a problem state if any "+
+		"installed nexthop egresses through another interface. Can be specified multiple times.").
+		Short('i').StringsVar(&p.ExpectedInterfaces)
+
+	node.Flag("nexthop-group", "Expected ID of the zebra nexthop group used by the route.").
+		Short('g').Uint32Var(&p.ExpectedNexthopGroup)
+
+	node.Flag("critical", "Toggles if the given route is critical or not. This will influence the resulting check "+
+		"state if the route is missing or egresses unexpectedly by either returning WARNING or CRITICAL as the result.").
+		Short('c').BoolVar(&p.IsCritical)
+}
+
+func (p *routePlugin) DefineCheck() nagopher.Check {
+	problemState := nagopher.StateWarning()
+	if p.IsCritical {
+		problemState = nagopher.StateCritical()
+	}
+
+	check := nagopher.NewCheck("route", newRouteSummarizer(p))
+	check.AttachResources(newRouteResource(p))
+	check.AttachContexts(
+		nagopher.NewStringInfoContext("info_route"),
+		nagopher.NewStringInfoContext("info_nexthops"),
+
+		nagopher.NewStringMatchContext("state", problemState, []string{"INSTALLED"}),
+		nagopher.NewStringMatchContext("egress", problemState, []string{"EXPECTED"}),
+		nagopher.NewStringMatchContext("nexthop_group", problemState,
+			[]string{strconv.FormatUint(uint64(p.ExpectedNexthopGroup), 10)}),
+		nagopher.NewScalarContext("nexthops", nil, nil),
+	)
+
+	return check
+}
+
+func (p *routePlugin) ThisModule() *frroutingModule {
+	return p.Plugin.Module().(*frroutingModule)
+}
+
+func newRouteResource(plugin *routePlugin) *routeResource {
+	return &routeResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *routeResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	if r.route == nil {
+		return append(metrics, nagopher.MustNewStringMetric("state", "MISSING", "")), nil
+	}
+
+	state := "INSTALLED"
+	if !r.route.Installed {
+		state = "NOT_INSTALLED"
+	}
+
+	var interfaces, nexthops []string
+	expectedInterfaces := r.ThisPlugin().ExpectedInterfaces
+	unexpectedInterfaces := 0
+	for _, nexthop := range r.route.Nexthops {
+		if !nexthop.FIB {
+			continue
+		}
+
+		interfaces = append(interfaces, nexthop.InterfaceName)
+		if nexthop.IP != "" {
+			nexthops = append(nexthops, fmt.Sprintf("%s (%s)", nexthop.InterfaceName, nexthop.IP))
+		} else {
+			nexthops = append(nexthops, nexthop.InterfaceName)
+		}
+
+		if len(expectedInterfaces) > 0 && !containsString(expectedInterfaces, nexthop.InterfaceName) {
+			unexpectedInterfaces++
+		}
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewStringMetric("state", state, ""),
+		nagopher.MustNewNumericMetric("nexthops", float64(len(nexthops)), "", nil, ""),
+		nagopher.MustNewStringMetric("info_route", fmt.Sprintf("route: %s via %s, nexthop group %d",
+			r.route.Prefix, r.route.Protocol, r.route.NexthopGroupID), ""),
+		nagopher.MustNewStringMetric("info_nexthops", fmt.Sprintf("nexthops: %s",
+			strings.Join(nexthops, ", ")), ""),
+	)
+
+	if len(expectedInterfaces) > 0 {
+		egress := "EXPECTED"
+		if unexpectedInterfaces > 0 || len(interfaces) == 0 {
+			egress = "UNEXPECTED"
+		}
+		metrics = append(metrics, nagopher.MustNewStringMetric("egress", egress, ""))
+	}
+
+	if r.ThisPlugin().ExpectedNexthopGroup != 0 {
+		metrics = append(metrics, nagopher.MustNewStringMetric("nexthop_group",
+			strconv.FormatUint(uint64(r.route.NexthopGroupID), 10), ""))
+	}
+
+	return metrics, nil
+}
+
+// Collect fetches all routes of the prefix and picks the one selected by zebra, as routes learned from other protocols
+// (e.g. a static backup route) might exist as well
+func (r *routeResource) Collect() error {
+	_, prefix, err := net.ParseCIDR(r.ThisPlugin().Prefix)
+	if err != nil {
+		return fmt.Errorf("could not parse prefix: %s", err.Error())
+	}
+
+	routes, err := r.Session().GetRoutes(prefix)
+	if err != nil {
+		return err
+	}
+
+	r.route = nil
+	for _, route := range routes {
+		if route.Selected {
+			r.route = route
+			break
+		}
+	}
+
+	return nil
+}
+
+func (r *routeResource) Session() Session {
+	return r.ThisPlugin().ThisModule().session
+}
+
+func (r *routeResource) ThisPlugin() *routePlugin {
+	return r.Resource.Plugin().(*routePlugin)
+}
+
+func newRouteSummarizer(plugin *routePlugin) *routeSummarizer {
+	return &routeSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin),
+	}
+}
+
+func (s *routeSummarizer) Ok(check nagopher.Check) string {
+	return fmt.Sprintf("%s is installed with %d nexthops", s.ThisPlugin().Prefix,
+		int(check.Results().GetNumericMetricValue("nexthops").OrElse(0)))
+}
+
+func (s *routeSummarizer) ThisPlugin() *routePlugin {
+	return s.Summarizer.Plugin().(*routePlugin)
+}
+
+func containsString(values []string, value string) bool {
+	for _, current := range values {
+		if current == value {
+			return true
+		}
+	}
+
+	return false
+}
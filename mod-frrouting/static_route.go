@@ -0,0 +1,257 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modfrrouting
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"net"
+	"sort"
+	"strings"
+)
+
+type staticRoutePlugin struct {
+	nagocheck.Plugin
+
+	Prefixes   []string
+	IsCritical bool
+}
+
+type staticRouteResource struct {
+	nagocheck.Resource
+
+	routes          map[string][]*Route
+	missingPrefixes []string
+}
+
+type staticRouteSummarizer struct {
+	nagocheck.Summarizer
+}
+
+func newStaticRoutePlugin() *staticRoutePlugin {
+	return &staticRoutePlugin{
+		Plugin: nagocheck.NewPlugin("static-route",
+			nagocheck.PluginDescription("Static Routes"),
+			nagocheck.PluginDefaultThresholds(false),
+		),
+	}
+}
+
+func (p *staticRoutePlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("prefix", "Only check the static routes of the given prefix in CIDR notation, which must exist. Can be "+
+		"specified multiple times. All configured static routes of both address families are checked by default.").
+		Short('p').StringsVar(&p.Prefixes)
+
+	node.Flag("critical", "Toggles if the static routes are critical or not. This will influence the resulting "+
+		"check state if a static route is missing or inactive by either returning WARNING or CRITICAL as the result.").
+		Short('c').BoolVar(&p.IsCritical)
+}
+
+func (p *staticRoutePlugin) DefineCheck() nagopher.Check {
+	noProblems := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(0))
+	var warningThreshold, criticalThreshold *nagopher.Bounds
+	if p.IsCritical {
+		criticalThreshold = &noProblems
+	} else {
+		warningThreshold = &noProblems
+	}
+
+	check := nagopher.NewCheck("static_route", newStaticRouteSummarizer(p))
+	check.AttachResources(newStaticRouteResource(p))
+	check.AttachContexts(
+		nagopher.NewStringInfoContext("info_inactive"),
+		nagopher.NewStringInfoContext("info_unreachable"),
+
+		nagopher.NewScalarContext("routes", nil, nil),
+		nagopher.NewScalarContext("inactive", warningThreshold, criticalThreshold),
+		nagopher.NewScalarContext("unreachable_nexthops", &noProblems, nil),
+	)
+
+	return check
+}
+
+func (p *staticRoutePlugin) ThisModule() *frroutingModule {
+	return p.Plugin.Module().(*frroutingModule)
+}
+
+func newStaticRouteResource(plugin *staticRoutePlugin) *staticRouteResource {
+	return &staticRouteResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *staticRouteResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	prefixes := make([]string, 0, len(r.routes))
+	for prefix := range r.routes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	inactiveRoutes := append([]string(nil), r.missingPrefixes...)
+	for index := range inactiveRoutes {
+		inactiveRoutes[index] += " (missing)"
+	}
+
+	var unreachableNexthops []string
+	for _, prefix := range prefixes {
+		active, installed := false, true
+		for _, route := range r.routes[prefix] {
+			// Static routes which are not selected (e.g. floating static routes) are not expected to be installed
+			if route.Selected && !route.Installed {
+				installed = false
+			}
+
+			for _, nexthop := range route.Nexthops {
+				// Nexthops which resolve a recursive nexthop are not part of the configuration
+				if nexthop.Resolver {
+					continue
+				}
+
+				if nexthop.Active {
+					active = true
+				} else {
+					unreachableNexthops = append(unreachableNexthops, fmt.Sprintf("%s via %s",
+						prefix, staticNexthopString(nexthop)))
+				}
+			}
+		}
+
+		if !active {
+			inactiveRoutes = append(inactiveRoutes, prefix+" (inactive)")
+		} else if !installed {
+			inactiveRoutes = append(inactiveRoutes, prefix+" (not installed)")
+		}
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("routes", float64(len(prefixes)+len(r.missingPrefixes)), "", nil, ""),
+		nagopher.MustNewNumericMetric("inactive", float64(len(inactiveRoutes)), "", nil, ""),
+		nagopher.MustNewNumericMetric("unreachable_nexthops", float64(len(unreachableNexthops)), "", nil, ""),
+	)
+
+	if len(inactiveRoutes) > 0 {
+		metrics = append(metrics, nagopher.MustNewStringMetric("info_inactive", fmt.Sprintf(
+			"inactive routes: %s", strings.Join(inactiveRoutes, ", ")), ""))
+	}
+	if len(unreachableNexthops) > 0 {
+		metrics = append(metrics, nagopher.MustNewStringMetric("info_unreachable", fmt.Sprintf(
+			"unreachable nexthops: %s", strings.Join(unreachableNexthops, ", ")), ""))
+	}
+
+	return metrics, nil
+}
+
+// Collect fetches the static routes of all address families being checked and groups them by their prefix. Prefixes
+// given by --prefix without any static route are being remembered as missing.
+func (r *staticRouteResource) Collect() error {
+	families := []string{"ip", "ipv6"}
+	wantedPrefixes := make(map[string]bool)
+	if prefixes := r.ThisPlugin().Prefixes; len(prefixes) > 0 {
+		families = nil
+		for _, rawPrefix := range prefixes {
+			_, prefix, err := net.ParseCIDR(rawPrefix)
+			if err != nil {
+				return fmt.Errorf("could not parse prefix: %s", err.Error())
+			}
+
+			family := "ip"
+			if prefix.IP.To4() == nil {
+				family = "ipv6"
+			}
+			if !containsString(families, family) {
+				families = append(families, family)
+			}
+			wantedPrefixes[prefix.String()] = true
+		}
+	}
+
+	r.routes = make(map[string][]*Route)
+	for _, family := range families {
+		routes, err := r.Session().GetStaticRoutes(family)
+		if err != nil {
+			return err
+		}
+
+		for _, route := range routes {
+			if len(wantedPrefixes) == 0 || wantedPrefixes[route.Prefix] {
+				r.routes[route.Prefix] = append(r.routes[route.Prefix], route)
+			}
+		}
+	}
+
+	r.missingPrefixes = nil
+	for prefix := range wantedPrefixes {
+		if _, ok := r.routes[prefix]; !ok {
+			r.missingPrefixes = append(r.missingPrefixes, prefix)
+		}
+	}
+	sort.Strings(r.missingPrefixes)
+
+	return nil
+}
+
+func (r *staticRouteResource) Session() Session {
+	return r.ThisPlugin().ThisModule().session
+}
+
+func (r *staticRouteResource) ThisPlugin() *staticRoutePlugin {
+	return r.Resource.Plugin().(*staticRoutePlugin)
+}
+
+func staticNexthopString(nexthop *RouteNexthop) string {
+	var parts []string
+	if nexthop.IP != "" {
+		parts = append(parts, nexthop.IP)
+	}
+	if nexthop.InterfaceName != "" {
+		parts = append(parts, nexthop.InterfaceName)
+	}
+	if nexthop.Recursive {
+		parts = append(parts, "(recursive)")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func newStaticRouteSummarizer(plugin *staticRoutePlugin) *staticRouteSummarizer {
+	return &staticRouteSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin),
+	}
+}
+
+func (s *staticRouteSummarizer) Ok(check nagopher.Check) string {
+	return fmt.Sprintf("all %d static routes are active",
+		int(check.Results().GetNumericMetricValue("routes").OrElse(0)))
+}
+
+func (s *staticRouteSummarizer) Problem(check nagopher.Check) string {
+	resultCollection := check.Results()
+	inactive := int(resultCollection.GetNumericMetricValue("inactive").OrElse(0))
+	if inactive == 0 {
+		return s.Summarizer.Problem(check)
+	}
+
+	return fmt.Sprintf("%d of %d static routes are inactive", inactive,
+		int(resultCollection.GetNumericMetricValue("routes").OrElse(0)))
+}
@@ -0,0 +1,466 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modkerberos
+
+import (
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	kerberosVersion = 5
+
+	messageTypeASRequest = 10
+	messageTypeASReply   = 11
+	messageTypeError     = 30
+
+	paEncryptedTimestamp = 2
+	paEncryptionInfo     = 11
+	paEncryptionInfo2    = 19
+
+	errPreauthRequired  = 25
+	errBadIntegrity     = 31
+	errResponseTooBig   = 52
+	maxTCPMessageLength = 1 << 20
+)
+
+var kdcErrorNames = map[int32]string{
+	1:  "KDC_ERR_NAME_EXP",
+	2:  "KDC_ERR_SERVICE_EXP",
+	3:  "KDC_ERR_BAD_PVNO",
+	6:  "KDC_ERR_C_PRINCIPAL_UNKNOWN",
+	7:  "KDC_ERR_S_PRINCIPAL_UNKNOWN",
+	12: "KDC_ERR_POLICY",
+	14: "KDC_ERR_ETYPE_NOSUPP",
+	18: "KDC_ERR_CLIENT_REVOKED",
+	23: "KDC_ERR_KEY_EXPIRED",
+	24: "KDC_ERR_PREAUTH_FAILED",
+	25: "KDC_ERR_PREAUTH_REQUIRED",
+	31: "KRB_AP_ERR_BAD_INTEGRITY",
+	37: "KRB_AP_ERR_SKEW",
+	52: "KRB_ERR_RESPONSE_TOO_BIG",
+	60: "KRB_ERR_GENERIC",
+	68: "KDC_ERR_WRONG_REALM",
+}
+
+type kdcOptions struct {
+	address string
+	tcp     bool
+	timeout time.Duration
+}
+
+type kdcClient struct {
+	options  kdcOptions
+	deadline time.Time
+}
+
+// kdcError represents a KRB-ERROR message returned by the KDC, e.g. due to an unknown principal or a wrong key
+type kdcError struct {
+	Code int32
+	Text string
+	Data []byte
+}
+
+// ticketResult contains the details of a successful AS exchange
+type ticketResult struct {
+	EncryptionType int32
+	RoundTrips     int
+	ClockSkew      time.Duration
+}
+
+type principalName struct {
+	NameType   int32           `asn1:"explicit,tag:0"`
+	NameString []asn1.RawValue `asn1:"explicit,tag:1"`
+}
+
+type encryptedData struct {
+	EncryptionType int32  `asn1:"explicit,tag:0"`
+	KVNO           int    `asn1:"optional,explicit,tag:1"`
+	Cipher         []byte `asn1:"explicit,tag:2"`
+}
+
+type paData struct {
+	Type  int32  `asn1:"explicit,tag:1"`
+	Value []byte `asn1:"explicit,tag:2"`
+}
+
+type paEncryptedTimestampData struct {
+	Timestamp    time.Time `asn1:"generalized,explicit,tag:0"`
+	Microseconds int       `asn1:"optional,explicit,tag:1"`
+}
+
+type encryptionInfoEntry struct {
+	EncryptionType int32 `asn1:"explicit,tag:0"`
+}
+
+type kdcRequestBody struct {
+	Options         asn1.BitString `asn1:"explicit,tag:0"`
+	ClientName      principalName  `asn1:"explicit,tag:1"`
+	Realm           asn1.RawValue
+	ServerName      principalName `asn1:"explicit,tag:3"`
+	Till            time.Time     `asn1:"generalized,explicit,tag:5"`
+	Nonce           int64         `asn1:"explicit,tag:7"`
+	EncryptionTypes []int32       `asn1:"explicit,tag:8"`
+}
+
+type kdcRequest struct {
+	Version     int            `asn1:"explicit,tag:1"`
+	MessageType int            `asn1:"explicit,tag:2"`
+	PAData      []paData       `asn1:"optional,explicit,tag:3"`
+	Body        kdcRequestBody `asn1:"explicit,tag:4"`
+}
+
+type kdcReply struct {
+	Version       int           `asn1:"explicit,tag:0"`
+	MessageType   int           `asn1:"explicit,tag:1"`
+	PAData        []paData      `asn1:"optional,explicit,tag:2"`
+	ClientRealm   string        `asn1:"explicit,tag:3"`
+	ClientName    principalName `asn1:"explicit,tag:4"`
+	Ticket        asn1.RawValue `asn1:"explicit,tag:5"`
+	EncryptedPart encryptedData `asn1:"explicit,tag:6"`
+}
+
+type encryptedReplyPart struct {
+	Key           asn1.RawValue  `asn1:"explicit,tag:0"`
+	LastRequest   asn1.RawValue  `asn1:"explicit,tag:1"`
+	Nonce         int64          `asn1:"explicit,tag:2"`
+	KeyExpiration time.Time      `asn1:"generalized,optional,explicit,tag:3"`
+	Flags         asn1.BitString `asn1:"explicit,tag:4"`
+	AuthTime      time.Time      `asn1:"generalized,explicit,tag:5"`
+}
+
+type errorMessage struct {
+	Version      int           `asn1:"explicit,tag:0"`
+	MessageType  int           `asn1:"explicit,tag:1"`
+	ClientTime   time.Time     `asn1:"generalized,optional,explicit,tag:2"`
+	ClientMicros int           `asn1:"optional,explicit,tag:3"`
+	ServerTime   time.Time     `asn1:"generalized,explicit,tag:4"`
+	ServerMicros int           `asn1:"explicit,tag:5"`
+	ErrorCode    int32         `asn1:"explicit,tag:6"`
+	ClientRealm  string        `asn1:"optional,explicit,tag:7"`
+	ClientName   principalName `asn1:"optional,explicit,tag:8"`
+	Realm        string        `asn1:"explicit,tag:9"`
+	ServerName   principalName `asn1:"explicit,tag:10"`
+	Text         string        `asn1:"optional,explicit,tag:11"`
+	Data         []byte        `asn1:"optional,explicit,tag:12"`
+}
+
+// requestTicket performs an AS exchange for the given client principal against the KDC, which proves that the KDC
+// knows the principal and shares its key with the keytab. Pre-authentication using an encrypted timestamp is only
+// being sent when requested by the KDC, as done by kinit.
+func requestTicket(options kdcOptions, client principal, service principal,
+	keys map[int32]keytabEntry) (*ticketResult, error) {
+	var encryptionTypeIDs []int32
+	for _, id := range preferredEncryptionTypes {
+		if _, ok := keys[id]; ok {
+			encryptionTypeIDs = append(encryptionTypeIDs, id)
+		}
+	}
+	if len(encryptionTypeIDs) == 0 {
+		return nil, fmt.Errorf("keytab contains no supported key for principal [%s]", client)
+	}
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &kdcClient{options: options, deadline: time.Now().Add(options.timeout)}
+	result := &ticketResult{RoundTrips: 1}
+	reply, err := c.asExchange(client, service, nonce, encryptionTypeIDs, nil)
+	if krbErr, ok := err.(*kdcError); ok && krbErr.Code == errPreauthRequired {
+		preauthData, err := encryptedTimestamp(keys[selectPreauthType(krbErr.Data, encryptionTypeIDs)])
+		if err != nil {
+			return nil, err
+		}
+
+		result.RoundTrips++
+		reply, err = c.asExchange(client, service, nonce, encryptionTypeIDs, []paData{preauthData})
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	key, ok := keys[reply.EncryptedPart.EncryptionType]
+	if !ok {
+		return nil, fmt.Errorf("KDC replied using unrequested encryption type [%s]",
+			encryptionTypeName(reply.EncryptedPart.EncryptionType))
+	}
+
+	encryptionType := encryptionTypes[key.KeyType]
+	plaintext, err := encryptionType.Decrypt(key.Key, keyUsageASRepEncryptedPart, reply.EncryptedPart.Cipher)
+	if err == errIntegrity {
+		return nil, &kdcError{Code: errBadIntegrity, Text: "could not decrypt reply, keytab is likely outdated"}
+	} else if err != nil {
+		return nil, fmt.Errorf("could not decrypt reply: %s", err.Error())
+	}
+
+	// MIT Kerberos uses the tag of EncTGSRepPart for AS replies as well, which has been permitted by RFC 4120
+	var wrapper asn1.RawValue
+	var replyPart encryptedReplyPart
+	if _, err := asn1.Unmarshal(plaintext, &wrapper); err != nil || wrapper.Class != asn1.ClassApplication ||
+		(wrapper.Tag != 25 && wrapper.Tag != 26) {
+		return nil, fmt.Errorf("could not parse encrypted part of reply")
+	}
+	if _, err := asn1.Unmarshal(wrapper.Bytes, &replyPart); err != nil {
+		return nil, fmt.Errorf("could not parse encrypted part of reply: %s", err.Error())
+	}
+	if replyPart.Nonce != nonce {
+		return nil, fmt.Errorf("nonce of reply does not match request")
+	}
+
+	result.EncryptionType = encryptionType.ID
+	result.ClockSkew = time.Until(replyPart.AuthTime).Round(time.Second)
+	return result, nil
+}
+
+func (c *kdcClient) asExchange(client principal, service principal, nonce int64, encryptionTypeIDs []int32,
+	preauthData []paData) (*kdcReply, error) {
+	request, err := asn1.MarshalWithParams(kdcRequest{
+		Version:     kerberosVersion,
+		MessageType: messageTypeASRequest,
+		PAData:      preauthData,
+		Body: kdcRequestBody{
+			Options:         asn1.BitString{Bytes: make([]byte, 4), BitLength: 32},
+			ClientName:      newPrincipalName(nameTypePrincipal, client),
+			Realm:           explicitTag(2, generalString(client.Realm)),
+			ServerName:      newPrincipalName(nameTypeServiceInstance, service),
+			Till:            time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second),
+			Nonce:           nonce,
+			EncryptionTypes: encryptionTypeIDs,
+		},
+	}, fmt.Sprintf("application,explicit,tag:%d", messageTypeASRequest))
+	if err != nil {
+		return nil, fmt.Errorf("could not encode AS-REQ: %s", err.Error())
+	}
+
+	response, err := c.exchange(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseReply(response)
+}
+
+// exchange sends the given message to the KDC and returns its response. UDP is being used unless --tcp has been
+// specified, falling back to TCP if the KDC indicates that the response is too big, e.g. due to large PACs on AD.
+func (c *kdcClient) exchange(request []byte) ([]byte, error) {
+	if !c.options.tcp {
+		response, err := c.exchangeUDP(request)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := parseReply(response); !isKDCError(err, errResponseTooBig) {
+			return response, nil
+		}
+	}
+
+	return c.exchangeTCP(request)
+}
+
+func (c *kdcClient) exchangeUDP(request []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", c.options.address, time.Until(c.deadline))
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to KDC: %s", err.Error())
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(c.deadline); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return nil, fmt.Errorf("could not send request to KDC: %s", err.Error())
+	}
+
+	buffer := make([]byte, 65535)
+	length, err := conn.Read(buffer)
+	if err != nil {
+		return nil, fmt.Errorf("could not receive response from KDC: %s", err.Error())
+	}
+
+	return buffer[:length], nil
+}
+
+func (c *kdcClient) exchangeTCP(request []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", c.options.address, time.Until(c.deadline))
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to KDC: %s", err.Error())
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(c.deadline); err != nil {
+		return nil, err
+	}
+
+	message := make([]byte, 4, 4+len(request))
+	binary.BigEndian.PutUint32(message, uint32(len(request)))
+	if _, err := conn.Write(append(message, request...)); err != nil {
+		return nil, fmt.Errorf("could not send request to KDC: %s", err.Error())
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, fmt.Errorf("could not receive response from KDC: %s", err.Error())
+	}
+
+	length := binary.BigEndian.Uint32(header)
+	if length > maxTCPMessageLength {
+		return nil, fmt.Errorf("could not receive response from KDC: message too long")
+	}
+
+	response := make([]byte, length)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, fmt.Errorf("could not receive response from KDC: %s", err.Error())
+	}
+
+	return response, nil
+}
+
+// parseReply parses the response of the KDC to an AS-REQ, returning KRB-ERROR messages as kdcError
+func parseReply(data []byte) (*kdcReply, error) {
+	var message asn1.RawValue
+	if _, err := asn1.Unmarshal(data, &message); err != nil || message.Class != asn1.ClassApplication {
+		return nil, fmt.Errorf("could not parse response of KDC")
+	}
+
+	switch message.Tag {
+	case messageTypeASReply:
+		var reply kdcReply
+		if _, err := asn1.Unmarshal(message.Bytes, &reply); err != nil {
+			return nil, fmt.Errorf("could not parse AS-REP: %s", err.Error())
+		}
+		return &reply, nil
+
+	case messageTypeError:
+		var errMessage errorMessage
+		if _, err := asn1.Unmarshal(message.Bytes, &errMessage); err != nil {
+			return nil, fmt.Errorf("could not parse KRB-ERROR: %s", err.Error())
+		}
+		return nil, &kdcError{Code: errMessage.ErrorCode, Text: errMessage.Text, Data: errMessage.Data}
+	}
+
+	return nil, fmt.Errorf("unexpected response of KDC with message type %d", message.Tag)
+}
+
+// selectPreauthType returns the first encryption type announced by the KDC within ETYPE-INFO2 or ETYPE-INFO, for
+// which a key is available. The most preferred encryption type of the client is used if none has been announced.
+func selectPreauthType(methodData []byte, encryptionTypeIDs []int32) int32 {
+	var entries []paData
+	if _, err := asn1.Unmarshal(methodData, &entries); err == nil {
+		for _, entry := range entries {
+			if entry.Type != paEncryptionInfo2 && entry.Type != paEncryptionInfo {
+				continue
+			}
+
+			var infoEntries []encryptionInfoEntry
+			if _, err := asn1.Unmarshal(entry.Value, &infoEntries); err != nil {
+				continue
+			}
+			for _, info := range infoEntries {
+				for _, id := range encryptionTypeIDs {
+					if info.EncryptionType == id {
+						return id
+					}
+				}
+			}
+		}
+	}
+
+	return encryptionTypeIDs[0]
+}
+
+func encryptedTimestamp(key keytabEntry) (paData, error) {
+	now := time.Now().UTC()
+	plaintext, err := asn1.Marshal(paEncryptedTimestampData{
+		Timestamp:    now.Truncate(time.Second),
+		Microseconds: now.Nanosecond() / 1000,
+	})
+	if err != nil {
+		return paData{}, err
+	}
+
+	ciphertext, err := encryptionTypes[key.KeyType].Encrypt(key.Key, keyUsageEncryptedTimestamp, plaintext)
+	if err != nil {
+		return paData{}, fmt.Errorf("could not encrypt timestamp: %s", err.Error())
+	}
+
+	value, err := asn1.Marshal(encryptedData{EncryptionType: key.KeyType, Cipher: ciphertext})
+	if err != nil {
+		return paData{}, err
+	}
+
+	return paData{Type: paEncryptedTimestamp, Value: value}, nil
+}
+
+func newPrincipalName(nameType int32, name principal) principalName {
+	result := principalName{NameType: nameType}
+	for _, component := range name.Components {
+		result.NameString = append(result.NameString, generalString(component))
+	}
+
+	return result
+}
+
+// generalString returns the given value as KerberosString, which is a GeneralString not supported by encoding/asn1
+func generalString(value string) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagGeneralString, Bytes: []byte(value)}
+}
+
+// explicitTag wraps the given value with a context-specific tag, as encoding/asn1 ignores field tags of raw values
+func explicitTag(tag int, value asn1.RawValue) asn1.RawValue {
+	content, _ := asn1.Marshal(value)
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: content}
+}
+
+func randomNonce() (int64, error) {
+	data := make([]byte, 4)
+	if _, err := rand.Read(data); err != nil {
+		return 0, err
+	}
+
+	return int64(binary.BigEndian.Uint32(data) & 0x7fffffff), nil
+}
+
+func isKDCError(err error, code int32) bool {
+	krbErr, ok := err.(*kdcError)
+	return ok && krbErr.Code == code
+}
+
+func (e *kdcError) Name() string {
+	if name, ok := kdcErrorNames[e.Code]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("KRB_ERROR_%d", e.Code)
+}
+
+func (e *kdcError) Error() string {
+	if e.Text != "" {
+		return fmt.Sprintf("%s: %s", e.Name(), e.Text)
+	}
+
+	return e.Name()
+}
@@ -0,0 +1,291 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modkerberos
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// encryptionType implements encryption and decryption of a Kerberos encryption type as specified by RFC 3961, which
+// is only required for the pre-authentication timestamp and the encrypted part of the AS-REP
+type encryptionType struct {
+	ID      int32
+	Name    string
+	KeySize int
+	Encrypt func(key []byte, usage uint32, plaintext []byte) ([]byte, error)
+	Decrypt func(key []byte, usage uint32, ciphertext []byte) ([]byte, error)
+}
+
+const (
+	keyUsageEncryptedTimestamp = 1
+	keyUsageASRepEncryptedPart = 3
+
+	aesMACSize = 12
+)
+
+var errIntegrity = errors.New("integrity check failed")
+
+var encryptionTypes = map[int32]encryptionType{
+	17: {ID: 17, Name: "aes128-cts-hmac-sha1-96", KeySize: 16, Encrypt: aesEncrypt, Decrypt: aesDecrypt},
+	18: {ID: 18, Name: "aes256-cts-hmac-sha1-96", KeySize: 32, Encrypt: aesEncrypt, Decrypt: aesDecrypt},
+	23: {ID: 23, Name: "rc4-hmac", KeySize: 16, Encrypt: rc4Encrypt, Decrypt: rc4Decrypt},
+}
+
+// preferredEncryptionTypes contains the IDs of all supported encryption types in order of preference
+var preferredEncryptionTypes = []int32{18, 17, 23}
+
+func encryptionTypeName(id int32) string {
+	if encType, ok := encryptionTypes[id]; ok {
+		return encType.Name
+	}
+
+	return fmt.Sprintf("etype-%d", id)
+}
+
+// aesEncrypt implements aes128-cts-hmac-sha1-96 and aes256-cts-hmac-sha1-96 as specified by RFC 3962
+func aesEncrypt(key []byte, usage uint32, plaintext []byte) ([]byte, error) {
+	encryptionKey, integrityKey, err := aesUsageKeys(key, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	confounder := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(confounder); err != nil {
+		return nil, err
+	}
+
+	data := append(confounder, plaintext...)
+	ciphertext, err := ctsEncrypt(encryptionKey, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(ciphertext, hmacSum(sha1.New, integrityKey, data)[:aesMACSize]...), nil
+}
+
+func aesDecrypt(key []byte, usage uint32, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aes.BlockSize+aesMACSize {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+
+	encryptionKey, integrityKey, err := aesUsageKeys(key, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := ciphertext[len(ciphertext)-aesMACSize:]
+	data, err := ctsDecrypt(encryptionKey, ciphertext[:len(ciphertext)-aesMACSize])
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(hmacSum(sha1.New, integrityKey, data)[:aesMACSize], mac) {
+		return nil, errIntegrity
+	}
+
+	return data[aes.BlockSize:], nil
+}
+
+func aesUsageKeys(key []byte, usage uint32) (encryptionKey []byte, integrityKey []byte, _ error) {
+	constant := make([]byte, 5)
+	binary.BigEndian.PutUint32(constant, usage)
+
+	constant[4] = 0xaa
+	encryptionKey, err := deriveKey(key, constant)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	constant[4] = 0x55
+	integrityKey, err = deriveKey(key, constant)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encryptionKey, integrityKey, nil
+}
+
+// deriveKey implements DK(key, constant) of RFC 3961 for AES, where random-to-key is the identity function
+func deriveKey(key []byte, constant []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	folded := nFold(constant, aes.BlockSize)
+	derived := make([]byte, 0, len(key)+aes.BlockSize)
+	for len(derived) < len(key) {
+		block.Encrypt(folded, folded)
+		derived = append(derived, folded...)
+	}
+
+	return derived[:len(key)], nil
+}
+
+// nFold stretches or shrinks the given input to the given amount of bytes as specified by RFC 3961
+func nFold(input []byte, size int) []byte {
+	inBytes, outBytes := len(input), size
+	a, b := outBytes, inBytes
+	for b != 0 {
+		a, b = b, a%b
+	}
+	lcm := outBytes * inBytes / a
+
+	output := make([]byte, outBytes)
+	carry := 0
+	for i := lcm - 1; i >= 0; i-- {
+		msbit := ((inBytes << 3) - 1 + ((inBytes<<3)+13)*(i/inBytes) + ((inBytes - i%inBytes) << 3)) % (inBytes << 3)
+		carry += ((int(input[(inBytes-1-(msbit>>3))%inBytes])<<8 |
+			int(input[(inBytes-(msbit>>3))%inBytes])) >> uint((msbit&7)+1)) & 0xff
+		carry += int(output[i%outBytes])
+		output[i%outBytes] = byte(carry)
+		carry >>= 8
+	}
+
+	for i := outBytes - 1; carry != 0 && i >= 0; i-- {
+		carry += int(output[i])
+		output[i] = byte(carry)
+		carry >>= 8
+	}
+
+	return output
+}
+
+// ctsEncrypt encrypts the given data using AES in CBC mode with ciphertext stealing and a zero IV, which always swaps
+// the last two blocks as specified by RFC 3962
+func ctsEncrypt(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aes.BlockSize {
+		return nil, fmt.Errorf("plaintext is too short")
+	}
+
+	padded := make([]byte, (len(data)+aes.BlockSize-1)/aes.BlockSize*aes.BlockSize)
+	copy(padded, data)
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(padded, padded)
+	if len(padded) == aes.BlockSize {
+		return padded, nil
+	}
+
+	size := len(padded)
+	remainder := len(data) - (size - aes.BlockSize)
+	result := append([]byte{}, padded[:size-2*aes.BlockSize]...)
+	result = append(result, padded[size-aes.BlockSize:]...)
+	return append(result, padded[size-2*aes.BlockSize:size-2*aes.BlockSize+remainder]...), nil
+}
+
+func ctsDecrypt(key []byte, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aes.BlockSize {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	if len(ciphertext) == aes.BlockSize {
+		plaintext := make([]byte, aes.BlockSize)
+		block.Decrypt(plaintext, ciphertext)
+		return plaintext, nil
+	}
+
+	// Restore the regular CBC ciphertext by decrypting the final block, which reveals the stolen bytes
+	size := len(ciphertext)
+	remainder := size - (size-1)/aes.BlockSize*aes.BlockSize
+	finalBlock := ciphertext[size-remainder-aes.BlockSize : size-remainder]
+	decryptedFinal := make([]byte, aes.BlockSize)
+	block.Decrypt(decryptedFinal, finalBlock)
+
+	regular := append([]byte{}, ciphertext[:size-remainder-aes.BlockSize]...)
+	regular = append(regular, ciphertext[size-remainder:]...)
+	regular = append(regular, decryptedFinal[remainder:]...)
+	regular = append(regular, finalBlock...)
+
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(regular, regular)
+	return regular[:size], nil
+}
+
+// rc4Encrypt implements rc4-hmac as specified by RFC 4757, which is still being used by older Active Directory domains
+func rc4Encrypt(key []byte, usage uint32, plaintext []byte) ([]byte, error) {
+	confounder := make([]byte, 8)
+	if _, err := rand.Read(confounder); err != nil {
+		return nil, err
+	}
+
+	data := append(confounder, plaintext...)
+	usageKey := hmacSum(md5.New, key, rc4UsageConstant(usage))
+	checksum := hmacSum(md5.New, usageKey, data)
+
+	stream, err := rc4.NewCipher(hmacSum(md5.New, usageKey, checksum))
+	if err != nil {
+		return nil, err
+	}
+	stream.XORKeyStream(data, data)
+
+	return append(checksum, data...), nil
+}
+
+func rc4Decrypt(key []byte, usage uint32, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < md5.Size+8 {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+
+	checksum := ciphertext[:md5.Size]
+	usageKey := hmacSum(md5.New, key, rc4UsageConstant(usage))
+
+	stream, err := rc4.NewCipher(hmacSum(md5.New, usageKey, checksum))
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, len(ciphertext)-md5.Size)
+	stream.XORKeyStream(data, ciphertext[md5.Size:])
+
+	if !hmac.Equal(hmacSum(md5.New, usageKey, data), checksum) {
+		return nil, errIntegrity
+	}
+
+	return data[8:], nil
+}
+
+// rc4UsageConstant returns the little-endian key usage, where RFC 4757 maps the usage of the AS-REP encrypted part to
+// the one of the TGS-REP encrypted part
+func rc4UsageConstant(usage uint32) []byte {
+	if usage == keyUsageASRepEncryptedPart {
+		usage = 8
+	}
+
+	constant := make([]byte, 4)
+	binary.LittleEndian.PutUint32(constant, usage)
+	return constant
+}
+
+func hmacSum(newHash func() hash.Hash, key []byte, data []byte) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
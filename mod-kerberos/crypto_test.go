@@ -0,0 +1,149 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modkerberos
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func decodeHex(t *testing.T, value string) []byte {
+	data, err := hex.DecodeString(value)
+	require.NoError(t, err, value)
+	return data
+}
+
+func TestNFold(t *testing.T) {
+	// given: RFC 3961 A.1
+	testCases := []struct {
+		input    string
+		size     int
+		expected string
+	}{
+		{"012345", 8, "be072631276b1955"},
+		{"password", 7, "78a07b6caf85fa"},
+		{"Rough Consensus, and Running Code", 8, "bb6ed30870b7f0e0"},
+		{"password", 21, "59e4a8ca7c0385c3c37b3f6d2000247cb6e6bd5b3e"},
+		{"MASSACHVSETTS INSTITVTE OF TECHNOLOGY", 24, "db3b0d8f0b061e603282b308a50841229ad798fab9540c1b"},
+		{"Q", 21, "518a54a215a8452a518a54a215a8452a518a54a215"},
+		{"kerberos", 8, "6b65726265726f73"},
+		{"kerberos", 16, "6b65726265726f737b9b5b2b93132b93"},
+	}
+
+	for _, testCase := range testCases {
+		// when
+		output := nFold([]byte(testCase.input), testCase.size)
+
+		// then
+		assert.Equal(t, testCase.expected, hex.EncodeToString(output), testCase.input)
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	// given: RFC 3962 Appendix B, deriving the final key from the PBKDF2 output for the password "password" and the
+	// salt "ATHENA.MIT.EDUraeburn" using DK(tkey, "kerberos")
+	testCases := []struct {
+		name     string
+		tkey     string
+		expected string
+	}{
+		{"128-bit, 1 iteration", "cdedb5281bb2f801565a1122b2563515", "42263c6e89f4fc28b8df68ee09799f15"},
+		{
+			"256-bit, 1 iteration",
+			"cdedb5281bb2f801565a1122b25635150ad1f7a04bb9f3a333ecc0e2e1f70837",
+			"fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161",
+		},
+		{"128-bit, 2 iterations", "01dbee7f4a9e243e988b62c73cda935d", "c651bf29e2300ac27fa469d693bdda13"},
+		{
+			"256-bit, 2 iterations",
+			"01dbee7f4a9e243e988b62c73cda935da05378b93244ec8f48a99e61ad799d86",
+			"a2e16d16b36069c135d5e9d2e25f896102685618b95914b467c67622225824ff",
+		},
+		{"128-bit, 1200 iterations", "5c08eb61fdf71e4e4ec3cf6ba1f5512b", "4c01cd46d632d01e6dbe230a01ed642a"},
+		{
+			"256-bit, 1200 iterations",
+			"5c08eb61fdf71e4e4ec3cf6ba1f5512ba7e52ddbc5e5142f708a31e2e62b1e13",
+			"55a6ac740ad17b4846941051e1e8b0a7548d93b0ab30a8bc3ff16280382b8c2a",
+		},
+	}
+
+	for _, testCase := range testCases {
+		// when
+		key, err := deriveKey(decodeHex(t, testCase.tkey), []byte("kerberos"))
+
+		// then
+		require.NoError(t, err, testCase.name)
+		assert.Equal(t, testCase.expected, hex.EncodeToString(key), testCase.name)
+	}
+}
+
+func TestCTS(t *testing.T) {
+	// given: RFC 3962 Appendix B, using the AES-128 key "chicken teriyaki" and prefixes of the given plaintext
+	key := []byte("chicken teriyaki")
+	plaintext := []byte("I would like the General Gau's Chicken, please, and wonton soup.")
+	testCases := []struct {
+		length   int
+		expected string
+	}{
+		{17, "c6353568f2bf8cb4d8a580362da7ff7f97"},
+		{31, "fc00783e0efdb2c1d445d4c8eff7ed2297687268d6ecccc0c07b25e25ecfe5"},
+		{32, "39312523a78662d5be7fcbcc98ebf5a897687268d6ecccc0c07b25e25ecfe584"},
+		{47, "97687268d6ecccc0c07b25e25ecfe584b3fffd940c16a18c1b5549d2f838029e39312523a78662d5be7fcbcc98ebf5"},
+		{48, "97687268d6ecccc0c07b25e25ecfe5849dad8bbb96c4cdc03bc103e1a194bbd839312523a78662d5be7fcbcc98ebf5a8"},
+		{
+			64,
+			"97687268d6ecccc0c07b25e25ecfe58439312523a78662d5be7fcbcc98ebf5a8" +
+				"4807efe836ee89a526730dbc2f7bc8409dad8bbb96c4cdc03bc103e1a194bbd8",
+		},
+	}
+
+	for _, testCase := range testCases {
+		data := plaintext[:testCase.length]
+
+		// when
+		ciphertext, err := ctsEncrypt(key, data)
+		require.NoError(t, err, testCase.length)
+		decrypted, err := ctsDecrypt(key, ciphertext)
+		require.NoError(t, err, testCase.length)
+
+		// then
+		assert.Equal(t, testCase.expected, hex.EncodeToString(ciphertext), testCase.length)
+		assert.Equal(t, data, decrypted, testCase.length)
+	}
+}
+
+func TestAES_RoundTrip(t *testing.T) {
+	// given
+	key := decodeHex(t, "fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161")
+	plaintext := []byte("pre-authentication timestamp")
+
+	// when
+	ciphertext, err := aesEncrypt(key, keyUsageEncryptedTimestamp, plaintext)
+	require.NoError(t, err)
+	decrypted, err := aesDecrypt(key, keyUsageEncryptedTimestamp, ciphertext)
+	require.NoError(t, err)
+	ciphertext[0] ^= 0xff
+	_, tamperedErr := aesDecrypt(key, keyUsageEncryptedTimestamp, ciphertext)
+
+	// then
+	assert.Equal(t, plaintext, decrypted)
+	assert.Equal(t, errIntegrity, tamperedErr)
+}
@@ -0,0 +1,68 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modkerberos
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+	"net"
+	"strconv"
+	"time"
+)
+
+type kerberosModule struct {
+	nagocheck.Module
+
+	host    string
+	port    uint16
+	tcp     bool
+	timeout time.Duration
+}
+
+// NewKerberosModule instantiates kerberosModule and all contained plugins
+func NewKerberosModule() nagocheck.Module {
+	return &kerberosModule{
+		Module: nagocheck.NewModule("kerberos",
+			nagocheck.ModuleDescription("Kerberos"),
+			nagocheck.ModulePlugin(newKDCPlugin()),
+		),
+	}
+}
+
+func (m *kerberosModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("host", "Specifies the hostname or address of the KDC, e.g. a domain controller.").
+		Short('H').Required().StringVar(&m.host)
+
+	node.Flag("port", "Specifies the port of the KDC.").
+		Short('p').Default("88").Uint16Var(&m.port)
+
+	node.Flag("tcp", "Always talk to the KDC using TCP instead of UDP. UDP falls back to TCP anyway if the KDC "+
+		"indicates that its response is too big.").
+		BoolVar(&m.tcp)
+
+	node.Flag("timeout", "Specifies the timeout for the whole conversation with the KDC.").
+		Short('t').Default("10s").DurationVar(&m.timeout)
+}
+
+// options returns the connection options of the KDC client based on the module flags
+func (m *kerberosModule) options() kdcOptions {
+	return kdcOptions{
+		address: net.JoinHostPort(m.host, strconv.Itoa(int(m.port))),
+		tcp:     m.tcp,
+		timeout: m.timeout,
+	}
+}
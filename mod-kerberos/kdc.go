@@ -0,0 +1,182 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modkerberos
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"time"
+)
+
+type kdcPlugin struct {
+	nagocheck.Plugin
+
+	Principal string
+	Keytab    string
+	Service   string
+}
+
+type kdcResource struct {
+	nagocheck.Resource
+
+	ticket       string
+	responseTime time.Duration
+	clockSkew    time.Duration
+}
+
+type kdcSummarizer struct {
+	nagocheck.Summarizer
+}
+
+func newKDCPlugin() *kdcPlugin {
+	return &kdcPlugin{
+		Plugin: nagocheck.NewPlugin("kdc",
+			nagocheck.PluginDescription("Key Distribution Center"),
+			nagocheck.PluginHysteresis(true),
+		),
+	}
+}
+
+func (p *kdcPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("principal", "Monitoring principal requesting a ticket, e.g. monitoring@EXAMPLE.COM. Active Directory "+
+		"expects the sAMAccountName and the upper-case domain as realm.").
+		Short('P').Required().StringVar(&p.Principal)
+
+	node.Flag("keytab", "Keytab containing the keys of the monitoring principal, as created by kadmin (ktadd) or "+
+		"ktpass.").
+		Short('k').Required().ExistingFileVar(&p.Keytab)
+
+	node.Flag("service", "Service principal of the requested ticket, defaults to the ticket-granting service "+
+		"krbtgt/<REALM>@<REALM>.").
+		StringVar(&p.Service)
+}
+
+func (p *kdcPlugin) DefineCheck() nagopher.Check {
+	check := nagopher.NewCheck("kdc", newKDCSummarizer(p))
+	check.AttachResources(newKDCResource(p))
+	check.AttachContexts(
+		nagopher.NewStringMatchContext("ticket", nagopher.StateCritical(), []string{"ISSUED"}),
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"response_time",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+		nagopher.NewScalarContext("clock_skew", nil, nil),
+	)
+
+	return check
+}
+
+func (p *kdcPlugin) ThisModule() *kerberosModule {
+	return p.Plugin.Module().(*kerberosModule)
+}
+
+func newKDCResource(plugin *kdcPlugin) *kdcResource {
+	return &kdcResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *kdcResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(math.Inf(1)))
+
+	if err := r.Collect(); err != nil {
+		krbErr, ok := err.(*kdcError)
+		if !ok {
+			return metrics, err
+		}
+
+		warnings.Add(nagopher.NewWarning("KDC rejected ticket request: %s", krbErr.Error()))
+		r.ticket = krbErr.Name()
+	}
+
+	metrics = append(metrics, nagopher.MustNewStringMetric("ticket", r.ticket, ""))
+	if r.ticket == "ISSUED" {
+		metrics = append(metrics,
+			nagopher.MustNewNumericMetric("response_time", r.responseTime.Seconds(), "s", &valueRange, ""),
+			nagopher.MustNewNumericMetric("clock_skew", r.clockSkew.Seconds(), "s", nil, ""),
+		)
+	}
+
+	return metrics, nil
+}
+
+func (r *kdcResource) Collect() error {
+	plugin := r.ThisPlugin()
+	options := plugin.ThisModule().options()
+
+	client, err := parsePrincipal(plugin.Principal)
+	if err != nil {
+		return err
+	}
+
+	service := principal{Components: []string{"krbtgt", client.Realm}, Realm: client.Realm}
+	if plugin.Service != "" {
+		if service, err = parsePrincipal(plugin.Service); err != nil {
+			return err
+		}
+	}
+
+	entries, err := loadKeytab(plugin.Keytab)
+	if err != nil {
+		return err
+	}
+
+	keys := keytabKeys(entries, client)
+	if len(keys) == 0 {
+		return fmt.Errorf("keytab contains no supported key for principal [%s]", client)
+	}
+
+	startTime := time.Now()
+	result, err := requestTicket(options, client, service, keys)
+	if err != nil {
+		return err
+	}
+	r.responseTime = time.Since(startTime)
+	plugin.Logger().Debugf("received ticket for %s from %s within %s using %s and %d round trips", client,
+		options.address, r.responseTime, encryptionTypeName(result.EncryptionType), result.RoundTrips)
+
+	r.ticket = "ISSUED"
+	r.clockSkew = result.ClockSkew
+
+	return nil
+}
+
+func (r *kdcResource) ThisPlugin() *kdcPlugin {
+	return r.Resource.Plugin().(*kdcPlugin)
+}
+
+func newKDCSummarizer(plugin *kdcPlugin) *kdcSummarizer {
+	return &kdcSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *kdcSummarizer) Ok(check nagopher.Check) string {
+	results := check.Results()
+	responseTime := results.GetNumericMetricValue("response_time").OrElse(math.NaN())
+	clockSkew := results.GetNumericMetricValue("clock_skew").OrElse(math.NaN())
+
+	return fmt.Sprintf("ticket for %s issued within %s - clock skew %s", s.Plugin().(*kdcPlugin).Principal,
+		time.Duration(responseTime*float64(time.Second)).Round(time.Millisecond),
+		time.Duration(clockSkew*float64(time.Second)))
+}
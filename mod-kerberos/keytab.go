@@ -0,0 +1,187 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modkerberos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// keytabEntry represents a single key of a keytab file, where a principal has one key per encryption type and version
+type keytabEntry struct {
+	Principal string
+	KVNO      uint32
+	KeyType   int32
+	Key       []byte
+}
+
+// principal represents a Kerberos principal name like monitoring@EXAMPLE.COM or krbtgt/EXAMPLE.COM@EXAMPLE.COM
+type principal struct {
+	Components []string
+	Realm      string
+}
+
+const (
+	nameTypePrincipal       = 1
+	nameTypeServiceInstance = 2
+)
+
+// loadKeytab parses a keytab file in the format being used by MIT Kerberos and Active Directory (ktpass) since version
+// 0x502, which stores all numbers in big-endian byte order
+func loadKeytab(path string) ([]keytabEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read keytab: %s", err.Error())
+	}
+	if len(data) < 2 || data[0] != 0x05 || data[1] != 0x02 {
+		return nil, fmt.Errorf("could not read keytab: unsupported format")
+	}
+
+	var entries []keytabEntry
+	reader := bytes.NewReader(data[2:])
+	for reader.Len() > 0 {
+		var size int32
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return nil, fmt.Errorf("could not read keytab: %s", err.Error())
+		}
+
+		// Negative sizes mark holes left behind by deleted entries
+		if size < 0 {
+			if _, err := reader.Seek(int64(-size), io.SeekCurrent); err != nil {
+				return nil, fmt.Errorf("could not read keytab: %s", err.Error())
+			}
+			continue
+		}
+
+		entryData := make([]byte, size)
+		if _, err := io.ReadFull(reader, entryData); err != nil {
+			return nil, fmt.Errorf("could not read keytab: truncated entry")
+		}
+
+		entry, err := parseKeytabEntry(entryData)
+		if err != nil {
+			return nil, fmt.Errorf("could not read keytab: %s", err.Error())
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func parseKeytabEntry(data []byte) (entry keytabEntry, _ error) {
+	reader := bytes.NewReader(data)
+	readString := func() (string, error) {
+		var length uint16
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return "", err
+		}
+
+		value := make([]byte, length)
+		_, err := io.ReadFull(reader, value)
+		return string(value), err
+	}
+
+	var components uint16
+	if err := binary.Read(reader, binary.BigEndian, &components); err != nil {
+		return entry, err
+	}
+
+	realm, err := readString()
+	if err != nil {
+		return entry, err
+	}
+
+	var name principal
+	name.Realm = realm
+	for index := 0; index < int(components); index++ {
+		component, err := readString()
+		if err != nil {
+			return entry, err
+		}
+		name.Components = append(name.Components, component)
+	}
+	entry.Principal = name.String()
+
+	var fields struct {
+		NameType  uint32
+		Timestamp uint32
+		KVNO      uint8
+		KeyType   uint16
+	}
+	if err := binary.Read(reader, binary.BigEndian, &fields); err != nil {
+		return entry, err
+	}
+
+	key, err := readString()
+	if err != nil {
+		return entry, err
+	}
+	entry.KeyType = int32(fields.KeyType)
+	entry.Key = []byte(key)
+	entry.KVNO = uint32(fields.KVNO)
+
+	// Newer implementations append the full key version number, as the 8-bit field wraps around
+	var kvno uint32
+	if reader.Len() >= 4 {
+		if err := binary.Read(reader, binary.BigEndian, &kvno); err == nil && kvno != 0 {
+			entry.KVNO = kvno
+		}
+	}
+
+	return entry, nil
+}
+
+// keytabKeys returns the latest key of the given principal per encryption type, ignoring unsupported ones
+func keytabKeys(entries []keytabEntry, name principal) map[int32]keytabEntry {
+	keys := make(map[int32]keytabEntry)
+	for _, entry := range entries {
+		if _, ok := encryptionTypes[entry.KeyType]; !ok || !strings.EqualFold(entry.Principal, name.String()) {
+			continue
+		}
+		if len(entry.Key) != encryptionTypes[entry.KeyType].KeySize {
+			continue
+		}
+
+		if existing, ok := keys[entry.KeyType]; !ok || entry.KVNO >= existing.KVNO {
+			keys[entry.KeyType] = entry
+		}
+	}
+
+	return keys
+}
+
+// parsePrincipal parses a principal name formatted as <component>[/<component>...]@<realm>
+func parsePrincipal(value string) (principal, error) {
+	index := strings.LastIndex(value, "@")
+	if index < 1 || index == len(value)-1 {
+		return principal{}, fmt.Errorf("invalid principal [%s]: expected <name>@<REALM>", value)
+	}
+
+	return principal{
+		Components: strings.Split(value[:index], "/"),
+		Realm:      value[index+1:],
+	}, nil
+}
+
+func (p principal) String() string {
+	return strings.Join(p.Components, "/") + "@" + p.Realm
+}
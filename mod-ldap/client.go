@@ -0,0 +1,581 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// BER tags of the LDAPv3 protocol operations (RFC 4511) and universal types, which are being used by the client
+const (
+	tagBoolean       = 0x01
+	tagInteger       = 0x02
+	tagOctetString   = 0x04
+	tagEnumerated    = 0x0a
+	tagSequence      = 0x30
+	tagBindRequest   = 0x60
+	tagBindResponse  = 0x61
+	tagUnbindRequest = 0x42
+	tagSearchRequest = 0x63
+	tagSearchEntry   = 0x64
+	tagSearchDone    = 0x65
+	tagSearchRef     = 0x73
+	tagExtendedReq   = 0x77
+	tagExtendedResp  = 0x78
+	tagSimpleAuth    = 0x80
+	tagExtendedName  = 0x80
+
+	ldapMaxPacketSize = 16 * 1024 * 1024
+	oidStartTLS       = "1.3.6.1.4.1.1466.20037"
+)
+
+// LDAP result codes which are not considered as failure
+const (
+	resultSuccess           = 0
+	resultSizeLimitExceeded = 4
+)
+
+// ldapResultCodes maps common LDAP result codes to their name as specified by RFC 4511
+var ldapResultCodes = map[int64]string{
+	1: "operationsError", 2: "protocolError", 3: "timeLimitExceeded", 7: "authMethodNotSupported",
+	8: "strongerAuthRequired", 10: "referral", 11: "adminLimitExceeded", 13: "confidentialityRequired",
+	32: "noSuchObject", 34: "invalidDNSyntax", 48: "inappropriateAuthentication", 49: "invalidCredentials",
+	50: "insufficientAccessRights", 51: "busy", 52: "unavailable", 53: "unwillingToPerform", 80: "other",
+}
+
+// ldapScopes maps the scope names accepted by the plugin to their LDAP enumeration value
+var ldapScopes = map[string]int64{"base": 0, "one": 1, "sub": 2}
+
+// ldapClient implements the small subset of LDAPv3 required for simple binds and searches, which avoids pulling in a
+// full client library for a single plugin
+type ldapClient struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	messageID int64
+}
+
+type ldapOptions struct {
+	address    string
+	serverName string
+	useTLS     bool
+	startTLS   bool
+	insecure   bool
+	timeout    time.Duration
+}
+
+// berElement is a single decoded BER element, where constructed elements contain their children
+type berElement struct {
+	tag      byte
+	content  []byte
+	children []berElement
+}
+
+// dialLDAP connects to the given directory server, optionally upgrading the connection using StartTLS
+func dialLDAP(options ldapOptions) (*ldapClient, error) {
+	tlsConfig := &tls.Config{ServerName: options.serverName, InsecureSkipVerify: options.insecure}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(options.address)
+	}
+
+	dialer := &net.Dialer{Timeout: options.timeout}
+
+	var conn net.Conn
+	var err error
+	if options.useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", options.address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", options.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to directory server: %s", err.Error())
+	}
+
+	client := &ldapClient{conn: conn, reader: bufio.NewReader(conn)}
+	if err := conn.SetDeadline(time.Now().Add(options.timeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if options.startTLS {
+		if err := client.startTLS(tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// TLSState returns the state of the TLS connection, which is only present when using LDAPS or StartTLS
+func (c *ldapClient) TLSState() (tls.ConnectionState, bool) {
+	if conn, ok := c.conn.(*tls.Conn); ok {
+		return conn.ConnectionState(), true
+	}
+
+	return tls.ConnectionState{}, false
+}
+
+// Bind authenticates using a simple bind, which is anonymous if both the DN and password are empty
+func (c *ldapClient) Bind(dn string, password string) error {
+	request := berTLV(tagBindRequest,
+		berInteger(tagInteger, 3),
+		berString(tagOctetString, dn),
+		berString(tagSimpleAuth, password),
+	)
+
+	response, err := c.roundTrip(request, tagBindResponse)
+	if err != nil {
+		return err
+	}
+
+	if err := checkResult(response, resultSuccess); err != nil {
+		return fmt.Errorf("bind failed: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Search executes a search below the given base DN and returns the amount of entries, which is limited by sizeLimit.
+// Exceeding the size limit is not considered an error.
+func (c *ldapClient) Search(baseDN string, scope int64, filter string, sizeLimit int) (entries int, _ error) {
+	encodedFilter, err := encodeFilter(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	request := berTLV(tagSearchRequest,
+		berString(tagOctetString, baseDN),
+		berInteger(tagEnumerated, scope),
+		berInteger(tagEnumerated, 0),
+		berInteger(tagInteger, int64(sizeLimit)),
+		berInteger(tagInteger, 0),
+		berTLV(tagBoolean, []byte{0xff}),
+		encodedFilter,
+		berTLV(tagSequence, berString(tagOctetString, "1.1")),
+	)
+
+	messageID, err := c.send(request)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		response, err := c.receive(messageID)
+		if err != nil {
+			return entries, err
+		}
+
+		switch response.tag {
+		case tagSearchEntry:
+			entries++
+		case tagSearchRef:
+		case tagSearchDone:
+			if err := checkResult(response, resultSuccess, resultSizeLimitExceeded); err != nil {
+				return entries, fmt.Errorf("search failed: %s", err.Error())
+			}
+			return entries, nil
+		default:
+			return entries, fmt.Errorf("unexpected response with tag 0x%02x", response.tag)
+		}
+	}
+}
+
+// Close sends an unbind request and closes the connection
+func (c *ldapClient) Close() error {
+	_, _ = c.send(berTLV(tagUnbindRequest))
+	return c.conn.Close()
+}
+
+func (c *ldapClient) startTLS(config *tls.Config) error {
+	request := berTLV(tagExtendedReq, berString(tagExtendedName, oidStartTLS))
+
+	response, err := c.roundTrip(request, tagExtendedResp)
+	if err != nil {
+		return err
+	}
+	if err := checkResult(response, resultSuccess); err != nil {
+		return fmt.Errorf("StartTLS failed: %s", err.Error())
+	}
+
+	tlsConn := tls.Client(c.conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("StartTLS handshake failed: %s", err.Error())
+	}
+
+	c.conn, c.reader = tlsConn, bufio.NewReader(tlsConn)
+	return nil
+}
+
+func (c *ldapClient) roundTrip(request []byte, expectedTag byte) (berElement, error) {
+	messageID, err := c.send(request)
+	if err != nil {
+		return berElement{}, err
+	}
+
+	response, err := c.receive(messageID)
+	if err != nil {
+		return response, err
+	}
+	if response.tag != expectedTag {
+		return response, fmt.Errorf("unexpected response with tag 0x%02x", response.tag)
+	}
+
+	return response, nil
+}
+
+func (c *ldapClient) send(operation []byte) (int64, error) {
+	c.messageID++
+	message := berTLV(tagSequence, berInteger(tagInteger, c.messageID), operation)
+
+	if _, err := c.conn.Write(message); err != nil {
+		return 0, fmt.Errorf("could not send request: %s", err.Error())
+	}
+
+	return c.messageID, nil
+}
+
+// receive reads the next message and returns its protocol operation, skipping unsolicited notifications
+func (c *ldapClient) receive(messageID int64) (berElement, error) {
+	for {
+		packet, err := readBERPacket(c.reader)
+		if err != nil {
+			return berElement{}, fmt.Errorf("could not receive response: %s", err.Error())
+		}
+
+		message, err := decodeBER(packet)
+		if err != nil {
+			return berElement{}, err
+		}
+		if message.tag != tagSequence || len(message.children) < 2 {
+			return berElement{}, fmt.Errorf("malformed LDAP message")
+		}
+
+		if decodeInteger(message.children[0].content) == messageID {
+			return message.children[1], nil
+		}
+	}
+}
+
+// checkResult returns an error if the LDAPResult contained within the given response has none of the accepted codes
+func checkResult(response berElement, acceptedCodes ...int64) error {
+	if len(response.children) < 3 {
+		return fmt.Errorf("malformed LDAP result")
+	}
+
+	resultCode := decodeInteger(response.children[0].content)
+	for _, acceptedCode := range acceptedCodes {
+		if resultCode == acceptedCode {
+			return nil
+		}
+	}
+
+	name, ok := ldapResultCodes[resultCode]
+	if !ok {
+		name = fmt.Sprintf("result code %d", resultCode)
+	}
+	if message := strings.TrimSpace(string(response.children[2].content)); message != "" {
+		return fmt.Errorf("%s (%s)", name, message)
+	}
+
+	return fmt.Errorf("%s", name)
+}
+
+// encodeFilter converts a search filter in its string representation as specified by RFC 4515 into BER, supporting
+// the operators &, |, !, =, >=, <=, ~= as well as presence and substring matches
+func encodeFilter(filter string) ([]byte, error) {
+	filter = strings.TrimSpace(filter)
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+
+	encoded, rest, err := parseFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter [%s]: %s", filter, err.Error())
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid filter [%s]: unexpected trailing data", filter)
+	}
+
+	return encoded, nil
+}
+
+func parseFilter(filter string) (encoded []byte, rest string, _ error) {
+	if !strings.HasPrefix(filter, "(") {
+		return nil, "", fmt.Errorf("expected '('")
+	}
+	filter = filter[1:]
+	if filter == "" {
+		return nil, "", fmt.Errorf("unexpected end of filter")
+	}
+
+	switch filter[0] {
+	case '&', '|':
+		tag := byte(0xa0)
+		if filter[0] == '|' {
+			tag = 0xa1
+		}
+
+		var children [][]byte
+		rest = filter[1:]
+		for strings.HasPrefix(rest, "(") {
+			child, childRest, err := parseFilter(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			children, rest = append(children, child), childRest
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", fmt.Errorf("expected ')'")
+		}
+
+		return berTLV(tag, children...), rest[1:], nil
+
+	case '!':
+		child, childRest, err := parseFilter(filter[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(childRest, ")") {
+			return nil, "", fmt.Errorf("expected ')'")
+		}
+
+		return berTLV(0xa2, child), childRest[1:], nil
+	}
+
+	end := strings.Index(filter, ")")
+	if end == -1 {
+		return nil, "", fmt.Errorf("expected ')'")
+	}
+
+	encoded, err := encodeFilterItem(filter[:end])
+	return encoded, filter[end+1:], err
+}
+
+func encodeFilterItem(item string) ([]byte, error) {
+	index := strings.Index(item, "=")
+	if index < 1 {
+		return nil, fmt.Errorf("invalid filter item [%s]", item)
+	}
+
+	attribute, value, tag := item[:index], item[index+1:], byte(0xa3)
+	switch attribute[len(attribute)-1] {
+	case '>':
+		attribute, tag = attribute[:len(attribute)-1], 0xa5
+	case '<':
+		attribute, tag = attribute[:len(attribute)-1], 0xa6
+	case '~':
+		attribute, tag = attribute[:len(attribute)-1], 0xa8
+	}
+
+	if tag == 0xa3 && value == "*" {
+		return berString(0x87, attribute), nil
+	}
+	if tag == 0xa3 && strings.Contains(value, "*") {
+		parts := strings.Split(value, "*")
+
+		var substrings [][]byte
+		for partIndex, part := range parts {
+			if part == "" {
+				continue
+			}
+
+			decoded, err := unescapeFilterValue(part)
+			if err != nil {
+				return nil, err
+			}
+
+			partTag := byte(0x81)
+			if partIndex == 0 {
+				partTag = 0x80
+			} else if partIndex == len(parts)-1 {
+				partTag = 0x82
+			}
+			substrings = append(substrings, berString(partTag, decoded))
+		}
+
+		return berTLV(0xa4, berString(tagOctetString, attribute), berTLV(tagSequence, substrings...)), nil
+	}
+
+	decoded, err := unescapeFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return berTLV(tag, berString(tagOctetString, attribute), berString(tagOctetString, decoded)), nil
+}
+
+// unescapeFilterValue decodes escape sequences like \2a within filter values
+func unescapeFilterValue(value string) (string, error) {
+	var result strings.Builder
+	for index := 0; index < len(value); index++ {
+		if value[index] != '\\' {
+			result.WriteByte(value[index])
+			continue
+		}
+
+		if index+2 >= len(value) {
+			return "", fmt.Errorf("invalid escape sequence in filter value [%s]", value)
+		}
+		decoded, err := hex.DecodeString(value[index+1 : index+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape sequence in filter value [%s]", value)
+		}
+		result.Write(decoded)
+		index += 2
+	}
+
+	return result.String(), nil
+}
+
+func berTLV(tag byte, values ...[]byte) []byte {
+	var content []byte
+	for _, value := range values {
+		content = append(content, value...)
+	}
+
+	length := len(content)
+	if length < 0x80 {
+		return append([]byte{tag, byte(length)}, content...)
+	}
+
+	var lengthBytes []byte
+	for ; length > 0; length >>= 8 {
+		lengthBytes = append([]byte{byte(length)}, lengthBytes...)
+	}
+
+	return append(append([]byte{tag, 0x80 | byte(len(lengthBytes))}, lengthBytes...), content...)
+}
+
+func berString(tag byte, value string) []byte {
+	return berTLV(tag, []byte(value))
+}
+
+func berInteger(tag byte, value int64) []byte {
+	content := []byte{byte(value)}
+	for value >>= 8; value != 0 && value != -1; value >>= 8 {
+		content = append([]byte{byte(value)}, content...)
+	}
+	if value == 0 && content[0]&0x80 != 0 {
+		content = append([]byte{0x00}, content...)
+	} else if value == -1 && content[0]&0x80 == 0 {
+		content = append([]byte{0xff}, content...)
+	}
+
+	return berTLV(tag, content)
+}
+
+// readBERPacket reads a single BER element including its tag and length from the given reader
+func readBERPacket(reader *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+
+	length := int(header[1])
+	if header[1]&0x80 != 0 {
+		lengthBytes := make([]byte, header[1]&0x7f)
+		if len(lengthBytes) == 0 || len(lengthBytes) > 4 {
+			return nil, fmt.Errorf("unsupported BER length encoding")
+		}
+		if _, err := io.ReadFull(reader, lengthBytes); err != nil {
+			return nil, err
+		}
+
+		length = 0
+		for _, lengthByte := range lengthBytes {
+			length = length<<8 | int(lengthByte)
+		}
+		header = append(header, lengthBytes...)
+	}
+	if length > ldapMaxPacketSize {
+		return nil, fmt.Errorf("packet exceeds maximum size of %d bytes", ldapMaxPacketSize)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(reader, content); err != nil {
+		return nil, err
+	}
+
+	return append(header, content...), nil
+}
+
+// decodeBER decodes a single BER element, recursing into constructed elements
+func decodeBER(data []byte) (berElement, error) {
+	element, rest, err := decodeBERElement(data)
+	if err == nil && len(rest) != 0 {
+		err = fmt.Errorf("unexpected trailing data in BER element")
+	}
+
+	return element, err
+}
+
+func decodeBERElement(data []byte) (element berElement, rest []byte, _ error) {
+	if len(data) < 2 {
+		return element, nil, fmt.Errorf("truncated BER element")
+	}
+
+	element.tag = data[0]
+	length, offset := int(data[1]), 2
+	if data[1]&0x80 != 0 {
+		lengthSize := int(data[1] & 0x7f)
+		if lengthSize == 0 || lengthSize > 4 || len(data) < 2+lengthSize {
+			return element, nil, fmt.Errorf("invalid BER length")
+		}
+
+		length = 0
+		for _, lengthByte := range data[2 : 2+lengthSize] {
+			length = length<<8 | int(lengthByte)
+		}
+		offset += lengthSize
+	}
+	if length < 0 || len(data) < offset+length {
+		return element, nil, fmt.Errorf("truncated BER element")
+	}
+
+	element.content = data[offset : offset+length]
+	if element.tag&0x20 != 0 {
+		for remaining := element.content; len(remaining) > 0; {
+			child, childRest, err := decodeBERElement(remaining)
+			if err != nil {
+				return element, nil, err
+			}
+			element.children, remaining = append(element.children, child), childRest
+		}
+	}
+
+	return element, data[offset+length:], nil
+}
+
+func decodeInteger(content []byte) int64 {
+	var value int64
+	for index, octet := range content {
+		if index == 0 && octet&0x80 != 0 {
+			value = -1
+		}
+		value = value<<8 | int64(octet)
+	}
+
+	return value
+}
@@ -0,0 +1,99 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modldap
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+	"net"
+	"strconv"
+	"time"
+)
+
+type ldapModule struct {
+	nagocheck.Module
+
+	host       string
+	port       uint16
+	useTLS     bool
+	startTLS   bool
+	insecure   bool
+	serverName string
+	bindDN     string
+	password   string
+	timeout    time.Duration
+}
+
+// NewLDAPModule instantiates ldapModule and all contained plugins
+func NewLDAPModule() nagocheck.Module {
+	return &ldapModule{
+		Module: nagocheck.NewModule("ldap",
+			nagocheck.ModuleDescription("LDAP / Active Directory"),
+			nagocheck.ModulePlugin(newServerPlugin()),
+		),
+	}
+}
+
+func (m *ldapModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("host", "Specifies the hostname or address of the directory server.").
+		Short('H').Required().StringVar(&m.host)
+
+	node.Flag("port", "Specifies the port of the directory server, defaults to 389 or 636 when using LDAPS.").
+		Short('p').Uint16Var(&m.port)
+
+	node.Flag("ldaps", "Connect to the directory server using LDAPS (LDAP over TLS).").
+		BoolVar(&m.useTLS)
+
+	node.Flag("starttls", "Upgrade the connection to TLS using the StartTLS extended operation.").
+		BoolVar(&m.startTLS)
+
+	node.Flag("insecure", "Skip verification of the TLS certificate presented by the directory server.").
+		BoolVar(&m.insecure)
+
+	node.Flag("server-name", "Server name used for verifying the TLS certificate, defaults to the given host.").
+		StringVar(&m.serverName)
+
+	node.Flag("bind-dn", "Specifies the DN used for a simple bind, e.g. cn=monitoring,dc=example,dc=com or "+
+		"monitoring@example.com for Active Directory. Binds anonymously if not set.").
+		Short('D').StringVar(&m.bindDN)
+
+	node.Flag("password", "Specifies the password used for a simple bind.").
+		Envar("NAGOCHECK_LDAP_PASSWORD").StringVar(&m.password)
+
+	node.Flag("timeout", "Specifies the timeout for the whole conversation with the directory server.").
+		Short('t').Default("10s").DurationVar(&m.timeout)
+}
+
+// options returns the connection options of the LDAP client based on the module flags
+func (m *ldapModule) options() ldapOptions {
+	port := m.port
+	if port == 0 {
+		port = 389
+		if m.useTLS {
+			port = 636
+		}
+	}
+
+	return ldapOptions{
+		address:    net.JoinHostPort(m.host, strconv.Itoa(int(port))),
+		serverName: m.serverName,
+		useTLS:     m.useTLS,
+		startTLS:   m.startTLS && !m.useTLS,
+		insecure:   m.insecure,
+		timeout:    m.timeout,
+	}
+}
@@ -0,0 +1,211 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modldap
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"strings"
+	"time"
+)
+
+type serverPlugin struct {
+	nagocheck.Plugin
+
+	BaseDN       string
+	Filter       string
+	Scope        string
+	MinEntries   int
+	CertWarning  nagopher.OptionalBounds
+	CertCritical nagopher.OptionalBounds
+}
+
+type serverResource struct {
+	nagocheck.Resource
+
+	connectTime      time.Duration
+	bindTime         time.Duration
+	searchTime       time.Duration
+	entries          int
+	certificateValid time.Time
+}
+
+type serverSummarizer struct {
+	nagocheck.Summarizer
+}
+
+func newServerPlugin() *serverPlugin {
+	return &serverPlugin{
+		Plugin: nagocheck.NewPlugin("server",
+			nagocheck.PluginDescription("Directory Server"),
+			nagocheck.PluginHysteresis(true),
+		),
+	}
+}
+
+func (p *serverPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("base-dn", "Base DN of the search, e.g. dc=example,dc=com. Defaults to the root DSE, which is "+
+		"readable by anonymous users on most directory servers.").
+		Short('b').StringVar(&p.BaseDN)
+
+	node.Flag("filter", "Search filter as specified by RFC 4515, e.g. (&(objectClass=user)(sAMAccountName=krbtgt)).").
+		Short('f').Default("(objectClass=*)").StringVar(&p.Filter)
+
+	node.Flag("scope", "Scope of the search.").
+		Short('s').Default("base").EnumVar(&p.Scope, "base", "one", "sub")
+
+	node.Flag("min-entries", "Minimum amount of entries the search must return, otherwise CRITICAL is returned.").
+		Default("1").IntVar(&p.MinEntries)
+
+	nagocheck.DurationBoundsVar(node.Flag("cert-warning", "Warning threshold for the remaining validity of the TLS "+
+		"certificate when using LDAPS or StartTLS, formatted as Nagios range specifier using durations like 14d:.").
+		Default("14d:"), &p.CertWarning)
+
+	nagocheck.DurationBoundsVar(node.Flag("cert-critical", "Critical threshold for the remaining validity of the TLS "+
+		"certificate when using LDAPS or StartTLS, formatted as Nagios range specifier using durations like 7d:.").
+		Default("7d:"), &p.CertCritical)
+}
+
+func (p *serverPlugin) DefineCheck() nagopher.Check {
+	entriesBounds := nagopher.NewBounds(nagopher.LowerBound(float64(p.MinEntries)), nagopher.UpperBound(math.Inf(1)))
+
+	check := nagopher.NewCheck("ldap", newServerSummarizer(p))
+	check.AttachResources(newServerResource(p))
+	check.AttachContexts(
+		nagopher.NewScalarContext("connect_time", nil, nil),
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"response_time",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+		nagopher.NewScalarContext("entries", nil, &entriesBounds),
+		nagopher.NewScalarContext("certificate_validity",
+			nagopher.OptionalBoundsPtr(p.CertWarning),
+			nagopher.OptionalBoundsPtr(p.CertCritical),
+		),
+	)
+
+	return check
+}
+
+func (p *serverPlugin) ThisModule() *ldapModule {
+	return p.Plugin.Module().(*ldapModule)
+}
+
+func newServerResource(plugin *serverPlugin) *serverResource {
+	return &serverResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *serverResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(math.Inf(1)))
+
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("connect_time", r.connectTime.Seconds(), "s", &valueRange, ""),
+		nagopher.MustNewNumericMetric("bind_time", r.bindTime.Seconds(), "s", &valueRange, "response_time"),
+		nagopher.MustNewNumericMetric("search_time", r.searchTime.Seconds(), "s", &valueRange, "response_time"),
+		nagopher.MustNewNumericMetric("entries", float64(r.entries), "", &valueRange, ""),
+	)
+
+	if !r.certificateValid.IsZero() {
+		remaining := nagocheck.Round(time.Until(r.certificateValid).Seconds(), 0)
+		metrics = append(metrics,
+			nagopher.MustNewNumericMetric("certificate_validity", remaining, "s", nil, ""),
+		)
+	}
+
+	return metrics, nil
+}
+
+func (r *serverResource) Collect() error {
+	plugin := r.ThisPlugin()
+	module := plugin.ThisModule()
+	options := module.options()
+
+	startTime := time.Now()
+	client, err := dialLDAP(options)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			plugin.Logger().Debugf("could not close connection: %s", err.Error())
+		}
+	}()
+	r.connectTime = time.Since(startTime)
+	plugin.Logger().Debugf("connected to %s within %s", options.address, r.connectTime)
+
+	if state, ok := client.TLSState(); ok && len(state.PeerCertificates) > 0 {
+		r.certificateValid = state.PeerCertificates[0].NotAfter
+	}
+
+	bindStart := time.Now()
+	if err := client.Bind(module.bindDN, module.password); err != nil {
+		return err
+	}
+	r.bindTime = time.Since(bindStart)
+
+	sizeLimit := plugin.MinEntries
+	if sizeLimit < 1 {
+		sizeLimit = 1
+	}
+
+	searchStart := time.Now()
+	r.entries, err = client.Search(plugin.BaseDN, ldapScopes[plugin.Scope], plugin.Filter, sizeLimit)
+	if err != nil {
+		return err
+	}
+	r.searchTime = time.Since(searchStart)
+
+	return nil
+}
+
+func (r *serverResource) ThisPlugin() *serverPlugin {
+	return r.Resource.Plugin().(*serverPlugin)
+}
+
+func newServerSummarizer(plugin *serverPlugin) *serverSummarizer {
+	return &serverSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *serverSummarizer) Ok(check nagopher.Check) string {
+	results := check.Results()
+	parts := []string{
+		fmt.Sprintf("bind %s", nagocheck.FormatSeconds(results.GetNumericMetricValue("bind_time").OrElse(math.NaN()))),
+		fmt.Sprintf("search %s", nagocheck.FormatSeconds(results.GetNumericMetricValue("search_time").OrElse(math.NaN()))),
+	}
+
+	if validity, err := results.GetNumericMetricValue("certificate_validity").Get(); err == nil {
+		parts = append(parts, fmt.Sprintf("certificate expires in %s",
+			nagocheck.DurationString(time.Duration(validity)*time.Second)))
+	}
+
+	entries := results.GetNumericMetricValue("entries").OrElse(math.NaN())
+	return fmt.Sprintf("%.0f entries found - %s", entries, strings.Join(parts, ", "))
+}
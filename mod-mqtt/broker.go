@@ -0,0 +1,269 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modmqtt
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"strings"
+	"time"
+)
+
+type brokerPlugin struct {
+	nagocheck.Plugin
+
+	Topic          string
+	IgnoreRetained bool
+	MissingState   string
+	Canary         bool
+	CanaryTopic    string
+}
+
+type brokerResource struct {
+	nagocheck.Resource
+
+	connectTime  time.Duration
+	canary       string
+	roundtrip    time.Duration
+	message      string
+	messageDelay time.Duration
+}
+
+type brokerSummarizer struct {
+	nagocheck.Summarizer
+}
+
+func newBrokerPlugin() *brokerPlugin {
+	return &brokerPlugin{
+		Plugin: nagocheck.NewPlugin("broker",
+			nagocheck.PluginDescription("Broker"),
+			nagocheck.PluginHysteresis(true),
+		),
+	}
+}
+
+func (p *brokerPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("topic", "Subscribe to the given topic filter and alert if neither a retained nor a new message "+
+		"arrives within the timeout. Wildcards are supported.").
+		StringVar(&p.Topic)
+
+	node.Flag("ignore-retained", "Only accept new messages on the topic, as retained messages may be arbitrarily old.").
+		BoolVar(&p.IgnoreRetained)
+
+	node.Flag("missing-state", "State being returned when no message arrived on the topic.").
+		Default("critical").EnumVar(&p.MissingState, nagocheck.StateNames...)
+
+	node.Flag("canary", "Publish a canary message and measure its roundtrip latency, which is being evaluated "+
+		"against the default thresholds in seconds. Use --no-canary if the broker denies publishing.").
+		Default("true").BoolVar(&p.Canary)
+
+	node.Flag("canary-topic", "Topic used for publishing canary messages.").
+		Default("nagocheck/canary").StringVar(&p.CanaryTopic)
+}
+
+func (p *brokerPlugin) DefineCheck() nagopher.Check {
+	missingState, err := nagocheck.ParseState(p.MissingState)
+	if err != nil {
+		missingState = nagopher.StateCritical()
+	}
+
+	check := nagopher.NewCheck("mqtt", newBrokerSummarizer(p))
+	check.AttachResources(newBrokerResource(p))
+	check.AttachContexts(
+		nagopher.NewScalarContext("connect_time", nil, nil),
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"roundtrip",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+		nagopher.NewStringMatchContext("canary", nagopher.StateCritical(), []string{"RECEIVED"}),
+		nagopher.NewStringMatchContext("message", missingState, []string{"RECEIVED", "RETAINED"}),
+		nagopher.NewScalarContext("message_delay", nil, nil),
+	)
+
+	return check
+}
+
+func (p *brokerPlugin) ThisModule() *mqttModule {
+	return p.Plugin.Module().(*mqttModule)
+}
+
+func newBrokerResource(plugin *brokerPlugin) *brokerResource {
+	return &brokerResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *brokerResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(math.Inf(1)))
+
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("connect_time", r.connectTime.Seconds(), "s", &valueRange, ""),
+	)
+
+	if r.canary != "" {
+		metrics = append(metrics, nagopher.MustNewStringMetric("canary", r.canary, ""))
+		if r.canary == "RECEIVED" {
+			metrics = append(metrics,
+				nagopher.MustNewNumericMetric("roundtrip", r.roundtrip.Seconds(), "s", &valueRange, ""),
+			)
+		}
+	}
+
+	if r.message != "" {
+		metrics = append(metrics, nagopher.MustNewStringMetric("message", r.message, ""))
+		if r.message != "MISSING" {
+			metrics = append(metrics,
+				nagopher.MustNewNumericMetric("message_delay", r.messageDelay.Seconds(), "s", &valueRange, ""),
+			)
+		}
+	}
+
+	return metrics, nil
+}
+
+func (r *brokerResource) Collect() error {
+	plugin := r.ThisPlugin()
+	options := plugin.ThisModule().options()
+
+	startTime := time.Now()
+	client, err := dialMQTT(options)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			plugin.Logger().Debugf("could not close connection: %s", err.Error())
+		}
+	}()
+	r.connectTime = time.Since(startTime)
+	plugin.Logger().Debugf("connected to %s as %s within %s", options.address, options.clientID, r.connectTime)
+
+	var filters []string
+	if plugin.Topic != "" {
+		filters = append(filters, plugin.Topic)
+		r.message = "MISSING"
+	}
+	if plugin.Canary {
+		filters = append(filters, plugin.CanaryTopic)
+		r.canary = "MISSING"
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+
+	subscribeTime := time.Now()
+	messages, err := client.Subscribe(filters...)
+	if err != nil {
+		return err
+	}
+
+	// Canary payloads are unique per execution, so that canaries of concurrent checks or topic filters matching the
+	// canary topic can not be mixed up
+	canaryPayload := []byte(fmt.Sprintf("nagocheck canary %s %d", options.clientID, subscribeTime.UnixNano()))
+	var publishTime time.Time
+	if plugin.Canary {
+		publishTime = time.Now()
+		if err := client.Publish(plugin.CanaryTopic, canaryPayload, false); err != nil {
+			return fmt.Errorf("could not publish canary: %s", err.Error())
+		}
+	}
+
+	deadline := time.Now().Add(options.timeout)
+	for r.message == "MISSING" || r.canary == "MISSING" {
+		if len(messages) == 0 {
+			message, err := client.Receive(deadline)
+			if err != nil {
+				return err
+			}
+			if message == nil {
+				break
+			}
+			messages = append(messages, *message)
+		}
+
+		message := messages[0]
+		messages = messages[1:]
+
+		if r.canary == "MISSING" && message.topic == plugin.CanaryTopic && bytes.Equal(message.payload, canaryPayload) {
+			r.canary, r.roundtrip = "RECEIVED", time.Since(publishTime)
+			continue
+		}
+		if r.message == "MISSING" && strings.HasPrefix(string(message.payload), "nagocheck canary ") {
+			continue
+		}
+		if r.message == "MISSING" && !(message.retained && plugin.IgnoreRetained) {
+			r.message, r.messageDelay = "RECEIVED", time.Since(subscribeTime)
+			if message.retained {
+				r.message = "RETAINED"
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *brokerResource) ThisPlugin() *brokerPlugin {
+	return r.Resource.Plugin().(*brokerPlugin)
+}
+
+func newBrokerSummarizer(plugin *brokerPlugin) *brokerSummarizer {
+	return &brokerSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin),
+	}
+}
+
+func (s *brokerSummarizer) Ok(check nagopher.Check) string {
+	results := check.Results()
+	parts := []string{fmt.Sprintf("connected within %s", nagocheck.FormatSeconds(
+		results.GetNumericMetricValue("connect_time").OrElse(math.NaN())))}
+
+	if roundtrip, err := results.GetNumericMetricValue("roundtrip").Get(); err == nil {
+		parts = append(parts, fmt.Sprintf("canary roundtrip %s", nagocheck.FormatSeconds(roundtrip)))
+	}
+	if message, err := results.GetStringMetricValue("message").Get(); err == nil && message == "RETAINED" {
+		parts = append(parts, fmt.Sprintf("retained message on %s", s.ThisPlugin().Topic))
+	} else if delay, err := results.GetNumericMetricValue("message_delay").Get(); err == nil {
+		parts = append(parts, fmt.Sprintf("message on %s after %s", s.ThisPlugin().Topic, nagocheck.FormatSeconds(delay)))
+	}
+
+	return "broker " + strings.Join(parts, ", ")
+}
+
+func (s *brokerSummarizer) Problem(check nagopher.Check) string {
+	results, timeout := check.Results(), s.ThisPlugin().ThisModule().timeout
+	if canary, err := results.GetStringMetricValue("canary").Get(); err == nil && canary == "MISSING" {
+		return fmt.Sprintf("canary on %s not received within %s", s.ThisPlugin().CanaryTopic, timeout)
+	}
+	if message, err := results.GetStringMetricValue("message").Get(); err == nil && message == "MISSING" {
+		return fmt.Sprintf("no message on %s within %s", s.ThisPlugin().Topic, timeout)
+	}
+
+	return s.Summarizer.Problem(check)
+}
+
+func (s *brokerSummarizer) ThisPlugin() *brokerPlugin {
+	return s.Summarizer.Plugin().(*brokerPlugin)
+}
@@ -0,0 +1,323 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modmqtt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Control packet types of MQTT 3.1.1, which are being used by the client
+const (
+	packetConnect     = 1
+	packetConnAck     = 2
+	packetPublish     = 3
+	packetSubscribe   = 8
+	packetSubAck      = 9
+	packetDisconnect  = 14
+	mqttKeepAlive     = 60
+	mqttMaxPacketSize = 1024 * 1024
+)
+
+// connectReturnCodes maps the return codes of CONNACK to their description as specified by MQTT 3.1.1
+var connectReturnCodes = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttClient implements the small subset of MQTT 3.1.1 required for subscribing and publishing with QoS 0, which
+// avoids pulling in a full client library for a single plugin
+type mqttClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type mqttMessage struct {
+	topic    string
+	payload  []byte
+	retained bool
+}
+
+type mqttOptions struct {
+	address  string
+	useTLS   bool
+	insecure bool
+	clientID string
+	username string
+	password string
+	timeout  time.Duration
+}
+
+// dialMQTT connects to the given broker and sends CONNECT with a clean session, returning once the broker accepted
+// the connection
+func dialMQTT(options mqttOptions) (*mqttClient, error) {
+	dialer := &net.Dialer{Timeout: options.timeout}
+
+	var conn net.Conn
+	var err error
+	if options.useTLS {
+		host, _, _ := net.SplitHostPort(options.address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", options.address, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: options.insecure,
+		})
+	} else {
+		conn, err = dialer.Dial("tcp", options.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to broker: %s", err.Error())
+	}
+
+	client := &mqttClient{conn: conn, reader: bufio.NewReader(conn)}
+	if err := conn.SetDeadline(time.Now().Add(options.timeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err := client.connect(options); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (c *mqttClient) connect(options mqttOptions) error {
+	var flags byte = 0x02 // clean session
+	var payload bytes.Buffer
+	writeString(&payload, options.clientID)
+	if options.username != "" {
+		flags |= 0x80
+		writeString(&payload, options.username)
+		if options.password != "" {
+			flags |= 0x40
+			writeString(&payload, options.password)
+		}
+	}
+
+	var body bytes.Buffer
+	writeString(&body, "MQTT")
+	body.WriteByte(4) // protocol level of MQTT 3.1.1
+	body.WriteByte(flags)
+	_ = binary.Write(&body, binary.BigEndian, uint16(mqttKeepAlive))
+	body.Write(payload.Bytes())
+
+	if err := c.writePacket(packetConnect<<4, body.Bytes()); err != nil {
+		return err
+	}
+
+	packetType, data, err := c.readPacket()
+	if err != nil {
+		return fmt.Errorf("could not read CONNACK: %s", err.Error())
+	}
+	if packetType != packetConnAck || len(data) != 2 {
+		return fmt.Errorf("broker responded with unexpected packet type %d instead of CONNACK", packetType)
+	}
+	if data[1] != 0 {
+		if description, ok := connectReturnCodes[data[1]]; ok {
+			return fmt.Errorf("broker refused connection: %s", description)
+		}
+		return fmt.Errorf("broker refused connection with return code %d", data[1])
+	}
+
+	return nil
+}
+
+// Subscribe subscribes to the given topic filters with QoS 0 and waits for SUBACK. Publish packets which arrive in
+// between, e.g. retained messages, are being returned, as they must not get lost.
+func (c *mqttClient) Subscribe(filters ...string) (messages []mqttMessage, _ error) {
+	const packetID = 1
+
+	var body bytes.Buffer
+	_ = binary.Write(&body, binary.BigEndian, uint16(packetID))
+	for _, filter := range filters {
+		writeString(&body, filter)
+		body.WriteByte(0)
+	}
+
+	if err := c.writePacket(packetSubscribe<<4|0x02, body.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for {
+		packetType, data, flags, err := c.readPacketWithFlags()
+		if err != nil {
+			return messages, fmt.Errorf("could not read SUBACK: %s", err.Error())
+		}
+
+		switch packetType {
+		case packetPublish:
+			message, err := parsePublish(data, flags)
+			if err != nil {
+				return messages, err
+			}
+			messages = append(messages, message)
+		case packetSubAck:
+			if len(data) < 2+len(filters) {
+				return messages, fmt.Errorf("broker sent malformed SUBACK")
+			}
+			for index, code := range data[2:] {
+				if code == 0x80 {
+					return messages, fmt.Errorf("broker rejected subscription to [%s]", filters[index])
+				}
+			}
+			return messages, nil
+		}
+	}
+}
+
+// Publish publishes the given payload with QoS 0 to the given topic
+func (c *mqttClient) Publish(topic string, payload []byte, retain bool) error {
+	var body bytes.Buffer
+	writeString(&body, topic)
+	body.Write(payload)
+
+	var header byte = packetPublish << 4
+	if retain {
+		header |= 0x01
+	}
+
+	return c.writePacket(header, body.Bytes())
+}
+
+// Receive waits until the next message arrives or the given deadline has been reached, returning nil in the latter
+// case
+func (c *mqttClient) Receive(deadline time.Time) (*mqttMessage, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	for {
+		packetType, data, flags, err := c.readPacketWithFlags()
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("could not receive message: %s", err.Error())
+		}
+
+		if packetType == packetPublish {
+			message, err := parsePublish(data, flags)
+			return &message, err
+		}
+	}
+}
+
+// Close sends DISCONNECT and closes the connection
+func (c *mqttClient) Close() error {
+	_ = c.conn.SetDeadline(time.Now().Add(time.Second))
+	_ = c.writePacket(packetDisconnect<<4, nil)
+
+	return c.conn.Close()
+}
+
+func (c *mqttClient) writePacket(header byte, body []byte) error {
+	var packet bytes.Buffer
+	packet.WriteByte(header)
+
+	// Remaining length is encoded as variable length integer with 7 bits per byte
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet.WriteByte(digit)
+		if length == 0 {
+			break
+		}
+	}
+	packet.Write(body)
+
+	_, err := c.conn.Write(packet.Bytes())
+	return err
+}
+
+func (c *mqttClient) readPacket() (byte, []byte, error) {
+	packetType, data, _, err := c.readPacketWithFlags()
+	return packetType, data, err
+}
+
+func (c *mqttClient) readPacketWithFlags() (packetType byte, data []byte, flags byte, _ error) {
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, nil, 0, err
+	}
+
+	length, multiplier := 0, 1
+	for index := 0; ; index++ {
+		digit, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		if index >= 4 {
+			return 0, nil, 0, fmt.Errorf("malformed remaining length")
+		}
+
+		length += int(digit&0x7F) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	if length > mqttMaxPacketSize {
+		return 0, nil, 0, fmt.Errorf("packet exceeds maximum size of %d bytes", mqttMaxPacketSize)
+	}
+
+	data = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return 0, nil, 0, err
+	}
+
+	return header >> 4, data, header & 0x0F, nil
+}
+
+func parsePublish(data []byte, flags byte) (mqttMessage, error) {
+	if len(data) < 2 {
+		return mqttMessage{}, fmt.Errorf("broker sent malformed PUBLISH")
+	}
+
+	topicLength := int(binary.BigEndian.Uint16(data))
+	offset := 2 + topicLength
+	// Packet identifiers are only present for QoS 1 and 2, which brokers may still use despite subscribing with QoS 0
+	if (flags>>1)&0x03 > 0 {
+		offset += 2
+	}
+	if len(data) < offset {
+		return mqttMessage{}, fmt.Errorf("broker sent malformed PUBLISH")
+	}
+
+	return mqttMessage{
+		topic:    string(data[2 : 2+topicLength]),
+		payload:  data[offset:],
+		retained: flags&0x01 != 0,
+	}, nil
+}
+
+func writeString(buffer *bytes.Buffer, value string) {
+	_ = binary.Write(buffer, binary.BigEndian, uint16(len(value)))
+	buffer.WriteString(value)
+}
@@ -0,0 +1,106 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modmqtt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"net"
+	"strconv"
+	"time"
+)
+
+type mqttModule struct {
+	nagocheck.Module
+
+	host     string
+	port     uint16
+	useTLS   bool
+	insecure bool
+	username string
+	password string
+	clientID string
+	timeout  time.Duration
+}
+
+// NewMQTTModule instantiates mqttModule and all contained plugins
+func NewMQTTModule() nagocheck.Module {
+	return &mqttModule{
+		Module: nagocheck.NewModule("mqtt",
+			nagocheck.ModuleDescription("MQTT"),
+			nagocheck.ModulePlugin(newBrokerPlugin()),
+		),
+	}
+}
+
+func (m *mqttModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("host", "Specifies the hostname or address of the MQTT broker.").
+		Short('H').Required().StringVar(&m.host)
+
+	node.Flag("port", "Specifies the port of the MQTT broker, defaults to 1883 or 8883 when using TLS.").
+		Short('p').Uint16Var(&m.port)
+
+	node.Flag("tls", "Connect to the MQTT broker using TLS.").
+		BoolVar(&m.useTLS)
+
+	node.Flag("insecure", "Skip verification of the TLS certificate presented by the MQTT broker.").
+		BoolVar(&m.insecure)
+
+	node.Flag("username", "Specifies the user name for authenticating against the MQTT broker.").
+		Short('u').StringVar(&m.username)
+
+	node.Flag("password", "Specifies the password for authenticating against the MQTT broker.").
+		Envar("NAGOCHECK_MQTT_PASSWORD").StringVar(&m.password)
+
+	node.Flag("client-id", "Specifies the client identifier, defaults to nagocheck-<random> so that concurrent "+
+		"checks do not disconnect each other.").
+		StringVar(&m.clientID)
+
+	node.Flag("timeout", "Specifies the timeout for connecting to the broker as well as for waiting on messages.").
+		Short('t').Default("10s").DurationVar(&m.timeout)
+}
+
+// options returns the connection options of the MQTT client based on the module flags
+func (m *mqttModule) options() mqttOptions {
+	port := m.port
+	if port == 0 {
+		port = 1883
+		if m.useTLS {
+			port = 8883
+		}
+	}
+
+	clientID := m.clientID
+	if clientID == "" {
+		// MQTT 3.1.1 only guarantees support for client identifiers with up to 23 characters
+		suffix := make([]byte, 6)
+		_, _ = rand.Read(suffix)
+		clientID = "nagocheck-" + hex.EncodeToString(suffix)
+	}
+
+	return mqttOptions{
+		address:  net.JoinHostPort(m.host, strconv.Itoa(int(port))),
+		useTLS:   m.useTLS,
+		insecure: m.insecure,
+		clientID: clientID,
+		username: m.username,
+		password: m.password,
+		timeout:  m.timeout,
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modnetdevice
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"net"
+)
+
+type bgpNeighborPlugin struct {
+	nagocheck.Plugin
+
+	NeighborIP  net.IP
+	IsCritical  bool
+	UptimeRange nagopher.OptionalBounds
+}
+
+type bgpNeighborResource struct {
+	nagocheck.Resource
+
+	neighbor *deviceBgpNeighbor
+}
+
+func newBgpNeighborPlugin() *bgpNeighborPlugin {
+	return &bgpNeighborPlugin{
+		Plugin: nagocheck.NewPlugin("bgp-neighbor",
+			nagocheck.PluginDescription("BGP Neighbor"),
+			nagocheck.PluginFlapDetection(true),
+			nagocheck.PluginDefaultThresholds(false),
+			nagocheck.PluginCapacityContexts("prefix_count", "prefix_limit_usage"),
+		),
+	}
+}
+
+func (p *bgpNeighborPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("neighbor", "Specifies the IP address of neighbor for which the statistics should be fetched. Both IPv4 "+
+		"IPv6 are supported without specifying the address family explicitly.").
+		Required().IPVar(&p.NeighborIP)
+
+	node.Flag("critical", "Toggles if the given neighbor is critical or not. This will influence the "+
+		"resulting check state if the session of the given neighbor is not established by either returning WARNING or "+
+		"CRITICAL as the result.").
+		Short('c').BoolVar(&p.IsCritical)
+
+	nagocheck.DurationBoundsVar(node.Flag("uptime", "Range for neighbor uptime (state=ESTABLISHED) given as Nagios range "+
+		"specifier using durations like 15m: or 1d: (seconds by default). Plugin will return WARNING state in case the "+
+		"range does not match. This allows to alert when a session was recently established.").
+		Short('u'), &p.UptimeRange)
+}
+
+func (p *bgpNeighborPlugin) DefineCheck() nagopher.Check {
+	problemState := nagopher.StateWarning()
+	if p.IsCritical {
+		problemState = nagopher.StateCritical()
+	}
+
+	check := nagopher.NewCheck("bgp_neighbor", nagocheck.NewNeighborSummarizer(p))
+	check.AttachResources(newBgpNeighborResource(p))
+	check.AttachContexts(
+		nagopher.NewStringInfoContext("info_description"),
+		nagopher.NewStringInfoContext("info_session"),
+
+		nagocheck.NewFlapDetectionContext(p, nagopher.NewStringMatchContext(
+			"state", problemState, []string{"ESTABLISHED"},
+		)),
+		nagopher.NewScalarContext("last_state_change", nil, nil),
+		nagopher.NewScalarContext("prefix_count", nil, nil),
+		nagopher.NewScalarContext("prefix_accepted", nil, nil),
+
+		nagocheck.NewNeighborUptimeContext("uptime", nagopher.OptionalBoundsPtr(p.UptimeRange), nil),
+	)
+
+	return check
+}
+
+func (p *bgpNeighborPlugin) ThisModule() *netdeviceModule {
+	return p.Plugin.Module().(*netdeviceModule)
+}
+
+func newBgpNeighborResource(plugin *bgpNeighborPlugin) *bgpNeighborResource {
+	return &bgpNeighborResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *bgpNeighborResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	lastStateChangeSeconds := nagocheck.Round(r.neighbor.LastStateChange.Seconds(), 0)
+	metrics = append(metrics,
+		nagopher.MustNewStringMetric("state", r.neighbor.State, ""),
+		nagopher.MustNewNumericMetric("last_state_change", lastStateChangeSeconds, "s", nil, ""),
+	)
+
+	if r.neighbor.Description != "" {
+		metrics = append(metrics, nagopher.MustNewStringMetric("info_description", fmt.Sprintf(
+			"description: %s",
+			r.neighbor.Description), ""))
+	}
+
+	sessionString := fmt.Sprintf("session: AS%s[%s]", r.neighbor.RemoteAS, r.neighbor.Address)
+	if r.neighbor.LocalAS != "" {
+		sessionString += fmt.Sprintf(" <-> AS%s", r.neighbor.LocalAS)
+	}
+	if r.neighbor.RouterID != "" {
+		sessionString += fmt.Sprintf(" LocalRID=%s", r.neighbor.RouterID)
+	}
+	metrics = append(metrics, nagopher.MustNewStringMetric("info_session", sessionString, ""))
+
+	// Prefix counts are only known by some platforms and only while the session is established
+	if r.neighbor.PrefixesReceived >= 0 {
+		metrics = append(metrics, nagopher.MustNewNumericMetric("prefix_count",
+			float64(r.neighbor.PrefixesReceived), "", nil, ""))
+	}
+	if r.neighbor.PrefixesAccepted >= 0 {
+		metrics = append(metrics, nagopher.MustNewNumericMetric("prefix_accepted",
+			float64(r.neighbor.PrefixesAccepted), "", nil, ""))
+	}
+
+	// Only add uptime metric (redundant with last state change metric) if state=='ESTABLISHED'
+	if r.neighbor.State == "ESTABLISHED" {
+		metrics = append(metrics, nagopher.MustNewNumericMetric("uptime", lastStateChangeSeconds, "s", nil, ""))
+	}
+
+	return metrics, nil
+}
+
+func (r *bgpNeighborResource) Collect() error {
+	neighborIP := r.ThisPlugin().NeighborIP
+
+	neighbor, err := r.ThisPlugin().ThisModule().session.GetBgpNeighbor(neighborIP)
+	if err != nil {
+		return err
+	} else if neighbor == nil {
+		return fmt.Errorf("could not find neighbor [%s]", neighborIP.String())
+	}
+
+	r.neighbor = neighbor
+	return nil
+}
+
+func (r *bgpNeighborResource) ThisPlugin() *bgpNeighborPlugin {
+	return r.Resource.Plugin().(*bgpNeighborPlugin)
+}
@@ -0,0 +1,271 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modnetdevice
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type eapiSession struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+type eapiRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	Method  string            `json:"method"`
+	Params  eapiRequestParams `json:"params"`
+	ID      string            `json:"id"`
+}
+
+type eapiRequestParams struct {
+	Version int      `json:"version"`
+	Cmds    []string `json:"cmds"`
+	Format  string   `json:"format"`
+}
+
+type eapiResponse struct {
+	Result []json.RawMessage `json:"result"`
+	Error  *eapiError        `json:"error"`
+}
+
+type eapiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    []struct {
+		Errors []string `json:"errors"`
+	} `json:"data"`
+}
+
+type eapiInterfaces struct {
+	Interfaces map[string]struct {
+		Description        string  `json:"description"`
+		LineProtocolStatus string  `json:"lineProtocolStatus"`
+		InterfaceStatus    string  `json:"interfaceStatus"`
+		Bandwidth          float64 `json:"bandwidth"`
+		Duplex             string  `json:"duplex"`
+		InterfaceCounters  *struct {
+			TotalInErrors  int `json:"totalInErrors"`
+			TotalOutErrors int `json:"totalOutErrors"`
+		} `json:"interfaceCounters"`
+	} `json:"interfaces"`
+}
+
+type eapiBgpSummary struct {
+	Vrfs map[string]struct {
+		RouterID string      `json:"routerId"`
+		ASN      interface{} `json:"asn"`
+		Peers    map[string]struct {
+			Description    string      `json:"description"`
+			PeerState      string      `json:"peerState"`
+			ASN            interface{} `json:"asn"`
+			UpDownTime     float64     `json:"upDownTime"`
+			PrefixReceived *int        `json:"prefixReceived"`
+			PrefixAccepted *int        `json:"prefixAccepted"`
+		} `json:"peers"`
+	} `json:"vrfs"`
+}
+
+// eapiDuplexModes maps the duplex modes reported by eAPI to the ones used by the interface plugin
+var eapiDuplexModes = map[string]string{"duplexFull": "FULL", "duplexHalf": "HALF"}
+
+// newEapiSession instantiates a session for the Arista eAPI, which executes CLI commands using JSON-RPC over HTTPS.
+// The token is expected as 'username:password', as eAPI only supports basic authentication.
+func newEapiSession(url string, token string, insecure bool, timeout time.Duration) *eapiSession {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+	}
+
+	return &eapiSession{
+		url:   url,
+		token: token,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+	}
+}
+
+func (s *eapiSession) GetInterface(name string) (*deviceInterface, error) {
+	var result eapiInterfaces
+	if err := s.runCommand("show interfaces "+name, &result); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	for interfaceName, data := range result.Interfaces {
+		iface := &deviceInterface{
+			Name:        interfaceName,
+			Description: data.Description,
+			AdminUp:     data.InterfaceStatus != "disabled",
+			OperUp:      data.LineProtocolStatus == "up",
+			Speed:       -1,
+			Duplex:      eapiDuplexModes[data.Duplex],
+			InErrors:    -1,
+			OutErrors:   -1,
+		}
+
+		if data.Bandwidth > 0 {
+			iface.Speed = int(data.Bandwidth / 1000000)
+		}
+		if data.InterfaceCounters != nil {
+			iface.InErrors = data.InterfaceCounters.TotalInErrors
+			iface.OutErrors = data.InterfaceCounters.TotalOutErrors
+		}
+
+		return iface, nil
+	}
+
+	return nil, nil
+}
+
+func (s *eapiSession) GetBgpNeighbor(address net.IP) (*deviceBgpNeighbor, error) {
+	command := "show ip bgp summary vrf all"
+	if address.To4() == nil {
+		command = "show ipv6 bgp summary vrf all"
+	}
+
+	var result eapiBgpSummary
+	if err := s.runCommand(command, &result); err != nil {
+		return nil, err
+	}
+
+	for _, vrf := range result.Vrfs {
+		for peerAddress, peer := range vrf.Peers {
+			if ip := net.ParseIP(peerAddress); ip == nil || !ip.Equal(address) {
+				continue
+			}
+
+			neighbor := &deviceBgpNeighbor{
+				Address:          peerAddress,
+				Description:      peer.Description,
+				RemoteAS:         fmt.Sprint(peer.ASN),
+				LocalAS:          fmt.Sprint(vrf.ASN),
+				RouterID:         vrf.RouterID,
+				State:            strings.ToUpper(peer.PeerState),
+				PrefixesReceived: -1,
+				PrefixesAccepted: -1,
+			}
+
+			if peer.UpDownTime > 0 {
+				seconds, fraction := math.Modf(peer.UpDownTime)
+				neighbor.LastStateChange = time.Since(time.Unix(int64(seconds), int64(fraction*1e9)))
+			}
+			if peer.PrefixReceived != nil {
+				neighbor.PrefixesReceived = *peer.PrefixReceived
+			}
+			if peer.PrefixAccepted != nil {
+				neighbor.PrefixesAccepted = *peer.PrefixAccepted
+			}
+
+			return neighbor, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// runCommand executes a single CLI command with JSON output and unmarshals its result into the target
+func (s *eapiSession) runCommand(command string, target interface{}) error {
+	requestBody, err := json.Marshal(eapiRequest{
+		JSONRPC: "2.0",
+		Method:  "runCmds",
+		Params:  eapiRequestParams{Version: 1, Cmds: []string{command}, Format: "json"},
+		ID:      "nagocheck",
+	})
+	if err != nil {
+		return fmt.Errorf("could not encode request: %s", err.Error())
+	}
+
+	request, err := http.NewRequest("POST", s.url, bytes.NewReader(requestBody))
+	if err != nil {
+		return fmt.Errorf("could not build request: %s", err.Error())
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		credentials := strings.SplitN(s.token, ":", 2)
+		if len(credentials) != 2 {
+			return fmt.Errorf("eapi token must be given as username:password")
+		}
+		request.SetBasicAuth(credentials[0], credentials[1])
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not query eapi: %s", err.Error())
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, 4*1024*1024))
+	if err != nil {
+		return fmt.Errorf("could not read response of eapi: %s", err.Error())
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("eapi responded with status %d", response.StatusCode)
+	}
+
+	var rpcResponse eapiResponse
+	if err := json.Unmarshal(body, &rpcResponse); err != nil {
+		return fmt.Errorf("could not unmarshal response of eapi: %s", err.Error())
+	}
+	if rpcResponse.Error != nil {
+		return rpcResponse.Error
+	}
+	if len(rpcResponse.Result) != 1 {
+		return fmt.Errorf("eapi returned %d results for a single command", len(rpcResponse.Result))
+	}
+
+	if err := json.Unmarshal(rpcResponse.Result[0], target); err != nil {
+		return fmt.Errorf("could not unmarshal result of command [%s]: %s", command, err.Error())
+	}
+
+	return nil
+}
+
+// Error returns the error message of eAPI together with the errors of the failed command, which contain the actual
+// reason like 'Interface does not exist'
+func (e *eapiError) Error() string {
+	var details []string
+	for _, data := range e.Data {
+		details = append(details, data.Errors...)
+	}
+
+	if len(details) == 0 {
+		return fmt.Sprintf("eapi returned error %d: %s", e.Code, e.Message)
+	}
+
+	return fmt.Sprintf("eapi returned error %d: %s (%s)", e.Code, e.Message, strings.Join(details, ", "))
+}
@@ -0,0 +1,135 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modnetdevice
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/mod-system"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"strings"
+	"time"
+)
+
+type netdeviceModule struct {
+	nagocheck.Module
+
+	session deviceSession
+
+	host         string
+	platform     string
+	port         uint16
+	token        string
+	tokenCommand string
+	insecure     bool
+	netconfUser  string
+	netconfKey   string
+	netconfCmd   string
+	timeout      time.Duration
+}
+
+// NewNetdeviceModule instantiates netdeviceModule and all contained plugins, which check network devices using their
+// management API, being either Arista eAPI or Junos NETCONF
+func NewNetdeviceModule() nagocheck.Module {
+	module := &netdeviceModule{}
+	module.Module = nagocheck.NewModule("netdevice",
+		nagocheck.ModuleDescription("Network Devices (Arista EOS, Juniper Junos)"),
+		nagocheck.ModulePlugin(newBgpNeighborPlugin()),
+		nagocheck.ModulePlugin(modsystem.NewRemoteInterfacePlugin(module)),
+	)
+
+	return module
+}
+
+func (m *netdeviceModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("host", "Specifies the hostname or address of the network device.").
+		Short('H').Required().StringVar(&m.host)
+
+	node.Flag("platform", "Specifies the platform of the network device, which selects the management API being "+
+		"used: eos (Arista eAPI) or junos (Junos NETCONF).").
+		Short('P').Required().EnumVar(&m.platform, "eos", "junos")
+
+	node.Flag("port", "Specifies the port of the management API. Defaults to 443 for eAPI and 830 for NETCONF.").
+		Uint16Var(&m.port)
+
+	node.Flag("token", "[eos] Credentials of the eAPI user as username:password.").
+		Envar("NAGOCHECK_NETDEVICE_TOKEN").StringVar(&m.token)
+
+	node.Flag("token-command", "[eos] Specifies a credential helper command with optional arguments, which prints "+
+		"the credentials as username:password and takes precedence over --token. Use comma to separate command and "+
+		"arguments.").
+		StringVar(&m.tokenCommand)
+
+	node.Flag("insecure", "[eos] Skip verification of the TLS certificate presented by the network device.").
+		BoolVar(&m.insecure)
+
+	node.Flag("netconf-user", "[junos] Specifies the remote user name. Defaults to the SSH client configuration.").
+		StringVar(&m.netconfUser)
+
+	node.Flag("netconf-key", "[junos] Specifies the private key file used for authentication.").
+		StringVar(&m.netconfKey)
+
+	node.Flag("netconf-cmd", "[junos] Specifies the command with optional arguments to be used for executing the "+
+		"SSH client, which must support the netconf subsystem. Use comma to separate command and arguments.").
+		Default("/usr/bin/ssh").StringVar(&m.netconfCmd)
+
+	node.Flag("timeout", "Specifies the timeout for each request sent to the management API.").
+		Short('t').Default("10s").DurationVar(&m.timeout)
+}
+
+func (m *netdeviceModule) ExecutePlugin(plugin nagocheck.Plugin) error {
+	switch m.platform {
+	case "eos":
+		token, err := m.credentials()
+		if err != nil {
+			return err
+		}
+
+		port := m.port
+		if port == 0 {
+			port = 443
+		}
+		m.session = newEapiSession(fmt.Sprintf("https://%s:%d/command-api", m.host, port), token, m.insecure, m.timeout)
+	case "junos":
+		port := m.port
+		if port == 0 {
+			port = 830
+		}
+		m.session = newNetconfSession(m.host, port, m.netconfUser, m.netconfKey, strings.Split(m.netconfCmd, ","),
+			m.timeout)
+	default:
+		return fmt.Errorf("unsupported platform: %s", m.platform)
+	}
+
+	return m.Module.ExecutePlugin(plugin)
+}
+
+// credentials returns the credentials for eAPI, which are either given directly or printed by a credential helper, so
+// that secrets do not have to be stored within the monitoring configuration
+func (m *netdeviceModule) credentials() (string, error) {
+	if m.tokenCommand == "" {
+		return m.token, nil
+	}
+
+	output, err := nagocheck.ExecuteCommand(m.timeout, strings.Split(m.tokenCommand, ","))
+	if err != nil {
+		return "", fmt.Errorf("could not execute credential helper: %s", err.Error())
+	}
+
+	return strings.TrimSpace(output), nil
+}
@@ -0,0 +1,258 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modnetdevice
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type netconfSession struct {
+	command []string
+	timeout time.Duration
+}
+
+type netconfReply struct {
+	MessageID string `xml:"message-id,attr"`
+	Errors    []struct {
+		Severity string `xml:"error-severity"`
+		Message  string `xml:"error-message"`
+	} `xml:"rpc-error"`
+}
+
+type junosInterfaceReply struct {
+	PhysicalInterfaces []struct {
+		Name         string `xml:"name"`
+		Description  string `xml:"description"`
+		AdminStatus  string `xml:"admin-status"`
+		OperStatus   string `xml:"oper-status"`
+		Speed        string `xml:"speed"`
+		Duplex       string `xml:"duplex"`
+		InputErrors  string `xml:"input-error-list>input-errors"`
+		OutputErrors string `xml:"output-error-list>output-errors"`
+	} `xml:"interface-information>physical-interface"`
+}
+
+type junosBgpSummaryReply struct {
+	Peers []struct {
+		Address     string `xml:"peer-address"`
+		Description string `xml:"description"`
+		RemoteAS    string `xml:"peer-as"`
+		State       string `xml:"peer-state"`
+		ElapsedTime struct {
+			Seconds string `xml:"seconds,attr"`
+		} `xml:"elapsed-time"`
+		Ribs []struct {
+			ReceivedPrefixes string `xml:"received-prefix-count"`
+			AcceptedPrefixes string `xml:"accepted-prefix-count"`
+		} `xml:"bgp-rib"`
+	} `xml:"bgp-information>bgp-peer"`
+}
+
+// netconfDelimiter terminates every message when using the framing of NETCONF 1.0, which is sufficient for sending a
+// fixed sequence of messages without waiting for any replies
+const netconfDelimiter = "]]>]]>"
+
+const netconfHello = `<?xml version="1.0" encoding="UTF-8"?>
+<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>` +
+	`<capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>`
+
+var junosSpeedRegexp = regexp.MustCompile(`^(\d+)([mg])bps$`)
+
+// junosDuplexModes maps the duplex modes reported by Junos to the ones used by the interface plugin
+var junosDuplexModes = map[string]string{"full-duplex": "FULL", "half-duplex": "HALF"}
+
+// newNetconfSession instantiates a session for Junos NETCONF, which wraps the OpenSSH client using the netconf
+// subsystem, so that the usual client configuration (known hosts, agent, jump hosts, ...) applies. The SSH client is
+// always executed in batch mode, as there is nobody who could answer interactive prompts.
+func newNetconfSession(host string, port uint16, user string, keyFile string, command []string,
+	timeout time.Duration) *netconfSession {
+	connectTimeout := int(math.Max(1, math.Ceil(timeout.Seconds())))
+	sshCommand := append(append([]string(nil), command...),
+		"-o", "BatchMode=yes",
+		"-o", "ConnectTimeout="+strconv.Itoa(connectTimeout),
+		"-p", strconv.Itoa(int(port)),
+	)
+
+	if user != "" {
+		sshCommand = append(sshCommand, "-l", user)
+	}
+	if keyFile != "" {
+		sshCommand = append(sshCommand, "-i", keyFile)
+	}
+
+	return &netconfSession{
+		command: append(sshCommand, "-s", host, "netconf"),
+		timeout: timeout,
+	}
+}
+
+func (s *netconfSession) GetInterface(name string) (*deviceInterface, error) {
+	var reply junosInterfaceReply
+	err := s.call(fmt.Sprintf("<get-interface-information><interface-name>%s</interface-name><extensive/>"+
+		"</get-interface-information>", xmlEscape(name)), &reply)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	for _, data := range reply.PhysicalInterfaces {
+		iface := &deviceInterface{
+			Name:        strings.TrimSpace(data.Name),
+			Description: strings.TrimSpace(data.Description),
+			AdminUp:     strings.TrimSpace(data.AdminStatus) == "up",
+			OperUp:      strings.TrimSpace(data.OperStatus) == "up",
+			Speed:       -1,
+			Duplex:      junosDuplexModes[strings.ToLower(strings.TrimSpace(data.Duplex))],
+			InErrors:    parseCounter(data.InputErrors),
+			OutErrors:   parseCounter(data.OutputErrors),
+		}
+
+		if match := junosSpeedRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(data.Speed))); match != nil {
+			iface.Speed, _ = strconv.Atoi(match[1])
+			if match[2] == "g" {
+				iface.Speed *= 1000
+			}
+		}
+
+		return iface, nil
+	}
+
+	return nil, nil
+}
+
+func (s *netconfSession) GetBgpNeighbor(address net.IP) (*deviceBgpNeighbor, error) {
+	var reply junosBgpSummaryReply
+	if err := s.call("<get-bgp-summary-information/>", &reply); err != nil {
+		return nil, err
+	}
+
+	for _, peer := range reply.Peers {
+		// Peer addresses might be suffixed with their port, e.g. 192.0.2.1+179
+		peerAddress := strings.SplitN(strings.TrimSpace(peer.Address), "+", 2)[0]
+		if ip := net.ParseIP(peerAddress); ip == nil || !ip.Equal(address) {
+			continue
+		}
+
+		neighbor := &deviceBgpNeighbor{
+			Address:          peerAddress,
+			Description:      strings.TrimSpace(peer.Description),
+			RemoteAS:         strings.TrimSpace(peer.RemoteAS),
+			State:            strings.ToUpper(strings.TrimSpace(peer.State)),
+			PrefixesReceived: -1,
+			PrefixesAccepted: -1,
+		}
+
+		if seconds, err := strconv.Atoi(strings.TrimSpace(peer.ElapsedTime.Seconds)); err == nil {
+			neighbor.LastStateChange = time.Duration(seconds) * time.Second
+		}
+
+		// Prefix counts are reported per routing table, e.g. inet.0 and inet6.0
+		for _, rib := range peer.Ribs {
+			addCounter(&neighbor.PrefixesReceived, rib.ReceivedPrefixes)
+			addCounter(&neighbor.PrefixesAccepted, rib.AcceptedPrefixes)
+		}
+
+		return neighbor, nil
+	}
+
+	return nil, nil
+}
+
+// call executes the given RPC within a new NETCONF session and unmarshals the reply into the target. All messages are
+// being sent at once, followed by closing the session, as NETCONF servers process them strictly in order.
+func (s *netconfSession) call(rpc string, target interface{}) error {
+	input := strings.Join([]string{
+		netconfHello,
+		`<rpc message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + rpc + `</rpc>`,
+		`<rpc message-id="2" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><close-session/></rpc>`,
+	}, netconfDelimiter+"\n") + netconfDelimiter + "\n"
+
+	output, err := nagocheck.ExecuteCommandWithInput(s.timeout, s.command, input)
+	if err != nil {
+		return fmt.Errorf("could not execute netconf rpc: %s", err.Error())
+	}
+
+	for _, message := range strings.Split(output, netconfDelimiter) {
+		message = strings.TrimSpace(message)
+		if !strings.Contains(message, "<rpc-reply") {
+			continue
+		}
+
+		var reply netconfReply
+		if err := xml.Unmarshal([]byte(message), &reply); err != nil {
+			return fmt.Errorf("could not unmarshal netconf reply: %s", err.Error())
+		} else if reply.MessageID != "1" {
+			continue
+		}
+
+		// Junos also returns errors with severity warning, which do not prevent the RPC from returning data
+		for _, rpcError := range reply.Errors {
+			if strings.TrimSpace(rpcError.Severity) == "error" {
+				return fmt.Errorf("netconf rpc failed: %s", strings.TrimSpace(rpcError.Message))
+			}
+		}
+
+		if err := xml.Unmarshal([]byte(message), target); err != nil {
+			return fmt.Errorf("could not unmarshal netconf reply: %s", err.Error())
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("netconf server did not reply to rpc")
+}
+
+// parseCounter parses a counter returned by Junos, which is padded with whitespace, returning -1 if it is unknown
+func parseCounter(value string) int {
+	counter, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return -1
+	}
+
+	return counter
+}
+
+// addCounter adds the given counter returned by Junos to the total, which becomes known once any counter is known
+func addCounter(total *int, value string) {
+	counter := parseCounter(value)
+	if counter < 0 {
+		return
+	} else if *total < 0 {
+		*total = 0
+	}
+
+	*total += counter
+}
+
+func xmlEscape(value string) string {
+	var builder strings.Builder
+	_ = xml.EscapeText(&builder, []byte(value))
+	return builder.String()
+}
@@ -0,0 +1,110 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modnetdevice
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/mod-system"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"net"
+	"time"
+)
+
+// deviceSession abstracts the management API of a network device, so that all plugins behave identically regardless
+// of the platform. Both methods return nil without an error if the requested item does not exist on the device.
+type deviceSession interface {
+	GetInterface(name string) (*deviceInterface, error)
+	GetBgpNeighbor(address net.IP) (*deviceBgpNeighbor, error)
+}
+
+// deviceInterface contains the status of a network interface, where unknown numbers are -1
+type deviceInterface struct {
+	Name        string
+	Description string
+	AdminUp     bool
+	OperUp      bool
+	Speed       int
+	Duplex      string
+	InErrors    int
+	OutErrors   int
+}
+
+// deviceBgpNeighbor contains the status of a BGP neighbor, where unknown prefix counts are -1. The state is normalized
+// to upper case, e.g. ESTABLISHED or ACTIVE.
+type deviceBgpNeighbor struct {
+	Address          string
+	Description      string
+	RemoteAS         string
+	LocalAS          string
+	RouterID         string
+	State            string
+	LastStateChange  time.Duration
+	PrefixesReceived int
+	PrefixesAccepted int
+}
+
+func (m *netdeviceModule) Target() string {
+	return m.host
+}
+
+func (m *netdeviceModule) CollectLoad() (stats modsystem.LoadStats, _ error) {
+	return stats, fmt.Errorf("%s does not provide load averages", m.platform)
+}
+
+func (m *netdeviceModule) CollectMemory() (stats modsystem.MemoryStats, _ error) {
+	return stats, fmt.Errorf("%s memory statistics are not supported", m.platform)
+}
+
+func (m *netdeviceModule) CollectUptime() (time.Duration, error) {
+	return 0, fmt.Errorf("%s uptime is not supported", m.platform)
+}
+
+func (m *netdeviceModule) CollectInterface(name string, warnings nagopher.WarningCollection) (modsystem.InterfaceStats, error) {
+	stats := modsystem.InterfaceStats{Speed: -1, TransmitErrors: -1, ReceiveErrors: -1}
+
+	iface, err := m.session.GetInterface(name)
+	if err != nil {
+		return stats, err
+	}
+	if iface == nil {
+		return stats, fmt.Errorf("could not find interface with name %s", name)
+	}
+
+	switch {
+	case !iface.AdminUp:
+		stats.State = "DISABLED"
+	case iface.OperUp:
+		stats.State = "UP"
+	default:
+		stats.State = "DOWN"
+	}
+
+	stats.TransmitErrors, stats.ReceiveErrors = iface.OutErrors, iface.InErrors
+	if stats.TransmitErrors < 0 || stats.ReceiveErrors < 0 {
+		warnings.Add(nagocheck.PartialFailure("could not determine error counters"))
+	}
+
+	// Link speed and duplex are only meaningful for interfaces with an established link
+	if stats.State == "UP" {
+		stats.Speed, stats.Duplex = iface.Speed, iface.Duplex
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,168 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modopenbgpd
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"net"
+)
+
+type bgpNeighborPlugin struct {
+	nagocheck.Plugin
+
+	NeighborIP       net.IP
+	IsCritical       bool
+	PrefixLimitRange nagopher.OptionalBounds
+	UptimeRange      nagopher.OptionalBounds
+}
+
+type bgpNeighborResource struct {
+	nagocheck.Resource
+
+	neighbor *BgpNeighbor
+}
+
+func newBgpNeighborPlugin() *bgpNeighborPlugin {
+	return &bgpNeighborPlugin{
+		Plugin: nagocheck.NewPlugin("bgp-neighbor",
+			nagocheck.PluginDescription("BGP Neighbor"),
+			nagocheck.PluginFlapDetection(true),
+			nagocheck.PluginDefaultThresholds(false),
+			nagocheck.PluginCapacityContexts("prefix_count", "prefix_limit_usage"),
+		),
+	}
+}
+
+func (p *bgpNeighborPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("neighbor", "Specifies the IP address of neighbor for which the statistics should be fetched. Both IPv4 "+
+		"IPv6 are supported without specifying the address family explicitly.").
+		Required().IPVar(&p.NeighborIP)
+
+	node.Flag("critical", "Toggles if the given neighbor is critical or not. This will influence the "+
+		"resulting check state if the session of the given neighbor is not established by either returning WARNING or "+
+		"CRITICAL as the result.").
+		Short('c').BoolVar(&p.IsCritical)
+
+	nagocheck.NagopherBoundsVar(node.Flag("prefix-limit", "Range for prefix limit usage given as Nagios range specifier. "+
+		"Plugin will return WARNING state in case the range does not match. If no prefix limit was configured, this "+
+		"check gets ignored.").
+		Short('l'), &p.PrefixLimitRange)
+
+	nagocheck.DurationBoundsVar(node.Flag("uptime", "Range for neighbor uptime (state=ESTABLISHED) given as Nagios range "+
+		"specifier using durations like 15m: or 1d: (seconds by default). Plugin will return WARNING state in case the "+
+		"range does not match. This allows to alert when a session was recently established.").
+		Short('u'), &p.UptimeRange)
+}
+
+func (p *bgpNeighborPlugin) DefineCheck() nagopher.Check {
+	problemState := nagopher.StateWarning()
+	if p.IsCritical {
+		problemState = nagopher.StateCritical()
+	}
+
+	check := nagopher.NewCheck("bgp_neighbor", nagocheck.NewNeighborSummarizer(p))
+	check.AttachResources(newBgpNeighborResource(p))
+	check.AttachContexts(
+		nagopher.NewStringInfoContext("info_description"),
+		nagopher.NewStringInfoContext("info_session"),
+		nagopher.NewStringInfoContext("info_prefix_usage"),
+
+		nagocheck.NewFlapDetectionContext(p, nagopher.NewStringMatchContext(
+			"state", problemState, []string{"ESTABLISHED"},
+		)),
+		nagopher.NewScalarContext("last_state_change", nil, nil),
+		nagopher.NewScalarContext("prefix_limit_usage", nagopher.OptionalBoundsPtr(p.PrefixLimitRange), nil),
+		nagopher.NewScalarContext("prefix_count", nil, nil),
+
+		nagocheck.NewNeighborUptimeContext("uptime", nagopher.OptionalBoundsPtr(p.UptimeRange), nil),
+	)
+
+	return check
+}
+
+func (p *bgpNeighborPlugin) ThisModule() *openbgpdModule {
+	return p.Plugin.Module().(*openbgpdModule)
+}
+
+func newBgpNeighborResource(plugin *bgpNeighborPlugin) *bgpNeighborResource {
+	return &bgpNeighborResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *bgpNeighborResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	lastStateChangeSeconds := nagocheck.Round(r.neighbor.LastStateChange.Seconds(), 0)
+	metrics = append(metrics,
+		nagopher.MustNewStringMetric("state", r.neighbor.OperationalState, ""),
+		nagopher.MustNewNumericMetric("last_state_change", lastStateChangeSeconds, "s", nil, ""),
+		nagopher.MustNewNumericMetric("prefix_count", float64(r.neighbor.PrefixUsageTotal), "", nil, ""),
+
+		nagopher.MustNewStringMetric("info_description", fmt.Sprintf(
+			"description: %s",
+			r.neighbor.Description), ""),
+		nagopher.MustNewStringMetric("info_session", fmt.Sprintf(
+			"session: AS%s[%s:%d] <-> [%s:%d] RemoteRID=%s",
+			r.neighbor.RemoteAS, r.neighbor.RemoteAddress, r.neighbor.Session.Remote.Port,
+			r.neighbor.Session.Local.Address, r.neighbor.Session.Local.Port, r.neighbor.RemoteRouterID), ""),
+	)
+
+	// Only add prefix limit usage statistics if a prefix limit was set
+	if r.neighbor.PrefixLimitTotal > 0 {
+		percentage := nagocheck.Round(float64(r.neighbor.PrefixUsageTotal)/float64(r.neighbor.PrefixLimitTotal)*100, 2)
+		metrics = append(metrics, nagopher.MustNewNumericMetric("prefix_limit_usage", percentage, "%", nil, ""))
+	}
+
+	// Only add uptime metric (redundant with last state change metric) if state=='ESTABLISHED'
+	if r.neighbor.OperationalState == "ESTABLISHED" {
+		metrics = append(metrics, nagopher.MustNewNumericMetric("uptime", lastStateChangeSeconds, "s", nil, ""))
+	}
+
+	// Display additional information about prefix usage
+	usageString := fmt.Sprintf("prefixes: %d received, %d sent",
+		r.neighbor.Stats.Prefixes.Received, r.neighbor.Stats.Prefixes.Sent)
+	if r.neighbor.PrefixLimitTotal > 0 {
+		usageString += fmt.Sprintf(", %d maximum", r.neighbor.PrefixLimitTotal)
+	} else {
+		usageString += ", no maximum set"
+	}
+	metrics = append(metrics, nagopher.MustNewStringMetric("info_prefix_usage", usageString, ""))
+
+	return metrics, nil
+}
+
+func (r *bgpNeighborResource) Collect() error {
+	var err error
+
+	r.neighbor, err = r.Session().GetBgpNeighbor(r.ThisPlugin().NeighborIP.String())
+	return err
+}
+
+func (r *bgpNeighborResource) Session() Session {
+	return r.ThisPlugin().ThisModule().session
+}
+
+func (r *bgpNeighborResource) ThisPlugin() *bgpNeighborPlugin {
+	return r.Resource.Plugin().(*bgpNeighborPlugin)
+}
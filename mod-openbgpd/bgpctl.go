@@ -0,0 +1,145 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modopenbgpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagocheck/nagocheck/transport"
+	"strings"
+	"time"
+)
+
+const timeout = 10 * time.Second
+
+// Session represents an active connection for communicating with OpenBGPD
+type Session interface {
+	GetBgpNeighbors() ([]*BgpNeighbor, error)
+	GetBgpNeighbor(neighborAddress string) (*BgpNeighbor, error)
+}
+
+type bgpctlSession struct {
+	transport     transport.Transport
+	bgpctlCommand nagocheck.SudoTemplate
+}
+
+// BgpNeighbor contains config and operational data about a BGP neighbor/peer
+type BgpNeighbor struct {
+	RemoteAddress  string `json:"remote_addr"`
+	RemoteAS       string `json:"remote_as"`
+	RemoteRouterID string `json:"bgpid"`
+	Description    string `json:"description"`
+	Group          string `json:"group"`
+
+	OperationalState string `json:"state"`
+	LastUpDown       uint64 `json:"last_updown_sec"`
+
+	Stats struct {
+		Prefixes struct {
+			Sent     uint64 `json:"sent"`
+			Received uint64 `json:"received"`
+		} `json:"prefixes"`
+	} `json:"stats"`
+
+	Config struct {
+		MaxPrefix struct {
+			In struct {
+				Limit uint64 `json:"limit"`
+			} `json:"in"`
+		} `json:"max_prefix"`
+	} `json:"config"`
+
+	Session struct {
+		Local struct {
+			Address string `json:"address"`
+			Port    uint16 `json:"port"`
+		} `json:"local"`
+		Remote struct {
+			Address string `json:"address"`
+			Port    uint16 `json:"port"`
+		} `json:"remote"`
+	} `json:"session"`
+
+	LastStateChange  time.Duration
+	PrefixUsageTotal uint64
+	PrefixLimitTotal uint64
+}
+
+// NewBgpctlSession instantiates a new Session which will use bgpctl to communicate with OpenBGPD. The given transport
+// allows executing bgpctl on a remote host.
+func NewBgpctlSession(transport transport.Transport, bgpctlCommand nagocheck.SudoTemplate) Session {
+	return &bgpctlSession{
+		transport:     transport,
+		bgpctlCommand: bgpctlCommand,
+	}
+}
+
+func (s *bgpctlSession) GetBgpNeighbors() ([]*BgpNeighbor, error) {
+	neighbors, err := s.fetchBgpNeighbors("neighbor")
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch neighbors: %s", err.Error())
+	}
+
+	return neighbors, nil
+}
+
+func (s *bgpctlSession) GetBgpNeighbor(neighborAddress string) (*BgpNeighbor, error) {
+	neighbors, err := s.fetchBgpNeighbors("neighbor", neighborAddress)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch neighbor data: %s", err.Error())
+	}
+
+	for _, neighbor := range neighbors {
+		if neighbor.RemoteAddress == neighborAddress {
+			return neighbor, nil
+		}
+	}
+
+	return nil, fmt.Errorf("could not find neighbor [%s]", neighborAddress)
+}
+
+func (s *bgpctlSession) fetchBgpNeighbors(args ...string) ([]*BgpNeighbor, error) {
+	cmdArgs, err := s.bgpctlCommand.Build(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rawOutput, err := s.transport.Execute(timeout, cmdArgs)
+	if err != nil {
+		sanitizedOutput := strings.Replace(strings.TrimSpace(rawOutput), "\n", " ", -1)
+		return nil, fmt.Errorf("command execution failed: %s (%s)", err.Error(), sanitizedOutput)
+	}
+
+	var data struct {
+		Neighbors []*BgpNeighbor `json:"neighbors"`
+	}
+	if err := json.Unmarshal([]byte(rawOutput), &data); err != nil {
+		return nil, fmt.Errorf("could not unmarshal JSON neighbor data: %s", err.Error())
+	}
+
+	for _, neighbor := range data.Neighbors {
+		neighbor.OperationalState = strings.ToUpper(neighbor.OperationalState)
+		neighbor.LastStateChange = time.Duration(neighbor.LastUpDown) * time.Second
+		neighbor.PrefixUsageTotal = neighbor.Stats.Prefixes.Received
+		neighbor.PrefixLimitTotal = neighbor.Config.MaxPrefix.In.Limit
+	}
+
+	return data.Neighbors, nil
+}
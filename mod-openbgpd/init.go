@@ -0,0 +1,81 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modopenbgpd
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+	"strings"
+)
+
+const defaultBgpctlCommand = "/usr/sbin/bgpctl"
+
+type openbgpdModule struct {
+	nagocheck.Module
+
+	session Session
+
+	bgpctlCommand string
+	socketPath    string
+}
+
+// NewOpenbgpdModule instantiates openbgpdModule and all contained plugins
+func NewOpenbgpdModule() nagocheck.Module {
+	return &openbgpdModule{
+		Module: nagocheck.NewModule("openbgpd",
+			nagocheck.ModuleDescription("OpenBGPD"),
+			nagocheck.ModulePlugin(newBgpNeighborPlugin()),
+		),
+	}
+}
+
+func (m *openbgpdModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("bgpctl-cmd", "Specifies the command with optional arguments to be used for executing bgpctl. Use "+
+		"comma to separate command and arguments. Specify the global --sudo flag for executing bgpctl with elevated "+
+		"privileges.").
+		Default(defaultBgpctlCommand).StringVar(&m.bgpctlCommand)
+
+	node.Flag("socket", "Specifies the path of the bgpd control socket, uses the default socket of bgpctl if empty.").
+		StringVar(&m.socketPath)
+}
+
+func (m *openbgpdModule) ExecutePlugin(plugin nagocheck.Plugin) error {
+	m.session = NewBgpctlSession(nagocheck.NewTransport("bgpctl"), m.bgpctlTemplate())
+
+	return m.Module.ExecutePlugin(plugin)
+}
+
+func (m *openbgpdModule) SudoTemplates() []nagocheck.SudoTemplate {
+	return []nagocheck.SudoTemplate{m.bgpctlTemplate()}
+}
+
+// bgpctlTemplate returns the allow-listed template for executing bgpctl, which only permits running show commands with
+// JSON output
+func (m *openbgpdModule) bgpctlTemplate() nagocheck.SudoTemplate {
+	bgpctlCommand := m.bgpctlCommand
+	if bgpctlCommand == "" {
+		bgpctlCommand = defaultBgpctlCommand
+	}
+
+	command := strings.Split(bgpctlCommand, ",")
+	if m.socketPath != "" {
+		command = append(command, "-s", m.socketPath)
+	}
+
+	return nagocheck.NewSudoTemplate("bgpctl", append(command, "-j", "show"), "*")
+}
@@ -0,0 +1,165 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modquery
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const maxResponseSize = 16 * 1024 * 1024
+
+type httpClient struct {
+	url     string
+	token   string
+	headers map[string]string
+	client  *http.Client
+}
+
+// newHTTPClient instantiates a client for JSON based query APIs. Tokens containing a colon are sent as basic
+// authentication, all others as bearer token.
+func newHTTPClient(url string, token string, insecure bool, timeout time.Duration) *httpClient {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+	}
+
+	return &httpClient{
+		url:   strings.TrimRight(url, "/"),
+		token: token,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+	}
+}
+
+// WithHeader returns a copy of the client, which additionally sends the given header with each request, e.g. for
+// selecting the tenant of multi-tenant servers
+func (c *httpClient) WithHeader(key string, value string) *httpClient {
+	headers := map[string]string{key: value}
+	for existingKey, existingValue := range c.headers {
+		if existingKey != key {
+			headers[existingKey] = existingValue
+		}
+	}
+
+	return &httpClient{url: c.url, token: c.token, headers: headers, client: c.client}
+}
+
+// Get fetches the given path with the given query parameters and unmarshals the response into the target
+func (c *httpClient) Get(path string, query url.Values, target interface{}) error {
+	requestURL := c.url + "/" + strings.TrimLeft(path, "/")
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+
+	return c.do("GET", requestURL, nil, target)
+}
+
+// Post sends the given payload encoded as JSON to the given path and unmarshals the response into the target
+func (c *httpClient) Post(path string, payload interface{}, target interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not encode request: %s", err.Error())
+	}
+
+	return c.do("POST", c.url+"/"+strings.TrimLeft(path, "/"), body, target)
+}
+
+func (c *httpClient) do(method string, requestURL string, requestBody []byte, target interface{}) error {
+	request, err := http.NewRequest(method, requestURL, bytes.NewReader(requestBody))
+	if err != nil {
+		return fmt.Errorf("could not build request: %s", err.Error())
+	}
+
+	request.Header.Set("Accept", "application/json")
+	for key, value := range c.headers {
+		request.Header.Set(key, value)
+	}
+	if requestBody != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if credentials := strings.SplitN(c.token, ":", 2); len(credentials) == 2 {
+		request.SetBasicAuth(credentials[0], credentials[1])
+	} else if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not query server: %s", err.Error())
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("could not read response: %s", err.Error())
+	}
+
+	if response.StatusCode != http.StatusOK {
+		if message := errorMessage(body); message != "" {
+			return fmt.Errorf("server responded with status %d: %s", response.StatusCode, message)
+		}
+
+		return fmt.Errorf("server responded with status %d", response.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("could not unmarshal response: %s", err.Error())
+	}
+
+	return nil
+}
+
+// errorMessage extracts the error message out of an error response, which is either a JSON document containing the
+// message as 'error' or 'error.reason' or plain text
+func errorMessage(body []byte) string {
+	var document struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &document); err == nil && len(document.Error) > 0 {
+		var message string
+		if err := json.Unmarshal(document.Error, &message); err == nil {
+			return message
+		}
+
+		var nested struct {
+			Reason string `json:"reason"`
+		}
+		if err := json.Unmarshal(document.Error, &nested); err == nil && nested.Reason != "" {
+			return nested.Reason
+		}
+	}
+
+	message := strings.TrimSpace(strings.SplitN(string(body), "\n", 2)[0])
+	if len(message) > 200 {
+		message = message[:200] + "..."
+	}
+
+	return message
+}
@@ -0,0 +1,94 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modquery
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"strings"
+	"time"
+)
+
+type queryModule struct {
+	nagocheck.Module
+
+	client *httpClient
+
+	url          string
+	token        string
+	tokenCommand string
+	insecure     bool
+	timeout      time.Duration
+}
+
+// NewQueryModule instantiates queryModule and all contained plugins, which apply thresholds to the results of queries
+// against external monitoring and logging systems, so that Nagios can alert on data which only exists there
+func NewQueryModule() nagocheck.Module {
+	return &queryModule{
+		Module: nagocheck.NewModule("query",
+			nagocheck.ModuleDescription("Query"),
+			nagocheck.ModulePlugin(newLogPlugin("elasticsearch", "Elasticsearch Log Query")),
+			nagocheck.ModulePlugin(newLogPlugin("loki", "Loki Log Query")),
+			nagocheck.ModulePlugin(newPrometheusPlugin()),
+		),
+	}
+}
+
+func (m *queryModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("url", "Specifies the base URL of the queried server, e.g. http://prometheus:9090.").
+		Short('U').Required().StringVar(&m.url)
+
+	node.Flag("token", "Credentials for the queried server, either as bearer token or as username:password for "+
+		"basic authentication.").
+		Envar("NAGOCHECK_QUERY_TOKEN").StringVar(&m.token)
+
+	node.Flag("token-command", "Specifies a credential helper command with optional arguments, which prints the "+
+		"credentials and takes precedence over --token. Use comma to separate command and arguments.").
+		StringVar(&m.tokenCommand)
+
+	node.Flag("insecure", "Skip verification of the TLS certificate presented by the queried server.").
+		BoolVar(&m.insecure)
+
+	node.Flag("timeout", "Specifies the timeout for each request sent to the queried server.").
+		Short('t').Default("10s").DurationVar(&m.timeout)
+}
+
+func (m *queryModule) ExecutePlugin(plugin nagocheck.Plugin) error {
+	token, err := m.credentials()
+	if err != nil {
+		return err
+	}
+
+	m.client = newHTTPClient(m.url, token, m.insecure, m.timeout)
+	return m.Module.ExecutePlugin(plugin)
+}
+
+// credentials returns the credentials for the queried server, which are either given directly or printed by a
+// credential helper, so that secrets do not have to be stored within the monitoring configuration
+func (m *queryModule) credentials() (string, error) {
+	if m.tokenCommand == "" {
+		return m.token, nil
+	}
+
+	output, err := nagocheck.ExecuteCommand(m.timeout, strings.Split(m.tokenCommand, ","))
+	if err != nil {
+		return "", fmt.Errorf("could not execute credential helper: %s", err.Error())
+	}
+
+	return strings.TrimSpace(output), nil
+}
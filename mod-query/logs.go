@@ -0,0 +1,242 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type logPlugin struct {
+	nagocheck.Plugin
+
+	backend string
+
+	Query     string
+	Window    time.Duration
+	Index     string
+	TimeField string
+	Tenant    string
+}
+
+type logResource struct {
+	nagocheck.Resource
+
+	hits float64
+}
+
+type logSummarizer struct {
+	nagocheck.Summarizer
+}
+
+type elasticsearchCountResponse struct {
+	Count  float64 `json:"count"`
+	Shards struct {
+		Total  int `json:"total"`
+		Failed int `json:"failed"`
+	} `json:"_shards"`
+}
+
+func newLogPlugin(backend string, description string) *logPlugin {
+	return &logPlugin{
+		Plugin: nagocheck.NewPlugin(backend,
+			nagocheck.PluginDescription(description),
+			nagocheck.PluginHysteresis(true),
+		),
+		backend: backend,
+	}
+}
+
+func (p *logPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	switch p.backend {
+	case "elasticsearch":
+		node.Arg("query", "Query string selecting the log entries being counted, e.g. 'level:ERROR AND app:web'.").
+			Required().StringVar(&p.Query)
+		node.Flag("index", "Index or index pattern being searched.").
+			Short('i').Default("*").StringVar(&p.Index)
+		node.Flag("time-field", "Name of the field containing the timestamp of log entries.").
+			Default("@timestamp").StringVar(&p.TimeField)
+	case "loki":
+		node.Arg("query", "LogQL log query selecting the log entries being counted, e.g. "+
+			"'{app=\"web\"} |= \"ERROR\"'.").
+			Required().StringVar(&p.Query)
+		node.Flag("tenant", "Tenant being queried on multi-tenant Loki servers.").
+			StringVar(&p.Tenant)
+	}
+
+	nagocheck.DurationVar(node.Flag("window", "Time window before now in which log entries are being counted, e.g. "+
+		"5m or 1h.").
+		Short('W').Default("5m"), &p.Window)
+}
+
+func (p *logPlugin) DefineCheck() nagopher.Check {
+	check := nagopher.NewCheck(p.backend, newLogSummarizer(p))
+	check.AttachResources(newLogResource(p))
+	check.AttachContexts(
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"hits",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+	)
+
+	return check
+}
+
+func (p *logPlugin) ThisModule() *queryModule {
+	return p.Plugin.Module().(*queryModule)
+}
+
+func newLogResource(plugin *logPlugin) *logResource {
+	return &logResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *logResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(math.Inf(1)))
+
+	if err := r.Collect(warnings); err != nil {
+		return metrics, err
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("hits", r.hits, "", &valueRange, "hits"),
+	)
+
+	return metrics, nil
+}
+
+func (r *logResource) Collect(warnings nagopher.WarningCollection) error {
+	plugin := r.ThisPlugin()
+	if plugin.Window <= 0 {
+		return fmt.Errorf("time window must be positive")
+	}
+
+	plugin.Logger().Debugf("counting log entries within last %s: %s", nagocheck.DurationString(plugin.Window),
+		plugin.Query)
+
+	if plugin.backend == "elasticsearch" {
+		return r.collectElasticsearch(warnings)
+	}
+
+	return r.collectLoki()
+}
+
+func (r *logResource) collectElasticsearch(warnings nagopher.WarningCollection) error {
+	plugin := r.ThisPlugin()
+	now := time.Now()
+
+	request := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": map[string]interface{}{
+					"query_string": map[string]interface{}{"query": plugin.Query},
+				},
+				"filter": map[string]interface{}{
+					"range": map[string]interface{}{
+						plugin.TimeField: map[string]interface{}{
+							"gte":    now.Add(-plugin.Window).UTC().Format(time.RFC3339Nano),
+							"lte":    now.UTC().Format(time.RFC3339Nano),
+							"format": "strict_date_optional_time_nanos",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var response elasticsearchCountResponse
+	if err := plugin.ThisModule().client.Post(url.PathEscape(plugin.Index)+"/_count", request, &response); err != nil {
+		return err
+	}
+
+	// Failed shards do not fail the whole request, which would otherwise silently reduce the amount of hits
+	if response.Shards.Failed > 0 {
+		warnings.Add(nagocheck.PartialFailure("%d of %d shards failed", response.Shards.Failed,
+			response.Shards.Total))
+	}
+
+	r.hits = response.Count
+	return nil
+}
+
+func (r *logResource) collectLoki() error {
+	plugin := r.ThisPlugin()
+	client := plugin.ThisModule().client
+	if plugin.Tenant != "" {
+		client = client.WithHeader("X-Scope-OrgID", plugin.Tenant)
+	}
+
+	query := fmt.Sprintf("sum(count_over_time(%s [%ds]))", plugin.Query, int64(plugin.Window/time.Second))
+	parameters := url.Values{
+		"query": {query},
+		"time":  {strconv.FormatInt(time.Now().UnixNano(), 10)},
+	}
+
+	var response prometheusResponse
+	if err := client.Get("loki/api/v1/query", parameters, &response); err != nil {
+		return err
+	}
+	if response.Status != "success" {
+		return fmt.Errorf("query failed: %s", response.Error)
+	}
+
+	// Loki returns an empty vector instead of zero if no log entries matched
+	var samples []prometheusSample
+	if err := json.Unmarshal(response.Data.Result, &samples); err != nil {
+		return fmt.Errorf("could not parse query result: %s", err.Error())
+	}
+
+	r.hits = 0
+	for _, sample := range samples {
+		value, err := sampleValue(sample.Value)
+		if err != nil {
+			return fmt.Errorf("could not parse query result: %s", err.Error())
+		}
+		r.hits += value
+	}
+
+	return nil
+}
+
+func (r *logResource) ThisPlugin() *logPlugin {
+	return r.Resource.Plugin().(*logPlugin)
+}
+
+func newLogSummarizer(plugin *logPlugin) *logSummarizer {
+	return &logSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin),
+	}
+}
+
+func (s *logSummarizer) Ok(check nagopher.Check) string {
+	return fmt.Sprintf("%s matching log entries within last %s",
+		strconv.FormatFloat(check.Results().GetNumericMetricValue("hits").OrElse(math.NaN()), 'f', -1, 64),
+		nagocheck.DurationString(s.ThisPlugin().Window))
+}
+
+func (s *logSummarizer) ThisPlugin() *logPlugin {
+	return s.Summarizer.Plugin().(*logPlugin)
+}
@@ -0,0 +1,287 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type prometheusPlugin struct {
+	nagocheck.Plugin
+
+	Query     string
+	NameLabel string
+	NoData    string
+}
+
+type prometheusResource struct {
+	nagocheck.Resource
+
+	series []prometheusSeries
+}
+
+type prometheusSummarizer struct {
+	nagocheck.Summarizer
+}
+
+type prometheusSeries struct {
+	name  string
+	value float64
+}
+
+type prometheusResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type prometheusSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+func newPrometheusPlugin() *prometheusPlugin {
+	return &prometheusPlugin{
+		Plugin: nagocheck.NewPlugin("prometheus",
+			nagocheck.PluginDescription("Prometheus Query"),
+			nagocheck.PluginHysteresis(true),
+		),
+	}
+}
+
+func (p *prometheusPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("query", "PromQL expression being evaluated as instant query, which must return a scalar or an "+
+		"instant vector.").
+		Required().StringVar(&p.Query)
+
+	node.Flag("name-label", "Label whose value is used as metric name for each returned series. Defaults to the "+
+		"values of all labels if the query returns multiple series.").
+		Short('l').StringVar(&p.NameLabel)
+
+	node.Flag("no-data", "State being returned when the query returns no data, e.g. because the underlying metric "+
+		"is absent or all series are NaN.").
+		Default("unknown").EnumVar(&p.NoData, nagocheck.StateNames...)
+}
+
+func (p *prometheusPlugin) DefineCheck() nagopher.Check {
+	noDataState, err := nagocheck.ParseState(p.NoData)
+	if err != nil {
+		noDataState = nagopher.StateUnknown()
+	}
+
+	check := nagopher.NewCheck("prometheus", newPrometheusSummarizer(p))
+	check.AttachResources(newPrometheusResource(p))
+	check.AttachContexts(
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"value",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+		nagopher.NewStringMatchContext("data", noDataState, []string{"PRESENT"}),
+	)
+
+	return check
+}
+
+func (p *prometheusPlugin) ThisModule() *queryModule {
+	return p.Plugin.Module().(*queryModule)
+}
+
+func newPrometheusResource(plugin *prometheusPlugin) *prometheusResource {
+	return &prometheusResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *prometheusResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(warnings); err != nil {
+		return metrics, err
+	}
+
+	if len(r.series) == 0 {
+		return append(metrics, nagopher.MustNewStringMetric("data", "MISSING", "data")), nil
+	}
+
+	for _, series := range r.series {
+		metric := nagopher.MustNewNumericMetric(series.name, series.value, "", nil, "value")
+		if len(r.series) > 1 {
+			metrics = append(metrics, r.Section(series.name, metric)...)
+		} else {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return metrics, nil
+}
+
+func (r *prometheusResource) Collect(warnings nagopher.WarningCollection) error {
+	plugin := r.ThisPlugin()
+	plugin.Logger().Debugf("evaluating prometheus query: %s", plugin.Query)
+
+	var response prometheusResponse
+	err := plugin.ThisModule().client.Get("api/v1/query", url.Values{"query": {plugin.Query}}, &response)
+	if err != nil {
+		return err
+	}
+	if response.Status != "success" {
+		return fmt.Errorf("query failed with %s: %s", response.ErrorType, response.Error)
+	}
+
+	var samples []prometheusSample
+	switch response.Data.ResultType {
+	case "vector":
+		if err := json.Unmarshal(response.Data.Result, &samples); err != nil {
+			return fmt.Errorf("could not parse instant vector: %s", err.Error())
+		}
+	case "scalar":
+		var value []interface{}
+		if err := json.Unmarshal(response.Data.Result, &value); err != nil {
+			return fmt.Errorf("could not parse scalar: %s", err.Error())
+		}
+		samples = append(samples, prometheusSample{Value: value})
+	default:
+		return fmt.Errorf("unsupported result type [%s], query must return a scalar or an instant vector",
+			response.Data.ResultType)
+	}
+
+	r.series = nil
+	names := make(map[string]bool)
+	for _, sample := range samples {
+		name := r.seriesName(sample.Metric, len(samples) > 1)
+		if names[name] {
+			return fmt.Errorf("query returned multiple series named [%s], use --name-label or aggregate the query",
+				name)
+		}
+		names[name] = true
+
+		value, err := sampleValue(sample.Value)
+		if err != nil {
+			return fmt.Errorf("could not parse value of series [%s]: %s", name, err.Error())
+		}
+		if math.IsNaN(value) {
+			warnings.Add(nagopher.NewWarning("series [%s] returned NaN", name))
+			continue
+		}
+
+		r.series = append(r.series, prometheusSeries{name: name, value: value})
+	}
+
+	sort.Slice(r.series, func(i, j int) bool {
+		return r.series[i].name < r.series[j].name
+	})
+
+	return nil
+}
+
+// seriesName derives the metric name of a series, which is either the value of the selected label, the values of
+// all labels sorted by label name for multiple series or simply 'value' otherwise
+func (r *prometheusResource) seriesName(labels map[string]string, multiple bool) string {
+	if label := r.ThisPlugin().NameLabel; label != "" {
+		if value := labels[label]; value != "" {
+			return value
+		}
+	}
+	if !multiple {
+		return "value"
+	}
+
+	var keys []string
+	for key := range labels {
+		if key != "__name__" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	values := make([]string, len(keys))
+	for index, key := range keys {
+		values[index] = labels[key]
+	}
+
+	if len(values) == 0 {
+		return "value"
+	}
+
+	return strings.Join(values, "_")
+}
+
+func (r *prometheusResource) ThisPlugin() *prometheusPlugin {
+	return r.Resource.Plugin().(*prometheusPlugin)
+}
+
+// sampleValue parses the value of a sample, which Prometheus encodes as [<timestamp>, "<value>"]
+func sampleValue(sample []interface{}) (float64, error) {
+	if len(sample) != 2 {
+		return 0, fmt.Errorf("unexpected sample format")
+	}
+
+	value, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected sample format")
+	}
+
+	return strconv.ParseFloat(value, 64)
+}
+
+func newPrometheusSummarizer(plugin *prometheusPlugin) *prometheusSummarizer {
+	return &prometheusSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *prometheusSummarizer) Ok(check nagopher.Check) string {
+	var values []float64
+	for _, result := range check.Results().Get() {
+		if metric, err := result.Metric().Get(); err == nil && metric != nil && metric.ContextName() == "value" {
+			values = append(values, check.Results().GetNumericMetricValue(metric.Name()).OrElse(math.NaN()))
+		}
+	}
+
+	switch len(values) {
+	case 0:
+		return "query returned no data"
+	case 1:
+		return fmt.Sprintf("query returned %s", strconv.FormatFloat(values[0], 'f', -1, 64))
+	}
+
+	sort.Float64s(values)
+	return fmt.Sprintf("query returned %d series between %s and %s", len(values),
+		strconv.FormatFloat(values[0], 'f', -1, 64), strconv.FormatFloat(values[len(values)-1], 'f', -1, 64))
+}
+
+func (s *prometheusSummarizer) Problem(check nagopher.Check) string {
+	if value, err := check.Results().GetStringMetricValue("data").Get(); err == nil && value == "MISSING" {
+		return "query returned no data"
+	}
+
+	return s.Summarizer.Problem(check)
+}
@@ -0,0 +1,223 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modrouteros
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+type bgpNeighborPlugin struct {
+	nagocheck.Plugin
+
+	NeighborIP  net.IP
+	IsCritical  bool
+	UptimeRange nagopher.OptionalBounds
+}
+
+type bgpNeighborResource struct {
+	nagocheck.Resource
+
+	session *bgpSession
+}
+
+// bgpSession contains the subset of '/routing/bgp/session' used by the plugin, which only lists sessions being
+// established or in the process of being established
+type bgpSession struct {
+	Name          string `json:"name"`
+	RemoteAddress string `json:"remote.address"`
+	RemoteAS      string `json:"remote.as"`
+	RemoteID      string `json:"remote.id"`
+	LocalAddress  string `json:"local.address"`
+	LocalAS       string `json:"local.as"`
+	Established   string `json:"established"`
+	Uptime        string `json:"uptime"`
+	PrefixCount   string `json:"prefix-count"`
+}
+
+type bgpNeighborSummarizer struct {
+	nagocheck.Summarizer
+}
+
+func newBgpNeighborPlugin() *bgpNeighborPlugin {
+	return &bgpNeighborPlugin{
+		Plugin: nagocheck.NewPlugin("bgp-neighbor",
+			nagocheck.PluginDescription("BGP Neighbor"),
+			nagocheck.PluginFlapDetection(true),
+			nagocheck.PluginDefaultThresholds(false),
+			nagocheck.PluginCapacityContexts("prefix_count", "prefix_limit_usage"),
+		),
+	}
+}
+
+func (p *bgpNeighborPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("neighbor", "Specifies the IP address of neighbor for which the statistics should be fetched. Both IPv4 "+
+		"IPv6 are supported without specifying the address family explicitly.").
+		Required().IPVar(&p.NeighborIP)
+
+	node.Flag("critical", "Toggles if the given neighbor is critical or not. This will influence the "+
+		"resulting check state if the session of the given neighbor is not established by either returning WARNING or "+
+		"CRITICAL as the result.").
+		Short('c').BoolVar(&p.IsCritical)
+
+	nagocheck.DurationBoundsVar(node.Flag("uptime", "Range for neighbor uptime (state=ESTABLISHED) given as Nagios range "+
+		"specifier using durations like 15m: or 1d: (seconds by default). Plugin will return WARNING state in case the "+
+		"range does not match. This allows to alert when a session was recently established.").
+		Short('u'), &p.UptimeRange)
+}
+
+func (p *bgpNeighborPlugin) DefineCheck() nagopher.Check {
+	problemState := nagopher.StateWarning()
+	if p.IsCritical {
+		problemState = nagopher.StateCritical()
+	}
+
+	check := nagopher.NewCheck("bgp_neighbor", newBgpNeighborSummarizer(p))
+	check.AttachResources(newBgpNeighborResource(p))
+	check.AttachContexts(
+		nagopher.NewStringInfoContext("info_session"),
+
+		nagocheck.NewFlapDetectionContext(p, nagopher.NewStringMatchContext(
+			"state", problemState, []string{"ESTABLISHED"},
+		)),
+		nagopher.NewScalarContext("prefix_count", nil, nil),
+
+		nagocheck.NewNeighborUptimeContext("uptime", nagopher.OptionalBoundsPtr(p.UptimeRange), nil),
+	)
+
+	return check
+}
+
+func (p *bgpNeighborPlugin) ThisModule() *routerosModule {
+	return p.Plugin.Module().(*routerosModule)
+}
+
+func newBgpNeighborResource(plugin *bgpNeighborPlugin) *bgpNeighborResource {
+	return &bgpNeighborResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *bgpNeighborResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	if r.session == nil {
+		return append(metrics, nagopher.MustNewStringMetric("state", "DOWN", "")), nil
+	}
+
+	state := "CONNECTING"
+	if parseBool(r.session.Established) {
+		state = "ESTABLISHED"
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewStringMetric("state", state, ""),
+		nagopher.MustNewStringMetric("info_session", fmt.Sprintf(
+			"session: %s AS%s[%s] <-> AS%s[%s] RemoteRID=%s",
+			r.session.Name, r.session.RemoteAS, r.session.RemoteAddress,
+			r.session.LocalAS, r.session.LocalAddress, r.session.RemoteID), ""),
+	)
+
+	if prefixCount, err := parseNumber(r.session.PrefixCount); err == nil {
+		metrics = append(metrics, nagopher.MustNewNumericMetric("prefix_count", prefixCount, "", nil, ""))
+	}
+
+	if state == "ESTABLISHED" {
+		uptime, err := nagocheck.ParseDuration(r.session.Uptime)
+		if err != nil {
+			warnings.Add(nagopher.NewWarning("could not parse session uptime: %s", err.Error()))
+		} else {
+			metrics = append(metrics, nagopher.MustNewNumericMetric("uptime",
+				nagocheck.Round(uptime.Seconds(), 0), "s", nil, ""))
+		}
+	}
+
+	return metrics, nil
+}
+
+// Collect fetches all BGP sessions and picks the one of the neighbor, as the REST API can only filter by exact values
+// while addresses of sessions might be suffixed with their port
+func (r *bgpNeighborResource) Collect() error {
+	var sessions []*bgpSession
+	if err := r.ThisPlugin().ThisModule().client.Get("routing/bgp/session", nil, &sessions); err != nil {
+		return err
+	}
+
+	neighborIP := r.ThisPlugin().NeighborIP
+	r.session = nil
+	for _, session := range sessions {
+		address := session.RemoteAddress
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			address = host
+		}
+
+		if ip := net.ParseIP(strings.TrimSpace(address)); ip != nil && ip.Equal(neighborIP) {
+			r.session = session
+			break
+		}
+	}
+
+	return nil
+}
+
+func (r *bgpNeighborResource) ThisPlugin() *bgpNeighborPlugin {
+	return r.Resource.Plugin().(*bgpNeighborPlugin)
+}
+
+func newBgpNeighborSummarizer(plugin *bgpNeighborPlugin) *bgpNeighborSummarizer {
+	return &bgpNeighborSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin),
+	}
+}
+
+func (s *bgpNeighborSummarizer) Ok(check nagopher.Check) string {
+	resultCollection := check.Results()
+
+	uptime := resultCollection.GetNumericMetricValue("uptime").OrElse(math.NaN())
+	uptimeString := "N/A"
+	if !math.IsNaN(uptime) {
+		uptimeString = nagocheck.DurationString(time.Duration(uptime) * time.Second)
+	}
+
+	state := resultCollection.GetStringMetricValue("state").OrElse("N/A")
+	if state != "ESTABLISHED" {
+		return fmt.Sprintf("state is %s", state)
+	}
+
+	return fmt.Sprintf("state is %s since %s", state, uptimeString)
+}
+
+func (s *bgpNeighborSummarizer) Problem(check nagopher.Check) string {
+	result, err := check.Results().MostSignificantResult().Get()
+	if err == nil && result != nil {
+		metric, err := result.Metric().Get()
+		if err == nil && metric != nil && metric.Name() == "state" {
+			return s.Ok(check)
+		}
+	}
+
+	return s.Summarizer.Problem(check)
+}
@@ -0,0 +1,146 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modrouteros
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type restClient struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+type restError struct {
+	Error   int    `json:"error"`
+	Message string `json:"message"`
+	Detail  string `json:"detail"`
+}
+
+// newRestClient instantiates a client for the RouterOS v7 REST API. The token is expected as 'username:password', as
+// the REST API only supports basic authentication.
+func newRestClient(url string, token string, insecure bool, timeout time.Duration) *restClient {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+	}
+
+	return &restClient{
+		url:   strings.TrimRight(url, "/"),
+		token: token,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+	}
+}
+
+// Get fetches the given menu path (e.g. 'system/resource') and unmarshals the response into the target, optionally
+// filtering the returned items by the given query
+func (c *restClient) Get(path string, query url.Values, target interface{}) error {
+	requestURL := c.url + "/" + strings.TrimLeft(path, "/")
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+
+	return c.do("GET", requestURL, nil, target)
+}
+
+// Post executes the given command path (e.g. 'interface/ethernet/monitor') with the given parameters and unmarshals
+// the response into the target
+func (c *restClient) Post(path string, parameters map[string]string, target interface{}) error {
+	body, err := json.Marshal(parameters)
+	if err != nil {
+		return fmt.Errorf("could not encode parameters: %s", err.Error())
+	}
+
+	return c.do("POST", c.url+"/"+strings.TrimLeft(path, "/"), body, target)
+}
+
+func (c *restClient) do(method string, requestURL string, requestBody []byte, target interface{}) error {
+	request, err := http.NewRequest(method, requestURL, bytes.NewReader(requestBody))
+	if err != nil {
+		return fmt.Errorf("could not build request: %s", err.Error())
+	}
+
+	request.Header.Set("Accept", "application/json")
+	if requestBody != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		credentials := strings.SplitN(c.token, ":", 2)
+		if len(credentials) != 2 {
+			return fmt.Errorf("routeros token must be given as username:password")
+		}
+		request.SetBasicAuth(credentials[0], credentials[1])
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not query routeros api: %s", err.Error())
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, 4*1024*1024))
+	if err != nil {
+		return fmt.Errorf("could not read response of routeros api: %s", err.Error())
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var apiError restError
+		if err := json.Unmarshal(body, &apiError); err == nil && apiError.Message != "" {
+			message := apiError.Message
+			if apiError.Detail != "" {
+				message += " (" + apiError.Detail + ")"
+			}
+
+			return fmt.Errorf("routeros api responded with status %d: %s", response.StatusCode, message)
+		}
+
+		return fmt.Errorf("routeros api responded with status %d", response.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("could not unmarshal response of routeros api: %s", err.Error())
+	}
+
+	return nil
+}
+
+// parseNumber parses a numeric value returned by the REST API, which encodes all values as strings
+func parseNumber(value string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(value), 64)
+}
+
+// parseBool parses a boolean value returned by the REST API, which encodes all values as strings
+func parseBool(value string) bool {
+	return value == "true" || value == "yes"
+}
@@ -0,0 +1,161 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modrouteros
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/mod-system"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// systemResource contains the subset of '/system/resource' used by the collector and the cpu plugin
+type systemResource struct {
+	Uptime      string `json:"uptime"`
+	CPULoad     string `json:"cpu-load"`
+	CPUCount    string `json:"cpu-count"`
+	FreeMemory  string `json:"free-memory"`
+	TotalMemory string `json:"total-memory"`
+	Version     string `json:"version"`
+	BoardName   string `json:"board-name"`
+}
+
+type routerosInterface struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Running       string `json:"running"`
+	Disabled      string `json:"disabled"`
+	TransmitError string `json:"tx-error"`
+	ReceiveError  string `json:"rx-error"`
+}
+
+type ethernetMonitor struct {
+	Status     string `json:"status"`
+	Rate       string `json:"rate"`
+	FullDuplex string `json:"full-duplex"`
+}
+
+// ethernetRates maps the link rates reported by '/interface/ethernet/monitor' to their speed in Mbit/s
+var ethernetRates = map[string]int{
+	"10Mbps": 10, "100Mbps": 100, "1Gbps": 1000, "2.5Gbps": 2500, "5Gbps": 5000, "10Gbps": 10000,
+	"25Gbps": 25000, "40Gbps": 40000, "50Gbps": 50000, "100Gbps": 100000,
+}
+
+func (m *routerosModule) Target() string {
+	return m.host
+}
+
+func (m *routerosModule) CollectLoad() (stats modsystem.LoadStats, _ error) {
+	return stats, fmt.Errorf("routeros does not provide load averages")
+}
+
+func (m *routerosModule) CollectMemory() (stats modsystem.MemoryStats, _ error) {
+	resource, err := m.collectSystemResource()
+	if err != nil {
+		return stats, err
+	}
+
+	total, err := parseNumber(resource.TotalMemory)
+	if err != nil {
+		return stats, fmt.Errorf("could not parse total memory: %s", err.Error())
+	}
+	free, err := parseNumber(resource.FreeMemory)
+	if err != nil {
+		return stats, fmt.Errorf("could not parse free memory: %s", err.Error())
+	}
+
+	stats.Total, stats.Free, stats.Available = uint64(total), uint64(free), uint64(free)
+	return stats, nil
+}
+
+func (m *routerosModule) CollectUptime() (time.Duration, error) {
+	resource, err := m.collectSystemResource()
+	if err != nil {
+		return 0, err
+	}
+
+	return nagocheck.ParseDuration(resource.Uptime)
+}
+
+func (m *routerosModule) CollectInterface(name string, warnings nagopher.WarningCollection) (modsystem.InterfaceStats, error) {
+	stats := modsystem.InterfaceStats{Speed: -1, TransmitErrors: -1, ReceiveErrors: -1}
+
+	var interfaces []routerosInterface
+	if err := m.client.Get("interface", url.Values{"name": {name}}, &interfaces); err != nil {
+		return stats, err
+	}
+	if len(interfaces) == 0 {
+		return stats, fmt.Errorf("could not find interface with name %s", name)
+	}
+
+	iface := interfaces[0]
+	switch {
+	case parseBool(iface.Disabled):
+		stats.State = "DISABLED"
+	case parseBool(iface.Running):
+		stats.State = "UP"
+	default:
+		stats.State = "DOWN"
+	}
+
+	if value, err := parseNumber(iface.TransmitError); err == nil {
+		stats.TransmitErrors = int(value)
+	} else {
+		warnings.Add(nagocheck.PartialFailure("could not determine transmit errors"))
+	}
+	if value, err := parseNumber(iface.ReceiveError); err == nil {
+		stats.ReceiveErrors = int(value)
+	} else {
+		warnings.Add(nagocheck.PartialFailure("could not determine receive errors"))
+	}
+
+	// Link speed and duplex are only known for ethernet interfaces with an established link
+	if iface.Type == "ether" && stats.State == "UP" {
+		var monitors []ethernetMonitor
+		err := m.client.Post("interface/ethernet/monitor", map[string]string{"numbers": name, "once": ""}, &monitors)
+		if err != nil || len(monitors) == 0 {
+			warnings.Add(nagocheck.PartialFailure("could not determine link speed and duplex"))
+			return stats, nil
+		}
+
+		if speed, ok := ethernetRates[monitors[0].Rate]; ok {
+			stats.Speed = speed
+		}
+
+		stats.Duplex = "HALF"
+		if parseBool(monitors[0].FullDuplex) {
+			stats.Duplex = "FULL"
+		}
+	}
+
+	return stats, nil
+}
+
+func (m *routerosModule) collectSystemResource() (*systemResource, error) {
+	var resource systemResource
+	if err := m.client.Get("system/resource", nil, &resource); err != nil {
+		return nil, err
+	}
+
+	resource.Uptime = strings.TrimSpace(resource.Uptime)
+	return &resource, nil
+}
@@ -0,0 +1,130 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modrouteros
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+)
+
+type cpuPlugin struct {
+	nagocheck.Plugin
+}
+
+type cpuResource struct {
+	nagocheck.Resource
+
+	cpuLoad  float64
+	cpuCount float64
+	board    string
+	version  string
+}
+
+type cpuSummarizer struct {
+	nagocheck.Summarizer
+}
+
+func newCPUPlugin() *cpuPlugin {
+	return &cpuPlugin{
+		Plugin: nagocheck.NewPlugin("cpu",
+			nagocheck.PluginDescription("CPU Usage"),
+			nagocheck.PluginHysteresis(true),
+		),
+	}
+}
+
+func (p *cpuPlugin) DefineCheck() nagopher.Check {
+	check := nagopher.NewCheck("cpu", newCPUSummarizer(p))
+	check.AttachResources(newCPUResource(p))
+	check.AttachContexts(
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"usage",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+
+		nagopher.NewScalarContext("cpu_count", nil, nil),
+		nagopher.NewStringInfoContext("info_system"),
+	)
+
+	return check
+}
+
+func (p *cpuPlugin) ThisModule() *routerosModule {
+	return p.Plugin.Module().(*routerosModule)
+}
+
+func newCPUResource(plugin *cpuPlugin) *cpuResource {
+	return &cpuResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *cpuResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(100))
+
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("usage", r.cpuLoad, "%", &valueRange, ""),
+		nagopher.MustNewNumericMetric("cpu_count", r.cpuCount, "", nil, ""),
+		nagopher.MustNewStringMetric("info_system", fmt.Sprintf("system: %s running RouterOS %s",
+			r.board, r.version), ""),
+	)
+
+	return metrics, nil
+}
+
+func (r *cpuResource) Collect() (err error) {
+	resource, err := r.ThisPlugin().ThisModule().collectSystemResource()
+	if err != nil {
+		return err
+	}
+
+	if r.cpuLoad, err = parseNumber(resource.CPULoad); err != nil {
+		return fmt.Errorf("could not parse cpu load: %s", err.Error())
+	}
+	if r.cpuCount, err = parseNumber(resource.CPUCount); err != nil {
+		return fmt.Errorf("could not parse cpu count: %s", err.Error())
+	}
+	r.board, r.version = resource.BoardName, resource.Version
+
+	return nil
+}
+
+func (r *cpuResource) ThisPlugin() *cpuPlugin {
+	return r.Resource.Plugin().(*cpuPlugin)
+}
+
+func newCPUSummarizer(plugin *cpuPlugin) *cpuSummarizer {
+	return &cpuSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin),
+	}
+}
+
+func (s *cpuSummarizer) Ok(check nagopher.Check) string {
+	resultCollection := check.Results()
+
+	return fmt.Sprintf("%.0f%% used across %d CPUs",
+		resultCollection.GetNumericMetricValue("usage").OrElse(0),
+		int(resultCollection.GetNumericMetricValue("cpu_count").OrElse(0)))
+}
@@ -0,0 +1,103 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modrouteros
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/mod-system"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"strings"
+	"time"
+)
+
+type routerosModule struct {
+	nagocheck.Module
+
+	client *restClient
+
+	host         string
+	port         uint16
+	token        string
+	tokenCommand string
+	insecure     bool
+	timeout      time.Duration
+}
+
+// NewRouterOSModule instantiates routerosModule and all contained plugins, which either reuse the plugins of the system
+// module or check RouterOS specific statistics, all of them being collected using the RouterOS v7 REST API
+func NewRouterOSModule() nagocheck.Module {
+	module := &routerosModule{}
+	module.Module = nagocheck.NewModule("routeros",
+		nagocheck.ModuleDescription("MikroTik RouterOS"),
+		nagocheck.ModulePlugin(newBgpNeighborPlugin()),
+		nagocheck.ModulePlugin(newCPUPlugin()),
+		nagocheck.ModulePlugin(modsystem.NewRemoteInterfacePlugin(module)),
+		nagocheck.ModulePlugin(modsystem.NewRemoteMemoryPlugin(module)),
+		nagocheck.ModulePlugin(modsystem.NewRemoteUptimePlugin(module)),
+	)
+
+	return module
+}
+
+func (m *routerosModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("host", "Specifies the hostname or address of the RouterOS device.").
+		Short('H').Required().StringVar(&m.host)
+
+	node.Flag("port", "Specifies the HTTPS port of the RouterOS REST API.").
+		Default("443").Uint16Var(&m.port)
+
+	node.Flag("token", "Credentials of the RouterOS API user as username:password.").
+		Envar("NAGOCHECK_ROUTEROS_TOKEN").StringVar(&m.token)
+
+	node.Flag("token-command", "Specifies a credential helper command with optional arguments, which prints the "+
+		"credentials as username:password and takes precedence over --token. Use comma to separate command and "+
+		"arguments.").
+		StringVar(&m.tokenCommand)
+
+	node.Flag("insecure", "Skip verification of the TLS certificate presented by the RouterOS device.").
+		BoolVar(&m.insecure)
+
+	node.Flag("timeout", "Specifies the timeout for each request sent to the RouterOS REST API.").
+		Short('t').Default("10s").DurationVar(&m.timeout)
+}
+
+func (m *routerosModule) ExecutePlugin(plugin nagocheck.Plugin) error {
+	token, err := m.credentials()
+	if err != nil {
+		return err
+	}
+
+	m.client = newRestClient(fmt.Sprintf("https://%s:%d/rest", m.host, m.port), token, m.insecure, m.timeout)
+	return m.Module.ExecutePlugin(plugin)
+}
+
+// credentials returns the credentials for the REST API, which are either given directly or printed by a credential
+// helper, so that secrets do not have to be stored within the monitoring configuration
+func (m *routerosModule) credentials() (string, error) {
+	if m.tokenCommand == "" {
+		return m.token, nil
+	}
+
+	output, err := nagocheck.ExecuteCommand(m.timeout, strings.Split(m.tokenCommand, ","))
+	if err != nil {
+		return "", fmt.Errorf("could not execute credential helper: %s", err.Error())
+	}
+
+	return strings.TrimSpace(output), nil
+}
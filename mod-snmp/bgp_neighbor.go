@@ -0,0 +1,318 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modsnmp
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagocheck/nagocheck/snmp"
+	"github.com/snapserv/nagopher"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type bgpNeighborPlugin struct {
+	nagocheck.Plugin
+
+	NeighborIP  net.IP
+	MIB         string
+	IsCritical  bool
+	UptimeRange nagopher.OptionalBounds
+}
+
+type bgpNeighborResource struct {
+	nagocheck.Resource
+
+	peer *bgpPeer
+}
+
+// bgpPeer contains the status of a BGP peer as exposed by either BGP4-MIB or CISCO-BGP4-MIB, where unknown prefix
+// counts are -1
+type bgpPeer struct {
+	State           string
+	RemoteAS        int64
+	LocalAS         int64
+	RemoteRouterID  string
+	LocalAddress    string
+	EstablishedTime time.Duration
+	AcceptedCount   int64
+}
+
+// Object identifiers of BGP4-MIB and CISCO-BGP4-MIB used by the bgp-neighbor plugin
+const (
+	oidBgpLocalAs                  = "1.3.6.1.2.1.15.2.0"
+	oidBgpPeerIdentifier           = "1.3.6.1.2.1.15.3.1.1"
+	oidBgpPeerState                = "1.3.6.1.2.1.15.3.1.2"
+	oidBgpPeerAdminStatus          = "1.3.6.1.2.1.15.3.1.3"
+	oidBgpPeerLocalAddr            = "1.3.6.1.2.1.15.3.1.5"
+	oidBgpPeerRemoteAs             = "1.3.6.1.2.1.15.3.1.9"
+	oidBgpPeerFsmEstablishedTime   = "1.3.6.1.2.1.15.3.1.16"
+	oidCbgpPeer2State              = "1.3.6.1.4.1.9.9.187.1.2.5.1.3"
+	oidCbgpPeer2AdminStatus        = "1.3.6.1.4.1.9.9.187.1.2.5.1.4"
+	oidCbgpPeer2LocalAddr          = "1.3.6.1.4.1.9.9.187.1.2.5.1.6"
+	oidCbgpPeer2LocalAs            = "1.3.6.1.4.1.9.9.187.1.2.5.1.8"
+	oidCbgpPeer2RemoteAs           = "1.3.6.1.4.1.9.9.187.1.2.5.1.11"
+	oidCbgpPeer2RemoteIdentifier   = "1.3.6.1.4.1.9.9.187.1.2.5.1.12"
+	oidCbgpPeer2FsmEstablishedTime = "1.3.6.1.4.1.9.9.187.1.2.5.1.19"
+	oidCbgpPeer2AcceptedPrefixes   = "1.3.6.1.4.1.9.9.187.1.2.8.1.1"
+)
+
+// bgpPeerStateNames maps BGP4-MIB::bgpPeerState and CISCO-BGP4-MIB::cbgpPeer2State to the state names used by the
+// bgp-neighbor plugins of all other modules
+var bgpPeerStateNames = map[int64]string{
+	1: "IDLE", 2: "CONNECT", 3: "ACTIVE", 4: "OPENSENT", 5: "OPENCONFIRM", 6: "ESTABLISHED",
+}
+
+// bgpPeerAdminStop is the value of BGP4-MIB::bgpPeerAdminStatus for administratively disabled peers
+const bgpPeerAdminStop = 1
+
+// bgpMIBNames contains all MIBs supported by the bgp-neighbor plugin, where 'auto' tries BGP4-MIB first
+var bgpMIBNames = []string{"auto", "bgp4", "cisco"}
+
+func newBgpNeighborPlugin() *bgpNeighborPlugin {
+	return &bgpNeighborPlugin{
+		Plugin: nagocheck.NewPlugin("bgp-neighbor",
+			nagocheck.PluginDescription("BGP Neighbor"),
+			nagocheck.PluginFlapDetection(true),
+			nagocheck.PluginDefaultThresholds(false),
+			nagocheck.PluginCapacityContexts("prefix_count", "prefix_limit_usage"),
+		),
+	}
+}
+
+func (p *bgpNeighborPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("neighbor", "Specifies the IP address of neighbor for which the statistics should be fetched. Both IPv4 "+
+		"IPv6 are supported without specifying the address family explicitly, while IPv6 requires CISCO-BGP4-MIB.").
+		Required().IPVar(&p.NeighborIP)
+
+	node.Flag("mib", "Specifies the MIB used for fetching the neighbor statistics. By default, BGP4-MIB is being "+
+		"used for IPv4 neighbors with a fallback to CISCO-BGP4-MIB, which also supports IPv6 and prefix counts.").
+		Default("auto").EnumVar(&p.MIB, bgpMIBNames...)
+
+	node.Flag("critical", "Toggles if the given neighbor is critical or not. This will influence the "+
+		"resulting check state if the session of the given neighbor is not established by either returning WARNING or "+
+		"CRITICAL as the result.").
+		Short('c').BoolVar(&p.IsCritical)
+
+	nagocheck.DurationBoundsVar(node.Flag("uptime", "Range for neighbor uptime (state=ESTABLISHED) given as Nagios range "+
+		"specifier using durations like 15m: or 1d: (seconds by default). Plugin will return WARNING state in case the "+
+		"range does not match. This allows to alert when a session was recently established.").
+		Short('u'), &p.UptimeRange)
+}
+
+func (p *bgpNeighborPlugin) DefineCheck() nagopher.Check {
+	problemState := nagopher.StateWarning()
+	if p.IsCritical {
+		problemState = nagopher.StateCritical()
+	}
+
+	check := nagopher.NewCheck("bgp_neighbor", nagocheck.NewNeighborSummarizer(p))
+	check.AttachResources(newBgpNeighborResource(p))
+	check.AttachContexts(
+		nagopher.NewStringInfoContext("info_session"),
+
+		nagocheck.NewFlapDetectionContext(p, nagopher.NewStringMatchContext(
+			"state", problemState, []string{"ESTABLISHED"},
+		)),
+		nagopher.NewScalarContext("last_state_change", nil, nil),
+		nagopher.NewScalarContext("prefix_count", nil, nil),
+
+		nagocheck.NewNeighborUptimeContext("uptime", nagopher.OptionalBoundsPtr(p.UptimeRange), nil),
+	)
+
+	return check
+}
+
+func (p *bgpNeighborPlugin) ThisModule() *snmpModule {
+	return p.Plugin.Module().(*snmpModule)
+}
+
+func newBgpNeighborResource(plugin *bgpNeighborPlugin) *bgpNeighborResource {
+	return &bgpNeighborResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *bgpNeighborResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	lastStateChangeSeconds := nagocheck.Round(r.peer.EstablishedTime.Seconds(), 0)
+	metrics = append(metrics,
+		nagopher.MustNewStringMetric("state", r.peer.State, ""),
+		nagopher.MustNewNumericMetric("last_state_change", lastStateChangeSeconds, "s", nil, ""),
+		nagopher.MustNewStringMetric("info_session", fmt.Sprintf(
+			"session: AS%d[%s] <-> AS%d[%s] RemoteRID=%s",
+			r.peer.RemoteAS, r.ThisPlugin().NeighborIP.String(),
+			r.peer.LocalAS, r.peer.LocalAddress, r.peer.RemoteRouterID), ""),
+	)
+
+	// Prefix counts are only exposed by CISCO-BGP4-MIB
+	if r.peer.AcceptedCount >= 0 {
+		metrics = append(metrics, nagopher.MustNewNumericMetric("prefix_count",
+			float64(r.peer.AcceptedCount), "", nil, ""))
+	}
+
+	// Only add uptime metric (redundant with last state change metric) if state=='ESTABLISHED'
+	if r.peer.State == "ESTABLISHED" {
+		metrics = append(metrics, nagopher.MustNewNumericMetric("uptime", lastStateChangeSeconds, "s", nil, ""))
+	}
+
+	return metrics, nil
+}
+
+// Collect fetches the statistics of the neighbor, falling back to CISCO-BGP4-MIB in case the neighbor can not be
+// found within BGP4-MIB, which only supports IPv4 neighbors
+func (r *bgpNeighborResource) Collect() (err error) {
+	module := r.ThisPlugin().ThisModule()
+	neighborIP := r.ThisPlugin().NeighborIP
+	mib := r.ThisPlugin().MIB
+
+	if (mib == "auto" || mib == "bgp4") && neighborIP.To4() != nil {
+		if r.peer, err = module.collectBgp4Peer(neighborIP); err != nil || r.peer != nil || mib == "bgp4" {
+			return r.ensurePeer(err)
+		}
+	}
+	if mib == "auto" || mib == "cisco" {
+		r.peer, err = module.collectCiscoBgp4Peer(neighborIP)
+	}
+
+	return r.ensurePeer(err)
+}
+
+func (r *bgpNeighborResource) ensurePeer(err error) error {
+	if err == nil && r.peer == nil {
+		return fmt.Errorf("could not find neighbor [%s]", r.ThisPlugin().NeighborIP.String())
+	}
+
+	return err
+}
+
+func (r *bgpNeighborResource) ThisPlugin() *bgpNeighborPlugin {
+	return r.Resource.Plugin().(*bgpNeighborPlugin)
+}
+
+// collectBgp4Peer fetches the statistics of the given IPv4 neighbor from BGP4-MIB::bgpPeerTable, which is indexed by
+// the address of the neighbor. Returns nil without an error if the neighbor does not exist.
+func (m *snmpModule) collectBgp4Peer(address net.IP) (*bgpPeer, error) {
+	index := "." + address.To4().String()
+	variables, err := m.client.Get(
+		oidBgpPeerState+index, oidBgpPeerAdminStatus+index, oidBgpPeerRemoteAs+index, oidBgpLocalAs,
+		oidBgpPeerIdentifier+index, oidBgpPeerLocalAddr+index, oidBgpPeerFsmEstablishedTime+index,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBgpPeer(variables, -1)
+}
+
+// collectCiscoBgp4Peer fetches the statistics of the given neighbor from CISCO-BGP4-MIB::cbgpPeer2Table, which is
+// indexed by the address type and the length-prefixed address of the neighbor. Returns nil without an error if the
+// neighbor does not exist.
+func (m *snmpModule) collectCiscoBgp4Peer(address net.IP) (*bgpPeer, error) {
+	addressType, addressFamily, octets := 1, 1, []byte(address.To4())
+	if octets == nil {
+		addressType, addressFamily, octets = 2, 2, []byte(address.To16())
+	}
+
+	indexParts := []string{strconv.Itoa(addressType), strconv.Itoa(len(octets))}
+	for _, octet := range octets {
+		indexParts = append(indexParts, strconv.Itoa(int(octet)))
+	}
+	index := "." + strings.Join(indexParts, ".")
+
+	variables, err := m.client.Get(
+		oidCbgpPeer2State+index, oidCbgpPeer2AdminStatus+index, oidCbgpPeer2RemoteAs+index, oidCbgpPeer2LocalAs+index,
+		oidCbgpPeer2RemoteIdentifier+index, oidCbgpPeer2LocalAddr+index, oidCbgpPeer2FsmEstablishedTime+index,
+		fmt.Sprintf("%s%s.%d.1", oidCbgpPeer2AcceptedPrefixes, index, addressFamily),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	acceptedCount := int64(-1)
+	if variables[7].Exists() {
+		if acceptedCount, err = variables[7].Int(); err != nil {
+			return nil, err
+		}
+	}
+
+	return newBgpPeer(variables[:7], acceptedCount)
+}
+
+// newBgpPeer builds the peer statistics from the variables of BGP4-MIB or CISCO-BGP4-MIB, which must be given in the
+// order state, admin status, remote AS, local AS, remote identifier, local address and established time
+func newBgpPeer(variables []snmp.Variable, acceptedCount int64) (*bgpPeer, error) {
+	if !variables[0].Exists() {
+		return nil, nil
+	}
+
+	numbers := make([]int64, 4)
+	for index := range numbers {
+		if !variables[index].Exists() {
+			continue
+		}
+
+		value, err := variables[index].Int()
+		if err != nil {
+			return nil, err
+		}
+		numbers[index] = value
+	}
+
+	peer := &bgpPeer{
+		State:          bgpPeerStateNames[numbers[0]],
+		RemoteAS:       numbers[2],
+		LocalAS:        numbers[3],
+		RemoteRouterID: addressString(variables[4]),
+		LocalAddress:   addressString(variables[5]),
+		AcceptedCount:  acceptedCount,
+	}
+
+	if peer.State == "" {
+		peer.State = "UNKNOWN"
+	}
+	if numbers[1] == bgpPeerAdminStop {
+		peer.State = "SHUTDOWN"
+	}
+
+	if variables[6].Exists() {
+		seconds, err := variables[6].Int()
+		if err != nil {
+			return nil, err
+		}
+		peer.EstablishedTime = time.Duration(seconds) * time.Second
+	}
+
+	return peer, nil
+}
+
+// addressString returns the IP address contained within the given variable, which is either an IpAddress or an
+// InetAddress given as raw octets
+func addressString(variable snmp.Variable) string {
+	if octets, ok := variable.Value.([]byte); ok && (len(octets) == net.IPv4len || len(octets) == net.IPv6len) {
+		return net.IP(octets).String()
+	}
+
+	return variable.String()
+}
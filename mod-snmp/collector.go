@@ -0,0 +1,223 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modsnmp
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/mod-system"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagocheck/nagocheck/snmp"
+	"github.com/snapserv/nagopher"
+	"strings"
+	"time"
+)
+
+// Object identifiers of UCD-SNMP-MIB, HOST-RESOURCES-MIB, IF-MIB and EtherLike-MIB used by the collector
+const (
+	oidLaLoad          = "1.3.6.1.4.1.2021.10.1.3"
+	oidMemTotalReal    = "1.3.6.1.4.1.2021.4.5.0"
+	oidMemAvailReal    = "1.3.6.1.4.1.2021.4.6.0"
+	oidMemBuffer       = "1.3.6.1.4.1.2021.4.14.0"
+	oidMemCached       = "1.3.6.1.4.1.2021.4.15.0"
+	oidMemSysAvail     = "1.3.6.1.4.1.2021.4.16.0"
+	oidHrSystemUptime  = "1.3.6.1.2.1.25.1.1.0"
+	oidSysUpTime       = "1.3.6.1.2.1.1.3.0"
+	oidHrProcessorLoad = "1.3.6.1.2.1.25.3.3.1.2"
+	oidIfDescr         = "1.3.6.1.2.1.2.2.1.2"
+	oidIfSpeed         = "1.3.6.1.2.1.2.2.1.5"
+	oidIfOperStatus    = "1.3.6.1.2.1.2.2.1.8"
+	oidIfInErrors      = "1.3.6.1.2.1.2.2.1.14"
+	oidIfOutErrors     = "1.3.6.1.2.1.2.2.1.20"
+	oidIfName          = "1.3.6.1.2.1.31.1.1.1.1"
+	oidIfHighSpeed     = "1.3.6.1.2.1.31.1.1.1.15"
+	oidDot3Duplex      = "1.3.6.1.2.1.10.7.2.1.19"
+)
+
+// ifOperStatusNames maps IF-MIB::ifOperStatus to the operational states used by Linux
+var ifOperStatusNames = map[int64]string{
+	1: "UP", 2: "DOWN", 3: "TESTING", 4: "UNKNOWN", 5: "DORMANT", 6: "NOTPRESENT", 7: "LOWERLAYERDOWN",
+}
+
+// dot3DuplexNames maps EtherLike-MIB::dot3StatsDuplexStatus to the duplex names used by Linux
+var dot3DuplexNames = map[int64]string{
+	1: "UNKNOWN", 2: "HALF", 3: "FULL",
+}
+
+func (m *snmpModule) Target() string {
+	return m.host
+}
+
+func (m *snmpModule) CollectLoad() (stats modsystem.LoadStats, _ error) {
+	variables, err := m.client.Get(oidLaLoad+".1", oidLaLoad+".2", oidLaLoad+".3")
+	if err != nil {
+		return stats, err
+	}
+
+	loadAverages := make([]float64, len(variables))
+	for index, variable := range variables {
+		if !variable.Exists() {
+			return stats, fmt.Errorf("agent does not provide UCD-SNMP-MIB::laLoad")
+		}
+		if loadAverages[index], err = variable.Float(); err != nil {
+			return stats, err
+		}
+	}
+
+	// CPU count is only being used for per-cpu load averages and therefore optional
+	processors, err := m.client.Walk(oidHrProcessorLoad)
+	if err == nil {
+		stats.CPUCores = uint(len(processors))
+	}
+
+	stats.Load1, stats.Load5, stats.Load15 = loadAverages[0], loadAverages[1], loadAverages[2]
+	return stats, nil
+}
+
+func (m *snmpModule) CollectMemory() (stats modsystem.MemoryStats, _ error) {
+	variables, err := m.client.Get(oidMemTotalReal, oidMemAvailReal, oidMemBuffer, oidMemCached, oidMemSysAvail)
+	if err != nil {
+		return stats, err
+	}
+
+	values := make([]uint64, len(variables))
+	for index, variable := range variables {
+		if !variable.Exists() {
+			continue
+		}
+
+		value, err := variable.Int()
+		if err != nil {
+			return stats, err
+		}
+		values[index] = uint64(value) * 1024
+	}
+
+	if values[0] == 0 {
+		return stats, fmt.Errorf("agent does not provide UCD-SNMP-MIB::memTotalReal")
+	}
+
+	stats.Total, stats.Free, stats.Buffers, stats.Cached = values[0], values[1], values[2], values[3]
+
+	// Prefer the available memory as calculated by the kernel, which is only exposed by recent versions of net-snmp
+	stats.Available = values[4]
+	if stats.Available == 0 {
+		stats.Available = stats.Free + stats.Buffers + stats.Cached
+	}
+	if stats.Available > stats.Total {
+		stats.Available = stats.Total
+	}
+
+	return stats, nil
+}
+
+func (m *snmpModule) CollectUptime() (time.Duration, error) {
+	// Prefer uptime of host over uptime of SNMP agent, which gets reset when restarting the agent
+	for _, oid := range []string{oidHrSystemUptime, oidSysUpTime} {
+		variables, err := m.client.Get(oid)
+		if err != nil {
+			return 0, err
+		}
+		if !variables[0].Exists() {
+			continue
+		}
+
+		ticks, err := variables[0].Int()
+		if err != nil {
+			return 0, err
+		}
+
+		return time.Duration(ticks) * 10 * time.Millisecond, nil
+	}
+
+	return 0, fmt.Errorf("agent does provide neither HOST-RESOURCES-MIB::hrSystemUptime nor SNMPv2-MIB::sysUpTime")
+}
+
+func (m *snmpModule) CollectInterface(name string, warnings nagopher.WarningCollection) (modsystem.InterfaceStats, error) {
+	stats := modsystem.InterfaceStats{Speed: -1, TransmitErrors: -1, ReceiveErrors: -1}
+
+	ifIndex, err := m.lookupInterfaceIndex(name)
+	if err != nil {
+		return stats, err
+	}
+
+	variables, err := m.client.Get(
+		oidIfOperStatus+ifIndex, oidIfHighSpeed+ifIndex, oidIfSpeed+ifIndex, oidDot3Duplex+ifIndex,
+		oidIfOutErrors+ifIndex, oidIfInErrors+ifIndex,
+	)
+	if err != nil {
+		return stats, err
+	}
+
+	value := func(variable snmp.Variable, description string) (int64, bool) {
+		if variable.Exists() {
+			if result, err := variable.Int(); err == nil {
+				return result, true
+			}
+		}
+
+		warnings.Add(nagocheck.PartialFailure("could not determine %s", description))
+		return 0, false
+	}
+
+	operStatus, ok := value(variables[0], "link state")
+	if !ok {
+		return stats, fmt.Errorf("could not determine link state of interface %s", name)
+	}
+	stats.State = ifOperStatusNames[operStatus]
+
+	// Prefer ifHighSpeed in Mbit/s, as ifSpeed in bit/s saturates at ~4.3 Gbit/s
+	if variables[1].Exists() {
+		if speed, ok := value(variables[1], "link speed"); ok {
+			stats.Speed = int(speed)
+		}
+	} else if speed, ok := value(variables[2], "link speed"); ok {
+		stats.Speed = int(speed / 1000000)
+	}
+
+	if duplex, ok := value(variables[3], "link duplex"); ok {
+		stats.Duplex = dot3DuplexNames[duplex]
+	}
+	if transmitErrors, ok := value(variables[4], "transmit errors"); ok {
+		stats.TransmitErrors = int(transmitErrors)
+	}
+	if receiveErrors, ok := value(variables[5], "receive errors"); ok {
+		stats.ReceiveErrors = int(receiveErrors)
+	}
+
+	return stats, nil
+}
+
+// lookupInterfaceIndex returns the IF-MIB::ifIndex of the interface with the given name as suffix for other
+// object identifiers, matching ifName before falling back to ifDescr
+func (m *snmpModule) lookupInterfaceIndex(name string) (string, error) {
+	for _, oid := range []string{oidIfName, oidIfDescr} {
+		variables, err := m.client.Walk(oid)
+		if err != nil {
+			return "", err
+		}
+
+		for _, variable := range variables {
+			if variable.String() == name {
+				return strings.TrimPrefix(variable.OID, oid), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("could not find interface with name %s", name)
+}
@@ -0,0 +1,113 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modsnmp
+
+import (
+	"github.com/snapserv/nagocheck/mod-system"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagocheck/nagocheck/snmp"
+	"time"
+)
+
+type snmpModule struct {
+	nagocheck.Module
+
+	client *snmp.Client
+
+	host      string
+	port      uint16
+	community string
+	security  snmp.SecurityParameters
+	timeout   time.Duration
+	retries   int
+}
+
+// NewSNMPModule instantiates snmpModule and all contained plugins, which mostly reuse the plugins of the system module
+// while collecting their statistics from a remote agent
+func NewSNMPModule() nagocheck.Module {
+	module := &snmpModule{}
+	module.Module = nagocheck.NewModule("snmp",
+		nagocheck.ModuleDescription("SNMP (agentless)"),
+		nagocheck.ModulePlugin(newBgpNeighborPlugin()),
+		nagocheck.ModulePlugin(newSensorPlugin()),
+		nagocheck.ModulePlugin(modsystem.NewRemoteInterfacePlugin(module)),
+		nagocheck.ModulePlugin(modsystem.NewRemoteLoadPlugin(module)),
+		nagocheck.ModulePlugin(modsystem.NewRemoteMemoryPlugin(module)),
+		nagocheck.ModulePlugin(modsystem.NewRemoteUptimePlugin(module)),
+	)
+
+	return module
+}
+
+func (m *snmpModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("host", "Specifies the hostname or address of the remote SNMP agent.").
+		Short('H').Required().StringVar(&m.host)
+
+	node.Flag("port", "Specifies the UDP port of the remote SNMP agent.").
+		Default("161").Uint16Var(&m.port)
+
+	node.Flag("community", "Specifies the community used for SNMP v2c. Ignored when --v3-user has been set.").
+		Short('C').Default("public").Envar("NAGOCHECK_SNMP_COMMUNITY").StringVar(&m.community)
+
+	node.Flag("timeout", "Specifies the timeout for each request sent to the remote SNMP agent.").
+		Short('t').Default("5s").DurationVar(&m.timeout)
+
+	node.Flag("retries", "Specifies the amount of retries for unanswered requests.").
+		Default("1").IntVar(&m.retries)
+
+	node.Flag("v3-user", "[v3] Specifies the USM user name, which switches to SNMP v3 when set.").
+		StringVar(&m.security.UserName)
+
+	node.Flag("v3-auth-protocol", "[v3] Specifies the authentication protocol.").
+		Default(string(snmp.AuthNone)).EnumVar((*string)(&m.security.AuthProtocol), snmp.AuthProtocolNames...)
+
+	node.Flag("v3-auth-password", "[v3] Specifies the authentication password.").
+		Envar("NAGOCHECK_SNMP_AUTH_PASSWORD").StringVar(&m.security.AuthPassword)
+
+	node.Flag("v3-priv-protocol", "[v3] Specifies the privacy (encryption) protocol.").
+		Default(string(snmp.PrivNone)).EnumVar((*string)(&m.security.PrivProtocol), snmp.PrivProtocolNames...)
+
+	node.Flag("v3-priv-password", "[v3] Specifies the privacy password.").
+		Envar("NAGOCHECK_SNMP_PRIV_PASSWORD").StringVar(&m.security.PrivPassword)
+
+	node.Flag("v3-context", "[v3] Specifies the context name.").
+		StringVar(&m.security.ContextName)
+}
+
+func (m *snmpModule) ExecutePlugin(plugin nagocheck.Plugin) error {
+	options := []snmp.ClientOpt{
+		snmp.ClientPort(m.port),
+		snmp.ClientTimeout(m.timeout),
+		snmp.ClientRetries(m.retries),
+	}
+
+	if m.security.UserName != "" {
+		options = append(options, snmp.ClientSecurity(m.security))
+	} else {
+		options = append(options, snmp.ClientCommunity(m.community))
+	}
+
+	m.client = snmp.NewClient(m.host, options...)
+	if err := m.client.Connect(); err != nil {
+		return err
+	}
+	defer m.client.Close()
+
+	return m.Module.ExecutePlugin(plugin)
+}
@@ -0,0 +1,415 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsnmp
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagocheck/nagocheck/snmp"
+	"github.com/snapserv/nagopher"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type sensorPlugin struct {
+	nagocheck.Plugin
+
+	Profile string
+	Columns []sensorColumn
+}
+
+type sensorResource struct {
+	nagocheck.Resource
+
+	readings []sensorReading
+}
+
+type sensorSummarizer struct {
+	nagocheck.Summarizer
+}
+
+// sensorColumn describes a table column containing sensor readings, which get exposed as one metric per row named
+// '<prefix>_<index>_<context>' or '<context>_<index>' without prefix. Values are multiplied by the given scale or, if a column containing the amount of
+// decimal digits per row has been specified, divided by 10^digits.
+type sensorColumn struct {
+	Context string
+	Prefix  string
+	Unit    string
+	OID     string
+	Scale   float64
+
+	// SkipIndex drops the given amount of leading index components, e.g. the PDU or strapping index
+	SkipIndex int
+	// IndexSuffix restricts the column to rows whose index ends with the given components, which are being stripped
+	IndexSuffix string
+	// TypeOID and TypeValue restrict the column to rows whose type column (sharing the same index) matches
+	TypeOID   string
+	TypeValue int64
+	// DigitsOID specifies a column containing the amount of decimal digits of each row
+	DigitsOID string
+}
+
+type sensorReading struct {
+	name    string
+	context string
+	unit    string
+	value   float64
+}
+
+type sensorColumnsValue struct {
+	value *[]sensorColumn
+}
+
+// sensorContextUnits maps the contexts used by the built-in profiles to their units
+var sensorContextUnits = map[string]string{
+	"current": "A", "voltage": "V", "temperature": "C", "humidity": "%",
+}
+
+// sensorProfiles contains ready-made column definitions for common PDUs and environmental sensors, based on
+// PowerNet-MIB (APC rPDU2), EATON-EPDU-MIB and PDU2-MIB (Raritan)
+var sensorProfiles = map[string][]sensorColumn{
+	"apc": {
+		{Context: "current", Prefix: "phase", OID: "1.3.6.1.4.1.318.1.1.26.6.3.1.5", Scale: 0.1},
+		{Context: "voltage", Prefix: "phase", OID: "1.3.6.1.4.1.318.1.1.26.6.3.1.6", Scale: 1},
+		{Context: "current", Prefix: "outlet", OID: "1.3.6.1.4.1.318.1.1.26.9.4.3.1.6", Scale: 0.1},
+		{Context: "temperature", Prefix: "sensor", OID: "1.3.6.1.4.1.318.1.1.26.10.2.2.1.8", Scale: 0.1},
+		{Context: "humidity", Prefix: "sensor", OID: "1.3.6.1.4.1.318.1.1.26.10.2.2.1.10", Scale: 1},
+	},
+	"eaton": {
+		{Context: "current", Prefix: "input", OID: "1.3.6.1.4.1.534.6.6.7.3.3.1.4", Scale: 0.001, SkipIndex: 1},
+		{Context: "voltage", Prefix: "input", OID: "1.3.6.1.4.1.534.6.6.7.3.2.1.3", Scale: 0.001, SkipIndex: 1},
+		{Context: "current", Prefix: "outlet", OID: "1.3.6.1.4.1.534.6.6.7.6.4.1.3", Scale: 0.001, SkipIndex: 1},
+		{Context: "temperature", Prefix: "sensor", OID: "1.3.6.1.4.1.534.6.6.7.7.1.1.4", Scale: 0.1, SkipIndex: 1},
+		{Context: "humidity", Prefix: "sensor", OID: "1.3.6.1.4.1.534.6.6.7.7.2.1.4", Scale: 0.1, SkipIndex: 1},
+	},
+	"raritan": {
+		{Context: "current", Prefix: "inlet", OID: "1.3.6.1.4.1.13742.6.5.2.3.1.4", SkipIndex: 1, IndexSuffix: "1",
+			DigitsOID: "1.3.6.1.4.1.13742.6.3.3.4.1.7"},
+		{Context: "voltage", Prefix: "inlet", OID: "1.3.6.1.4.1.13742.6.5.2.3.1.4", SkipIndex: 1, IndexSuffix: "4",
+			DigitsOID: "1.3.6.1.4.1.13742.6.3.3.4.1.7"},
+		{Context: "current", Prefix: "outlet", OID: "1.3.6.1.4.1.13742.6.5.4.3.1.4", SkipIndex: 1, IndexSuffix: "1",
+			DigitsOID: "1.3.6.1.4.1.13742.6.3.5.4.1.7"},
+		{Context: "temperature", Prefix: "sensor", OID: "1.3.6.1.4.1.13742.6.5.5.3.1.4", SkipIndex: 1,
+			TypeOID: "1.3.6.1.4.1.13742.6.3.6.3.1.2", TypeValue: 10, DigitsOID: "1.3.6.1.4.1.13742.6.3.6.3.1.17"},
+		{Context: "humidity", Prefix: "sensor", OID: "1.3.6.1.4.1.13742.6.5.5.3.1.4", SkipIndex: 1,
+			TypeOID: "1.3.6.1.4.1.13742.6.3.6.3.1.2", TypeValue: 11, DigitsOID: "1.3.6.1.4.1.13742.6.3.6.3.1.17"},
+	},
+}
+
+var sensorColumnPattern = regexp.MustCompile(`^([a-z][a-z0-9_]*)=\.?([0-9]+(?:\.[0-9]+)+)(?:\*([0-9.eE+-]+))?$`)
+
+func newSensorPlugin() *sensorPlugin {
+	return &sensorPlugin{
+		Plugin: nagocheck.NewPlugin("sensor",
+			nagocheck.PluginDescription("PDU/Environment Sensors"),
+			nagocheck.PluginHysteresis(true),
+			nagocheck.PluginDefaultThresholds(false),
+		),
+	}
+}
+
+func (p *sensorPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("profile", "Selects a ready-made set of OIDs for a common PDU or environmental sensor, exposing the "+
+		"contexts current, voltage, temperature and humidity. Thresholds are set per context using --threshold, e.g. "+
+		"--threshold temperature=warn:~:30:crit:~:35.").
+		Short('P').EnumVar(&p.Profile, sensorProfileNames()...)
+
+	node.Flag("oid", "Additional table column or scalar to monitor, formatted as <context>=<oid>[*<scale>], e.g. "+
+		"temperature=1.3.6.1.4.1.99.1.2*0.1. Can be specified multiple times.").
+		PlaceHolder("CONTEXT=OID").SetValue(&sensorColumnsValue{&p.Columns})
+}
+
+func (p *sensorPlugin) DefineCheck() nagopher.Check {
+	check := nagopher.NewCheck("sensor", newSensorSummarizer(p))
+	check.AttachResources(newSensorResource(p))
+
+	for _, contextName := range p.contextNames() {
+		check.AttachContexts(nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(contextName, nil, nil)))
+	}
+
+	return check
+}
+
+// AllColumns returns the columns of the selected profile followed by all additional columns given by --oid
+func (p *sensorPlugin) AllColumns() []sensorColumn {
+	columns := append([]sensorColumn{}, sensorProfiles[p.Profile]...)
+	return append(columns, p.Columns...)
+}
+
+func (p *sensorPlugin) contextNames() (names []string) {
+	seen := make(map[string]bool)
+	for _, column := range p.AllColumns() {
+		if !seen[column.Context] {
+			seen[column.Context] = true
+			names = append(names, column.Context)
+		}
+	}
+
+	return names
+}
+
+func (p *sensorPlugin) ThisModule() *snmpModule {
+	return p.Plugin.Module().(*snmpModule)
+}
+
+func sensorProfileNames() (names []string) {
+	for name := range sensorProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func newSensorResource(plugin *sensorPlugin) *sensorResource {
+	return &sensorResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *sensorResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	for _, reading := range r.readings {
+		metrics = append(metrics, nagopher.MustNewNumericMetric(
+			reading.name, reading.value, reading.unit, nil, reading.context,
+		))
+	}
+
+	return metrics, nil
+}
+
+func (r *sensorResource) Collect() error {
+	plugin := r.ThisPlugin()
+	columns := plugin.AllColumns()
+	if len(columns) == 0 {
+		return fmt.Errorf("either --profile or --oid must be specified")
+	}
+
+	// Walk each column only once, as several profile columns may share the same value, type or digits column
+	walks := make(map[string][]snmp.Variable)
+	walk := func(oid string) ([]snmp.Variable, error) {
+		if variables, ok := walks[oid]; ok {
+			return variables, nil
+		}
+
+		variables, err := plugin.ThisModule().client.Walk(oid)
+		if err != nil {
+			return nil, fmt.Errorf("could not walk [%s]: %s", oid, err.Error())
+		}
+
+		walks[oid] = variables
+		return variables, nil
+	}
+
+	r.readings = nil
+	for _, column := range columns {
+		readings, err := collectSensorColumn(column, walk)
+		if err != nil {
+			return err
+		}
+		r.readings = append(r.readings, readings...)
+	}
+
+	if len(r.readings) == 0 {
+		if plugin.Profile != "" {
+			return fmt.Errorf("agent does not provide any sensors of profile [%s]", plugin.Profile)
+		}
+		return fmt.Errorf("agent does not provide any of the given OIDs")
+	}
+
+	return nil
+}
+
+func (r *sensorResource) ThisPlugin() *sensorPlugin {
+	return r.Resource.Plugin().(*sensorPlugin)
+}
+
+// collectSensorColumn walks the given column and converts each row into a reading, where scalars (OIDs ending with
+// the instance '.0') are being exposed without index
+func collectSensorColumn(column sensorColumn, walk func(oid string) ([]snmp.Variable, error)) ([]sensorReading, error) {
+	variables, err := walk(column.OID)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := sensorColumnIndex(column.TypeOID, walk)
+	if err != nil {
+		return nil, err
+	}
+	digits, err := sensorColumnIndex(column.DigitsOID, walk)
+	if err != nil {
+		return nil, err
+	}
+
+	var readings []sensorReading
+	for _, variable := range variables {
+		if !variable.Exists() {
+			continue
+		}
+
+		index := strings.TrimPrefix(strings.TrimPrefix(variable.OID, strings.TrimPrefix(column.OID, ".")), ".")
+		if column.TypeOID != "" && types[index] != column.TypeValue {
+			continue
+		}
+
+		value, err := variable.Float()
+		if err != nil {
+			return nil, fmt.Errorf("could not parse [%s]: %s", variable.OID, err.Error())
+		}
+		if column.DigitsOID != "" {
+			value /= math.Pow10(int(digits[index]))
+		} else if column.Scale != 0 {
+			value *= column.Scale
+		}
+		// Strip floating point noise introduced by scaling, e.g. 284 * 0.1 = 28.400000000000002
+		value = math.Round(value*1e6) / 1e6
+
+		name, ok := sensorMetricName(column, index)
+		if !ok {
+			continue
+		}
+
+		unit := column.Unit
+		if unit == "" {
+			unit = sensorContextUnits[column.Context]
+		}
+
+		readings = append(readings, sensorReading{name: name, context: column.Context, unit: unit, value: value})
+	}
+
+	return readings, nil
+}
+
+// sensorColumnIndex walks the given column and returns its integer values keyed by their index
+func sensorColumnIndex(oid string, walk func(oid string) ([]snmp.Variable, error)) (map[string]int64, error) {
+	values := make(map[string]int64)
+	if oid == "" {
+		return values, nil
+	}
+
+	variables, err := walk(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, variable := range variables {
+		if !variable.Exists() {
+			continue
+		}
+
+		value, err := variable.Int()
+		if err != nil {
+			return nil, fmt.Errorf("could not parse [%s]: %s", variable.OID, err.Error())
+		}
+
+		index := strings.TrimPrefix(strings.TrimPrefix(variable.OID, strings.TrimPrefix(oid, ".")), ".")
+		values[index] = value
+	}
+
+	return values, nil
+}
+
+// sensorMetricName builds the metric name for the given row index, returning false in case the row has been excluded
+// by the index suffix of the column
+func sensorMetricName(column sensorColumn, index string) (string, bool) {
+	if index == "" || index == "0" {
+		return column.Context, true
+	}
+
+	components := strings.Split(index, ".")
+	if column.IndexSuffix != "" {
+		suffix := strings.Split(column.IndexSuffix, ".")
+		if len(components) <= len(suffix) ||
+			strings.Join(components[len(components)-len(suffix):], ".") != column.IndexSuffix {
+			return "", false
+		}
+		components = components[:len(components)-len(suffix)]
+	}
+	if column.SkipIndex > 0 && len(components) > column.SkipIndex {
+		components = components[column.SkipIndex:]
+	}
+
+	if column.Prefix == "" {
+		return fmt.Sprintf("%s_%s", column.Context, strings.Join(components, "_")), true
+	}
+
+	return fmt.Sprintf("%s_%s_%s", column.Prefix, strings.Join(components, "_"), column.Context), true
+}
+
+func (v *sensorColumnsValue) Set(rawValue string) error {
+	match := sensorColumnPattern.FindStringSubmatch(strings.TrimSpace(rawValue))
+	if match == nil {
+		return fmt.Errorf("sensor OID [%s] must be formatted as <context>=<oid>[*<scale>]", rawValue)
+	}
+
+	column := sensorColumn{Context: match[1], OID: match[2], Scale: 1}
+	if match[3] != "" {
+		scale, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			return fmt.Errorf("sensor OID [%s] has invalid scale: %s", rawValue, err.Error())
+		}
+		column.Scale = scale
+	}
+
+	*v.value = append(*v.value, column)
+	return nil
+}
+
+func (v *sensorColumnsValue) String() string {
+	var parts []string
+	for _, column := range *v.value {
+		parts = append(parts, fmt.Sprintf("%s=%s*%s", column.Context, column.OID,
+			strconv.FormatFloat(column.Scale, 'f', -1, 64)))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (v *sensorColumnsValue) IsCumulative() bool {
+	return true
+}
+
+func newSensorSummarizer(plugin *sensorPlugin) *sensorSummarizer {
+	return &sensorSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin, nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength)),
+	}
+}
+
+func (s *sensorSummarizer) Ok(check nagopher.Check) string {
+	counts := make(map[string]int)
+	for _, result := range check.Results().Get() {
+		if metric, err := result.Metric().Get(); err == nil {
+			counts[metric.ContextName()]++
+		}
+	}
+
+	var parts []string
+	for _, contextName := range s.Plugin().(*sensorPlugin).contextNames() {
+		if counts[contextName] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[contextName], contextName))
+		}
+	}
+
+	return fmt.Sprintf("%s sensors are within thresholds", strings.Join(parts, ", "))
+}
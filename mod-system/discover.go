@@ -0,0 +1,69 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"net"
+	"regexp"
+)
+
+// DiscoverServices enumerates all interfaces which are up, all mounted filesystems matching the default filters of
+// the disk plugin as well as md arrays and zfs pools, which are each monitored by a single service if present
+func (m *systemModule) DiscoverServices() ([]nagocheck.DiscoveredService, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("could not list interfaces: %s", err.Error())
+	}
+
+	var services []nagocheck.DiscoveredService
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+
+		services = append(services, nagocheck.DiscoveredService{
+			Plugin: "interface", Name: iface.Name, Args: []string{iface.Name},
+		})
+	}
+
+	diskPlugin := newDiskPlugin()
+	diskPlugin.ExcludeFsType = regexp.MustCompile(defaultDiskExcludeFsType)
+	diskResource := newDiskResource(diskPlugin)
+	if err := diskResource.Collect(nagopher.NewWarningCollection()); err == nil {
+		for _, filesystem := range diskResource.filesystems {
+			services = append(services, nagocheck.DiscoveredService{
+				Plugin: "disk", Name: mountpointMetricName(filesystem.mountpoint), Args: []string{filesystem.mountpoint},
+			})
+		}
+	}
+
+	mdraidResource := newMdraidResource(newMdraidPlugin())
+	if err := mdraidResource.Collect(nagopher.NewWarningCollection()); err == nil && len(mdraidResource.arrays) > 0 {
+		services = append(services, nagocheck.DiscoveredService{Plugin: "mdraid"})
+	}
+
+	zfsResource := newZfsResource(newZfsPlugin())
+	if err := zfsResource.Collect(nagopher.NewWarningCollection()); err == nil && len(zfsResource.poolStats) > 0 {
+		services = append(services, nagocheck.DiscoveredService{Plugin: "zfs"})
+	}
+
+	return services, nil
+}
@@ -0,0 +1,324 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"fmt"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const defaultDiskExcludeFsType = "^(tmpfs|devtmpfs|ramfs|overlay|squashfs|iso9660|udf)$"
+
+type diskPlugin struct {
+	nagocheck.Plugin
+
+	Mountpoints   []string
+	Discovery     *nagocheck.AutoDiscovery
+	FsType        *regexp.Regexp
+	ExcludeFsType *regexp.Regexp
+	ExcludeMount  *regexp.Regexp
+	FreeWarning   nagopher.OptionalBounds
+	FreeCritical  nagopher.OptionalBounds
+	InodeWarning  nagopher.OptionalBounds
+	InodeCritical nagopher.OptionalBounds
+}
+
+type diskResource struct {
+	nagocheck.Resource
+
+	filesystems []diskFilesystem
+}
+
+type diskSummarizer struct {
+	nagocheck.Summarizer
+}
+
+// diskFilesystem contains the space and inode usage of a single mounted filesystem, where inodeUsage is NaN for
+// filesystems without a fixed amount of inodes like btrfs or NTFS
+type diskFilesystem struct {
+	mountpoint string
+	fsType     string
+	usage      float64
+	totalBytes float64
+	freeBytes  float64
+	inodeUsage float64
+}
+
+func newDiskPlugin() *diskPlugin {
+	return &diskPlugin{
+		Plugin: nagocheck.NewPlugin("disk",
+			nagocheck.PluginDescription("Filesystem Usage"),
+			nagocheck.PluginHysteresis(true),
+			nagocheck.PluginCapacityContexts("usage", "inodes"),
+			nagocheck.PluginHistory(true),
+		),
+		Discovery: nagocheck.NewAutoDiscovery("filesystems", true),
+	}
+}
+
+func (p *diskPlugin) DefineFlags(kp nagocheck.KingpinNode) {
+	kp.Arg("mountpoint", "Mountpoints of the filesystems which should be checked. Defaults to all mounted "+
+		"filesystems, which can be narrowed down using the filesystem type and mountpoint patterns.").
+		StringsVar(&p.Mountpoints)
+
+	p.Discovery.DefineFlags(kp)
+
+	kp.Flag("fs-type", "Regular expression matching the types of filesystems which should be checked, e.g. "+
+		"'^(ext4|xfs)$'. Only applies when no mountpoints have been given.").
+		RegexpVar(&p.FsType)
+
+	kp.Flag("exclude-fs-type", "Regular expression matching the types of filesystems which should be ignored. Only "+
+		"applies when no mountpoints have been given.").
+		Default(defaultDiskExcludeFsType).RegexpVar(&p.ExcludeFsType)
+
+	kp.Flag("exclude-mount", "Regular expression matching the mountpoints which should be ignored, e.g. "+
+		"'^/(snap|run)/'. Only applies when no mountpoints have been given.").
+		RegexpVar(&p.ExcludeMount)
+
+	nagocheck.SizeBoundsVar(kp.Flag("free-warning", "Warning threshold for free space per filesystem formatted as "+
+		"Nagios range specifier, using sizes like 10GB: or 2GiB: (bytes by default)."), &p.FreeWarning)
+	nagocheck.SizeBoundsVar(kp.Flag("free-critical", "Critical threshold for free space per filesystem formatted as "+
+		"Nagios range specifier, using sizes like 10GB: or 2GiB: (bytes by default)."), &p.FreeCritical)
+
+	nagocheck.NagopherBoundsVar(kp.Flag("inode-warning", "Warning threshold for inode usage in percent per "+
+		"filesystem formatted as Nagios range specifier.").Default("90"), &p.InodeWarning)
+	nagocheck.NagopherBoundsVar(kp.Flag("inode-critical", "Critical threshold for inode usage in percent per "+
+		"filesystem formatted as Nagios range specifier.").Default("95"), &p.InodeCritical)
+}
+
+func (p *diskPlugin) DefineCheck() nagopher.Check {
+	check := nagopher.NewCheck("disk", newDiskSummarizer(p))
+	check.AttachResources(newDiskResource(p))
+	check.AttachContexts(
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"usage",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+		nagopher.NewScalarContext("free",
+			nagopher.OptionalBoundsPtr(p.FreeWarning),
+			nagopher.OptionalBoundsPtr(p.FreeCritical),
+		),
+		nagopher.NewScalarContext("inodes",
+			nagopher.OptionalBoundsPtr(p.InodeWarning),
+			nagopher.OptionalBoundsPtr(p.InodeCritical),
+		),
+	)
+
+	return check
+}
+
+func newDiskResource(plugin *diskPlugin) *diskResource {
+	return &diskResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+// Probe emits the space usage of each filesystem as metric named after its mountpoint, so that thresholds for single
+// filesystems can be passed as e.g. --instance-threshold var_log=w:90,c:95 for /var/log
+func (r *diskResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	percentRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(100))
+	sizeRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(math.Inf(1)))
+
+	if err := r.Collect(warnings); err != nil {
+		return metrics, err
+	}
+
+	for _, filesystem := range r.filesystems {
+		name := mountpointMetricName(filesystem.mountpoint)
+		filesystemMetrics := []nagopher.Metric{
+			nagopher.MustNewNumericMetric(name, filesystem.usage, "%", &percentRange, "usage"),
+			nagopher.MustNewNumericMetric(name+"_free", filesystem.freeBytes, "B", &sizeRange, "free"),
+		}
+		if !math.IsNaN(filesystem.inodeUsage) {
+			filesystemMetrics = append(filesystemMetrics,
+				nagopher.MustNewNumericMetric(name+"_inodes", filesystem.inodeUsage, "%", &percentRange, "inodes"))
+		}
+
+		metrics = append(metrics, r.Section(filesystem.mountpoint, filesystemMetrics...)...)
+	}
+
+	return metrics, nil
+}
+
+// Collect fetches the usage of all requested filesystems. Filesystems without any blocks like procfs or cgroups are
+// always being skipped, just like inaccessible filesystems unless their mountpoint has been requested explicitly.
+func (r *diskResource) Collect(warnings nagopher.WarningCollection) error {
+	plugin := r.ThisPlugin()
+	if err := plugin.Discovery.Validate(plugin.Mountpoints); err != nil {
+		return err
+	}
+
+	partitions, err := disk.Partitions(true)
+	if err != nil {
+		return fmt.Errorf("could not list mounted filesystems: %s", err.Error())
+	}
+
+	// Later entries within the mount table hide earlier filesystems with the same mountpoint
+	mounts := make(map[string]disk.PartitionStat)
+	for _, partition := range partitions {
+		mounts[partition.Mountpoint] = partition
+	}
+
+	mountpoints := plugin.Mountpoints
+	if plugin.Discovery.Active(plugin.Mountpoints) {
+		var present []string
+		for mountpoint, partition := range mounts {
+			if r.isRequested(partition) {
+				present = append(present, mountpoint)
+			}
+		}
+		mountpoints = plugin.Discovery.Select(plugin.Mountpoints, present)
+	}
+
+	// Filesystems are queried concurrently, so that e.g. a hanging network filesystem only fails itself on timeout
+	results := nagocheck.RunConcurrently(len(mountpoints), 0, func(index int) (interface{}, error) {
+		partition, ok := mounts[mountpoints[index]]
+		if !ok {
+			return nil, fmt.Errorf("no filesystem mounted at [%s]", mountpoints[index])
+		}
+
+		return disk.Usage(partition.Mountpoint)
+	})
+
+	r.filesystems = nil
+	for index, mountpoint := range mountpoints {
+		usage, err := results[index].Value, results[index].Err
+		if err != nil {
+			if len(plugin.Mountpoints) != 0 {
+				return fmt.Errorf("could not get usage of [%s]: %s", mountpoint, err.Error())
+			}
+			warnings.Add(nagocheck.PartialFailure("could not get usage of [%s]: %s", mountpoint, err.Error()))
+			continue
+		}
+
+		filesystem, ok := newDiskFilesystem(mounts[mountpoint], usage.(*disk.UsageStat))
+		if !ok {
+			if len(plugin.Mountpoints) != 0 {
+				return fmt.Errorf("filesystem mounted at [%s] has no capacity", mountpoint)
+			}
+			continue
+		}
+
+		r.filesystems = append(r.filesystems, filesystem)
+	}
+
+	if len(r.filesystems) == 0 {
+		return fmt.Errorf("no filesystems available")
+	}
+
+	return nil
+}
+
+// newDiskFilesystem builds a filesystem out of the given usage, returning false for filesystems without any blocks
+func newDiskFilesystem(partition disk.PartitionStat, usage *disk.UsageStat) (diskFilesystem, bool) {
+	if usage.Total == 0 {
+		return diskFilesystem{}, false
+	}
+
+	filesystem := diskFilesystem{
+		mountpoint: partition.Mountpoint,
+		fsType:     partition.Fstype,
+		usage:      nagocheck.Round(usage.UsedPercent, 2),
+		totalBytes: float64(usage.Total),
+		freeBytes:  float64(usage.Free),
+		inodeUsage: math.NaN(),
+	}
+	if usage.InodesTotal > 0 {
+		filesystem.inodeUsage = nagocheck.Round(usage.InodesUsedPercent, 2)
+	}
+
+	return filesystem, true
+}
+
+func (r *diskResource) isRequested(partition disk.PartitionStat) bool {
+	plugin := r.ThisPlugin()
+	if plugin.FsType != nil && !plugin.FsType.MatchString(partition.Fstype) {
+		return false
+	}
+	if plugin.ExcludeFsType != nil && plugin.ExcludeFsType.MatchString(partition.Fstype) {
+		return false
+	}
+	if plugin.ExcludeMount != nil && plugin.ExcludeMount.MatchString(partition.Mountpoint) {
+		return false
+	}
+
+	return true
+}
+
+// mountpointMetricName converts a mountpoint into a metric name, e.g. '/var/log' into 'var_log' and '/' into 'root'
+func mountpointMetricName(mountpoint string) string {
+	name := strings.Trim(strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, mountpoint), "_")
+
+	if name == "" {
+		return "root"
+	}
+
+	return name
+}
+
+func (r *diskResource) ThisPlugin() *diskPlugin {
+	return r.Resource.Plugin().(*diskPlugin)
+}
+
+func newDiskSummarizer(plugin *diskPlugin) *diskSummarizer {
+	return &diskSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *diskSummarizer) Ok(check nagopher.Check) string {
+	filesystems, fullestName, fullestUsage := 0, "", -1.0
+	for _, result := range check.Results().Get() {
+		metric, err := result.Metric().Get()
+		if err != nil || metric.ContextName() != "usage" {
+			continue
+		}
+
+		filesystems++
+		numericMetric, ok := metric.(nagopher.NumericMetric)
+		if !ok || numericMetric.Value() <= fullestUsage {
+			continue
+		}
+
+		fullestName, fullestUsage = metric.Name(), numericMetric.Value()
+		if resource, ok := result.Resource().OrElse(nil).(nagocheck.Resource); ok {
+			fullestName = resource.SectionOf(metric)
+		}
+	}
+
+	if filesystems == 1 {
+		return fmt.Sprintf("%s is %.2f%% used", fullestName, fullestUsage)
+	}
+
+	return fmt.Sprintf("%d filesystems checked, fullest is %s with %.2f%% used", filesystems, fullestName,
+		fullestUsage)
+}
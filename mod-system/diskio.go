@@ -0,0 +1,288 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"fmt"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type diskioPlugin struct {
+	nagocheck.Plugin
+
+	DeviceNames   []string
+	Exclude       *regexp.Regexp
+	AwaitWarning  nagopher.OptionalBounds
+	AwaitCritical nagopher.OptionalBounds
+}
+
+type diskioResource struct {
+	nagocheck.Resource `json:"-"`
+
+	devices []diskioDevice
+
+	Rates nagocheck.RateStates `json:"rates"`
+}
+
+type diskioSummarizer struct {
+	nagocheck.Summarizer
+}
+
+// diskioDevice contains the raw I/O counters of a block device as reported by the kernel. Rates are computed out of
+// them by rate contexts, while the average time spent per request (await) is computed by the resource itself.
+type diskioDevice struct {
+	name       string
+	readCount  uint64
+	writeCount uint64
+	readBytes  uint64
+	writeBytes uint64
+	ioTime     uint64
+	await      float64
+	hasAwait   bool
+}
+
+func newDiskioPlugin() *diskioPlugin {
+	return &diskioPlugin{
+		Plugin: nagocheck.NewPlugin("diskio",
+			nagocheck.PluginDescription("Disk I/O Statistics"),
+			nagocheck.PluginHysteresis(true),
+			nagocheck.PluginHistory(true),
+		),
+	}
+}
+
+func (p *diskioPlugin) DefineFlags(kp nagocheck.KingpinNode) {
+	kp.Arg("device", "Names of the block devices which should be checked, e.g. sda or nvme0n1. Defaults to all "+
+		"whole disks, excluding partitions.").
+		StringsVar(&p.DeviceNames)
+
+	kp.Flag("exclude", "Regular expression matching the names of block devices which should be ignored. Only "+
+		"applies when no devices have been given.").
+		Default("^(loop|ram|zram|sr|fd)[0-9]*$").RegexpVar(&p.Exclude)
+
+	nagocheck.NagopherBoundsVar(kp.Flag("await-warning", "Warning threshold for the average latency per request "+
+		"in milliseconds formatted as Nagios range specifier."), &p.AwaitWarning)
+	nagocheck.NagopherBoundsVar(kp.Flag("await-critical", "Critical threshold for the average latency per request "+
+		"in milliseconds formatted as Nagios range specifier."), &p.AwaitCritical)
+}
+
+func (p *diskioPlugin) DefineCheck() nagopher.Check {
+	resource := newDiskioResource(p)
+	check := nagopher.NewCheck("diskio", newDiskioSummarizer(p))
+	check.AttachResources(resource)
+	check.AttachContexts(
+		nagocheck.NewHysteresisContext(p, nagocheck.NewRateContext(p, "utilization", &resource.Rates,
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+			nagocheck.RateScale(0.1, "%"),
+		)),
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"await",
+			nagopher.OptionalBoundsPtr(p.AwaitWarning),
+			nagopher.OptionalBoundsPtr(p.AwaitCritical),
+		)),
+		nagocheck.NewRateContext(p, "iops", &resource.Rates, nil, nil),
+		nagocheck.NewRateContext(p, "throughput", &resource.Rates, nil, nil),
+		nagopher.NewScalarContext("devices", nil, nil),
+	)
+
+	return check
+}
+
+func newDiskioResource(plugin *diskioPlugin) *diskioResource {
+	persistenceKey := "all"
+	if len(plugin.DeviceNames) > 0 {
+		persistenceKey = strings.Join(plugin.DeviceNames, "_")
+	}
+
+	resource := &diskioResource{}
+	resource.Resource = nagocheck.NewResource(plugin,
+		nagocheck.ResourcePersistence(persistenceKey, resource, &resource),
+	)
+
+	return resource
+}
+
+// PersistenceVersion has been increased after replacing the previous counters by the states of the rate contexts
+func (r *diskioResource) PersistenceVersion() int {
+	return 2
+}
+
+// Probe returns the raw counters of all devices, which get evaluated as per-second rates by the rate contexts. The
+// busy time in milliseconds results in the utilization percentage of the device.
+func (r *diskioResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(math.Inf(1)))
+
+	deviceCount, err := r.Collect()
+	if err != nil {
+		return metrics, err
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("devices", float64(deviceCount), "", &valueRange, "devices"))
+
+	for _, device := range r.devices {
+		deviceMetrics := []nagopher.Metric{
+			nagopher.MustNewNumericMetric(device.name+"_reads", float64(device.readCount), "", &valueRange, "iops"),
+			nagopher.MustNewNumericMetric(device.name+"_writes", float64(device.writeCount), "", &valueRange,
+				"iops"),
+			nagopher.MustNewNumericMetric(device.name+"_read_bytes", float64(device.readBytes), "B", &valueRange,
+				"throughput"),
+			nagopher.MustNewNumericMetric(device.name+"_write_bytes", float64(device.writeBytes), "B", &valueRange,
+				"throughput"),
+			nagopher.MustNewNumericMetric(device.name+"_util", float64(device.ioTime), "ms", &valueRange,
+				"utilization"),
+		}
+		if device.hasAwait {
+			deviceMetrics = append(deviceMetrics,
+				nagopher.MustNewNumericMetric(device.name+"_await", device.await, "ms", &valueRange, "await"))
+		}
+
+		metrics = append(metrics, r.Section(device.name, deviceMetrics...)...)
+	}
+
+	return metrics, nil
+}
+
+// Collect reads the current counters of all requested block devices, returning the amount of devices. The average
+// time per request can only be computed starting with the second sample and is skipped for devices whose counters
+// have been reset in the meantime, which gets reported by the rate contexts.
+func (r *diskioResource) Collect() (int, error) {
+	plugin := r.ThisPlugin()
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return 0, fmt.Errorf("could not get disk I/O counters: %s", err.Error())
+	}
+
+	deviceNames := plugin.DeviceNames
+	if len(deviceNames) == 0 {
+		for name := range counters {
+			if isWholeDisk(name) && (plugin.Exclude == nil || !plugin.Exclude.MatchString(name)) {
+				deviceNames = append(deviceNames, name)
+			}
+		}
+		sort.Strings(deviceNames)
+	}
+	if len(deviceNames) == 0 {
+		return 0, fmt.Errorf("no block devices available")
+	}
+
+	if r.Rates == nil {
+		r.Rates = make(nagocheck.RateStates)
+	}
+
+	r.devices = nil
+	now := time.Now().UnixNano()
+	for _, name := range deviceNames {
+		stat, ok := counters[name]
+		if !ok {
+			return 0, fmt.Errorf("no I/O counters available for block device [%s]", name)
+		}
+
+		device := diskioDevice{
+			name:       name,
+			readCount:  stat.ReadCount,
+			writeCount: stat.WriteCount,
+			readBytes:  stat.ReadBytes,
+			writeBytes: stat.WriteBytes,
+			ioTime:     stat.IoTime,
+		}
+
+		requests := nagocheck.RateState{Value: float64(stat.ReadCount + stat.WriteCount), Timestamp: now}
+		requestTime := nagocheck.RateState{Value: float64(stat.ReadTime + stat.WriteTime), Timestamp: now}
+		previousRequests, hasRequests := r.Rates[name+"_requests"]
+		previousRequestTime, hasRequestTime := r.Rates[name+"_request_time"]
+		r.Rates[name+"_requests"], r.Rates[name+"_request_time"] = requests, requestTime
+
+		if hasRequests && hasRequestTime && requests.Value >= previousRequests.Value &&
+			requestTime.Value >= previousRequestTime.Value {
+			device.hasAwait = true
+			if requests.Value > previousRequests.Value {
+				device.await = nagocheck.Round(
+					(requestTime.Value-previousRequestTime.Value)/(requests.Value-previousRequests.Value), 2)
+			}
+		}
+
+		r.devices = append(r.devices, device)
+	}
+
+	return len(deviceNames), nil
+}
+
+func (r *diskioResource) ThisPlugin() *diskioPlugin {
+	return r.Resource.Plugin().(*diskioPlugin)
+}
+
+func newDiskioSummarizer(plugin *diskioPlugin) *diskioSummarizer {
+	return &diskioSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *diskioSummarizer) Ok(check nagopher.Check) string {
+	var iops, throughput, busiestUtilization float64
+	var devices, busiestName string
+	for _, result := range check.Results().Get() {
+		metric, err := result.Metric().Get()
+		if err != nil {
+			continue
+		}
+
+		// Rates are only included once available, as the raw counters are being passed through until then
+		numericMetric, ok := metric.(nagopher.NumericMetric)
+		if !ok || math.IsNaN(numericMetric.Value()) ||
+			(metric.ContextName() != "devices" && !strings.HasSuffix(metric.Name(), "_rate")) {
+			continue
+		}
+
+		switch metric.ContextName() {
+		case "devices":
+			devices = metric.ValueString()
+		case "iops":
+			iops += numericMetric.Value()
+		case "throughput":
+			throughput += numericMetric.Value()
+		case "utilization":
+			if busiestName == "" || numericMetric.Value() > busiestUtilization {
+				busiestName = strings.TrimSuffix(metric.Name(), "_util_rate")
+				busiestUtilization = numericMetric.Value()
+			}
+		}
+	}
+
+	if devices == "1" {
+		devices += " device"
+	} else {
+		devices += " devices"
+	}
+	if busiestName == "" {
+		return fmt.Sprintf("%s, waiting for second sample", devices)
+	}
+
+	return fmt.Sprintf("%s - %.2f IOPS, %s/s, busiest is %s with %.2f%% utilization", devices, iops,
+		nagocheck.FormatBinarySize(throughput), busiestName, busiestUtilization)
+}
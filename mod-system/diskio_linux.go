@@ -0,0 +1,34 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+	"os"
+)
+
+// isWholeDisk returns true if the given block device is not a partition, as only whole disks are listed within
+// /sys/block. All devices are considered whole disks if sysfs is unavailable.
+func isWholeDisk(name string) bool {
+	if _, err := os.Stat(nagocheck.SysPath("block")); err != nil {
+		return true
+	}
+
+	_, err := os.Stat(nagocheck.SysPath("block", name))
+	return err == nil
+}
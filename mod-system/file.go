@@ -0,0 +1,326 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"io"
+	"math"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type filePlugin struct {
+	nagocheck.Plugin
+
+	Path         string
+	Absent       bool
+	AgeWarning   nagopher.OptionalBounds
+	AgeCritical  nagopher.OptionalBounds
+	SizeWarning  nagopher.OptionalBounds
+	SizeCritical nagopher.OptionalBounds
+	Checksum     string
+	Mode         string
+	Owner        string
+	Group        string
+}
+
+type fileResource struct {
+	nagocheck.Resource
+
+	info     os.FileInfo
+	checksum string
+	owner    string
+	group    string
+}
+
+type fileSummarizer struct {
+	nagocheck.Summarizer
+
+	resource *fileResource
+}
+
+func newFilePlugin() *filePlugin {
+	return &filePlugin{
+		Plugin: nagocheck.NewPlugin("file",
+			nagocheck.PluginDescription("File"),
+		),
+	}
+}
+
+func (p *filePlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("path", "Path to the file or directory which should be checked.").
+		Required().StringVar(&p.Path)
+
+	node.Flag("absent", "Return CRITICAL if the path exists instead of if it does not exist, e.g. for lock files or "+
+		"maintenance markers.").
+		BoolVar(&p.Absent)
+
+	nagocheck.DurationBoundsVar(node.Flag("age-warning", "Warning threshold for the time since the last "+
+		"modification, formatted as Nagios range specifier using durations like 24h."), &p.AgeWarning)
+
+	nagocheck.DurationBoundsVar(node.Flag("age-critical", "Critical threshold for the time since the last "+
+		"modification, formatted as Nagios range specifier using durations like 26h."), &p.AgeCritical)
+
+	nagocheck.SizeBoundsVar(node.Flag("size-warning", "Warning threshold for the file size, formatted as Nagios "+
+		"range specifier using sizes like 10MB: for requiring at least 10MB."), &p.SizeWarning)
+
+	nagocheck.SizeBoundsVar(node.Flag("size-critical", "Critical threshold for the file size, formatted as Nagios "+
+		"range specifier using sizes like 10MB: for requiring at least 10MB."), &p.SizeCritical)
+
+	node.Flag("sha256", "Return CRITICAL unless the SHA256 checksum of the file matches the given hex digest.").
+		StringVar(&p.Checksum)
+
+	node.Flag("mode", "Return CRITICAL unless the permission bits of the path match the given octal mode, e.g. 0640.").
+		StringVar(&p.Mode)
+
+	node.Flag("owner", "Return CRITICAL unless the path is owned by the given user name or UID.").
+		StringVar(&p.Owner)
+
+	node.Flag("group", "Return CRITICAL unless the path is owned by the given group name or GID.").
+		StringVar(&p.Group)
+}
+
+func (p *filePlugin) DefineCheck() nagopher.Check {
+	expectedState := "PRESENT"
+	if p.Absent {
+		expectedState = "MISSING"
+	}
+
+	resource := newFileResource(p)
+	check := nagopher.NewCheck("file", newFileSummarizer(p, resource))
+	check.AttachResources(resource)
+	check.AttachContexts(
+		nagocheck.NewExpectContext("state", nagopher.StateCritical(), expectedState),
+		nagopher.NewScalarContext("age",
+			nagopher.OptionalBoundsPtr(p.AgeWarning),
+			nagopher.OptionalBoundsPtr(p.AgeCritical),
+		),
+		nagopher.NewScalarContext("size",
+			nagopher.OptionalBoundsPtr(p.SizeWarning),
+			nagopher.OptionalBoundsPtr(p.SizeCritical),
+		),
+		nagocheck.NewExpectContext("sha256", nagopher.StateCritical(), strings.ToLower(p.Checksum)),
+		nagocheck.NewExpectContext("mode", nagopher.StateCritical(), p.normalizedMode()),
+		nagocheck.NewExpectContext("owner", nagopher.StateCritical(), p.Owner),
+		nagocheck.NewExpectContext("group", nagopher.StateCritical(), p.Group),
+	)
+
+	return check
+}
+
+// normalizedMode returns the expected mode as four-digit octal number, so that e.g. '640' and '0640' are equal. Invalid
+// modes are returned as-is and rejected when collecting.
+func (p *filePlugin) normalizedMode() string {
+	mode, err := strconv.ParseUint(p.Mode, 8, 32)
+	if err != nil {
+		return p.Mode
+	}
+
+	return formatFileMode(os.FileMode(mode))
+}
+
+func newFileResource(plugin *filePlugin) *fileResource {
+	return &fileResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *fileResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	plugin := r.ThisPlugin()
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0))
+
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	if r.info == nil {
+		return append(metrics, nagopher.MustNewStringMetric("state", "MISSING", "state")), nil
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewStringMetric("state", "PRESENT", "state"),
+		nagopher.MustNewNumericMetric("age", math.Max(0, math.Floor(time.Since(r.info.ModTime()).Seconds())),
+			"s", &valueRange, "age"),
+	)
+	if !r.info.IsDir() {
+		metrics = append(metrics,
+			nagopher.MustNewNumericMetric("size", float64(r.info.Size()), "B", &valueRange, "size"))
+	}
+
+	if plugin.Checksum != "" {
+		metrics = append(metrics, nagopher.MustNewStringMetric("sha256", r.checksum, "sha256"))
+	}
+	if plugin.Mode != "" {
+		metrics = append(metrics, nagopher.MustNewStringMetric("mode", formatFileMode(r.info.Mode()), "mode"))
+	}
+	if plugin.Owner != "" {
+		metrics = append(metrics, nagopher.MustNewStringMetric("owner", r.owner, "owner"))
+	}
+	if plugin.Group != "" {
+		metrics = append(metrics, nagopher.MustNewStringMetric("group", r.group, "group"))
+	}
+
+	return metrics, nil
+}
+
+// Collect gathers the metadata of the path, which is left empty if the path does not exist. Checksum and ownership are
+// only determined if they should be checked, as hashing large files is expensive.
+func (r *fileResource) Collect() error {
+	plugin := r.ThisPlugin()
+	if plugin.Mode != "" {
+		if _, err := strconv.ParseUint(plugin.Mode, 8, 32); err != nil {
+			return fmt.Errorf("invalid octal mode [%s]", plugin.Mode)
+		}
+	}
+
+	info, err := os.Stat(plugin.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not stat file: %s", err.Error())
+	}
+	r.info = info
+
+	if plugin.Checksum != "" {
+		if info.IsDir() {
+			return fmt.Errorf("could not calculate checksum: %s is a directory", plugin.Path)
+		}
+		if r.checksum, err = fileChecksum(plugin.Path); err != nil {
+			return fmt.Errorf("could not calculate checksum: %s", err.Error())
+		}
+	}
+
+	if plugin.Owner != "" || plugin.Group != "" {
+		uid, gid, err := fileOwnership(info)
+		if err != nil {
+			return err
+		}
+
+		r.owner = lookupFileOwner(plugin.Owner, uid, func(id string) (string, error) {
+			owner, err := user.LookupId(id)
+			if err != nil {
+				return "", err
+			}
+			return owner.Username, nil
+		})
+		r.group = lookupFileOwner(plugin.Group, gid, func(id string) (string, error) {
+			group, err := user.LookupGroupId(id)
+			if err != nil {
+				return "", err
+			}
+			return group.Name, nil
+		})
+	}
+
+	return nil
+}
+
+func (r *fileResource) ThisPlugin() *filePlugin {
+	return r.Resource.Plugin().(*filePlugin)
+}
+
+// fileChecksum returns the SHA256 checksum of the given file as lowercase hex digest
+func fileChecksum(path string) (_ string, rerr error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := file.Close(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// lookupFileOwner returns the numeric ID if the expected owner is numeric as well, otherwise the ID gets resolved into
+// its name using the given lookup function, falling back to the numeric ID for unknown users or groups
+func lookupFileOwner(expected string, id uint32, lookup func(id string) (string, error)) string {
+	numericID := strconv.FormatUint(uint64(id), 10)
+	if _, err := strconv.ParseUint(expected, 10, 32); err == nil {
+		return numericID
+	}
+
+	name, err := lookup(numericID)
+	if err != nil {
+		return numericID
+	}
+
+	return name
+}
+
+func formatFileMode(mode os.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
+
+func newFileSummarizer(plugin *filePlugin, resource *fileResource) *fileSummarizer {
+	return &fileSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+		resource: resource,
+	}
+}
+
+func (s *fileSummarizer) Ok(check nagopher.Check) string {
+	plugin := s.ThisPlugin()
+	info := s.resource.info
+	if info == nil {
+		return fmt.Sprintf("%s does not exist", plugin.Path)
+	}
+
+	summary := fmt.Sprintf("%s is %s old", plugin.Path,
+		nagocheck.DurationString(time.Since(info.ModTime()).Truncate(time.Second)))
+	if !info.IsDir() {
+		summary += " with " + nagocheck.FormatBinarySize(float64(info.Size()))
+	}
+
+	var checks []string
+	if plugin.Checksum != "" {
+		checks = append(checks, "checksum matches")
+	}
+	if plugin.Mode != "" {
+		checks = append(checks, "mode "+formatFileMode(info.Mode()))
+	}
+	if plugin.Owner != "" || plugin.Group != "" {
+		checks = append(checks, "owned by "+strings.Trim(s.resource.owner+":"+s.resource.group, ":"))
+	}
+	if len(checks) > 0 {
+		summary += " (" + strings.Join(checks, ", ") + ")"
+	}
+
+	return summary
+}
+
+func (s *fileSummarizer) ThisPlugin() *filePlugin {
+	return s.Summarizer.Plugin().(*filePlugin)
+}
@@ -0,0 +1,34 @@
+//+build !linux
+
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func fileOwnership(info os.FileInfo) (uint32, uint32, error) {
+	return 0, 0, fmt.Errorf("unsupported operating system for checking ownership: %s", runtime.GOOS)
+}
+
+func fileIdentity(info os.FileInfo) uint64 {
+	return 0
+}
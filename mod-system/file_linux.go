@@ -0,0 +1,44 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileOwnership returns the UID and GID owning the file described by the given file info
+func fileOwnership(info os.FileInfo) (uint32, uint32, error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, fmt.Errorf("could not determine ownership of %s", info.Name())
+	}
+
+	return stat.Uid, stat.Gid, nil
+}
+
+// fileIdentity returns the inode of the file described by the given file info, which allows detecting whether a path
+// refers to another file than before, e.g. after rotating log files. Zero is returned if unknown.
+func fileIdentity(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+
+	return 0
+}
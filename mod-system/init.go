@@ -38,6 +38,12 @@ func NewSystemModule() nagocheck.Module {
 			nagocheck.ModulePlugin(newTemperaturePlugin()),
 			nagocheck.ModulePlugin(newMdraidPlugin()),
 			nagocheck.ModulePlugin(newZfsPlugin()),
+			nagocheck.ModulePlugin(newSmartPlugin()),
+			nagocheck.ModulePlugin(newDiskPlugin()),
+			nagocheck.ModulePlugin(newDiskioPlugin()),
+			nagocheck.ModulePlugin(newFilePlugin()),
+			nagocheck.ModulePlugin(newLogfilePlugin()),
+			nagocheck.ModulePlugin(newTimesyncPlugin()),
 		),
 	}
 }
@@ -23,24 +23,42 @@ import (
 	"github.com/snapserv/nagocheck/nagocheck"
 	"github.com/snapserv/nagopher"
 	"math"
+	"net"
+	"strings"
 )
 
+const defaultEthtoolCommand = "/sbin/ethtool"
+const defaultInterfaceExclude = "^(veth.*|docker[0-9]+|br-[0-9a-f]+|virbr[0-9]+(-nic)?)$"
+
 type interfacePlugin struct {
 	nagocheck.Plugin
 
-	InterfaceName  string
+	InterfaceNames []string
+	Discovery      *nagocheck.AutoDiscovery
 	SpeedRange     nagopher.OptionalBounds
 	ExpectedDuplex []string
+
+	CollectOptics          bool
+	EthtoolCommand         string
+	OpticsRxPowerRange     nagopher.OptionalBounds
+	OpticsTxPowerRange     nagopher.OptionalBounds
+	OpticsTemperatureRange nagopher.OptionalBounds
+
+	remote RemoteCollector
 }
 
 type interfaceResource struct {
 	nagocheck.Resource `json:"-"`
 
+	name           string
+	prefix         string
+	err            error
 	linkState      string
 	linkSpeed      int
 	linkDuplex     string
 	transmitErrors int
 	receiveErrors  int
+	optics         *interfaceOpticsStats
 
 	PreviousTransmitErrors float64 `json:"txErrors"`
 	PreviousReceiveErrors  float64 `json:"rxErrors"`
@@ -50,12 +68,20 @@ type interfaceSummarizer struct {
 	nagocheck.Summarizer
 }
 
+type interfaceOpticsStats struct {
+	temperature   float64
+	receivePower  map[string]float64
+	transmitPower map[string]float64
+}
+
 func newInterfacePlugin() *interfacePlugin {
 	return &interfacePlugin{
 		Plugin: nagocheck.NewPlugin("interface",
 			nagocheck.PluginDescription("Network Interface"),
+			nagocheck.PluginFlapDetection(true),
 			nagocheck.PluginDefaultThresholds(false),
 		),
+		Discovery: nagocheck.NewAutoDiscovery("interfaces", false),
 	}
 }
 
@@ -66,38 +92,164 @@ func (p *interfacePlugin) DefineFlags(kp nagocheck.KingpinNode) {
 	kp.Flag("duplex", "Return WARNING state when interface duplex does not match (e.g.: half, full).").
 		Short('d').HintOptions("half", "full").StringsVar(&p.ExpectedDuplex)
 
-	kp.Arg("name", "Name of network interface.").
-		Required().StringVar(&p.InterfaceName)
+	kp.Flag("optics", "Collect optical power levels and temperature of SFP/QSFP modules using ethtool.").
+		BoolVar(&p.CollectOptics)
+
+	kp.Flag("ethtool-cmd", "[optics] Specifies the command with optional arguments to be used for executing "+
+		"ethtool. Use comma to separate command and arguments. Specify the global --sudo flag for executing "+
+		"ethtool with elevated privileges.").
+		Default(defaultEthtoolCommand).StringVar(&p.EthtoolCommand)
+
+	nagocheck.NagopherBoundsVar(kp.Flag("optics-rx-power", "[optics] Receive power threshold in dBm formatted as "+
+		"Nagios range specifier."), &p.OpticsRxPowerRange)
+	nagocheck.NagopherBoundsVar(kp.Flag("optics-tx-power", "[optics] Transmit power threshold in dBm formatted as "+
+		"Nagios range specifier."), &p.OpticsTxPowerRange)
+	nagocheck.NagopherBoundsVar(kp.Flag("optics-temperature", "[optics] Module temperature threshold in degrees "+
+		"celsius formatted as Nagios range specifier."), &p.OpticsTemperatureRange)
+
+	// Remote interfaces can not be enumerated, as remote collectors only support fetching a single interface
+	if p.remote != nil {
+		kp.Arg("name", "Names of network interfaces.").
+			Required().StringsVar(&p.InterfaceNames)
+		return
+	}
+
+	p.Discovery.DefineFlags(kp)
+	p.Discovery.DefineExcludeFlag(kp, defaultInterfaceExclude)
+	kp.Arg("name", "Names of network interfaces. Metrics are prefixed with the interface name (e.g. eth0_state) "+
+		"unless exactly one interface has been given.").
+		StringsVar(&p.InterfaceNames)
+}
+
+func (p *interfacePlugin) SudoTemplates() []nagocheck.SudoTemplate {
+	if p.remote != nil {
+		return nil
+	}
+
+	return []nagocheck.SudoTemplate{p.ethtoolTemplate()}
+}
+
+// ethtoolTemplate returns the allow-listed template for executing ethtool, which only permits dumping module eeprom
+func (p *interfacePlugin) ethtoolTemplate() nagocheck.SudoTemplate {
+	ethtoolCommand := p.EthtoolCommand
+	if ethtoolCommand == "" {
+		ethtoolCommand = defaultEthtoolCommand
+	}
+
+	command := append(strings.Split(ethtoolCommand, ","), "-m")
+	return nagocheck.NewSudoTemplate("ethtool", command, "*")
 }
 
 func (p *interfacePlugin) DefineCheck() nagopher.Check {
 	deltaRange := nagopher.NewBounds(nagopher.LowerBound(math.Inf(-1)), nagopher.UpperBound(0))
-	resource := newInterfaceResource(p)
 
 	check := nagopher.NewCheck("interface", newInterfaceSummarizer(p))
-	check.AttachResources(resource)
 	check.AttachContexts(
-		nagopher.NewStringMatchContext("state", nagopher.StateCritical(), []string{"UP"}),
+		nagocheck.NewFlapDetectionContext(p, nagopher.NewStringMatchContext(
+			"state", nagopher.StateCritical(), []string{"UP"},
+		)),
 		nagopher.NewStringMatchContext("duplex", nagopher.StateWarning(), p.ExpectedDuplex),
 		nagopher.NewScalarContext("speed", nagopher.OptionalBoundsPtr(p.SpeedRange), nil),
-		nagopher.NewDeltaContext("errors_tx", &resource.PreviousReceiveErrors, &deltaRange, nil),
-		nagopher.NewDeltaContext("errors_rx", &resource.PreviousTransmitErrors, &deltaRange, nil),
+
+		nagopher.NewScalarContext("optics_rx_power", nagopher.OptionalBoundsPtr(p.OpticsRxPowerRange), nil),
+		nagopher.NewScalarContext("optics_tx_power", nagopher.OptionalBoundsPtr(p.OpticsTxPowerRange), nil),
+		nagopher.NewScalarContext("optics_temperature", nagopher.OptionalBoundsPtr(p.OpticsTemperatureRange), nil),
 	)
 
+	interfaceNames, err := p.interfaceNames()
+	if err != nil {
+		resource := &interfaceResource{err: err}
+		resource.Resource = nagocheck.NewResource(p)
+		check.AttachResources(resource)
+		return check
+	}
+
+	// Error counters are compared against the previous values of each interface, which requires a context per interface
+	resources := make([]nagocheck.Resource, 0, len(interfaceNames))
+	for _, interfaceName := range interfaceNames {
+		resource := newInterfaceResource(p, interfaceName)
+		if len(interfaceNames) != 1 || p.Discovery.Active(p.InterfaceNames) {
+			resource.prefix = interfaceName + "_"
+		}
+
+		resources = append(resources, resource)
+		check.AttachContexts(
+			nagocheck.NewDeltaContext(p, resource.prefix+"errors_tx", &resource.PreviousTransmitErrors, &deltaRange, nil),
+			nagocheck.NewDeltaContext(p, resource.prefix+"errors_rx", &resource.PreviousReceiveErrors, &deltaRange, nil),
+		)
+	}
+
+	if len(resources) == 1 {
+		check.AttachResources(resources[0])
+	} else {
+		nagocheck.AttachConcurrentResources(check, 0, resources...)
+	}
+
 	return check
 }
 
-func newInterfaceResource(plugin *interfacePlugin) *interfaceResource {
-	resource := &interfaceResource{}
+// interfaceNames returns the names of all interfaces which should be checked, enumerating all interfaces which are
+// administratively up except for loopback interfaces when using --auto
+func (p *interfacePlugin) interfaceNames() ([]string, error) {
+	if p.remote != nil {
+		return p.InterfaceNames, nil
+	}
+	if err := p.Discovery.Validate(p.InterfaceNames); err != nil {
+		return nil, err
+	}
+	if !p.Discovery.Active(p.InterfaceNames) {
+		return p.InterfaceNames, nil
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("could not list interfaces: %s", err.Error())
+	}
+
+	var present []string
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback == 0 && iface.Flags&net.FlagUp != 0 {
+			present = append(present, iface.Name)
+		}
+	}
+
+	interfaceNames := p.Discovery.Select(p.InterfaceNames, present)
+	if len(interfaceNames) == 0 {
+		return nil, fmt.Errorf("no interfaces available")
+	}
+
+	return interfaceNames, nil
+}
+
+func newInterfaceResource(plugin *interfacePlugin, name string) *interfaceResource {
+	// Remote interfaces are additionally identified by their target and may contain slashes (e.g. Gi0/1)
+	persistenceKey := name
+	if plugin.remote != nil {
+		persistenceKey = strings.Replace(plugin.remote.Target()+"-"+name, "/", "_", -1)
+	}
+
+	resource := &interfaceResource{name: name}
 	resource.Resource = nagocheck.NewResource(plugin,
-		nagocheck.ResourcePersistence(plugin.InterfaceName, &resource),
+		nagocheck.ResourcePersistence(persistenceKey, resource, &resource),
 	)
 
 	return resource
 }
 
 func (r *interfaceResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
-	if err := r.Collect(warnings); err != nil {
+	if r.err != nil {
+		return metrics, r.err
+	}
+
+	collect := r.Collect
+	if r.ThisPlugin().remote != nil {
+		collect = r.collectRemote
+	}
+
+	if err := collect(warnings); err != nil {
+		if r.prefix != "" {
+			return metrics, fmt.Errorf("%s: %s", r.name, err.Error())
+		}
 		return metrics, err
 	}
 
@@ -110,16 +262,60 @@ func (r *interfaceResource) Probe(warnings nagopher.WarningCollection) (metrics
 	}
 
 	metrics = append(metrics,
-		nagopher.MustNewStringMetric("state", r.linkState, ""),
-		nagopher.MustNewStringMetric("duplex", r.linkDuplex, ""),
-		nagopher.MustNewNumericMetric("speed", intToFloat64(r.linkSpeed), "MB", nil, ""),
-		nagopher.MustNewNumericMetric("errors_tx", intToFloat64(r.transmitErrors), "c", nil, ""),
-		nagopher.MustNewNumericMetric("errors_rx", intToFloat64(r.receiveErrors), "c", nil, ""),
+		nagopher.MustNewStringMetric(r.prefix+"state", r.linkState, "state"),
+		nagopher.MustNewStringMetric(r.prefix+"duplex", r.linkDuplex, "duplex"),
+		nagopher.MustNewNumericMetric(r.prefix+"speed", intToFloat64(r.linkSpeed), "MB", nil, "speed"),
+		nagopher.MustNewNumericMetric(r.prefix+"errors_tx", intToFloat64(r.transmitErrors), "c", nil, ""),
+		nagopher.MustNewNumericMetric(r.prefix+"errors_rx", intToFloat64(r.receiveErrors), "c", nil, ""),
 	)
 
+	if r.optics != nil {
+		if !math.IsNaN(r.optics.temperature) {
+			metrics = append(metrics, nagopher.MustNewNumericMetric(r.prefix+"optics_temperature",
+				r.optics.temperature, "", nil, "optics_temperature"))
+		}
+
+		opticsPowerMetrics := func(contextName string, values map[string]float64) {
+			for channel, value := range values {
+				metricName := r.prefix + contextName
+				if channel != "" {
+					metricName += "_ch" + channel
+				}
+
+				metrics = append(metrics, nagopher.MustNewNumericMetric(metricName, value, "", nil, contextName))
+			}
+		}
+
+		opticsPowerMetrics("optics_rx_power", r.optics.receivePower)
+		opticsPowerMetrics("optics_tx_power", r.optics.transmitPower)
+	}
+
+	if r.prefix != "" {
+		return r.Section(r.name, metrics...), nil
+	}
+
 	return metrics, nil
 }
 
+func (r *interfaceResource) collectRemote(warnings nagopher.WarningCollection) error {
+	if r.ThisPlugin().CollectOptics {
+		warnings.Add(nagopher.NewWarning("optics are not supported for remote interfaces"))
+	}
+
+	stats, err := r.ThisPlugin().remote.CollectInterface(r.name, warnings)
+	if err != nil {
+		return err
+	}
+
+	r.linkState = stats.State
+	r.linkSpeed = stats.Speed
+	r.linkDuplex = stats.Duplex
+	r.transmitErrors = stats.TransmitErrors
+	r.receiveErrors = stats.ReceiveErrors
+
+	return nil
+}
+
 func (r *interfaceResource) ThisPlugin() *interfacePlugin {
 	return r.Resource.Plugin().(*interfacePlugin)
 }
@@ -134,6 +330,11 @@ func (s *interfaceSummarizer) Ok(check nagopher.Check) string {
 	var interfaceSpeed = "N/A"
 	resultCollection := check.Results()
 
+	plugin := s.Summarizer.Plugin().(*interfacePlugin)
+	if interfaceCount := len(check.Resources()); interfaceCount != 1 || plugin.Discovery.Active(plugin.InterfaceNames) {
+		return fmt.Sprintf("%d interfaces are up", interfaceCount)
+	}
+
 	interfaceState := resultCollection.GetStringMetricValue("state").OrElse("N/A")
 	interfaceDuplex := resultCollection.GetStringMetricValue("duplex").OrElse("N/A")
 
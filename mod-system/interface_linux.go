@@ -20,37 +20,62 @@ package modsystem
 
 import (
 	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
 	"github.com/snapserv/nagopher"
 	"io/ioutil"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
+const ethtoolTimeout = 10 * time.Second
+
+// ethtoolMinimumPower is used instead of -inf dBm, which ethtool reports for modules without any received light, as
+// nagopher treats infinite values as always violating the given thresholds
+const ethtoolMinimumPower = -40
+
+var ethtoolLineRE = regexp.MustCompile(`^\s*(.+?)\s*:\s*(.*)$`)
+var ethtoolChannelRE = regexp.MustCompile(`(?i)\s*\(channel (\d+)\)$`)
+var ethtoolPowerRE = regexp.MustCompile(`(?i)(-?inf|-?[\d.]+) dBm`)
+var ethtoolTemperatureRE = regexp.MustCompile(`(?i)(-?[\d.]+) degrees C`)
+
+var ethtoolReceivePowerKeys = []string{"receiver signal average optical power", "rcvr signal avg optical power"}
+var ethtoolTransmitPowerKeys = []string{"laser output power", "transmit avg optical power"}
+
 func (r *interfaceResource) Collect(warnings nagopher.WarningCollection) error {
-	device := r.ThisPlugin().InterfaceName
+	device := r.name
+	r.ThisPlugin().Logger().Debugf("collecting statistics from %s", nagocheck.SysPath("class/net", device))
 
 	if err := r.collectLinkState(device); err != nil {
 		return err
 	}
 
 	if err := r.collectLinkSpeed(device); err != nil {
-		warnings.Add(nagopher.NewWarning(err.Error()))
+		warnings.Add(nagocheck.PartialFailure("%s", err.Error()))
 	}
 	if err := r.collectLinkDuplex(device); err != nil {
-		warnings.Add(nagopher.NewWarning(err.Error()))
+		warnings.Add(nagocheck.PartialFailure("%s", err.Error()))
 	}
 	if err := r.collectTransmitErrors(device); err != nil {
-		warnings.Add(nagopher.NewWarning(err.Error()))
+		warnings.Add(nagocheck.PartialFailure("%s", err.Error()))
 	}
 	if err := r.collectReceiveErrors(device); err != nil {
-		warnings.Add(nagopher.NewWarning(err.Error()))
+		warnings.Add(nagocheck.PartialFailure("%s", err.Error()))
+	}
+
+	if r.ThisPlugin().CollectOptics {
+		if err := r.collectOptics(device); err != nil {
+			warnings.Add(nagocheck.PartialFailure("%s", err.Error()))
+		}
 	}
 
 	return nil
 }
 
 func (r *interfaceResource) collectLinkState(device string) error {
-	bytes, err := ioutil.ReadFile(fmt.Sprintf("/sys/class/net/%s/operstate", device))
+	bytes, err := ioutil.ReadFile(nagocheck.SysPath("class/net", device, "operstate"))
 	if err != nil {
 		return fmt.Errorf("could not determine link state (%s)", err.Error())
 	}
@@ -60,7 +85,7 @@ func (r *interfaceResource) collectLinkState(device string) error {
 }
 
 func (r *interfaceResource) collectLinkSpeed(device string) error {
-	bytes, err := ioutil.ReadFile(fmt.Sprintf("/sys/class/net/%s/speed", device))
+	bytes, err := ioutil.ReadFile(nagocheck.SysPath("class/net", device, "speed"))
 	if err != nil {
 		return fmt.Errorf("could not determine link speed (%s)", err.Error())
 	}
@@ -76,7 +101,7 @@ func (r *interfaceResource) collectLinkSpeed(device string) error {
 }
 
 func (r *interfaceResource) collectLinkDuplex(device string) error {
-	bytes, err := ioutil.ReadFile(fmt.Sprintf("/sys/class/net/%s/duplex", device))
+	bytes, err := ioutil.ReadFile(nagocheck.SysPath("class/net", device, "duplex"))
 	if err != nil {
 		return fmt.Errorf("could not determine link duplex (%s)", err.Error())
 	}
@@ -86,7 +111,7 @@ func (r *interfaceResource) collectLinkDuplex(device string) error {
 }
 
 func (r *interfaceResource) collectTransmitErrors(device string) error {
-	bytes, err := ioutil.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/tx_errors", device))
+	bytes, err := ioutil.ReadFile(nagocheck.SysPath("class/net", device, "statistics/tx_errors"))
 	if err != nil {
 		return fmt.Errorf("could not determine transmit errors (%s)", err.Error())
 	}
@@ -102,7 +127,7 @@ func (r *interfaceResource) collectTransmitErrors(device string) error {
 }
 
 func (r *interfaceResource) collectReceiveErrors(device string) error {
-	bytes, err := ioutil.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/rx_errors", device))
+	bytes, err := ioutil.ReadFile(nagocheck.SysPath("class/net", device, "statistics/rx_errors"))
 	if err != nil {
 		return fmt.Errorf("could not determine receive errors (%s)", err.Error())
 	}
@@ -116,3 +141,86 @@ func (r *interfaceResource) collectReceiveErrors(device string) error {
 	r.receiveErrors = int(errorCount)
 	return nil
 }
+
+func (r *interfaceResource) collectOptics(device string) error {
+	command, err := r.ThisPlugin().ethtoolTemplate().Build(device)
+	if err != nil {
+		return err
+	}
+
+	output, err := nagocheck.ExecuteCommand(ethtoolTimeout, command)
+	if err != nil {
+		sanitizedOutput := strings.Replace(strings.TrimSpace(output), "\n", " ", -1)
+		return fmt.Errorf("could not read module eeprom (%s: %s)", err.Error(), sanitizedOutput)
+	}
+
+	optics, err := parseEthtoolModuleInfo(output)
+	if err != nil {
+		return fmt.Errorf("could not parse module eeprom (%s)", err.Error())
+	}
+
+	r.optics = optics
+	return nil
+}
+
+// parseEthtoolModuleInfo parses the output of 'ethtool -m', which only contains diagnostic values if the module supports
+// digital optical monitoring (DOM). QSFP modules report their power levels per channel.
+func parseEthtoolModuleInfo(output string) (*interfaceOpticsStats, error) {
+	optics := &interfaceOpticsStats{
+		temperature:   math.NaN(),
+		receivePower:  make(map[string]float64),
+		transmitPower: make(map[string]float64),
+	}
+
+	matchesKey := func(key string, candidates []string) bool {
+		for _, candidate := range candidates {
+			if key == candidate {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		lineMatch := ethtoolLineRE.FindStringSubmatch(line)
+		if lineMatch == nil {
+			continue
+		}
+
+		key, value, channel := strings.ToLower(lineMatch[1]), lineMatch[2], ""
+		if channelMatch := ethtoolChannelRE.FindStringSubmatch(key); channelMatch != nil {
+			key, channel = strings.TrimSpace(strings.TrimSuffix(key, channelMatch[0])), channelMatch[1]
+		}
+
+		switch {
+		case key == "module temperature":
+			if match := ethtoolTemperatureRE.FindStringSubmatch(value); match != nil {
+				optics.temperature, _ = strconv.ParseFloat(match[1], 64)
+			}
+		case matchesKey(key, ethtoolReceivePowerKeys):
+			if match := ethtoolPowerRE.FindStringSubmatch(value); match != nil {
+				optics.receivePower[channel] = parseEthtoolPower(match[1])
+			}
+		case matchesKey(key, ethtoolTransmitPowerKeys):
+			if match := ethtoolPowerRE.FindStringSubmatch(value); match != nil {
+				optics.transmitPower[channel] = parseEthtoolPower(match[1])
+			}
+		}
+	}
+
+	if math.IsNaN(optics.temperature) && len(optics.receivePower) == 0 && len(optics.transmitPower) == 0 {
+		return nil, fmt.Errorf("module does not provide diagnostic monitoring data")
+	}
+
+	return optics, nil
+}
+
+func parseEthtoolPower(rawValue string) float64 {
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		return math.NaN()
+	}
+
+	return math.Max(value, ethtoolMinimumPower)
+}
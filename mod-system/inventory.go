@@ -0,0 +1,151 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modsystem
+
+import (
+	"fmt"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/mem"
+	"github.com/snapserv/nagopher"
+	"net"
+	"sort"
+)
+
+type systemInventory struct {
+	CPUCount    int                  `json:"cpu_count"`
+	MemoryTotal uint64               `json:"memory_total"`
+	Interfaces  []interfaceInventory `json:"interfaces"`
+	ZfsPools    []zfsPoolInventory   `json:"zfs_pools"`
+	MdArrays    []mdArrayInventory   `json:"md_arrays"`
+	Warnings    []string             `json:"warnings,omitempty"`
+}
+
+type interfaceInventory struct {
+	Name   string `json:"name"`
+	MAC    string `json:"mac,omitempty"`
+	MTU    int    `json:"mtu"`
+	State  string `json:"state,omitempty"`
+	Speed  int    `json:"speed,omitempty"`
+	Duplex string `json:"duplex,omitempty"`
+}
+
+type zfsPoolInventory struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+type mdArrayInventory struct {
+	Name        string `json:"name"`
+	State       string `json:"state"`
+	DisksTotal  uint64 `json:"disks_total"`
+	BlocksTotal uint64 `json:"blocks_total"`
+}
+
+// Inventory gathers static facts about the host by reusing the collectors of the contained plugins. Only missing CPU
+// or memory information is considered fatal, all other collectors merely add warnings as not every host has e.g. ZFS.
+func (m *systemModule) Inventory() (interface{}, error) {
+	var inventory systemInventory
+	warnings := nagopher.NewWarningCollection()
+
+	cpuCount, err := cpu.Counts(true)
+	if err != nil {
+		return nil, fmt.Errorf("could not determine cpu count: %s", err.Error())
+	}
+	inventory.CPUCount = cpuCount
+
+	memoryStats, err := mem.VirtualMemory()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine memory size: %s", err.Error())
+	}
+	inventory.MemoryTotal = memoryStats.Total
+
+	inventory.Interfaces = m.interfaceInventory(warnings)
+	inventory.ZfsPools = m.zfsInventory(warnings)
+	inventory.MdArrays = m.mdraidInventory(warnings)
+	inventory.Warnings = warnings.GetWarningStrings()
+
+	return inventory, nil
+}
+
+func (m *systemModule) interfaceInventory(warnings nagopher.WarningCollection) []interfaceInventory {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		warnings.Add(nagopher.NewWarning("could not list interfaces: %s", err.Error()))
+		return []interfaceInventory{}
+	}
+
+	result := make([]interfaceInventory, 0, len(interfaces))
+	for _, iface := range interfaces {
+		item := interfaceInventory{
+			Name: iface.Name,
+			MAC:  iface.HardwareAddr.String(),
+			MTU:  iface.MTU,
+		}
+
+		// Link details are best-effort, as e.g. virtual interfaces do not report any speed
+		resource := newInterfaceResource(newInterfacePlugin(), iface.Name)
+		if err := resource.Collect(nagopher.NewWarningCollection()); err == nil {
+			item.State = resource.linkState
+			item.Duplex = resource.linkDuplex
+			if resource.linkSpeed > 0 {
+				item.Speed = resource.linkSpeed
+			}
+		}
+
+		result = append(result, item)
+	}
+
+	return result
+}
+
+func (m *systemModule) zfsInventory(warnings nagopher.WarningCollection) []zfsPoolInventory {
+	resource := newZfsResource(newZfsPlugin())
+	if err := resource.Collect(nagopher.NewWarningCollection()); err != nil {
+		warnings.Add(nagopher.NewWarning("could not gather zfs pools: %s", err.Error()))
+	}
+
+	result := make([]zfsPoolInventory, 0, len(resource.poolStats))
+	for name, pool := range resource.poolStats {
+		result = append(result, zfsPoolInventory{Name: name, State: pool.state})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+func (m *systemModule) mdraidInventory(warnings nagopher.WarningCollection) []mdArrayInventory {
+	resource := newMdraidResource(newMdraidPlugin())
+	if err := resource.Collect(warnings); err != nil {
+		warnings.Add(nagopher.NewWarning("could not gather md arrays: %s", err.Error()))
+	}
+
+	result := make([]mdArrayInventory, 0, len(resource.arrays))
+	for _, array := range resource.arrays {
+		result = append(result, mdArrayInventory{
+			Name:        array.name,
+			State:       array.state,
+			DisksTotal:  array.disksTotal,
+			BlocksTotal: array.blocksTotal,
+		})
+	}
+
+	return result
+}
@@ -31,6 +31,8 @@ type loadPlugin struct {
 	nagocheck.Plugin
 
 	PerCPU bool
+
+	remote RemoteCollector
 }
 
 type loadResource struct {
@@ -50,6 +52,7 @@ func newLoadPlugin() *loadPlugin {
 	return &loadPlugin{
 		Plugin: nagocheck.NewPlugin("load",
 			nagocheck.PluginDescription("Load Average"),
+			nagocheck.PluginHysteresis(true),
 		),
 		PerCPU: false,
 	}
@@ -63,11 +66,11 @@ func (p *loadPlugin) DefineCheck() nagopher.Check {
 	check := nagopher.NewCheck("load", newLoadSummarizer(p))
 	check.AttachResources(newLoadResource(p))
 	check.AttachContexts(
-		nagopher.NewScalarContext(
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
 			"load",
 			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
 			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
-		),
+		)),
 	)
 
 	return check
@@ -96,17 +99,17 @@ func (r *loadResource) Probe(warnings nagopher.WarningCollection) (metrics []nag
 }
 
 func (r *loadResource) Collect() error {
-	loadStats, err := load.Avg()
+	loadStats, err := r.collectStats()
 	if err != nil {
 		return err
 	}
 
-	r.cpuCores = uint(runtime.NumCPU())
+	r.cpuCores = loadStats.CPUCores
 	r.loadAverage1 = loadStats.Load1
 	r.loadAverage5 = loadStats.Load5
 	r.loadAverage15 = loadStats.Load15
 
-	if r.ThisPlugin().PerCPU {
+	if r.ThisPlugin().PerCPU && r.cpuCores > 0 {
 		r.loadAverage1 /= float64(r.cpuCores)
 		r.loadAverage5 /= float64(r.cpuCores)
 		r.loadAverage15 /= float64(r.cpuCores)
@@ -115,6 +118,24 @@ func (r *loadResource) Collect() error {
 	return nil
 }
 
+func (r *loadResource) collectStats() (LoadStats, error) {
+	if remote := r.ThisPlugin().remote; remote != nil {
+		return remote.CollectLoad()
+	}
+
+	loadStats, err := load.Avg()
+	if err != nil {
+		return LoadStats{}, err
+	}
+
+	return LoadStats{
+		CPUCores: uint(runtime.NumCPU()),
+		Load1:    loadStats.Load1,
+		Load5:    loadStats.Load5,
+		Load15:   loadStats.Load15,
+	}, nil
+}
+
 func (r *loadResource) ThisPlugin() *loadPlugin {
 	return r.Resource.Plugin().(*loadPlugin)
 }
@@ -0,0 +1,346 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type logfilePlugin struct {
+	nagocheck.Plugin
+
+	Path             string
+	CriticalPatterns []*regexp.Regexp
+	WarningPatterns  []*regexp.Regexp
+	IgnorePatterns   []*regexp.Regexp
+	CriticalCount    nagopher.OptionalBounds
+	WarningCount     nagopher.OptionalBounds
+	SampleLines      int
+}
+
+type logfileResource struct {
+	nagocheck.Resource `json:"-"`
+
+	lines         int
+	criticalLines []string
+	warningLines  []string
+	criticalCount int
+	warningCount  int
+	firstRun      bool
+
+	Offset    int64  `json:"offset"`
+	Identity  uint64 `json:"identity"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type logfileSummarizer struct {
+	nagocheck.Summarizer
+
+	resource *logfileResource
+}
+
+// logfileMaxSampleLength is the maximum length of sample lines within the verbose output
+const logfileMaxSampleLength = 200
+
+func newLogfilePlugin() *logfilePlugin {
+	return &logfilePlugin{
+		Plugin: nagocheck.NewPlugin("logfile",
+			nagocheck.PluginDescription("Log File"),
+			nagocheck.PluginDefaultThresholds(false),
+		),
+	}
+}
+
+func (p *logfilePlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("path", "Path to the log file which should be scanned for new lines since the previous execution.").
+		Required().StringVar(&p.Path)
+
+	node.Flag("critical-pattern", "Regular expression matching lines which should be counted as critical. Can be "+
+		"specified multiple times.").
+		RegexpListVar(&p.CriticalPatterns)
+
+	node.Flag("warning-pattern", "Regular expression matching lines which should be counted as warning, unless they "+
+		"are already counted as critical. Can be specified multiple times.").
+		RegexpListVar(&p.WarningPatterns)
+
+	node.Flag("ignore-pattern", "Regular expression matching lines which should never be counted, e.g. known "+
+		"harmless errors. Can be specified multiple times.").
+		RegexpListVar(&p.IgnorePatterns)
+
+	nagocheck.NagopherBoundsVar(node.Flag("critical-count", "Critical threshold for the amount of new lines "+
+		"matching critical patterns, formatted as Nagios range specifier.").
+		Default("0"), &p.CriticalCount)
+
+	nagocheck.NagopherBoundsVar(node.Flag("warning-count", "Warning threshold for the amount of new lines matching "+
+		"warning patterns, formatted as Nagios range specifier.").
+		Default("0"), &p.WarningCount)
+
+	node.Flag("sample-lines", "Maximum amount of the most recent matching lines per severity which are being shown "+
+		"within the verbose output.").
+		Default("5").IntVar(&p.SampleLines)
+}
+
+func (p *logfilePlugin) DefineCheck() nagopher.Check {
+	resource := newLogfileResource(p)
+
+	check := nagopher.NewCheck("logfile", newLogfileSummarizer(p, resource))
+	check.AttachResources(resource)
+	check.AttachContexts(
+		nagopher.NewScalarContext("critical_lines", nil, nagopher.OptionalBoundsPtr(p.CriticalCount)),
+		nagopher.NewScalarContext("warning_lines", nagopher.OptionalBoundsPtr(p.WarningCount), nil),
+		nagopher.NewScalarContext("lines", nil, nil),
+	)
+
+	return check
+}
+
+// newLogfileResource instantiates a resource whose persistence key is derived from the path and all patterns, so that
+// several checks scanning the same log file for different patterns do not share their offsets
+func newLogfileResource(plugin *logfilePlugin) *logfileResource {
+	parts := []string{plugin.Path}
+	for _, patterns := range [][]*regexp.Regexp{plugin.CriticalPatterns, plugin.WarningPatterns, plugin.IgnorePatterns} {
+		for _, pattern := range patterns {
+			parts = append(parts, pattern.String())
+		}
+		parts = append(parts, "")
+	}
+	hash := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+
+	resource := &logfileResource{}
+	resource.Resource = nagocheck.NewResource(plugin,
+		nagocheck.ResourcePersistence(hex.EncodeToString(hash[:8]), resource, &resource),
+		nagocheck.ResourceDurablePersistence(),
+	)
+
+	return resource
+}
+
+func (r *logfileResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(math.Inf(1)))
+
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+	if r.firstRun {
+		warnings.Add(nagopher.NewWarning("waiting for new lines, starting at end of file"))
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("critical_lines", float64(r.criticalCount), "", &valueRange, "critical_lines"),
+		nagopher.MustNewNumericMetric("warning_lines", float64(r.warningCount), "", &valueRange, "warning_lines"),
+		nagopher.MustNewNumericMetric("lines", float64(r.lines), "", &valueRange, "lines"),
+	)
+
+	return metrics, nil
+}
+
+// Collect scans all lines appended to the log file since the previous execution. The first execution only remembers
+// the end of the file, as all previous lines have most likely been handled already. Rotated log files are being
+// detected by their identity, in which case the remainder of the rotated file is being scanned as well if it still
+// exists with the suffix '.1', while truncated log files are being scanned from the start.
+func (r *logfileResource) Collect() (rerr error) {
+	plugin := r.ThisPlugin()
+	if len(plugin.CriticalPatterns) == 0 && len(plugin.WarningPatterns) == 0 {
+		return fmt.Errorf("at least one critical or warning pattern is required")
+	}
+
+	file, err := os.Open(plugin.Path)
+	if err != nil {
+		return fmt.Errorf("could not open log file: %s", err.Error())
+	}
+	defer func() {
+		if err := file.Close(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat log file: %s", err.Error())
+	}
+
+	identity, offset := fileIdentity(info), r.Offset
+	if r.Timestamp == 0 {
+		r.firstRun = true
+		r.Offset, r.Identity, r.Timestamp = info.Size(), identity, time.Now().Unix()
+		return nil
+	}
+
+	if identity != 0 && r.Identity != 0 && identity != r.Identity {
+		plugin.Logger().Debugf("log file has been rotated, scanning from start")
+		if err := r.scanRotated(offset); err != nil {
+			plugin.Logger().Debugf("could not scan rotated log file: %s", err.Error())
+		}
+		offset = 0
+	} else if info.Size() < offset {
+		plugin.Logger().Debugf("log file has been truncated, scanning from start")
+		offset = 0
+	}
+
+	if r.Offset, err = r.scan(file, offset); err != nil {
+		return fmt.Errorf("could not read log file: %s", err.Error())
+	}
+	r.Identity, r.Timestamp = identity, time.Now().Unix()
+
+	return nil
+}
+
+// scanRotated scans the remainder of the previous log file starting at the given offset, as long as it has been
+// rotated by renaming it to the same path with the suffix '.1'
+func (r *logfileResource) scanRotated(offset int64) (rerr error) {
+	file, err := os.Open(r.ThisPlugin().Path + ".1")
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if fileIdentity(info) != r.Identity || info.Size() < offset {
+		return nil
+	}
+
+	_, err = r.scan(file, offset)
+	return err
+}
+
+// scan reads all complete lines of the given file starting at the given offset and returns the offset after the last
+// complete line, so that lines which are still being written get scanned during the next execution
+func (r *logfileResource) scan(file io.ReadSeeker, offset int64) (int64, error) {
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return offset, nil
+		} else if err != nil {
+			return offset, err
+		}
+
+		offset += int64(len(line))
+		r.lines++
+		r.match(strings.TrimRight(line, "\r\n"))
+	}
+}
+
+// match counts the given line according to the most severe matching pattern, remembering the most recent lines of each
+// severity for the verbose output
+func (r *logfileResource) match(line string) {
+	plugin := r.ThisPlugin()
+	if matchesAny(plugin.IgnorePatterns, line) {
+		return
+	}
+
+	if matchesAny(plugin.CriticalPatterns, line) {
+		r.criticalCount++
+		r.criticalLines = appendSampleLine(r.criticalLines, line, plugin.SampleLines)
+	} else if matchesAny(plugin.WarningPatterns, line) {
+		r.warningCount++
+		r.warningLines = appendSampleLine(r.warningLines, line, plugin.SampleLines)
+	}
+}
+
+func (r *logfileResource) ThisPlugin() *logfilePlugin {
+	return r.Resource.Plugin().(*logfilePlugin)
+}
+
+func matchesAny(patterns []*regexp.Regexp, line string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(line) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// appendSampleLine appends the given line to the sample lines, keeping at most the given amount of lines
+func appendSampleLine(lines []string, line string, maxLines int) []string {
+	if maxLines <= 0 {
+		return lines
+	}
+	if len(line) > logfileMaxSampleLength {
+		line = line[:logfileMaxSampleLength] + "..."
+	}
+
+	lines = append(lines, line)
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+
+	return lines
+}
+
+func newLogfileSummarizer(plugin *logfilePlugin, resource *logfileResource) *logfileSummarizer {
+	return &logfileSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+		resource: resource,
+	}
+}
+
+func (s *logfileSummarizer) Ok(check nagopher.Check) string {
+	resource := s.resource
+	summary := fmt.Sprintf("%d new lines in %s", resource.lines, s.Plugin().(*logfilePlugin).Path)
+	if resource.lines == 1 {
+		summary = fmt.Sprintf("1 new line in %s", s.Plugin().(*logfilePlugin).Path)
+	}
+
+	if resource.criticalCount+resource.warningCount == 0 {
+		return summary + " without any matches"
+	}
+
+	return fmt.Sprintf("%s, %d critical and %d warning matches", summary, resource.criticalCount,
+		resource.warningCount)
+}
+
+// Verbose appends the most recent matching lines of each severity to the verbose output of the results
+func (s *logfileSummarizer) Verbose(check nagopher.Check) []string {
+	lines := s.Summarizer.Verbose(check)
+	for _, line := range s.resource.criticalLines {
+		lines = append(lines, "critical line: "+line)
+	}
+	for _, line := range s.resource.warningLines {
+		lines = append(lines, "warning line: "+line)
+	}
+
+	return lines
+}
@@ -27,6 +27,9 @@ import (
 
 type mdraidPlugin struct {
 	nagocheck.Plugin
+
+	ArrayNames []string
+	Discovery  *nagocheck.AutoDiscovery
 }
 
 type mdraidResource struct {
@@ -55,9 +58,18 @@ func newMdraidPlugin() *mdraidPlugin {
 			nagocheck.PluginDescription("MD RAID"),
 			nagocheck.PluginForceVerbose(true),
 		),
+		Discovery: nagocheck.NewAutoDiscovery("arrays", true),
 	}
 }
 
+func (p *mdraidPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("array", "Names of the arrays which should be checked, e.g. md0. Defaults to all present arrays.").
+		StringsVar(&p.ArrayNames)
+
+	p.Discovery.DefineFlags(node)
+	p.Discovery.DefineExcludeFlag(node, "")
+}
+
 func (p *mdraidPlugin) DefineCheck() nagopher.Check {
 	check := nagopher.NewCheck("mdraid", newMdraidSummarizer(p))
 	check.AttachResources(newMdraidResource(p))
@@ -81,16 +93,21 @@ func newMdraidResource(plugin *mdraidPlugin) *mdraidResource {
 }
 
 func (r *mdraidResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	plugin := r.Resource.Plugin().(*mdraidPlugin)
+	if err := plugin.Discovery.Validate(plugin.ArrayNames); err != nil {
+		return metrics, err
+	}
 	if err := r.Collect(warnings); err != nil {
 		return metrics, err
 	}
 
-	if len(r.arrays) == 0 {
+	arrays := r.selectArrays(plugin)
+	if len(arrays) == 0 {
 		return metrics, fmt.Errorf("no arrays available")
 	}
 
-	for _, array := range r.arrays {
-		metrics = append(metrics,
+	for _, array := range arrays {
+		metrics = append(metrics, r.Section(array.name,
 			nagopher.MustNewStringMetric(array.name+"_state", array.state, "state"),
 			nagopher.MustNewStringMetric(array.name+"_array",
 				fmt.Sprintf("%s: %s with %d/%d disks and %d blocks",
@@ -104,15 +121,39 @@ func (r *mdraidResource) Probe(warnings nagopher.WarningCollection) (metrics []n
 			nagopher.MustNewNumericMetric(array.name+"_disks_total", float64(array.disksTotal), "", nil, "disks_total"),
 			nagopher.MustNewNumericMetric(array.name+"_blocks_synced", float64(array.blocksSynced), "", nil, "blocks_synced"),
 			nagopher.MustNewNumericMetric(array.name+"_blocks_total", float64(array.blocksTotal), "", nil, "blocks_total"),
-		)
+		)...)
 	}
 
 	return metrics, nil
 }
 
+// selectArrays returns the requested arrays, where arrays which have been given explicitly but are not present are
+// being reported with the state MISSING
+func (r *mdraidResource) selectArrays(plugin *mdraidPlugin) (arrays []arrayStats) {
+	present := make(map[string]arrayStats)
+	presentNames := make([]string, 0, len(r.arrays))
+	for _, array := range r.arrays {
+		present[array.name] = array
+		presentNames = append(presentNames, array.name)
+	}
+
+	for _, name := range plugin.Discovery.Select(plugin.ArrayNames, presentNames) {
+		array, ok := present[name]
+		if !ok {
+			array = arrayStats{name: name, state: "MISSING"}
+		}
+
+		arrays = append(arrays, array)
+	}
+
+	return arrays
+}
+
 func newMdraidSummarizer(plugin *mdraidPlugin) *mdraidSummarizer {
 	return &mdraidSummarizer{
-		Summarizer: nagocheck.NewSummarizer(plugin),
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
 	}
 }
 
@@ -20,6 +20,7 @@ package modsystem
 
 import (
 	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
 	"github.com/snapserv/nagopher"
 	"io/ioutil"
 	"regexp"
@@ -34,7 +35,7 @@ var personalityUnsupportedLineRE = regexp.MustCompile(`(\d+) blocks (.*)`)
 var syncLineRE = regexp.MustCompile(`\((\d+)/\d+\)`)
 
 func (r *mdraidResource) Collect(warnings nagopher.WarningCollection) error {
-	if err := r.parseMdstat("/proc/mdstat", warnings); err != nil {
+	if err := r.parseMdstat(nagocheck.ProcPath("mdstat"), warnings); err != nil {
 		return err
 	}
 
@@ -43,6 +44,8 @@ func (r *mdraidResource) Collect(warnings nagopher.WarningCollection) error {
 			r.arrays[i].state = "INACTIVE"
 		} else if array.blocksSynced != array.blocksTotal {
 			r.arrays[i].state = "SYNCING"
+		} else if array.disksActive < array.disksTotal {
+			r.arrays[i].state = "DEGRADED"
 		} else {
 			r.arrays[i].state = "ACTIVE"
 		}
@@ -52,10 +55,12 @@ func (r *mdraidResource) Collect(warnings nagopher.WarningCollection) error {
 }
 
 func (r *mdraidResource) parseMdstat(mdstatPath string, warnings nagopher.WarningCollection) error {
+	logger := r.Plugin().Logger()
 	bytes, err := ioutil.ReadFile(mdstatPath)
 	if err != nil {
 		return fmt.Errorf("could not read mdstat: %s", err.Error())
 	}
+	logger.Debugf("read %d bytes from %s", len(bytes), mdstatPath)
 
 	lines := strings.Split(string(bytes), "\n")
 	r.arrays = make([]arrayStats, 0, len(lines)/3)
@@ -127,6 +132,8 @@ func (r *mdraidResource) parseMdstat(mdstatPath string, warnings nagopher.Warnin
 			array.blocksSynced = array.blocksTotal
 		}
 
+		logger.Debugf("parsed array %s with personality [%s]: %d/%d disks, %d/%d blocks", array.name, personality,
+			array.disksActive, array.disksTotal, array.blocksSynced, array.blocksTotal)
 		r.arrays = append(r.arrays, array)
 	}
 
@@ -0,0 +1,79 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modsystem_test
+
+import (
+	"github.com/snapserv/nagocheck/mod-system"
+	"github.com/snapserv/nagocheck/nagocheck/nagochecktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestMdraid_Fixtures(t *testing.T) {
+	testCases := []struct {
+		fixture  string
+		args     []string
+		exitCode int
+	}{
+		{fixture: "healthy", exitCode: 0},
+		{fixture: "healthy", args: []string{"md0"}, exitCode: 0},
+		{fixture: "raid1-degraded", exitCode: 2},
+		{fixture: "raid5-recovery", exitCode: 2},
+	}
+
+	for _, testCase := range testCases {
+		name := testCase.fixture
+		if len(testCase.args) > 0 {
+			name += "-" + testCase.args[0]
+		}
+
+		t.Run(name, func(t *testing.T) {
+			// given
+			directory := filepath.Join("testdata", "mdraid", testCase.fixture)
+			restoreFixtures := nagochecktest.UseFixtures(filepath.Join(directory, "proc"), "")
+			defer restoreFixtures()
+
+			// when
+			result, err := nagochecktest.RunCheck(modsystem.NewSystemModule(), append([]string{"mdraid"},
+				testCase.args...)...)
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, testCase.exitCode, result.ExitCode)
+			assert.NoError(t, nagochecktest.CompareGolden(
+				filepath.Join("testdata", "mdraid", name+".golden"), result.Output))
+		})
+	}
+}
+
+func TestMdraid_MissingArray(t *testing.T) {
+	// given
+	restoreFixtures := nagochecktest.UseFixtures(filepath.Join("testdata", "mdraid", "healthy", "proc"), "")
+	defer restoreFixtures()
+
+	// when
+	result, err := nagochecktest.RunCheck(modsystem.NewSystemModule(), "mdraid", "md0", "md9")
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.ExitCode)
+	assert.Contains(t, result.Output, "md9")
+}
@@ -31,6 +31,10 @@ type memoryPlugin struct {
 	nagocheck.Plugin
 
 	CountReclaimable bool
+	FreeWarning      nagopher.OptionalBounds
+	FreeCritical     nagopher.OptionalBounds
+
+	remote RemoteCollector
 }
 
 type memoryResource struct {
@@ -59,6 +63,9 @@ func newMemoryPlugin() *memoryPlugin {
 	return &memoryPlugin{
 		Plugin: nagocheck.NewPlugin("memory",
 			nagocheck.PluginDescription("Memory Usage"),
+			nagocheck.PluginHysteresis(true),
+			nagocheck.PluginCapacityContexts("usage"),
+			nagocheck.PluginHistory(true),
 		),
 	}
 }
@@ -66,21 +73,29 @@ func newMemoryPlugin() *memoryPlugin {
 func (p *memoryPlugin) DefineFlags(kp nagocheck.KingpinNode) {
 	kp.Flag("count-reclaimable", "Count reclaimable space (e.g. cached and buffers) as used.").
 		BoolVar(&p.CountReclaimable)
+
+	nagocheck.SizeBoundsVar(kp.Flag("free-warning", "Warning threshold for free memory formatted as Nagios range "+
+		"specifier, using sizes like 512MB: or 2GiB: (bytes by default)."), &p.FreeWarning)
+	nagocheck.SizeBoundsVar(kp.Flag("free-critical", "Critical threshold for free memory formatted as Nagios range "+
+		"specifier, using sizes like 512MB: or 2GiB: (bytes by default)."), &p.FreeCritical)
 }
 
 func (p *memoryPlugin) DefineCheck() nagopher.Check {
 	check := nagopher.NewCheck("memory", newMemorySummarizer(p))
 	check.AttachResources(newMemoryResource(p))
 	check.AttachContexts(
-		nagopher.NewScalarContext(
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
 			"usage",
 			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
 			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
-		),
+		)),
 
 		nagopher.NewScalarContext("total", nil, nil),
 		nagopher.NewScalarContext("used", nil, nil),
-		nagopher.NewScalarContext("free", nil, nil),
+		nagopher.NewScalarContext("free",
+			nagopher.OptionalBoundsPtr(p.FreeWarning),
+			nagopher.OptionalBoundsPtr(p.FreeCritical),
+		),
 
 		nagopher.NewScalarContext("active", nil, nil),
 		nagopher.NewScalarContext("inactive", nil, nil),
@@ -130,39 +145,65 @@ func (r *memoryResource) Probe(warnings nagopher.WarningCollection) (metrics []n
 }
 
 func (r *memoryResource) Collect() error {
-	vmStats, err := mem.VirtualMemory()
+	memoryStats, err := r.collectStats()
 	if err != nil {
 		return err
 	}
 
-	freeBytes := vmStats.Available
+	freeBytes := memoryStats.Available
 	if r.ThisPlugin().CountReclaimable {
-		freeBytes = vmStats.Free
+		freeBytes = memoryStats.Free
 	}
 
-	r.usageStats.totalBytes = float64(vmStats.Total)
-	r.usageStats.usedBytes = float64(vmStats.Total - freeBytes)
+	r.usageStats.totalBytes = float64(memoryStats.Total)
+	r.usageStats.usedBytes = float64(memoryStats.Total - freeBytes)
 	r.usageStats.freeBytes = float64(freeBytes)
 
-	r.usageStats.activeBytes = float64(vmStats.Active)
-	r.usageStats.inactiveBytes = float64(vmStats.Inactive)
-	r.usageStats.wiredBytes = float64(vmStats.Wired)
-	r.usageStats.buffersBytes = float64(vmStats.Buffers)
-	r.usageStats.cachedBytes = float64(vmStats.Cached)
-	r.usageStats.laundryBytes = float64(vmStats.Laundry)
+	r.usageStats.activeBytes = float64(memoryStats.Active)
+	r.usageStats.inactiveBytes = float64(memoryStats.Inactive)
+	r.usageStats.wiredBytes = float64(memoryStats.Wired)
+	r.usageStats.buffersBytes = float64(memoryStats.Buffers)
+	r.usageStats.cachedBytes = float64(memoryStats.Cached)
+	r.usageStats.laundryBytes = float64(memoryStats.Laundry)
 
 	r.usagePercent = nagocheck.Round(100-(r.usageStats.freeBytes/r.usageStats.totalBytes*100), 2)
 
 	return nil
 }
 
+func (r *memoryResource) collectStats() (MemoryStats, error) {
+	if remote := r.ThisPlugin().remote; remote != nil {
+		return remote.CollectMemory()
+	}
+
+	vmStats, err := mem.VirtualMemory()
+	if err != nil {
+		return MemoryStats{}, err
+	}
+
+	return MemoryStats{
+		Total:     vmStats.Total,
+		Free:      vmStats.Free,
+		Available: vmStats.Available,
+
+		Active:   vmStats.Active,
+		Inactive: vmStats.Inactive,
+		Wired:    vmStats.Wired,
+		Buffers:  vmStats.Buffers,
+		Cached:   vmStats.Cached,
+		Laundry:  vmStats.Laundry,
+	}, nil
+}
+
 func (r *memoryResource) ThisPlugin() *memoryPlugin {
 	return r.Resource.Plugin().(*memoryPlugin)
 }
 
 func newMemorySummarizer(plugin *memoryPlugin) *memorySummarizer {
 	return &memorySummarizer{
-		Summarizer: nagocheck.NewSummarizer(plugin),
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
 	}
 }
 
@@ -0,0 +1,60 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modsystem_test
+
+import (
+	"github.com/snapserv/nagocheck/mod-system"
+	"github.com/snapserv/nagocheck/nagocheck/nagochecktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemory_Fixtures(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fixture  string
+		args     []string
+		exitCode int
+	}{
+		{name: "ok", fixture: "ok", exitCode: 0},
+		{name: "usage-warning", fixture: "ok", args: []string{"--warning", "20"}, exitCode: 1},
+		{name: "free-critical", fixture: "low-free", args: []string{"--free-critical", "1GiB:"}, exitCode: 2},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// given
+			directory := filepath.Join("testdata", "memory", testCase.fixture)
+			restoreFixtures := nagochecktest.UseFixtures(filepath.Join(directory, "proc"), "")
+			defer restoreFixtures()
+
+			// when
+			result, err := nagochecktest.RunCheck(modsystem.NewSystemModule(), append([]string{"memory"},
+				testCase.args...)...)
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, testCase.exitCode, result.ExitCode)
+			assert.NoError(t, nagochecktest.CompareGolden(
+				filepath.Join("testdata", "memory", testCase.name+".golden"), result.Output))
+		})
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modsystem
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"time"
+)
+
+// RemoteCollector collects statistics from a remote system instead of the local one, which allows running the plugins
+// of this module against devices without a local installation of nagocheck, e.g. by using SNMP
+type RemoteCollector interface {
+	Target() string
+	CollectLoad() (LoadStats, error)
+	CollectMemory() (MemoryStats, error)
+	CollectUptime() (time.Duration, error)
+	CollectInterface(name string, warnings nagopher.WarningCollection) (InterfaceStats, error)
+}
+
+// LoadStats contains the load averages of a system along with its amount of CPU cores
+type LoadStats struct {
+	CPUCores uint
+	Load1    float64
+	Load5    float64
+	Load15   float64
+}
+
+// MemoryStats contains the memory usage of a system in bytes, where statistics unknown to the system are set to zero
+type MemoryStats struct {
+	Total     uint64
+	Free      uint64
+	Available uint64
+
+	Active   uint64
+	Inactive uint64
+	Wired    uint64
+	Buffers  uint64
+	Cached   uint64
+	Laundry  uint64
+}
+
+// InterfaceStats contains the link status and error counters of a network interface, where unknown numbers are -1
+type InterfaceStats struct {
+	State          string
+	Speed          int
+	Duplex         string
+	TransmitErrors int
+	ReceiveErrors  int
+}
+
+// NewRemoteInterfacePlugin instantiates the interface plugin using the given remote collector
+func NewRemoteInterfacePlugin(collector RemoteCollector) nagocheck.Plugin {
+	plugin := newInterfacePlugin()
+	plugin.remote = collector
+	return plugin
+}
+
+// NewRemoteLoadPlugin instantiates the load plugin using the given remote collector
+func NewRemoteLoadPlugin(collector RemoteCollector) nagocheck.Plugin {
+	plugin := newLoadPlugin()
+	plugin.remote = collector
+	return plugin
+}
+
+// NewRemoteMemoryPlugin instantiates the memory plugin using the given remote collector
+func NewRemoteMemoryPlugin(collector RemoteCollector) nagocheck.Plugin {
+	plugin := newMemoryPlugin()
+	plugin.remote = collector
+	return plugin
+}
+
+// NewRemoteUptimePlugin instantiates the uptime plugin using the given remote collector
+func NewRemoteUptimePlugin(collector RemoteCollector) nagocheck.Plugin {
+	plugin := newUptimePlugin()
+	plugin.remote = collector
+	return plugin
+}
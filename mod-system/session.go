@@ -53,13 +53,15 @@ func newSessionPlugin() *sessionPlugin {
 	return &sessionPlugin{
 		Plugin: nagocheck.NewPlugin("session",
 			nagocheck.PluginDescription("User Sessions"),
+			nagocheck.PluginHysteresis(true),
 			nagocheck.PluginForceVerbose(true),
 		),
 	}
 }
 
 func (p *sessionPlugin) DefineFlags(node nagocheck.KingpinNode) {
-	nagocheck.NagopherBoundsVar(node.Flag("lifetime", "Lifetime warning threshold formatted as Nagios range specifier.").
+	nagocheck.DurationBoundsVar(node.Flag("lifetime", "Lifetime warning threshold formatted as Nagios range specifier, "+
+		"using durations like 30m or 1d (seconds by default).").
 		Short('l'), &p.lifetimeThreshold)
 }
 
@@ -67,11 +69,11 @@ func (p *sessionPlugin) DefineCheck() nagopher.Check {
 	check := nagopher.NewCheck("session", newSessionSummarizer(p))
 	check.AttachResources(newSessionResource(p))
 	check.AttachContexts(
-		nagopher.NewScalarContext(
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
 			"active",
 			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
 			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
-		),
+		)),
 
 		nagopher.NewStringInfoContext("session"),
 		nagocheck.NewHiddenScalarContext(p, "lifetime", nagopher.OptionalBoundsPtr(p.lifetimeThreshold), nil),
@@ -98,7 +100,7 @@ func (r *sessionResource) Probe(warnings nagopher.WarningCollection) (metrics []
 	)
 
 	for sessionID, session := range r.sessions {
-		metrics = append(metrics,
+		metrics = append(metrics, r.Section(session.user,
 			nagopher.MustNewStringMetric(
 				fmt.Sprintf("session%d", sessionID),
 				fmt.Sprintf("#%d %s@%s:%s since %s",
@@ -112,7 +114,7 @@ func (r *sessionResource) Probe(warnings nagopher.WarningCollection) (metrics []
 				fmt.Sprintf("lifetime%d", sessionID),
 				float64(session.lifetime.Seconds()), "s", &valueRange, "lifetime",
 			),
-		)
+		)...)
 	}
 
 	return metrics, nil
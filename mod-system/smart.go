@@ -0,0 +1,467 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+const defaultSmartctlCommand = "/usr/sbin/smartctl"
+
+type smartPlugin struct {
+	nagocheck.Plugin
+
+	DevicePaths         []string
+	UseSmartctl         bool
+	SmartctlCommand     string
+	AvailableSpareRange nagopher.OptionalBounds
+	MediaErrorsRange    nagopher.OptionalBounds
+	TemperatureRange    nagopher.OptionalBounds
+	ReallocatedRange    nagopher.OptionalBounds
+	PendingRange        nagopher.OptionalBounds
+}
+
+type smartResource struct {
+	nagocheck.Resource
+
+	devices []smartDevice
+}
+
+type smartSummarizer struct {
+	nagocheck.Summarizer
+}
+
+type smartAttributeContext struct {
+	nagocheck.Context
+}
+
+type nvmeCriticalWarningContext struct {
+	nagocheck.Context
+}
+
+// smartDevice contains the health of a single drive, where nvme is only set for NVMe devices and all other statistics
+// are NaN if unknown. The overall health is only available when using smartctl.
+type smartDevice struct {
+	path               string
+	health             string
+	nvme               *nvmeSmartLog
+	temperature        float64
+	percentageUsed     float64
+	reallocatedSectors float64
+	pendingSectors     float64
+	powerOnHours       float64
+	failingAttributes  []smartAttribute
+}
+
+// smartAttribute contains a failing ATA SMART attribute, where state is either 'FAILING_NOW' or 'FAILED_PAST'
+type smartAttribute struct {
+	name  string
+	state string
+}
+
+type nvmeSmartLog struct {
+	criticalWarning         uint8
+	temperature             float64
+	availableSpare          uint8
+	availableSpareThreshold uint8
+	percentageUsed          uint8
+	powerCycles             uint64
+	powerOnHours            uint64
+	unsafeShutdowns         uint64
+	mediaErrors             uint64
+	errorLogEntries         uint64
+}
+
+var nvmeCriticalWarningBits = []string{
+	"available spare below threshold",
+	"temperature threshold exceeded",
+	"reliability degraded",
+	"media placed in read-only mode",
+	"volatile memory backup failed",
+	"persistent memory region read-only",
+}
+
+func newSmartPlugin() *smartPlugin {
+	return &smartPlugin{
+		Plugin: nagocheck.NewPlugin("smart",
+			nagocheck.PluginDescription("SMART Disk Health"),
+			nagocheck.PluginHysteresis(true),
+		),
+	}
+}
+
+func (p *smartPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("device", "Paths of the devices to check, e.g. /dev/nvme0. Defaults to all drives found by "+
+		"'smartctl --scan' when using --smartctl.").
+		StringsVar(&p.DevicePaths)
+
+	node.Flag("smartctl", "Collect SMART data using 'smartctl --json' instead of querying NVMe devices directly, "+
+		"which additionally supports ATA and SCSI drives. Specify the global --sudo flag for executing smartctl "+
+		"with elevated privileges.").
+		BoolVar(&p.UseSmartctl)
+
+	node.Flag("smartctl-cmd", "[smartctl] Specifies the command with optional arguments to be used for executing "+
+		"smartctl. Use comma to separate command and arguments.").
+		Default(defaultSmartctlCommand).StringVar(&p.SmartctlCommand)
+
+	nagocheck.NagopherBoundsVar(node.Flag("available-spare", "[nvme] Available spare warning threshold in percent "+
+		"formatted as Nagios range specifier."), &p.AvailableSpareRange)
+
+	nagocheck.NagopherBoundsVar(node.Flag("media-errors", "[nvme] Media error warning threshold formatted as Nagios "+
+		"range specifier."), &p.MediaErrorsRange)
+
+	nagocheck.NagopherBoundsVar(node.Flag("temperature", "Temperature warning threshold in degrees celsius formatted "+
+		"as Nagios range specifier."), &p.TemperatureRange)
+
+	nagocheck.NagopherBoundsVar(node.Flag("reallocated-sectors", "[ata/scsi] Reallocated sector warning threshold "+
+		"formatted as Nagios range specifier.").Default("10"), &p.ReallocatedRange)
+
+	nagocheck.NagopherBoundsVar(node.Flag("pending-sectors", "[ata] Pending sector warning threshold formatted as "+
+		"Nagios range specifier.").Default("0"), &p.PendingRange)
+}
+
+func (p *smartPlugin) SudoTemplates() []nagocheck.SudoTemplate {
+	if !p.UseSmartctl {
+		return nil
+	}
+
+	return []nagocheck.SudoTemplate{p.smartctlScanTemplate(), p.smartctlTemplate()}
+}
+
+// smartctlScanTemplate returns the allow-listed template for listing all drives using smartctl
+func (p *smartPlugin) smartctlScanTemplate() nagocheck.SudoTemplate {
+	command := append(p.smartctlCommand(), "--json", "--scan")
+	return nagocheck.NewSudoTemplate("smartctl-scan", command, "")
+}
+
+// smartctlTemplate returns the allow-listed template for executing smartctl, which only permits reading all SMART
+// information of a device below /dev
+func (p *smartPlugin) smartctlTemplate() nagocheck.SudoTemplate {
+	command := append(p.smartctlCommand(), "--json", "--all")
+	return nagocheck.NewSudoTemplate("smartctl", command, "/dev/*")
+}
+
+func (p *smartPlugin) smartctlCommand() []string {
+	smartctlCommand := p.SmartctlCommand
+	if smartctlCommand == "" {
+		smartctlCommand = defaultSmartctlCommand
+	}
+
+	return strings.Split(smartctlCommand, ",")
+}
+
+func (p *smartPlugin) DefineCheck() nagopher.Check {
+	check := nagopher.NewCheck("smart", newSmartSummarizer(p))
+	check.AttachResources(newSmartResource(p))
+	check.AttachContexts(
+		nagopher.NewStringMatchContext("health", nagopher.StateCritical(), []string{"PASSED"}),
+		newSmartAttributeContext(p),
+		newNvmeCriticalWarningContext(p),
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"percentage_used",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+		nagopher.NewScalarContext("available_spare", nagopher.OptionalBoundsPtr(p.AvailableSpareRange), nil),
+		nagopher.NewScalarContext("media_errors", nagopher.OptionalBoundsPtr(p.MediaErrorsRange), nil),
+		nagopher.NewScalarContext("temperature", nagopher.OptionalBoundsPtr(p.TemperatureRange), nil),
+		nagopher.NewScalarContext("reallocated_sectors", nagopher.OptionalBoundsPtr(p.ReallocatedRange), nil),
+		nagopher.NewScalarContext("pending_sectors", nagopher.OptionalBoundsPtr(p.PendingRange), nil),
+
+		nagopher.NewScalarContext("available_spare_threshold", nil, nil),
+		nagopher.NewScalarContext("power_cycles", nil, nil),
+		nagopher.NewScalarContext("power_on_hours", nil, nil),
+		nagopher.NewScalarContext("unsafe_shutdowns", nil, nil),
+		nagopher.NewScalarContext("error_log_entries", nil, nil),
+	)
+
+	return check
+}
+
+func newSmartResource(plugin *smartPlugin) *smartResource {
+	return &smartResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+// Probe emits the metrics of all devices, which are being prefixed with the device name (e.g. sda_temperature) unless
+// a single device has been given explicitly, which keeps the metric names of previous versions
+func (r *smartResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(warnings); err != nil {
+		return metrics, err
+	}
+
+	for _, device := range r.devices {
+		prefix := ""
+		if len(r.ThisPlugin().DevicePaths) != 1 {
+			prefix = filepath.Base(device.path) + "_"
+		}
+
+		metrics = append(metrics, r.Section(device.path, device.metrics(prefix)...)...)
+	}
+
+	return metrics, nil
+}
+
+// Collect gathers the SMART data of all requested devices, either by using smartctl or by querying NVMe devices
+// directly, which requires the devices to be given explicitly
+func (r *smartResource) Collect(warnings nagopher.WarningCollection) error {
+	plugin := r.ThisPlugin()
+	if plugin.UseSmartctl {
+		return r.collectSmartctl(warnings)
+	}
+	if len(plugin.DevicePaths) == 0 {
+		return fmt.Errorf("no devices given, scanning for drives requires --smartctl")
+	}
+
+	r.devices = nil
+	for _, devicePath := range plugin.DevicePaths {
+		nvme, err := r.collectNative(devicePath)
+		if err != nil {
+			return err
+		}
+
+		device := newSmartDevice(devicePath)
+		device.nvme = &nvme
+		r.devices = append(r.devices, device)
+	}
+
+	return nil
+}
+
+func (r *smartResource) ThisPlugin() *smartPlugin {
+	return r.Resource.Plugin().(*smartPlugin)
+}
+
+func newSmartDevice(path string) smartDevice {
+	return smartDevice{
+		path:               path,
+		temperature:        math.NaN(),
+		percentageUsed:     math.NaN(),
+		reallocatedSectors: math.NaN(),
+		pendingSectors:     math.NaN(),
+		powerOnHours:       math.NaN(),
+	}
+}
+
+func (d smartDevice) metrics(prefix string) (metrics []nagopher.Metric) {
+	percentRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(100))
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0))
+
+	if d.health != "" {
+		metrics = append(metrics, nagopher.MustNewStringMetric(prefix+"health", d.health, "health"))
+	}
+	for _, attribute := range d.failingAttributes {
+		metrics = append(metrics, nagopher.MustNewStringMetric(prefix+attribute.name, attribute.state, "attribute"))
+	}
+
+	if nvme := d.nvme; nvme != nil {
+		return append(metrics,
+			nagopher.MustNewNumericMetric(prefix+"critical_warning", float64(nvme.criticalWarning), "", nil,
+				"critical_warning"),
+			nagopher.MustNewNumericMetric(prefix+"percentage_used", float64(nvme.percentageUsed), "%", &valueRange,
+				"percentage_used"),
+			nagopher.MustNewNumericMetric(prefix+"available_spare", float64(nvme.availableSpare), "%", &percentRange,
+				"available_spare"),
+			nagopher.MustNewNumericMetric(prefix+"media_errors", float64(nvme.mediaErrors), "c", &valueRange,
+				"media_errors"),
+			nagopher.MustNewNumericMetric(prefix+"temperature", nvme.temperature, "", nil, "temperature"),
+
+			nagopher.MustNewNumericMetric(prefix+"available_spare_threshold", float64(nvme.availableSpareThreshold),
+				"%", &percentRange, "available_spare_threshold"),
+			nagopher.MustNewNumericMetric(prefix+"power_cycles", float64(nvme.powerCycles), "c", &valueRange,
+				"power_cycles"),
+			nagopher.MustNewNumericMetric(prefix+"power_on_hours", float64(nvme.powerOnHours), "", &valueRange,
+				"power_on_hours"),
+			nagopher.MustNewNumericMetric(prefix+"unsafe_shutdowns", float64(nvme.unsafeShutdowns), "c", &valueRange,
+				"unsafe_shutdowns"),
+			nagopher.MustNewNumericMetric(prefix+"error_log_entries", float64(nvme.errorLogEntries), "c", &valueRange,
+				"error_log_entries"),
+		)
+	}
+
+	optionalMetric := func(name string, value float64, valueUnit string, valueRange *nagopher.Bounds) {
+		if !math.IsNaN(value) {
+			metrics = append(metrics, nagopher.MustNewNumericMetric(prefix+name, value, valueUnit, valueRange, name))
+		}
+	}
+
+	optionalMetric("percentage_used", d.percentageUsed, "%", &valueRange)
+	optionalMetric("temperature", d.temperature, "", nil)
+	optionalMetric("reallocated_sectors", d.reallocatedSectors, "", &valueRange)
+	optionalMetric("pending_sectors", d.pendingSectors, "", &valueRange)
+	optionalMetric("power_on_hours", d.powerOnHours, "", &valueRange)
+
+	return metrics
+}
+
+func newSmartSummarizer(plugin *smartPlugin) *smartSummarizer {
+	return &smartSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *smartSummarizer) Ok(check nagopher.Check) string {
+	devices := make(map[string]bool)
+	hottest, used, spare := math.NaN(), math.NaN(), math.NaN()
+	for _, result := range check.Results().Get() {
+		metric, err := result.Metric().Get()
+		if err != nil {
+			continue
+		}
+		if resource, ok := result.Resource().OrElse(nil).(nagocheck.Resource); ok {
+			devices[resource.SectionOf(metric)] = true
+		}
+
+		numericMetric, ok := metric.(nagopher.NumericMetric)
+		if !ok {
+			continue
+		}
+
+		value := numericMetric.Value()
+		switch metric.ContextName() {
+		case "temperature":
+			if math.IsNaN(hottest) || value > hottest {
+				hottest = value
+			}
+		case "percentage_used":
+			if math.IsNaN(used) || value > used {
+				used = value
+			}
+		case "available_spare":
+			if math.IsNaN(spare) || value < spare {
+				spare = value
+			}
+		}
+	}
+
+	multiple := len(devices) != 1
+	var details []string
+	if !math.IsNaN(used) {
+		details = append(details, fmt.Sprintf(smartSummaryFormat(multiple, "up to ")+"%.0f%% used", used))
+	}
+	if !math.IsNaN(spare) {
+		details = append(details, fmt.Sprintf(smartSummaryFormat(multiple, "at least ")+"%.0f%% spare", spare))
+	}
+	if !math.IsNaN(hottest) {
+		details = append(details, fmt.Sprintf(smartSummaryFormat(multiple, "hottest at ")+"%.0f°C", hottest))
+	}
+
+	summary := fmt.Sprintf("%d drives are healthy", len(devices))
+	for devicePath := range devices {
+		if !multiple {
+			summary = devicePath + " is healthy"
+		}
+	}
+	if len(details) == 0 {
+		return summary
+	}
+
+	return summary + " - " + strings.Join(details, ", ")
+}
+
+// smartSummaryFormat returns the given qualifier when summarizing multiple drives, as only the worst value is shown
+func smartSummaryFormat(multiple bool, qualifier string) string {
+	if multiple {
+		return qualifier
+	}
+
+	return ""
+}
+
+func newNvmeCriticalWarningContext(plugin *smartPlugin) *nvmeCriticalWarningContext {
+	return &nvmeCriticalWarningContext{
+		Context: nagocheck.NewContext(plugin, nagopher.NewBaseContext("critical_warning", "critical warning is %<value>s")),
+	}
+}
+
+func (c *nvmeCriticalWarningContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	numericMetric, ok := metric.(nagopher.NumericMetric)
+	if !ok {
+		return nagocheck.NewInvalidMetricTypeResult(c, metric, resource)
+	}
+
+	var reasons []string
+	criticalWarning := uint8(numericMetric.Value())
+	for bit, reason := range nvmeCriticalWarningBits {
+		if criticalWarning&(1<<uint(bit)) != 0 {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	if len(reasons) > 0 {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateCritical()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint(strings.Join(reasons, ", ")),
+		)
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(nagopher.StateOk()),
+		nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+	)
+}
+
+func (c *nvmeCriticalWarningContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	perfData, err := nagopher.NewPerfData(metric, nil, nil)
+	if err != nil {
+		return nagopher.OptionalPerfData{}, err
+	}
+
+	return nagopher.NewOptionalPerfData(perfData), nil
+}
+
+func newSmartAttributeContext(plugin *smartPlugin) *smartAttributeContext {
+	return &smartAttributeContext{
+		Context: nagocheck.NewContext(plugin, nagopher.NewBaseContext("attribute", "%<name>s is %<value>s")),
+	}
+}
+
+// Evaluate returns critical for attributes which are currently below their threshold and warning for attributes which
+// have been below their threshold in the past
+func (c *smartAttributeContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	stringMetric, ok := metric.(nagopher.StringMetric)
+	if !ok {
+		return nagocheck.NewInvalidMetricTypeResult(c, metric, resource)
+	}
+
+	state := nagopher.StateOk()
+	switch stringMetric.Value() {
+	case "FAILING_NOW":
+		state = nagopher.StateCritical()
+	case "FAILED_PAST":
+		state = nagopher.StateWarning()
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(state),
+		nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+	)
+}
+
+func (c *smartAttributeContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	return nagopher.OptionalPerfData{}, nil
+}
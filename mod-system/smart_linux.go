@@ -0,0 +1,110 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modsystem
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const nvmeIoctlAdminCmd = 0xC0484E41
+const nvmeAdminGetLogPage = 0x02
+const nvmeLogSmartHealth = 0x02
+const nvmeLogSmartHealthSize = 512
+
+// nvmePassthruCmd mirrors 'struct nvme_passthru_cmd' of the linux kernel (include/uapi/linux/nvme_ioctl.h)
+type nvmePassthruCmd struct {
+	opcode      uint8
+	flags       uint8
+	rsvd1       uint16
+	nsid        uint32
+	cdw2        uint32
+	cdw3        uint32
+	metadata    uint64
+	addr        uint64
+	metadataLen uint32
+	dataLen     uint32
+	cdw10       uint32
+	cdw11       uint32
+	cdw12       uint32
+	cdw13       uint32
+	cdw14       uint32
+	cdw15       uint32
+	timeoutMs   uint32
+	result      uint32
+}
+
+// collectNative reads the SMART log page of the given device directly using ioctl, which is only supported for NVMe
+func (r *smartResource) collectNative(devicePath string) (nvmeSmartLog, error) {
+	if strings.HasPrefix(filepath.Base(devicePath), "nvme") {
+		return collectNvme(devicePath)
+	}
+
+	return nvmeSmartLog{}, fmt.Errorf("unsupported device type, use --smartctl instead: %s", devicePath)
+}
+
+func collectNvme(devicePath string) (nvmeSmartLog, error) {
+	file, err := os.Open(devicePath)
+	if err != nil {
+		return nvmeSmartLog{}, fmt.Errorf("could not open nvme device: %s", err.Error())
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	data := make([]byte, nvmeLogSmartHealthSize)
+	cmd := nvmePassthruCmd{
+		opcode:  nvmeAdminGetLogPage,
+		nsid:    0xFFFFFFFF,
+		addr:    uint64(uintptr(unsafe.Pointer(&data[0]))),
+		dataLen: uint32(len(data)),
+		cdw10:   nvmeLogSmartHealth | uint32(len(data)/4-1)<<16,
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), nvmeIoctlAdminCmd, uintptr(unsafe.Pointer(&cmd)))
+	runtime.KeepAlive(data)
+	if errno != 0 {
+		return nvmeSmartLog{}, fmt.Errorf("could not read nvme smart log page: %s", errno.Error())
+	}
+
+	return parseNvmeSmartLog(data), nil
+}
+
+// parseNvmeSmartLog parses the 'SMART / Health Information' log page as specified by NVMe 1.4, section 5.14.1.2.
+// All 128-bit counters are truncated to their lower 64 bits.
+func parseNvmeSmartLog(data []byte) nvmeSmartLog {
+	return nvmeSmartLog{
+		criticalWarning:         data[0],
+		temperature:             float64(binary.LittleEndian.Uint16(data[1:3])) - 273,
+		availableSpare:          data[3],
+		availableSpareThreshold: data[4],
+		percentageUsed:          data[5],
+		powerCycles:             binary.LittleEndian.Uint64(data[112:120]),
+		powerOnHours:            binary.LittleEndian.Uint64(data[128:136]),
+		unsafeShutdowns:         binary.LittleEndian.Uint64(data[144:152]),
+		mediaErrors:             binary.LittleEndian.Uint64(data[160:168]),
+		errorLogEntries:         binary.LittleEndian.Uint64(data[176:184]),
+	}
+}
@@ -0,0 +1,264 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"strings"
+	"time"
+)
+
+const smartctlTimeout = 30 * time.Second
+
+// smartctlExitStatusFailed contains the bits of the smartctl exit status which indicate that no data could be read,
+// while all other bits describe the disk health and are being evaluated separately
+const smartctlExitStatusFailed = 0x03
+
+type smartctlScan struct {
+	Devices []struct {
+		Name string `json:"name"`
+	} `json:"devices"`
+}
+
+type smartctlOutput struct {
+	Smartctl struct {
+		ExitStatus int `json:"exit_status"`
+		Messages   []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+
+	Device struct {
+		Protocol string `json:"protocol"`
+	} `json:"device"`
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature *struct {
+		Current float64 `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime *struct {
+		Hours float64 `json:"hours"`
+	} `json:"power_on_time"`
+
+	AtaSmartAttributes struct {
+		Table []smartctlAtaAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NvmeSmartHealthInformationLog *struct {
+		CriticalWarning         uint8   `json:"critical_warning"`
+		Temperature             float64 `json:"temperature"`
+		AvailableSpare          uint8   `json:"available_spare"`
+		AvailableSpareThreshold uint8   `json:"available_spare_threshold"`
+		PercentageUsed          uint8   `json:"percentage_used"`
+		PowerCycles             uint64  `json:"power_cycles"`
+		PowerOnHours            uint64  `json:"power_on_hours"`
+		UnsafeShutdowns         uint64  `json:"unsafe_shutdowns"`
+		MediaErrors             uint64  `json:"media_errors"`
+		NumErrLogEntries        uint64  `json:"num_err_log_entries"`
+	} `json:"nvme_smart_health_information_log"`
+	ScsiGrownDefectList *float64 `json:"scsi_grown_defect_list"`
+	ScsiPercentageUsed  *float64 `json:"scsi_percentage_used_endurance_indicator"`
+}
+
+type smartctlAtaAttribute struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Value      int    `json:"value"`
+	WhenFailed string `json:"when_failed"`
+	Raw        struct {
+		Value float64 `json:"value"`
+	} `json:"raw"`
+}
+
+// smartctlWearAttributes contains the IDs of vendor-specific ATA attributes, whose normalized value contains the
+// remaining life of solid state drives in percent
+var smartctlWearAttributes = []int{231, 233, 177, 202}
+
+// collectSmartctl gathers the SMART data of all requested devices using smartctl, scanning for all available drives
+// if no devices were given
+func (r *smartResource) collectSmartctl(warnings nagopher.WarningCollection) error {
+	plugin := r.ThisPlugin()
+
+	devicePaths := plugin.DevicePaths
+	if len(devicePaths) == 0 {
+		var err error
+		if devicePaths, err = r.scanSmartctl(); err != nil {
+			return err
+		}
+		if len(devicePaths) == 0 {
+			return fmt.Errorf("smartctl did not find any drives")
+		}
+	}
+
+	// Drives are queried concurrently, as smartctl may take several seconds per drive with many drives attached
+	results := nagocheck.RunConcurrently(len(devicePaths), 0, func(index int) (interface{}, error) {
+		return r.executeSmartctl(devicePaths[index])
+	})
+
+	r.devices = nil
+	for index, result := range results {
+		if result.Err != nil {
+			return fmt.Errorf("could not read smart data of %s: %s", devicePaths[index], result.Err.Error())
+		}
+
+		device := result.Value.(smartDevice)
+		if device.health == "" {
+			warnings.Add(nagopher.NewWarning("%s does not report its overall health", device.path))
+		}
+
+		r.devices = append(r.devices, device)
+	}
+
+	return nil
+}
+
+func (r *smartResource) scanSmartctl() ([]string, error) {
+	var scan smartctlScan
+	if err := runSmartctl(r.ThisPlugin().smartctlScanTemplate(), &scan); err != nil {
+		return nil, fmt.Errorf("could not scan for drives: %s", err.Error())
+	}
+
+	var devicePaths []string
+	for _, device := range scan.Devices {
+		devicePaths = append(devicePaths, device.Name)
+	}
+
+	return devicePaths, nil
+}
+
+func (r *smartResource) executeSmartctl(devicePath string) (smartDevice, error) {
+	var output smartctlOutput
+	if err := runSmartctl(r.ThisPlugin().smartctlTemplate(), &output, devicePath); err != nil {
+		return smartDevice{}, err
+	}
+
+	if output.Smartctl.ExitStatus&smartctlExitStatusFailed != 0 {
+		var messages []string
+		for _, message := range output.Smartctl.Messages {
+			messages = append(messages, message.String)
+		}
+		return smartDevice{}, fmt.Errorf("%s", strings.Join(messages, ", "))
+	}
+
+	return parseSmartctlOutput(devicePath, output), nil
+}
+
+// runSmartctl executes the given smartctl template and decodes its JSON output. As smartctl uses its exit status as
+// bitmask for reporting the disk health, non-zero exit codes are only considered as failure without valid output.
+func runSmartctl(template nagocheck.SudoTemplate, result interface{}, args ...string) error {
+	command, err := template.Build(args...)
+	if err != nil {
+		return err
+	}
+
+	output, execErr := nagocheck.ExecuteCommand(smartctlTimeout, command)
+	if err := json.Unmarshal([]byte(output), result); err != nil {
+		if execErr != nil {
+			sanitizedOutput := strings.Replace(strings.TrimSpace(output), "\n", " ", -1)
+			return fmt.Errorf("%s: %s", execErr.Error(), sanitizedOutput)
+		}
+
+		return fmt.Errorf("could not parse output: %s", err.Error())
+	}
+
+	return nil
+}
+
+// parseSmartctlOutput converts the JSON output of 'smartctl --json --all' into a device, where NVMe drives report
+// their health log and ATA/SCSI drives report their sector and wear statistics
+func parseSmartctlOutput(devicePath string, output smartctlOutput) smartDevice {
+	device := newSmartDevice(devicePath)
+
+	if output.SmartStatus != nil {
+		device.health = "PASSED"
+		if !output.SmartStatus.Passed {
+			device.health = "FAILED"
+		}
+	}
+	if output.Temperature != nil {
+		device.temperature = output.Temperature.Current
+	}
+	if output.PowerOnTime != nil {
+		device.powerOnHours = output.PowerOnTime.Hours
+	}
+
+	if log := output.NvmeSmartHealthInformationLog; log != nil {
+		device.nvme = &nvmeSmartLog{
+			criticalWarning:         log.CriticalWarning,
+			temperature:             log.Temperature,
+			availableSpare:          log.AvailableSpare,
+			availableSpareThreshold: log.AvailableSpareThreshold,
+			percentageUsed:          log.PercentageUsed,
+			powerCycles:             log.PowerCycles,
+			powerOnHours:            log.PowerOnHours,
+			unsafeShutdowns:         log.UnsafeShutdowns,
+			mediaErrors:             log.MediaErrors,
+			errorLogEntries:         log.NumErrLogEntries,
+		}
+		return device
+	}
+
+	wear := math.NaN()
+	for _, attribute := range output.AtaSmartAttributes.Table {
+		switch attribute.ID {
+		case 5:
+			device.reallocatedSectors = attribute.Raw.Value
+		case 197:
+			device.pendingSectors = attribute.Raw.Value
+		}
+
+		for _, wearID := range smartctlWearAttributes {
+			if attribute.ID == wearID && math.IsNaN(wear) {
+				wear = float64(100 - attribute.Value)
+			}
+		}
+
+		switch attribute.WhenFailed {
+		case "now":
+			device.failingAttributes = append(device.failingAttributes, smartAttribute{
+				name: smartAttributeName(attribute), state: "FAILING_NOW",
+			})
+		case "past":
+			device.failingAttributes = append(device.failingAttributes, smartAttribute{
+				name: smartAttributeName(attribute), state: "FAILED_PAST",
+			})
+		}
+	}
+	if !math.IsNaN(wear) {
+		device.percentageUsed = math.Max(wear, 0)
+	}
+
+	if output.ScsiGrownDefectList != nil {
+		device.reallocatedSectors = *output.ScsiGrownDefectList
+	}
+	if output.ScsiPercentageUsed != nil {
+		device.percentageUsed = *output.ScsiPercentageUsed
+	}
+
+	return device
+}
+
+// smartAttributeName returns the metric name of an ATA attribute, e.g. 'attribute_5_reallocated_sector_ct'
+func smartAttributeName(attribute smartctlAtaAttribute) string {
+	return fmt.Sprintf("attribute_%d_%s", attribute.ID, strings.ToLower(attribute.Name))
+}
@@ -28,6 +28,9 @@ import (
 
 type swapPlugin struct {
 	nagocheck.Plugin
+
+	FreeWarning  nagopher.OptionalBounds
+	FreeCritical nagopher.OptionalBounds
 }
 
 type swapResource struct {
@@ -49,23 +52,34 @@ func newSwapPlugin() *swapPlugin {
 	return &swapPlugin{
 		Plugin: nagocheck.NewPlugin("swap",
 			nagocheck.PluginDescription("Swap Usage"),
+			nagocheck.PluginHysteresis(true),
 		),
 	}
 }
 
+func (p *swapPlugin) DefineFlags(kp nagocheck.KingpinNode) {
+	nagocheck.SizeBoundsVar(kp.Flag("free-warning", "Warning threshold for free swap space formatted as Nagios "+
+		"range specifier, using sizes like 512MB: or 2GiB: (bytes by default)."), &p.FreeWarning)
+	nagocheck.SizeBoundsVar(kp.Flag("free-critical", "Critical threshold for free swap space formatted as Nagios "+
+		"range specifier, using sizes like 512MB: or 2GiB: (bytes by default)."), &p.FreeCritical)
+}
+
 func (p *swapPlugin) DefineCheck() nagopher.Check {
 	check := nagopher.NewCheck("swap", newSwapSummarizer(p))
 	check.AttachResources(newSwapResource(p))
 	check.AttachContexts(
-		nagopher.NewScalarContext(
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
 			"usage",
 			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
 			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
-		),
+		)),
 
 		nagopher.NewScalarContext("total", nil, nil),
 		nagopher.NewScalarContext("used", nil, nil),
-		nagopher.NewScalarContext("free", nil, nil),
+		nagopher.NewScalarContext("free",
+			nagopher.OptionalBoundsPtr(p.FreeWarning),
+			nagopher.OptionalBoundsPtr(p.FreeCritical),
+		),
 	)
 
 	return check
@@ -49,6 +49,7 @@ func newTemperaturePlugin() *temperaturePlugin {
 	return &temperaturePlugin{
 		Plugin: nagocheck.NewPlugin("temperature",
 			nagocheck.PluginDescription("Temperature Sensors"),
+			nagocheck.PluginHysteresis(true),
 		),
 	}
 }
@@ -57,11 +58,11 @@ func (p *temperaturePlugin) DefineCheck() nagopher.Check {
 	check := nagopher.NewCheck("temperature", newTemperatureSummarizer(p))
 	check.AttachResources(newTemperatureResource(p))
 	check.AttachContexts(
-		nagopher.NewScalarContext(
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
 			"sensor",
 			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
 			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
-		),
+		)),
 	)
 
 	return check
@@ -0,0 +1,193 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type timesyncPlugin struct {
+	nagocheck.Plugin
+}
+
+type timesyncResource struct {
+	nagocheck.Resource
+
+	synchronized bool
+	offset       float64
+	drift        float64
+	source       string
+}
+
+type timesyncSummarizer struct {
+	nagocheck.Summarizer
+
+	resource *timesyncResource
+}
+
+const timesyncTimeout = 5 * time.Second
+
+func newTimesyncPlugin() *timesyncPlugin {
+	return &timesyncPlugin{
+		Plugin: nagocheck.NewPlugin("timesync",
+			nagocheck.PluginDescription("Time Synchronisation"),
+		),
+	}
+}
+
+func (p *timesyncPlugin) DefineCheck() nagopher.Check {
+	resource := newTimesyncResource(p)
+	check := nagopher.NewCheck("timesync", newTimesyncSummarizer(p, resource))
+	check.AttachResources(resource)
+	check.AttachContexts(
+		nagocheck.NewExpectContext("sync", nagopher.StateCritical(), "SYNCHRONIZED"),
+		nagopher.NewScalarContext("offset",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		),
+		nagopher.NewScalarContext("drift", nil, nil),
+		nagopher.NewBaseContext("source", "source is %<value>s"),
+	)
+
+	return check
+}
+
+func newTimesyncResource(plugin *timesyncPlugin) *timesyncResource {
+	return &timesyncResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+// Probe returns the absolute offset of the local clock in milliseconds, so that thresholds apply in both directions,
+// and its frequency drift in ppm
+func (r *timesyncResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0))
+
+	if err := r.Collect(warnings); err != nil {
+		return metrics, err
+	}
+
+	syncState := "SYNCHRONIZED"
+	if !r.synchronized {
+		syncState = "UNSYNCHRONIZED"
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewStringMetric("sync", syncState, "sync"),
+		nagopher.MustNewNumericMetric("offset", nagocheck.Round(math.Abs(r.offset), 3), "ms", &valueRange, "offset"),
+		nagopher.MustNewNumericMetric("drift", nagocheck.Round(r.drift, 3), "ppm", nil, "drift"),
+	)
+	if r.source != "" {
+		metrics = append(metrics, nagopher.MustNewStringMetric("source", r.source, "source"))
+	}
+
+	return metrics, nil
+}
+
+// collectChrony reads offset, source and synchronisation state from 'chronyc -c tracking', whose CSV output contains
+// the reference ID, reference name, stratum, reference time and the offset of the system time in seconds followed by
+// further statistics and the leap status as last field
+func (r *timesyncResource) collectChrony() error {
+	output, err := nagocheck.ExecuteCommand(timesyncTimeout, []string{"chronyc", "-c", "tracking"})
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Split(strings.TrimSpace(output), ",")
+	if len(fields) < 14 {
+		return fmt.Errorf("unexpected output of chronyc: %s", strings.TrimSpace(output))
+	}
+
+	offset, err := strconv.ParseFloat(fields[4], 64)
+	if err != nil {
+		return fmt.Errorf("invalid system time offset [%s]", fields[4])
+	}
+
+	r.offset = offset * 1000
+	r.source = fields[1]
+	if fields[len(fields)-1] == "Not synchronised" {
+		r.synchronized = false
+	}
+
+	return nil
+}
+
+// collectTimesyncd reads offset and source from 'timedatectl timesync-status', which is only available if the clock
+// gets synchronised by systemd-timesyncd. The server is formatted as '<address> (<name>)'.
+func (r *timesyncResource) collectTimesyncd() error {
+	output, err := nagocheck.ExecuteCommand(timesyncTimeout, []string{"timedatectl", "timesync-status"})
+	if err != nil {
+		return err
+	}
+
+	var server, offset string
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch parts[0] {
+		case "Server":
+			server = strings.TrimSpace(parts[1])
+		case "Offset":
+			offset = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if server == "" || offset == "" {
+		return fmt.Errorf("timedatectl did not report server and offset")
+	}
+
+	duration, err := time.ParseDuration(offset)
+	if err != nil {
+		return fmt.Errorf("invalid offset [%s]", offset)
+	}
+
+	r.offset = duration.Seconds() * 1000
+	r.source = server
+	if start, end := strings.Index(server, "("), strings.LastIndex(server, ")"); start != -1 && end > start {
+		r.source = server[start+1 : end]
+	}
+
+	return nil
+}
+
+func newTimesyncSummarizer(plugin *timesyncPlugin, resource *timesyncResource) *timesyncSummarizer {
+	return &timesyncSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+		resource: resource,
+	}
+}
+
+func (s *timesyncSummarizer) Ok(check nagopher.Check) string {
+	summary := "Clock is synchronized"
+	if s.resource.source != "" {
+		summary += " with " + s.resource.source
+	}
+
+	return fmt.Sprintf("%s (offset %+.3fms, drift %+.3fppm)", summary, s.resource.offset, s.resource.drift)
+}
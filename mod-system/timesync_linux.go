@@ -0,0 +1,63 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modsystem
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"syscall"
+)
+
+// Status bits and clock state returned by adjtimex, as defined within <sys/timex.h>
+const (
+	timexStatusUnsync = 0x0040
+	timexStatusNano   = 0x2000
+	timexStateError   = 5
+)
+
+// Collect reads the synchronisation state and frequency drift from the kernel clock using adjtimex, which gets
+// maintained by all common synchronisation daemons. As only ntpd uses the kernel PLL, whose remaining offset gets
+// reported by adjtimex, offset and source are taken from chrony or systemd-timesyncd if available. Offsets are
+// positive if the local clock is behind its source.
+func (r *timesyncResource) Collect(warnings nagopher.WarningCollection) error {
+	var timex syscall.Timex
+	state, err := syscall.Adjtimex(&timex)
+	if err != nil {
+		return fmt.Errorf("could not read kernel clock: %s", err.Error())
+	}
+
+	r.synchronized = state != timexStateError && int64(timex.Status)&timexStatusUnsync == 0
+	r.drift = float64(-int64(timex.Freq)) / 65536
+	r.offset = float64(timex.Offset) / 1000
+	if int64(timex.Status)&timexStatusNano != 0 {
+		r.offset /= 1000
+	}
+
+	logger := r.Plugin().Logger()
+	chronyErr := r.collectChrony()
+	if chronyErr == nil {
+		return nil
+	}
+	logger.Debugf("could not query chrony: %s", chronyErr.Error())
+
+	if err := r.collectTimesyncd(); err != nil {
+		logger.Debugf("could not query systemd-timesyncd: %s", err.Error())
+	}
+
+	return nil
+}
@@ -30,6 +30,8 @@ import (
 
 type uptimePlugin struct {
 	nagocheck.Plugin
+
+	remote RemoteCollector
 }
 
 type uptimeResource struct {
@@ -53,6 +55,7 @@ func newUptimePlugin() *uptimePlugin {
 	return &uptimePlugin{
 		Plugin: nagocheck.NewPlugin("uptime",
 			nagocheck.PluginDescription("System Uptime"),
+			nagocheck.PluginDurationThresholds(true),
 		),
 	}
 }
@@ -91,6 +94,16 @@ func (r *uptimeResource) Probe(warnings nagopher.WarningCollection) (metrics []n
 }
 
 func (r *uptimeResource) Collect() error {
+	if remote := r.ThisPlugin().remote; remote != nil {
+		uptime, err := remote.CollectUptime()
+		if err != nil {
+			return err
+		}
+
+		r.uptime = uptime.Seconds()
+		return nil
+	}
+
 	uptime, err := host.Uptime()
 	if err != nil {
 		return err
@@ -101,6 +114,10 @@ func (r *uptimeResource) Collect() error {
 	return nil
 }
 
+func (r *uptimeResource) ThisPlugin() *uptimePlugin {
+	return r.Resource.Plugin().(*uptimePlugin)
+}
+
 func newUptimeContext(plugin *uptimePlugin, warningThreshold *nagopher.Bounds, criticalThreshold *nagopher.Bounds) *uptimeContext {
 	uptimeContext := &uptimeContext{
 		Context: nagocheck.NewContext(plugin, nagopher.NewBaseContext("uptime", "%<value>s")),
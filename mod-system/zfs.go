@@ -26,6 +26,9 @@ import (
 
 type zfsPlugin struct {
 	nagocheck.Plugin
+
+	PoolNames []string
+	Discovery *nagocheck.AutoDiscovery
 }
 
 type zfsResource struct {
@@ -63,16 +66,24 @@ func newZfsPlugin() *zfsPlugin {
 			nagocheck.PluginDescription("ZFS Pool Statistics"),
 			nagocheck.PluginForceVerbose(true),
 		),
+		Discovery: nagocheck.NewAutoDiscovery("pools", true),
 	}
 }
 
+func (p *zfsPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("pool", "Names of the pools which should be checked. Defaults to all imported pools.").
+		StringsVar(&p.PoolNames)
+
+	p.Discovery.DefineFlags(node)
+	p.Discovery.DefineExcludeFlag(node, "")
+}
+
 func (p *zfsPlugin) DefineCheck() nagopher.Check {
 	check := nagopher.NewCheck("zfs", newZfsSummarizer(p))
 	check.AttachResources(newZfsResource(p))
 	check.AttachContexts(
 		nagopher.NewScalarContext("arc_size", nil, nil),
-		nagopher.NewScalarContext("arc_hits", nil, nil),
-		nagopher.NewScalarContext("arc_misses", nil, nil),
+		nagocheck.NewRatioContext(p, "arc_hit_ratio", nagocheck.RatioOfSum, "arc_hits", "arc_misses", nil, nil),
 
 		nagopher.NewStringMatchContext("pool_state", nagopher.StateCritical(), []string{"ONLINE"}),
 		nagopher.NewStringInfoContext("pool"),
@@ -88,18 +99,33 @@ func newZfsResource(plugin *zfsPlugin) *zfsResource {
 }
 
 func (r *zfsResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	plugin := r.Resource.Plugin().(*zfsPlugin)
+	if err := plugin.Discovery.Validate(plugin.PoolNames); err != nil {
+		return metrics, err
+	}
 	if err := r.Collect(warnings); err != nil {
 		return metrics, err
 	}
 
 	metrics = append(metrics,
 		nagopher.MustNewNumericMetric("arc_size", float64(r.globalStats.arcSize), "B", nil, ""),
-		nagopher.MustNewNumericMetric("arc_hits", float64(r.globalStats.arcHits), "c", nil, ""),
-		nagopher.MustNewNumericMetric("arc_misses", float64(r.globalStats.arcMisses), "c", nil, ""),
+		nagopher.MustNewNumericMetric("arc_hits", float64(r.globalStats.arcHits), "c", nil, "arc_hit_ratio"),
+		nagopher.MustNewNumericMetric("arc_misses", float64(r.globalStats.arcMisses), "c", nil, "arc_hit_ratio"),
 	)
 
-	for poolName, pool := range r.poolStats {
-		metrics = append(metrics,
+	presentNames := make([]string, 0, len(r.poolStats))
+	for poolName := range r.poolStats {
+		presentNames = append(presentNames, poolName)
+	}
+
+	// Pools which have been given explicitly but are not imported are being reported with the state MISSING
+	for _, poolName := range plugin.Discovery.Select(plugin.PoolNames, presentNames) {
+		pool, ok := r.poolStats[poolName]
+		if !ok {
+			pool = zfsPoolStats{state: "MISSING"}
+		}
+
+		metrics = append(metrics, r.Section(poolName,
 			nagopher.MustNewStringMetric(fmt.Sprintf("pool_%s_state", poolName), pool.state, "pool_state"),
 			nagopher.MustNewStringMetric(
 				fmt.Sprintf("pool_%s", poolName),
@@ -110,7 +136,7 @@ func (r *zfsResource) Probe(warnings nagopher.WarningCollection) (metrics []nago
 				),
 				"pool",
 			),
-		)
+		)...)
 	}
 
 	return metrics, nil
@@ -118,7 +144,9 @@ func (r *zfsResource) Probe(warnings nagopher.WarningCollection) (metrics []nago
 
 func newZfsSummarizer(plugin *zfsPlugin) *zfsSummarizer {
 	return &zfsSummarizer{
-		Summarizer: nagocheck.NewSummarizer(plugin),
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
 	}
 }
 
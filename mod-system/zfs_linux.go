@@ -22,6 +22,7 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
 	"github.com/snapserv/nagopher"
 	"io"
 	"os"
@@ -30,7 +31,7 @@ import (
 	"strings"
 )
 
-const zfsProcBasePath = "/proc/spl/kstat/zfs"
+const zfsProcBasePath = "spl/kstat/zfs"
 const zfsProcArcStats = "arcstats"
 const zfsPoolPathPattern = "/*/io"
 
@@ -39,11 +40,11 @@ const (
 )
 
 func (r *zfsResource) Collect(warnings nagopher.WarningCollection) error {
-	if err := r.collectGlobal(zfsProcBasePath, warnings); err != nil {
+	if err := r.collectGlobal(nagocheck.ProcPath(zfsProcBasePath), warnings); err != nil {
 		return err
 	}
 
-	if err := r.collectPools(zfsProcBasePath); err != nil {
+	if err := r.collectPools(nagocheck.ProcPath(zfsProcBasePath)); err != nil {
 		return err
 	}
 
@@ -53,6 +54,7 @@ func (r *zfsResource) Collect(warnings nagopher.WarningCollection) error {
 func (r *zfsResource) collectGlobal(basePath string, warnings nagopher.WarningCollection) error {
 	if file, err := os.Open(filepath.Join(basePath, zfsProcArcStats)); err == nil {
 		if metrics, err := r.parseGlobalStats(file, warnings); err == nil {
+			r.Plugin().Logger().Debugf("parsed %d arc statistics", len(metrics))
 			if value, ok := metrics["size"]; ok {
 				r.globalStats.arcSize = value
 			}
@@ -63,10 +65,10 @@ func (r *zfsResource) collectGlobal(basePath string, warnings nagopher.WarningCo
 				r.globalStats.arcMisses = value
 			}
 		} else {
-			warnings.Add(nagopher.NewWarning("could not parse arc statistics: %s", err.Error()))
+			warnings.Add(nagocheck.PartialFailure("could not parse arc statistics: %s", err.Error()))
 		}
 	} else {
-		warnings.Add(nagopher.NewWarning("could not gather arc statistics: %s", err.Error()))
+		warnings.Add(nagocheck.PartialFailure("could not gather arc statistics: %s", err.Error()))
 	}
 
 	return nil
@@ -108,7 +110,7 @@ func (r *zfsResource) parseGlobalStats(reader io.Reader, warnings nagopher.Warni
 }
 
 func (r *zfsResource) collectPools(basePath string) error {
-	globMatches, err := filepath.Glob(filepath.Join(zfsProcBasePath, zfsPoolPathPattern))
+	globMatches, err := filepath.Glob(filepath.Join(basePath, zfsPoolPathPattern))
 	if err != nil {
 		return fmt.Errorf("could not glob zfs pool paths: %s", err.Error())
 	}
@@ -120,6 +122,7 @@ func (r *zfsResource) collectPools(basePath string) error {
 	for _, globMatch := range globMatches {
 		poolPath := filepath.Dir(globMatch)
 		poolName := filepath.Base(poolPath)
+		r.Plugin().Logger().Debugf("collecting statistics of pool %s from %s", poolName, poolPath)
 		poolStats, err := r.updatePoolStats(poolPath)
 
 		if err != nil {
@@ -0,0 +1,45 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modtls
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+	"time"
+)
+
+type tlsModule struct {
+	nagocheck.Module
+
+	Timeout time.Duration
+}
+
+// NewTLSModule instantiates tlsModule and all contained plugins
+func NewTLSModule() nagocheck.Module {
+	return &tlsModule{
+		Module: nagocheck.NewModule("tls",
+			nagocheck.ModuleDescription("TLS"),
+			nagocheck.ModulePlugin(newPolicyPlugin()),
+		),
+	}
+}
+
+func (m *tlsModule) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("timeout", "Specifies the timeout for each connection attempt to the remote server.").
+		Short('t').Default("10s").DurationVar(&m.Timeout)
+}
@@ -0,0 +1,396 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modtls
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+	"strings"
+)
+
+type policyPlugin struct {
+	nagocheck.Plugin
+
+	Address     string
+	ServerName  string
+	PolicyFile  string
+	RequireOCSP bool
+	IsCritical  bool
+	Discovery   nagocheck.TargetDiscovery
+}
+
+type policyResource struct {
+	nagocheck.Resource
+
+	policy  Policy
+	results []policyTargetResult
+}
+
+type policyTargetResult struct {
+	target           nagocheck.Target
+	err              error
+	offeredProtocols []string
+	offeredCiphers   []string
+	hasOCSPStapling  bool
+}
+
+type policySummarizer struct {
+	nagocheck.Summarizer
+
+	resource *policyResource
+}
+
+type ocspStaplingContext struct {
+	nagocheck.Context
+
+	resource     *policyResource
+	problemState nagopher.State
+}
+
+func newPolicyPlugin() *policyPlugin {
+	return &policyPlugin{
+		Plugin: nagocheck.NewPlugin("policy",
+			nagocheck.PluginDescription("Protocol and Cipher Policy"),
+			nagocheck.PluginDefaultThresholds(false),
+		),
+	}
+}
+
+func (p *policyPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("address", "Address of the TLS server formatted as host:port.").
+		Required().StringVar(&p.Address)
+
+	node.Flag("server-name", "Server name sent using SNI, defaults to the host part of the given address.").
+		Short('s').StringVar(&p.ServerName)
+
+	node.Flag("policy", "Path to a JSON policy file with the keys forbidden_protocols, forbidden_ciphers and "+
+		"require_ocsp_stapling. Defaults to forbidding TLS 1.0/1.1 and all insecure cipher suites.").
+		Short('p').ExistingFileVar(&p.PolicyFile)
+
+	node.Flag("require-ocsp", "Require the server to staple OCSP responses, regardless of the policy file.").
+		BoolVar(&p.RequireOCSP)
+
+	node.Flag("critical", "Return CRITICAL instead of WARNING when the server violates the policy.").
+		Short('c').BoolVar(&p.IsCritical)
+
+	p.Discovery.DefineFlags(node)
+}
+
+func (p *policyPlugin) DefineCheck() nagopher.Check {
+	var warningThreshold, criticalThreshold *nagopher.Bounds
+
+	zeroBounds := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(0))
+	problemState := nagopher.StateWarning()
+	if p.IsCritical {
+		problemState = nagopher.StateCritical()
+		criticalThreshold = &zeroBounds
+	} else {
+		warningThreshold = &zeroBounds
+	}
+
+	resource := newPolicyResource(p)
+	check := nagopher.NewCheck("tls_policy", newPolicySummarizer(p, resource))
+	check.AttachResources(resource)
+	check.AttachContexts(
+		nagopher.NewStringInfoContext("info_protocols"),
+		nagopher.NewStringInfoContext("info_ciphers"),
+	)
+
+	if p.Discovery.Enabled() && p.Discovery.Quorum > 0 {
+		// Individual targets are only informational when a quorum is given, as the state solely depends on the amount
+		// of targets passing the policy
+		quorumBounds := nagopher.NewBounds(
+			nagopher.LowerBound(float64(p.Discovery.Quorum)),
+			nagopher.UpperBound(math.Inf(1)),
+		)
+
+		check.AttachContexts(
+			nagopher.NewStringInfoContext("reachable"),
+			nagopher.NewScalarContext("weak_protocols", nil, nil),
+			nagopher.NewScalarContext("weak_ciphers", nil, nil),
+			newOCSPStaplingContext(p, resource, nagopher.StateOk()),
+			nagopher.NewScalarContext("targets_passing", nil, &quorumBounds),
+			nagopher.NewScalarContext("targets_total", nil, nil),
+		)
+
+		return check
+	}
+
+	check.AttachContexts(
+		nagopher.NewStringMatchContext("reachable", nagopher.StateCritical(), []string{"REACHABLE"}),
+		nagopher.NewScalarContext("weak_protocols", warningThreshold, criticalThreshold),
+		nagopher.NewScalarContext("weak_ciphers", warningThreshold, criticalThreshold),
+		newOCSPStaplingContext(p, resource, problemState),
+		nagopher.NewScalarContext("targets_passing", nil, nil),
+		nagopher.NewScalarContext("targets_total", nil, nil),
+	)
+
+	return check
+}
+
+func (p *policyPlugin) ThisModule() *tlsModule {
+	return p.Plugin.Module().(*tlsModule)
+}
+
+func newPolicyResource(plugin *policyPlugin) *policyResource {
+	return &policyResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *policyResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	if !r.ThisPlugin().Discovery.Enabled() {
+		result := r.results[0]
+		if result.err != nil {
+			return metrics, result.err
+		}
+
+		return result.metrics(""), nil
+	}
+
+	passing := 0
+	for _, result := range r.results {
+		if result.passes(r.policy) {
+			passing++
+		}
+
+		prefix := result.target.Address + "_"
+		if result.err != nil {
+			metrics = append(metrics, r.Section(result.target.Address,
+				nagopher.MustNewStringMetric(prefix+"reachable", "UNREACHABLE", "reachable"),
+			)...)
+			warnings.Add(nagopher.NewWarning("%s: %s", result.target.Address, result.err.Error()))
+			continue
+		}
+
+		metrics = append(metrics, r.Section(result.target.Address, append(result.metrics(prefix),
+			nagopher.MustNewStringMetric(prefix+"reachable", "REACHABLE", "reachable"),
+		)...)...)
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("targets_passing", float64(passing), "", nil, ""),
+		nagopher.MustNewNumericMetric("targets_total", float64(len(r.results)), "", nil, ""),
+	)
+
+	return metrics, nil
+}
+
+// metrics returns the metrics of a single target, using the given prefix for metric names so that the results of
+// multiple targets can be told apart while still being evaluated by the same contexts
+func (r policyTargetResult) metrics(prefix string) (metrics []nagopher.Metric) {
+	ocspStapling := "MISSING"
+	if r.hasOCSPStapling {
+		ocspStapling = "STAPLED"
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric(prefix+"weak_protocols", float64(len(r.offeredProtocols)), "", nil, "weak_protocols"),
+		nagopher.MustNewNumericMetric(prefix+"weak_ciphers", float64(len(r.offeredCiphers)), "", nil, "weak_ciphers"),
+		nagopher.MustNewStringMetric(prefix+"ocsp_stapling", ocspStapling, "ocsp_stapling"),
+	)
+
+	if len(r.offeredProtocols) > 0 {
+		metrics = append(metrics, nagopher.MustNewStringMetric(prefix+"info_protocols",
+			fmt.Sprintf("forbidden protocols offered: %s", strings.Join(r.offeredProtocols, ", ")), "info_protocols"))
+	}
+	if len(r.offeredCiphers) > 0 {
+		metrics = append(metrics, nagopher.MustNewStringMetric(prefix+"info_ciphers",
+			fmt.Sprintf("forbidden ciphers offered: %s", strings.Join(r.offeredCiphers, ", ")), "info_ciphers"))
+	}
+
+	return metrics
+}
+
+// passes returns true if the target was reachable and did not violate the given policy
+func (r policyTargetResult) passes(policy Policy) bool {
+	return r.err == nil && len(r.offeredProtocols) == 0 && len(r.offeredCiphers) == 0 &&
+		(r.hasOCSPStapling || !policy.RequireOCSPStapling)
+}
+
+func (r *policyResource) Collect() (err error) {
+	plugin := r.ThisPlugin()
+
+	r.policy = DefaultPolicy()
+	if plugin.PolicyFile != "" {
+		if r.policy, err = LoadPolicy(plugin.PolicyFile); err != nil {
+			return err
+		}
+	}
+	if plugin.RequireOCSP {
+		r.policy.RequireOCSPStapling = true
+	}
+
+	targets, err := plugin.Discovery.Targets(plugin.Address, plugin.ServerName, plugin.ThisModule().Timeout)
+	if err != nil {
+		return err
+	}
+
+	r.results = make([]policyTargetResult, 0, len(targets))
+	for _, target := range targets {
+		result, err := r.collectTarget(target)
+		if err != nil {
+			return err
+		}
+
+		r.results = append(r.results, result)
+	}
+
+	return nil
+}
+
+// collectTarget probes a single target for all forbidden protocols and ciphers. Connection failures are stored within
+// the result instead of being returned, as they only affect this target when discovery is being used.
+func (r *policyResource) collectTarget(target nagocheck.Target) (result policyTargetResult, err error) {
+	result.target = target
+	prober := Prober{
+		Address:    target.Address,
+		ServerName: target.ServerName,
+		Timeout:    r.ThisPlugin().ThisModule().Timeout,
+	}
+
+	if result.hasOCSPStapling, err = prober.Staples(); err != nil {
+		result.err = fmt.Errorf("could not establish TLS connection: %s", err.Error())
+		return result, nil
+	}
+
+	for _, protocol := range r.policy.ForbiddenProtocols {
+		offered, err := prober.OffersProtocol(protocol)
+		if err != nil {
+			return result, err
+		}
+		if offered {
+			result.offeredProtocols = append(result.offeredProtocols, protocol)
+		}
+	}
+
+	for _, cipher := range r.policy.ForbiddenCiphers {
+		offered, err := prober.OffersCipher(cipher)
+		if err != nil {
+			return result, err
+		}
+		if offered {
+			result.offeredCiphers = append(result.offeredCiphers, cipher)
+		}
+	}
+
+	return result, nil
+}
+
+func (r *policyResource) ThisPlugin() *policyPlugin {
+	return r.Resource.Plugin().(*policyPlugin)
+}
+
+func newPolicySummarizer(plugin *policyPlugin, resource *policyResource) *policySummarizer {
+	return &policySummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin),
+		resource:   resource,
+	}
+}
+
+func (s *policySummarizer) Ok(check nagopher.Check) string {
+	if s.ThisPlugin().Discovery.Enabled() {
+		return s.targetSummary(check)
+	}
+
+	return fmt.Sprintf("%s complies with TLS policy", s.ThisPlugin().Address)
+}
+
+func (s *policySummarizer) Problem(check nagopher.Check) string {
+	if s.ThisPlugin().Discovery.Enabled() {
+		if len(s.resource.results) == 0 {
+			return s.Summarizer.Problem(check)
+		}
+
+		return s.targetSummary(check)
+	}
+
+	var violations []string
+	resultCollection := check.Results()
+
+	if count := resultCollection.GetNumericMetricValue("weak_protocols").OrElse(0); count > 0 {
+		violations = append(violations, fmt.Sprintf("%d forbidden protocols", int(count)))
+	}
+	if count := resultCollection.GetNumericMetricValue("weak_ciphers").OrElse(0); count > 0 {
+		violations = append(violations, fmt.Sprintf("%d forbidden ciphers", int(count)))
+	}
+	if len(violations) > 0 {
+		violations = []string{"offers " + strings.Join(violations, " and ")}
+	}
+
+	if result, err := resultCollection.GetByMetricName("ocsp_stapling").Get(); err == nil && result != nil {
+		if state, err := result.State().Get(); err == nil && state != nagopher.StateOk() {
+			violations = append(violations, "missing OCSP stapling")
+		}
+	}
+
+	if len(violations) == 0 {
+		return s.Summarizer.Problem(check)
+	}
+
+	return fmt.Sprintf("%s violates TLS policy: %s", s.ThisPlugin().Address, strings.Join(violations, ", "))
+}
+
+func (s *policySummarizer) targetSummary(check nagopher.Check) string {
+	resultCollection := check.Results()
+	passing := int(resultCollection.GetNumericMetricValue("targets_passing").OrElse(0))
+	total := int(resultCollection.GetNumericMetricValue("targets_total").OrElse(0))
+
+	return fmt.Sprintf("%d of %d targets of %s comply with TLS policy (%d required)",
+		passing, total, s.ThisPlugin().Address, s.ThisPlugin().Discovery.Required(total))
+}
+
+func (s *policySummarizer) ThisPlugin() *policyPlugin {
+	return s.Summarizer.Plugin().(*policyPlugin)
+}
+
+func newOCSPStaplingContext(plugin *policyPlugin, resource *policyResource, problemState nagopher.State) *ocspStaplingContext {
+	return &ocspStaplingContext{
+		Context:      nagocheck.NewContext(plugin, nagopher.NewBaseContext("ocsp_stapling", "OCSP stapling is %<value>s")),
+		resource:     resource,
+		problemState: problemState,
+	}
+}
+
+func (c *ocspStaplingContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	stringMetric, ok := metric.(nagopher.StringMetric)
+	if !ok {
+		return nagocheck.NewInvalidMetricTypeResult(c, metric, resource)
+	}
+
+	// Requirement of OCSP stapling is only known after the policy file has been loaded by the resource
+	if c.resource.policy.RequireOCSPStapling && stringMetric.Value() != "STAPLED" {
+		return nagopher.NewResult(
+			nagopher.ResultState(c.problemState),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint("required by policy"),
+		)
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(nagopher.StateOk()),
+		nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+	)
+}
@@ -0,0 +1,188 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package modtls
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+// Policy describes which protocol versions and cipher suites a TLS server must not offer and which features it has to
+// support. Policies can be loaded from JSON files using LoadPolicy().
+type Policy struct {
+	ForbiddenProtocols  []string `json:"forbidden_protocols"`
+	ForbiddenCiphers    []string `json:"forbidden_ciphers"`
+	RequireOCSPStapling bool     `json:"require_ocsp_stapling"`
+}
+
+// Prober establishes TLS connections with a remote server to determine the offered protocol versions, cipher suites
+// and features. Certificates are intentionally not being verified, as only the server configuration is of interest.
+type Prober struct {
+	Address    string
+	ServerName string
+	Timeout    time.Duration
+}
+
+var protocolVersions = map[string]uint16{
+	"TLS1.0": tls.VersionTLS10,
+	"TLS1.1": tls.VersionTLS11,
+	"TLS1.2": tls.VersionTLS12,
+	"TLS1.3": tls.VersionTLS13,
+}
+
+// DefaultPolicy returns the policy being used if no policy file was given, which forbids TLS 1.0/1.1 as well as all
+// cipher suites considered insecure by the Go standard library.
+func DefaultPolicy() Policy {
+	policy := Policy{
+		ForbiddenProtocols: []string{"TLS1.0", "TLS1.1"},
+	}
+
+	for _, cipherSuite := range tls.InsecureCipherSuites() {
+		policy.ForbiddenCiphers = append(policy.ForbiddenCiphers, cipherSuite.Name)
+	}
+
+	return policy
+}
+
+// LoadPolicy reads a policy from the given JSON file. Fields which are missing in the file inherit the values of
+// DefaultPolicy().
+func LoadPolicy(path string) (Policy, error) {
+	policy := DefaultPolicy()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return policy, fmt.Errorf("could not read policy file: %s", err.Error())
+	}
+
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return policy, fmt.Errorf("could not parse policy file: %s", err.Error())
+	}
+
+	return policy, policy.Validate()
+}
+
+// Validate ensures that all protocol versions and cipher suites referenced by the policy are known
+func (p Policy) Validate() error {
+	for _, protocol := range p.ForbiddenProtocols {
+		if _, ok := protocolVersions[strings.ToUpper(protocol)]; !ok {
+			return fmt.Errorf("unknown protocol version in policy: %s", protocol)
+		}
+	}
+
+	for _, cipher := range p.ForbiddenCiphers {
+		if _, ok := cipherSuiteByName(cipher); !ok {
+			return fmt.Errorf("unknown cipher suite in policy: %s", cipher)
+		}
+	}
+
+	return nil
+}
+
+// OffersProtocol returns true if the server accepts a handshake using the given protocol version, e.g. TLS1.0. Only a
+// rejected handshake is considered as protocol not being offered, while e.g. connection errors are being returned.
+func (p Prober) OffersProtocol(protocol string) (bool, error) {
+	version, ok := protocolVersions[strings.ToUpper(protocol)]
+	if !ok {
+		return false, fmt.Errorf("unknown protocol version: %s", protocol)
+	}
+
+	_, err := p.handshake(&tls.Config{MinVersion: version, MaxVersion: version})
+	return handshakeOutcome(err)
+}
+
+// OffersCipher returns true if the server accepts a handshake using the given cipher suite. As TLS 1.3 cipher suites
+// are not configurable, the handshake is being limited to TLS 1.2 and lower.
+func (p Prober) OffersCipher(cipher string) (bool, error) {
+	cipherSuite, ok := cipherSuiteByName(cipher)
+	if !ok {
+		return false, fmt.Errorf("unknown cipher suite: %s", cipher)
+	}
+
+	_, err := p.handshake(&tls.Config{
+		MinVersion:   tls.VersionTLS10,
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{cipherSuite.ID},
+	})
+	return handshakeOutcome(err)
+}
+
+// Staples returns true if the server staples an OCSP response during a regular handshake. As this handshake accepts
+// all protocol versions down to TLS1.0, it also serves as a connectivity check before probing for specific protocols
+// or ciphers, which succeeds for servers only offering outdated protocols as well.
+func (p Prober) Staples() (bool, error) {
+	state, err := p.handshake(&tls.Config{MinVersion: tls.VersionTLS10})
+	if err != nil {
+		return false, err
+	}
+
+	return len(state.OCSPResponse) > 0, nil
+}
+
+func (p Prober) handshake(config *tls.Config) (state tls.ConnectionState, _ error) {
+	config.ServerName = p.ServerName
+	config.InsecureSkipVerify = true
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(p.Address)
+	}
+
+	dialer := &net.Dialer{Timeout: p.Timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", p.Address, config)
+	if err != nil {
+		return state, err
+	}
+
+	state = conn.ConnectionState()
+	_ = conn.Close()
+
+	return state, nil
+}
+
+// handshakeOutcome returns whether a handshake succeeded, considering alerts sent by either side as rejection of the
+// offered protocols or ciphers. All other errors are being returned, e.g. connection failures or timeouts.
+func handshakeOutcome(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "remote error" || opErr.Op == "local error") {
+		return false, nil
+	} else if opErr == nil && strings.HasPrefix(err.Error(), "tls: ") {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("could not complete TLS handshake: %s", err.Error())
+}
+
+func cipherSuiteByName(name string) (*tls.CipherSuite, bool) {
+	cipherSuites := append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+	for _, cipherSuite := range cipherSuites {
+		if strings.EqualFold(cipherSuite.Name, name) {
+			return cipherSuite, true
+		}
+	}
+
+	return nil, false
+}
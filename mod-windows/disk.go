@@ -0,0 +1,191 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modwindows
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"sort"
+	"strings"
+)
+
+type diskPlugin struct {
+	nagocheck.Plugin
+
+	Drives       []string
+	FreeWarning  nagopher.OptionalBounds
+	FreeCritical nagopher.OptionalBounds
+}
+
+type diskResource struct {
+	nagocheck.Resource
+
+	disks []win32LogicalDisk
+}
+
+type diskSummarizer struct {
+	nagocheck.Summarizer
+}
+
+// win32LogicalDisk contains the properties of WMI class Win32_LogicalDisk used by the disk plugin
+type win32LogicalDisk struct {
+	DeviceID   string
+	VolumeName string
+	Size       uint64
+	FreeSpace  uint64
+}
+
+// driveTypeLocalDisk is the value of Win32_LogicalDisk.DriveType for local fixed disks
+const driveTypeLocalDisk = 3
+
+func newDiskPlugin() *diskPlugin {
+	return &diskPlugin{
+		Plugin: nagocheck.NewPlugin("disk",
+			nagocheck.PluginDescription("Disk Usage"),
+			nagocheck.PluginHysteresis(true),
+			nagocheck.PluginCapacityContexts("usage"),
+		),
+	}
+}
+
+func (p *diskPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("drive", "Drive letters of the disks which should be checked, e.g. C: or D:. Defaults to all local "+
+		"fixed disks.").
+		StringsVar(&p.Drives)
+
+	nagocheck.SizeBoundsVar(node.Flag("free-warning", "Warning threshold for free disk space formatted as Nagios "+
+		"range specifier, using sizes like 512MB: or 2GiB: (bytes by default)."), &p.FreeWarning)
+	nagocheck.SizeBoundsVar(node.Flag("free-critical", "Critical threshold for free disk space formatted as Nagios "+
+		"range specifier, using sizes like 512MB: or 2GiB: (bytes by default)."), &p.FreeCritical)
+}
+
+func (p *diskPlugin) DefineCheck() nagopher.Check {
+	check := nagopher.NewCheck("disk", newDiskSummarizer(p))
+	check.AttachResources(newDiskResource(p))
+	check.AttachContexts(
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"usage",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+
+		nagopher.NewScalarContext("total", nil, nil),
+		nagopher.NewScalarContext("free",
+			nagopher.OptionalBoundsPtr(p.FreeWarning),
+			nagopher.OptionalBoundsPtr(p.FreeCritical),
+		),
+	)
+
+	return check
+}
+
+func newDiskResource(plugin *diskPlugin) *diskResource {
+	return &diskResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *diskResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.BoundsOpt(nagopher.LowerBound(0)))
+	percentRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(100))
+
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	for _, disk := range r.disks {
+		name := strings.ToLower(strings.TrimSuffix(disk.DeviceID, ":"))
+		usagePercent := nagocheck.Round(100-(float64(disk.FreeSpace)/float64(disk.Size)*100), 2)
+
+		metrics = append(metrics, r.Section(disk.DeviceID,
+			nagopher.MustNewNumericMetric(name+"_usage", usagePercent, "%", &percentRange, "usage"),
+			nagopher.MustNewNumericMetric(name+"_total", float64(disk.Size), "B", &valueRange, "total"),
+			nagopher.MustNewNumericMetric(name+"_free", float64(disk.FreeSpace), "B", &valueRange, "free"),
+		)...)
+	}
+
+	return metrics, nil
+}
+
+func (r *diskResource) Collect() error {
+	drives := r.ThisPlugin().Drives
+
+	query := fmt.Sprintf("SELECT DeviceID, VolumeName, Size, FreeSpace FROM Win32_LogicalDisk WHERE DriveType = %d",
+		driveTypeLocalDisk)
+	if len(drives) > 0 {
+		conditions := make([]string, len(drives))
+		for index, drive := range drives {
+			conditions[index] = "DeviceID = " + quoteWQL(strings.ToUpper(strings.TrimSuffix(drive, ":"))+":")
+		}
+		query = "SELECT DeviceID, VolumeName, Size, FreeSpace FROM Win32_LogicalDisk WHERE " +
+			strings.Join(conditions, " OR ")
+	}
+
+	var disks []win32LogicalDisk
+	if err := queryWMI(query, &disks); err != nil {
+		return err
+	}
+
+	// Disks without size are removable drives without media, which can not be evaluated
+	r.disks = nil
+	for _, disk := range disks {
+		if disk.Size > 0 {
+			r.disks = append(r.disks, disk)
+		}
+	}
+	sort.Slice(r.disks, func(i, j int) bool {
+		return r.disks[i].DeviceID < r.disks[j].DeviceID
+	})
+
+	if len(drives) > 0 && len(r.disks) != len(drives) {
+		return fmt.Errorf("could not find all requested drives, found %d out of %d", len(r.disks), len(drives))
+	}
+	if len(r.disks) == 0 {
+		return fmt.Errorf("no disks available")
+	}
+
+	return nil
+}
+
+func (r *diskResource) ThisPlugin() *diskPlugin {
+	return r.Resource.Plugin().(*diskPlugin)
+}
+
+func newDiskSummarizer(plugin *diskPlugin) *diskSummarizer {
+	return &diskSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *diskSummarizer) Ok(check nagopher.Check) string {
+	var parts []string
+	for _, result := range check.Results().Get() {
+		metric, err := result.Metric().Get()
+		if err != nil || metric.ContextName() != "usage" {
+			continue
+		}
+
+		drive := strings.ToUpper(strings.TrimSuffix(metric.Name(), "_usage"))
+		parts = append(parts, fmt.Sprintf("%s: %s%% used", drive, metric.ValueString()))
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,191 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modwindows
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type eventlogPlugin struct {
+	nagocheck.Plugin
+
+	LogNames        []string
+	IncludeWarnings bool
+	Source          *regexp.Regexp
+	Window          time.Duration
+}
+
+type eventlogResource struct {
+	nagocheck.Resource `json:"-"`
+
+	counts map[string]int
+
+	LastRun int64 `json:"lastRun"`
+}
+
+type eventlogSummarizer struct {
+	nagocheck.Summarizer
+}
+
+// win32NTLogEvent contains the properties of WMI class Win32_NTLogEvent used by the eventlog plugin
+type win32NTLogEvent struct {
+	RecordNumber uint32
+	SourceName   string
+}
+
+// Values of Win32_NTLogEvent.EventType for errors and warnings
+const (
+	eventTypeError   = 1
+	eventTypeWarning = 2
+)
+
+// wmiDateTimeFormat is the layout of CIM_DATETIME values in UTC, which are used for comparing TimeGenerated
+const wmiDateTimeFormat = "20060102150405.000000+000"
+
+func newEventlogPlugin() *eventlogPlugin {
+	return &eventlogPlugin{
+		Plugin: nagocheck.NewPlugin("eventlog",
+			nagocheck.PluginDescription("Event Log"),
+		),
+	}
+}
+
+func (p *eventlogPlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Flag("log", "Name of the event log which should be checked. Can be specified multiple times.").
+		Short('l').Default("Application", "System").StringsVar(&p.LogNames)
+
+	node.Flag("warnings", "Count warnings in addition to errors.").
+		BoolVar(&p.IncludeWarnings)
+
+	node.Flag("source", "Regular expression matching the sources of events which should be counted, e.g. "+
+		"'^(Disk|Ntfs)$'. Defaults to all sources.").
+		RegexpVar(&p.Source)
+
+	nagocheck.DurationVar(node.Flag("window", "Time window of events which are being counted during the first "+
+		"execution or if persistent data is not available, e.g. 1h. Afterwards, all events since the previous "+
+		"execution are being counted.").Default("1h"), &p.Window)
+}
+
+func (p *eventlogPlugin) DefineCheck() nagopher.Check {
+	check := nagopher.NewCheck("eventlog", newEventlogSummarizer(p))
+	check.AttachResources(newEventlogResource(p))
+	check.AttachContexts(
+		nagopher.NewScalarContext(
+			"events",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		),
+	)
+
+	return check
+}
+
+func newEventlogResource(plugin *eventlogPlugin) *eventlogResource {
+	resource := &eventlogResource{}
+	resource.Resource = nagocheck.NewResource(plugin,
+		nagocheck.ResourcePersistence(strings.Join(plugin.LogNames, "_"), resource, &resource),
+	)
+
+	return resource
+}
+
+func (r *eventlogResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.BoundsOpt(nagopher.LowerBound(0)))
+
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	for _, logName := range r.ThisPlugin().LogNames {
+		metrics = append(metrics, nagopher.MustNewNumericMetric(
+			strings.ToLower(strings.Replace(logName, " ", "_", -1)), float64(r.counts[logName]), "",
+			&valueRange, "events",
+		))
+	}
+
+	return metrics, nil
+}
+
+// Collect counts the events of all event logs since the previous execution, falling back to the configured window
+func (r *eventlogResource) Collect() error {
+	plugin := r.ThisPlugin()
+	now := time.Now()
+
+	since := now.Add(-plugin.Window)
+	if r.LastRun != 0 {
+		since = time.Unix(r.LastRun, 0)
+	}
+
+	eventTypes := fmt.Sprintf("EventType = %d", eventTypeError)
+	if plugin.IncludeWarnings {
+		eventTypes = fmt.Sprintf("(EventType = %d OR EventType = %d)", eventTypeError, eventTypeWarning)
+	}
+
+	r.counts = make(map[string]int)
+	for _, logName := range plugin.LogNames {
+		query := fmt.Sprintf("SELECT RecordNumber, SourceName FROM Win32_NTLogEvent WHERE Logfile = %s AND %s AND "+
+			"TimeGenerated > '%s'", quoteWQL(logName), eventTypes, since.UTC().Format(wmiDateTimeFormat))
+
+		var events []win32NTLogEvent
+		if err := queryWMI(query, &events); err != nil {
+			return fmt.Errorf("could not read event log [%s]: %s", logName, err.Error())
+		}
+
+		for _, event := range events {
+			if plugin.Source == nil || plugin.Source.MatchString(event.SourceName) {
+				r.counts[logName]++
+			}
+		}
+	}
+
+	r.LastRun = now.Unix()
+	return nil
+}
+
+func (r *eventlogResource) ThisPlugin() *eventlogPlugin {
+	return r.Resource.Plugin().(*eventlogPlugin)
+}
+
+func newEventlogSummarizer(plugin *eventlogPlugin) *eventlogSummarizer {
+	return &eventlogSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *eventlogSummarizer) Ok(check nagopher.Check) string {
+	var parts []string
+	for _, result := range check.Results().Get() {
+		if metric, err := result.Metric().Get(); err == nil {
+			parts = append(parts, fmt.Sprintf("%s: %s", metric.Name(), metric.ValueString()))
+		}
+	}
+
+	eventType := "errors"
+	if s.Plugin().(*eventlogPlugin).IncludeWarnings {
+		eventType = "errors/warnings"
+	}
+
+	return fmt.Sprintf("%s since last run (%s)", eventType, strings.Join(parts, ", "))
+}
@@ -0,0 +1,45 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modwindows
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+	"strings"
+)
+
+type windowsModule struct {
+	nagocheck.Module
+}
+
+// NewWindowsModule instantiates windowsModule and all contained plugins, which query the local system using WMI and
+// are therefore only supported on Windows
+func NewWindowsModule() nagocheck.Module {
+	return &windowsModule{
+		Module: nagocheck.NewModule("windows",
+			nagocheck.ModuleDescription("Windows (WMI)"),
+			nagocheck.ModulePlugin(newServicePlugin()),
+			nagocheck.ModulePlugin(newDiskPlugin()),
+			nagocheck.ModulePlugin(newEventlogPlugin()),
+		),
+	}
+}
+
+// quoteWQL returns the given value as WQL string literal
+func quoteWQL(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
@@ -0,0 +1,183 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modwindows
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"regexp"
+	"strings"
+)
+
+type servicePlugin struct {
+	nagocheck.Plugin
+
+	ServiceNames []string
+	Exclude      *regexp.Regexp
+	IsCritical   bool
+}
+
+type serviceResource struct {
+	nagocheck.Resource
+
+	services []win32Service
+}
+
+type serviceSummarizer struct {
+	nagocheck.Summarizer
+}
+
+// win32Service contains the properties of WMI class Win32_Service used by the service plugin
+type win32Service struct {
+	Name        string
+	DisplayName string
+	State       string
+	StartMode   string
+}
+
+func newServicePlugin() *servicePlugin {
+	return &servicePlugin{
+		Plugin: nagocheck.NewPlugin("service",
+			nagocheck.PluginDescription("Services"),
+			nagocheck.PluginDefaultThresholds(false),
+		),
+	}
+}
+
+func (p *servicePlugin) DefineFlags(node nagocheck.KingpinNode) {
+	node.Arg("name", "Names of the services which must be running. Defaults to all services with start mode "+
+		"'Auto', which is equivalent to the services started automatically during boot.").
+		StringsVar(&p.ServiceNames)
+
+	node.Flag("exclude", "Regular expression matching the names of services which should be ignored, e.g. "+
+		"'^(gupdate|sppsvc)$'. Only applies when no service names have been given.").
+		RegexpVar(&p.Exclude)
+
+	node.Flag("critical", "Toggles if stopped services are critical or not. This will influence the resulting "+
+		"check state by either returning WARNING or CRITICAL as the result.").
+		Short('c').Default("true").BoolVar(&p.IsCritical)
+}
+
+func (p *servicePlugin) DefineCheck() nagopher.Check {
+	problemState := nagopher.StateWarning()
+	if p.IsCritical {
+		problemState = nagopher.StateCritical()
+	}
+
+	check := nagopher.NewCheck("service", newServiceSummarizer(p))
+	check.AttachResources(newServiceResource(p))
+	check.AttachContexts(
+		nagopher.NewStringMatchContext("state", problemState, []string{"RUNNING"}),
+	)
+
+	return check
+}
+
+func newServiceResource(plugin *servicePlugin) *serviceResource {
+	return &serviceResource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *serviceResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	for _, service := range r.services {
+		metrics = append(metrics, r.Section(service.DisplayName,
+			nagopher.MustNewStringMetric(service.Name, service.State, "state"),
+		)...)
+	}
+
+	return metrics, nil
+}
+
+// Collect fetches the state of all requested services, where services which do not exist are being reported with the
+// state 'MISSING'
+func (r *serviceResource) Collect() error {
+	plugin := r.ThisPlugin()
+
+	query := "SELECT Name, DisplayName, State, StartMode FROM Win32_Service WHERE StartMode = 'Auto'"
+	if len(plugin.ServiceNames) > 0 {
+		conditions := make([]string, len(plugin.ServiceNames))
+		for index, serviceName := range plugin.ServiceNames {
+			conditions[index] = "Name = " + quoteWQL(serviceName)
+		}
+		query = "SELECT Name, DisplayName, State, StartMode FROM Win32_Service WHERE " + strings.Join(conditions, " OR ")
+	}
+
+	var services []win32Service
+	if err := queryWMI(query, &services); err != nil {
+		return err
+	}
+
+	r.services = nil
+	for _, service := range services {
+		if len(plugin.ServiceNames) == 0 && plugin.Exclude != nil && plugin.Exclude.MatchString(service.Name) {
+			continue
+		}
+
+		service.State = strings.ToUpper(strings.Replace(service.State, " ", "_", -1))
+		r.services = append(r.services, service)
+	}
+
+	for _, serviceName := range plugin.ServiceNames {
+		if !r.hasService(serviceName) {
+			r.services = append(r.services, win32Service{Name: serviceName, DisplayName: serviceName, State: "MISSING"})
+		}
+	}
+
+	if len(r.services) == 0 {
+		return fmt.Errorf("no services available")
+	}
+
+	return nil
+}
+
+func (r *serviceResource) hasService(name string) bool {
+	for _, service := range r.services {
+		if strings.EqualFold(service.Name, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *serviceResource) ThisPlugin() *servicePlugin {
+	return r.Resource.Plugin().(*servicePlugin)
+}
+
+func newServiceSummarizer(plugin *servicePlugin) *serviceSummarizer {
+	return &serviceSummarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *serviceSummarizer) Ok(check nagopher.Check) string {
+	serviceCount := len(check.Results().Get())
+	if serviceCount == 1 {
+		return fmt.Sprintf("%d service running", serviceCount)
+	}
+
+	return fmt.Sprintf("%d services running", serviceCount)
+}
@@ -0,0 +1,33 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package modwindows
+
+import (
+	"fmt"
+	"github.com/StackExchange/wmi"
+)
+
+// queryWMI executes the given WQL query within the default namespace root\cimv2 and stores the results into the given
+// slice of structs, whose fields must be named like the selected properties
+func queryWMI(query string, target interface{}) error {
+	if err := wmi.Query(query, target); err != nil {
+		return fmt.Errorf("could not execute WMI query: %s", err.Error())
+	}
+
+	return nil
+}
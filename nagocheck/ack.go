@@ -0,0 +1,212 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"strings"
+	"time"
+)
+
+// acknowledgement marks a known failure of a check, which gets downgraded from CRITICAL to WARNING until it expires or
+// the check recovers, e.g. for a degraded array awaiting replacement parts
+type acknowledgement struct {
+	Service string    `json:"service"`
+	Until   time.Time `json:"until"`
+	Comment string    `json:"comment"`
+	Created time.Time `json:"created"`
+}
+
+// ackPersistenceVersion is the version of the layout of persisted acknowledgements, which must be increased on changes
+const ackPersistenceVersion = 1
+
+type acknowledgedCheck struct {
+	nagopher.Check
+	ack *acknowledgement
+}
+
+type ackTool struct {
+	service string
+	until   string
+	comment string
+	remove  bool
+}
+
+// NewAckTool instantiates a Tool, which acknowledges the failure of a check by recording it within the persistence
+// backend, so that subsequent executions report WARNING instead of CRITICAL until the acknowledgement expires.
+func NewAckTool() Tool {
+	return &ackTool{}
+}
+
+func (t *ackTool) Name() string {
+	return "ack"
+}
+
+func (t *ackTool) DefineCommand(app *kingpin.Application) {
+	node := app.Command(t.Name(), "Acknowledge a known failure of a check, downgrading it from CRITICAL to WARNING.")
+
+	node.Arg("check", "Service name of the check, which defaults to <module>-<plugin> unless --submit-service is "+
+		"used, e.g. system-mdraid. Checks with arguments or flags only honor acknowledgements when being executed "+
+		"with --submit-service, so that each invocation has its own acknowledgement.").
+		Required().StringVar(&t.service)
+
+	node.Flag("until", "Expiry of the acknowledgement, either as duration (e.g. 72h) or as date formatted as "+
+		"RFC3339 or YYYY-MM-DD.").
+		Short('u').Default("24h").StringVar(&t.until)
+
+	node.Flag("comment", "Comment which gets appended to the check output, e.g. the ticket number.").
+		Short('m').StringVar(&t.comment)
+
+	node.Flag("remove", "Remove an existing acknowledgement instead of adding one.").
+		BoolVar(&t.remove)
+}
+
+func (t *ackTool) Execute(modules map[string]Module) error {
+	ack := &acknowledgement{
+		Service: t.service,
+		Comment: t.comment,
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+
+	if !t.remove {
+		until, err := parseAckExpiry(t.until, ack.Created)
+		if err != nil {
+			return err
+		}
+		if !until.After(ack.Created) {
+			return fmt.Errorf("acknowledgement expiry must be in the future: %s", until.Format(time.RFC3339))
+		}
+		ack.Until = until
+	}
+
+	if err := ack.store(); err != nil {
+		return err
+	}
+
+	if t.remove {
+		fmt.Printf("removed acknowledgement of %s\n", ack.Service)
+	} else {
+		fmt.Printf("acknowledged %s until %s\n", ack.Service, ack.Until.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func parseAckExpiry(value string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(duration), nil
+	}
+	if until, err := time.Parse(time.RFC3339, value); err == nil {
+		return until.UTC(), nil
+	}
+	if until, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return until.UTC(), nil
+	}
+
+	return time.Time{}, fmt.Errorf("could not parse expiry [%s] as duration or date", value)
+}
+
+// loadAcknowledgement returns the active acknowledgement of the given service or nil, if there is none. As
+// acknowledgements are keyed by service name, they are being ignored for invocations with plugin-specific arguments or
+// flags (e.g. a single interface) unless --submit-service has been given, as otherwise the recovery of any other
+// invocation sharing the default service name would release the acknowledgement.
+func loadAcknowledgement(service string, plugin Plugin) (*acknowledgement, error) {
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return nil, err
+	}
+
+	var ack acknowledgement
+	found, err := LoadVersionedData(backend, ackPersistenceKey(service), ackPersistenceVersion, &ack)
+	if err != nil {
+		return nil, fmt.Errorf("could not load acknowledgement: %s", err.Error())
+	}
+	if !found || !ack.Active() {
+		return nil, nil
+	}
+	if globals.submitService == "" && len(plugin.invocationTags()) > 0 {
+		return nil, fmt.Errorf("ignoring acknowledgement of %s, as --submit-service is required for invocations "+
+			"with arguments or flags", service)
+	}
+
+	return &ack, nil
+}
+
+func (a *acknowledgement) store() error {
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return err
+	}
+
+	return StoreVersionedData(backend, ackPersistenceKey(a.Service), ackPersistenceVersion, a)
+}
+
+// Active returns true if the acknowledgement exists and has not expired yet
+func (a *acknowledgement) Active() bool {
+	return a != nil && time.Now().Before(a.Until)
+}
+
+// Release removes the acknowledgement once the check has recovered, so that future failures are reported as usual
+func (a *acknowledgement) Release(check nagopher.Check) error {
+	if !a.Active() || check.State() != nagopher.StateOk() {
+		return nil
+	}
+
+	a.Until = time.Time{}
+	return a.store()
+}
+
+// Apply wraps the given check, so that CRITICAL gets downgraded to WARNING while the acknowledgement is active. The
+// check is being returned as-is if there is no active acknowledgement.
+func (a *acknowledgement) Apply(check nagopher.Check) nagopher.Check {
+	if !a.Active() {
+		return check
+	}
+
+	return &acknowledgedCheck{Check: check, ack: a}
+}
+
+func (c *acknowledgedCheck) State() nagopher.State {
+	state := c.Check.State()
+	if state == nagopher.StateCritical() {
+		return nagopher.StateWarning()
+	}
+
+	return state
+}
+
+func (c *acknowledgedCheck) Summary() string {
+	summary := c.Check.Summary()
+	if c.Check.State() != nagopher.StateCritical() {
+		return summary
+	}
+
+	note := "acknowledged until " + c.ack.Until.Format(time.RFC3339)
+	if comment := strings.TrimSpace(c.ack.Comment); comment != "" {
+		note += ": " + comment
+	}
+
+	return fmt.Sprintf("%s (%s)", summary, note)
+}
+
+func ackPersistenceKey(service string) string {
+	return strings.ToLower(".nagocheck-ack-" + strings.Replace(service, "/", "_", -1))
+}
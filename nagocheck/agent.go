@@ -0,0 +1,228 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type agentTool struct {
+	moduleFactory func() map[string]Module
+
+	listenAddress string
+	token         string
+	tlsCertFile   string
+	tlsKeyFile    string
+	parallelism   int
+
+	workers chan *agentWorker
+}
+
+// agentWorker holds a set of modules together with the kingpin application defining their flags, which is prepared
+// ahead of executing a single request. It can not be reused for further requests, as kingpin neither resets flags
+// without default nor repeatable flags when parsing again.
+type agentWorker struct {
+	modules map[string]Module
+	app     *kingpin.Application
+}
+
+type agentError struct {
+	Error string `json:"error"`
+}
+
+// NewAgentTool instantiates a Tool, which runs as a daemon and executes plugins in-process on behalf of authenticated
+// HTTP requests, avoiding the process start-up cost for high-frequency checks. As plugins store their flags within
+// their own structs, every worker uses the given factory for preparing a fresh set of modules after each request.
+func NewAgentTool(moduleFactory func() map[string]Module) Tool {
+	return &agentTool{
+		moduleFactory: moduleFactory,
+	}
+}
+
+func (t *agentTool) Name() string {
+	return "agent"
+}
+
+func (t *agentTool) DefineCommand(app *kingpin.Application) {
+	node := app.Command(t.Name(), "Run as daemon and execute plugins on behalf of HTTP requests to "+
+		"/check/<module>/<plugin>?args=<arguments>, returning results as JSON.")
+
+	node.Flag("listen", "Address on which the HTTP server listens.").
+		Short('l').Default("127.0.0.1:9811").StringVar(&t.listenAddress)
+
+	node.Flag("token", "Bearer token which must be sent by clients within the Authorization header.").
+		Envar("NAGOCHECK_AGENT_TOKEN").Required().StringVar(&t.token)
+
+	node.Flag("tls-cert", "Serve HTTPS using the given certificate file, requires --tls-key.").
+		ExistingFileVar(&t.tlsCertFile)
+
+	node.Flag("tls-key", "Private key file for the certificate given with --tls-cert.").
+		ExistingFileVar(&t.tlsKeyFile)
+
+	node.Flag("parallel", "Maximum amount of plugins being executed at the same time.").
+		Short('p').Default("4").IntVar(&t.parallelism)
+}
+
+func (t *agentTool) Execute(modules map[string]Module) error {
+	if (t.tlsCertFile == "") != (t.tlsKeyFile == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be specified together")
+	}
+
+	parallelism := t.parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	t.workers = make(chan *agentWorker, parallelism)
+	for i := 0; i < parallelism; i++ {
+		t.workers <- t.newWorker()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", t.handleHealth)
+	mux.HandleFunc("/check/", t.requireToken(t.handleCheck))
+	mux.HandleFunc("/info", t.requireToken(handleBuildInfo(modules)))
+	mux.HandleFunc("/metrics", t.requireToken(handleBuildInfo(modules)))
+
+	NewLogger(t.Name()).WithField("address", t.listenAddress).Debugf("starting http server")
+	if t.tlsCertFile != "" {
+		return http.ListenAndServeTLS(t.listenAddress, t.tlsCertFile, t.tlsKeyFile, mux)
+	}
+	return http.ListenAndServe(t.listenAddress, mux)
+}
+
+func (t *agentTool) handleHealth(writer http.ResponseWriter, request *http.Request) {
+	writer.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintln(writer, "ok")
+}
+
+// requireToken wraps the given handler, so that it only gets called for requests containing the bearer token
+func (t *agentTool) requireToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if !t.authenticate(request) {
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			t.writeError(writer, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+
+		handler(writer, request)
+	}
+}
+
+func (t *agentTool) handleCheck(writer http.ResponseWriter, request *http.Request) {
+	path := strings.Split(strings.Trim(strings.TrimPrefix(request.URL.Path, "/check/"), "/"), "/")
+	if len(path) != 2 || path[0] == "" || path[1] == "" {
+		t.writeError(writer, http.StatusNotFound, "expected path /check/<module>/<plugin>")
+		return
+	}
+
+	args := path
+	for _, value := range request.URL.Query()["args"] {
+		valueArgs, err := SplitCommandLine(value)
+		if err != nil {
+			t.writeError(writer, http.StatusBadRequest, fmt.Sprintf("invalid arguments: %s", err.Error()))
+			return
+		}
+		args = append(args, valueArgs...)
+	}
+
+	// Workers get replaced in the background, so that preparing the modules does not delay the response
+	worker := <-t.workers
+	defer func() {
+		go func() { t.workers <- t.newWorker() }()
+	}()
+
+	result, status, err := worker.execute(args)
+	if err != nil {
+		t.writeError(writer, status, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	_ = NewJSONSink(writer).Emit(result)
+}
+
+func (t *agentTool) authenticate(request *http.Request) bool {
+	authorization := request.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(t.token)) == 1
+}
+
+// newWorker prepares a fresh set of modules using the module factory and defines their flags within a dedicated
+// kingpin application. Global flags are not available, the options of the agent process apply instead.
+func (t *agentTool) newWorker() *agentWorker {
+	modules := t.moduleFactory()
+	app := kingpin.New("nagocheck", "")
+	app.UsageWriter(ioutil.Discard)
+	app.ErrorWriter(ioutil.Discard)
+	app.Terminate(nil)
+
+	for _, module := range modules {
+		moduleNode := module.DefineCommand(app)
+		module.DefineFlags(moduleNode)
+	}
+	DefineEnvars(app, modules)
+
+	return &agentWorker{modules: modules, app: app}
+}
+
+// execute parses the given arguments using the kingpin application of the worker and executes the selected plugin
+// in-process
+func (w *agentWorker) execute(args []string) (result SinkResult, status int, rerr error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			status, rerr = http.StatusInternalServerError, fmt.Errorf("plugin execution panicked: %v", recovered)
+		}
+	}()
+
+	module, ok := w.modules[args[0]]
+	if !ok {
+		return result, http.StatusNotFound, fmt.Errorf("module not found with name [%s]", args[0])
+	}
+	plugin, err := module.GetPluginByName(args[1])
+	if err != nil {
+		return result, http.StatusNotFound, err
+	}
+
+	if _, err := w.app.Parse(args); err != nil {
+		return result, http.StatusBadRequest, fmt.Errorf("invalid arguments: %s", err.Error())
+	}
+
+	result, err = ExecutePluginInProcess(module, plugin)
+	if err != nil {
+		return result, http.StatusInternalServerError, fmt.Errorf("plugin execution failed: %s", err.Error())
+	}
+
+	return result, http.StatusOK, nil
+}
+
+func (t *agentTool) writeError(writer http.ResponseWriter, status int, message string) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(agentError{Error: message})
+}
@@ -0,0 +1,153 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"strconv"
+	"strings"
+)
+
+// AggregationModes contains the names of all modes supported by AggregationPolicy
+var AggregationModes = []string{"max-non-ok", "min-ok", "min-ok-percent"}
+
+// AggregationPolicy decides whether a check evaluating many items, e.g. pools, arrays or BGP peers, is considered OK
+// although some of its items are not. Items are identified by the sections of the results. Without a mode, the worst
+// state of all items is being used as usual.
+type AggregationPolicy struct {
+	Mode  string
+	Limit float64
+}
+
+type aggregatedCheck struct {
+	nagopher.Check
+	policy AggregationPolicy
+}
+
+// ParseAggregationPolicy parses an aggregation policy formatted as <mode>:<limit>, e.g. max-non-ok:1 or
+// min-ok-percent:75
+func ParseAggregationPolicy(rawValue string) (AggregationPolicy, error) {
+	parts := strings.SplitN(rawValue, ":", 2)
+	if len(parts) != 2 {
+		return AggregationPolicy{}, fmt.Errorf("aggregation policy must be formatted as <mode>:<limit>")
+	}
+
+	policy := AggregationPolicy{Mode: parts[0]}
+	validMode := false
+	for _, mode := range AggregationModes {
+		validMode = validMode || mode == policy.Mode
+	}
+	if !validMode {
+		return AggregationPolicy{}, fmt.Errorf("unknown aggregation mode [%s], expected one of: %s",
+			policy.Mode, strings.Join(AggregationModes, ", "))
+	}
+
+	limit, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || limit < 0 {
+		return AggregationPolicy{}, fmt.Errorf("aggregation limit must be a non-negative number: %s", parts[1])
+	}
+	if policy.Mode == "min-ok-percent" && limit > 100 {
+		return AggregationPolicy{}, fmt.Errorf("aggregation limit must not exceed 100 percent: %s", parts[1])
+	}
+	policy.Limit = limit
+
+	return policy, nil
+}
+
+func (p AggregationPolicy) String() string {
+	if p.Mode == "" {
+		return ""
+	}
+
+	return p.Mode + ":" + strconv.FormatFloat(p.Limit, 'f', -1, 64)
+}
+
+// Satisfied returns true if the given amount of OK items out of all items is acceptable according to the policy
+func (p AggregationPolicy) Satisfied(okItems int, totalItems int) bool {
+	switch p.Mode {
+	case "max-non-ok":
+		return float64(totalItems-okItems) <= p.Limit
+	case "min-ok":
+		return float64(okItems) >= p.Limit
+	case "min-ok-percent":
+		return totalItems > 0 && float64(okItems)*100/float64(totalItems) >= p.Limit
+	}
+
+	return okItems == totalItems
+}
+
+// Apply wraps the given check, so that its final state gets determined by the policy. The check is being returned
+// as-is if no mode has been set.
+func (p AggregationPolicy) Apply(check nagopher.Check) nagopher.Check {
+	if p.Mode == "" {
+		return check
+	}
+
+	return &aggregatedCheck{Check: check, policy: p}
+}
+
+// State returns the worst state of all results outside of any item if the policy is satisfied, otherwise the worst
+// state of all results. Results without metrics, e.g. failing resources, are never being aggregated.
+func (c *aggregatedCheck) State() nagopher.State {
+	okItems, totalItems, plainResults := c.countItems()
+	if totalItems == 0 || !c.policy.Satisfied(okItems, totalItems) {
+		return c.Check.State()
+	}
+
+	return plainResults.MostSignificantState().OrElse(nagopher.StateOk())
+}
+
+func (c *aggregatedCheck) Summary() string {
+	okItems, totalItems, _ := c.countItems()
+	if c.State() == nagopher.StateOk() && c.Check.State() != nagopher.StateOk() {
+		return fmt.Sprintf("%d of %d items ok, accepted by aggregation policy %s", okItems, totalItems, c.policy)
+	}
+
+	return c.Check.Summary()
+}
+
+// countItems groups all results by their section title and counts the items whose results are all OK. Results which
+// do not belong to any item are returned separately.
+func (c *aggregatedCheck) countItems() (okItems int, totalItems int, plainResults nagopher.ResultCollection) {
+	plainResults = nagopher.NewResultCollection()
+	itemResults := make(map[string]nagopher.ResultCollection)
+
+	for _, result := range c.Check.Results().Get() {
+		title := resultSectionTitle(result)
+		if metric, err := result.Metric().Get(); title == "" || err != nil || metric == nil {
+			plainResults.Add(result)
+			continue
+		}
+
+		if _, ok := itemResults[title]; !ok {
+			itemResults[title] = nagopher.NewResultCollection()
+		}
+		itemResults[title].Add(result)
+	}
+
+	for _, results := range itemResults {
+		state := results.MostSignificantState().OrElse(nagopher.StateOk())
+		if state == nagopher.StateOk() || state == nagopher.StateInfo() {
+			okItems++
+		}
+	}
+
+	return okItems, len(itemResults), plainResults
+}
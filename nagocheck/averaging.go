@@ -0,0 +1,259 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AveragingModes contains the names of all supported averaging modes, which can be used within averaging policies
+var AveragingModes = []string{"mean", "median"}
+
+// AveragingPolicy specifies how many samples of a context should be remembered and how they should be averaged
+type AveragingPolicy struct {
+	Mode    string
+	Samples int
+}
+
+// AveragingPolicies maps context names to their respective averaging policies
+type AveragingPolicies map[string]AveragingPolicy
+
+// AllContexts is the context name of averaging policies applying to all contexts without a more specific policy
+const AllContexts = "*"
+
+// averagingPersistenceVersion is the version of the layout of persisted samples, which must be increased on changes
+const averagingPersistenceVersion = 1
+
+type averagingContext struct {
+	Context
+
+	policy  AveragingPolicy
+	samples map[string][]float64
+}
+
+// ParseAveragingPolicy parses an averaging policy formatted as '[<context>=]<mode>:<samples>', where mode is either
+// mean or median and samples specifies the amount of samples including the current one which are being averaged.
+// Policies without a context apply to all contexts, which is returned as AllContexts.
+func ParseAveragingPolicy(rawValue string) (string, AveragingPolicy, error) {
+	var policy AveragingPolicy
+
+	parts := strings.SplitN(rawValue, "=", 2)
+	if len(parts) == 1 {
+		parts = []string{AllContexts, parts[0]}
+	}
+	if strings.TrimSpace(parts[0]) == "" {
+		return "", policy, fmt.Errorf("averaging policy [%s] must be formatted as [<context>=]<mode>:<samples>",
+			rawValue)
+	}
+
+	contextName := strings.TrimSpace(parts[0])
+	specifier := strings.SplitN(parts[1], ":", 2)
+	if len(specifier) != 2 {
+		return "", policy, fmt.Errorf("averaging policy [%s] must be formatted as [<context>=]<mode>:<samples>",
+			rawValue)
+	}
+
+	policy.Mode = strings.ToLower(strings.TrimSpace(specifier[0]))
+	validMode := false
+	for _, mode := range AveragingModes {
+		validMode = validMode || mode == policy.Mode
+	}
+	if !validMode {
+		return "", policy, fmt.Errorf("unknown averaging mode [%s], expected one of: %s",
+			policy.Mode, strings.Join(AveragingModes, ", "))
+	}
+
+	samples, err := strconv.Atoi(strings.TrimSpace(specifier[1]))
+	if err != nil || samples < 1 {
+		return "", policy, fmt.Errorf("invalid amount of samples in averaging policy [%s]", rawValue)
+	}
+	policy.Samples = samples
+
+	return contextName, policy, nil
+}
+
+func (p AveragingPolicy) String() string {
+	return fmt.Sprintf("%s:%d", p.Mode, p.Samples)
+}
+
+// Average returns either the mean or the median of the given samples depending on the mode of the policy
+func (p AveragingPolicy) Average(samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	if p.Mode == "median" {
+		sorted := append([]float64(nil), samples...)
+		sort.Float64s(sorted)
+
+		middle := len(sorted) / 2
+		if len(sorted)%2 == 0 {
+			return (sorted[middle-1] + sorted[middle]) / 2
+		}
+
+		return sorted[middle]
+	}
+
+	sum := float64(0)
+	for _, sample := range samples {
+		sum += sample
+	}
+
+	return sum / float64(len(samples))
+}
+
+// Apply wraps all contexts of the given check, which have an averaging policy, so that thresholds are being evaluated
+// against the average of the previous samples instead of the current value. An error gets returned if an averaging
+// policy refers to an unknown context. Policies for all contexts skip contexts evaluating counters like deltas and
+// rates, as averaging their raw values would result in bogus differences.
+func (p AveragingPolicies) Apply(check nagopher.Check, plugin Plugin) error {
+	contexts := make(map[string]nagopher.Context)
+	for _, context := range check.Contexts() {
+		contexts[context.Name()] = context
+	}
+
+	for contextName, policy := range p {
+		if contextName == AllContexts {
+			continue
+		}
+
+		context, ok := contexts[contextName]
+		if !ok {
+			return fmt.Errorf("averaging policy refers to unknown context [%s]", contextName)
+		}
+
+		check.AttachContexts(&averagingContext{Context: NewContext(plugin, context), policy: policy})
+	}
+
+	if policy, ok := p[AllContexts]; ok {
+		for contextName, context := range contexts {
+			if _, ok := p[contextName]; ok || isCounterContext(context) {
+				continue
+			}
+
+			check.AttachContexts(&averagingContext{Context: NewContext(plugin, context), policy: policy})
+		}
+	}
+
+	return nil
+}
+
+// isCounterContext returns true if the given context evaluates the difference between samples of a counter
+func isCounterContext(context nagopher.Context) bool {
+	switch context.(type) {
+	case *deltaContext, *rateContext:
+		return true
+	}
+
+	return false
+}
+
+func (c *averagingContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	// Unknown values are being evaluated as-is, as they would turn the average into an unknown value as well
+	numericMetric, ok := metric.(nagopher.NumericMetric)
+	if !ok || math.IsNaN(numericMetric.Value()) {
+		return c.Context.Evaluate(metric, resource)
+	}
+
+	samples := append(c.previousSamples(metric.Name()), numericMetric.Value())
+	if len(samples) > c.policy.Samples {
+		samples = samples[len(samples)-c.policy.Samples:]
+	}
+	if history := c.Plugin().History(); history != nil {
+		history.Record(metric.Name(), numericMetric.Value())
+	} else {
+		c.samples[metric.Name()] = samples
+		c.Plugin().deferPersistence(c)
+	}
+
+	averagedMetric, err := nagopher.NewNumericMetric(metric.Name(), Round(c.policy.Average(samples), 2),
+		metric.ValueUnit(), nagopher.OptionalBoundsPtr(metric.ValueRange()), metric.ContextName())
+	if err != nil {
+		return c.Context.Evaluate(metric, resource)
+	}
+
+	result := c.Context.Evaluate(averagedMetric, resource)
+	if result.Hint() == "" {
+		return result
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(result.State().OrElse(nagopher.StateUnknown())),
+		nagopher.ResultMetric(result.Metric().OrElse(averagedMetric)), nagopher.ResultContext(c),
+		nagopher.ResultResource(resource),
+		nagopher.ResultHint(fmt.Sprintf("%s, %s of %d samples", result.Hint(), c.policy.Mode, len(samples))),
+	)
+}
+
+// previousSamples returns the values of the given metric during previous executions, which are either taken from the
+// history of the plugin or from the samples persisted by the context itself
+func (c *averagingContext) previousSamples(name string) []float64 {
+	history := c.Plugin().History()
+	if history == nil {
+		c.loadSamples()
+		return c.samples[name]
+	}
+
+	series := history.Series(name)
+	if len(series) >= c.policy.Samples {
+		series = series[len(series)-c.policy.Samples+1:]
+	}
+
+	samples := make([]float64, len(series))
+	for index, sample := range series {
+		samples[index] = sample.Value
+	}
+
+	return samples
+}
+
+func (c *averagingContext) loadSamples() {
+	if c.samples != nil {
+		return
+	}
+
+	c.samples = make(map[string][]float64)
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return
+	}
+
+	key := contextPersistenceKey("average", c)
+	if _, err := LoadVersionedData(backend, key, averagingPersistenceVersion, &c.samples); err != nil {
+		c.Plugin().Logger().Debugf("could not unmarshal previous samples: %s", err.Error())
+		c.samples = make(map[string][]float64)
+	}
+}
+
+func (c *averagingContext) storePersistentData() {
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return
+	}
+
+	key := contextPersistenceKey("average", c)
+	if err := StoreVersionedData(backend, key, averagingPersistenceVersion, c.samples); err != nil {
+		c.Plugin().Logger().Debugf("could not store previous samples: %s", err.Error())
+	}
+}
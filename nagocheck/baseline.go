@@ -0,0 +1,314 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BaselinePolicy specifies how long the baseline of a context gets learned, how many standard deviations a value
+// may deviate from the learned mean before the warning or critical state gets returned and after how long of
+// continuous deviation the baseline gets learned anew
+type BaselinePolicy struct {
+	Warning  float64
+	Critical float64
+	Learn    time.Duration
+	Relearn  time.Duration
+}
+
+// BaselinePolicies maps context names to their respective baseline policies
+type BaselinePolicies map[string]BaselinePolicy
+
+// BaselineStatistics contains the running mean and variance of a metric, which are being updated using Welford's
+// algorithm so that no samples have to be remembered, and since when the values have been deviating continuously
+type BaselineStatistics struct {
+	Started   int64   `json:"started"`
+	Count     int64   `json:"count"`
+	Mean      float64 `json:"mean"`
+	M2        float64 `json:"m2"`
+	Deviating int64   `json:"deviating,omitempty"`
+}
+
+type baselineContext struct {
+	Context
+
+	policy     BaselinePolicy
+	statistics map[string]BaselineStatistics
+}
+
+// DefaultBaselineLearn is the duration during which a baseline gets learned unless specified otherwise
+const DefaultBaselineLearn = 7 * 24 * time.Hour
+
+// DefaultBaselineRelearn is the duration of continuous deviation after which a baseline gets learned anew, as the
+// values have most likely shifted permanently, e.g. after adding capacity
+const DefaultBaselineRelearn = 24 * time.Hour
+
+// baselineMinSamples is the minimum amount of samples a baseline requires, even if its learning window has passed
+const baselineMinSamples = 10
+
+// baselinePersistenceVersion is the version of the layout of persisted baselines, which must be increased on changes
+const baselinePersistenceVersion = 1
+
+// ParseBaselinePolicy parses a baseline policy formatted as
+// '[<context>=]w:<sigma>,c:<sigma>[,learn:<duration>][,relearn:<duration>]', where either the warning or the critical
+// part may be omitted. Policies without a context apply to all contexts, which is returned as AllContexts.
+func ParseBaselinePolicy(rawValue string) (string, BaselinePolicy, error) {
+	policy := BaselinePolicy{Learn: DefaultBaselineLearn, Relearn: DefaultBaselineRelearn}
+	formatError := fmt.Errorf("baseline policy [%s] must be formatted as "+
+		"[<context>=]w:<sigma>,c:<sigma>[,learn:<duration>][,relearn:<duration>]", rawValue)
+
+	parts := strings.SplitN(rawValue, "=", 2)
+	if len(parts) == 1 {
+		parts = []string{AllContexts, parts[0]}
+	}
+	if strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return "", policy, formatError
+	}
+
+	contextName := strings.TrimSpace(parts[0])
+	for _, part := range strings.Split(parts[1], ",") {
+		keywordParts := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		if len(keywordParts) != 2 {
+			return "", policy, formatError
+		}
+
+		value := strings.TrimSpace(keywordParts[1])
+		switch keywordParts[0] {
+		case "w", "c":
+			sigma, err := strconv.ParseFloat(value, 64)
+			if err != nil || sigma <= 0 {
+				return "", policy, fmt.Errorf("invalid amount of standard deviations in baseline policy [%s]",
+					rawValue)
+			}
+
+			if keywordParts[0] == "w" {
+				policy.Warning = sigma
+			} else {
+				policy.Critical = sigma
+			}
+		case "learn":
+			learn, err := ParseDuration(value)
+			if err != nil {
+				return "", policy, fmt.Errorf("invalid learning window in baseline policy [%s]: %s",
+					rawValue, err.Error())
+			}
+			policy.Learn = learn
+		case "relearn":
+			relearn, err := ParseDuration(value)
+			if err != nil {
+				return "", policy, fmt.Errorf("invalid relearn duration in baseline policy [%s]: %s",
+					rawValue, err.Error())
+			}
+			policy.Relearn = relearn
+		default:
+			return "", policy, formatError
+		}
+	}
+
+	if policy.Warning == 0 && policy.Critical == 0 {
+		return "", policy, formatError
+	}
+
+	return contextName, policy, nil
+}
+
+func (p BaselinePolicy) String() string {
+	var parts []string
+	if p.Warning > 0 {
+		parts = append(parts, "w:"+strconv.FormatFloat(p.Warning, 'f', -1, 64))
+	}
+	if p.Critical > 0 {
+		parts = append(parts, "c:"+strconv.FormatFloat(p.Critical, 'f', -1, 64))
+	}
+	parts = append(parts, "learn:"+DurationString(p.Learn))
+	parts = append(parts, "relearn:"+DurationString(p.Relearn))
+
+	return strings.Join(parts, ",")
+}
+
+// Apply wraps all contexts of the given check, which have a baseline policy, so that their values are being learned
+// during the learning window and compared against the learned mean afterwards. An error gets returned if a baseline
+// policy refers to an unknown context. Policies for all contexts skip contexts evaluating counters like deltas and
+// rates, as their raw values only grow over time.
+func (p BaselinePolicies) Apply(check nagopher.Check, plugin Plugin) error {
+	contexts := make(map[string]nagopher.Context)
+	for _, context := range check.Contexts() {
+		contexts[context.Name()] = context
+	}
+
+	for contextName, policy := range p {
+		if contextName == AllContexts {
+			continue
+		}
+
+		context, ok := contexts[contextName]
+		if !ok {
+			return fmt.Errorf("baseline policy refers to unknown context [%s]", contextName)
+		}
+
+		check.AttachContexts(&baselineContext{Context: NewContext(plugin, context), policy: policy})
+	}
+
+	if policy, ok := p[AllContexts]; ok {
+		for contextName, context := range contexts {
+			if _, ok := p[contextName]; ok || isCounterContext(context) {
+				continue
+			}
+
+			check.AttachContexts(&baselineContext{Context: NewContext(plugin, context), policy: policy})
+		}
+	}
+
+	return nil
+}
+
+// Add updates the running mean and variance with the given value
+func (s *BaselineStatistics) Add(value float64) {
+	s.Count++
+	delta := value - s.Mean
+	s.Mean += delta / float64(s.Count)
+	s.M2 += delta * (value - s.Mean)
+}
+
+// StdDev returns the sample standard deviation of all values added so far
+func (s BaselineStatistics) StdDev() float64 {
+	if s.Count < 2 {
+		return 0
+	}
+
+	return math.Sqrt(s.M2 / float64(s.Count-1))
+}
+
+// Deviation returns by how many standard deviations the given value deviates from the mean. Any deviation from a
+// baseline without variance is considered infinite.
+func (s BaselineStatistics) Deviation(value float64) float64 {
+	stdDev := s.StdDev()
+	if stdDev == 0 {
+		if value == s.Mean {
+			return 0
+		}
+		return math.Inf(1)
+	}
+
+	return math.Abs(value-s.Mean) / stdDev
+}
+
+func (c *baselineContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	// Unknown values are being evaluated as-is, as they would turn the baseline into an unknown value as well
+	result := c.Context.Evaluate(metric, resource)
+	numericMetric, ok := metric.(nagopher.NumericMetric)
+	if !ok || math.IsNaN(numericMetric.Value()) || math.IsInf(numericMetric.Value(), 0) {
+		return result
+	}
+
+	c.loadStatistics()
+	value := numericMetric.Value()
+	statistics := c.statistics[metric.Name()]
+	if statistics.Started == 0 {
+		statistics.Started = time.Now().Unix()
+	}
+
+	// Values deviating for longer than the relearn duration are considered a lasting change instead of an anomaly, so
+	// the baseline gets learned anew starting with the current value instead of alerting forever
+	if statistics.Deviating != 0 && c.policy.Relearn > 0 &&
+		time.Since(time.Unix(statistics.Deviating, 0)) >= c.policy.Relearn {
+		c.Plugin().Logger().Debugf("relearning baseline of %s after deviating since %s", metric.Name(),
+			time.Unix(statistics.Deviating, 0).Format(time.RFC3339))
+		statistics = BaselineStatistics{Started: time.Now().Unix()}
+	}
+
+	// Values are being learned until the learning window has passed, afterwards only values within the baseline are
+	// being added, so that the baseline follows slow changes without being skewed by anomalies
+	learnedSince := time.Since(time.Unix(statistics.Started, 0))
+	if learnedSince < c.policy.Learn || statistics.Count < baselineMinSamples {
+		statistics.Add(value)
+		c.updateStatistics(metric.Name(), statistics)
+		return result
+	}
+
+	deviation := statistics.Deviation(value)
+	state := nagopher.StateOk()
+	if c.policy.Critical > 0 && deviation > c.policy.Critical {
+		state = nagopher.StateCritical()
+	} else if c.policy.Warning > 0 && deviation > c.policy.Warning {
+		state = nagopher.StateWarning()
+	}
+
+	if state == nagopher.StateOk() {
+		statistics.Deviating = 0
+		statistics.Add(value)
+		c.updateStatistics(metric.Name(), statistics)
+	} else if statistics.Deviating == 0 {
+		statistics.Deviating = time.Now().Unix()
+		c.updateStatistics(metric.Name(), statistics)
+	}
+
+	resultState := result.State().OrElse(nagopher.StateUnknown())
+	if exitCodeSignificance(int(state.ExitCode())) <= exitCodeSignificance(int(resultState.ExitCode())) {
+		return result
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(state),
+		nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+		nagopher.ResultHint(fmt.Sprintf("deviates %.1f sigma from baseline %s±%s", deviation,
+			strconv.FormatFloat(Round(statistics.Mean, 2), 'f', -1, 64),
+			strconv.FormatFloat(Round(statistics.StdDev(), 2), 'f', -1, 64))),
+	)
+}
+
+func (c *baselineContext) loadStatistics() {
+	if c.statistics != nil {
+		return
+	}
+
+	c.statistics = make(map[string]BaselineStatistics)
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return
+	}
+
+	key := contextPersistenceKey("baseline", c)
+	if _, err := LoadVersionedData(backend, key, baselinePersistenceVersion, &c.statistics); err != nil {
+		c.Plugin().Logger().Debugf("could not unmarshal baseline: %s", err.Error())
+		c.statistics = make(map[string]BaselineStatistics)
+	}
+}
+
+// updateStatistics replaces the statistics of the given metric, which get stored once all metrics have been evaluated
+func (c *baselineContext) updateStatistics(name string, statistics BaselineStatistics) {
+	c.statistics[name] = statistics
+	c.Plugin().deferPersistence(c)
+}
+
+func (c *baselineContext) storePersistentData() {
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return
+	}
+
+	key := contextPersistenceKey("baseline", c)
+	if err := StoreVersionedData(backend, key, baselinePersistenceVersion, c.statistics); err != nil {
+		c.Plugin().Logger().Debugf("could not store baseline: %s", err.Error())
+	}
+}
@@ -0,0 +1,253 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type batchTool struct {
+	invocations []string
+	file        string
+	parallelism int
+	timeout     time.Duration
+	outputMode  string
+	splay       time.Duration
+	pluginLimit int
+}
+
+type invocationResult struct {
+	invocation string
+	exitCode   int
+	output     string
+	duration   time.Duration
+}
+
+// NewBatchTool instantiates a Tool, which executes several plugin invocations concurrently as child processes and
+// either aggregates their results into a single check result or outputs all of them one after another.
+func NewBatchTool() Tool {
+	return &batchTool{}
+}
+
+func (t *batchTool) Name() string {
+	return "batch"
+}
+
+func (t *batchTool) DefineCommand(app *kingpin.Application) {
+	node := app.Command(t.Name(), "Execute multiple plugin invocations concurrently.")
+
+	node.Arg("invocation", "Plugin invocation including all arguments, e.g. \"system load -w 2\".").
+		StringsVar(&t.invocations)
+
+	node.Flag("file", "Read plugin invocations from the given file, one per line. Empty lines and lines "+
+		"starting with # are ignored.").
+		Short('f').ExistingFileVar(&t.file)
+
+	node.Flag("parallel", "Maximum amount of plugin invocations being executed at the same time.").
+		Short('p').Default("4").IntVar(&t.parallelism)
+
+	node.Flag("timeout", "Timeout for each plugin invocation.").
+		Short('t').Default("60s").DurationVar(&t.timeout)
+
+	node.Flag("output-mode", "Output mode, either 'aggregate' for a single result with the worst state or 'separate' "+
+		"for the complete output of each invocation.").
+		Short('o').Default("aggregate").EnumVar(&t.outputMode, "aggregate", "separate")
+
+	node.Flag("splay", "Delay each invocation by a random duration up to the given value, so that invocations do not "+
+		"hit shared backends at the same time. Note that this prolongs the total execution time.").
+		Default("0s").DurationVar(&t.splay)
+
+	node.Flag("plugin-parallel", "Maximum amount of invocations of the same plugin being executed at the same "+
+		"time, 0 for no limit besides --parallel.").
+		Default("0").IntVar(&t.pluginLimit)
+}
+
+func (t *batchTool) Execute(modules map[string]Module) error {
+	invocations, err := t.collectInvocations()
+	if err != nil {
+		return err
+	}
+	if len(invocations) == 0 {
+		return fmt.Errorf("no plugin invocations given")
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not determine path of executable: %s", err.Error())
+	}
+
+	results := t.executeAll(modules, executable, invocations)
+	exitCode := 0
+	for _, result := range results {
+		exitCode = worseExitCode(exitCode, result.exitCode)
+	}
+
+	if t.outputMode == "separate" {
+		for _, result := range results {
+			fmt.Printf("[%s] %s", result.invocation, ensureTrailingNewline(result.output))
+		}
+	} else {
+		fmt.Print(t.aggregateOutput(exitCode, results))
+	}
+
+	os.Exit(exitCode)
+	return nil
+}
+
+func (t *batchTool) collectInvocations() ([]string, error) {
+	invocations := append([]string{}, t.invocations...)
+	if t.file == "" {
+		return invocations, nil
+	}
+
+	file, err := os.Open(t.file)
+	if err != nil {
+		return nil, fmt.Errorf("could not open batch file: %s", err.Error())
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		invocations = append(invocations, line)
+	}
+
+	return invocations, scanner.Err()
+}
+
+func (t *batchTool) executeAll(modules map[string]Module, executable string, invocations []string) []invocationResult {
+	var waitGroup sync.WaitGroup
+	limiter := newPluginLimiter(t.pluginLimit)
+
+	parallelism := t.parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	results := make([]invocationResult, len(invocations))
+	semaphore := make(chan struct{}, parallelism)
+	for index, invocation := range invocations {
+		waitGroup.Add(1)
+		semaphore <- struct{}{}
+
+		go func(index int, invocation string) {
+			defer waitGroup.Done()
+			defer func() { <-semaphore }()
+
+			time.Sleep(randomDelay(t.splay))
+			release := limiter.acquire(invocationPlugin(modules, invocation))
+			defer release()
+
+			results[index] = executeInvocation(executable, invocation, t.timeout)
+		}(index, invocation)
+	}
+
+	waitGroup.Wait()
+	return results
+}
+
+// executeInvocation executes a single plugin invocation like "system load -w 2" as child process of the given
+// executable, which is usually nagocheck itself, and returns its output and exit code.
+func executeInvocation(executable string, invocation string, timeout time.Duration) (result invocationResult) {
+	result = invocationResult{invocation: invocation, exitCode: int(nagopher.StateUnknown().ExitCode())}
+	startTime := time.Now()
+	defer func() { result.duration = time.Since(startTime) }()
+
+	args, err := SplitCommandLine(invocation)
+	if err != nil {
+		result.output = fmt.Sprintf("UNKNOWN - invalid invocation: %s\n", err.Error())
+		return result
+	}
+
+	output, err := ExecuteCommand(timeout, append([]string{executable}, args...))
+	result.output = output
+	if err == nil {
+		result.exitCode = 0
+	} else if exitError, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.Exited() {
+			result.exitCode = status.ExitStatus()
+		}
+	} else {
+		result.output = fmt.Sprintf("UNKNOWN - %s\n", err.Error())
+	}
+
+	return result
+}
+
+func (t *batchTool) aggregateOutput(exitCode int, results []invocationResult) string {
+	stateCounts := make(map[int]int)
+	for _, result := range results {
+		stateCounts[result.exitCode]++
+	}
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("BATCH %s - %d checks: %d ok, %d warning, %d critical, %d unknown",
+		strings.ToUpper(exitCodeDescription(exitCode)), len(results),
+		stateCounts[0], stateCounts[1], stateCounts[2], stateCounts[3]))
+
+	for _, result := range results {
+		firstLine := strings.SplitN(strings.TrimSpace(result.output), "\n", 2)[0]
+		firstLine = strings.SplitN(firstLine, "|", 2)[0]
+		lines = append(lines, fmt.Sprintf("[%s] %s", result.invocation, strings.TrimSpace(firstLine)))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// worseExitCode returns the more significant of two Nagios exit codes
+func worseExitCode(a int, b int) int {
+	if exitCodeSignificance(b) > exitCodeSignificance(a) {
+		return b
+	}
+
+	return a
+}
+
+func exitCodeDescription(exitCode int) string {
+	for _, state := range []nagopher.State{nagopher.StateOk(), nagopher.StateWarning(), nagopher.StateCritical()} {
+		if int(state.ExitCode()) == exitCode {
+			return state.Description()
+		}
+	}
+
+	return nagopher.StateUnknown().Description()
+}
+
+func ensureTrailingNewline(value string) string {
+	if strings.HasSuffix(value, "\n") {
+		return value
+	}
+
+	return value + "\n"
+}
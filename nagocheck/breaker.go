@@ -0,0 +1,111 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck/transport"
+	"strings"
+	"time"
+)
+
+// circuitBreaker wraps a transport and stops executing commands after several consecutive failures, as plugins would
+// otherwise keep spawning processes which run into their timeout while the backend is unavailable. Its state is kept
+// in the persistence backend, as every plugin invocation usually runs in a separate process.
+type circuitBreaker struct {
+	transport transport.Transport
+	key       string
+	threshold int
+	window    time.Duration
+}
+
+type circuitBreakerState struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+}
+
+// breakerPersistenceVersion is the version of the layout of persisted breaker states, which must be increased on
+// changes
+const breakerPersistenceVersion = 1
+
+// newCircuitBreaker instantiates a circuit breaker for the given backend, which opens after the given amount of
+// consecutive failures within the window and allows a single retry once the window since the last failure has passed
+func newCircuitBreaker(inner transport.Transport, backend string, threshold int, window time.Duration) transport.Transport {
+	return &circuitBreaker{
+		transport: inner,
+		key:       strings.ToLower(strings.Replace(".nagocheck-breaker-"+backend, "/", "_", -1)),
+		threshold: threshold,
+		window:    window,
+	}
+}
+
+func (b *circuitBreaker) Name() string {
+	return b.transport.Name()
+}
+
+func (b *circuitBreaker) Execute(timeout time.Duration, command []string) (string, error) {
+	logger := NewLogger("breaker").WithField("key", b.key)
+
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return "", err
+	}
+
+	// Breaker state is only advisory, so failing to load or store it must not prevent command execution
+	state := b.loadState(backend)
+	if state.Failures >= b.threshold && time.Since(state.LastFailure) < b.window {
+		retryAfter := state.LastFailure.Add(b.window).Sub(time.Now()).Round(time.Second)
+		return "", fmt.Errorf("backend unavailable (%d consecutive failures, retrying in %s)",
+			state.Failures, DurationString(retryAfter))
+	}
+
+	output, err := b.transport.Execute(timeout, command)
+	switch {
+	case err != nil:
+		// Failures only count as consecutive within the window, unless the breaker is already open
+		if time.Since(state.LastFailure) >= b.window && state.Failures < b.threshold {
+			state.Failures = 0
+		}
+		state.Failures++
+		state.LastFailure = time.Now()
+		logger.Debugf("recorded failure %d of %d", state.Failures, b.threshold)
+	case state.Failures > 0:
+		state = circuitBreakerState{}
+	default:
+		return output, nil
+	}
+
+	if storeErr := b.storeState(backend, state); storeErr != nil {
+		logger.Debugf("could not store breaker state: %s", storeErr.Error())
+	}
+
+	return output, err
+}
+
+func (b *circuitBreaker) loadState(backend PersistenceBackend) (state circuitBreakerState) {
+	if found, _ := LoadVersionedData(backend, b.key, breakerPersistenceVersion, &state); !found {
+		return circuitBreakerState{}
+	}
+
+	return state
+}
+
+func (b *circuitBreaker) storeState(backend PersistenceBackend, state circuitBreakerState) error {
+	return StoreVersionedData(backend, b.key, breakerPersistenceVersion, state)
+}
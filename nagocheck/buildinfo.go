@@ -0,0 +1,133 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// BuildInfo contains the build metadata of the running binary, which is being reported by daemons and sinks so that
+// deployed versions can be audited from the monitoring system
+type BuildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+type buildInfoDocument struct {
+	BuildInfo
+	GoVersion string   `json:"go_version"`
+	Platform  string   `json:"platform"`
+	Modules   []string `json:"modules"`
+	Features  []string `json:"features"`
+}
+
+var buildInfo = BuildInfo{
+	Version: "SNAPSHOT",
+	Commit:  "N/A",
+	Date:    "N/A",
+}
+
+// SetBuildInfo sets the build metadata of the running binary, which should be called once during startup
+func SetBuildInfo(info BuildInfo) {
+	buildInfo = info
+}
+
+func newBuildInfoDocument(modules map[string]Module) buildInfoDocument {
+	moduleNames := make([]string, 0, len(modules))
+	for name := range modules {
+		moduleNames = append(moduleNames, name)
+	}
+	sort.Strings(moduleNames)
+
+	return buildInfoDocument{
+		BuildInfo: buildInfo,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Modules:   moduleNames,
+		Features:  enabledFeatures(),
+	}
+}
+
+// enabledFeatures returns the names of all optional features, which have been enabled using global flags
+func enabledFeatures() []string {
+	features := []string{"persistence-" + globals.persistenceBackend}
+	for _, feature := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"breaker", globals.breakerThreshold > 0},
+		{"cache", globals.cacheTTL > 0},
+		{"no-new-privs", globals.noNewPrivs},
+		{"seccomp", globals.seccomp},
+		{"ssh", globals.sshHost != ""},
+		{"sudo", globals.sudo},
+	} {
+		if feature.enabled {
+			features = append(features, feature.name)
+		}
+	}
+
+	return features
+}
+
+// writeBuildInfoMetrics writes the build metadata as info-style metrics in the Prometheus text format, which always
+// have the value 1 and carry all information within their labels
+func writeBuildInfoMetrics(buffer *bytes.Buffer, document buildInfoDocument) {
+	fmt.Fprintf(buffer, "# HELP nagocheck_build_info Build metadata of the running nagocheck binary.\n")
+	fmt.Fprintf(buffer, "# TYPE nagocheck_build_info gauge\n")
+	fmt.Fprintf(buffer, "nagocheck_build_info{version=\"%s\",commit=\"%s\",date=\"%s\",goversion=\"%s\","+
+		"platform=\"%s\",features=\"%s\"} 1\n",
+		escapePrometheusLabel(document.Version), escapePrometheusLabel(document.Commit),
+		escapePrometheusLabel(document.Date), escapePrometheusLabel(document.GoVersion),
+		escapePrometheusLabel(document.Platform), escapePrometheusLabel(strings.Join(document.Features, ",")))
+
+	if len(document.Modules) > 0 {
+		fmt.Fprintf(buffer, "# HELP nagocheck_module_info Modules available within the running nagocheck binary.\n")
+		fmt.Fprintf(buffer, "# TYPE nagocheck_module_info gauge\n")
+		for _, module := range document.Modules {
+			fmt.Fprintf(buffer, "nagocheck_module_info{module=\"%s\"} 1\n", escapePrometheusLabel(module))
+		}
+	}
+}
+
+// handleBuildInfo returns a handler which exposes the build metadata as JSON at /info and as Prometheus metrics at
+// /metrics, which is shared by all daemons
+func handleBuildInfo(modules map[string]Module) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		document := newBuildInfoDocument(modules)
+
+		if request.URL.Path == "/metrics" {
+			var buffer bytes.Buffer
+			writeBuildInfoMetrics(&buffer, document)
+
+			writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			_, _ = writer.Write(buffer.Bytes())
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(writer).Encode(document)
+	}
+}
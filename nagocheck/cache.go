@@ -0,0 +1,236 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var perfDataValueRE = regexp.MustCompile(`^(-?[0-9.]+(?:[eE][-+]?[0-9]+)?|U)(.*)$`)
+
+// resultCache stores the results of plugin executions within the persistence backend, so that expensive probes can be
+// shared by several service definitions executing the same plugin invocation
+type resultCache struct {
+	key string
+	ttl time.Duration
+}
+
+type cachedResult struct {
+	Timestamp   time.Time `json:"timestamp"`
+	CheckSource string    `json:"checkSource"`
+	ExitCode    int       `json:"exitCode"`
+	State       string    `json:"state"`
+	RawOutput   string    `json:"rawOutput"`
+	Output      string    `json:"output"`
+	PerfData    []string  `json:"perfData"`
+}
+
+// cachePersistenceVersion is the version of the layout of cached results, which must be increased on changes
+const cachePersistenceVersion = 1
+
+// newResultCache returns a cache for the current plugin invocation or nil, if caching has not been enabled. The cache
+// key is derived from the parsed values of all global, module and plugin flags and arguments, excluding --cache-ttl
+// itself, so that invocations with different TTLs but otherwise identical values share their results. Unlike the
+// process arguments, this also covers values passed as environment variables, e.g. NAGOCHECK_SNMP_HOST.
+func newResultCache(module Module, plugin Plugin) *resultCache {
+	if globals.cacheTTL <= 0 {
+		return nil
+	}
+
+	var values []string
+	for _, node := range append([]KingpinNode{globalNode}, plugin.kingpinNodes()...) {
+		values = append(values, "\x01")
+		values = append(values, kingpinValues(node)...)
+	}
+
+	hash := sha1.Sum([]byte(strings.Join(values, "\x00")))
+	return &resultCache{
+		key: strings.ToLower(fmt.Sprintf(".nagocheck-cache-%s-%s-%s", module.Name(), plugin.Name(),
+			hex.EncodeToString(hash[:8]))),
+		ttl: globals.cacheTTL,
+	}
+}
+
+// kingpinValues returns the parsed values of all flags and arguments of the given kingpin node as name=value
+func kingpinValues(node KingpinNode) (values []string) {
+	var flags []*kingpin.FlagModel
+	var args []*kingpin.ArgModel
+	switch node := node.(type) {
+	case *kingpin.Application:
+		model := node.Model()
+		flags, args = model.Flags, model.Args
+	case *kingpin.CmdClause:
+		model := node.Model()
+		flags, args = model.Flags, model.Args
+	}
+
+	for _, flag := range flags {
+		if flag.Name != "cache-ttl" && flag.Name != "help" {
+			values = append(values, "--"+flag.Name+"="+flag.Value.String())
+		}
+	}
+	for _, arg := range args {
+		values = append(values, arg.Name+"="+arg.Value.String())
+	}
+
+	return values
+}
+
+// Load returns the cached result in case it is younger than the TTL
+func (c *resultCache) Load(module Module, plugin Plugin) (result SinkResult, ok bool) {
+	logger := NewLogger("cache").WithField("key", c.key)
+
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return result, false
+	}
+
+	var cached cachedResult
+	found, err := LoadVersionedData(backend, c.key, cachePersistenceVersion, &cached)
+	if err != nil {
+		logger.Debugf("could not load cached result: %s", err.Error())
+		return result, false
+	} else if !found {
+		return result, false
+	}
+
+	age := time.Since(cached.Timestamp)
+	if age < 0 || age >= c.ttl {
+		return result, false
+	}
+
+	result = newBaseSinkResult(module, plugin)
+	result.CheckSource = cached.CheckSource
+	result.Timestamp = cached.Timestamp
+	result.ExitCode = cached.ExitCode
+	result.State = cached.State
+	result.RawOutput = cached.RawOutput
+	result.Output = cached.Output
+
+	for _, value := range cached.PerfData {
+		perfData, err := parsePerfData(value)
+		if err != nil {
+			logger.Debugf("could not parse cached performance data: %s", err.Error())
+			return result, false
+		}
+		result.PerfData = append(result.PerfData, perfData)
+	}
+
+	logger.Debugf("serving cached result with age %s", age.Round(time.Second))
+	return result, true
+}
+
+// Store saves the given result, unless its state is UNKNOWN, as failed probes should be retried immediately
+func (c *resultCache) Store(result SinkResult) error {
+	if result.ExitCode == int(nagopher.StateUnknown().ExitCode()) {
+		return nil
+	}
+
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return err
+	}
+
+	return StoreVersionedData(backend, c.key, cachePersistenceVersion, cachedResult{
+		Timestamp:   result.Timestamp,
+		CheckSource: result.CheckSource,
+		ExitCode:    result.ExitCode,
+		State:       result.State,
+		RawOutput:   result.RawOutput,
+		Output:      result.Output,
+		PerfData:    result.PerfDataStrings(),
+	})
+}
+
+// parsePerfData parses performance data formatted according to the Nagios plugin specs, which is required for
+// restoring cached results, as nagopher only supports formatting them
+func parsePerfData(value string) (nagopher.PerfData, error) {
+	var name, rest string
+	if strings.HasPrefix(value, "'") {
+		index := strings.Index(value, "'=")
+		if index == -1 {
+			return nil, fmt.Errorf("invalid performance data: %s", value)
+		}
+		name, rest = value[1:index], value[index+2:]
+	} else {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid performance data: %s", value)
+		}
+		name, rest = parts[0], parts[1]
+	}
+
+	fields := strings.Split(rest, ";")
+	for len(fields) < 5 {
+		fields = append(fields, "")
+	}
+
+	match := perfDataValueRE.FindStringSubmatch(fields[0])
+	if match == nil {
+		return nil, fmt.Errorf("invalid performance data value: %s", value)
+	}
+
+	number := math.NaN()
+	if match[1] != "U" {
+		var err error
+		if number, err = strconv.ParseFloat(match[1], 64); err != nil {
+			return nil, fmt.Errorf("invalid performance data value: %s", value)
+		}
+	}
+
+	optionalBounds := func(specifier string) (*nagopher.Bounds, error) {
+		if specifier == "" {
+			return nil, nil
+		}
+
+		bounds, err := nagopher.NewBoundsFromNagiosRange(specifier)
+		return &bounds, err
+	}
+
+	warningThreshold, err := optionalBounds(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	criticalThreshold, err := optionalBounds(fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var valueRange *nagopher.Bounds
+	if fields[3] != "" || fields[4] != "" {
+		lowerBound := fields[3]
+		if lowerBound == "" {
+			lowerBound = "~"
+		}
+		if valueRange, err = optionalBounds(lowerBound + ":" + fields[4]); err != nil {
+			return nil, err
+		}
+	}
+
+	return nagopher.NewNumericPerfData(name, number, match[2], valueRange, warningThreshold, criticalThreshold)
+}
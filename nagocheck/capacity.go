@@ -0,0 +1,371 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CapacityReport contains the options of the capacity report mode, which is available for plugins declaring capacity
+// contexts using PluginCapacityContexts()
+type CapacityReport struct {
+	Enabled bool
+	Window  time.Duration
+}
+
+// capacitySample contains a historic value of a capacity metric as pair of UNIX timestamp and value, which keeps the
+// persisted history compact
+type capacitySample [2]float64
+
+type capacityCheck struct {
+	nagopher.Check
+
+	plugin   Plugin
+	contexts map[string]bool
+	entries  []capacityEntry
+}
+
+// capacityEntry contains the current value of a single capacity metric along with its trend per day and the predicted
+// exhaustion, where capacity is NaN if unknown and exhaustion is zero if not being predicted
+type capacityEntry struct {
+	name       string
+	unit       string
+	value      float64
+	capacity   float64
+	trend      float64
+	history    time.Duration
+	exhaustion time.Time
+}
+
+// capacityHistoryInterval is the minimum interval between two samples within the capacity history, so that regular
+// executions every few minutes do not bloat the persisted data
+const capacityHistoryInterval = 6 * time.Hour
+
+// capacityHistoryLength is the maximum amount of samples per metric, which covers 90 days at the minimum interval
+const capacityHistoryLength = 360
+
+// capacityPersistenceVersion is the version of the layout of the persisted capacity history, which must be increased on
+// changes
+const capacityPersistenceVersion = 1
+
+// capacityHorizon is the maximum time span for which an exhaustion is being predicted
+const capacityHorizon = 5 * 365 * 24 * time.Hour
+
+// PluginCapacityContexts is a functional option for NewPlugin(), which declares the contexts whose metrics consume a
+// finite capacity like disk space. The history of these metrics is being recorded during every execution and --report
+// turns the plugin into an informational capacity report including trends and predicted exhaustion.
+func PluginCapacityContexts(contextNames ...string) PluginOpt {
+	return func(p *basePlugin) {
+		p.capacityContexts = contextNames
+	}
+}
+
+// ApplyCapacityReport wraps the given check, so that the history of all capacity metrics of the plugin is being
+// recorded after running the check. If the capacity report mode is enabled, the check always returns OK unless probing
+// failed and summarizes the current value, trend and predicted exhaustion of each capacity metric instead.
+func ApplyCapacityReport(check nagopher.Check, plugin Plugin) nagopher.Check {
+	contextNames := plugin.CapacityContexts()
+	if len(contextNames) == 0 {
+		return check
+	}
+
+	contexts := make(map[string]bool)
+	for _, contextName := range contextNames {
+		contexts[contextName] = true
+	}
+
+	return &capacityCheck{Check: check, plugin: plugin, contexts: contexts}
+}
+
+func (c *capacityCheck) Run(warnings nagopher.WarningCollection) {
+	c.Check.Run(warnings)
+	if c.Check.State() == nagopher.StateUnknown() {
+		return
+	}
+
+	if history := c.plugin.History(); history != nil {
+		c.recordHistory(history)
+		return
+	}
+
+	logger := c.plugin.Logger().WithField("key", c.persistenceKey())
+	histories, backend, err := c.loadJSONHistories()
+	if err != nil {
+		logger.Debugf("could not load capacity history: %s", err.Error())
+		return
+	}
+
+	now := time.Now()
+	changed := false
+	report := c.plugin.CapacityReport()
+	for _, result := range c.capacityResults() {
+		numericMetric := result.Metric().OrElse(nil).(nagopher.NumericMetric)
+		sample := capacitySample{float64(now.Unix()), numericMetric.Value()}
+		history := histories[numericMetric.Name()]
+		if len(history) == 0 || now.Sub(time.Unix(int64(history[len(history)-1][0]), 0)) >= capacityHistoryInterval {
+			history = append(history, sample)
+			if len(history) > capacityHistoryLength {
+				history = history[len(history)-capacityHistoryLength:]
+			}
+			histories[numericMetric.Name()] = history
+			changed = true
+		}
+
+		if report.Enabled {
+			c.entries = append(c.entries, newCapacityEntry(result, numericMetric, history, sample, now, report.Window))
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := StoreVersionedData(backend, c.persistenceKey(), capacityPersistenceVersion, histories); err != nil {
+		logger.Debugf("could not store capacity history: %s", err.Error())
+	}
+}
+
+// recordHistory records all capacity metrics within the history of the plugin, which replaces the single JSON document
+// used otherwise. The samples of the JSON document are being imported once for series without any samples.
+func (c *capacityCheck) recordHistory(history *History) {
+	now := time.Now()
+	report := c.plugin.CapacityReport()
+
+	var jsonHistories map[string][]capacitySample
+	for _, result := range c.capacityResults() {
+		numericMetric := result.Metric().OrElse(nil).(nagopher.NumericMetric)
+
+		series := history.Series(numericMetric.Name())
+		if len(series) == 0 {
+			if jsonHistories == nil {
+				jsonHistories, _, _ = c.loadJSONHistories()
+			}
+			for _, sample := range jsonHistories[numericMetric.Name()] {
+				series = append(series, HistorySample{Timestamp: time.Unix(int64(sample[0]), 0), Value: sample[1]})
+			}
+			if len(series) > 0 {
+				history.importSamples(numericMetric.Name(), series)
+			}
+		}
+		history.Record(numericMetric.Name(), numericMetric.Value())
+
+		if report.Enabled {
+			samples := make([]capacitySample, len(series))
+			for index, sample := range series {
+				samples[index] = capacitySample{float64(sample.Timestamp.Unix()), sample.Value}
+			}
+
+			sample := capacitySample{float64(now.Unix()), numericMetric.Value()}
+			c.entries = append(c.entries, newCapacityEntry(result, numericMetric, samples, sample, now, report.Window))
+		}
+	}
+}
+
+// capacityResults returns all results of capacity metrics with a numeric value
+func (c *capacityCheck) capacityResults() (results []nagopher.Result) {
+	for _, result := range c.Check.Results().Get() {
+		metric, err := result.Metric().Get()
+		if err != nil || !c.contexts[metric.ContextName()] {
+			continue
+		}
+		numericMetric, ok := metric.(nagopher.NumericMetric)
+		if !ok || math.IsNaN(numericMetric.Value()) {
+			continue
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// loadJSONHistories loads the capacity history of plugins without History, which is stored as single JSON document
+// using the selected persistence backend
+func (c *capacityCheck) loadJSONHistories() (map[string][]capacitySample, PersistenceBackend, error) {
+	histories := make(map[string][]capacitySample)
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return histories, nil, err
+	}
+
+	if _, err := LoadVersionedData(backend, c.persistenceKey(), capacityPersistenceVersion, &histories); err != nil {
+		c.plugin.Logger().Debugf("could not load capacity history: %s", err.Error())
+		histories = make(map[string][]capacitySample)
+	}
+
+	return histories, backend, nil
+}
+
+func (c *capacityCheck) State() nagopher.State {
+	if !c.plugin.CapacityReport().Enabled || c.Check.State() == nagopher.StateUnknown() {
+		return c.Check.State()
+	}
+
+	return nagopher.StateOk()
+}
+
+func (c *capacityCheck) Summary() string {
+	if !c.plugin.CapacityReport().Enabled || c.Check.State() == nagopher.StateUnknown() {
+		return c.Check.Summary()
+	}
+
+	var nearest *capacityEntry
+	for index, entry := range c.entries {
+		if !entry.exhaustion.IsZero() && (nearest == nil || entry.exhaustion.Before(nearest.exhaustion)) {
+			nearest = &c.entries[index]
+		}
+	}
+
+	summary := fmt.Sprintf("capacity report for %d metrics", len(c.entries))
+	if len(c.entries) == 1 {
+		summary = "capacity report for 1 metric"
+	}
+	if nearest == nil {
+		return summary + ", no exhaustion predicted"
+	}
+
+	return fmt.Sprintf("%s, %s exhausted %s", summary, nearest.name, nearest.exhaustionString())
+}
+
+func (c *capacityCheck) VerboseSummary() []string {
+	if !c.plugin.CapacityReport().Enabled || c.Check.State() == nagopher.StateUnknown() {
+		return c.Check.VerboseSummary()
+	}
+
+	lines := make([]string, len(c.entries))
+	for index, entry := range c.entries {
+		lines[index] = entry.String()
+	}
+	sort.Strings(lines)
+
+	return lines
+}
+
+func (c *capacityCheck) persistenceKey() string {
+	return pluginPersistenceKey("capacity", c.plugin, "")
+}
+
+// newCapacityEntry computes the trend of a capacity metric using a linear regression over all samples within the
+// given window including the current one, which requires samples spanning at least a day
+func newCapacityEntry(result nagopher.Result, metric nagopher.NumericMetric, history []capacitySample,
+	current capacitySample, now time.Time, window time.Duration) capacityEntry {
+	entry := capacityEntry{
+		name:     metric.Name(),
+		unit:     metric.ValueUnit(),
+		value:    metric.Value(),
+		capacity: metric.ValueRange().OrElse(nagopher.NewBounds()).Upper().OrElse(math.NaN()),
+	}
+	if math.IsInf(entry.capacity, 1) {
+		entry.capacity = math.NaN()
+	}
+	if math.IsNaN(entry.capacity) && entry.unit == "%" {
+		entry.capacity = 100
+	}
+	if resource, ok := result.Resource().OrElse(nil).(Resource); ok {
+		if section := resource.SectionOf(metric); section != "" && section != metric.Name() {
+			entry.name = section + " (" + metric.ContextName() + ")"
+		}
+	}
+
+	var samples []capacitySample
+	for _, sample := range history {
+		if sample[0] < current[0] && now.Sub(time.Unix(int64(sample[0]), 0)) <= window {
+			samples = append(samples, sample)
+		}
+	}
+	samples = append(samples, current)
+
+	entry.history = time.Duration(samples[len(samples)-1][0]-samples[0][0]) * time.Second
+	if len(samples) < 3 || entry.history < 24*time.Hour {
+		entry.trend = math.NaN()
+		return entry
+	}
+
+	// Least squares regression with days since the first sample as x, resulting in the trend per day
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range samples {
+		x := (sample[0] - samples[0][0]) / 86400
+		sumX, sumY, sumXY, sumXX = sumX+x, sumY+sample[1], sumXY+x*sample[1], sumXX+x*x
+	}
+	count := float64(len(samples))
+	entry.trend = (count*sumXY - sumX*sumY) / (count*sumXX - sumX*sumX)
+
+	if !math.IsNaN(entry.capacity) && entry.trend > 0 {
+		remainingDays := math.Max(0, (entry.capacity-entry.value)/entry.trend)
+		if remainingDays <= capacityHorizon.Hours()/24 {
+			entry.exhaustion = now.Add(time.Duration(remainingDays * float64(24*time.Hour)))
+		}
+	}
+
+	return entry
+}
+
+func (e capacityEntry) String() string {
+	line := e.name + ": " + formatCapacityValue(e.value, e.unit)
+	if !math.IsNaN(e.capacity) {
+		line += " of " + formatCapacityValue(e.capacity, e.unit)
+	}
+
+	if math.IsNaN(e.trend) {
+		return line + ", insufficient history for trend"
+	}
+
+	trend := formatCapacityValue(math.Abs(e.trend), e.unit)
+	if strings.TrimRight(trend, e.unit) == "0" {
+		trend = "±" + trend
+	} else if e.trend > 0 {
+		trend = "+" + trend
+	} else {
+		trend = "-" + trend
+	}
+	line += fmt.Sprintf(", trend %s/d over %.0fd", trend, e.history.Hours()/24)
+
+	if e.exhaustion.IsZero() {
+		return line + ", no exhaustion predicted"
+	}
+
+	return line + ", exhausted " + e.exhaustionString()
+}
+
+func (e capacityEntry) exhaustionString() string {
+	days := time.Until(e.exhaustion).Hours() / 24
+	if days < 1 {
+		return "now"
+	}
+
+	return fmt.Sprintf("in %.0fd (%s)", days, e.exhaustion.Format("2006-01-02"))
+}
+
+// formatCapacityValue formats the given value with a precision of two, omitting trailing zeros
+func formatCapacityValue(value float64, unit string) string {
+	if unit == "B" {
+		if value == 0 {
+			return "0B"
+		}
+		return FormatBinarySize(value)
+	}
+
+	formatted := strings.TrimRight(strconv.FormatFloat(value, 'f', 2, 64), "0")
+	return strings.TrimSuffix(formatted, ".") + unit
+}
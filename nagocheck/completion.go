@@ -0,0 +1,230 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"sort"
+	"strings"
+)
+
+type completionTool struct {
+	app   *kingpin.Application
+	shell string
+}
+
+// completionNode represents a single command path (e.g. "system load") together with its subcommands and all flags,
+// which are available at this level including the flags of all parent commands.
+type completionNode struct {
+	path        string
+	subcommands []*kingpin.CmdModel
+	flags       []*kingpin.FlagModel
+}
+
+// NewCompletionTool instantiates a Tool, which generates shell completion scripts for bash, zsh and fish by
+// introspecting the kingpin command tree of the application.
+func NewCompletionTool() Tool {
+	return &completionTool{}
+}
+
+func (t *completionTool) Name() string {
+	return "completion"
+}
+
+func (t *completionTool) DefineCommand(app *kingpin.Application) {
+	t.app = app
+
+	node := app.Command(t.Name(), "Generate shell completion script for all modules, plugins and flags.")
+	node.Arg("shell", "Shell for which the completion script should be generated.").
+		Required().EnumVar(&t.shell, "bash", "zsh", "fish")
+}
+
+func (t *completionTool) Execute(modules map[string]Module) error {
+	model := t.app.Model()
+	nodes := collectCompletionNodes("", model.CmdGroupModel, visibleFlags(model.FlagGroupModel))
+
+	switch t.shell {
+	case "bash":
+		fmt.Print(t.generateBash(model.Name, nodes))
+	case "zsh":
+		fmt.Print("autoload -U +X bashcompinit && bashcompinit\n" + t.generateBash(model.Name, nodes))
+	case "fish":
+		fmt.Print(t.generateFish(model.Name, nodes))
+	default:
+		return fmt.Errorf("unsupported shell: %s", t.shell)
+	}
+
+	return nil
+}
+
+func (t *completionTool) generateBash(name string, nodes []completionNode) string {
+	var buffer bytes.Buffer
+	function := "_" + completionIdentifier(name)
+
+	fmt.Fprintf(&buffer, "# bash completion for %s\n", name)
+	fmt.Fprintf(&buffer, "declare -A %s_commands=(\n", function)
+	// Associative arrays in bash do not support empty keys, so the application name is used as root path
+	for _, node := range nodes {
+		fmt.Fprintf(&buffer, "  [%q]=%q\n", strings.TrimSpace(name+" "+node.path),
+			strings.Join(commandNames(node.subcommands), " "))
+	}
+	fmt.Fprintf(&buffer, ")\ndeclare -A %s_flags=(\n", function)
+	for _, node := range nodes {
+		fmt.Fprintf(&buffer, "  [%q]=%q\n", strings.TrimSpace(name+" "+node.path),
+			strings.Join(flagNames(node.flags), " "))
+	}
+	fmt.Fprintf(&buffer, ")\n\n")
+
+	fmt.Fprintf(&buffer, `%[1]s() {
+  local cur="${COMP_WORDS[COMP_CWORD]}" path=%[2]q word sub i
+  for ((i = 1; i < COMP_CWORD; i++)); do
+    word="${COMP_WORDS[i]}"
+    for sub in ${%[1]s_commands[$path]}; do
+      if [[ "$sub" == "$word" ]]; then
+        path="$path $word"
+        break
+      fi
+    done
+  done
+
+  if [[ "$cur" == -* ]]; then
+    COMPREPLY=($(compgen -W "${%[1]s_flags[$path]}" -- "$cur"))
+  else
+    COMPREPLY=($(compgen -W "${%[1]s_commands[$path]}" -- "$cur"))
+  fi
+}
+complete -F %[1]s %[2]s
+`, function, name)
+
+	return buffer.String()
+}
+
+func (t *completionTool) generateFish(name string, nodes []completionNode) string {
+	var buffer bytes.Buffer
+	function := "__" + completionIdentifier(name) + "_path"
+
+	fmt.Fprintf(&buffer, "# fish completion for %s\n", name)
+	fmt.Fprintf(&buffer, "function %s\n    set -l path ''\n    for token in (commandline -opc)[2..-1]\n", function)
+	fmt.Fprintf(&buffer, "        switch $path\n")
+	for _, node := range nodes {
+		if len(node.subcommands) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&buffer, "            case '%s'\n", node.path)
+		fmt.Fprintf(&buffer, "                if contains -- $token %s\n", strings.Join(commandNames(node.subcommands), " "))
+		fmt.Fprintf(&buffer, "                    set path (string trim -- \"$path $token\")\n")
+		fmt.Fprintf(&buffer, "                end\n")
+	}
+	fmt.Fprintf(&buffer, "        end\n    end\n    echo $path\nend\n\n")
+	fmt.Fprintf(&buffer, "complete -c %s -f\n", name)
+
+	for _, node := range nodes {
+		condition := fmt.Sprintf("test (%s) = '%s'", function, node.path)
+		for _, command := range node.subcommands {
+			fmt.Fprintf(&buffer, "complete -c %s -n \"%s\" -a %s -d %s\n",
+				name, condition, command.Name, fishQuote(command.Help))
+		}
+
+		for _, flag := range node.flags {
+			short := ""
+			if flag.Short != 0 {
+				short = fmt.Sprintf(" -s %c", flag.Short)
+			}
+
+			requiresValue := ""
+			if !flag.IsBoolFlag() {
+				requiresValue = " -r"
+			}
+
+			fmt.Fprintf(&buffer, "complete -c %s -n \"%s\" -l %s%s%s -d %s\n",
+				name, condition, flag.Name, short, requiresValue, fishQuote(flag.Help))
+		}
+	}
+
+	return buffer.String()
+}
+
+func collectCompletionNodes(path string, group *kingpin.CmdGroupModel, flags []*kingpin.FlagModel) []completionNode {
+	node := completionNode{path: path, flags: flags}
+	var nodes []completionNode
+
+	for _, command := range group.Commands {
+		if command.Hidden {
+			continue
+		}
+
+		node.subcommands = append(node.subcommands, command)
+		commandPath := strings.TrimSpace(path + " " + command.Name)
+		commandFlags := append(append([]*kingpin.FlagModel{}, flags...), visibleFlags(command.FlagGroupModel)...)
+		nodes = append(nodes, collectCompletionNodes(commandPath, command.CmdGroupModel, commandFlags)...)
+	}
+
+	sort.Slice(node.subcommands, func(i, j int) bool {
+		return node.subcommands[i].Name < node.subcommands[j].Name
+	})
+
+	return append([]completionNode{node}, nodes...)
+}
+
+func visibleFlags(group *kingpin.FlagGroupModel) (flags []*kingpin.FlagModel) {
+	for _, flag := range group.Flags {
+		if !flag.Hidden {
+			flags = append(flags, flag)
+		}
+	}
+
+	return
+}
+
+func commandNames(commands []*kingpin.CmdModel) []string {
+	names := make([]string, len(commands))
+	for key, command := range commands {
+		names[key] = command.Name
+	}
+
+	return names
+}
+
+func flagNames(flags []*kingpin.FlagModel) []string {
+	var names []string
+	for _, flag := range flags {
+		names = append(names, "--"+flag.Name)
+		if flag.Short != 0 {
+			names = append(names, "-"+string(flag.Short))
+		}
+	}
+
+	return names
+}
+
+func completionIdentifier(name string) string {
+	return strings.Map(func(char rune) rune {
+		if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') {
+			return char
+		}
+		return '_'
+	}, name)
+}
+
+func fishQuote(value string) string {
+	return "'" + strings.Replace(strings.Replace(value, `\`, `\\`, -1), "'", `\'`, -1) + "'"
+}
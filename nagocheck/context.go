@@ -18,7 +18,12 @@
 
 package nagocheck
 
-import "github.com/snapserv/nagopher"
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/snapserv/nagopher"
+	"strings"
+)
 
 // Context provides a base type for nagocheck contexts, which embeds nagopher.Context
 type Context interface {
@@ -26,6 +31,13 @@ type Context interface {
 	Plugin() Plugin
 }
 
+// persistentContext is implemented by contexts keeping data across executions within the persistence backend, which
+// gets loaded once on first use and stored once by the plugin after all metrics have been evaluated
+type persistentContext interface {
+	Context
+	storePersistentData()
+}
+
 // ContextOpt is a type alias for functional options used by NewContext()
 type ContextOpt func(*baseContext)
 
@@ -51,3 +63,29 @@ func NewContext(plugin Plugin, parentContext nagopher.Context, options ...Contex
 func (s *baseContext) Plugin() Plugin {
 	return s.plugin
 }
+
+// contextPersistenceKey identifies data persisted by a context across executions by plugin and invocation, so that e.g.
+// different interfaces checked by the same plugin do not share their data
+func contextPersistenceKey(kind string, context Context) string {
+	return pluginPersistenceKey(kind, context.Plugin(), context.Name())
+}
+
+// pluginPersistenceKey identifies data persisted across executions by plugin and invocation, which is additionally
+// scoped by the given name, e.g. the name of a context
+func pluginPersistenceKey(kind string, plugin Plugin, name string) string {
+	tags := plugin.invocationTags()
+
+	var parts []string
+	for _, key := range sortedKeys(tags) {
+		parts = append(parts, key+"="+tags[key])
+	}
+
+	hash := sha1.Sum([]byte(name + "\x00" + strings.Join(parts, "\x00")))
+	moduleName := ""
+	if plugin.Module() != nil {
+		moduleName = plugin.Module().Name()
+	}
+
+	return strings.ToLower(".nagocheck-" + kind + "-" + moduleName + "-" + plugin.Name() + "-" +
+		hex.EncodeToString(hash[:8]))
+}
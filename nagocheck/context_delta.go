@@ -0,0 +1,132 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"github.com/snapserv/nagopher"
+	"strconv"
+	"time"
+)
+
+type deltaContext struct {
+	Context
+
+	previousValue *float64
+}
+
+// NewDeltaContext is a subclass of the standard DeltaContext provided by nagopher. It behaves exactly the same, except
+// that non-OK results get suppressed during the first execution after a system reboot, as the previous value has
+// been discarded and the delta would therefore be meaningless. Decreasing counters are treated as being reset or
+// wrapped around, in which case the sample gets suppressed and a warning is added instead of reporting a huge negative
+// delta.
+func NewDeltaContext(plugin Plugin, name string, previousValue *float64, warningThreshold *nagopher.Bounds, criticalThreshold *nagopher.Bounds) Context {
+	return &deltaContext{
+		Context: NewContext(plugin, nagopher.NewDeltaContext(
+			name, previousValue, warningThreshold, criticalThreshold,
+		)),
+		previousValue: previousValue,
+	}
+}
+
+func (c *deltaContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	var previousValue float64
+	if c.previousValue != nil {
+		previousValue = *c.previousValue
+	}
+
+	// Evaluating the parent context updates the previous value, which must also happen for suppressed samples
+	result := c.Context.Evaluate(metric, resource)
+	if numericMetric, ok := metric.(nagopher.NumericMetric); ok && numericMetric.Value() < previousValue {
+		return suppressCounterReset(c, metric, resource, previousValue, numericMetric.Value())
+	}
+
+	return suppressAfterReboot(c, handleStaleData(c, result, metric, resource), metric, resource)
+}
+
+// suppressCounterReset returns an OK result for a counter which has decreased since the previous sample, either due to
+// being reset (e.g. driver reload) or wrapping around at 32/64 bits. As both cases can not be told apart reliably, the
+// sample is being skipped and a warning gets attached to the resource.
+func suppressCounterReset(context nagopher.Context, metric nagopher.Metric, resource nagopher.Resource, previousValue float64, currentValue float64) nagopher.Result {
+	if nagocheckResource, ok := resource.(Resource); ok {
+		nagocheckResource.deferWarning(nagopher.NewWarning(
+			"counter %s decreased from %s to %s, skipping sample as it was reset or wrapped around",
+			metric.Name(), strconv.FormatFloat(previousValue, 'f', -1, 64), strconv.FormatFloat(currentValue, 'f', -1, 64),
+		))
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(nagopher.StateOk()),
+		nagopher.ResultMetric(metric), nagopher.ResultContext(context),
+		nagopher.ResultResource(resource), nagopher.ResultHint("suppressed after counter reset"),
+	)
+}
+
+// suppressAfterReboot downgrades non-OK results of the given context to OK if the resource has been collected for the
+// first time after a system reboot and --reboot-blackout is enabled, as previous values have been discarded since
+func suppressAfterReboot(context nagopher.Context, result nagopher.Result, metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	if !globals.rebootBlackout {
+		return result
+	}
+
+	nagocheckResource, ok := resource.(Resource)
+	if !ok || !nagocheckResource.Rebooted() {
+		return result
+	}
+
+	state, err := result.State().Get()
+	if err != nil || state == nagopher.StateOk() || state == nagopher.StateInfo() {
+		return result
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(nagopher.StateOk()),
+		nagopher.ResultMetric(result.Metric().OrElse(metric)), nagopher.ResultContext(context),
+		nagopher.ResultResource(resource), nagopher.ResultHint("suppressed after reboot"),
+	)
+}
+
+// handleStaleData either downgrades non-OK results of the given context to OK or returns UNKNOWN, depending on
+// --stale-data, if the persistent data of the resource exceeded --max-data-age and has therefore been discarded
+func handleStaleData(context nagopher.Context, result nagopher.Result, metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	nagocheckResource, ok := resource.(Resource)
+	if !ok || !nagocheckResource.Stale() {
+		return result
+	}
+
+	dataAge := nagocheckResource.DataAge().Round(time.Second)
+	hint := "persistent data was stale (" + DurationString(dataAge) + " old)"
+	if globals.staleData == "unknown" {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateUnknown()),
+			nagopher.ResultMetric(result.Metric().OrElse(metric)), nagopher.ResultContext(context),
+			nagopher.ResultResource(resource), nagopher.ResultHint(hint),
+		)
+	}
+
+	state, err := result.State().Get()
+	if err != nil || state == nagopher.StateOk() || state == nagopher.StateInfo() {
+		return result
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(nagopher.StateOk()),
+		nagopher.ResultMetric(result.Metric().OrElse(metric)), nagopher.ResultContext(context),
+		nagopher.ResultResource(resource), nagopher.ResultHint("suppressed as "+hint),
+	)
+}
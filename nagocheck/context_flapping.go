@@ -0,0 +1,136 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"strconv"
+)
+
+// flappingPersistenceVersion is the version of the layout of persisted state histories, which must be increased on
+// changes
+const flappingPersistenceVersion = 1
+
+type flapDetectionContext struct {
+	Context
+
+	window    int
+	threshold int
+	histories map[string][]string
+}
+
+// NewFlapDetectionContext wraps the given context, so that a metric changes to at least WARNING state when its state
+// changed --flap-threshold times or more within the last --flap-window executions, similar to the flap detection of
+// Nagios but on the level of single metrics. String metrics are considered changed whenever their value differs from
+// the previous execution, while all other metrics are considered changed when their evaluated state differs. The
+// history is being kept within the persistence backend and the context behaves exactly like its parent by default. The
+// plugin must be instantiated with PluginFlapDetection() for the flap detection flags to be defined.
+func NewFlapDetectionContext(plugin Plugin, parentContext nagopher.Context) Context {
+	return &flapDetectionContext{
+		Context:   NewContext(plugin, parentContext),
+		window:    plugin.FlapWindow(),
+		threshold: plugin.FlapThreshold(),
+	}
+}
+
+func (c *flapDetectionContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	result := c.Context.Evaluate(metric, resource)
+	if c.threshold <= 0 || c.window < 2 {
+		return result
+	}
+
+	state, err := result.State().Get()
+	if err != nil || state == nagopher.StateUnknown() {
+		return result
+	}
+
+	observation := strconv.Itoa(int(state.ExitCode()))
+	if stringMetric, ok := metric.(nagopher.StringMetric); ok {
+		observation = stringMetric.Value()
+	}
+
+	c.loadHistories()
+	history := append(c.histories[metric.Name()], observation)
+	if len(history) > c.window {
+		history = history[len(history)-c.window:]
+	}
+	c.histories[metric.Name()] = history
+	c.Plugin().deferPersistence(c)
+
+	changes := 0
+	for i := 1; i < len(history); i++ {
+		if history[i] != history[i-1] {
+			changes++
+		}
+	}
+
+	if changes < c.threshold {
+		return result
+	}
+
+	c.Plugin().Logger().WithField("metric", metric.Name()).Debugf("detected %d state changes within %d runs",
+		changes, len(history))
+
+	flappingState := state
+	if flappingState.ExitCode() < nagopher.StateWarning().ExitCode() {
+		flappingState = nagopher.StateWarning()
+	}
+
+	hint := fmt.Sprintf("flapping, %d state changes within last %d runs", changes, len(history))
+	if resultHint := result.Hint(); resultHint != "" {
+		hint = resultHint + ", " + hint
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(flappingState),
+		nagopher.ResultMetric(result.Metric().OrElse(metric)), nagopher.ResultContext(c),
+		nagopher.ResultResource(resource), nagopher.ResultHint(hint),
+	)
+}
+
+func (c *flapDetectionContext) loadHistories() {
+	if c.histories != nil {
+		return
+	}
+
+	c.histories = make(map[string][]string)
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return
+	}
+
+	key := contextPersistenceKey("flapping", c)
+	if _, err := LoadVersionedData(backend, key, flappingPersistenceVersion, &c.histories); err != nil {
+		c.Plugin().Logger().Debugf("could not unmarshal state history: %s", err.Error())
+		c.histories = make(map[string][]string)
+	}
+}
+
+func (c *flapDetectionContext) storePersistentData() {
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return
+	}
+
+	key := contextPersistenceKey("flapping", c)
+	if err := StoreVersionedData(backend, key, flappingPersistenceVersion, c.histories); err != nil {
+		c.Plugin().Logger().Debugf("could not store state history: %s", err.Error())
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"github.com/snapserv/nagopher"
+)
+
+// hysteresisPersistenceVersion is the version of the layout of persisted states, which must be increased on changes
+const hysteresisPersistenceVersion = 1
+
+type hysteresisContext struct {
+	Context
+
+	warningRecover  nagopher.OptionalBounds
+	criticalRecover nagopher.OptionalBounds
+	states          map[string]int8
+}
+
+// NewHysteresisContext wraps the given context, so that a metric which has been in WARNING or CRITICAL state during the
+// previous execution only recovers once it matches the recovery thresholds given by --warning-recover and
+// --critical-recover. This avoids flapping of values hovering around a threshold. The previous states are being kept
+// within the persistence backend and the context behaves exactly like its parent without any recovery thresholds. The
+// plugin must be instantiated with PluginHysteresis() for the recovery thresholds to be defined.
+func NewHysteresisContext(plugin Plugin, parentContext nagopher.Context) Context {
+	return &hysteresisContext{
+		Context:         NewContext(plugin, parentContext),
+		warningRecover:  plugin.WarningRecoverThreshold(),
+		criticalRecover: plugin.CriticalRecoverThreshold(),
+	}
+}
+
+func (c *hysteresisContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	result := c.Context.Evaluate(metric, resource)
+	warningRecover := nagopher.OptionalBoundsPtr(c.warningRecover)
+	criticalRecover := nagopher.OptionalBoundsPtr(c.criticalRecover)
+	if warningRecover == nil && criticalRecover == nil {
+		return result
+	}
+
+	numericMetric, ok := result.Metric().OrElse(metric).(nagopher.NumericMetric)
+	state, err := result.State().Get()
+	if !ok || err != nil || state == nagopher.StateUnknown() {
+		return result
+	}
+
+	c.loadStates()
+	previousState := c.states[metric.Name()]
+	logger := c.Plugin().Logger().WithField("metric", metric.Name())
+
+	if previousState == nagopher.StateCritical().ExitCode() && state != nagopher.StateCritical() &&
+		criticalRecover != nil && !(*criticalRecover).Match(numericMetric.Value()) {
+		logger.Debugf("keeping critical state until recovery threshold is met")
+		result = c.stickyResult(nagopher.StateCritical(), *criticalRecover, numericMetric, resource)
+	} else if previousState >= nagopher.StateWarning().ExitCode() && state == nagopher.StateOk() &&
+		warningRecover != nil && !(*warningRecover).Match(numericMetric.Value()) {
+		logger.Debugf("keeping warning state until recovery threshold is met")
+		result = c.stickyResult(nagopher.StateWarning(), *warningRecover, numericMetric, resource)
+	}
+
+	c.states[metric.Name()] = result.State().OrElse(state).ExitCode()
+	c.Plugin().deferPersistence(c)
+
+	return result
+}
+
+func (c *hysteresisContext) stickyResult(state nagopher.State, recover nagopher.Bounds, metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	return nagopher.NewResult(
+		nagopher.ResultState(state),
+		nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+		nagopher.ResultHint("not yet recovered, "+recover.ViolationHint()),
+	)
+}
+
+func (c *hysteresisContext) loadStates() {
+	if c.states != nil {
+		return
+	}
+
+	c.states = make(map[string]int8)
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return
+	}
+
+	key := contextPersistenceKey("hysteresis", c)
+	if _, err := LoadVersionedData(backend, key, hysteresisPersistenceVersion, &c.states); err != nil {
+		c.Plugin().Logger().Debugf("could not unmarshal previous states: %s", err.Error())
+		c.states = make(map[string]int8)
+	}
+}
+
+func (c *hysteresisContext) storePersistentData() {
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return
+	}
+
+	key := contextPersistenceKey("hysteresis", c)
+	if err := StoreVersionedData(backend, key, hysteresisPersistenceVersion, c.states); err != nil {
+		c.Plugin().Logger().Debugf("could not store previous states: %s", err.Error())
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"github.com/snapserv/nagopher"
+	"math"
+	"time"
+)
+
+// RateState contains the previous value of a counter and the time it has been collected at
+type RateState struct {
+	Value     float64 `json:"value"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// RateStates contains the previous values of all counters evaluated by a rate context, keyed by metric name. It must be
+// part of the persistent data of a resource, so that NewRateContext() can compute rates across plugin executions.
+type RateStates map[string]RateState
+
+// RateContextOpt is a type alias for functional options used by NewRateContext()
+type RateContextOpt func(*rateContext)
+
+type rateContext struct {
+	Context
+
+	states            *RateStates
+	factor            float64
+	unit              string
+	hasUnit           bool
+	warningThreshold  *nagopher.Bounds
+	criticalThreshold *nagopher.Bounds
+	rates             map[string]nagopher.NumericMetric
+}
+
+// NewRateContext instantiates a context which evaluates the per-second rate of counter metrics against the given
+// thresholds. The rate is computed from the previous value and timestamp of each metric stored in the given states,
+// which get updated with the current values afterwards. Unlike NewDeltaContext(), thresholds do not depend on the check
+// interval. The rate is reported as '<metric>_rate', which is unknown until a second sample is available.
+func NewRateContext(plugin Plugin, name string, states *RateStates, warningThreshold *nagopher.Bounds, criticalThreshold *nagopher.Bounds, options ...RateContextOpt) Context {
+	context := &rateContext{
+		Context: NewContext(plugin, nagopher.NewScalarContext(
+			name, warningThreshold, criticalThreshold,
+		)),
+		states:            states,
+		factor:            1,
+		warningThreshold:  warningThreshold,
+		criticalThreshold: criticalThreshold,
+		rates:             make(map[string]nagopher.NumericMetric),
+	}
+
+	for _, option := range options {
+		option(context)
+	}
+
+	return context
+}
+
+// RateScale is a functional option for NewRateContext(), which multiplies the per-second rate by the given factor and
+// reports it using the given unit instead of the unit of the counter, e.g. 0.1 and '%' for busy time in milliseconds
+func RateScale(factor float64, unit string) RateContextOpt {
+	return func(c *rateContext) {
+		c.factor = factor
+		c.unit = unit
+		c.hasUnit = true
+	}
+}
+
+func (c *rateContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	numericMetric, ok := metric.(nagopher.NumericMetric)
+	if !ok {
+		return NewInvalidMetricTypeResult(c, metric, resource)
+	}
+
+	now := time.Now()
+	previous, exists := c.state(metric.Name())
+	c.update(numericMetric, now)
+	c.rates[metric.Name()] = c.rateMetric(numericMetric, math.NaN())
+
+	// Rates can only be computed once a previous sample with an earlier timestamp is available
+	elapsed := now.Sub(time.Unix(0, previous.Timestamp)).Seconds()
+	if !exists || previous.Timestamp == 0 || elapsed <= 0 {
+		return handleStaleData(c, nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateOk()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint("waiting for second sample"),
+		), metric, resource)
+	}
+
+	if numericMetric.Value() < previous.Value {
+		return suppressCounterReset(c, metric, resource, previous.Value, numericMetric.Value())
+	}
+
+	rate := (numericMetric.Value() - previous.Value) / elapsed * c.factor
+	rateMetric := c.rateMetric(numericMetric, Round(rate, 2))
+	c.rates[metric.Name()] = rateMetric
+
+	return suppressAfterReboot(c, c.Context.Evaluate(rateMetric, resource), rateMetric, resource)
+}
+
+// Performance returns the computed rate including thresholds, which is reported as unknown value if no rate could be
+// computed, so that the performance data of a metric keeps its name across executions
+func (c *rateContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	rateMetric, ok := c.rates[metric.Name()]
+	if !ok {
+		numericMetric, isNumeric := metric.(nagopher.NumericMetric)
+		if !isNumeric {
+			return nagopher.OptionalPerfData{}, nil
+		}
+		rateMetric = c.rateMetric(numericMetric, math.NaN())
+	}
+
+	perfData, err := nagopher.NewPerfData(rateMetric, c.warningThreshold, c.criticalThreshold)
+	if err != nil {
+		return nagopher.OptionalPerfData{}, err
+	}
+
+	return nagopher.NewOptionalPerfData(perfData), nil
+}
+
+func (c *rateContext) rateMetric(metric nagopher.NumericMetric, rate float64) nagopher.NumericMetric {
+	unit := metric.ValueUnit()
+	if c.hasUnit {
+		unit = c.unit
+	}
+
+	return nagopher.MustNewNumericMetric(metric.Name()+"_rate", rate, unit, nil, metric.ContextName())
+}
+
+func (c *rateContext) state(name string) (RateState, bool) {
+	state, ok := (*c.states)[name]
+	return state, ok
+}
+
+func (c *rateContext) update(metric nagopher.NumericMetric, now time.Time) {
+	if *c.states == nil {
+		*c.states = make(RateStates)
+	}
+
+	(*c.states)[metric.Name()] = RateState{Value: metric.Value(), Timestamp: now.UnixNano()}
+}
@@ -0,0 +1,134 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"strings"
+)
+
+// RatioMode specifies how the percentage of a ratio context is being computed out of its two metrics
+type RatioMode int
+
+const (
+	// RatioOfTotal computes the numerator as percentage of the denominator, e.g. active disks out of all disks
+	RatioOfTotal RatioMode = iota
+	// RatioOfSum computes the numerator as percentage of the sum of both metrics, e.g. cache hits out of hits and misses
+	RatioOfSum
+)
+
+type ratioContext struct {
+	Context
+
+	mode        RatioMode
+	numerator   string
+	denominator string
+	pending     map[string]map[string]float64
+}
+
+// pendingResult is returned for the first metric of a ratio, which can not be evaluated until the second metric is
+// known. Wrapping contexts must pass it through as-is instead of applying thresholds to the raw value.
+type pendingResult struct {
+	nagopher.Result
+}
+
+// NewRatioContext instantiates a context which computes a percentage out of two metrics and evaluates it against the
+// given thresholds. Both metrics have to use this context and their names must end with the given numerator and
+// denominator names, while the remaining prefix (e.g. a pool name) identifies which metrics belong together. The
+// first metric of each pair always results in OK, while the second one results in the percentage named after the
+// context, e.g. `pool1_` + `hit_ratio`.
+func NewRatioContext(plugin Plugin, name string, mode RatioMode, numerator string, denominator string, warningThreshold *nagopher.Bounds, criticalThreshold *nagopher.Bounds) Context {
+	return &ratioContext{
+		Context: NewContext(plugin, nagopher.NewScalarContext(
+			name, warningThreshold, criticalThreshold,
+		)),
+		mode:        mode,
+		numerator:   numerator,
+		denominator: denominator,
+		pending:     make(map[string]map[string]float64),
+	}
+}
+
+func (c *ratioContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	numericMetric, ok := metric.(nagopher.NumericMetric)
+	if !ok {
+		return NewInvalidMetricTypeResult(c, metric, resource)
+	}
+
+	var prefix, part string
+	switch {
+	case strings.HasSuffix(metric.Name(), c.numerator):
+		prefix, part = strings.TrimSuffix(metric.Name(), c.numerator), c.numerator
+	case strings.HasSuffix(metric.Name(), c.denominator):
+		prefix, part = strings.TrimSuffix(metric.Name(), c.denominator), c.denominator
+	default:
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateUnknown()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint(fmt.Sprintf("metric must end with [%s] or [%s]", c.numerator, c.denominator)),
+		)
+	}
+
+	values, ok := c.pending[prefix]
+	if !ok {
+		values = make(map[string]float64)
+		c.pending[prefix] = values
+	}
+	values[part] = numericMetric.Value()
+
+	numeratorValue, hasNumerator := values[c.numerator]
+	denominatorValue, hasDenominator := values[c.denominator]
+	if !hasNumerator || !hasDenominator {
+		return pendingResult{nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateOk()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+		)}
+	}
+	delete(c.pending, prefix)
+
+	total := denominatorValue
+	if c.mode == RatioOfSum {
+		total += numeratorValue
+	}
+	if total == 0 {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateOk()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint("ratio undefined without any samples"),
+		)
+	}
+
+	ratioMetric := nagopher.MustNewNumericMetric(prefix+c.Name(), numeratorValue/total*100, "%", nil, c.Name())
+	if nagocheckResource, ok := resource.(Resource); ok {
+		nagocheckResource.Section(nagocheckResource.SectionOf(metric), ratioMetric)
+	}
+
+	return c.Context.Evaluate(ratioMetric, resource)
+}
+
+// Performance returns the raw metrics without thresholds, as the thresholds only apply to the computed percentage
+func (c *ratioContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	perfData, err := nagopher.NewPerfData(metric, nil, nil)
+	if err != nil {
+		return nagopher.OptionalPerfData{}, err
+	}
+
+	return nagopher.NewOptionalPerfData(perfData), nil
+}
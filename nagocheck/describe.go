@@ -0,0 +1,207 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"sort"
+)
+
+type describeTool struct {
+	app    *kingpin.Application
+	format string
+}
+
+type describeDocument struct {
+	Build   buildInfoDocument `json:"build"`
+	Flags   []describeFlag    `json:"flags"`
+	Modules []describeModule  `json:"modules"`
+}
+
+type describeModule struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Flags       []describeFlag   `json:"flags"`
+	Plugins     []describePlugin `json:"plugins"`
+}
+
+type describePlugin struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Arguments   []describeFlag    `json:"arguments"`
+	Flags       []describeFlag    `json:"flags"`
+	Thresholds  map[string]string `json:"thresholds"`
+	Contexts    []string          `json:"contexts"`
+}
+
+// describeFlag describes both flags and positional arguments, as the latter only lack a few fields
+type describeFlag struct {
+	Name        string   `json:"name"`
+	Help        string   `json:"help"`
+	Short       string   `json:"short,omitempty"`
+	Default     []string `json:"default,omitempty"`
+	Envar       string   `json:"envar,omitempty"`
+	PlaceHolder string   `json:"placeholder,omitempty"`
+	Required    bool     `json:"required"`
+	Boolean     bool     `json:"boolean,omitempty"`
+	Repeatable  bool     `json:"repeatable,omitempty"`
+}
+
+// NewDescribeTool instantiates a Tool, which emits a machine-readable description of all modules and plugins including
+// their flags, default thresholds and contexts, e.g. for generating command definitions with configuration management.
+func NewDescribeTool() Tool {
+	return &describeTool{}
+}
+
+func (t *describeTool) Name() string {
+	return "describe"
+}
+
+func (t *describeTool) DefineCommand(app *kingpin.Application) {
+	t.app = app
+
+	node := app.Command(t.Name(), "Describe all modules and plugins including their flags, default thresholds and "+
+		"contexts in a machine-readable format.")
+	node.Flag("format", "Output format of the description.").
+		Short('f').Default("json").EnumVar(&t.format, "json")
+}
+
+func (t *describeTool) Execute(modules map[string]Module) error {
+	model := t.app.Model()
+	document := describeDocument{
+		Build:   newBuildInfoDocument(modules),
+		Flags:   describeFlags(model.FlagGroupModel),
+		Modules: make([]describeModule, 0, len(modules)),
+	}
+
+	commands := make(map[string]*kingpin.CmdModel)
+	for _, command := range model.Commands {
+		commands[command.Name] = command
+	}
+
+	for _, module := range sortedModules(modules) {
+		command, ok := commands[module.Name()]
+		if !ok {
+			return fmt.Errorf("could not find command of module [%s]", module.Name())
+		}
+
+		document.Modules = append(document.Modules, t.describeModule(module, command))
+	}
+
+	switch t.format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(document)
+	}
+
+	return fmt.Errorf("unsupported format: %s", t.format)
+}
+
+func (t *describeTool) describeModule(module Module, command *kingpin.CmdModel) describeModule {
+	result := describeModule{
+		Name:        module.Name(),
+		Description: module.Description(),
+		Flags:       describeFlags(command.FlagGroupModel),
+		Plugins:     make([]describePlugin, 0, len(module.Plugins())),
+	}
+
+	subcommands := make(map[string]*kingpin.CmdModel)
+	for _, subcommand := range command.Commands {
+		subcommands[subcommand.Name] = subcommand
+	}
+
+	for _, plugin := range sortedPlugins(module) {
+		subcommand, ok := subcommands[plugin.Name()]
+		if !ok {
+			continue
+		}
+
+		result.Plugins = append(result.Plugins, t.describePlugin(plugin, subcommand))
+	}
+
+	return result
+}
+
+func (t *describeTool) describePlugin(plugin Plugin, command *kingpin.CmdModel) describePlugin {
+	result := describePlugin{
+		Name:        plugin.Name(),
+		Description: plugin.Description(),
+		Arguments:   make([]describeFlag, 0, len(command.Args)),
+		Flags:       describeFlags(command.FlagGroupModel),
+		Thresholds:  make(map[string]string),
+		Contexts:    []string{},
+	}
+
+	for _, arg := range command.Args {
+		result.Arguments = append(result.Arguments, describeFlag{
+			Name:       arg.Name,
+			Help:       arg.Help,
+			Default:    arg.Default,
+			Envar:      arg.Envar,
+			Required:   arg.Required,
+			Repeatable: isRepeatable(arg.Value),
+		})
+	}
+
+	// Default thresholds are only known as flag defaults, as plugins may derive their contexts from them
+	for _, flag := range result.Flags {
+		if (flag.Name == "warning" || flag.Name == "critical") && len(flag.Default) > 0 {
+			result.Thresholds[flag.Name] = flag.Default[0]
+		}
+	}
+
+	for _, context := range plugin.DefineCheck().Contexts() {
+		result.Contexts = append(result.Contexts, context.Name())
+	}
+	sort.Strings(result.Contexts)
+
+	return result
+}
+
+func describeFlags(group *kingpin.FlagGroupModel) []describeFlag {
+	flags := make([]describeFlag, 0, len(group.Flags))
+	for _, flag := range visibleFlags(group) {
+		short := ""
+		if flag.Short != 0 {
+			short = string(flag.Short)
+		}
+
+		flags = append(flags, describeFlag{
+			Name:        flag.Name,
+			Help:        flag.Help,
+			Short:       short,
+			Default:     flag.Default,
+			Envar:       flag.Envar,
+			PlaceHolder: flag.PlaceHolder,
+			Required:    flag.Required,
+			Boolean:     flag.IsBoolFlag(),
+			Repeatable:  isRepeatable(flag.Value),
+		})
+	}
+
+	return flags
+}
+
+func isRepeatable(value kingpin.Value) bool {
+	cumulative, ok := value.(interface{ IsCumulative() bool })
+	return ok && cumulative.IsCumulative()
+}
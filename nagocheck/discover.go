@@ -0,0 +1,345 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ServiceDiscoveryProvider is implemented by modules which are able to enumerate the objects present on the local
+// host, e.g. network interfaces or BGP neighbors, so that `discover` can emit a service definition for each of them
+type ServiceDiscoveryProvider interface {
+	DiscoverServices() ([]DiscoveredService, error)
+}
+
+// DiscoveredService is a single object which should be monitored by the given plugin. Args contains the positional
+// arguments for invoking the plugin, while Name gets appended to the service name and may be empty for plugins which
+// monitor all objects at once, e.g. all md arrays.
+type DiscoveredService struct {
+	Plugin string
+	Name   string
+	Args   []string
+}
+
+type discoverTool struct {
+	app         *kingpin.Application
+	format      string
+	host        string
+	template    string
+	binary      string
+	moduleNames []string
+}
+
+// discoveredCommand is the command definition of a plugin, which gets shared by all services of the same plugin
+type discoveredCommand struct {
+	name     string
+	command  []string
+	args     []*kingpin.ArgModel
+	varNames []string
+}
+
+type discoveredServiceDefinition struct {
+	name    string
+	command *discoveredCommand
+	args    []string
+}
+
+type directorBasket struct {
+	Command    map[string]directorCommand    `json:"Command"`
+	ServiceSet map[string]directorServiceSet `json:"ServiceSet"`
+}
+
+type directorCommand struct {
+	ObjectName     string                             `json:"object_name"`
+	ObjectType     string                             `json:"object_type"`
+	MethodsExecute string                             `json:"methods_execute"`
+	Command        string                             `json:"command"`
+	Arguments      map[string]directorCommandArgument `json:"arguments"`
+}
+
+type directorCommandArgument struct {
+	Value    string `json:"value"`
+	Order    string `json:"order"`
+	SkipKey  bool   `json:"skip_key"`
+	Required bool   `json:"required"`
+}
+
+type directorServiceSet struct {
+	ObjectName   string                     `json:"object_name"`
+	ObjectType   string                     `json:"object_type"`
+	Description  string                     `json:"description"`
+	AssignFilter string                     `json:"assign_filter"`
+	Services     map[string]directorService `json:"services"`
+}
+
+type directorService struct {
+	ObjectName   string            `json:"object_name"`
+	ObjectType   string            `json:"object_type"`
+	Imports      []string          `json:"imports"`
+	CheckCommand string            `json:"check_command"`
+	Vars         map[string]string `json:"vars"`
+}
+
+// NewDiscoverTool instantiates a Tool, which probes the local host for monitorable objects using all modules
+// implementing ServiceDiscoveryProvider and emits ready-to-import service definitions for each of them.
+func NewDiscoverTool() Tool {
+	return &discoverTool{}
+}
+
+func (t *discoverTool) Name() string {
+	return "discover"
+}
+
+func (t *discoverTool) DefineCommand(app *kingpin.Application) {
+	t.app = app
+	hostname, _ := os.Hostname()
+
+	node := app.Command(t.Name(), "Discover monitorable objects on the local host, e.g. interfaces, filesystems or BGP "+
+		"neighbors, and print service definitions for each of them.")
+
+	node.Flag("format", "Output format, either Nagios object definitions or an Icinga Director basket as JSON.").
+		Short('f').Default("nagios").EnumVar(&t.format, "nagios", "director")
+	node.Flag("host", "Specifies the host name which the services are being assigned to.").
+		Default(hostname).StringVar(&t.host)
+	node.Flag("template", "Specifies the service template which is being imported by all services.").
+		Default("generic-service").StringVar(&t.template)
+	node.Flag("binary", "Specifies the path of the nagocheck binary used within command definitions.").
+		Default("/usr/bin/nagocheck").StringVar(&t.binary)
+	node.Flag("module", "Only discover services of the given module, can be specified multiple times.").
+		Short('m').StringsVar(&t.moduleNames)
+}
+
+func (t *discoverTool) Execute(modules map[string]Module) error {
+	selected := modules
+	if len(t.moduleNames) > 0 {
+		selected = make(map[string]Module)
+		for _, name := range t.moduleNames {
+			module, ok := modules[name]
+			if !ok {
+				return fmt.Errorf("unknown module: %s", name)
+			}
+
+			selected[name] = module
+		}
+	}
+
+	services, err := t.discover(selected)
+	if err != nil {
+		return err
+	}
+
+	switch t.format {
+	case "nagios":
+		fmt.Print(t.formatNagios(services))
+		return nil
+	case "director":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(t.formatDirector(services))
+	}
+
+	return fmt.Errorf("unsupported format: %s", t.format)
+}
+
+// discover collects the services of all selected modules and resolves the commands of their plugins. Failing modules
+// are only reported on stderr, as e.g. FRRouting is not installed on every host.
+func (t *discoverTool) discover(modules map[string]Module) ([]discoveredServiceDefinition, error) {
+	model := t.app.Model()
+	commands := make(map[string]*discoveredCommand)
+
+	var definitions []discoveredServiceDefinition
+	for _, module := range sortedModules(modules) {
+		provider, ok := module.(ServiceDiscoveryProvider)
+		if !ok {
+			continue
+		}
+
+		services, err := provider.DiscoverServices()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not discover services of module [%s]: %s\n", module.Name(), err.Error())
+			continue
+		}
+
+		for _, service := range services {
+			key := module.Name() + " " + service.Plugin
+			command, ok := commands[key]
+			if !ok {
+				if command, err = t.newDiscoveredCommand(model, module.Name(), service.Plugin); err != nil {
+					return nil, err
+				}
+				commands[key] = command
+			}
+			if len(service.Args) > len(command.args) {
+				return nil, fmt.Errorf("too many arguments for command [%s]: %s", command.name,
+					strings.Join(service.Args, " "))
+			}
+
+			name := module.Name() + "-" + service.Plugin
+			if service.Name != "" {
+				name += "-" + service.Name
+			}
+
+			definitions = append(definitions, discoveredServiceDefinition{
+				name:    name,
+				command: command,
+				args:    service.Args,
+			})
+		}
+	}
+
+	sort.SliceStable(definitions, func(i, j int) bool {
+		return definitions[i].name < definitions[j].name
+	})
+
+	return definitions, nil
+}
+
+func (t *discoverTool) newDiscoveredCommand(model *kingpin.ApplicationModel, moduleName string, pluginName string) (*discoveredCommand, error) {
+	for _, moduleCommand := range model.Commands {
+		if moduleCommand.Name != moduleName {
+			continue
+		}
+
+		for _, pluginCommand := range moduleCommand.Commands {
+			if pluginCommand.Name != pluginName {
+				continue
+			}
+
+			command := &discoveredCommand{
+				name:    "nagocheck-" + moduleName + "-" + pluginName,
+				command: []string{t.binary, moduleName, pluginName},
+				args:    pluginCommand.Args,
+			}
+			for _, arg := range pluginCommand.Args {
+				varName := strings.Join([]string{"nc", moduleName, pluginName, arg.Name}, "_")
+				command.varNames = append(command.varNames, strings.Replace(varName, "-", "_", -1))
+			}
+
+			return command, nil
+		}
+	}
+
+	return nil, fmt.Errorf("could not find command of plugin [%s %s]", moduleName, pluginName)
+}
+
+// formatNagios returns Nagios object definitions for all services, passing the plugin arguments as $ARGn$ macros
+func (t *discoverTool) formatNagios(services []discoveredServiceDefinition) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# nagocheck services discovered on %s\n", t.host)
+
+	seen := make(map[string]bool)
+	for _, service := range services {
+		if seen[service.command.name] {
+			continue
+		}
+		seen[service.command.name] = true
+
+		commandLine := strings.Join(service.command.command, " ")
+		for key := range service.command.args {
+			commandLine += fmt.Sprintf(" $ARG%d$", key+1)
+		}
+
+		fmt.Fprintf(&builder, "\ndefine command {\n")
+		fmt.Fprintf(&builder, "    command_name        %s\n", service.command.name)
+		fmt.Fprintf(&builder, "    command_line        %s\n", commandLine)
+		fmt.Fprintf(&builder, "}\n")
+	}
+
+	for _, service := range services {
+		checkCommand := service.command.name
+		for _, arg := range service.args {
+			checkCommand += "!" + strings.Replace(arg, "!", "\\!", -1)
+		}
+
+		fmt.Fprintf(&builder, "\ndefine service {\n")
+		if t.template != "" {
+			fmt.Fprintf(&builder, "    use                 %s\n", t.template)
+		}
+		fmt.Fprintf(&builder, "    host_name           %s\n", t.host)
+		fmt.Fprintf(&builder, "    service_description %s\n", service.name)
+		fmt.Fprintf(&builder, "    check_command       %s\n", checkCommand)
+		fmt.Fprintf(&builder, "}\n")
+	}
+
+	return builder.String()
+}
+
+// formatDirector returns an Icinga Director basket containing a command per plugin and a service set with all
+// services, which gets assigned to the host by name and passes the plugin arguments as custom variables
+func (t *discoverTool) formatDirector(services []discoveredServiceDefinition) directorBasket {
+	serviceSet := directorServiceSet{
+		ObjectName:   "nagocheck-" + t.host,
+		ObjectType:   "template",
+		Description:  "nagocheck services discovered on " + t.host,
+		AssignFilter: "host.name=" + strconv.Quote(t.host),
+		Services:     make(map[string]directorService),
+	}
+	basket := directorBasket{
+		Command:    make(map[string]directorCommand),
+		ServiceSet: map[string]directorServiceSet{serviceSet.ObjectName: serviceSet},
+	}
+
+	for _, service := range services {
+		command := service.command
+		if _, ok := basket.Command[command.name]; !ok {
+			arguments := make(map[string]directorCommandArgument)
+			for key, arg := range command.args {
+				arguments[arg.Name] = directorCommandArgument{
+					Value:    "$" + command.varNames[key] + "$",
+					Order:    strconv.Itoa(key + 1),
+					SkipKey:  true,
+					Required: arg.Required,
+				}
+			}
+
+			basket.Command[command.name] = directorCommand{
+				ObjectName:     command.name,
+				ObjectType:     "object",
+				MethodsExecute: "PluginCheck",
+				Command:        strings.Join(command.command, " "),
+				Arguments:      arguments,
+			}
+		}
+
+		vars := make(map[string]string)
+		for key, arg := range service.args {
+			vars[command.varNames[key]] = arg
+		}
+
+		imports := []string{}
+		if t.template != "" {
+			imports = []string{t.template}
+		}
+
+		serviceSet.Services[service.name] = directorService{
+			ObjectName:   service.name,
+			ObjectType:   "object",
+			Imports:      imports,
+			CheckCommand: command.name,
+			Vars:         vars,
+		}
+	}
+
+	return basket
+}
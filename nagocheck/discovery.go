@@ -0,0 +1,213 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Target is a single probe destination, which has been discovered by expanding a service address
+type Target struct {
+	Address    string
+	ServerName string
+}
+
+// TargetDiscovery expands a single service address into multiple probe targets, either by resolving a DNS SRV record
+// or all A/AAAA records of a host name. This allows checking every node of anycast or load-balanced services with a
+// single plugin invocation, aggregating the results by requiring either all or a quorum of targets to pass.
+type TargetDiscovery struct {
+	Mode   string
+	Quorum int
+}
+
+// AutoDiscovery selects the objects of plugins checking multiple objects of the same kind, e.g. interfaces or md
+// arrays, which are either given explicitly as arguments or enumerated at runtime when using --auto. Plugins which
+// implicitly check all objects when none have been given keep doing so, while --auto makes this explicit.
+type AutoDiscovery struct {
+	Enabled bool
+	Exclude *regexp.Regexp
+
+	kind     string
+	implicit bool
+}
+
+// DiscoveryModes contains the names of all modes supported by TargetDiscovery
+var DiscoveryModes = []string{"none", "srv", "dns"}
+
+// DefineFlags defines the flags for configuring target discovery on the given kingpin node
+func (d *TargetDiscovery) DefineFlags(node KingpinNode) {
+	node.Flag("discover", "Expand the address into multiple targets, either using the SRV record of the given name "+
+		"(e.g. _https._tcp.example.com) or all A/AAAA records of the host part (e.g. example.com:443).").
+		Default("none").EnumVar(&d.Mode, DiscoveryModes...)
+
+	node.Flag("quorum", "Minimum amount of discovered targets which have to pass, all targets have to pass when zero.").
+		Default("0").IntVar(&d.Quorum)
+}
+
+// Enabled returns true if the address should be expanded into multiple targets
+func (d *TargetDiscovery) Enabled() bool {
+	return d.Mode != "" && d.Mode != "none"
+}
+
+// Required returns the amount of targets which have to pass out of the given total amount of targets. A quorum larger
+// than the amount of discovered targets is returned as-is, as it can never be reached.
+func (d *TargetDiscovery) Required(total int) int {
+	if d.Quorum <= 0 {
+		return total
+	}
+
+	return d.Quorum
+}
+
+// Targets resolves the given address into all probe targets according to the discovery mode. The server name of each
+// target defaults to the given server name, falling back to the host name which was used for reaching the target.
+func (d *TargetDiscovery) Targets(address string, serverName string, timeout time.Duration) ([]Target, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var targets []Target
+	switch d.Mode {
+	case "", "none":
+		targets = []Target{{Address: address}}
+	case "srv":
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", address)
+		if err != nil {
+			return nil, fmt.Errorf("could not lookup SRV record [%s]: %s", address, err.Error())
+		}
+
+		for _, record := range records {
+			host := trimTrailingDot(record.Target)
+			targets = append(targets, Target{
+				Address:    net.JoinHostPort(host, strconv.Itoa(int(record.Port))),
+				ServerName: host,
+			})
+		}
+	case "dns":
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse address [%s]: %s", address, err.Error())
+		}
+
+		addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve host [%s]: %s", host, err.Error())
+		}
+
+		for _, ip := range addresses {
+			targets = append(targets, Target{
+				Address:    net.JoinHostPort(ip, port),
+				ServerName: host,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown discovery mode: %s", d.Mode)
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets discovered for [%s]", address)
+	}
+
+	// Sort targets by address, as SRV records are returned in a randomized order based on their weights
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Address < targets[j].Address
+	})
+	for key := range targets {
+		if serverName != "" {
+			targets[key].ServerName = serverName
+		}
+	}
+
+	return targets, nil
+}
+
+func trimTrailingDot(name string) string {
+	if len(name) > 0 && name[len(name)-1] == '.' {
+		return name[:len(name)-1]
+	}
+
+	return name
+}
+
+// NewAutoDiscovery instantiates AutoDiscovery for the given kind of objects, e.g. 'interfaces'. When implicit is true,
+// all present objects are being checked if none have been given, even without specifying --auto.
+func NewAutoDiscovery(kind string, implicit bool) *AutoDiscovery {
+	return &AutoDiscovery{
+		kind:     kind,
+		implicit: implicit,
+	}
+}
+
+// DefineFlags defines the --auto flag on the given kingpin node
+func (d *AutoDiscovery) DefineFlags(node KingpinNode) {
+	node.Flag("auto", fmt.Sprintf("Check all present %s instead of the given ones, which are enumerated during "+
+		"each execution.", d.kind)).
+		BoolVar(&d.Enabled)
+}
+
+// DefineExcludeFlag defines the --exclude flag on the given kingpin node, which ignores all objects matching the
+// given regular expression during enumeration
+func (d *AutoDiscovery) DefineExcludeFlag(node KingpinNode, defaultPattern string) {
+	clause := node.Flag("exclude", fmt.Sprintf("Regular expression matching the names of %s which should be "+
+		"ignored. Only applies when enumerating all present %s.", d.kind, d.kind))
+	if defaultPattern != "" {
+		clause.Default(defaultPattern)
+	}
+
+	clause.RegexpVar(&d.Exclude)
+}
+
+// Active returns true if all present objects should be checked instead of the given names
+func (d *AutoDiscovery) Active(names []string) bool {
+	return d.Enabled || (d.implicit && len(names) == 0)
+}
+
+// Validate ensures that objects have either been given explicitly or are being enumerated, but not both
+func (d *AutoDiscovery) Validate(names []string) error {
+	if d.Enabled && len(names) > 0 {
+		return fmt.Errorf("either specify %s or --auto, but not both", d.kind)
+	}
+	if len(names) == 0 && !d.Active(names) {
+		return fmt.Errorf("no %s given, specify --auto for checking all present %s", d.kind, d.kind)
+	}
+
+	return nil
+}
+
+// Select returns the given names if there are any, otherwise all present names which are not excluded, sorted by name
+func (d *AutoDiscovery) Select(names []string, present []string) []string {
+	if !d.Active(names) {
+		return names
+	}
+
+	var result []string
+	for _, name := range present {
+		if d.Exclude == nil || !d.Exclude.MatchString(name) {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
@@ -0,0 +1,265 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// downtimeWindow declares a period of planned maintenance for all services matching the given host and service
+// patterns, which is either a fixed range of dates or a daily time range optionally restricted to some weekdays
+type downtimeWindow struct {
+	Host    string
+	Service string
+	Comment string
+
+	start, end time.Time
+	weekdays   map[time.Weekday]bool
+	from, to   time.Duration
+}
+
+type downtimeCheck struct {
+	nagopher.Check
+
+	window *downtimeWindow
+	state  nagopher.State
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// loadDowntimeWindows parses the downtime file, which contains one window per line formatted as '<host> <service>
+// <window> [comment]'. Host and service are glob patterns and the window is one of:
+//
+//	2019-06-01T22:00/2019-06-02T02:00    fixed range of local dates, also accepting RFC3339 and YYYY-MM-DD
+//	01:00-03:30                          every day, wrapping around midnight if the end precedes the start
+//	sat,sun@22:00-06:00                  on the given weekdays, where the window starts
+//
+// Empty lines and lines starting with '#' are being ignored.
+func loadDowntimeWindows(filePath string) ([]*downtimeWindow, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open downtime file: %s", err.Error())
+	}
+	defer file.Close()
+
+	var windows []*downtimeWindow
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		window, err := parseDowntimeWindow(line)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse downtime file [%s:%d]: %s", filePath, lineNumber, err.Error())
+		}
+		windows = append(windows, window)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read downtime file: %s", err.Error())
+	}
+
+	return windows, nil
+}
+
+func parseDowntimeWindow(line string) (*downtimeWindow, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("expected '<host> <service> <window> [comment]'")
+	}
+
+	window := &downtimeWindow{
+		Host:    fields[0],
+		Service: fields[1],
+		Comment: strings.Join(fields[3:], " "),
+	}
+	for _, pattern := range []string{window.Host, window.Service} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern [%s]", pattern)
+		}
+	}
+
+	spec := fields[2]
+	if parts := strings.SplitN(spec, "/", 2); len(parts) == 2 {
+		start, err := parseDowntimeDate(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseDowntimeDate(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("end of window must be after its start [%s]", spec)
+		}
+
+		window.start, window.end = start, end
+		return window, nil
+	}
+
+	if parts := strings.SplitN(spec, "@", 2); len(parts) == 2 {
+		window.weekdays = make(map[time.Weekday]bool)
+		for _, name := range strings.Split(parts[0], ",") {
+			weekday, ok := weekdayNames[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown weekday [%s]", name)
+			}
+			window.weekdays[weekday] = true
+		}
+		spec = parts[1]
+	}
+
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid window [%s]", spec)
+	}
+	from, err := parseTimeOfDay(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseTimeOfDay(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if from == to {
+		return nil, fmt.Errorf("window must not be empty [%s]", spec)
+	}
+
+	window.from, window.to = from, to
+	return window, nil
+}
+
+func parseDowntimeDate(value string) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("could not parse date [%s]", value)
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse time of day [%s]", value)
+	}
+
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// Matches returns true if the window applies to the given host and service
+func (w *downtimeWindow) Matches(host string, service string) bool {
+	hostMatch, _ := path.Match(strings.ToLower(w.Host), strings.ToLower(host))
+	serviceMatch, _ := path.Match(strings.ToLower(w.Service), strings.ToLower(service))
+
+	return hostMatch && serviceMatch
+}
+
+// Active returns true if the given time falls inside the window
+func (w *downtimeWindow) Active(now time.Time) bool {
+	if !w.start.IsZero() {
+		return !now.Before(w.start) && now.Before(w.end)
+	}
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	offset := now.Sub(midnight)
+
+	// Windows wrapping around midnight belong to the weekday on which they started
+	if w.from < w.to {
+		return w.from <= offset && offset < w.to && w.activeOn(now.Weekday())
+	}
+	if offset >= w.from {
+		return w.activeOn(now.Weekday())
+	}
+
+	return offset < w.to && w.activeOn(midnight.AddDate(0, 0, -1).Weekday())
+}
+
+func (w *downtimeWindow) activeOn(weekday time.Weekday) bool {
+	return w.weekdays == nil || w.weekdays[weekday]
+}
+
+// loadActiveDowntime returns the first window of --downtime-file which currently applies to the given host and
+// service, or nil if there is none or no downtime file has been specified
+func loadActiveDowntime(host string, service string) (*downtimeWindow, error) {
+	if globals.downtimeFile == "" {
+		return nil, nil
+	}
+
+	windows, err := loadDowntimeWindows(globals.downtimeFile)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, window := range windows {
+		if window.Matches(host, service) && window.Active(now) {
+			return window, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Apply wraps the given check, so that its final state gets replaced by --downtime-state while the window is active.
+// Performance data is being kept as-is. The check is being returned as-is if there is no active window.
+func (w *downtimeWindow) Apply(check nagopher.Check) (nagopher.Check, error) {
+	if w == nil {
+		return check, nil
+	}
+
+	state, err := ParseState(globals.downtimeState)
+	if err != nil {
+		return nil, err
+	}
+
+	return &downtimeCheck{Check: check, window: w, state: state}, nil
+}
+
+func (c *downtimeCheck) State() nagopher.State {
+	return c.state
+}
+
+func (c *downtimeCheck) Summary() string {
+	note := "maintenance"
+	if comment := strings.TrimSpace(c.window.Comment); comment != "" {
+		note += ": " + comment
+	}
+
+	state := c.Check.State()
+	if state == c.state {
+		return fmt.Sprintf("%s (%s)", c.Check.Summary(), note)
+	}
+
+	return fmt.Sprintf("%s (%s, actually %s)", c.Check.Summary(), note, strings.ToUpper(state.Description()))
+}
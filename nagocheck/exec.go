@@ -0,0 +1,225 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck/transport"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// NewTransport instantiates the transport which should be used by plugins for executing external commands of the given
+// backend (e.g. vtysh). Commands are being executed via SSH when a remote host was specified using the global flags
+// and locally otherwise, optionally guarded by a circuit breaker per backend and host.
+func NewTransport(backend string) transport.Transport {
+	var result transport.Transport
+	if globals.sshHost == "" {
+		result = transport.NewLocalTransport(ExecuteCommand)
+	} else {
+		result = transport.NewSSHTransport(ExecuteCommand, globals.sshHost,
+			transport.SSHUser(globals.sshUser),
+			transport.SSHPort(globals.sshPort),
+			transport.SSHKeyFile(globals.sshKey),
+			transport.SSHOptions(globals.sshOptions...),
+			transport.SSHCommand(strings.Split(globals.sshCommand, ",")),
+		)
+		backend += "-" + globals.sshHost
+	}
+
+	if globals.breakerThreshold > 0 {
+		result = newCircuitBreaker(result, backend, globals.breakerThreshold, globals.breakerWindow)
+	}
+
+	return result
+}
+
+// processGracePeriod is the time between asking a process group to terminate and killing it forcefully, which allows
+// wrappers like sudo to relay the termination signal to their children running with different privileges
+const processGracePeriod = 1 * time.Second
+
+var runningProcesses = struct {
+	sync.Mutex
+	groups map[int]struct{}
+	once   sync.Once
+}{groups: make(map[int]struct{})}
+
+// ExecuteCommand executes the given command with its arguments and returns the combined output of stdout and stderr.
+// The command runs within its own process group, which gets killed entirely if the command does not finish within the
+// given timeout or nagocheck itself gets terminated, so that no orphans (e.g. of sudo-wrapped commands) remain.
+func ExecuteCommand(timeout time.Duration, command []string) (string, error) {
+	var output bytes.Buffer
+	err := executeCommand(timeout, command, nil, &output, &output)
+
+	return output.String(), err
+}
+
+// ExecuteCommandWithInput executes the given command like ExecuteCommand(), but passes the given input on stdin and
+// only returns the output written to stdout. Output written to stderr is only used for error messages, so that it can
+// not interfere with parsing the output, e.g. of protocols being tunneled through SSH.
+func ExecuteCommandWithInput(timeout time.Duration, command []string, input string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	if err := executeCommand(timeout, command, strings.NewReader(input), &stdout, &stderr); err != nil {
+		sanitizedStderr := strings.Replace(strings.TrimSpace(stderr.String()), "\n", " ", -1)
+		if sanitizedStderr == "" {
+			return "", err
+		}
+
+		return "", fmt.Errorf("%s (%s)", err.Error(), sanitizedStderr)
+	}
+
+	return stdout.String(), nil
+}
+
+// executeCommand executes the given command like ExecuteCommand(), but reads stdin from the given reader (if any) and
+// writes stdout and stderr into the given writers
+func executeCommand(timeout time.Duration, command []string, stdin io.Reader, stdout io.Writer,
+	stderr io.Writer) error {
+	if len(command) == 0 {
+		return fmt.Errorf("no command given")
+	}
+
+	logger := NewLogger("exec").WithField("command", strings.Join(command, " "))
+	defer logger.Timed("command execution")()
+
+	// Passing the same writer twice ensures that exec never writes concurrently into it
+	output := &countingWriter{writer: stdout}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = stdin
+	cmd.Stdout = output
+	cmd.Stderr = stderr
+	if stdout == stderr {
+		cmd.Stderr = output
+	}
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		logger.Debugf("command execution failed: %s", err.Error())
+		return err
+	}
+	trackProcessGroup(cmd.Process.Pid)
+	defer untrackProcessGroup(cmd.Process.Pid)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-timer.C:
+		logger.Debugf("command execution timed out, terminating process group")
+		terminateProcessGroup(cmd.Process.Pid, done)
+		err = fmt.Errorf("command execution timed out after %s", timeout)
+		recordTimeout()
+	}
+
+	if err != nil {
+		logger.Debugf("command execution failed: %s", err.Error())
+	}
+	logger.Debugf("command returned %d bytes of output", output.count)
+
+	return err
+}
+
+// terminateProcessGroup asks the process group to terminate and kills it after the grace period. The given channel
+// receives the result of waiting for the process, which might never happen if a descendant left the process group
+// while keeping the output pipes open.
+func terminateProcessGroup(pgid int, done <-chan error) {
+	_ = signalProcessGroup(pgid, syscall.SIGTERM)
+
+	select {
+	case <-done:
+		return
+	case <-time.After(processGracePeriod):
+	}
+
+	_ = signalProcessGroup(pgid, syscall.SIGKILL)
+
+	select {
+	case <-done:
+	case <-time.After(processGracePeriod):
+	}
+}
+
+func trackProcessGroup(pgid int) {
+	runningProcesses.once.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+		go terminateOnSignal(signals)
+	})
+
+	runningProcesses.Lock()
+	runningProcesses.groups[pgid] = struct{}{}
+	runningProcesses.Unlock()
+}
+
+func untrackProcessGroup(pgid int) {
+	runningProcesses.Lock()
+	delete(runningProcesses.groups, pgid)
+	runningProcesses.Unlock()
+}
+
+// terminateOnSignal terminates all running process groups once nagocheck receives a termination signal, e.g. when
+// being killed by the monitoring system due to a timeout, and exits afterwards using the conventional exit code
+func terminateOnSignal(signals <-chan os.Signal) {
+	receivedSignal := <-signals
+
+	runningProcesses.Lock()
+	for pgid := range runningProcesses.groups {
+		_ = signalProcessGroup(pgid, syscall.SIGTERM)
+	}
+	if len(runningProcesses.groups) > 0 {
+		time.Sleep(processGracePeriod)
+	}
+	for pgid := range runningProcesses.groups {
+		_ = signalProcessGroup(pgid, syscall.SIGKILL)
+	}
+	runningProcesses.Unlock()
+
+	exitCode := 1
+	if signalNumber, ok := receivedSignal.(syscall.Signal); ok {
+		exitCode = 128 + int(signalNumber)
+	}
+	os.Exit(exitCode)
+}
+
+// countingWriter counts the bytes written into the wrapped writer, which is used for logging the output size
+type countingWriter struct {
+	writer io.Writer
+	count  int
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	n, err := w.writer.Write(data)
+	w.count += n
+
+	return n, err
+}
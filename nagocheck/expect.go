@@ -0,0 +1,135 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"strconv"
+	"strings"
+)
+
+// Expectations maps metric names to the values they are expected to have, which turns arbitrary metrics into simple
+// pass/fail assertions, e.g. the amount of CPUs or the running firmware version
+type Expectations map[string][]string
+
+type expectContext struct {
+	nagopher.Context
+
+	problemState nagopher.State
+	expected     []string
+}
+
+type expectationContext struct {
+	nagopher.Context
+
+	expectations Expectations
+}
+
+// NewExpectContext instantiates a context, which returns the given problem state unless the value of a metric equals
+// one of the expected values. Numeric metrics are compared numerically, so that e.g. '4' and '4.0' are equal, while
+// string metrics are compared case-sensitively.
+func NewExpectContext(name string, problemState nagopher.State, expected ...string) nagopher.Context {
+	return &expectContext{
+		Context:      nagopher.NewBaseContext(name, "%<name>s is %<value>s"),
+		problemState: problemState,
+		expected:     expected,
+	}
+}
+
+// ParseExpectation parses an expectation formatted as '<metric>=<value>[,<value>...]', where the metric must have
+// one of the given values
+func ParseExpectation(rawValue string) (string, []string, error) {
+	parts := strings.SplitN(rawValue, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || parts[1] == "" {
+		return "", nil, fmt.Errorf("expectation [%s] must be formatted as <metric>=<value>[,<value>...]", rawValue)
+	}
+
+	return strings.TrimSpace(parts[0]), strings.Split(parts[1], ","), nil
+}
+
+func (c *expectContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	if expectationMatches(metric, c.expected) {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateOk()),
+			nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+		)
+	}
+
+	hint := "expected " + c.expected[0]
+	if len(c.expected) > 1 {
+		hint = "expected one of " + strings.Join(c.expected, ", ")
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(c.problemState),
+		nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+		nagopher.ResultHint(hint),
+	)
+}
+
+func (c *expectContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	if _, ok := metric.(nagopher.NumericMetric); !ok {
+		return nagopher.OptionalPerfData{}, nil
+	}
+
+	perfData, err := nagopher.NewPerfData(metric, nil, nil)
+	if err != nil {
+		return nagopher.OptionalPerfData{}, err
+	}
+
+	return nagopher.NewOptionalPerfData(perfData), nil
+}
+
+// expectationMatches returns true if the value of the given metric equals one of the expected values
+func expectationMatches(metric nagopher.Metric, expected []string) bool {
+	for _, value := range expected {
+		if numericMetric, ok := metric.(nagopher.NumericMetric); ok {
+			if parsedValue, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil &&
+				parsedValue == numericMetric.Value() {
+				return true
+			}
+		} else if value == metric.ValueString() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Apply wraps all contexts of the given check, so that metrics with an expectation are being evaluated against it
+// instead of their regular context, returning CRITICAL on mismatch. Performance data is still emitted by the regular
+// context. Metrics which do not exist are being ignored, as for instance thresholds.
+func (e Expectations) Apply(check nagopher.Check) {
+	if len(e) == 0 {
+		return
+	}
+
+	for _, context := range check.Contexts() {
+		check.AttachContexts(&expectationContext{Context: context, expectations: e})
+	}
+}
+
+func (c *expectationContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	if expected, ok := c.expectations[metric.Name()]; ok {
+		context := &expectContext{Context: c.Context, problemState: nagopher.StateCritical(), expected: expected}
+		return context.Evaluate(metric, resource)
+	}
+
+	return c.Context.Evaluate(metric, resource)
+}
@@ -0,0 +1,433 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// External modules are standalone executables named 'nagocheck-<module>', which are discovered within the external
+// module directories and communicate with nagocheck using a simple subprocess protocol based on JSON:
+//
+// 'nagocheck-<module> describe' prints the module description, containing the plugins and their flags as well as
+// the contexts including default thresholds formatted as Nagios range specifiers:
+//
+//	{"name": "example", "description": "Example", "plugins": [{"name": "queue", "description": "Queue Length",
+//	 "flags": [{"name": "queue", "help": "Name of the queue.", "required": true}],
+//	 "contexts": [{"name": "queue_age", "warning": "300", "critical": "900"}]}]}
+//
+// 'nagocheck-<module> execute <plugin> [--<flag>=<value>...]' probes the plugin and prints the collected metrics and
+// warnings, or an error message which results in an UNKNOWN state:
+//
+//	{"metrics": [{"name": "length", "value": 42, "min": 0}, {"name": "age", "value": 12.5, "unit": "s",
+//	 "context": "queue_age"}], "warnings": ["queue is paused"]}
+//
+// Metrics without context are evaluated using the context named after the plugin, whose thresholds are specified by
+// --warning and --critical. All other thresholds can be overridden using --threshold.
+
+// ExternalModuleDirectoryEnv is the environment variable containing the list of directories, which are searched for
+// external modules. It must be an environment variable, as modules have to be discovered before parsing any flags.
+const ExternalModuleDirectoryEnv = "NAGOCHECK_MODULE_DIR"
+
+// DefaultExternalModuleDirectory is being searched for external modules, unless ExternalModuleDirectoryEnv is set
+const DefaultExternalModuleDirectory = "/usr/lib/nagocheck/modules"
+
+const externalModulePrefix = "nagocheck-"
+const externalDescribeTimeout = 5 * time.Second
+
+type externalModuleDescription struct {
+	Name        string                      `json:"name"`
+	Description string                      `json:"description"`
+	Plugins     []externalPluginDescription `json:"plugins"`
+}
+
+type externalPluginDescription struct {
+	Name        string                       `json:"name"`
+	Description string                       `json:"description"`
+	Flags       []externalFlagDescription    `json:"flags"`
+	Contexts    []externalContextDescription `json:"contexts"`
+}
+
+type externalFlagDescription struct {
+	Name     string `json:"name"`
+	Help     string `json:"help"`
+	Default  string `json:"default"`
+	Required bool   `json:"required"`
+}
+
+type externalContextDescription struct {
+	Name     string `json:"name"`
+	Warning  string `json:"warning"`
+	Critical string `json:"critical"`
+
+	warningThreshold  *nagopher.Bounds
+	criticalThreshold *nagopher.Bounds
+}
+
+type externalProbeResult struct {
+	Metrics  []externalMetric `json:"metrics"`
+	Warnings []string         `json:"warnings"`
+	Error    string           `json:"error"`
+}
+
+type externalMetric struct {
+	Name    string   `json:"name"`
+	Value   float64  `json:"value"`
+	Unit    string   `json:"unit"`
+	Min     *float64 `json:"min"`
+	Max     *float64 `json:"max"`
+	Context string   `json:"context"`
+}
+
+type externalPlugin struct {
+	Plugin
+
+	path        string
+	description externalPluginDescription
+	flagValues  map[string]*string
+	timeout     time.Duration
+}
+
+type externalResource struct {
+	Resource
+}
+
+// ExternalModuleDirectories returns the directories which should be searched for external modules, either taken from
+// ExternalModuleDirectoryEnv as a list separated by the OS-specific path list separator or the default directory
+func ExternalModuleDirectories() []string {
+	value := os.Getenv(ExternalModuleDirectoryEnv)
+	if value == "" {
+		return []string{DefaultExternalModuleDirectory}
+	}
+
+	return filepath.SplitList(value)
+}
+
+// DiscoverExternalModules instantiates a module for every external module executable within the given directories,
+// which are silently ignored if they do not exist. Executables which could not be described are skipped and returned
+// as errors instead, so that a single broken module does not prevent executing any other module.
+func DiscoverExternalModules(directories ...string) ([]Module, []error) {
+	factory, errs := ExternalModuleFactory(directories...)
+	return factory(), errs
+}
+
+// ExternalModuleFactory discovers all external modules like DiscoverExternalModules(), but returns a factory which
+// instantiates fresh copies of these modules without scanning the directories and describing the executables again.
+// This suits tools executing plugins in-process, which require a fresh set of modules for every execution as plugins
+// store their flag values within their own structs.
+func ExternalModuleFactory(directories ...string) (factory func() []Module, errs []error) {
+	var paths []string
+	var descriptions []externalModuleDescription
+	seen := make(map[string]bool)
+
+	for _, directory := range directories {
+		files, err := ioutil.ReadDir(directory)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("could not read external module directory [%s]: %s", directory,
+				err.Error()))
+			continue
+		}
+
+		for _, file := range files {
+			name := externalModuleName(file)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			path := filepath.Join(directory, file.Name())
+			description, err := describeExternalModule(path)
+			if err == nil && description.Name != name {
+				err = fmt.Errorf("module name [%s] does not match executable name", description.Name)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not load external module [%s]: %s", path, err.Error()))
+				continue
+			}
+
+			paths = append(paths, path)
+			descriptions = append(descriptions, description)
+		}
+	}
+
+	factory = func() []Module {
+		modules := make([]Module, 0, len(descriptions))
+		for index, description := range descriptions {
+			modules = append(modules, newExternalModule(paths[index], description))
+		}
+
+		return modules
+	}
+
+	return factory, errs
+}
+
+// externalModuleName returns the module name of the given file or an empty string, if the file is not executable or
+// does not match the naming scheme of external modules
+func externalModuleName(file os.FileInfo) string {
+	name := file.Name()
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, ".exe")
+	} else if file.Mode()&0111 == 0 {
+		return ""
+	}
+
+	if !file.Mode().IsRegular() || !strings.HasPrefix(name, externalModulePrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(name, externalModulePrefix)
+}
+
+func describeExternalModule(path string) (description externalModuleDescription, _ error) {
+	if err := runExternalModule(externalDescribeTimeout, []string{path, "describe"}, &description); err != nil {
+		return description, err
+	}
+
+	return description, description.validate()
+}
+
+// runExternalModule executes the given command and parses its output as JSON into the given target. Output written to
+// stderr is only used for error messages, so that external modules can log freely.
+func runExternalModule(timeout time.Duration, command []string, target interface{}) error {
+	var stdout, stderr bytes.Buffer
+	err := executeCommand(timeout, command, nil, &stdout, &stderr)
+	sanitizedStderr := strings.Replace(strings.TrimSpace(stderr.String()), "\n", " ", -1)
+	if err != nil {
+		return fmt.Errorf("execution failed: %s (%s)", err.Error(), sanitizedStderr)
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), target); err != nil {
+		return fmt.Errorf("could not parse output as JSON: %s", err.Error())
+	}
+
+	return nil
+}
+
+// externalReservedFlags returns the names of all flags defined by nagocheck itself, i.e. the global flags, the default
+// flags of all plugins and the timeout of external plugins, which must not be redefined by external modules
+func externalReservedFlags() []string {
+	app := kingpin.New("", "")
+	options := newGlobalOptions()
+	defineGlobalFlags(app, &options)
+
+	reservedFlags := append([]string{"timeout"}, defaultFlagNames...)
+	for _, flag := range app.Model().Flags {
+		reservedFlags = append(reservedFlags, flag.Name)
+	}
+
+	return reservedFlags
+}
+
+func (d *externalModuleDescription) validate() error {
+	if len(d.Plugins) == 0 {
+		return fmt.Errorf("module does not contain any plugins")
+	}
+
+	reservedFlags := externalReservedFlags()
+	for _, plugin := range d.Plugins {
+		if plugin.Name == "" {
+			return fmt.Errorf("plugin without name")
+		}
+
+		for _, flag := range plugin.Flags {
+			if flag.Name == "" || strings.HasPrefix(flag.Name, "-") {
+				return fmt.Errorf("invalid flag name [%s] of plugin [%s]", flag.Name, plugin.Name)
+			}
+			for _, reservedFlag := range reservedFlags {
+				if flag.Name == reservedFlag {
+					return fmt.Errorf("flag [%s] of plugin [%s] is reserved", flag.Name, plugin.Name)
+				}
+			}
+		}
+
+		for key, context := range plugin.Contexts {
+			if context.Name == "" || context.Name == plugin.Name {
+				return fmt.Errorf("invalid context name [%s] of plugin [%s]", context.Name, plugin.Name)
+			}
+
+			var err error
+			if plugin.Contexts[key].warningThreshold, err = parseOptionalNagiosRange(context.Warning); err != nil {
+				return fmt.Errorf("invalid warning threshold of context [%s]: %s", context.Name, err.Error())
+			}
+			if plugin.Contexts[key].criticalThreshold, err = parseOptionalNagiosRange(context.Critical); err != nil {
+				return fmt.Errorf("invalid critical threshold of context [%s]: %s", context.Name, err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseOptionalNagiosRange(specifier string) (*nagopher.Bounds, error) {
+	if specifier == "" {
+		return nil, nil
+	}
+
+	bounds, err := nagopher.NewBoundsFromNagiosRange(specifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bounds, nil
+}
+
+func newExternalModule(path string, description externalModuleDescription) Module {
+	moduleDescription := description.Description
+	if moduleDescription == "" {
+		moduleDescription = description.Name
+	}
+
+	options := []ModuleOpt{ModuleDescription(moduleDescription)}
+	for _, pluginDescription := range description.Plugins {
+		options = append(options, ModulePlugin(newExternalPlugin(path, pluginDescription)))
+	}
+
+	return NewModule(description.Name, options...)
+}
+
+func newExternalPlugin(path string, description externalPluginDescription) *externalPlugin {
+	pluginDescription := description.Description
+	if pluginDescription == "" {
+		pluginDescription = description.Name
+	}
+
+	return &externalPlugin{
+		Plugin: NewPlugin(description.Name,
+			PluginDescription(pluginDescription),
+			PluginHysteresis(true),
+		),
+
+		path:        path,
+		description: description,
+		flagValues:  make(map[string]*string),
+	}
+}
+
+func (p *externalPlugin) DefineFlags(node KingpinNode) {
+	node.Flag("timeout", "Timeout for executing the external module.").
+		Default("30s").DurationVar(&p.timeout)
+
+	for _, flag := range p.description.Flags {
+		clause := node.Flag(flag.Name, flag.Help)
+		if flag.Default != "" {
+			clause.Default(flag.Default)
+		}
+		if flag.Required {
+			clause.Required()
+		}
+
+		p.flagValues[flag.Name] = clause.String()
+	}
+}
+
+func (p *externalPlugin) DefineCheck() nagopher.Check {
+	check := nagopher.NewCheck(p.Name(), NewSummarizer(p))
+	check.AttachResources(newExternalResource(p))
+	check.AttachContexts(NewHysteresisContext(p, nagopher.NewScalarContext(p.Name(),
+		nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+		nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+	)))
+
+	for _, context := range p.description.Contexts {
+		check.AttachContexts(NewContext(p, nagopher.NewScalarContext(context.Name,
+			context.warningThreshold, context.criticalThreshold)))
+	}
+
+	return check
+}
+
+// command returns the command line for probing the plugin, passing all flags which have a value in a stable order
+func (p *externalPlugin) command() []string {
+	command := []string{p.path, "execute", p.Name()}
+
+	names := make([]string, 0, len(p.flagValues))
+	for name, value := range p.flagValues {
+		if *value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		command = append(command, fmt.Sprintf("--%s=%s", name, *p.flagValues[name]))
+	}
+
+	return command
+}
+
+func newExternalResource(plugin *externalPlugin) *externalResource {
+	return &externalResource{
+		Resource: NewResource(plugin),
+	}
+}
+
+func (r *externalResource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	plugin := r.Plugin().(*externalPlugin)
+
+	var result externalProbeResult
+	if err := runExternalModule(plugin.timeout, plugin.command(), &result); err != nil {
+		return metrics, err
+	}
+	if result.Error != "" {
+		return metrics, fmt.Errorf("%s", result.Error)
+	}
+
+	for _, warning := range result.Warnings {
+		warnings.Add(nagopher.NewWarning("%s", warning))
+	}
+
+	for _, externalMetric := range result.Metrics {
+		contextName := externalMetric.Context
+		if contextName == "" {
+			contextName = plugin.Name()
+		}
+
+		var boundsOptions []nagopher.BoundsOpt
+		if externalMetric.Min != nil {
+			boundsOptions = append(boundsOptions, nagopher.LowerBound(*externalMetric.Min))
+		}
+		if externalMetric.Max != nil {
+			boundsOptions = append(boundsOptions, nagopher.UpperBound(*externalMetric.Max))
+		}
+		valueRange := nagopher.NewBounds(boundsOptions...)
+
+		metric, err := nagopher.NewNumericMetric(externalMetric.Name, externalMetric.Value, externalMetric.Unit,
+			&valueRange, contextName)
+		if err != nil {
+			return metrics, fmt.Errorf("invalid metric [%s]: %s", externalMetric.Name, err.Error())
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
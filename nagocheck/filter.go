@@ -0,0 +1,88 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"github.com/snapserv/nagopher"
+	"regexp"
+)
+
+// MetricFilter restricts the evaluation and performance data of a check to metrics with matching names. All metrics
+// are being included if no include patterns were given, while exclude patterns always take precedence.
+type MetricFilter struct {
+	Include []*regexp.Regexp
+	Exclude []*regexp.Regexp
+}
+
+type metricFilterContext struct {
+	nagopher.Context
+	filter MetricFilter
+}
+
+// Match returns true if the metric with the given name should be evaluated
+func (f MetricFilter) Match(metricName string) bool {
+	for _, pattern := range f.Exclude {
+		if pattern.MatchString(metricName) {
+			return false
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return true
+	}
+
+	for _, pattern := range f.Include {
+		if pattern.MatchString(metricName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Apply wraps all contexts of the given check, so that filtered metrics are neither evaluated nor emitted as
+// performance data. As nagopher does not allow dropping metrics, they are being reported with an OK state instead.
+func (f MetricFilter) Apply(check nagopher.Check) {
+	if len(f.Include) == 0 && len(f.Exclude) == 0 {
+		return
+	}
+
+	for _, context := range check.Contexts() {
+		check.AttachContexts(&metricFilterContext{Context: context, filter: f})
+	}
+}
+
+func (c *metricFilterContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	if c.filter.Match(metric.Name()) {
+		return c.Context.Evaluate(metric, resource)
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(nagopher.StateOk()),
+		nagopher.ResultMetric(metric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+	)
+}
+
+func (c *metricFilterContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	if c.filter.Match(metric.Name()) {
+		return c.Context.Performance(metric, resource)
+	}
+
+	return nagopher.OptionalPerfData{}, nil
+}
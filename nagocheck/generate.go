@@ -0,0 +1,134 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"sort"
+	"strings"
+)
+
+type generateTool struct {
+	sudoersCommand *kingpin.CmdClause
+	sudoersUser    string
+	selected       string
+}
+
+// NewGenerateTool instantiates a Tool, which generates configuration snippets required for running nagocheck, e.g.
+// the sudoers entries for all plugins executing external commands with elevated privileges.
+func NewGenerateTool() Tool {
+	return &generateTool{}
+}
+
+func (t *generateTool) Name() string {
+	return "generate"
+}
+
+func (t *generateTool) DefineCommand(app *kingpin.Application) {
+	node := app.Command(t.Name(), "Generate configuration snippets for running nagocheck.")
+
+	t.sudoersCommand = node.Command("sudoers", "Generate sudoers entries for all external commands, which are "+
+		"executed by plugins when using --sudo. Entries use the default command paths of all modules and plugins.")
+	t.sudoersCommand.Flag("user", "Specifies the user name which executes nagocheck.").
+		Short('u').Default("nagios").StringVar(&t.sudoersUser)
+	t.sudoersCommand.Action(func(*kingpin.ParseContext) error {
+		t.selected = "sudoers"
+		return nil
+	})
+}
+
+func (t *generateTool) Execute(modules map[string]Module) error {
+	switch t.selected {
+	case "sudoers":
+		fmt.Print(t.generateSudoers(modules))
+	default:
+		return fmt.Errorf("unknown generator: %s", t.selected)
+	}
+
+	return nil
+}
+
+func (t *generateTool) generateSudoers(modules map[string]Module) string {
+	var lines []string
+	seen := make(map[string]bool)
+
+	for _, module := range sortedModules(modules) {
+		providers := []interface{}{module}
+		for _, plugin := range sortedPlugins(module) {
+			providers = append(providers, plugin)
+		}
+
+		for _, provider := range providers {
+			sudoProvider, ok := provider.(SudoProvider)
+			if !ok {
+				continue
+			}
+
+			for _, template := range sudoProvider.SudoTemplates() {
+				entries := strings.Join(template.SudoersEntries(t.sudoersUser), "\n")
+				if seen[entries] {
+					continue
+				}
+
+				seen[entries] = true
+				lines = append(lines, fmt.Sprintf("# %s: %s", module.Name(), template.Name), entries)
+			}
+		}
+	}
+
+	header := "# sudoers entries for nagocheck --sudo, install as /etc/sudoers.d/nagocheck and verify with visudo -c\n"
+	if len(lines) == 0 {
+		return header
+	}
+
+	return header + strings.Join(lines, "\n") + "\n"
+}
+
+func sortedModules(modules map[string]Module) []Module {
+	var names []string
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]Module, len(names))
+	for key, name := range names {
+		result[key] = modules[name]
+	}
+
+	return result
+}
+
+func sortedPlugins(module Module) []Plugin {
+	plugins := module.Plugins()
+
+	var names []string
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]Plugin, len(names))
+	for key, name := range names {
+		result[key] = plugins[name]
+	}
+
+	return result
+}
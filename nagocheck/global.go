@@ -0,0 +1,321 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import "time"
+
+type globalOptions struct {
+	debug          bool
+	configFile     string
+	rebootBlackout bool
+	maxDataAge     time.Duration
+	staleData      string
+	warningAs      string
+	criticalAs     string
+	unknownAs      string
+	partialOk      bool
+	partialUnknown bool
+	downtimeFile   string
+	downtimeState  string
+
+	perfDataLabelLength int
+	probeWorkers        int
+	probeTimeout        time.Duration
+	sampleInterval      time.Duration
+	selfMetrics         bool
+
+	stateDirectory       string
+	persistenceBackend   string
+	persistenceDirectory string
+	redisAddress         string
+	redisPassword        string
+	redisDatabase        int
+
+	sinks           []string
+	spoolDirectory  string
+	submitTimeout   time.Duration
+	submitHost      string
+	submitService   string
+	icinga2URL      string
+	icinga2Token    string
+	icinga2Insecure bool
+	nscaAddress     string
+	nscaIdentity    string
+	nscaPassword    string
+	pushgatewayURL  string
+	pushgatewayJob  string
+	otlpEndpoint    string
+	otlpHeaders     map[string]string
+
+	sshHost    string
+	sshUser    string
+	sshPort    uint16
+	sshKey     string
+	sshOptions []string
+	sshCommand string
+
+	sudo        bool
+	sudoCommand string
+
+	workingDirectory string
+	umask            string
+	noNewPrivs       bool
+	seccomp          bool
+
+	breakerThreshold int
+	breakerWindow    time.Duration
+
+	cacheTTL    time.Duration
+	listMetrics bool
+}
+
+var globals = newGlobalOptions()
+
+// globalNode is the kingpin node containing the global flags, which allows deriving e.g. cache keys from their values
+var globalNode KingpinNode
+
+// DefineGlobalFlags defines all flags which are shared by all modules and plugins at the given kingpin node, which
+// should usually be the kingpin application itself.
+func DefineGlobalFlags(node KingpinNode) {
+	globalNode = node
+	defineGlobalFlags(node, &globals)
+}
+
+// newGlobalOptions returns the global options before parsing any flags, which also allows parsing flags into
+// separate options without affecting the global ones, e.g. when validating invocations
+func newGlobalOptions() globalOptions {
+	return globalOptions{
+		persistenceBackend: defaultPersistenceBackend,
+		rebootBlackout:     true,
+		staleData:          "skip",
+		downtimeState:      "ok",
+		otlpHeaders:        make(map[string]string),
+	}
+}
+
+func defineGlobalFlags(node KingpinNode, options *globalOptions) {
+	node.Flag("debug", "Enable debug logging to stderr, e.g. command invocations, file reads and timings.").
+		BoolVar(&options.debug)
+
+	node.Flag("config", "Path to the config file declaring threshold profiles for --threshold-profile, one per line "+
+		"formatted as 'profile <name> <context>=warn:<range>:crit:<range>...'.").
+		Envar("NAGOCHECK_CONFIG").StringVar(&options.configFile)
+
+	node.Flag("reboot-blackout", "Suppress alerts of delta contexts during the first execution after a system "+
+		"reboot, as counters are being reset when booting.").
+		Default("true").BoolVar(&options.rebootBlackout)
+
+	DurationVar(node.Flag("max-data-age", "Discard persistent data (e.g. previous counter values) older than the "+
+		"given duration like 1h or 7d, as deltas and rates against ancient values are meaningless. Disabled when set "+
+		"to zero.").
+		Default("0s"), &options.maxDataAge)
+
+	node.Flag("stale-data", "Either skip evaluating delta and rate contexts or return UNKNOWN if persistent data has "+
+		"been discarded due to --max-data-age.").
+		Default("skip").EnumVar(&options.staleData, "skip", "unknown")
+
+	node.Flag("warning-as", "Remap a final WARNING state to the given state.").
+		EnumVar(&options.warningAs, StateNames...)
+
+	node.Flag("critical-as", "Remap a final CRITICAL state to the given state.").
+		EnumVar(&options.criticalAs, StateNames...)
+
+	node.Flag("unknown-as", "Remap a final UNKNOWN state to the given state, e.g. for treating flaky collectors "+
+		"as non-urgent.").
+		EnumVar(&options.unknownAs, StateNames...)
+
+	node.Flag("partial-ok", "Evaluate the remaining metrics of a resource if some of them could not be collected, "+
+		"e.g. the link speed of an interface, and only report the failure as a warning. This is the default.").
+		BoolVar(&options.partialOk)
+
+	node.Flag("partial-unknown", "Return UNKNOWN if some metrics of a resource could not be collected instead of "+
+		"evaluating the remaining ones.").
+		BoolVar(&options.partialUnknown)
+
+	node.Flag("downtime-file", "Specifies a file declaring maintenance windows, one per line formatted as '<host> "+
+		"<service> <window> [comment]' with glob patterns for host and service. Windows are either fixed like "+
+		"2019-06-01T22:00/2019-06-02T02:00 or recurring like 01:00-03:30 and sat,sun@22:00-06:00.").
+		Envar("NAGOCHECK_DOWNTIME_FILE").StringVar(&options.downtimeFile)
+
+	node.Flag("downtime-state", "Final state being reported while a maintenance window of --downtime-file is "+
+		"active. Performance data is still being emitted.").
+		Default("ok").EnumVar(&options.downtimeState, StateNames...)
+
+	node.Flag("perfdata-label-length", "Truncate labels of performance data exceeding the given length, appending a "+
+		"short hash of the original label to keep them unique. Unlimited when set to zero.").
+		Default("0").IntVar(&options.perfDataLabelLength)
+
+	node.Flag("probe-workers", "Maximum amount of resources being probed concurrently by plugins evaluating multiple "+
+		"resources within a single check, e.g. all interfaces or disks.").
+		Default("4").IntVar(&options.probeWorkers)
+
+	DurationVar(node.Flag("probe-timeout", "Abandon probing a single resource or object of plugins evaluating "+
+		"multiple ones concurrently after the given duration like 5s, reporting it as failed while still evaluating "+
+		"all others. Disabled when set to zero.").
+		Default("0s"), &options.probeTimeout)
+
+	DurationVar(node.Flag("sample-interval", "Probe all resources twice with the given interval like 2s and "+
+		"compute deltas and rates from both samples within a single execution instead of using persistent data "+
+		"of previous executions. Resources with sampled deltas or rates neither load nor store non-durable "+
+		"persistent data then. Disabled when set to zero.").
+		Default("0s"), &options.sampleInterval)
+
+	node.Flag("self-metrics", "Append performance data about the execution itself, i.e. probe duration, amount "+
+		"of warnings, time spent loading and storing persistent data and whether a timeout was hit.").
+		BoolVar(&options.selfMetrics)
+
+	node.Flag("state-dir", "Specifies the directory in which lock files and persistent data are being stored, which "+
+		"also namespaces shared memory objects. Defaults to the temporary directory of the operating system for root "+
+		"and a private directory per user otherwise.").
+		Envar("NAGOCHECK_STATE_DIR").StringVar(&options.stateDirectory)
+
+	node.Flag("persistence", "Specifies the backend used for storing persistent data between plugin executions.").
+		Default(defaultPersistenceBackend).EnumVar(&options.persistenceBackend, PersistenceBackendNames...)
+
+	node.Flag("persistence-dir", "[file] Specifies the directory in which persistent data should be stored. "+
+		"Defaults to the directory given by --state-dir.").
+		StringVar(&options.persistenceDirectory)
+
+	node.Flag("redis-address", "[redis] Specifies the address of the redis server as host:port.").
+		Default("127.0.0.1:6379").StringVar(&options.redisAddress)
+
+	node.Flag("redis-password", "[redis] Specifies the password used for authenticating against the redis server.").
+		Envar("NAGOCHECK_REDIS_PASSWORD").StringVar(&options.redisPassword)
+
+	node.Flag("redis-db", "[redis] Specifies the redis database number.").
+		Default("0").IntVar(&options.redisDatabase)
+
+	node.Flag("sink", "Emit the check result using the given sink, can be specified multiple times. Defaults to "+
+		"'nagios', which prints the result according to the Nagios plugin specs.").
+		EnumsVar(&options.sinks, SinkNames...)
+
+	node.Flag("output", "Alias of --sink, e.g. --output=influx for writing InfluxDB line protocol.").
+		EnumsVar(&options.sinks, SinkNames...)
+
+	node.Flag("spool-dir", "[spool] Directory in which check result files for Nagios are being written.").
+		Default("/var/spool/nagios/checkresults").StringVar(&options.spoolDirectory)
+
+	node.Flag("submit-timeout", "Timeout for submitting passive check results.").
+		Default("10s").DurationVar(&options.submitTimeout)
+
+	node.Flag("submit-host", "Host name used for passive check result submission. Defaults to the local hostname.").
+		StringVar(&options.submitHost)
+
+	node.Flag("submit-service", "Service name used for passive check result submission. Defaults to "+
+		"'<module>-<plugin>', e.g. 'system-load'.").
+		StringVar(&options.submitService)
+
+	node.Flag("icinga2-url", "[icinga2] Submit check results to the Icinga 2 REST API at the given URL, "+
+		"e.g. https://icinga.example.com:5665.").
+		StringVar(&options.icinga2URL)
+
+	node.Flag("icinga2-token", "[icinga2] Credentials of the Icinga 2 API user as username:password.").
+		Envar("NAGOCHECK_ICINGA2_TOKEN").StringVar(&options.icinga2Token)
+
+	node.Flag("icinga2-insecure", "[icinga2] Skip verification of the Icinga 2 API certificate.").
+		BoolVar(&options.icinga2Insecure)
+
+	node.Flag("submit-nsca", "[nsca] Submit check results as passive checks to the NSCA-ng daemon at the given "+
+		"host[:port] instead of printing them, unless --sink has been given explicitly. Defaults to port 5668. The "+
+		"daemon must allow the PSK-AES128-GCM-SHA256 cipher suite (tls_ciphers within nsca-ng.cfg).").
+		StringVar(&options.nscaAddress)
+
+	node.Flag("nsca-identity", "[nsca] Identity used for authenticating against the NSCA-ng daemon. Defaults to the "+
+		"hostname of the local system.").
+		StringVar(&options.nscaIdentity)
+
+	node.Flag("nsca-password", "[nsca] Password (pre-shared key) of the identity used for authenticating against the "+
+		"NSCA-ng daemon.").
+		Envar("NAGOCHECK_NSCA_PASSWORD").StringVar(&options.nscaPassword)
+
+	node.Flag("pushgateway-url", "[pushgateway] Push numeric metrics to the Prometheus Pushgateway at the given URL.").
+		StringVar(&options.pushgatewayURL)
+
+	node.Flag("pushgateway-job", "[pushgateway] Job label used for pushing metrics.").
+		Default("nagocheck").StringVar(&options.pushgatewayJob)
+
+	node.Flag("otlp-endpoint", "[otlp] Export numeric metrics to the OpenTelemetry collector at the given base URL "+
+		"using OTLP/HTTP, e.g. http://localhost:4318.").
+		StringVar(&options.otlpEndpoint)
+
+	node.Flag("otlp-header", "[otlp] Additional HTTP header sent to the collector as key=value, can be specified "+
+		"multiple times.").
+		StringMapVar(&options.otlpHeaders)
+
+	node.Flag("ssh-host", "Execute external commands of plugins (e.g. vtysh) on the given remote host via SSH "+
+		"instead of locally.").
+		StringVar(&options.sshHost)
+
+	node.Flag("ssh-user", "[ssh] Specifies the remote user name. Defaults to the SSH client configuration.").
+		StringVar(&options.sshUser)
+
+	node.Flag("ssh-port", "[ssh] Specifies the remote port. Defaults to the SSH client configuration.").
+		Uint16Var(&options.sshPort)
+
+	node.Flag("ssh-key", "[ssh] Specifies the private key file used for authentication.").
+		StringVar(&options.sshKey)
+
+	node.Flag("ssh-option", "[ssh] Additional option passed to the SSH client as key=value, can be specified "+
+		"multiple times, e.g. StrictHostKeyChecking=yes.").
+		StringsVar(&options.sshOptions)
+
+	node.Flag("ssh-cmd", "[ssh] Specifies the command with optional arguments to be used for executing the SSH "+
+		"client. Use comma to separate command and arguments.").
+		Default("/usr/bin/ssh").StringVar(&options.sshCommand)
+
+	node.Flag("sudo", "Execute external commands of plugins (e.g. vtysh, ethtool) non-interactively via sudo. Use "+
+		"'generate sudoers' for listing the required sudoers entries.").
+		BoolVar(&options.sudo)
+
+	node.Flag("sudo-cmd", "[sudo] Specifies the command with optional arguments to be used for executing sudo. Use "+
+		"comma to separate command and arguments.").
+		Default("/usr/bin/sudo").StringVar(&options.sudoCommand)
+
+	node.Flag("chdir", "Change the working directory before probing, e.g. to '/' for not keeping any directory busy. "+
+		"Relative paths given for other options are resolved against the new directory.").
+		StringVar(&options.workingDirectory)
+
+	node.Flag("umask", "Set the given octal umask before probing, e.g. 0077 for keeping all created files private.").
+		StringVar(&options.umask)
+
+	node.Flag("no-new-privs", "Prevent nagocheck and all external commands from gaining privileges, e.g. using "+
+		"setuid binaries. Only supported on Linux and can not be combined with --sudo.").
+		BoolVar(&options.noNewPrivs)
+
+	node.Flag("seccomp", "Install a seccomp filter before probing, which denies syscalls that are never required "+
+		"by any plugin, e.g. mount, reboot, ptrace or loading kernel modules. Only supported on Linux and requires "+
+		"either running as root or --no-new-privs.").
+		BoolVar(&options.seccomp)
+
+	node.Flag("breaker-threshold", "Stop executing external commands of a backend (e.g. vtysh) after the given "+
+		"amount of consecutive failures and return UNKNOWN immediately, 0 disables the circuit breaker.").
+		Default("0").IntVar(&options.breakerThreshold)
+
+	node.Flag("breaker-window", "[breaker] Window in which failures are considered consecutive, which is also the "+
+		"time after which a single retry is attempted while the circuit breaker is open.").
+		Default("5m").DurationVar(&options.breakerWindow)
+
+	node.Flag("cache-ttl", "Serve the last result of an identical invocation from the persistence backend without "+
+		"probing again, as long as it is younger than the given TTL. Results with UNKNOWN state are never cached.").
+		Default("0s").DurationVar(&options.cacheTTL)
+
+	node.Flag("list-metrics", "Probe the plugin without evaluating any thresholds and list all collected metrics "+
+		"with their current value, unit and context, which can be used for --threshold.").
+		BoolVar(&options.listMetrics)
+}
@@ -0,0 +1,83 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+var hardening struct {
+	once sync.Once
+	err  error
+}
+
+// applyHardening restricts the process according to the hardening options before the first plugin gets probed, as
+// nagocheck often runs as root. The restrictions are applied once per process and are inherited by all external
+// commands, so that repeated executions within batch or serve mode do not stack them.
+func applyHardening() error {
+	hardening.once.Do(func() {
+		hardening.err = hardenProcess()
+	})
+
+	return hardening.err
+}
+
+func hardenProcess() error {
+	logger := NewLogger("hardening")
+
+	if globals.noNewPrivs && globals.sudo {
+		return fmt.Errorf("--no-new-privs can not be combined with --sudo, as sudo requires gaining privileges")
+	}
+
+	if globals.workingDirectory != "" {
+		if err := os.Chdir(globals.workingDirectory); err != nil {
+			return fmt.Errorf("could not change working directory: %s", err.Error())
+		}
+		logger.Debugf("changed working directory to %s", globals.workingDirectory)
+	}
+
+	if globals.umask != "" {
+		umask, err := strconv.ParseUint(globals.umask, 8, 32)
+		if err != nil || umask > 0777 {
+			return fmt.Errorf("could not parse umask [%s] as octal file mode", globals.umask)
+		}
+		if err := setUmask(int(umask)); err != nil {
+			return fmt.Errorf("could not set umask: %s", err.Error())
+		}
+		logger.Debugf("set umask to %04o", umask)
+	}
+
+	if globals.noNewPrivs {
+		if err := setNoNewPrivs(); err != nil {
+			return fmt.Errorf("could not set no-new-privs: %s", err.Error())
+		}
+		logger.Debugf("disabled gaining new privileges")
+	}
+
+	if globals.seccomp {
+		if err := installSeccompFilter(); err != nil {
+			return fmt.Errorf("could not install seccomp filter: %s", err.Error())
+		}
+		logger.Debugf("installed seccomp filter")
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetNoNewPrivs = 38
+
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+	seccompRetAllow        = 0x7fff0000
+	seccompRetErrno        = 0x00050000
+
+	bpfLoadAbsolute = 0x00 | 0x00 | 0x20
+	bpfJumpEqual    = 0x05 | 0x10 | 0x00
+	bpfJumpSet      = 0x05 | 0x40 | 0x00
+	bpfReturn       = 0x06 | 0x00
+
+	seccompDataNr   = 0
+	seccompDataArch = 4
+
+	x32SyscallBit = 0x40000000
+)
+
+// seccompArch contains the audit architecture and the number of the seccomp syscall, which is missing within the
+// syscall package for most architectures
+type seccompArch struct {
+	auditArch uint32
+	syscallNr uintptr
+}
+
+var seccompArchs = map[string]seccompArch{
+	"386":   {auditArch: 0x40000003, syscallNr: 354},
+	"amd64": {auditArch: 0xc000003e, syscallNr: 317},
+	"arm":   {auditArch: 0x40000028, syscallNr: 383},
+	"arm64": {auditArch: 0xc00000b7, syscallNr: 277},
+}
+
+// seccompDeniedSyscalls contains all syscalls which are never required by nagocheck or the external commands being
+// executed by plugins, but would allow taking over or disrupting the host
+var seccompDeniedSyscalls = []uintptr{
+	syscall.SYS_ACCT,
+	syscall.SYS_CHROOT,
+	syscall.SYS_DELETE_MODULE,
+	syscall.SYS_INIT_MODULE,
+	syscall.SYS_KEXEC_LOAD,
+	syscall.SYS_MOUNT,
+	syscall.SYS_PIVOT_ROOT,
+	syscall.SYS_PTRACE,
+	syscall.SYS_REBOOT,
+	syscall.SYS_SETTIMEOFDAY,
+	syscall.SYS_SWAPOFF,
+	syscall.SYS_SWAPON,
+	syscall.SYS_UMOUNT2,
+}
+
+func setUmask(umask int) error {
+	syscall.Umask(umask)
+	return nil
+}
+
+func setNoNewPrivs() error {
+	_, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0)
+	if errno == 0 {
+		return nil
+	} else if errno != syscall.ENOTSUP {
+		return errno
+	}
+
+	// Binaries linked against cgo can not use AllThreadsSyscall, so the flag is set for the current thread only and
+	// propagated to all other threads by installing a permissive seccomp filter with thread synchronization.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return errno
+	}
+
+	return loadSeccompFilter([]syscall.SockFilter{bpfStatement(bpfReturn, seccompRetAllow)})
+}
+
+// installSeccompFilter denies all syscalls within seccompDeniedSyscalls with EPERM for all threads and children.
+// Syscalls of foreign architectures and x32 syscalls are denied entirely, as they would bypass the filter.
+func installSeccompFilter() error {
+	arch, ok := seccompArchs[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("unsupported architecture: %s", runtime.GOARCH)
+	}
+
+	filter := []syscall.SockFilter{
+		bpfStatement(bpfLoadAbsolute, seccompDataArch),
+		bpfJump(bpfJumpEqual, arch.auditArch, 1, 0),
+		bpfStatement(bpfReturn, seccompRetErrno|uint32(syscall.EPERM)),
+		bpfStatement(bpfLoadAbsolute, seccompDataNr),
+	}
+	if runtime.GOARCH == "amd64" {
+		filter = append(filter, bpfJump(bpfJumpSet, x32SyscallBit, uint8(len(seccompDeniedSyscalls)+1), 0))
+	}
+	for key, syscallNr := range seccompDeniedSyscalls {
+		filter = append(filter, bpfJump(bpfJumpEqual, uint32(syscallNr), uint8(len(seccompDeniedSyscalls)-key), 0))
+	}
+	filter = append(filter,
+		bpfStatement(bpfReturn, seccompRetAllow),
+		bpfStatement(bpfReturn, seccompRetErrno|uint32(syscall.EPERM)),
+	)
+
+	err := loadSeccompFilter(filter)
+	if err == syscall.EACCES {
+		return fmt.Errorf("%s (requires --no-new-privs or CAP_SYS_ADMIN)", err.Error())
+	}
+
+	return err
+}
+
+func loadSeccompFilter(filter []syscall.SockFilter) error {
+	arch, ok := seccompArchs[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("unsupported architecture: %s", runtime.GOARCH)
+	}
+
+	program := syscall.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+
+	result, _, errno := syscall.Syscall(arch.syscallNr, seccompSetModeFilter, seccompFilterFlagTsync,
+		uintptr(unsafe.Pointer(&program)))
+	if errno != 0 {
+		return errno
+	} else if result != 0 {
+		return fmt.Errorf("thread %d could not be synchronized", result)
+	}
+
+	return nil
+}
+
+func bpfStatement(code uint16, k uint32) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, K: k}
+}
+
+func bpfJump(code uint16, k uint32, jumpTrue uint8, jumpFalse uint8) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, Jt: jumpTrue, Jf: jumpFalse, K: k}
+}
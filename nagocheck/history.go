@@ -0,0 +1,371 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// History is a small embedded time-series store, which keeps the samples of all metrics recorded by a single check
+// within an append-only file. Older samples are downsampled into coarser averages during compaction, so that the file
+// stays small while still covering months, e.g. for predicting trends. Plugins opt in using PluginHistory().
+type History struct {
+	key     string
+	backend *filePersistenceBackend
+	logger  Logger
+
+	mutex    sync.Mutex
+	loaded   bool
+	series   map[string][]HistorySample
+	recorded map[string]float64
+}
+
+// HistorySample contains a single value of a metric along with the time it has been recorded at
+type HistorySample struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// historyTier specifies the resolution of samples up to the given age, where a resolution of zero keeps all samples
+type historyTier struct {
+	age        time.Duration
+	resolution time.Duration
+}
+
+// historyTiers contains the downsampling tiers ordered by age. Samples older than the last tier are being discarded.
+var historyTiers = []historyTier{
+	{age: 2 * 24 * time.Hour, resolution: 0},
+	{age: 14 * 24 * time.Hour, resolution: time.Hour},
+	{age: 180 * 24 * time.Hour, resolution: 6 * time.Hour},
+}
+
+// historyCompactInterval is the minimum interval between two compactions of the same history
+const historyCompactInterval = time.Hour
+
+// historyHeader is the first line of every history file, followed by the UNIX timestamp of the last compaction
+const historyHeader = "# nagocheck history v1 compacted="
+
+// PluginHistory is a functional option for NewPlugin(), which stores the samples of all capacity metrics and averaged
+// contexts within a History instead of separate single-sample persistent data
+func PluginHistory(enabled bool) PluginOpt {
+	return func(p *basePlugin) {
+		p.historyEnabled = enabled
+	}
+}
+
+func newHistory(plugin Plugin) *History {
+	return &History{
+		key:      pluginPersistenceKey("history", plugin, ""),
+		backend:  &filePersistenceBackend{directory: StateDirectory()},
+		logger:   plugin.Logger(),
+		recorded: make(map[string]float64),
+	}
+}
+
+// Series returns all previously stored samples of the given metric ordered by time, excluding samples recorded during
+// the current execution
+func (h *History) Series(name string) []HistorySample {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.loaded {
+		h.loaded = true
+		err := h.backend.withLock(h.key, false, func() (err error) {
+			h.series, _, err = h.read()
+			return err
+		})
+		if err != nil {
+			h.logger.Debugf("could not load history: %s", err.Error())
+		}
+	}
+
+	return h.series[name]
+}
+
+// Record remembers the current value of the given metric, which gets appended to the history by Flush(). Only the
+// first value recorded per metric and execution is kept, so that e.g. averaged values never replace the raw value.
+func (h *History) Record(name string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.recorded[name]; !ok {
+		h.recorded[name] = value
+	}
+}
+
+// Flush appends all recorded values to the history file, compacting it beforehand once per compaction interval
+func (h *History) Flush() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.recorded) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	err := h.backend.withLock(h.key, true, func() error {
+		series, compacted, err := h.read()
+		if err != nil {
+			return err
+		}
+
+		if now.Sub(compacted) >= historyCompactInterval {
+			for name, value := range h.recorded {
+				series[name] = append(series[name], HistorySample{Timestamp: now, Value: value})
+			}
+			return h.rewrite(compactHistory(series, now), now)
+		}
+
+		return h.append(h.recorded, now)
+	})
+	if err != nil {
+		return err
+	}
+
+	h.recorded = make(map[string]float64)
+	return nil
+}
+
+// importSamples adds the given samples to the stored series, which allows migrating data persisted by previous versions
+func (h *History) importSamples(name string, samples []HistorySample) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	err := h.backend.withLock(h.key, true, func() error {
+		series, _, err := h.read()
+		if err != nil {
+			return err
+		}
+
+		series[name] = append(series[name], samples...)
+		sort.SliceStable(series[name], func(i, j int) bool {
+			return series[name][i].Timestamp.Before(series[name][j].Timestamp)
+		})
+		h.series = series
+
+		return h.rewrite(series, time.Time{})
+	})
+	if err != nil {
+		h.logger.Debugf("could not import samples into history: %s", err.Error())
+	}
+}
+
+// read parses the history file, returning all series and the time of the last compaction. Malformed lines, e.g. of a
+// partially written sample after a crash, are being skipped.
+func (h *History) read() (map[string][]HistorySample, time.Time, error) {
+	series := make(map[string][]HistorySample)
+
+	file, err := os.Open(h.backend.path(h.key))
+	if os.IsNotExist(err) {
+		return series, time.Time{}, nil
+	} else if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	var compacted time.Time
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, historyHeader) {
+			if seconds, err := strconv.ParseInt(strings.TrimPrefix(line, historyHeader), 10, 64); err == nil {
+				compacted = time.Unix(seconds, 0)
+			}
+			continue
+		}
+
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		seconds, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			continue
+		}
+
+		series[parts[2]] = append(series[parts[2]], HistorySample{Timestamp: time.Unix(seconds, 0), Value: value})
+	}
+
+	return series, compacted, scanner.Err()
+}
+
+// append adds the given values to the end of the history file, creating it including its header if necessary
+func (h *History) append(values map[string]float64, now time.Time) (rerr error) {
+	file, err := os.OpenFile(h.backend.path(h.key), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	writer := bufio.NewWriter(file)
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		writeHistoryHeader(writer, now)
+	}
+	for _, name := range sortedHistoryNames(values) {
+		writeHistorySample(writer, name, HistorySample{Timestamp: now, Value: values[name]})
+	}
+
+	return writer.Flush()
+}
+
+// rewrite atomically replaces the history file with the given series, storing the given time as last compaction
+func (h *History) rewrite(series map[string][]HistorySample, compacted time.Time) error {
+	var builder strings.Builder
+	writer := bufio.NewWriter(&builder)
+	writeHistoryHeader(writer, compacted)
+
+	names := make([]string, 0, len(series))
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, sample := range series[name] {
+			writeHistorySample(writer, name, sample)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(h.backend.path(h.key)+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, builder.String()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(h.backend.path(h.key)+".tmp", h.backend.path(h.key))
+}
+
+// compactHistory downsamples all series according to the history tiers, averaging both timestamps and values of all
+// samples falling into the same interval of a tier, and discards samples older than the last tier
+func compactHistory(series map[string][]HistorySample, now time.Time) map[string][]HistorySample {
+	compacted := make(map[string][]HistorySample, len(series))
+	for name, samples := range series {
+		var result []HistorySample
+		var bucket []HistorySample
+		bucketKey := int64(-1)
+
+		flushBucket := func() {
+			if len(bucket) == 0 {
+				return
+			}
+
+			var timestamps, values float64
+			for _, sample := range bucket {
+				timestamps += float64(sample.Timestamp.Unix())
+				values += sample.Value
+			}
+			count := float64(len(bucket))
+			result = append(result, HistorySample{
+				Timestamp: time.Unix(int64(math.Round(timestamps/count)), 0),
+				Value:     values / count,
+			})
+			bucket = nil
+		}
+
+		for _, sample := range samples {
+			tier, ok := historyTierOf(now.Sub(sample.Timestamp))
+			if !ok {
+				continue
+			}
+			if tier.resolution == 0 {
+				flushBucket()
+				result = append(result, sample)
+				continue
+			}
+
+			key := sample.Timestamp.Unix() / int64(tier.resolution.Seconds())
+			if key != bucketKey {
+				flushBucket()
+				bucketKey = key
+			}
+			bucket = append(bucket, sample)
+		}
+		flushBucket()
+
+		if len(result) > 0 {
+			compacted[name] = result
+		}
+	}
+
+	return compacted
+}
+
+// historyTierOf returns the tier responsible for samples of the given age, returning false if it should be discarded
+func historyTierOf(age time.Duration) (historyTier, bool) {
+	for _, tier := range historyTiers {
+		if age <= tier.age {
+			return tier, true
+		}
+	}
+
+	return historyTier{}, false
+}
+
+func writeHistoryHeader(writer *bufio.Writer, compacted time.Time) {
+	timestamp := int64(0)
+	if !compacted.IsZero() {
+		timestamp = compacted.Unix()
+	}
+
+	_, _ = writer.WriteString(historyHeader + strconv.FormatInt(timestamp, 10) + "\n")
+}
+
+func writeHistorySample(writer *bufio.Writer, name string, sample HistorySample) {
+	name = strings.NewReplacer("\n", " ", "\t", " ").Replace(name)
+	_, _ = writer.WriteString(strconv.FormatInt(sample.Timestamp.Unix(), 10) + "\t" +
+		strconv.FormatFloat(sample.Value, 'g', -1, 64) + "\t" + name + "\n")
+}
+
+func sortedHistoryNames(values map[string]float64) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,45 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ProcPath returns the given path below the proc filesystem, which can be relocated using the HOST_PROC environment
+// variable. This matches the behavior of gopsutil, so that all plugins can be pointed at a container mount or at
+// recorded fixtures at once.
+func ProcPath(elem ...string) string {
+	return hostPath("HOST_PROC", "/proc", elem...)
+}
+
+// SysPath returns the given path below the sys filesystem, which can be relocated using the HOST_SYS environment
+// variable in the same way as ProcPath()
+func SysPath(elem ...string) string {
+	return hostPath("HOST_SYS", "/sys", elem...)
+}
+
+func hostPath(key string, defaultRoot string, elem ...string) string {
+	root := os.Getenv(key)
+	if root == "" {
+		root = defaultRoot
+	}
+
+	return filepath.Join(append([]string{root}, elem...)...)
+}
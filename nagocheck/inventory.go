@@ -0,0 +1,111 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"time"
+)
+
+// InventoryProvider is implemented by modules which are able to describe static facts about the host they are
+// monitoring, e.g. hardware or software versions, so that `inventory` can gather them into a single document
+type InventoryProvider interface {
+	Inventory() (interface{}, error)
+}
+
+type inventoryTool struct {
+	moduleNames []string
+}
+
+type inventoryDocument struct {
+	Host      string                 `json:"host"`
+	Timestamp time.Time              `json:"timestamp"`
+	Build     buildInfoDocument      `json:"build"`
+	Modules   map[string]interface{} `json:"modules"`
+	Errors    map[string]string      `json:"errors,omitempty"`
+}
+
+// NewInventoryTool instantiates a Tool, which gathers static facts about the host from all modules implementing
+// InventoryProvider and prints them as a single JSON document.
+func NewInventoryTool() Tool {
+	return &inventoryTool{}
+}
+
+func (t *inventoryTool) Name() string {
+	return "inventory"
+}
+
+func (t *inventoryTool) DefineCommand(app *kingpin.Application) {
+	node := app.Command(t.Name(), "Print static facts about the host as JSON, e.g. hardware and software versions.")
+
+	node.Flag("module", "Only gather facts from the given module, can be specified multiple times.").
+		Short('m').StringsVar(&t.moduleNames)
+}
+
+func (t *inventoryTool) Execute(modules map[string]Module) error {
+	selected := modules
+	if len(t.moduleNames) > 0 {
+		selected = make(map[string]Module)
+		for _, name := range t.moduleNames {
+			module, ok := modules[name]
+			if !ok {
+				return fmt.Errorf("unknown module: %s", name)
+			}
+
+			selected[name] = module
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(t.collect(selected, modules))
+}
+
+// collect gathers the facts of all selected modules. Failing modules are recorded within the document instead of
+// aborting, as an incomplete inventory is still more useful than none.
+func (t *inventoryTool) collect(selected map[string]Module, modules map[string]Module) inventoryDocument {
+	hostname, _ := os.Hostname()
+	document := inventoryDocument{
+		Host:      hostname,
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+		Build:     newBuildInfoDocument(modules),
+		Modules:   make(map[string]interface{}),
+		Errors:    make(map[string]string),
+	}
+
+	for _, module := range sortedModules(selected) {
+		provider, ok := module.(InventoryProvider)
+		if !ok {
+			continue
+		}
+
+		facts, err := provider.Inventory()
+		if err != nil {
+			document.Errors[module.Name()] = err.Error()
+			continue
+		}
+
+		document.Modules[module.Name()] = facts
+	}
+
+	return document
+}
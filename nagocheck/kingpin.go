@@ -19,8 +19,14 @@
 package nagocheck
 
 import (
+	"fmt"
 	"github.com/snapserv/nagopher"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // KingpinNode is a unified interface for kingpin, which allows using Arg() and Flag() at root- and command-level
@@ -33,6 +39,46 @@ type nagopherBoundsValue struct {
 	value *nagopher.OptionalBounds
 }
 
+type durationValue struct {
+	value *time.Duration
+}
+
+type sizeValue struct {
+	value *float64
+}
+
+type durationBoundsValue struct {
+	value *nagopher.OptionalBounds
+}
+
+type sizeBoundsValue struct {
+	value *nagopher.OptionalBounds
+}
+
+type thresholdOverridesValue struct {
+	value *ThresholdOverrides
+}
+
+type instanceThresholdsValue struct {
+	value *InstanceThresholds
+}
+
+type expectationsValue struct {
+	value *Expectations
+}
+
+type averagingPoliciesValue struct {
+	value *AveragingPolicies
+}
+
+type baselinePoliciesValue struct {
+	value *BaselinePolicies
+}
+
+type aggregationPolicyValue struct {
+	value *AggregationPolicy
+}
+
 func (r *nagopherBoundsValue) Set(rawValue string) error {
 	value, err := nagopher.NewBoundsFromNagiosRange(rawValue)
 	if err == nil {
@@ -43,10 +89,364 @@ func (r *nagopherBoundsValue) Set(rawValue string) error {
 }
 
 func (r *nagopherBoundsValue) String() string {
-	return (*r.value).OrElse(nagopher.NewBounds()).String()
+	bounds := nagopher.OptionalBoundsPtr(*r.value)
+	if bounds == nil {
+		return ""
+	}
+
+	return formatNagiosRange(*bounds)
+}
+
+// formatNagiosRange works like Bounds.ToNagiosRange(), but keeps the colon of ranges without upper bound (e.g. '10:'),
+// which nagopher omits and thereby turns into a range with an upper bound
+func formatNagiosRange(bounds nagopher.Bounds) string {
+	result := bounds.ToNagiosRange()
+	upperBound, err := bounds.Upper().Get()
+	if (err != nil || math.IsInf(upperBound, 1)) && !strings.Contains(result, ":") {
+		result += ":"
+	}
+
+	return result
 }
 
 // NagopherBoundsVar is a helper method for defining kingpin flags which should be parsed as a Nagopher range specifier.
 func NagopherBoundsVar(s kingpin.Settings, target *nagopher.OptionalBounds) {
 	s.SetValue(&nagopherBoundsValue{target})
 }
+
+func (r *durationValue) Set(rawValue string) error {
+	duration, err := ParseDuration(rawValue)
+	if err != nil {
+		return err
+	}
+
+	*r.value = duration
+	return nil
+}
+
+func (r *durationValue) String() string {
+	return r.value.String()
+}
+
+// DurationVar is a helper method for defining kingpin flags which should be parsed as durations like '15m', '2h' or
+// '7d' as supported by ParseDuration()
+func DurationVar(s kingpin.Settings, target *time.Duration) {
+	s.SetValue(&durationValue{target})
+}
+
+func (r *sizeValue) Set(rawValue string) error {
+	size, err := ParseSize(rawValue)
+	if err != nil {
+		return err
+	}
+
+	*r.value = size
+	return nil
+}
+
+func (r *sizeValue) String() string {
+	return FormatBinarySize(*r.value)
+}
+
+// SizeVar is a helper method for defining kingpin flags which should be parsed as sizes like '512MB' or '2GiB' as
+// supported by ParseSize(). The size is given in bytes.
+func SizeVar(s kingpin.Settings, target *float64) {
+	s.SetValue(&sizeValue{target})
+}
+
+func (r *durationBoundsValue) Set(rawValue string) error {
+	specifier, err := convertNagiosRange(rawValue, func(part string) (float64, error) {
+		duration, err := ParseDuration(part)
+		return duration.Seconds(), err
+	})
+	if err != nil {
+		return err
+	}
+
+	return (&nagopherBoundsValue{r.value}).Set(specifier)
+}
+
+func (r *durationBoundsValue) String() string {
+	return (&nagopherBoundsValue{r.value}).String()
+}
+
+// DurationBoundsVar is a helper method for defining kingpin flags which should be parsed as a Nagopher range specifier,
+// whose values are durations like '15m', '2h' or '7d' as supported by ParseDuration(). The bounds are given in seconds.
+func DurationBoundsVar(s kingpin.Settings, target *nagopher.OptionalBounds) {
+	s.SetValue(&durationBoundsValue{target})
+}
+
+func (r *sizeBoundsValue) Set(rawValue string) error {
+	specifier, err := convertNagiosRange(rawValue, ParseSize)
+	if err != nil {
+		return err
+	}
+
+	return (&nagopherBoundsValue{r.value}).Set(specifier)
+}
+
+func (r *sizeBoundsValue) String() string {
+	return (&nagopherBoundsValue{r.value}).String()
+}
+
+// SizeBoundsVar is a helper method for defining kingpin flags which should be parsed as a Nagopher range specifier,
+// whose values are sizes like '512MB' or '2GiB' as supported by ParseSize(). The bounds are given in bytes.
+func SizeBoundsVar(s kingpin.Settings, target *nagopher.OptionalBounds) {
+	s.SetValue(&sizeBoundsValue{target})
+}
+
+// convertNagiosRange converts both values of a Nagios range specifier using the given function, while keeping the
+// inversion prefix, the colon and infinite values as-is
+func convertNagiosRange(specifier string, convert func(string) (float64, error)) (string, error) {
+	prefix := ""
+	if strings.HasPrefix(specifier, "@") {
+		prefix, specifier = "@", specifier[1:]
+	}
+
+	parts := strings.Split(specifier, ":")
+	if len(parts) > 2 {
+		return "", fmt.Errorf("range specifier must contain only one colon")
+	}
+
+	for index, part := range parts {
+		if part == "" || part == "~" {
+			continue
+		}
+
+		value, err := convert(part)
+		if err != nil {
+			return "", err
+		}
+		parts[index] = strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	return prefix + strings.Join(parts, ":"), nil
+}
+
+func (r *thresholdOverridesValue) Set(rawValue string) error {
+	contextName, override, err := ParseThresholdOverride(rawValue)
+	if err != nil {
+		return err
+	}
+
+	if *r.value == nil {
+		*r.value = make(ThresholdOverrides)
+	}
+	(*r.value)[contextName] = override
+
+	return nil
+}
+
+func (r *thresholdOverridesValue) String() string {
+	var parts []string
+	for contextName, override := range *r.value {
+		parts = append(parts, contextName+"="+override.String())
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ",")
+}
+
+func (r *thresholdOverridesValue) IsCumulative() bool {
+	return true
+}
+
+// ThresholdOverridesVar is a helper method for defining repeatable kingpin flags, which are parsed as threshold
+// overrides using ParseThresholdOverride()
+func ThresholdOverridesVar(s kingpin.Settings, target *ThresholdOverrides) {
+	s.SetValue(&thresholdOverridesValue{target})
+}
+
+func (r *instanceThresholdsValue) Set(rawValue string) error {
+	metricName, thresholds, err := ParseInstanceThreshold(rawValue)
+	if err != nil {
+		return err
+	}
+
+	if *r.value == nil {
+		*r.value = make(InstanceThresholds)
+	}
+	(*r.value)[metricName] = thresholds
+
+	return nil
+}
+
+func (r *instanceThresholdsValue) String() string {
+	var parts []string
+	for metricName, thresholds := range *r.value {
+		parts = append(parts, metricName+"="+thresholds.String())
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ",")
+}
+
+func (r *instanceThresholdsValue) IsCumulative() bool {
+	return true
+}
+
+// InstanceThresholdsVar is a helper method for defining repeatable kingpin flags, which are parsed as instance
+// thresholds using ParseInstanceThreshold()
+func InstanceThresholdsVar(s kingpin.Settings, target *InstanceThresholds) {
+	s.SetValue(&instanceThresholdsValue{target})
+}
+
+func (r *expectationsValue) Set(rawValue string) error {
+	metricName, expected, err := ParseExpectation(rawValue)
+	if err != nil {
+		return err
+	}
+
+	if *r.value == nil {
+		*r.value = make(Expectations)
+	}
+	(*r.value)[metricName] = expected
+
+	return nil
+}
+
+func (r *expectationsValue) String() string {
+	var parts []string
+	for metricName, expected := range *r.value {
+		parts = append(parts, metricName+"="+strings.Join(expected, ","))
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ";")
+}
+
+func (r *expectationsValue) IsCumulative() bool {
+	return true
+}
+
+// ExpectationsVar is a helper method for defining repeatable kingpin flags, which are parsed as expectations using
+// ParseExpectation()
+func ExpectationsVar(s kingpin.Settings, target *Expectations) {
+	s.SetValue(&expectationsValue{target})
+}
+
+func (r *averagingPoliciesValue) Set(rawValue string) error {
+	contextName, policy, err := ParseAveragingPolicy(rawValue)
+	if err != nil {
+		return err
+	}
+
+	if *r.value == nil {
+		*r.value = make(AveragingPolicies)
+	}
+	(*r.value)[contextName] = policy
+
+	return nil
+}
+
+func (r *averagingPoliciesValue) String() string {
+	var parts []string
+	for contextName, policy := range *r.value {
+		parts = append(parts, contextName+"="+policy.String())
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ",")
+}
+
+func (r *averagingPoliciesValue) IsCumulative() bool {
+	return true
+}
+
+// AveragingPoliciesVar is a helper method for defining repeatable kingpin flags, which are parsed as averaging policies
+// using ParseAveragingPolicy()
+func AveragingPoliciesVar(s kingpin.Settings, target *AveragingPolicies) {
+	s.SetValue(&averagingPoliciesValue{target})
+}
+
+func (r *baselinePoliciesValue) Set(rawValue string) error {
+	contextName, policy, err := ParseBaselinePolicy(rawValue)
+	if err != nil {
+		return err
+	}
+
+	if *r.value == nil {
+		*r.value = make(BaselinePolicies)
+	}
+	(*r.value)[contextName] = policy
+
+	return nil
+}
+
+func (r *baselinePoliciesValue) String() string {
+	var parts []string
+	for contextName, policy := range *r.value {
+		parts = append(parts, contextName+"="+policy.String())
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ",")
+}
+
+func (r *baselinePoliciesValue) IsCumulative() bool {
+	return true
+}
+
+// BaselinePoliciesVar is a helper method for defining repeatable kingpin flags, which are parsed as baseline policies
+// using ParseBaselinePolicy()
+func BaselinePoliciesVar(s kingpin.Settings, target *BaselinePolicies) {
+	s.SetValue(&baselinePoliciesValue{target})
+}
+
+func (r *aggregationPolicyValue) Set(rawValue string) error {
+	policy, err := ParseAggregationPolicy(rawValue)
+	if err == nil {
+		*r.value = policy
+	}
+
+	return err
+}
+
+func (r *aggregationPolicyValue) String() string {
+	return r.value.String()
+}
+
+// AggregationPolicyVar is a helper method for defining kingpin flags, which are parsed using ParseAggregationPolicy()
+func AggregationPolicyVar(s kingpin.Settings, target *AggregationPolicy) {
+	s.SetValue(&aggregationPolicyValue{target})
+}
+
+// DefineEnvars associates all module and plugin flags of the given modules, which do not already have an environment
+// variable, with a default one named 'NAGOCHECK_<MODULE>_<FLAG>' or 'NAGOCHECK_<MODULE>_<PLUGIN>_<FLAG>'. This must be
+// called after all flags have been defined and before parsing the command line.
+func DefineEnvars(app *kingpin.Application, modules map[string]Module) {
+	for _, module := range modules {
+		moduleNode := app.GetCommand(module.Name())
+		if moduleNode == nil {
+			continue
+		}
+
+		defineCommandEnvars(moduleNode, "NAGOCHECK_"+module.Name())
+		for _, plugin := range module.Plugins() {
+			if pluginNode := moduleNode.GetCommand(plugin.Name()); pluginNode != nil {
+				defineCommandEnvars(pluginNode, "NAGOCHECK_"+module.Name()+"_"+plugin.Name())
+			}
+		}
+	}
+}
+
+func defineCommandEnvars(node *kingpin.CmdClause, prefix string) {
+	for _, flagModel := range node.Model().Flags {
+		if flagModel.Envar != "" || flagModel.Name == "help" {
+			continue
+		}
+
+		node.GetFlag(flagModel.Name).Envar(envarName(prefix + "_" + flagModel.Name))
+	}
+}
+
+// envarName converts the given name into an environment variable name by upper-casing it and replacing all characters
+// besides letters, digits and underscores with underscores
+func envarName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(name))
+}
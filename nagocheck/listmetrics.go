@@ -0,0 +1,76 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// ListMetrics probes all resources of the given check without evaluating the collected metrics and writes a table
+// containing the name, current value, unit and context of each metric to the given writer. Resources are not torn
+// down, so that persistent data (e.g. of delta contexts) remains unchanged.
+func ListMetrics(check nagopher.Check, writer io.Writer) error {
+	contextNames := make(map[string]bool)
+	for _, context := range check.Contexts() {
+		contextNames[context.Name()] = true
+	}
+
+	warnings := nagopher.NewWarningCollection()
+	var metrics []nagopher.Metric
+	for _, resource := range check.Resources() {
+		if err := resource.Setup(warnings); err != nil {
+			return fmt.Errorf("could not setup resource: %s", err.Error())
+		}
+
+		resourceMetrics, err := resource.Probe(warnings)
+		if err != nil {
+			return fmt.Errorf("could not probe resource: %s", err.Error())
+		}
+		metrics = append(metrics, resourceMetrics...)
+	}
+
+	sort.SliceStable(metrics, func(i, j int) bool {
+		return metrics[i].Name() < metrics[j].Name()
+	})
+
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(table, "METRIC\tVALUE\tUNIT\tCONTEXT")
+	for _, metric := range metrics {
+		contextName := metric.ContextName()
+		if !contextNames[contextName] {
+			contextName += " (missing)"
+		}
+
+		_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", metric.Name(), metric.ValueString(), metric.ValueUnit(),
+			contextName)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	for _, warning := range warnings.GetWarningStrings() {
+		_, _ = fmt.Fprintf(writer, "warning: %s\n", warning)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Logger writes structured debug messages for a specific component to stderr, but only if debug logging has been
+// enabled using the global --debug flag. All methods are safe to call when debugging is disabled.
+type Logger interface {
+	Debugf(format string, values ...interface{})
+	WithField(key string, value interface{}) Logger
+	Timed(action string) func()
+}
+
+type baseLogger struct {
+	component string
+	fields    map[string]interface{}
+}
+
+var logOutput io.Writer = os.Stderr
+
+// NewLogger instantiates a new Logger for the given component name, e.g. a module or plugin name
+func NewLogger(component string) Logger {
+	return &baseLogger{
+		component: component,
+		fields:    make(map[string]interface{}),
+	}
+}
+
+// DebugEnabled returns true if debug logging has been enabled
+func DebugEnabled() bool {
+	return globals.debug
+}
+
+func (l *baseLogger) Debugf(format string, values ...interface{}) {
+	if !globals.debug {
+		return
+	}
+
+	parts := []string{
+		time.Now().Format("2006-01-02T15:04:05.000"),
+		"DEBUG",
+		"[" + l.component + "]",
+		fmt.Sprintf(format, values...),
+	}
+
+	keys := make([]string, 0, len(l.fields))
+	for key := range l.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", key, fmt.Sprint(l.fields[key])))
+	}
+
+	_, _ = fmt.Fprintln(logOutput, strings.Join(parts, " "))
+}
+
+func (l *baseLogger) WithField(key string, value interface{}) Logger {
+	fields := make(map[string]interface{}, len(l.fields)+1)
+	for existingKey, existingValue := range l.fields {
+		fields[existingKey] = existingValue
+	}
+	fields[key] = value
+
+	return &baseLogger{
+		component: l.component,
+		fields:    fields,
+	}
+}
+
+// Timed logs the start of the given action and returns a function, which logs its completion including the elapsed
+// time when being called. It is meant to be used together with defer.
+func (l *baseLogger) Timed(action string) func() {
+	if !globals.debug {
+		return func() {}
+	}
+
+	startTime := time.Now()
+	l.Debugf("%s started", action)
+
+	return func() {
+		l.WithField("duration", time.Since(startTime)).Debugf("%s finished", action)
+	}
+}
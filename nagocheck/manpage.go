@@ -0,0 +1,232 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type manPageTool struct {
+	app       *kingpin.Application
+	outputDir string
+}
+
+// NewManPageTool instantiates a hidden Tool, which renders man pages for all modules and plugins out of the kingpin
+// command tree, so that packagers can ship documentation which always matches the binary
+func NewManPageTool() Tool {
+	return &manPageTool{}
+}
+
+func (t *manPageTool) Name() string {
+	return "gen-man"
+}
+
+func (t *manPageTool) DefineCommand(app *kingpin.Application) {
+	t.app = app
+
+	node := app.Command(t.Name(), "Generate man pages for all modules and plugins.").Hidden()
+	node.Flag("output-dir", "Write a consolidated page as nagocheck.1 and one page per module as "+
+		"nagocheck-<module>.1 into the given directory instead of printing the consolidated page.").
+		Short('o').StringVar(&t.outputDir)
+}
+
+func (t *manPageTool) Execute(modules map[string]Module) error {
+	model := t.app.Model()
+	commands := make(map[string]*kingpin.CmdModel)
+	for _, command := range model.Commands {
+		commands[command.Name] = command
+	}
+
+	if t.outputDir == "" {
+		fmt.Print(t.renderConsolidated(model, modules, commands))
+		return nil
+	}
+
+	pages := map[string]string{model.Name + ".1": t.renderConsolidated(model, modules, commands)}
+	for _, module := range sortedModules(modules) {
+		if command, ok := commands[module.Name()]; ok {
+			pages[model.Name+"-"+module.Name()+".1"] = t.renderModule(model, module, command)
+		}
+	}
+
+	if err := os.MkdirAll(t.outputDir, 0755); err != nil {
+		return fmt.Errorf("could not create output directory: %s", err.Error())
+	}
+	for name, page := range pages {
+		if err := ioutil.WriteFile(filepath.Join(t.outputDir, name), []byte(page), 0644); err != nil {
+			return fmt.Errorf("could not write man page: %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (t *manPageTool) renderConsolidated(model *kingpin.ApplicationModel, modules map[string]Module,
+	commands map[string]*kingpin.CmdModel) string {
+	var buffer bytes.Buffer
+
+	writeManHeader(&buffer, model.Name, model.Name, "Reliable and lightweight Nagios plugins written in Go")
+	fmt.Fprintf(&buffer, ".SH SYNOPSIS\n.B %s\n[\\fIFLAGS\\fR] \\fIMODULE\\fR [\\fIFLAGS\\fR] \\fIPLUGIN\\fR "+
+		"[\\fIFLAGS\\fR] [\\fIARGS\\fR]\n.br\n.B %s\n[\\fIFLAGS\\fR] \\fICOMMAND\\fR [\\fIFLAGS\\fR] "+
+		"[\\fIARGS\\fR]\n", model.Name, model.Name)
+	fmt.Fprintf(&buffer, ".SH DESCRIPTION\n%s provides Nagios plugins grouped by modules. Each plugin returns a "+
+		"single status line including performance data and exits with the respective Nagios state.\n",
+		model.Name)
+	fmt.Fprintf(&buffer, ".PP\nAll flags of modules and plugins can also be set using environment variables named "+
+		"NAGOCHECK_<MODULE>_<FLAG> or NAGOCHECK_<MODULE>_<PLUGIN>_<FLAG>, which are listed below each flag.\n")
+
+	buffer.WriteString(".SH GLOBAL FLAGS\n")
+	writeManFlags(&buffer, model.FlagGroupModel)
+
+	buffer.WriteString(".SH MODULES\n")
+	for _, module := range sortedModules(modules) {
+		if command, ok := commands[module.Name()]; ok {
+			writeManModule(&buffer, model.Name, module, command)
+		}
+	}
+
+	buffer.WriteString(".SH COMMANDS\n")
+	for _, command := range model.Commands {
+		if _, ok := modules[command.Name]; ok || command.Hidden {
+			continue
+		}
+
+		writeManCommand(&buffer, model.Name+" "+command.Name, command)
+		for _, subcommand := range command.Commands {
+			if !subcommand.Hidden {
+				writeManCommand(&buffer, model.Name+" "+command.Name+" "+subcommand.Name, subcommand)
+			}
+		}
+	}
+
+	return buffer.String()
+}
+
+func (t *manPageTool) renderModule(model *kingpin.ApplicationModel, module Module, command *kingpin.CmdModel) string {
+	var buffer bytes.Buffer
+
+	name := model.Name + "-" + module.Name()
+	writeManHeader(&buffer, name, name, fmt.Sprintf("%s plugins of %s", module.Description(), model.Name))
+	fmt.Fprintf(&buffer, ".SH SYNOPSIS\n.B %s %s\n[\\fIFLAGS\\fR] \\fIPLUGIN\\fR [\\fIFLAGS\\fR] [\\fIARGS\\fR]\n",
+		model.Name, module.Name())
+	buffer.WriteString(".SH MODULE\n")
+	writeManModule(&buffer, model.Name, module, command)
+	fmt.Fprintf(&buffer, ".SH SEE ALSO\n.BR %s (1)\n", model.Name)
+
+	return buffer.String()
+}
+
+func writeManHeader(buffer *bytes.Buffer, title string, name string, description string) {
+	date := buildInfo.Date
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	fmt.Fprintf(buffer, ".TH %s 1 %q %q \"User Commands\"\n", strings.ToUpper(manEscape(title)), date,
+		"nagocheck "+buildInfo.Version)
+	fmt.Fprintf(buffer, ".SH NAME\n%s \\- %s\n", manEscape(name), manEscape(description))
+}
+
+func writeManModule(buffer *bytes.Buffer, appName string, module Module, command *kingpin.CmdModel) {
+	fmt.Fprintf(buffer, ".SS \"%s %s\"\n%s\n", appName, module.Name(), manEscape(module.Description()))
+	if len(visibleFlags(command.FlagGroupModel)) > 0 {
+		buffer.WriteString(".PP\nModule flags:\n")
+		writeManFlags(buffer, command.FlagGroupModel)
+	}
+
+	for _, plugin := range sortedPlugins(module) {
+		for _, subcommand := range command.Commands {
+			if subcommand.Name == plugin.Name() && !subcommand.Hidden {
+				writeManCommand(buffer, appName+" "+module.Name()+" "+plugin.Name(), subcommand)
+			}
+		}
+	}
+}
+
+func writeManCommand(buffer *bytes.Buffer, path string, command *kingpin.CmdModel) {
+	var synopsis []string
+	for _, arg := range command.Args {
+		argument := "\\fI" + manEscape(arg.Name) + "\\fR"
+		if !arg.Required {
+			argument = "[" + argument + "]"
+		}
+		synopsis = append(synopsis, argument)
+	}
+
+	fmt.Fprintf(buffer, ".SS \"%s\"\n%s\n", manEscape(path), manEscape(command.Help))
+	synopsis = append([]string{"[\\fIFLAGS\\fR]"}, synopsis...)
+	fmt.Fprintf(buffer, ".PP\n.B %s\n%s\n", manEscape(path), strings.Join(synopsis, " "))
+
+	for _, arg := range command.Args {
+		fmt.Fprintf(buffer, ".TP\n\\fI%s\\fR\n%s\n", manEscape(arg.Name), manEscape(arg.Help))
+	}
+	writeManFlags(buffer, command.FlagGroupModel)
+}
+
+func writeManFlags(buffer *bytes.Buffer, group *kingpin.FlagGroupModel) {
+	for _, flag := range visibleFlags(group) {
+		if flag.Name == "help" {
+			continue
+		}
+
+		name := "\\fB\\-\\-" + manEscape(flag.Name) + "\\fR"
+		if flag.Short != 0 {
+			name = "\\fB\\-" + string(flag.Short) + "\\fR, " + name
+		}
+		if !flag.IsBoolFlag() {
+			placeholder := flag.PlaceHolder
+			if placeholder == "" {
+				placeholder = strings.ToUpper(strings.Replace(flag.Name, "-", "_", -1))
+			}
+			name += "=\\fI" + manEscape(placeholder) + "\\fR"
+		}
+
+		help := manEscape(flag.Help)
+		if len(flag.Default) > 0 && flag.Default[0] != "" {
+			help += " Defaults to \\fB" + manEscape(strings.Join(flag.Default, ", ")) + "\\fR."
+		}
+		if flag.Envar != "" {
+			help += "\n.br\nEnvironment: \\fB" + manEscape(flag.Envar) + "\\fR"
+		}
+
+		fmt.Fprintf(buffer, ".TP\n%s\n%s\n", name, help)
+	}
+}
+
+// manEscape escapes the given text for being used within roff, which interprets backslashes as escape sequences and
+// lines starting with a dot or an apostrophe as requests
+func manEscape(text string) string {
+	text = strings.Replace(text, `\`, `\e`, -1)
+	text = strings.Replace(text, "-", `\-`, -1)
+
+	lines := strings.Split(text, "\n")
+	for index, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[index] = `\&` + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
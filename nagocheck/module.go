@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"github.com/snapserv/nagopher"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
 )
 
 // Module consists out of several plugins and offers methods for executing them
@@ -30,11 +31,13 @@ type Module interface {
 	Description() string
 	Plugins() map[string]Plugin
 
-	DefineCommand() KingpinNode
+	DefineCommand(app *kingpin.Application) KingpinNode
 	DefineFlags(node KingpinNode)
 	RegisterPlugin(plugin Plugin)
 	ExecutePlugin(plugin Plugin) error
 	GetPluginByName(pluginName string) (Plugin, error)
+
+	handleResults(handler func(SinkResult))
 }
 
 // ModuleOpt is a type alias for functional options used by NewModule()
@@ -44,6 +47,8 @@ type baseModule struct {
 	name        string
 	description string
 	plugins     map[string]Plugin
+
+	resultHandler func(SinkResult)
 }
 
 // RegisterModules returns a map of modules with their name as the respective key. Additionally, all plugins contained
@@ -93,13 +98,14 @@ func (m *baseModule) RegisterPlugin(plugin Plugin) {
 	m.plugins[plugin.Name()] = plugin
 }
 
-func (m *baseModule) DefineCommand() KingpinNode {
-	moduleNode := kingpin.Command(m.name, m.description)
+func (m *baseModule) DefineCommand(app *kingpin.Application) KingpinNode {
+	moduleNode := app.Command(m.name, m.description)
 
 	for _, plugin := range m.plugins {
 		pluginDescription := fmt.Sprintf("%s: %s", m.description, plugin.Description())
 		pluginNode := moduleNode.Command(plugin.Name(), pluginDescription)
 
+		plugin.setModuleNode(moduleNode)
 		plugin.defineDefaultFlags(pluginNode)
 		plugin.DefineFlags(pluginNode)
 	}
@@ -111,13 +117,179 @@ func (m *baseModule) DefineFlags(node KingpinNode) {
 }
 
 func (m *baseModule) ExecutePlugin(plugin Plugin) error {
+	if err := applyHardening(); err != nil {
+		return err
+	}
+
+	if globals.listMetrics {
+		if err := ListMetrics(plugin.DefineCheck(), os.Stdout); err != nil {
+			return err
+		}
+
+		os.Exit(0)
+	}
+
+	// Results are only cached for regular invocations, as the cache key is derived from the flags parsed on startup
+	var cache *resultCache
+	if m.resultHandler == nil {
+		cache = newResultCache(m, plugin)
+	}
+	if cache != nil {
+		if sinkResult, ok := cache.Load(m, plugin); ok {
+			return m.finishExecution(sinkResult)
+		}
+	}
+
 	check := plugin.DefineCheck()
-	runtime := nagopher.NewRuntime(plugin.VerboseOutput())
-	runtime.ExecuteAndExit(check)
+	sampling := newResourceSampling(check, globals.sampleInterval)
+	if err := plugin.AveragingPolicies().Apply(check, plugin); err != nil {
+		return err
+	}
+	thresholdOverrides, err := resolveThresholdOverrides(globals, plugin, check)
+	if err != nil {
+		return err
+	}
+	if err := thresholdOverrides.Apply(check); err != nil {
+		return err
+	}
+	plugin.InstanceThresholds().Apply(check)
+	if err := plugin.BaselinePolicies().Apply(check, plugin); err != nil {
+		return err
+	}
+	plugin.Expectations().Apply(check)
+	plugin.MetricFilter().Apply(check)
+	PerfDataLabels{MaxLength: globals.perfDataLabelLength}.Apply(check)
+	check = plugin.AggregationPolicy().Apply(check)
+
+	partialPolicy, err := NewPartialPolicy()
+	if err != nil {
+		return err
+	}
+	check = partialPolicy.Apply(check)
+
+	logger := NewLogger(m.name).WithField("plugin", plugin.Name())
+	baseSinkResult := newBaseSinkResult(m, plugin)
+	ack, err := loadAcknowledgement(baseSinkResult.Service, plugin)
+	if err != nil {
+		logger.Debugf("could not load acknowledgement: %s", err.Error())
+	}
+	evaluatedCheck := check
+	check = ack.Apply(check)
+
+	if plugin.SummaryTemplate() != "" {
+		templatedCheck, err := NewTemplatedCheck(check, plugin, plugin.SummaryTemplate())
+		if err != nil {
+			return err
+		}
+		check = templatedCheck
+	}
+
+	stateMapping, err := NewStateMapping()
+	if err != nil {
+		return err
+	}
+	check = stateMapping.Apply(check)
+
+	downtime, err := loadActiveDowntime(baseSinkResult.Host, baseSinkResult.Service)
+	if err != nil {
+		return err
+	}
+	if check, err = downtime.Apply(check); err != nil {
+		return err
+	}
+	check = ApplyCapacityReport(check, plugin)
+	check = ApplySelfMetrics(check)
+
+	sampling.Sample(check, logger)
+	probeResourceGroups(check, logger)
+
+	finishExecution := logger.Timed("plugin execution")
+	runtime := nagopher.NewRuntime(plugin.VerboseOutput() || plugin.CapacityReport().Enabled)
+	result := runtime.Execute(check)
+	finishExecution()
+
+	plugin.storeDeferredPersistence()
+	if history := plugin.History(); history != nil {
+		if err := history.Flush(); err != nil {
+			logger.Debugf("could not store history: %s", err.Error())
+		}
+	}
+
+	if err := ack.Release(evaluatedCheck); err != nil {
+		logger.Debugf("could not release acknowledgement: %s", err.Error())
+	}
+
+	logger.WithField("exitCode", result.ExitCode()).Debugf("plugin execution resulted in state %s", check.State().Description())
+
+	sinkResult := NewSinkResult(m, plugin, check, result)
+	if cache != nil {
+		if err := cache.Store(sinkResult); err != nil {
+			logger.Debugf("could not store result in cache: %s", err.Error())
+		}
+	}
+
+	return m.finishExecution(sinkResult)
+}
+
+// finishExecution either passes the result to the result handler or emits it using the configured sinks, followed by
+// terminating the process with the respective exit code
+func (m *baseModule) finishExecution(sinkResult SinkResult) error {
+	if m.resultHandler != nil {
+		m.resultHandler(sinkResult)
+		return nil
+	}
+
+	exitCode := sinkResult.ExitCode
+	if err := m.emitResult(sinkResult); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		exitCode = int(nagopher.StateUnknown().ExitCode())
+	}
+
+	os.Exit(exitCode)
 
 	return nil
 }
 
+func (m *baseModule) emitResult(sinkResult SinkResult) error {
+	sinks, err := NewSinks()
+	if err != nil {
+		return err
+	}
+
+	for _, sink := range sinks {
+		if err := sink.Emit(sinkResult); err != nil {
+			return fmt.Errorf("%s sink failed: %s", sink.Name(), err.Error())
+		}
+	}
+
+	return nil
+}
+
+// handleResults passes the results of all subsequent plugin executions to the given handler instead of emitting them
+// using the configured sinks and terminating the process, which allows executing plugins in-process
+func (m *baseModule) handleResults(handler func(SinkResult)) {
+	m.resultHandler = handler
+}
+
+// ExecutePluginInProcess executes the given plugin like Module.ExecutePlugin(), but returns the result instead of
+// emitting it using the configured sinks and terminating the process. All flags must have been parsed beforehand.
+func ExecutePluginInProcess(module Module, plugin Plugin) (result SinkResult, _ error) {
+	executed := false
+	module.handleResults(func(sinkResult SinkResult) {
+		result, executed = sinkResult, true
+	})
+	defer module.handleResults(nil)
+
+	if err := module.ExecutePlugin(plugin); err != nil {
+		return result, err
+	}
+	if !executed {
+		return result, fmt.Errorf("plugin execution did not return a result")
+	}
+
+	return result, nil
+}
+
 func (m *baseModule) GetPluginByName(pluginName string) (Plugin, error) {
 	plugin, ok := m.plugins[pluginName]
 	if !ok {
@@ -0,0 +1,51 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagochecktest
+
+import (
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// KingpinNode is a standalone implementation of nagocheck.KingpinNode, which allows testing the flag definitions of a
+// module or plugin in isolation by passing it to DefineFlags() and parsing arbitrary arguments afterwards
+type KingpinNode struct {
+	app *kingpin.Application
+}
+
+// NewKingpinNode instantiates a KingpinNode without any flags or arguments
+func NewKingpinNode() *KingpinNode {
+	return &KingpinNode{
+		app: newApplication(),
+	}
+}
+
+// Arg defines a positional argument
+func (n *KingpinNode) Arg(name, help string) *kingpin.ArgClause {
+	return n.app.Arg(name, help)
+}
+
+// Flag defines a flag
+func (n *KingpinNode) Flag(name, help string) *kingpin.FlagClause {
+	return n.app.Flag(name, help)
+}
+
+// Parse parses the given arguments and stores their values in the variables bound by the defined flags and arguments
+func (n *KingpinNode) Parse(args ...string) error {
+	_, err := n.app.Parse(args)
+	return err
+}
@@ -0,0 +1,179 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+// Package nagochecktest provides helpers for testing nagocheck modules and plugins, e.g. executing plugins in-process
+// against recorded /proc and /sys fixtures with an in-memory persistence backend and comparing their output with
+// golden files:
+//
+//	restoreFixtures := nagochecktest.UseFixtures("testdata/mdraid/raid1-degraded/proc", "")
+//	defer restoreFixtures()
+//
+//	result, err := nagochecktest.RunCheck(modsystem.NewSystemModule(), "mdraid")
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	if err := nagochecktest.CompareGolden("testdata/mdraid/raid1-degraded.golden", result.Output); err != nil {
+//		t.Error(err)
+//	}
+package nagochecktest
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Result contains the outcome of a plugin execution using RunCheck()
+type Result struct {
+	nagocheck.SinkResult
+
+	// Output contains the complete output as printed according to the Nagios plugin specs, including perfdata
+	Output string
+}
+
+// RunCheck parses the given arguments, which must start with the plugin name, and executes the plugin of the given
+// module in-process using an empty in-memory persistence backend. As kingpin keeps values of repeatable flags across
+// parses, a freshly instantiated module should be passed each time.
+func RunCheck(module nagocheck.Module, args ...string) (Result, error) {
+	return RunCheckWithPersistence(NewMemoryPersistence(), module, args...)
+}
+
+// RunCheckWithPersistence works like RunCheck(), but uses the given persistence backend, which allows testing
+// delta-based checks across several executions. File-based data bypassing the persistence backend, e.g. the history
+// of plugins, is kept within a temporary state directory which gets removed after the execution.
+func RunCheckWithPersistence(persistence nagocheck.PersistenceBackend, module nagocheck.Module,
+	args ...string) (_ Result, rerr error) {
+	if len(args) == 0 {
+		return Result{}, fmt.Errorf("no plugin name given")
+	}
+
+	plugin, err := module.GetPluginByName(args[0])
+	if err != nil {
+		return Result{}, err
+	}
+
+	app := newApplication()
+	nagocheck.RegisterModules(module)
+	moduleNode := module.DefineCommand(app)
+	module.DefineFlags(moduleNode)
+
+	if _, err := app.Parse(append([]string{module.Name()}, args...)); err != nil {
+		return Result{}, fmt.Errorf("could not parse arguments: %s", err.Error())
+	}
+
+	restorePersistence := nagocheck.OverridePersistenceBackend(persistence)
+	defer restorePersistence()
+
+	stateDirectory, err := ioutil.TempDir("", "nagochecktest-")
+	if err != nil {
+		return Result{}, fmt.Errorf("could not create state directory: %s", err.Error())
+	}
+	restoreStateDirectory := nagocheck.OverrideStateDirectory(stateDirectory)
+	defer func() {
+		restoreStateDirectory()
+		if err := os.RemoveAll(stateDirectory); err != nil && rerr == nil {
+			rerr = fmt.Errorf("could not remove state directory: %s", err.Error())
+		}
+	}()
+
+	sinkResult, err := nagocheck.ExecutePluginInProcess(module, plugin)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{SinkResult: sinkResult, Output: sinkResult.RawOutput}, nil
+}
+
+// UseFixtures relocates the proc and sys filesystems to the given fixture directories by setting HOST_PROC and
+// HOST_SYS, which are respected by nagocheck.ProcPath(), nagocheck.SysPath() and gopsutil. Empty directories keep
+// the respective filesystem untouched. The returned function restores the previous environment.
+func UseFixtures(procDirectory string, sysDirectory string) (restore func()) {
+	var restoreFuncs []func()
+	if procDirectory != "" {
+		restoreFuncs = append(restoreFuncs, setEnv("HOST_PROC", procDirectory))
+	}
+	if sysDirectory != "" {
+		restoreFuncs = append(restoreFuncs, setEnv("HOST_SYS", sysDirectory))
+	}
+
+	return func() {
+		for _, restoreFunc := range restoreFuncs {
+			restoreFunc()
+		}
+	}
+}
+
+// CompareGolden compares the given output with the contents of the golden file at the given path and returns an error
+// describing the first difference. When NAGOCHECK_UPDATE_GOLDEN is set, the golden file gets overwritten instead.
+func CompareGolden(path string, actual string) error {
+	if os.Getenv("NAGOCHECK_UPDATE_GOLDEN") != "" {
+		return ioutil.WriteFile(path, []byte(actual), 0644)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read golden file: %s", err.Error())
+	}
+
+	expected := string(data)
+	if expected == actual {
+		return nil
+	}
+
+	expectedLines, actualLines := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+	for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+		var expectedLine, actualLine string
+		if i < len(expectedLines) {
+			expectedLine = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			actualLine = actualLines[i]
+		}
+
+		if expectedLine != actualLine {
+			return fmt.Errorf("output differs from %s at line %d:\n  expected: %q\n  actual:   %q",
+				path, i+1, expectedLine, actualLine)
+		}
+	}
+
+	return fmt.Errorf("output differs from %s", path)
+}
+
+func newApplication() *kingpin.Application {
+	app := kingpin.New("nagocheck", "")
+	app.UsageWriter(ioutil.Discard)
+	app.ErrorWriter(ioutil.Discard)
+	app.Terminate(nil)
+
+	return app
+}
+
+func setEnv(key string, value string) (restore func()) {
+	previous, existed := os.LookupEnv(key)
+	_ = os.Setenv(key, value)
+
+	return func() {
+		if existed {
+			_ = os.Setenv(key, previous)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	}
+}
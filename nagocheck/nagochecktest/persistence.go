@@ -0,0 +1,71 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagochecktest
+
+import (
+	"sync"
+)
+
+// MemoryPersistence is an in-memory implementation of nagocheck.PersistenceBackend, which allows inspecting and
+// preparing persistent data of resources, e.g. for testing delta-based checks
+type MemoryPersistence struct {
+	mutex sync.Mutex
+	data  map[string][]byte
+}
+
+// NewMemoryPersistence instantiates an empty MemoryPersistence
+func NewMemoryPersistence() *MemoryPersistence {
+	return &MemoryPersistence{
+		data: make(map[string][]byte),
+	}
+}
+
+// Name returns the name of the persistence backend
+func (p *MemoryPersistence) Name() string {
+	return "memory"
+}
+
+// Load returns the data stored for the given key or nil, if no data exists
+func (p *MemoryPersistence) Load(key string) ([]byte, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.data[key], nil
+}
+
+// Store stores a copy of the given data for the given key
+func (p *MemoryPersistence) Store(key string, data []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.data[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// Keys returns all keys for which data has been stored
+func (p *MemoryPersistence) Keys() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var keys []string
+	for key := range p.data {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
@@ -0,0 +1,220 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"sync"
+	"time"
+)
+
+// ConcurrentResult contains the outcome of a single call executed by RunConcurrently()
+type ConcurrentResult struct {
+	Value interface{}
+	Err   error
+}
+
+// resourceGroup probes a set of resources concurrently using a bounded pool of workers, keeping the results until the
+// check evaluates each resource
+type resourceGroup struct {
+	once      sync.Once
+	workers   int
+	resources []*concurrentResource
+}
+
+type concurrentResource struct {
+	Resource
+
+	group     *resourceGroup
+	metrics   []nagopher.Metric
+	warnings  nagopher.WarningCollection
+	err       error
+	abandoned bool
+}
+
+// AttachConcurrentResources attaches the given resources to the check, so that all of them get probed concurrently as
+// soon as the check probes the first one, which keeps checks evaluating many resources (e.g. all interfaces or disks)
+// fast. Setup() and Probe() of the resources must therefore be safe for concurrent use, while Teardown() is still
+// being called sequentially after the metrics have been evaluated. The amount of workers defaults to --probe-workers
+// if zero. Resources exceeding --probe-timeout are reported as failed and skip Teardown(), so that a single hanging
+// resource neither delays all others nor persists incomplete data.
+func AttachConcurrentResources(check nagopher.Check, workers int, resources ...Resource) {
+	group := &resourceGroup{workers: workers}
+	for _, resource := range resources {
+		concurrentResource := &concurrentResource{Resource: resource, group: group}
+		group.resources = append(group.resources, concurrentResource)
+
+		// Resources are attached one by one, as nagopher identifies them by the address of its loop variable
+		check.AttachResources(concurrentResource)
+	}
+}
+
+// probeResourceGroups probes all concurrent resources of the given check upfront, so that the time spent on probing
+// shows up separately from the evaluation when debugging slow plugins
+func probeResourceGroups(check nagopher.Check, logger Logger) {
+	var groups []*resourceGroup
+	for _, resource := range check.Resources() {
+		if concurrentResource, ok := resource.(*concurrentResource); ok {
+			groups = append(groups, concurrentResource.group)
+		}
+	}
+	if len(groups) == 0 {
+		return
+	}
+
+	finishProbing := logger.WithField("resources", len(groups)).Timed("concurrent probing")
+	for _, group := range groups {
+		group.probe()
+	}
+	finishProbing()
+}
+
+func (g *resourceGroup) probe() {
+	g.once.Do(func() {
+		results := RunConcurrently(len(g.resources), g.workers, func(index int) (interface{}, error) {
+			return g.resources[index].probe()
+		})
+
+		for index, resource := range g.resources {
+			resource.metrics, resource.warnings = nil, nagopher.NewWarningCollection()
+			resource.err, resource.abandoned = results[index].Err, isTimeoutResult(results[index])
+			if probeResult, ok := results[index].Value.(concurrentProbeResult); ok {
+				resource.metrics, resource.warnings = probeResult.metrics, probeResult.warnings
+			}
+		}
+	})
+}
+
+type concurrentProbeResult struct {
+	metrics  []nagopher.Metric
+	warnings nagopher.WarningCollection
+}
+
+// errProbeTimeout is returned by RunConcurrently() for calls which have been abandoned due to --probe-timeout
+type errProbeTimeout struct {
+	timeout time.Duration
+}
+
+func (e errProbeTimeout) Error() string {
+	return "probing timed out after " + DurationString(e.timeout)
+}
+
+func isTimeoutResult(result ConcurrentResult) bool {
+	_, ok := result.Err.(errProbeTimeout)
+	return ok
+}
+
+// RunConcurrently calls fn for each index below count using a bounded pool of workers, which defaults to
+// --probe-workers if zero, and returns the results in the same order. Calls exceeding --probe-timeout are abandoned
+// and reported as failed, so that a single hanging object like a stale NFS mount does not delay all others. As
+// abandoned calls keep running in the background, fn must only pass its results by returning them.
+func RunConcurrently(count int, workers int, fn func(index int) (interface{}, error)) []ConcurrentResult {
+	if workers <= 0 {
+		workers = globals.probeWorkers
+	}
+	if workers <= 0 || workers > count {
+		workers = count
+	}
+
+	results := make([]ConcurrentResult, count)
+	var waitGroup sync.WaitGroup
+	queue := make(chan int)
+	for i := 0; i < workers; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for index := range queue {
+				results[index] = runWithTimeout(index, globals.probeTimeout, fn)
+			}
+		}()
+	}
+
+	for index := 0; index < count; index++ {
+		queue <- index
+	}
+	close(queue)
+	waitGroup.Wait()
+
+	return results
+}
+
+// runWithTimeout calls fn within its own goroutine, so that it can be abandoned after the given timeout. Panics are
+// converted into errors, as they would otherwise terminate the whole process without any output.
+func runWithTimeout(index int, timeout time.Duration, fn func(index int) (interface{}, error)) ConcurrentResult {
+	done := make(chan ConcurrentResult, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- ConcurrentResult{Err: fmt.Errorf("probing panicked: %v", recovered)}
+			}
+		}()
+
+		value, err := fn(index)
+		done <- ConcurrentResult{Value: value, Err: err}
+	}()
+
+	if timeout <= 0 {
+		return <-done
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-done:
+		return result
+	case <-timer.C:
+		recordTimeout()
+		return ConcurrentResult{Err: errProbeTimeout{timeout: timeout}}
+	}
+}
+
+// probe executes Setup() and Probe() of the wrapped resource, collecting warnings separately as warning collections
+// are not safe for concurrent use
+func (r *concurrentResource) probe() (interface{}, error) {
+	warnings := nagopher.NewWarningCollection()
+	if err := r.Resource.Setup(warnings); err != nil {
+		return concurrentProbeResult{warnings: warnings}, err
+	}
+
+	metrics, err := r.Resource.Probe(warnings)
+	return concurrentProbeResult{metrics: metrics, warnings: warnings}, err
+}
+
+func (r *concurrentResource) Setup(warnings nagopher.WarningCollection) error {
+	r.group.probe()
+	return nil
+}
+
+func (r *concurrentResource) Probe(warnings nagopher.WarningCollection) ([]nagopher.Metric, error) {
+	r.group.probe()
+	warnings.Add(r.warnings.Get()...)
+
+	return r.metrics, r.err
+}
+
+// Teardown is being skipped for abandoned resources, as they may still be probing in the background
+func (r *concurrentResource) Teardown(warnings nagopher.WarningCollection) error {
+	if r.abandoned {
+		return nil
+	}
+
+	return r.Resource.Teardown(warnings)
+}
@@ -0,0 +1,102 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"strings"
+)
+
+// PartialPolicy decides how a check behaves if a resource could only collect some of its metrics, e.g. because the
+// link speed of an interface or the ARC statistics of ZFS were not available. Such failures are being reported by
+// resources using PartialFailure() instead of regular warnings.
+type PartialPolicy struct {
+	Unknown bool
+}
+
+type partialFailure struct {
+	message string
+}
+
+type partialCheck struct {
+	nagopher.Check
+	failures []string
+}
+
+// NewPartialPolicy returns the policy selected by --partial-ok or --partial-unknown. Partial results are being
+// evaluated by default, as long as UNKNOWN has not been explicitly requested.
+func NewPartialPolicy() (PartialPolicy, error) {
+	return newPartialPolicy(globals)
+}
+
+func newPartialPolicy(options globalOptions) (PartialPolicy, error) {
+	if options.partialOk && options.partialUnknown {
+		return PartialPolicy{}, fmt.Errorf("--partial-ok and --partial-unknown are mutually exclusive")
+	}
+
+	return PartialPolicy{Unknown: options.partialUnknown}, nil
+}
+
+// PartialFailure instantiates a warning for a collection sub-step which failed without affecting the remaining
+// metrics of a resource. It gets emitted like any other warning, but results in UNKNOWN with --partial-unknown.
+func PartialFailure(format string, values ...interface{}) nagopher.Warning {
+	return partialFailure{message: fmt.Sprintf(format, values...)}
+}
+
+func (w partialFailure) Warning() string {
+	return w.message
+}
+
+// Apply wraps the given check, so that it returns UNKNOWN if any partial failure has been reported during its
+// execution. The check is being returned as-is if partial results should be evaluated.
+func (p PartialPolicy) Apply(check nagopher.Check) nagopher.Check {
+	if !p.Unknown {
+		return check
+	}
+
+	return &partialCheck{Check: check}
+}
+
+func (c *partialCheck) Run(warnings nagopher.WarningCollection) {
+	c.Check.Run(warnings)
+
+	c.failures = nil
+	for _, warning := range warnings.Get() {
+		if _, ok := warning.(partialFailure); ok {
+			c.failures = append(c.failures, warning.Warning())
+		}
+	}
+}
+
+func (c *partialCheck) State() nagopher.State {
+	if len(c.failures) > 0 {
+		return nagopher.StateUnknown()
+	}
+
+	return c.Check.State()
+}
+
+func (c *partialCheck) Summary() string {
+	if len(c.failures) > 0 {
+		return "incomplete results: " + strings.Join(c.failures, ", ")
+	}
+
+	return c.Check.Summary()
+}
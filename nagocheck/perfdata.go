@@ -0,0 +1,136 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/snapserv/nagopher"
+	"regexp"
+	"strings"
+)
+
+// PerfDataLabels normalizes the labels of performance data, as dynamic metric names (e.g. pool, sensor or array
+// names) might contain characters or lengths which break parsing by Nagios or graphing addons like PNP4Nagios
+type PerfDataLabels struct {
+	MaxLength int
+}
+
+type perfDataLabelContext struct {
+	nagopher.Context
+	labels PerfDataLabels
+}
+
+// labeledPerfData replaces the label of performance data while retaining its value and thresholds
+type labeledPerfData struct {
+	nagopher.PerfData
+	metric nagopher.Metric
+}
+
+// perfDataLabelHashLength is the amount of hex characters of the hash, which gets appended to truncated labels
+const perfDataLabelHashLength = 8
+
+var illegalPerfDataLabelChars = regexp.MustCompile(`[^A-Za-z0-9_.\-]`)
+
+// unquotedPerfDataLabel matches all labels which nagopher emits without quotes
+var unquotedPerfDataLabel = regexp.MustCompile(`^\w+$`)
+
+// Sanitize replaces all characters of the given label except letters, digits, dots, dashes and underscores with an
+// underscore. Labels exceeding the maximum length get truncated and suffixed with a hash of the original label, so
+// that truncated labels stay unique and stable across executions.
+func (l PerfDataLabels) Sanitize(label string) string {
+	sanitized := illegalPerfDataLabelChars.ReplaceAllString(label, "_")
+	if l.MaxLength <= 0 || len(sanitized) <= l.MaxLength {
+		return sanitized
+	}
+
+	hash := sha1.Sum([]byte(label))
+	suffix := "_" + hex.EncodeToString(hash[:])[:perfDataLabelHashLength]
+	if l.MaxLength <= len(suffix) {
+		return suffix[1:]
+	}
+
+	return sanitized[:l.MaxLength-len(suffix)] + suffix
+}
+
+// Apply wraps all contexts of the given check, so that the labels of their performance data get sanitized
+func (l PerfDataLabels) Apply(check nagopher.Check) {
+	for _, context := range check.Contexts() {
+		check.AttachContexts(&perfDataLabelContext{Context: context, labels: l})
+	}
+}
+
+func (c *perfDataLabelContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	optionalPerfData, err := c.Context.Performance(metric, resource)
+	if err != nil {
+		// Metric names containing quotes or equal signs are rejected by nagopher, so retry with the sanitized name
+		renamedMetric, renameErr := renameMetric(metric, c.labels.Sanitize(metric.Name()))
+		if renameErr != nil || renamedMetric == metric {
+			return optionalPerfData, err
+		}
+
+		return c.Context.Performance(renamedMetric, resource)
+	}
+
+	// The label of performance data might differ from the metric name, e.g. for rates of counters
+	perfData, err := optionalPerfData.Get()
+	if err != nil || perfData == nil {
+		return optionalPerfData, nil
+	}
+
+	label := c.labels.Sanitize(perfData.Metric().Name())
+	if label == perfData.Metric().Name() {
+		return optionalPerfData, nil
+	}
+
+	renamedMetric, err := renameMetric(perfData.Metric(), label)
+	if err != nil {
+		return nagopher.OptionalPerfData{}, err
+	}
+
+	return nagopher.NewOptionalPerfData(&labeledPerfData{PerfData: perfData, metric: renamedMetric}), nil
+}
+
+func (pd *labeledPerfData) Metric() nagopher.Metric {
+	return pd.metric
+}
+
+// ToNagiosPerfData replaces the label of the original performance data, which is always followed by the first equal
+// sign as nagopher does not allow them within metric names
+func (pd *labeledPerfData) ToNagiosPerfData() string {
+	output := pd.PerfData.ToNagiosPerfData()
+	label := pd.metric.Name()
+	if !unquotedPerfDataLabel.MatchString(label) {
+		label = "'" + label + "'"
+	}
+
+	return label + output[strings.Index(output, "="):]
+}
+
+// renameMetric returns a copy of the given metric with a different name, which is only supported for numeric metrics
+// as other metrics are never emitted as performance data. All other metrics are being returned unchanged.
+func renameMetric(metric nagopher.Metric, name string) (nagopher.Metric, error) {
+	numericMetric, ok := metric.(nagopher.NumericMetric)
+	if !ok || metric.Name() == name {
+		return metric, nil
+	}
+
+	return nagopher.NewNumericMetric(name, numericMetric.Value(), metric.ValueUnit(),
+		nagopher.OptionalBoundsPtr(metric.ValueRange()), metric.ContextName())
+}
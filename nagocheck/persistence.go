@@ -0,0 +1,320 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fabiokung/shm"
+	"github.com/shirou/gopsutil/host"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PersistenceBackend loads and stores raw persistent data of resources, which is being identified by a unique key
+type PersistenceBackend interface {
+	Name() string
+	Load(key string) ([]byte, error)
+	Store(key string, data []byte) error
+}
+
+// persistenceEnvelope wraps all persisted data with the version of its layout, the boot time and a timestamp, which
+// allows detecting incompatible, outdated or stale data after upgrades and reboots
+type persistenceEnvelope struct {
+	Version   int             `json:"version"`
+	BootTime  uint64          `json:"bootTime"`
+	Timestamp int64           `json:"timestamp,omitempty"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type shmPersistenceBackend struct {
+	namespace string
+}
+
+type filePersistenceBackend struct {
+	directory string
+}
+
+// PersistenceBackendNames contains the names of all available persistence backends, which can be passed to
+// NewPersistenceBackend()
+var PersistenceBackendNames = []string{"shm", "file", "redis"}
+
+// DefaultPersistenceVersion is the version of persisted data returned by PersistenceVersion() unless being overridden
+// by a resource. Data stored by previous releases without any version is considered to be of this version.
+const DefaultPersistenceVersion = 1
+
+var persistenceOverride PersistenceBackend
+
+// NewPersistenceBackend instantiates the persistence backend with the given name using the global options
+func NewPersistenceBackend(name string) (PersistenceBackend, error) {
+	if persistenceOverride != nil {
+		return persistenceOverride, nil
+	}
+
+	switch name {
+	case "shm":
+		return NewShmPersistenceBackend(), nil
+	case "file":
+		directory := globals.persistenceDirectory
+		if directory == "" {
+			directory = StateDirectory()
+		}
+		return NewFilePersistenceBackend(directory), nil
+	case "redis":
+		return NewRedisPersistenceBackend(globals.redisAddress, globals.redisPassword, globals.redisDatabase), nil
+	}
+
+	return nil, fmt.Errorf("unknown persistence backend: %s", name)
+}
+
+// SelectedPersistenceBackend instantiates the persistence backend selected by --persistence, which allows plugins to
+// store data independently of resource persistence, e.g. if it must survive reboots
+func SelectedPersistenceBackend() (PersistenceBackend, error) {
+	return NewPersistenceBackend(globals.persistenceBackend)
+}
+
+// OverridePersistenceBackend replaces the persistence backend selected by --persistence with the given backend until
+// the returned function gets called, e.g. for running plugins against an in-memory backend within tests
+func OverridePersistenceBackend(backend PersistenceBackend) (restore func()) {
+	previous := persistenceOverride
+	persistenceOverride = backend
+
+	return func() {
+		persistenceOverride = previous
+	}
+}
+
+// LoadVersionedData loads the data stored by StoreVersionedData() with the given key and unmarshals it into the target.
+// Data of any other version is being discarded and false returned, as unmarshalling it into zero values would result
+// in bogus state. Data stored by previous releases without any version is considered to be of
+// DefaultPersistenceVersion.
+func LoadVersionedData(backend PersistenceBackend, key string, version int, target interface{}) (bool, error) {
+	defer trackPersistenceLoad()()
+
+	jsonData, err := backend.Load(key)
+	if err != nil || len(jsonData) == 0 {
+		return false, err
+	}
+
+	envelope := unmarshalPersistenceEnvelope(jsonData)
+	if envelope.Version == 0 && version == DefaultPersistenceVersion {
+		envelope.Version = DefaultPersistenceVersion
+	}
+	if envelope.Version != version {
+		NewLogger("persistence").WithField("backend", backend.Name()).WithField("key", key).
+			Debugf("discarding persistent data of version %d", envelope.Version)
+		return false, nil
+	}
+
+	if err := json.Unmarshal(envelope.Data, target); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// StoreVersionedData marshals the given source as JSON and stores it with the given key, using the same envelope
+// including the version of its layout as resource persistence
+func StoreVersionedData(backend PersistenceBackend, key string, version int, source interface{}) error {
+	defer trackPersistenceStore()()
+
+	jsonData, err := marshalPersistenceEnvelope(version, source)
+	if err != nil {
+		return err
+	}
+
+	return backend.Store(key, jsonData)
+}
+
+// marshalPersistenceEnvelope marshals the given source into an envelope with the given version, the current boot time
+// and timestamp
+func marshalPersistenceEnvelope(version int, source interface{}) ([]byte, error) {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return nil, err
+	}
+
+	bootTime, err := host.BootTime()
+	if err != nil {
+		bootTime = 0
+	}
+
+	return json.Marshal(persistenceEnvelope{
+		Version:   version,
+		BootTime:  bootTime,
+		Timestamp: time.Now().Unix(),
+		Data:      data,
+	})
+}
+
+// unmarshalPersistenceEnvelope unmarshals the given persistent data, falling back to the legacy format of previous
+// releases which only contained the plain data and is therefore returned as version 0
+func unmarshalPersistenceEnvelope(jsonData []byte) persistenceEnvelope {
+	var envelope persistenceEnvelope
+	if err := json.Unmarshal(jsonData, &envelope); err != nil || envelope.Data == nil {
+		envelope = persistenceEnvelope{Data: jsonData}
+	}
+
+	return envelope
+}
+
+// NewShmPersistenceBackend instantiates a PersistenceBackend which stores data as POSIX shared memory objects. Their
+// names are being prefixed with the namespace of the state directory, as shared memory has no directories.
+func NewShmPersistenceBackend() PersistenceBackend {
+	return &shmPersistenceBackend{
+		namespace: stateNamespace(),
+	}
+}
+
+func (b *shmPersistenceBackend) Name() string {
+	return "shm"
+}
+
+func (b *shmPersistenceBackend) Load(key string) (_ []byte, rerr error) {
+	// Attempt to open or create file using SHM
+	file, err := shm.Open(b.objectName(key), shmReadFlags, shmDefaultMode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure file is always being properly closed
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			rerr = err
+		}
+	}()
+
+	return ioutil.ReadAll(file)
+}
+
+func (b *shmPersistenceBackend) Store(key string, data []byte) (rerr error) {
+	// Attempt to open or create file using SHM
+	file, err := shm.Open(b.objectName(key), shmWriteFlags, shmDefaultMode)
+	if err != nil {
+		return err
+	}
+
+	// Ensure file is always being properly closed
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			rerr = err
+		}
+	}()
+
+	_, err = file.Write(data)
+	return err
+}
+
+// objectName returns the name of the shared memory object for the given key, e.g. '.nagocheck-u1000-load-cpu'
+func (b *shmPersistenceBackend) objectName(key string) string {
+	if b.namespace == "" {
+		return key
+	}
+
+	return ".nagocheck-" + b.namespace + "-" + strings.TrimPrefix(key, ".nagocheck-")
+}
+
+// NewFilePersistenceBackend instantiates a PersistenceBackend which stores data as plain files within a directory. All
+// accesses are guarded by advisory locks on a lock file per key, which works on all platforms including Windows.
+func NewFilePersistenceBackend(directory string) PersistenceBackend {
+	if directory == "" {
+		directory = os.TempDir()
+	}
+
+	return &filePersistenceBackend{
+		directory: directory,
+	}
+}
+
+func (b *filePersistenceBackend) Name() string {
+	return "file"
+}
+
+func (b *filePersistenceBackend) Load(key string) (data []byte, _ error) {
+	err := b.withLock(key, false, func() (err error) {
+		data, err = ioutil.ReadFile(b.path(key))
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	})
+
+	return data, err
+}
+
+func (b *filePersistenceBackend) Store(key string, data []byte) error {
+	return b.withLock(key, true, func() error {
+		// Write into temporary file first and rename afterwards, so that concurrent readers never see partial data
+		file, err := ioutil.TempFile(b.directory, ".tmp-")
+		if err != nil {
+			return err
+		}
+
+		if _, err := file.Write(data); err != nil {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+			return err
+		}
+		if err := file.Close(); err != nil {
+			_ = os.Remove(file.Name())
+			return err
+		}
+
+		return os.Rename(file.Name(), b.path(key))
+	})
+}
+
+// withLock executes the given function while holding an advisory lock on the lock file of the given key, which is
+// either shared for reading or exclusive for writing
+func (b *filePersistenceBackend) withLock(key string, exclusive bool, fn func() error) (rerr error) {
+	if err := ensureStateDirectory(b.directory); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(b.path(key)+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open lock file: %s", err.Error())
+	}
+	defer func() {
+		if err := file.Close(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	if err := lockFile(file, exclusive); err != nil {
+		return fmt.Errorf("could not acquire lock: %s", err.Error())
+	}
+	defer func() {
+		if err := unlockFile(file); err != nil && rerr == nil {
+			rerr = fmt.Errorf("could not release lock: %s", err.Error())
+		}
+	}()
+
+	return fn()
+}
+
+func (b *filePersistenceBackend) path(key string) string {
+	return filepath.Join(b.directory, strings.Replace(key, string(filepath.Separator), "_", -1))
+}
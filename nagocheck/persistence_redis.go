@@ -0,0 +1,149 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const redisTimeout = 5 * time.Second
+
+type redisPersistenceBackend struct {
+	address  string
+	password string
+	database int
+}
+
+// NewRedisPersistenceBackend instantiates a PersistenceBackend which stores data as keys within a Redis database. Only
+// the small subset of the Redis protocol required for reading and writing plain keys is being implemented. The
+// connection gets authenticated if a password has been given, while an empty password skips authentication.
+func NewRedisPersistenceBackend(address string, password string, database int) PersistenceBackend {
+	return &redisPersistenceBackend{
+		address:  address,
+		password: password,
+		database: database,
+	}
+}
+
+func (b *redisPersistenceBackend) Name() string {
+	return "redis"
+}
+
+func (b *redisPersistenceBackend) Load(key string) (data []byte, _ error) {
+	err := b.withConnection(func(rw *bufio.ReadWriter) (err error) {
+		data, err = b.execute(rw, "GET", key)
+		return err
+	})
+
+	return data, err
+}
+
+func (b *redisPersistenceBackend) Store(key string, data []byte) error {
+	return b.withConnection(func(rw *bufio.ReadWriter) error {
+		_, err := b.execute(rw, "SET", key, string(data))
+		return err
+	})
+}
+
+func (b *redisPersistenceBackend) withConnection(function func(rw *bufio.ReadWriter) error) (rerr error) {
+	conn, err := net.DialTimeout("tcp", b.address, redisTimeout)
+	if err != nil {
+		return fmt.Errorf("could not connect to redis: %s", err.Error())
+	}
+
+	// Ensure connection is always being properly closed
+	defer func() {
+		err := conn.Close()
+		if err != nil && rerr == nil {
+			rerr = err
+		}
+	}()
+
+	if err := conn.SetDeadline(time.Now().Add(redisTimeout)); err != nil {
+		return err
+	}
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	if b.password != "" {
+		if _, err := b.execute(rw, "AUTH", b.password); err != nil {
+			return err
+		}
+	}
+	if b.database != 0 {
+		if _, err := b.execute(rw, "SELECT", strconv.Itoa(b.database)); err != nil {
+			return err
+		}
+	}
+
+	return function(rw)
+}
+
+func (b *redisPersistenceBackend) execute(rw *bufio.ReadWriter, args ...string) ([]byte, error) {
+	// Send command as RESP array of bulk strings
+	if _, err := fmt.Fprintf(rw, "*%d\r\n", len(args)); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(rw, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return nil, err
+		}
+	}
+	if err := rw.Flush(); err != nil {
+		return nil, err
+	}
+
+	// Parse reply, which is either a simple string, an error or a (possibly nil) bulk string
+	line, err := rw.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("invalid redis reply: %q", line)
+	}
+
+	payload := line[1 : len(line)-2]
+	switch line[0] {
+	case '+':
+		return []byte(payload), nil
+	case '-':
+		return nil, fmt.Errorf("redis command %s failed: %s", args[0], payload)
+	case '$':
+		length, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis bulk length: %s", payload)
+		}
+		if length < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(rw, data); err != nil {
+			return nil, err
+		}
+
+		return data[:length], nil
+	}
+
+	return nil, fmt.Errorf("unsupported redis reply type: %q", line[0])
+}
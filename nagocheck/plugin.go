@@ -20,6 +20,10 @@ package nagocheck
 
 import (
 	"github.com/snapserv/nagopher"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 // Plugin represents a single check including its CLI arguments
@@ -31,11 +35,34 @@ type Plugin interface {
 	DefineCheck() nagopher.Check
 
 	VerboseOutput() bool
+	VerboseOutputPolicy() VerboseOutputPolicy
 	WarningThreshold() nagopher.OptionalBounds
 	CriticalThreshold() nagopher.OptionalBounds
+	WarningRecoverThreshold() nagopher.OptionalBounds
+	CriticalRecoverThreshold() nagopher.OptionalBounds
+	FlapWindow() int
+	FlapThreshold() int
+	ThresholdOverrides() ThresholdOverrides
+	ThresholdProfile() string
+	InstanceThresholds() InstanceThresholds
+	Expectations() Expectations
+	AveragingPolicies() AveragingPolicies
+	BaselinePolicies() BaselinePolicies
+	SummaryTemplate() string
+	MetricFilter() MetricFilter
+	AggregationPolicy() AggregationPolicy
+	CapacityContexts() []string
+	CapacityReport() CapacityReport
+	History() *History
+	Logger() Logger
 
 	setModule(module Module)
+	setModuleNode(node KingpinNode)
+	kingpinNodes() []KingpinNode
 	defineDefaultFlags(node KingpinNode)
+	invocationTags() map[string]string
+	deferPersistence(context persistentContext)
+	storeDeferredPersistence()
 }
 
 // PluginOpt is a type alias for functional options used by NewPlugin()
@@ -45,13 +72,37 @@ type basePlugin struct {
 	name                 string
 	description          string
 	module               Module
+	moduleNode           KingpinNode
+	node                 KingpinNode
 	useDefaultFlags      bool
 	useDefaultThresholds bool
+	durationThresholds   bool
+	hysteresis           bool
+	flapDetection        bool
 	forceVerboseOutput   bool
 
-	verboseOutput     bool
-	warningThreshold  nagopher.OptionalBounds
-	criticalThreshold nagopher.OptionalBounds
+	verboseOutput      bool
+	verbosePolicy      VerboseOutputPolicy
+	warningThreshold   nagopher.OptionalBounds
+	criticalThreshold  nagopher.OptionalBounds
+	warningRecover     nagopher.OptionalBounds
+	criticalRecover    nagopher.OptionalBounds
+	flapWindow         int
+	flapThreshold      int
+	thresholdOverrides ThresholdOverrides
+	thresholdProfile   string
+	instanceThresholds InstanceThresholds
+	expectations       Expectations
+	averagingPolicies  AveragingPolicies
+	baselinePolicies   BaselinePolicies
+	summaryTemplate    string
+	metricFilter       MetricFilter
+	aggregationPolicy  AggregationPolicy
+	capacityContexts   []string
+	capacityReport     CapacityReport
+	historyEnabled     bool
+	history            *History
+	deferredContexts   []persistentContext
 }
 
 // NewPlugin instantiates basePlugin with the given functional options
@@ -62,6 +113,7 @@ func NewPlugin(name string, options ...PluginOpt) Plugin {
 		useDefaultFlags:      true,
 		useDefaultThresholds: true,
 		forceVerboseOutput:   false,
+		verbosePolicy:        VerboseOutputPolicy{Group: true},
 	}
 
 	for _, option := range options {
@@ -85,6 +137,14 @@ func PluginForceVerbose(enabled bool) PluginOpt {
 	}
 }
 
+// PluginVerboseOutput is a functional option for NewPlugin(), which sets the default verbose output policy of a plugin.
+// It can still be changed using the respective flags, as long as the default flags are being defined.
+func PluginVerboseOutput(policy VerboseOutputPolicy) PluginOpt {
+	return func(p *basePlugin) {
+		p.verbosePolicy = policy
+	}
+}
+
 // PluginDefaultFlags is a functional option for NewPlugin(), which toggles the definition of default flags
 func PluginDefaultFlags(enabled bool) PluginOpt {
 	return func(p *basePlugin) {
@@ -99,20 +159,143 @@ func PluginDefaultThresholds(enabled bool) PluginOpt {
 	}
 }
 
+// PluginDurationThresholds is a functional option for NewPlugin(), which toggles parsing the default thresholds as
+// ranges of durations like '15m:' or '7d:' instead of seconds
+func PluginDurationThresholds(enabled bool) PluginOpt {
+	return func(p *basePlugin) {
+		p.durationThresholds = enabled
+	}
+}
+
+// PluginHysteresis is a functional option for NewPlugin(), which toggles the definition of --warning-recover and
+// --critical-recover. It must be enabled by plugins using NewHysteresisContext(), as the flags would be ignored otherwise.
+func PluginHysteresis(enabled bool) PluginOpt {
+	return func(p *basePlugin) {
+		p.hysteresis = enabled
+	}
+}
+
+// PluginFlapDetection is a functional option for NewPlugin(), which toggles the definition of --flap-window and
+// --flap-threshold. It must be enabled by plugins using NewFlapDetectionContext(), as the flags would be ignored
+// otherwise.
+func PluginFlapDetection(enabled bool) PluginOpt {
+	return func(p *basePlugin) {
+		p.flapDetection = enabled
+	}
+}
+
+// defaultFlagNames contains all flags defined by nagocheck itself, which only control the evaluation of a plugin
+var defaultFlagNames = []string{"help", "verbose", "verbose-sort", "verbose-group", "verbose-lines", "threshold",
+	"threshold-profile", "instance-threshold", "expect", "average", "baseline", "summary-template", "include-metric",
+	"exclude-metric", "aggregate", "flap-window", "flap-threshold", "warning", "critical", "warning-recover",
+	"critical-recover", "report", "report-window"}
+
 func (p *basePlugin) defineDefaultFlags(node KingpinNode) {
+	p.node = node
+
+	boundsVar, boundsHint := NagopherBoundsVar, ""
+	if p.durationThresholds {
+		boundsVar, boundsHint = DurationBoundsVar, " Values are durations like 15m or 7d, seconds by default."
+	}
+
 	if p.useDefaultFlags {
 		if !p.verboseOutput {
 			node.Flag("verbose", "Enable verbose plugin output.").
 				Short('v').BoolVar(&p.verboseOutput)
 		}
+
+		node.Flag("verbose-sort", "Sort the lines of the verbose output by state, section and message.").
+			Default(strconv.FormatBool(p.verbosePolicy.Sort)).BoolVar(&p.verbosePolicy.Sort)
+		node.Flag("verbose-group", "Group the lines of the verbose output per instance under a titled header.").
+			Default(strconv.FormatBool(p.verbosePolicy.Group)).BoolVar(&p.verbosePolicy.Group)
+		node.Flag("verbose-lines", "Maximum amount of lines within the verbose output, followed by the amount of "+
+			"omitted lines. Unlimited when set to zero.").
+			Default(strconv.Itoa(p.verbosePolicy.MaxLines)).IntVar(&p.verbosePolicy.MaxLines)
+
+		ThresholdOverridesVar(node.Flag("threshold", "Overrides the thresholds of a specific context, formatted as "+
+			"<context>=warn:<range>:crit:<range> using Nagios range specifiers. Can be specified multiple times."),
+			&p.thresholdOverrides)
+
+		node.Flag("threshold-profile", "Applies the threshold overrides of the given profile declared within the "+
+			"config file given by --config. Overrides given by --threshold take precedence.").
+			StringVar(&p.thresholdProfile)
+
+		InstanceThresholdsVar(node.Flag("instance-threshold", "Thresholds for a single instance of plugins emitting "+
+			"one metric per instance (e.g. temperature sensors), formatted as <metric>=w:<range>,c:<range> using Nagios "+
+			"range specifiers. Can be specified multiple times and takes precedence over --threshold."),
+			&p.instanceThresholds)
+
+		ExpectationsVar(node.Flag("expect", "Expects a metric to have one of the given values, formatted as "+
+			"<metric>=<value>[,<value>...], e.g. cpu_count=4. Returns CRITICAL on mismatch instead of evaluating its "+
+			"regular thresholds. Can be specified multiple times."),
+			&p.expectations)
+
+		AveragingPoliciesVar(node.Flag("average", "Evaluates the thresholds of a specific context against the mean or "+
+			"median of the last samples instead of the current value, formatted as [<context>=]<mean|median>:<samples>, "+
+			"e.g. to reduce flapping of noisy metrics. Applies to all contexts except counters if the context is "+
+			"omitted. Can be specified multiple times."),
+			&p.averagingPolicies)
+
+		BaselinePoliciesVar(node.Flag("baseline", "Learns the mean and standard deviation of a specific context "+
+			"during a learning window and alerts on values deviating by more than the given amount of standard "+
+			"deviations afterwards, formatted as "+
+			"[<context>=]w:<sigma>,c:<sigma>[,learn:<duration>][,relearn:<duration>], e.g. for traffic rates or "+
+			"latencies without static thresholds. The learning window defaults to 7d. Values deviating for longer "+
+			"than the relearn duration (defaults to 1d, disabled by 0) are considered a lasting change and restart "+
+			"learning. Applies to all contexts except counters if the context is omitted. Can be specified multiple "+
+			"times."),
+			&p.baselinePolicies)
+
+		node.Flag("summary-template", "Go text/template for rendering the check summary. Available fields are "+
+			".Hostname, .Module, .Plugin, .State, .Summary as well as .Metrics and .Values indexed by metric name.").
+			StringVar(&p.summaryTemplate)
+
+		node.Flag("include-metric", "Only evaluate metrics whose name matches the given regular expression. Can be "+
+			"specified multiple times.").
+			RegexpListVar(&p.metricFilter.Include)
+		node.Flag("exclude-metric", "Do not evaluate metrics whose name matches the given regular expression. Can "+
+			"be specified multiple times and takes precedence over --include-metric.").
+			RegexpListVar(&p.metricFilter.Exclude)
+
+		AggregationPolicyVar(node.Flag("aggregate", "Aggregation policy for checks evaluating multiple items, "+
+			"formatted as <mode>:<limit>. Supported modes are max-non-ok (at most N items not OK), min-ok (at least "+
+			"N items OK) and min-ok-percent (at least N percent of items OK). Defaults to the worst state of all items."),
+			&p.aggregationPolicy)
+
+		if p.flapDetection {
+			node.Flag("flap-window", "Amount of previous runs which are being considered for flap detection.").
+				Default("10").IntVar(&p.flapWindow)
+			node.Flag("flap-threshold", "Return at least WARNING when a metric supporting flap detection changed "+
+				"its state this many times within the flap window. Flap detection is disabled when set to zero.").
+				Default("0").IntVar(&p.flapThreshold)
+		}
+
+		if len(p.capacityContexts) > 0 {
+			node.Flag("report", "Print an informational capacity report with the current value, trend and predicted "+
+				"exhaustion of each capacity metric instead of evaluating thresholds, e.g. for a weekly service. "+
+				"Trends are based on the history recorded by regular executions with the same arguments.").
+				BoolVar(&p.capacityReport.Enabled)
+			DurationVar(node.Flag("report-window", "Time span of the history being used for computing trends "+
+				"within the capacity report.").
+				Default("30d"), &p.capacityReport.Window)
+		}
 	}
 
 	if p.useDefaultThresholds {
-		NagopherBoundsVar(node.Flag("warning", "Warning threshold formatted as Nagios range specifier.").
+		boundsVar(node.Flag("warning", "Warning threshold formatted as Nagios range specifier."+boundsHint).
 			Short('w'), &p.warningThreshold)
-		NagopherBoundsVar(node.Flag("critical", "Critical threshold formatted as Nagios range specifier.").
+		boundsVar(node.Flag("critical", "Critical threshold formatted as Nagios range specifier."+boundsHint).
 			Short('c'), &p.criticalThreshold)
 	}
+
+	if p.hysteresis {
+		boundsVar(node.Flag("warning-recover", "Recovery threshold formatted as Nagios range specifier, "+
+			"which must be met before a metric in WARNING state returns to OK (e.g. 70 for --warning 80)."+boundsHint),
+			&p.warningRecover)
+		boundsVar(node.Flag("critical-recover", "Recovery threshold formatted as Nagios range specifier, "+
+			"which must be met before a metric in CRITICAL state returns to a lower state."+boundsHint),
+			&p.criticalRecover)
+	}
 }
 
 func (p *basePlugin) Name() string {
@@ -131,6 +314,15 @@ func (p *basePlugin) setModule(module Module) {
 	p.module = module
 }
 
+func (p *basePlugin) setModuleNode(node KingpinNode) {
+	p.moduleNode = node
+}
+
+// kingpinNodes returns the kingpin nodes of the module and plugin, which contain the flags of the current invocation
+func (p *basePlugin) kingpinNodes() []KingpinNode {
+	return []KingpinNode{p.moduleNode, p.node}
+}
+
 func (p *basePlugin) VerboseOutput() bool {
 	if p.forceVerboseOutput {
 		return true
@@ -139,6 +331,10 @@ func (p *basePlugin) VerboseOutput() bool {
 	return p.verboseOutput
 }
 
+func (p *basePlugin) VerboseOutputPolicy() VerboseOutputPolicy {
+	return p.verbosePolicy
+}
+
 func (p *basePlugin) WarningThreshold() nagopher.OptionalBounds {
 	return p.warningThreshold
 }
@@ -147,8 +343,154 @@ func (p *basePlugin) CriticalThreshold() nagopher.OptionalBounds {
 	return p.criticalThreshold
 }
 
+func (p *basePlugin) WarningRecoverThreshold() nagopher.OptionalBounds {
+	return p.warningRecover
+}
+
+func (p *basePlugin) CriticalRecoverThreshold() nagopher.OptionalBounds {
+	return p.criticalRecover
+}
+
+func (p *basePlugin) FlapWindow() int {
+	return p.flapWindow
+}
+
+func (p *basePlugin) FlapThreshold() int {
+	return p.flapThreshold
+}
+
+func (p *basePlugin) ThresholdOverrides() ThresholdOverrides {
+	return p.thresholdOverrides
+}
+
+func (p *basePlugin) ThresholdProfile() string {
+	return p.thresholdProfile
+}
+
+func (p *basePlugin) InstanceThresholds() InstanceThresholds {
+	return p.instanceThresholds
+}
+
+func (p *basePlugin) Expectations() Expectations {
+	return p.expectations
+}
+
+func (p *basePlugin) AveragingPolicies() AveragingPolicies {
+	return p.averagingPolicies
+}
+
+func (p *basePlugin) BaselinePolicies() BaselinePolicies {
+	return p.baselinePolicies
+}
+
+func (p *basePlugin) SummaryTemplate() string {
+	return p.summaryTemplate
+}
+
+func (p *basePlugin) MetricFilter() MetricFilter {
+	return p.metricFilter
+}
+
+func (p *basePlugin) AggregationPolicy() AggregationPolicy {
+	return p.aggregationPolicy
+}
+
+func (p *basePlugin) CapacityContexts() []string {
+	return p.capacityContexts
+}
+
+func (p *basePlugin) CapacityReport() CapacityReport {
+	return p.capacityReport
+}
+
+// History returns the history of the plugin invocation, which is nil unless the plugin opted in using PluginHistory()
+func (p *basePlugin) History() *History {
+	if !p.historyEnabled {
+		return nil
+	}
+	if p.history == nil {
+		p.history = newHistory(p)
+	}
+
+	return p.history
+}
+
+// deferPersistence remembers that the data of the given context has changed, so that it gets stored once by
+// storeDeferredPersistence() after all metrics have been evaluated instead of once per metric
+func (p *basePlugin) deferPersistence(context persistentContext) {
+	for _, deferredContext := range p.deferredContexts {
+		if deferredContext == context {
+			return
+		}
+	}
+
+	p.deferredContexts = append(p.deferredContexts, context)
+}
+
+// storeDeferredPersistence stores the data of all contexts passed to deferPersistence() since the last call
+func (p *basePlugin) storeDeferredPersistence() {
+	for _, context := range p.deferredContexts {
+		context.storePersistentData()
+	}
+
+	p.deferredContexts = nil
+}
+
+func (p *basePlugin) Logger() Logger {
+	return NewLogger(p.name)
+}
+
 func (p *basePlugin) DefineFlags(node KingpinNode) {}
 
 func (p *basePlugin) DefineCheck() nagopher.Check {
 	return nagopher.NewCheck(p.name, NewSummarizer(p))
 }
+
+// invocationTags returns all arguments as well as all module- and plugin-specific flags of the current invocation,
+// which have a value that differs from their default. They identify what a plugin has been probing, e.g. the host
+// and the name of an interface. Flags containing credentials are skipped, as the tags get passed to sinks.
+func (p *basePlugin) invocationTags() map[string]string {
+	tags := make(map[string]string)
+
+	if module, ok := p.moduleNode.(*kingpin.CmdClause); ok {
+		addFlagTags(tags, module.Model().Flags)
+	}
+
+	command, ok := p.node.(*kingpin.CmdClause)
+	if !ok {
+		return tags
+	}
+	model := command.Model()
+
+	for _, arg := range model.Args {
+		if value := arg.Value.String(); value != "" && value != strings.Join(arg.Default, ",") {
+			tags[arg.Name] = value
+		}
+	}
+
+	addFlagTags(tags, model.Flags)
+	return tags
+}
+
+// secretFlagPattern matches the names of flags containing credentials, e.g. --password or --v3-auth-password
+var secretFlagPattern = regexp.MustCompile(`password|secret|token|community|key`)
+
+func addFlagTags(tags map[string]string, flags []*kingpin.FlagModel) {
+	for _, flag := range flags {
+		isDefaultFlag := false
+		for _, name := range defaultFlagNames {
+			isDefaultFlag = isDefaultFlag || flag.Name == name
+		}
+
+		value := flag.Value.String()
+		if isDefaultFlag || secretFlagPattern.MatchString(flag.Name) {
+			continue
+		} else if value == "" || value == strings.Join(flag.Default, ",") {
+			continue
+		} else if flag.IsBoolFlag() && value == "false" {
+			continue
+		}
+
+		tags[flag.Name] = value
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"os"
+	"strings"
+)
+
+// ThresholdProfiles maps the names of threshold profiles to their threshold overrides, which allows sharing a set of
+// thresholds between many invocations using --threshold-profile instead of repeating --threshold for each of them
+type ThresholdProfiles map[string]ThresholdOverrides
+
+// LoadConfigFile parses the config file at the given path, which currently declares threshold profiles only. Every
+// line which is neither empty nor a comment starting with '#' must be formatted as 'profile <name> <override>...',
+// where every override is formatted like the value of --threshold.
+func LoadConfigFile(path string) (ThresholdProfiles, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open config file: %s", err.Error())
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	profiles := make(ThresholdProfiles)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if err := profiles.parseConfigLine(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("invalid config file [%s] at line %d: %s", path, lineNumber, err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read config file: %s", err.Error())
+	}
+
+	return profiles, nil
+}
+
+// parseConfigLine parses a single line of the config file and adds the declared threshold profile
+func (p ThresholdProfiles) parseConfigLine(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	fields, err := SplitCommandLine(line)
+	if err != nil {
+		return err
+	}
+	if fields[0] != "profile" {
+		return fmt.Errorf("unknown directive [%s], expected 'profile <name> <override>...'", fields[0])
+	}
+	if len(fields) < 3 {
+		return fmt.Errorf("profile must be formatted as 'profile <name> <override>...'")
+	}
+
+	name := fields[1]
+	if _, ok := p[name]; ok {
+		return fmt.Errorf("duplicate threshold profile [%s]", name)
+	}
+
+	overrides := make(ThresholdOverrides)
+	for _, field := range fields[2:] {
+		contextName, override, err := ParseThresholdOverride(field)
+		if err != nil {
+			return err
+		}
+		overrides[contextName] = override
+	}
+	p[name] = overrides
+
+	return nil
+}
+
+// resolveThresholdOverrides returns the threshold overrides of the given plugin, merged with the threshold profile
+// selected by --threshold-profile from the config file given within the options. As profiles are usually shared by
+// several plugins, overrides of the profile referring to contexts unknown to the given check are being skipped, while
+// overrides given by --threshold take precedence over the ones of the profile.
+func resolveThresholdOverrides(options globalOptions, plugin Plugin, check nagopher.Check) (ThresholdOverrides, error) {
+	profileName := plugin.ThresholdProfile()
+	if profileName == "" {
+		return plugin.ThresholdOverrides(), nil
+	}
+	if options.configFile == "" {
+		return nil, fmt.Errorf("--threshold-profile requires a config file given by --config")
+	}
+
+	profiles, err := LoadConfigFile(options.configFile)
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := profiles[profileName]
+	if !ok {
+		return nil, fmt.Errorf("unknown threshold profile [%s]", profileName)
+	}
+
+	overrides := make(ThresholdOverrides)
+	for _, context := range check.Contexts() {
+		if override, ok := profile[context.Name()]; ok {
+			overrides[context.Name()] = override
+		}
+	}
+	for contextName, override := range plugin.ThresholdOverrides() {
+		overrides[contextName] = override
+	}
+
+	return overrides, nil
+}
@@ -21,16 +21,29 @@ package nagocheck
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/fabiokung/shm"
+	"github.com/shirou/gopsutil/host"
 	"github.com/snapserv/nagopher"
-	"io/ioutil"
 	"strings"
+	"time"
 )
 
-// Resource provides a base type for nagocheck resources, which embeds nagopher.Resource
+// Resource provides a base type for nagocheck resources, which embeds nagopher.Resource. Resources using persistence
+// must increase PersistenceVersion() whenever the layout of their persisted data changes and may override
+// MigratePersistentData() for converting data of previous versions, which is being discarded by default.
 type Resource interface {
 	nagopher.Resource
 	Plugin() Plugin
+	Name() string
+	Rebooted() bool
+	Stale() bool
+	DataAge() time.Duration
+	Section(title string, metrics ...nagopher.Metric) []nagopher.Metric
+	SectionOf(metric nagopher.Metric) string
+	PersistenceVersion() int
+	MigratePersistentData(version int, data json.RawMessage) (json.RawMessage, error)
+
+	deferWarning(warning nagopher.Warning)
+	markSampled()
 }
 
 // ResourceOpt is a type alias for functional options used by NewSummarizer()
@@ -39,16 +52,30 @@ type ResourceOpt func(*baseResource)
 type baseResource struct {
 	nagopher.Resource `json:"-"`
 	plugin            Plugin
+	name              string
+	sections          map[string]string
+	deferredWarnings  []nagopher.Warning
 
 	persistenceKey   string
+	persistenceOwner Resource
 	persistenceStore interface{}
+	durable          bool
+	sampled          bool
+	rebooted         bool
+	stale            bool
+	dataAge          time.Duration
 }
 
+// bootTimeTolerance is the maximum difference in seconds between two boot times considered as the same boot, as the
+// boot time is derived from the current time and uptime and might therefore vary slightly between executions
+const bootTimeTolerance = 5
+
 // NewResource instantiates baseResource with the given functional options
 func NewResource(plugin Plugin, options ...ResourceOpt) Resource {
 	resource := &baseResource{
 		Resource: nagopher.NewResource(),
 		plugin:   plugin,
+		sections: make(map[string]string),
 	}
 
 	for _, option := range options {
@@ -58,15 +85,35 @@ func NewResource(plugin Plugin, options ...ResourceOpt) Resource {
 	return resource
 }
 
-// ResourcePersistence is a functional option for NewResource(), which enables resource persistence with the given key
-func ResourcePersistence(uniqueKey string, dataStore interface{}) ResourceOpt {
+// ResourceName is a functional option for NewResource(), which sets the resource name. It is being used as the
+// default section title for all metrics of this resource within the long output.
+func ResourceName(name string) ResourceOpt {
+	return func(r *baseResource) {
+		r.name = name
+	}
+}
+
+// ResourcePersistence is a functional option for NewResource(), which enables resource persistence with the given key.
+// The owner is the resource embedding the base resource, whose PersistenceVersion() and MigratePersistentData() get
+// used for versioning the persisted data store.
+func ResourcePersistence(uniqueKey string, owner Resource, dataStore interface{}) ResourceOpt {
 	return func(r *baseResource) {
 		r.persistenceKey = strings.ToLower(".nagocheck-" + r.Plugin().Name() + "-" + uniqueKey)
+		r.persistenceOwner = owner
 		r.persistenceStore = dataStore
 	}
 }
 
-func (r baseResource) Setup(warnings nagopher.WarningCollection) error {
+// ResourceDurablePersistence is a functional option for NewResource(), which keeps persistent data across reboots and
+// regardless of --max-data-age. This suits data remaining valid over time like file offsets, which must be verified by
+// the resource itself.
+func ResourceDurablePersistence() ResourceOpt {
+	return func(r *baseResource) {
+		r.durable = true
+	}
+}
+
+func (r *baseResource) Setup(warnings nagopher.WarningCollection) error {
 	if err := r.loadPersistentData(); err != nil {
 		return fmt.Errorf("unable to load persistent data: %s", err.Error())
 	}
@@ -75,6 +122,8 @@ func (r baseResource) Setup(warnings nagopher.WarningCollection) error {
 }
 
 func (r baseResource) Teardown(warnings nagopher.WarningCollection) error {
+	warnings.Add(r.deferredWarnings...)
+
 	if err := r.storePersistentData(); err != nil {
 		return fmt.Errorf("unable to store persistent data: %s", err.Error())
 	}
@@ -82,76 +131,187 @@ func (r baseResource) Teardown(warnings nagopher.WarningCollection) error {
 	return nil
 }
 
-func (r *baseResource) loadPersistentData() (rerr error) {
-	// Skip persistence if identifier or store is missing
-	if r.persistenceKey == "" {
+func (r *baseResource) loadPersistentData() error {
+	// Skip persistence if identifier or store is missing or previous values have been sampled in-process
+	if r.persistenceKey == "" || (r.sampled && !r.durable) {
 		return nil
 	}
 
-	// Attempt to open or create file using SHM
-	file, err := shm.Open(r.persistenceKey, shmReadFlags, shmDefaultMode)
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
+	if err != nil {
+		return err
+	}
+	defer trackPersistenceLoad()()
+
+	// Attempt to read contents from backend
+	logger := NewLogger("persistence").WithField("backend", backend.Name()).WithField("key", r.persistenceKey)
+	jsonData, err := backend.Load(r.persistenceKey)
 	if err != nil {
 		return err
 	}
+	logger.Debugf("loaded %d bytes of persistent data", len(jsonData))
 
-	// Ensure file is always being properly closed
-	defer func() {
-		err := file.Close()
+	if len(jsonData) == 0 {
+		return nil
+	}
+
+	// Migrate persistent data stored with a different layout, discarding it if not possible instead of unmarshalling it
+	// into zero values, which would result in bogus deltas
+	envelope := unmarshalPersistenceEnvelope(jsonData)
+	owner := r.owner()
+	if currentVersion := owner.PersistenceVersion(); envelope.Version != currentVersion {
+		if envelope.Version > currentVersion {
+			logger.Debugf("discarding persistent data of newer version %d", envelope.Version)
+			return nil
+		}
+
+		data, err := owner.MigratePersistentData(envelope.Version, envelope.Data)
 		if err != nil {
-			rerr = err
+			logger.Debugf("discarding persistent data of version %d: %s", envelope.Version, err.Error())
+			return nil
 		}
-	}()
+		logger.Debugf("migrated persistent data from version %d to %d", envelope.Version, currentVersion)
+		envelope.Data = data
+	}
 
-	// Attempt to read contents from file
-	jsonData, err := ioutil.ReadAll(file)
-	if err != nil {
-		return err
+	// Discard persistent data from before the last system boot, as counters have most likely been reset since then
+	if envelope.BootTime != 0 && !r.durable {
+		bootTime, err := host.BootTime()
+		if err == nil && !sameBootTime(bootTime, envelope.BootTime) {
+			logger.Debugf("discarding persistent data from before reboot")
+			r.rebooted = true
+			return nil
+		}
 	}
 
-	// Attempt to unmarshal contents as JSON into target
-	if len(jsonData) > 0 {
-		if err := json.Unmarshal(jsonData, r.persistenceStore); err != nil {
-			return err
+	// Discard persistent data exceeding the maximum age, as deltas against ancient values are meaningless. Data stored
+	// by previous versions has no timestamp and is therefore always being used.
+	if envelope.Timestamp != 0 {
+		r.dataAge = time.Since(time.Unix(envelope.Timestamp, 0))
+		if globals.maxDataAge > 0 && r.dataAge > globals.maxDataAge && !r.durable {
+			logger.Debugf("discarding persistent data which is %s old", DurationString(r.dataAge))
+			r.stale = true
+			return nil
 		}
 	}
 
-	return nil
+	// Attempt to unmarshal contents as JSON into target
+	return json.Unmarshal(envelope.Data, r.persistenceStore)
 }
 
-func (r baseResource) storePersistentData() (rerr error) {
-	// Skip persistence if identifier or store is missing
-	if r.persistenceKey == "" {
+func (r baseResource) storePersistentData() error {
+	// Skip persistence if identifier or store is missing or previous values have been sampled in-process
+	if r.persistenceKey == "" || (r.sampled && !r.durable) {
 		return nil
 	}
 
-	// Attempt to marshal source into JSON
-	jsonData, err := json.Marshal(r.persistenceStore)
+	backend, err := NewPersistenceBackend(globals.persistenceBackend)
 	if err != nil {
 		return err
 	}
+	defer trackPersistenceStore()()
 
-	// Attempt to open or create file using SHM
-	file, err := shm.Open(r.persistenceKey, shmWriteFlags, shmDefaultMode)
+	// Attempt to marshal source into JSON, including the current boot time and timestamp to detect reboots and staleness
+	jsonData, err := marshalPersistenceEnvelope(r.owner().PersistenceVersion(), r.persistenceStore)
 	if err != nil {
 		return err
 	}
 
-	// Ensure file is always being properly closed
-	defer func() {
-		err := file.Close()
-		if err != nil {
-			rerr = err
-		}
-	}()
+	// Attempt to write JSON data into backend
+	logger := NewLogger("persistence").WithField("backend", backend.Name()).WithField("key", r.persistenceKey)
+	logger.Debugf("storing %d bytes of persistent data", len(jsonData))
+	return backend.Store(r.persistenceKey, jsonData)
+}
 
-	// Attempt to write JSON data into file
-	if _, err := file.Write(jsonData); err != nil {
-		return err
+// PersistenceVersion returns the version of the layout of the persisted data of this resource
+func (r *baseResource) PersistenceVersion() int {
+	return DefaultPersistenceVersion
+}
+
+// MigratePersistentData converts persisted data of the given previous version into the current layout. Only data
+// stored by previous releases without any version is being accepted as-is, as it matches DefaultPersistenceVersion.
+func (r *baseResource) MigratePersistentData(version int, data json.RawMessage) (json.RawMessage, error) {
+	if version == 0 && r.owner().PersistenceVersion() == DefaultPersistenceVersion {
+		return data, nil
 	}
 
-	return nil
+	return nil, fmt.Errorf("no migration from version %d available", version)
+}
+
+// owner returns the resource passed to ResourcePersistence(), which may override PersistenceVersion() and
+// MigratePersistentData(), or this base resource if persistence has not been enabled
+func (r *baseResource) owner() Resource {
+	if r.persistenceOwner != nil {
+		return r.persistenceOwner
+	}
+
+	return r
 }
 
 func (r *baseResource) Plugin() Plugin {
 	return r.plugin
 }
+
+func (r *baseResource) Name() string {
+	return r.name
+}
+
+// deferWarning remembers a warning raised while evaluating the metrics of this resource, e.g. by a context, which gets
+// added to the warnings of the check during teardown as contexts have no access to them
+func (r *baseResource) deferWarning(warning nagopher.Warning) {
+	r.deferredWarnings = append(r.deferredWarnings, warning)
+}
+
+// markSampled remembers that previous values of this resource have been sampled in-process by --sample-interval,
+// so that the evaluation neither replaces them with persistent data nor reports the outcome of loading it
+func (r *baseResource) markSampled() {
+	r.sampled = true
+	r.rebooted = false
+	r.stale = false
+	r.dataAge = 0
+}
+
+// Section assigns the given metrics to a titled section within the long output, which is useful for resources
+// containing several logical entities like arrays or pools. The metrics are returned as-is for easier chaining.
+func (r *baseResource) Section(title string, metrics ...nagopher.Metric) []nagopher.Metric {
+	for _, metric := range metrics {
+		r.sections[metric.Name()] = title
+	}
+
+	return metrics
+}
+
+// SectionOf returns the title of the section the given metric belongs to, falling back to the resource name
+func (r *baseResource) SectionOf(metric nagopher.Metric) string {
+	if title, ok := r.sections[metric.Name()]; ok {
+		return title
+	}
+
+	return r.name
+}
+
+// Rebooted returns true if the system has been rebooted since the persistent data of this resource has been stored,
+// in which case the persistent data has been discarded.
+func (r *baseResource) Rebooted() bool {
+	return r.rebooted
+}
+
+// Stale returns true if the persistent data of this resource has been older than --max-data-age, in which case the
+// persistent data has been discarded.
+func (r *baseResource) Stale() bool {
+	return r.stale
+}
+
+// DataAge returns the age of the persistent data of this resource, which is zero if no data was available or it has
+// been stored without a timestamp by a previous version.
+func (r *baseResource) DataAge() time.Duration {
+	return r.dataAge
+}
+
+func sameBootTime(a, b uint64) bool {
+	if a > b {
+		return a-b <= bootTimeTolerance
+	}
+
+	return b-a <= bootTimeTolerance
+}
@@ -28,3 +28,7 @@ const shmOpenFlags = os.O_CREATE
 const shmReadFlags = shmOpenFlags | os.O_RDONLY
 const shmWriteFlags = shmOpenFlags | os.O_WRONLY | os.O_TRUNC
 const shmDefaultMode = 0600
+
+// defaultPersistenceBackend is the persistence backend used unless --persistence is given. POSIX shared memory is not
+// available on all platforms (e.g. Windows), so plain files are used instead.
+const defaultPersistenceBackend = "file"
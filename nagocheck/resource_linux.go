@@ -27,3 +27,6 @@ const shmOpenFlags = os.O_CREATE | syscall.O_DSYNC | syscall.O_RSYNC
 const shmReadFlags = shmOpenFlags | os.O_RDONLY
 const shmWriteFlags = shmOpenFlags | os.O_WRONLY | os.O_TRUNC
 const shmDefaultMode = 0600
+
+// defaultPersistenceBackend is the persistence backend used unless --persistence is given
+const defaultPersistenceBackend = "shm"
@@ -0,0 +1,132 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"github.com/snapserv/nagopher"
+	"sync"
+	"time"
+)
+
+// contextSampler is implemented by contexts which compare a metric against its previous value, e.g. deltas and rates,
+// so that the previous value can be taken from a sample collected within the same execution
+type contextSampler interface {
+	sample(metric nagopher.NumericMetric)
+}
+
+// resourceSampling probes all resources of a check once before the actual execution when --sample-interval is set,
+// which allows computing deltas and rates in-process without depending on persistent data of previous executions
+type resourceSampling struct {
+	interval time.Duration
+	samplers map[string]contextSampler
+}
+
+// newResourceSampling collects all contexts of the check supporting in-process sampling. It must be called before any
+// context gets wrapped, as wrappers do not expose the sampling support of the wrapped context.
+func newResourceSampling(check nagopher.Check, interval time.Duration) *resourceSampling {
+	sampling := &resourceSampling{
+		interval: interval,
+		samplers: make(map[string]contextSampler),
+	}
+
+	for _, context := range check.Contexts() {
+		if sampler, ok := samplerOf(context); ok {
+			sampling.samplers[context.Name()] = sampler
+		}
+	}
+
+	return sampling
+}
+
+// samplerOf returns the given context as contextSampler, which might also be wrapped by a hysteresis context, so that
+// e.g. rates keep supporting in-process sampling when being combined with recovery thresholds
+func samplerOf(context nagopher.Context) (contextSampler, bool) {
+	if hysteresisContext, ok := context.(*hysteresisContext); ok {
+		if parentContext, ok := hysteresisContext.Context.(*baseContext); ok {
+			context = parentContext.Context
+		}
+	}
+
+	sampler, ok := context.(contextSampler)
+	return sampler, ok
+}
+
+// Sample probes all resources of the given check, passes the collected values to the respective contexts as previous
+// values and waits for the sample interval, so that the regular execution afterwards evaluates the second sample.
+// Failures are only being logged, as the regular execution reports them anyway.
+func (s *resourceSampling) Sample(check nagopher.Check, logger Logger) {
+	if s.interval <= 0 {
+		return
+	}
+	if len(s.samplers) == 0 {
+		logger.Debugf("skipping first sample, as the plugin has no delta or rate contexts")
+		return
+	}
+
+	finishSampling := logger.WithField("interval", s.interval).Timed("first sample")
+	warnings := nagopher.NewWarningCollection()
+	for _, resource := range check.Resources() {
+		var metrics []nagopher.Metric
+		var err error
+
+		if concurrentResource, ok := resource.(*concurrentResource); ok {
+			concurrentResource.group.probe()
+			metrics, err = concurrentResource.metrics, concurrentResource.err
+			concurrentResource.group.reset()
+		} else if err = resource.Setup(warnings); err == nil {
+			metrics, err = resource.Probe(warnings)
+		}
+
+		if err != nil {
+			logger.Debugf("could not collect first sample: %s", err.Error())
+			continue
+		}
+
+		sampled := false
+		for _, metric := range metrics {
+			numericMetric, ok := metric.(nagopher.NumericMetric)
+			if sampler, exists := s.samplers[metric.ContextName()]; ok && exists {
+				sampler.sample(numericMetric)
+				sampled = true
+			}
+		}
+
+		// Only resources with sampled metrics skip persistence, as all others still depend on their persistent data
+		if nagocheckResource, ok := resource.(Resource); ok && sampled {
+			nagocheckResource.markSampled()
+		}
+	}
+	finishSampling()
+
+	time.Sleep(s.interval)
+}
+
+// reset discards the results of a concurrent resource group, so that it gets probed again
+func (g *resourceGroup) reset() {
+	g.once = sync.Once{}
+}
+
+func (c *deltaContext) sample(metric nagopher.NumericMetric) {
+	if c.previousValue != nil {
+		*c.previousValue = metric.Value()
+	}
+}
+
+func (c *rateContext) sample(metric nagopher.NumericMetric) {
+	c.update(metric, time.Now())
+}
@@ -0,0 +1,303 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+type scaffoldTool struct {
+	moduleName  string
+	pluginName  string
+	description string
+	directory   string
+}
+
+// scaffoldNames contains the identifiers used within the templates of the scaffolding tool
+type scaffoldNames struct {
+	Package     string
+	ModuleName  string
+	Module      string
+	ModuleType  string
+	PluginName  string
+	Plugin      string
+	PluginType  string
+	Description string
+}
+
+var scaffoldNamePattern = regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`)
+
+const scaffoldHeader = `/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+`
+
+var scaffoldModuleTemplate = template.Must(template.New("module").Parse(scaffoldHeader + `package {{.Package}}
+
+import (
+	"github.com/snapserv/nagocheck/nagocheck"
+)
+
+type {{.Module}}Module struct {
+	nagocheck.Module
+}
+
+// New{{.ModuleType}}Module instantiates {{.Module}}Module and all contained plugins
+func New{{.ModuleType}}Module() nagocheck.Module {
+	return &{{.Module}}Module{
+		Module: nagocheck.NewModule("{{.ModuleName}}",
+			nagocheck.ModuleDescription("{{.ModuleType}}"),
+			nagocheck.ModulePlugin(new{{.PluginType}}Plugin()),
+		),
+	}
+}
+`))
+
+var scaffoldPluginTemplate = template.Must(template.New("plugin").Parse(scaffoldHeader + `package {{.Package}}
+
+import (
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck"
+	"github.com/snapserv/nagopher"
+	"math"
+)
+
+type {{.Plugin}}Plugin struct {
+	nagocheck.Plugin
+}
+
+type {{.Plugin}}Resource struct {
+	nagocheck.Resource
+
+	value float64
+}
+
+type {{.Plugin}}Summarizer struct {
+	nagocheck.Summarizer
+}
+
+func new{{.PluginType}}Plugin() *{{.Plugin}}Plugin {
+	return &{{.Plugin}}Plugin{
+		Plugin: nagocheck.NewPlugin("{{.PluginName}}",
+			nagocheck.PluginDescription({{printf "%q" .Description}}),
+			nagocheck.PluginHysteresis(true),
+		),
+	}
+}
+
+func (p *{{.Plugin}}Plugin) DefineFlags(node nagocheck.KingpinNode) {
+	// TODO: Define the flags and arguments of the plugin, e.g. node.Flag(...).StringVar(&p.Field)
+}
+
+func (p *{{.Plugin}}Plugin) DefineCheck() nagopher.Check {
+	check := nagopher.NewCheck("{{.PluginName}}", new{{.PluginType}}Summarizer(p))
+	check.AttachResources(new{{.PluginType}}Resource(p))
+	check.AttachContexts(
+		nagocheck.NewHysteresisContext(p, nagopher.NewScalarContext(
+			"value",
+			nagopher.OptionalBoundsPtr(p.WarningThreshold()),
+			nagopher.OptionalBoundsPtr(p.CriticalThreshold()),
+		)),
+	)
+
+	return check
+}
+
+func new{{.PluginType}}Resource(plugin *{{.Plugin}}Plugin) *{{.Plugin}}Resource {
+	return &{{.Plugin}}Resource{
+		Resource: nagocheck.NewResource(plugin),
+	}
+}
+
+func (r *{{.Plugin}}Resource) Probe(warnings nagopher.WarningCollection) (metrics []nagopher.Metric, _ error) {
+	valueRange := nagopher.NewBounds(nagopher.LowerBound(0), nagopher.UpperBound(math.Inf(1)))
+
+	if err := r.Collect(); err != nil {
+		return metrics, err
+	}
+
+	metrics = append(metrics,
+		nagopher.MustNewNumericMetric("value", r.value, "", &valueRange, ""),
+	)
+
+	return metrics, nil
+}
+
+func (r *{{.Plugin}}Resource) Collect() error {
+	// TODO: Collect the data of the monitored system and store it within the resource
+	return fmt.Errorf("not implemented yet")
+}
+
+func (r *{{.Plugin}}Resource) ThisPlugin() *{{.Plugin}}Plugin {
+	return r.Resource.Plugin().(*{{.Plugin}}Plugin)
+}
+
+func new{{.PluginType}}Summarizer(plugin *{{.Plugin}}Plugin) *{{.Plugin}}Summarizer {
+	return &{{.Plugin}}Summarizer{
+		Summarizer: nagocheck.NewSummarizer(plugin,
+			nagocheck.SummarizerListProblems(nagocheck.DefaultProblemListLength),
+		),
+	}
+}
+
+func (s *{{.Plugin}}Summarizer) Ok(check nagopher.Check) string {
+	value := check.Results().GetNumericMetricValue("value").OrElse(math.NaN())
+	return fmt.Sprintf("value is %.2f", value)
+}
+`))
+
+// NewScaffoldTool instantiates a Tool, which creates the skeleton of a new plugin consisting of plugin, resource and
+// summarizer within the source tree, including the module if it does not exist yet
+func NewScaffoldTool() Tool {
+	return &scaffoldTool{}
+}
+
+func (t *scaffoldTool) Name() string {
+	return "new-plugin"
+}
+
+func (t *scaffoldTool) DefineCommand(app *kingpin.Application) {
+	node := app.Command(t.Name(), "Create the skeleton of a new plugin within the nagocheck source tree.")
+
+	node.Arg("module", "Name of the module containing the plugin, which gets created if it does not exist yet.").
+		Required().StringVar(&t.moduleName)
+
+	node.Arg("plugin", "Name of the new plugin, e.g. disk-usage.").
+		Required().StringVar(&t.pluginName)
+
+	node.Flag("description", "Short description of the plugin as shown within the usage.").
+		Short('d').StringVar(&t.description)
+
+	node.Flag("directory", "Root directory of the nagocheck source tree.").
+		Short('C').Default(".").ExistingDirVar(&t.directory)
+}
+
+func (t *scaffoldTool) Execute(modules map[string]Module) error {
+	for _, name := range []string{t.moduleName, t.pluginName} {
+		if !scaffoldNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid name [%s]: must only contain lower-case letters, digits and dashes", name)
+		}
+	}
+
+	if module, ok := modules[t.moduleName]; ok {
+		if _, err := module.GetPluginByName(t.pluginName); err == nil {
+			return fmt.Errorf("plugin already exists: %s %s", t.moduleName, t.pluginName)
+		}
+	}
+
+	names := newScaffoldNames(t.moduleName, t.pluginName, t.description)
+	moduleDirectory := filepath.Join(t.directory, "mod-"+t.moduleName)
+	pluginFile := filepath.Join(moduleDirectory, strings.Replace(t.pluginName, "-", "_", -1)+".go")
+	if _, err := os.Stat(pluginFile); err == nil {
+		return fmt.Errorf("plugin file already exists: %s", pluginFile)
+	}
+
+	initFile := filepath.Join(moduleDirectory, "init.go")
+	_, err := os.Stat(initFile)
+	createModule := os.IsNotExist(err)
+	if createModule {
+		if err := os.MkdirAll(moduleDirectory, 0755); err != nil {
+			return fmt.Errorf("could not create module directory: %s", err.Error())
+		}
+		if err := writeScaffoldFile(initFile, scaffoldModuleTemplate, names); err != nil {
+			return err
+		}
+		fmt.Printf("created %s\n", initFile)
+	}
+
+	if err := writeScaffoldFile(pluginFile, scaffoldPluginTemplate, names); err != nil {
+		return err
+	}
+	fmt.Printf("created %s\n", pluginFile)
+
+	if createModule {
+		fmt.Printf("register the module within main.go: %s.New%sModule()\n", names.Package, names.ModuleType)
+	} else {
+		fmt.Printf("register the plugin within %s: nagocheck.ModulePlugin(new%sPlugin())\n",
+			initFile, names.PluginType)
+	}
+
+	return nil
+}
+
+func newScaffoldNames(moduleName string, pluginName string, description string) scaffoldNames {
+	if description == "" {
+		description = scaffoldIdentifier(pluginName, true)
+	}
+
+	return scaffoldNames{
+		Package:     "mod" + strings.Replace(moduleName, "-", "", -1),
+		ModuleName:  moduleName,
+		Module:      scaffoldIdentifier(moduleName, false),
+		ModuleType:  scaffoldIdentifier(moduleName, true),
+		PluginName:  pluginName,
+		Plugin:      scaffoldIdentifier(pluginName, false),
+		PluginType:  scaffoldIdentifier(pluginName, true),
+		Description: description,
+	}
+}
+
+// scaffoldIdentifier converts a dashed name like 'disk-usage' into a Go identifier like 'diskUsage' or 'DiskUsage'
+func scaffoldIdentifier(name string, exported bool) string {
+	parts := strings.Split(name, "-")
+	for index, part := range parts {
+		if index > 0 || exported {
+			parts[index] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+
+	return strings.Join(parts, "")
+}
+
+func writeScaffoldFile(path string, tmpl *template.Template, names scaffoldNames) error {
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, names); err != nil {
+		return fmt.Errorf("could not render %s: %s", filepath.Base(path), err.Error())
+	}
+
+	source, err := format.Source(buffer.Bytes())
+	if err != nil {
+		return fmt.Errorf("could not format %s: %s", filepath.Base(path), err.Error())
+	}
+
+	return ioutil.WriteFile(path, source, 0644)
+}
@@ -0,0 +1,105 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pluginLimiter restricts the amount of concurrent invocations of the same plugin, which protects shared backends
+// like vtysh or databases from being hammered when many invocations are being executed at once
+type pluginLimiter struct {
+	sync.Mutex
+
+	limit int
+	slots map[string]chan struct{}
+}
+
+var splayRandom = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+func newPluginLimiter(limit int) *pluginLimiter {
+	return &pluginLimiter{
+		limit: limit,
+		slots: make(map[string]chan struct{}),
+	}
+}
+
+// acquire blocks until a slot for the given plugin is available and returns a function for releasing it again. No
+// limit is being enforced when the limit is zero or the plugin is unknown.
+func (l *pluginLimiter) acquire(plugin string) (release func()) {
+	if l.limit < 1 || plugin == "" {
+		return func() {}
+	}
+
+	l.Lock()
+	slots, ok := l.slots[plugin]
+	if !ok {
+		slots = make(chan struct{}, l.limit)
+		l.slots[plugin] = slots
+	}
+	l.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// invocationPlugin determines the module and plugin of the given plugin invocation, e.g. "system load" for
+// "--debug system load -w 2", by looking for the first argument matching a module followed by one of its plugins
+func invocationPlugin(modules map[string]Module, invocation string) string {
+	args, err := SplitCommandLine(invocation)
+	if err != nil {
+		return ""
+	}
+
+	for index, arg := range args {
+		module, ok := modules[arg]
+		if !ok {
+			continue
+		}
+
+		for _, pluginArg := range args[index+1:] {
+			if strings.HasPrefix(pluginArg, "-") {
+				continue
+			}
+			if _, err := module.GetPluginByName(pluginArg); err == nil {
+				return module.Name() + " " + pluginArg
+			}
+		}
+	}
+
+	return ""
+}
+
+// randomDelay returns a random duration between zero and the given maximum, which is used for spreading executions
+func randomDelay(maximum time.Duration) time.Duration {
+	if maximum <= 0 {
+		return 0
+	}
+
+	splayRandom.Lock()
+	defer splayRandom.Unlock()
+
+	return time.Duration(splayRandom.Int63n(int64(maximum)))
+}
@@ -0,0 +1,142 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"github.com/snapserv/nagopher"
+	"strings"
+	"sync"
+	"time"
+)
+
+// executionStats collects timings and events of the current plugin execution, which are being emitted as performance
+// data with --self-metrics
+type executionStats struct {
+	sync.Mutex
+
+	persistenceLoad  time.Duration
+	persistenceStore time.Duration
+	timeouts         int
+}
+
+type selfMetricsCheck struct {
+	nagopher.Check
+
+	startTime time.Time
+	perfData  []nagopher.PerfData
+}
+
+var selfStats = &executionStats{}
+
+// timeoutMessages contains fragments of the error messages returned by the standard library and nagocheck itself when
+// an operation timed out, which are being searched for within warnings and the summary of a check
+var timeoutMessages = []string{"timed out", "i/o timeout", "deadline exceeded", "Timeout exceeded"}
+
+// trackPersistenceLoad returns a function, which adds the time elapsed since calling trackPersistenceLoad to the total
+// time spent loading persistent data
+func trackPersistenceLoad() func() {
+	startTime := time.Now()
+	return func() {
+		selfStats.Lock()
+		selfStats.persistenceLoad += time.Since(startTime)
+		selfStats.Unlock()
+	}
+}
+
+// trackPersistenceStore is the counterpart of trackPersistenceLoad for storing persistent data
+func trackPersistenceStore() func() {
+	startTime := time.Now()
+	return func() {
+		selfStats.Lock()
+		selfStats.persistenceStore += time.Since(startTime)
+		selfStats.Unlock()
+	}
+}
+
+// recordTimeout counts an operation which has been aborted due to a timeout, e.g. an external command
+func recordTimeout() {
+	selfStats.Lock()
+	selfStats.timeouts++
+	selfStats.Unlock()
+}
+
+// ApplySelfMetrics wraps the given check if --self-metrics has been specified, so that performance data about the
+// execution itself gets appended after running the check. The probe duration is measured starting with this call.
+func ApplySelfMetrics(check nagopher.Check) nagopher.Check {
+	if !globals.selfMetrics {
+		return check
+	}
+
+	selfStats.Lock()
+	selfStats.persistenceLoad, selfStats.persistenceStore, selfStats.timeouts = 0, 0, 0
+	selfStats.Unlock()
+
+	return &selfMetricsCheck{Check: check, startTime: time.Now()}
+}
+
+func (c *selfMetricsCheck) Run(warnings nagopher.WarningCollection) {
+	c.Check.Run(warnings)
+	probeTime := time.Since(c.startTime)
+
+	timedOut := false
+	for _, message := range append(warnings.GetWarningStrings(), c.Check.Summary()) {
+		timedOut = timedOut || isTimeoutMessage(message)
+	}
+
+	selfStats.Lock()
+	defer selfStats.Unlock()
+	if selfStats.timeouts > 0 {
+		timedOut = true
+	}
+
+	c.perfData = nil
+	c.addPerfData("nagocheck_probe_time", probeTime.Seconds(), "s")
+	c.addPerfData("nagocheck_warnings", float64(len(warnings.Get())), "")
+	c.addPerfData("nagocheck_persistence_load_time", selfStats.persistenceLoad.Seconds(), "s")
+	c.addPerfData("nagocheck_persistence_store_time", selfStats.persistenceStore.Seconds(), "s")
+	c.addPerfData("nagocheck_timeout", boolToFloat(timedOut), "")
+}
+
+func (c *selfMetricsCheck) PerfData() []nagopher.PerfData {
+	return append(append([]nagopher.PerfData{}, c.Check.PerfData()...), c.perfData...)
+}
+
+func (c *selfMetricsCheck) addPerfData(name string, value float64, unit string) {
+	perfData, err := nagopher.NewNumericPerfData(name, value, unit, nil, nil, nil)
+	if err == nil {
+		c.perfData = append(c.perfData, perfData)
+	}
+}
+
+func isTimeoutMessage(message string) bool {
+	for _, fragment := range timeoutMessages {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,390 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// selfUpdateMaxDownloadSize limits the size of all downloaded files, as they are being kept in memory
+const selfUpdateMaxDownloadSize = 256 << 20
+
+const selfUpdateChecksumFile = "checksums.txt"
+const selfUpdateSignatureFile = "checksums.txt.sig"
+
+type selfUpdateTool struct {
+	currentVersion string
+
+	url       string
+	publicKey string
+	platform  string
+	timeout   time.Duration
+	force     bool
+	checkOnly bool
+}
+
+// selfUpdateRelease describes the release artifact for the current platform, as found in the checksum file
+type selfUpdateRelease struct {
+	version  string
+	archive  string
+	checksum []byte
+}
+
+// NewSelfUpdateTool instantiates a Tool, which replaces the running binary with the latest release for the current
+// platform. The checksum file of the release must be signed using the ed25519 key matching the given public key, which
+// is usually being embedded during compilation and can be overridden using --public-key.
+func NewSelfUpdateTool(currentVersion string, publicKey string) Tool {
+	return &selfUpdateTool{
+		currentVersion: currentVersion,
+		publicKey:      publicKey,
+	}
+}
+
+func (t *selfUpdateTool) Name() string {
+	return "self-update"
+}
+
+func (t *selfUpdateTool) DefineCommand(app *kingpin.Application) {
+	node := app.Command(t.Name(), "Replace this binary with the latest release for the current platform. The "+
+		"release directory must contain the archives, "+selfUpdateChecksumFile+" in sha256sum format and "+
+		selfUpdateSignatureFile+" containing the base64-encoded ed25519 signature of the checksum file.")
+
+	node.Flag("url", "Base URL of the release directory, e.g. "+
+		"https://github.com/snapserv/nagocheck/releases/latest/download.").
+		Envar("NAGOCHECK_UPDATE_URL").Required().StringVar(&t.url)
+
+	publicKeyFlag := node.Flag("public-key", "Base64-encoded ed25519 public key used for verifying the signature "+
+		"of the checksum file.").Envar("NAGOCHECK_UPDATE_PUBLIC_KEY")
+	if t.publicKey != "" {
+		publicKeyFlag.Default(t.publicKey)
+	}
+	publicKeyFlag.StringVar(&t.publicKey)
+
+	node.Flag("platform", "Platform of the release archive formatted as <os>_<arch>, e.g. linux_armv7.").
+		Default(selfUpdatePlatform()).StringVar(&t.platform)
+
+	node.Flag("timeout", "Timeout for each download.").
+		Default("60s").DurationVar(&t.timeout)
+
+	node.Flag("force", "Install the latest release even if its version matches or is older than the running "+
+		"version, or if the running version is unknown.").
+		BoolVar(&t.force)
+
+	node.Flag("check", "Only check for a newer release without installing it.").
+		BoolVar(&t.checkOnly)
+}
+
+func (t *selfUpdateTool) Execute(modules map[string]Module) error {
+	publicKey, err := base64.StdEncoding.DecodeString(t.publicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("a valid ed25519 public key is required for verifying releases, either embedded at build " +
+			"time or given using --public-key")
+	}
+
+	checksums, err := t.download(selfUpdateChecksumFile)
+	if err != nil {
+		return err
+	}
+	encodedSignature, err := t.download(selfUpdateSignatureFile)
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedSignature)))
+	if err != nil {
+		return fmt.Errorf("could not decode signature: %s", err.Error())
+	}
+	if !ed25519.Verify(publicKey, checksums, signature) {
+		return fmt.Errorf("signature verification of %s failed", selfUpdateChecksumFile)
+	}
+
+	release, err := findSelfUpdateRelease(checksums, t.platform)
+	if err != nil {
+		return err
+	}
+
+	comparison, err := compareVersions(release.version, t.currentVersion)
+	if err != nil && !t.force {
+		return fmt.Errorf("could not compare release %s with running version: %s", release.version, err.Error())
+	} else if comparison == 0 && !t.force {
+		fmt.Printf("nagocheck is up to date (version %s)\n", t.currentVersion)
+		return nil
+	} else if comparison < 0 && !t.force {
+		if t.checkOnly {
+			fmt.Printf("nagocheck is up to date (running version %s is newer than release %s)\n",
+				t.currentVersion, release.version)
+			return nil
+		}
+		return fmt.Errorf("refusing to downgrade from version %s to %s without --force", t.currentVersion,
+			release.version)
+	} else if t.checkOnly {
+		fmt.Printf("nagocheck %s is available (running version %s)\n", release.version, t.currentVersion)
+		return nil
+	}
+
+	archive, err := t.download(release.archive)
+	if err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(archive)
+	if !bytes.Equal(checksum[:], release.checksum) {
+		return fmt.Errorf("checksum verification of %s failed", release.archive)
+	}
+
+	binary, err := extractSelfUpdateBinary(archive)
+	if err != nil {
+		return fmt.Errorf("could not extract %s: %s", release.archive, err.Error())
+	}
+
+	if err := replaceExecutable(binary); err != nil {
+		return err
+	}
+
+	fmt.Printf("nagocheck has been updated from version %s to %s\n", t.currentVersion, release.version)
+	return nil
+}
+
+func (t *selfUpdateTool) download(name string) ([]byte, error) {
+	url := strings.TrimRight(t.url, "/") + "/" + name
+	logger := NewLogger("self-update").WithField("url", url)
+	defer logger.Timed("download")()
+
+	client := &http.Client{Timeout: t.timeout}
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("could not download %s: %s", name, err.Error())
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not download %s: unexpected status %s", name, response.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(response.Body, selfUpdateMaxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not download %s: %s", name, err.Error())
+	} else if len(data) > selfUpdateMaxDownloadSize {
+		return nil, fmt.Errorf("could not download %s: exceeds maximum size", name)
+	}
+
+	logger.Debugf("downloaded %d bytes", len(data))
+	return data, nil
+}
+
+// compareVersions compares two semantic versions like 1.2.3 or v1.3.0-rc1, returning a negative number if the first
+// one is older, zero if both are equal and a positive number if the first one is newer. Pre-releases are older than
+// the respective release and compared lexically among each other.
+func compareVersions(a, b string) (int, error) {
+	parse := func(version string) (numbers []int, preRelease string, err error) {
+		version = strings.SplitN(strings.TrimPrefix(version, "v"), "+", 2)[0]
+		parts := strings.SplitN(version, "-", 2)
+		if len(parts) == 2 {
+			preRelease = parts[1]
+		}
+
+		for _, field := range strings.Split(parts[0], ".") {
+			number, err := strconv.Atoi(field)
+			if err != nil || number < 0 {
+				return nil, "", fmt.Errorf("invalid version: %s", version)
+			}
+			numbers = append(numbers, number)
+		}
+
+		return numbers, preRelease, nil
+	}
+
+	aNumbers, aPreRelease, err := parse(a)
+	if err != nil {
+		return 0, err
+	}
+	bNumbers, bPreRelease, err := parse(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for index := 0; index < len(aNumbers) || index < len(bNumbers); index++ {
+		var aNumber, bNumber int
+		if index < len(aNumbers) {
+			aNumber = aNumbers[index]
+		}
+		if index < len(bNumbers) {
+			bNumber = bNumbers[index]
+		}
+
+		if aNumber != bNumber {
+			return aNumber - bNumber, nil
+		}
+	}
+
+	switch {
+	case aPreRelease == bPreRelease:
+		return 0, nil
+	case aPreRelease == "":
+		return 1, nil
+	case bPreRelease == "":
+		return -1, nil
+	}
+
+	return strings.Compare(aPreRelease, bPreRelease), nil
+}
+
+// findSelfUpdateRelease looks up the archive for the given platform within the checksum file, which is named
+// 'nagocheck_<version>_<platform>.tar.gz' by goreleaser
+func findSelfUpdateRelease(checksums []byte, platform string) (selfUpdateRelease, error) {
+	suffix := "_" + platform + ".tar.gz"
+
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "nagocheck_") || !strings.HasSuffix(fields[1], suffix) {
+			continue
+		}
+
+		checksum, err := hex.DecodeString(fields[0])
+		if err != nil || len(checksum) != sha256.Size {
+			return selfUpdateRelease{}, fmt.Errorf("invalid checksum of %s", fields[1])
+		}
+
+		return selfUpdateRelease{
+			version:  strings.TrimSuffix(strings.TrimPrefix(fields[1], "nagocheck_"), suffix),
+			archive:  fields[1],
+			checksum: checksum,
+		}, nil
+	}
+
+	return selfUpdateRelease{}, fmt.Errorf("no release found for platform %s", platform)
+}
+
+// extractSelfUpdateBinary returns the nagocheck binary contained by the given release archive
+func extractSelfUpdateBinary(archive []byte) ([]byte, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+
+	binaryName := "nagocheck"
+	if runtime.GOOS == "windows" {
+		binaryName += ".exe"
+	}
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("archive does not contain %s", binaryName)
+		} else if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag == tar.TypeReg && filepath.Base(header.Name) == binaryName {
+			return ioutil.ReadAll(io.LimitReader(tarReader, selfUpdateMaxDownloadSize))
+		}
+	}
+}
+
+// replaceExecutable atomically replaces the running executable with the given binary, after ensuring that the new
+// binary can actually be executed on this system. Windows does not allow replacing a running executable, which is
+// why it gets renamed out of the way first.
+func replaceExecutable(binary []byte) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not determine executable path: %s", err.Error())
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return fmt.Errorf("could not resolve executable path: %s", err.Error())
+	}
+
+	fileInfo, err := os.Stat(executable)
+	if err != nil {
+		return fmt.Errorf("could not stat executable: %s", err.Error())
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(executable), ".nagocheck-update-")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file: %s", err.Error())
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(binary); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not write temporary file: %s", err.Error())
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("could not write temporary file: %s", err.Error())
+	}
+	if err := os.Chmod(file.Name(), fileInfo.Mode().Perm()); err != nil {
+		return fmt.Errorf("could not change permissions of temporary file: %s", err.Error())
+	}
+
+	if output, err := ExecuteCommand(10*time.Second, []string{file.Name(), "--version"}); err != nil {
+		return fmt.Errorf("new binary is not executable: %s (%s)", err.Error(), strings.TrimSpace(output))
+	}
+
+	if runtime.GOOS == "windows" {
+		oldExecutable := executable + ".old"
+		_ = os.Remove(oldExecutable)
+		if err := os.Rename(executable, oldExecutable); err != nil {
+			return fmt.Errorf("could not move executable out of the way: %s", err.Error())
+		}
+	}
+
+	if err := os.Rename(file.Name(), executable); err != nil {
+		return fmt.Errorf("could not replace executable: %s", err.Error())
+	}
+
+	return nil
+}
+
+// selfUpdatePlatform returns the platform of the running binary as used within the archive names of goreleaser,
+// including the ARM version the binary has been built for
+func selfUpdatePlatform() string {
+	platform := runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOARCH != "arm" {
+		return platform
+	}
+
+	armVersion := "6"
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			if setting.Key == "GOARM" && setting.Value != "" {
+				armVersion = strings.TrimSuffix(strings.TrimSuffix(setting.Value, ",softfloat"), ",hardfloat")
+			}
+		}
+	}
+
+	return platform + "v" + armVersion
+}
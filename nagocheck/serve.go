@@ -0,0 +1,257 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type serveTool struct {
+	file          string
+	listenAddress string
+	timeout       time.Duration
+	splay         time.Duration
+	jitter        time.Duration
+	pluginLimit   int
+
+	executable string
+	checks     []*scheduledCheck
+	limiter    *pluginLimiter
+}
+
+type scheduledCheck struct {
+	sync.RWMutex
+
+	invocation string
+	plugin     string
+	interval   time.Duration
+	executions uint64
+	lastResult invocationResult
+	lastRun    time.Time
+}
+
+type scheduledCheckStatus struct {
+	Invocation    string  `json:"invocation"`
+	Interval      string  `json:"interval"`
+	Executions    uint64  `json:"executions"`
+	LastExecution string  `json:"last_execution,omitempty"`
+	Duration      float64 `json:"duration_seconds"`
+	ExitCode      int     `json:"exit_code"`
+	State         string  `json:"state"`
+	Output        string  `json:"output"`
+}
+
+// NewServeTool instantiates a Tool, which runs as a daemon and periodically executes scheduled plugin invocations.
+// Their results are kept in memory and exposed via HTTP, alongside health and readiness endpoints for the daemon.
+func NewServeTool() Tool {
+	return &serveTool{}
+}
+
+func (t *serveTool) Name() string {
+	return "serve"
+}
+
+func (t *serveTool) DefineCommand(app *kingpin.Application) {
+	node := app.Command(t.Name(), "Run as daemon and execute scheduled plugin invocations periodically.")
+
+	node.Flag("file", "Read scheduled plugin invocations from the given file, one per line formatted as "+
+		"'<interval> <invocation>', e.g. '60s system load -w 2'. Empty lines and lines starting with # are ignored.").
+		Short('f').Required().ExistingFileVar(&t.file)
+
+	node.Flag("listen", "Address on which the HTTP server for health and check status endpoints listens.").
+		Short('l').Default("127.0.0.1:9810").StringVar(&t.listenAddress)
+
+	node.Flag("timeout", "Timeout for each plugin invocation.").
+		Short('t').Default("60s").DurationVar(&t.timeout)
+
+	node.Flag("splay", "Delay the first execution of each check by a random duration up to the given value, so that "+
+		"checks with the same interval are spread instead of running at the same second.").
+		Default("0s").DurationVar(&t.splay)
+
+	node.Flag("jitter", "Delay each execution by an additional random duration up to the given value.").
+		Default("0s").DurationVar(&t.jitter)
+
+	node.Flag("plugin-parallel", "Maximum amount of executions of the same plugin running at the same time, "+
+		"0 for no limit.").
+		Default("0").IntVar(&t.pluginLimit)
+}
+
+func (t *serveTool) Execute(modules map[string]Module) error {
+	checks, err := t.loadSchedule()
+	if err != nil {
+		return err
+	}
+	if len(checks) == 0 {
+		return fmt.Errorf("no scheduled plugin invocations given")
+	}
+	t.checks = checks
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not determine path of executable: %s", err.Error())
+	}
+	t.executable = executable
+	t.limiter = newPluginLimiter(t.pluginLimit)
+
+	for _, check := range t.checks {
+		check.plugin = invocationPlugin(modules, check.invocation)
+		go t.schedule(check)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", t.handleHealth)
+	mux.HandleFunc("/readyz", t.handleReady)
+	mux.HandleFunc("/checks", t.handleChecks)
+	mux.HandleFunc("/info", handleBuildInfo(modules))
+	mux.HandleFunc("/metrics", handleBuildInfo(modules))
+
+	NewLogger(t.Name()).WithField("address", t.listenAddress).Debugf("starting http server")
+	return http.ListenAndServe(t.listenAddress, mux)
+}
+
+func (t *serveTool) loadSchedule() ([]*scheduledCheck, error) {
+	file, err := os.Open(t.file)
+	if err != nil {
+		return nil, fmt.Errorf("could not open schedule file: %s", err.Error())
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var checks []*scheduledCheck
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		check, err := parseScheduleEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+
+	return checks, scanner.Err()
+}
+
+// parseScheduleEntry parses a single line of the schedule file formatted as '<interval> <invocation>'
+func parseScheduleEntry(line string) (*scheduledCheck, error) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid schedule entry, expected '<interval> <invocation>': %s", line)
+	}
+
+	interval, err := time.ParseDuration(parts[0])
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid interval in schedule entry: %s", line)
+	}
+
+	return &scheduledCheck{
+		invocation: strings.TrimSpace(parts[1]),
+		interval:   interval,
+	}, nil
+}
+
+func (t *serveTool) schedule(check *scheduledCheck) {
+	logger := NewLogger(t.Name()).WithField("invocation", check.invocation)
+	time.Sleep(randomDelay(t.splay))
+
+	ticker := time.NewTicker(check.interval)
+	defer ticker.Stop()
+
+	for {
+		time.Sleep(randomDelay(t.jitter))
+		release := t.limiter.acquire(check.plugin)
+
+		startTime := time.Now()
+		result := executeInvocation(t.executable, check.invocation, t.timeout)
+		logger.WithField("exitCode", result.exitCode).Debugf("scheduled execution finished")
+		release()
+
+		check.Lock()
+		check.executions++
+		check.lastRun = startTime
+		check.lastResult = result
+		check.Unlock()
+
+		<-ticker.C
+	}
+}
+
+func (t *serveTool) handleHealth(writer http.ResponseWriter, request *http.Request) {
+	writer.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintln(writer, "ok")
+}
+
+func (t *serveTool) handleReady(writer http.ResponseWriter, request *http.Request) {
+	pending := 0
+	for _, check := range t.checks {
+		check.RLock()
+		if check.executions == 0 {
+			pending++
+		}
+		check.RUnlock()
+	}
+
+	if pending > 0 {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintf(writer, "waiting for first execution of %d checks\n", pending)
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintln(writer, "ok")
+}
+
+func (t *serveTool) handleChecks(writer http.ResponseWriter, request *http.Request) {
+	statuses := make([]scheduledCheckStatus, 0, len(t.checks))
+	for _, check := range t.checks {
+		check.RLock()
+		status := scheduledCheckStatus{
+			Invocation: check.invocation,
+			Interval:   check.interval.String(),
+			Executions: check.executions,
+			Duration:   check.lastResult.duration.Seconds(),
+			ExitCode:   check.lastResult.exitCode,
+			State:      exitCodeDescription(check.lastResult.exitCode),
+			Output:     strings.TrimSpace(check.lastResult.output),
+		}
+		if check.executions > 0 {
+			status.LastExecution = check.lastRun.Format(time.RFC3339)
+		} else {
+			status.State = "pending"
+		}
+		check.RUnlock()
+
+		statuses = append(statuses, status)
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(writer).Encode(statuses)
+}
@@ -0,0 +1,178 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sink receives the result of a plugin execution and emits it somewhere, e.g. as Nagios output on stdout or as a
+// passive check result to a remote monitoring system. Multiple sinks can be attached to a single execution.
+type Sink interface {
+	Name() string
+	Emit(result SinkResult) error
+}
+
+// SinkResult contains all information of a plugin execution which are required by sinks
+type SinkResult struct {
+	Host        string
+	Service     string
+	Module      string
+	Plugin      string
+	CheckSource string
+	Timestamp   time.Time
+	Tags        map[string]string
+
+	ExitCode  int
+	State     string
+	RawOutput string
+	Output    string
+	PerfData  []nagopher.PerfData
+}
+
+type nagiosSink struct{}
+
+// SinkNames contains the names of all sinks which can be selected using --sink
+var SinkNames = []string{"nagios", "json", "spool", "influx"}
+
+// NewSinkResult builds a SinkResult out of an executed check and its result. The host defaults to the hostname of the
+// local system, while the service name defaults to '<module>-<plugin>'.
+func NewSinkResult(module Module, plugin Plugin, check nagopher.Check, result nagopher.CheckResult) SinkResult {
+	// Strip performance data from status line, as it gets emitted separately
+	lines := strings.SplitN(result.Output(), "\n", 2)
+	lines[0] = strings.SplitN(lines[0], " | ", 2)[0]
+
+	var perfData []nagopher.PerfData
+	if check.State() != nagopher.StateUnknown() {
+		perfData = check.PerfData()
+	}
+
+	sinkResult := newBaseSinkResult(module, plugin)
+	sinkResult.ExitCode = int(result.ExitCode())
+	sinkResult.State = check.State().Description()
+	sinkResult.RawOutput = result.Output()
+	sinkResult.Output = strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	sinkResult.PerfData = perfData
+
+	return sinkResult
+}
+
+func newBaseSinkResult(module Module, plugin Plugin) SinkResult {
+	hostname, _ := os.Hostname()
+	host := globals.submitHost
+	if host == "" {
+		host = hostname
+	}
+
+	service := globals.submitService
+	if service == "" {
+		service = module.Name() + "-" + plugin.Name()
+	}
+
+	return SinkResult{
+		Host:        host,
+		Service:     service,
+		Module:      module.Name(),
+		Plugin:      plugin.Name(),
+		CheckSource: hostname,
+		Timestamp:   time.Now(),
+		Tags:        plugin.invocationTags(),
+	}
+}
+
+// PerfDataStrings returns the performance data of the result formatted according to the Nagios plugin specs
+func (r SinkResult) PerfDataStrings() []string {
+	values := make([]string, len(r.PerfData))
+	for key, value := range r.PerfData {
+		values[key] = value.ToNagiosPerfData()
+	}
+
+	return values
+}
+
+// NewSinks instantiates all sinks which have been selected by global flags. The nagios sink gets used by default,
+// unless other sinks have been explicitly selected using --sink or the result gets submitted using --submit-nsca.
+func NewSinks() ([]Sink, error) {
+	var sinks []Sink
+
+	sinkNames := globals.sinks
+	if len(sinkNames) == 0 && globals.nscaAddress == "" {
+		sinkNames = []string{"nagios"}
+	}
+
+	for _, sinkName := range sinkNames {
+		sink, err := NewSink(sinkName)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if globals.icinga2URL != "" {
+		sinks = append(sinks, NewIcinga2Sink(globals.icinga2URL, globals.icinga2Token,
+			globals.icinga2Insecure, globals.submitTimeout))
+	}
+	if globals.nscaAddress != "" {
+		sinks = append(sinks, NewNscaSink(globals.nscaAddress, globals.nscaIdentity, globals.nscaPassword,
+			globals.submitTimeout))
+	}
+	if globals.pushgatewayURL != "" {
+		sinks = append(sinks, NewPushgatewaySink(globals.pushgatewayURL, globals.pushgatewayJob,
+			globals.submitTimeout))
+	}
+	if globals.otlpEndpoint != "" {
+		sinks = append(sinks, NewOTLPSink(globals.otlpEndpoint, globals.otlpHeaders, globals.submitTimeout))
+	}
+
+	return sinks, nil
+}
+
+// NewSink instantiates the sink with the given name using the global options
+func NewSink(name string) (Sink, error) {
+	switch name {
+	case "nagios":
+		return NewNagiosSink(), nil
+	case "json":
+		return NewJSONSink(os.Stdout), nil
+	case "spool":
+		return NewSpoolSink(globals.spoolDirectory), nil
+	case "influx":
+		return NewInfluxSink(os.Stdout), nil
+	}
+
+	return nil, fmt.Errorf("unknown sink: %s", name)
+}
+
+// NewNagiosSink instantiates a Sink which prints the result according to the Nagios plugin specs on stdout
+func NewNagiosSink() Sink {
+	return &nagiosSink{}
+}
+
+func (s *nagiosSink) Name() string {
+	return "nagios"
+}
+
+func (s *nagiosSink) Emit(result SinkResult) error {
+	_, err := fmt.Print(result.RawOutput)
+	return err
+}
@@ -0,0 +1,145 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type icinga2Sink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+type icinga2CheckResult struct {
+	Type            string            `json:"type"`
+	Filter          string            `json:"filter"`
+	FilterVars      map[string]string `json:"filter_vars"`
+	ExitStatus      int               `json:"exit_status"`
+	PluginOutput    string            `json:"plugin_output"`
+	PerformanceData []string          `json:"performance_data,omitempty"`
+	CheckSource     string            `json:"check_source,omitempty"`
+}
+
+// NewIcinga2Sink instantiates a Sink which uses the 'process-check-result' action of the Icinga 2 REST API.
+// The token is expected as 'username:password' of an API user, as Icinga 2 only supports basic authentication.
+func NewIcinga2Sink(url string, token string, insecure bool, timeout time.Duration) Sink {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+	}
+
+	return &icinga2Sink{
+		url:   strings.TrimRight(url, "/"),
+		token: token,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+	}
+}
+
+func (s *icinga2Sink) Name() string {
+	return "icinga2"
+}
+
+func (s *icinga2Sink) Emit(result SinkResult) error {
+	payload := icinga2CheckResult{
+		Type:            "Host",
+		Filter:          "host.name==host",
+		FilterVars:      map[string]string{"host": result.Host},
+		ExitStatus:      result.ExitCode,
+		PluginOutput:    result.Output,
+		PerformanceData: result.PerfDataStrings(),
+		CheckSource:     result.CheckSource,
+	}
+	if result.Service != "" {
+		payload.Type = "Service"
+		payload.Filter = "host.name==host && service.name==service"
+		payload.FilterVars["service"] = result.Service
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not encode check result: %s", err.Error())
+	}
+
+	request, err := http.NewRequest("POST", s.url+"/v1/actions/process-check-result", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not build request: %s", err.Error())
+	}
+
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		credentials := strings.SplitN(s.token, ":", 2)
+		if len(credentials) != 2 {
+			return fmt.Errorf("icinga2 token must be given as username:password")
+		}
+		request.SetBasicAuth(credentials[0], credentials[1])
+	}
+
+	logger := NewLogger("sink").WithField("sink", s.Name()).WithField("url", request.URL.String())
+	defer logger.Timed("check result submission")()
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not submit check result: %s", err.Error())
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+	logger.Debugf("api responded with status %d: %s", response.StatusCode, strings.TrimSpace(string(responseBody)))
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("icinga2 api rejected check result with status %d: %s",
+			response.StatusCode, strings.TrimSpace(string(responseBody)))
+	}
+
+	// Icinga 2 responds with 200 OK even if the filter did not match any object, so check for empty results as well
+	var apiResponse struct {
+		Results []struct {
+			Code   float64 `json:"code"`
+			Status string  `json:"status"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(responseBody, &apiResponse); err == nil {
+		if len(apiResponse.Results) == 0 {
+			return fmt.Errorf("icinga2 api did not find any matching object for host [%s] and service [%s]",
+				result.Host, result.Service)
+		}
+		for _, apiResult := range apiResponse.Results {
+			if apiResult.Code != 200 {
+				return fmt.Errorf("icinga2 api rejected check result: %s", apiResult.Status)
+			}
+		}
+	}
+
+	return nil
+}
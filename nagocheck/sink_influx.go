@@ -0,0 +1,92 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type influxSink struct {
+	writer io.Writer
+}
+
+var influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+var influxKeyEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+
+// NewInfluxSink instantiates a Sink which writes all numeric metrics as a single line of InfluxDB line protocol into
+// the given writer, e.g. for being consumed by the exec input of Telegraf. The measurement is named after the module
+// and plugin, while the host and all non-default flags and arguments of the module and plugin are used as tags. A
+// --host flag of the module is tagged as target, as it would otherwise clash with the host running the check.
+func NewInfluxSink(writer io.Writer) Sink {
+	return &influxSink{writer: writer}
+}
+
+func (s *influxSink) Name() string {
+	return "influx"
+}
+
+func (s *influxSink) Emit(result SinkResult) error {
+	var buffer bytes.Buffer
+	buffer.WriteString(influxMeasurementEscaper.Replace(result.Module + "_" + result.Plugin))
+
+	tags := map[string]string{"host": result.Host}
+	for key, value := range result.Tags {
+		if key == "host" {
+			key = "target"
+		}
+		tags[key] = value
+	}
+	for _, key := range sortedKeys(tags) {
+		if tags[key] != "" {
+			fmt.Fprintf(&buffer, ",%s=%s", influxKeyEscaper.Replace(key), influxKeyEscaper.Replace(tags[key]))
+		}
+	}
+
+	fmt.Fprintf(&buffer, " state=%di", result.ExitCode)
+	for _, perfData := range result.PerfData {
+		metric, ok := perfData.Metric().(nagopher.NumericMetric)
+		if !ok || math.IsNaN(metric.Value()) || math.IsInf(metric.Value(), 0) || metric.Name() == "state" {
+			continue
+		}
+
+		fmt.Fprintf(&buffer, ",%s=%s", influxKeyEscaper.Replace(metric.Name()),
+			strconv.FormatFloat(metric.Value(), 'f', -1, 64))
+	}
+
+	fmt.Fprintf(&buffer, " %d\n", result.Timestamp.UnixNano())
+
+	_, err := s.writer.Write(buffer.Bytes())
+	return err
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
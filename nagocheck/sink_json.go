@@ -0,0 +1,109 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"encoding/json"
+	"github.com/snapserv/nagopher"
+	"io"
+	"strings"
+	"time"
+)
+
+type jsonSink struct {
+	writer io.Writer
+}
+
+type jsonSinkResult struct {
+	Host      string             `json:"host"`
+	Service   string             `json:"service"`
+	Module    string             `json:"module"`
+	Plugin    string             `json:"plugin"`
+	Timestamp string             `json:"timestamp"`
+	ExitCode  int                `json:"exit_code"`
+	State     string             `json:"state"`
+	Output    string             `json:"output"`
+	PerfData  []jsonSinkPerfData `json:"perfdata"`
+	Build     BuildInfo          `json:"build"`
+}
+
+type jsonSinkPerfData struct {
+	Name     string      `json:"name"`
+	Value    interface{} `json:"value"`
+	Unit     string      `json:"unit,omitempty"`
+	Warning  string      `json:"warning,omitempty"`
+	Critical string      `json:"critical,omitempty"`
+}
+
+// NewJSONSink instantiates a Sink which writes the result as a single-line JSON document to the given writer
+func NewJSONSink(writer io.Writer) Sink {
+	return &jsonSink{writer: writer}
+}
+
+func (s *jsonSink) Name() string {
+	return "json"
+}
+
+func (s *jsonSink) Emit(result SinkResult) error {
+	document := jsonSinkResult{
+		Host:      result.Host,
+		Service:   result.Service,
+		Module:    result.Module,
+		Plugin:    result.Plugin,
+		Timestamp: result.Timestamp.Format(time.RFC3339),
+		ExitCode:  result.ExitCode,
+		State:     result.State,
+		Output:    result.Output,
+		PerfData:  make([]jsonSinkPerfData, 0, len(result.PerfData)),
+		Build:     buildInfo,
+	}
+
+	for _, perfData := range result.PerfData {
+		metric := perfData.Metric()
+		warning, critical := PerfDataThresholds(perfData)
+		entry := jsonSinkPerfData{
+			Name:     metric.Name(),
+			Value:    metric.ValueString(),
+			Unit:     metric.ValueUnit(),
+			Warning:  warning,
+			Critical: critical,
+		}
+		if numericMetric, ok := metric.(nagopher.NumericMetric); ok {
+			entry.Value = numericMetric.Value()
+		}
+
+		document.PerfData = append(document.PerfData, entry)
+	}
+
+	return json.NewEncoder(s.writer).Encode(document)
+}
+
+// PerfDataThresholds returns the warning and critical threshold of the given performance data as Nagios range
+// specifiers, as nagopher does not expose them directly.
+func PerfDataThresholds(perfData nagopher.PerfData) (warning string, critical string) {
+	parts := strings.Split(perfData.ToNagiosPerfData(), ";")
+	if len(parts) > 1 {
+		warning = parts[1]
+	}
+	if len(parts) > 2 {
+		critical = parts[2]
+	}
+
+	return
+}
@@ -0,0 +1,148 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/snapserv/nagocheck/nagocheck/tlspsk"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	nscaDefaultPort     = "5668"
+	nscaProtocolVersion = 1
+)
+
+type nscaSink struct {
+	address  string
+	identity string
+	password string
+	timeout  time.Duration
+}
+
+// NewNscaSink instantiates a Sink which transmits check results to a NSCA-ng daemon. The session gets authenticated
+// using TLS-PSK with the given identity and password, where the identity defaults to the hostname of the local system.
+// The port defaults to 5668 if the address does not contain one. The daemon must allow the PSK-AES128-GCM-SHA256
+// cipher suite, which is the only one supported by package tlspsk.
+func NewNscaSink(address string, identity string, password string, timeout time.Duration) Sink {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, nscaDefaultPort)
+	}
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+
+	return &nscaSink{
+		address:  address,
+		identity: identity,
+		password: password,
+		timeout:  timeout,
+	}
+}
+
+func (s *nscaSink) Name() string {
+	return "nsca"
+}
+
+func (s *nscaSink) Emit(result SinkResult) error {
+	logger := NewLogger("sink").WithField("sink", s.Name()).WithField("address", s.address)
+	defer logger.Timed("check result submission")()
+
+	conn, err := net.DialTimeout("tcp", s.address, s.timeout)
+	if err != nil {
+		return fmt.Errorf("could not connect to nsca-ng daemon: %s", err.Error())
+	}
+	if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	session, err := tlspsk.Client(conn, s.identity, []byte(s.password))
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("could not authenticate as [%s]: %s", s.identity, err.Error())
+	}
+	defer func() {
+		_ = session.Close()
+	}()
+	logger.Debugf("established tls session using %s", session.CipherSuite())
+
+	sessionID := make([]byte, 4)
+	if _, err := rand.Read(sessionID); err != nil {
+		return err
+	}
+
+	// The client announces the protocol version, pushes the length of the data followed by the data itself and ends
+	// the session. Each step gets acknowledged by the server, which replies with FAIL or BAIL on errors.
+	command := s.buildCommand(result)
+	reader := bufio.NewReader(session)
+	steps := []struct {
+		request  string
+		response string
+	}{
+		{fmt.Sprintf("MOIN %d %s\r\n", nscaProtocolVersion, hex.EncodeToString(sessionID)), "MOIN"},
+		{fmt.Sprintf("PUSH %d\r\n", len(command)), "OKAY"},
+		{command, "OKAY"},
+		{"QUIT\r\n", "OKAY"},
+	}
+
+	for _, step := range steps {
+		if _, err := session.Write([]byte(step.request)); err != nil {
+			return fmt.Errorf("could not send request: %s", err.Error())
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("could not receive response: %s", err.Error())
+		}
+
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if fields[0] == "FAIL" || fields[0] == "BAIL" {
+			return fmt.Errorf("nsca-ng daemon rejected request: %s", strings.TrimSpace(line))
+		} else if fields[0] != step.response {
+			return fmt.Errorf("unexpected response from nsca-ng daemon: %s", strings.TrimSpace(line))
+		}
+	}
+
+	logger.Debugf("submitted check result with %d bytes", len(command))
+	return nil
+}
+
+// buildCommand formats the result as PROCESS_SERVICE_CHECK_RESULT external command, which gets passed as-is by the
+// NSCA-ng daemon to the command file of the monitoring system
+func (s *nscaSink) buildCommand(result SinkResult) string {
+	output := result.Output
+	if len(result.PerfData) > 0 {
+		lines := strings.SplitN(output, "\n", 2)
+		lines[0] += " | " + strings.Join(result.PerfDataStrings(), " ")
+		output = strings.Join(lines, "\n")
+	}
+
+	// Multi-line output must be escaped, as it would otherwise break the external command
+	output = strings.Replace(output, "\n", `\n`, -1)
+
+	return fmt.Sprintf("[%d] PROCESS_SERVICE_CHECK_RESULT;%s;%s;%d;%s\n",
+		result.Timestamp.Unix(), result.Host, result.Service, result.ExitCode, output)
+}
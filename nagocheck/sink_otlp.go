@@ -0,0 +1,168 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type otlpSink struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+type otlpAttribute struct {
+	Key   string             `json:"key"`
+	Value otlpAttributeValue `json:"value"`
+}
+
+type otlpAttributeValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpMetric struct {
+	Name  string `json:"name"`
+	Unit  string `json:"unit,omitempty"`
+	Gauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+// NewOTLPSink instantiates a Sink which exports all numeric metrics to an OpenTelemetry collector using OTLP/HTTP with
+// JSON encoding. The endpoint is expected as base URL, e.g. http://collector:4318, while headers are being sent
+// along with each request, which is usually required for authentication.
+func NewOTLPSink(endpoint string, headers map[string]string, timeout time.Duration) Sink {
+	return &otlpSink{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		headers:  headers,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+func (s *otlpSink) Name() string {
+	return "otlp"
+}
+
+func (s *otlpSink) Emit(result SinkResult) error {
+	timestamp := strconv.FormatInt(result.Timestamp.UnixNano(), 10)
+
+	// Group data points by their unit, as OTLP expects all data points of a metric to share the same unit
+	var metrics []otlpMetric
+	metricsByUnit := make(map[string]int)
+	for _, perfData := range result.PerfData {
+		numericMetric, ok := perfData.Metric().(nagopher.NumericMetric)
+		if !ok {
+			continue
+		}
+
+		index, ok := metricsByUnit[numericMetric.ValueUnit()]
+		if !ok {
+			index = len(metrics)
+			metricsByUnit[numericMetric.ValueUnit()] = index
+			metrics = append(metrics, otlpMetric{Name: "nagocheck.metric", Unit: numericMetric.ValueUnit()})
+		}
+
+		metrics[index].Gauge.DataPoints = append(metrics[index].Gauge.DataPoints, otlpDataPoint{
+			Attributes:   []otlpAttribute{newOTLPAttribute("nagocheck.metric", numericMetric.Name())},
+			TimeUnixNano: timestamp,
+			AsDouble:     numericMetric.Value(),
+		})
+	}
+
+	stateMetric := otlpMetric{Name: "nagocheck.state"}
+	stateMetric.Gauge.DataPoints = []otlpDataPoint{{
+		Attributes:   []otlpAttribute{newOTLPAttribute("nagocheck.state", result.State)},
+		TimeUnixNano: timestamp,
+		AsDouble:     float64(result.ExitCode),
+	}}
+	metrics = append(metrics, stateMetric)
+
+	payload := map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{
+					newOTLPAttribute("service.name", "nagocheck"),
+					newOTLPAttribute("host.name", result.Host),
+					newOTLPAttribute("nagocheck.check", result.Service),
+					newOTLPAttribute("nagocheck.module", result.Module),
+					newOTLPAttribute("nagocheck.plugin", result.Plugin),
+				},
+			},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   map[string]string{"name": "github.com/snapserv/nagocheck"},
+				"metrics": metrics,
+			}},
+		}},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not encode metrics: %s", err.Error())
+	}
+
+	request, err := http.NewRequest("POST", s.endpoint+"/v1/metrics", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not build request: %s", err.Error())
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		request.Header.Set(key, value)
+	}
+
+	logger := NewLogger("sink").WithField("sink", s.Name()).WithField("url", request.URL.String())
+	defer logger.Timed("metric export")()
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not export metrics: %s", err.Error())
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		responseBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("otlp collector rejected metrics with status %d: %s",
+			response.StatusCode, strings.TrimSpace(string(responseBody)))
+	}
+
+	return nil
+}
+
+func newOTLPAttribute(key string, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpAttributeValue{StringValue: value}}
+}
@@ -0,0 +1,111 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type pushgatewaySink struct {
+	url    string
+	job    string
+	client *http.Client
+}
+
+// NewPushgatewaySink instantiates a Sink which pushes all numeric metrics to a Prometheus Pushgateway. Each check
+// uses its own grouping key consisting of job, instance and check, so that checks do not overwrite each other.
+func NewPushgatewaySink(url string, job string, timeout time.Duration) Sink {
+	return &pushgatewaySink{
+		url: strings.TrimRight(url, "/"),
+		job: job,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+func (s *pushgatewaySink) Name() string {
+	return "pushgateway"
+}
+
+func (s *pushgatewaySink) Emit(result SinkResult) error {
+	labels := fmt.Sprintf(`module="%s",plugin="%s"`,
+		escapePrometheusLabel(result.Module), escapePrometheusLabel(result.Plugin))
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "# TYPE nagocheck_metric gauge\n")
+	for _, perfData := range result.PerfData {
+		metric, ok := perfData.Metric().(nagopher.NumericMetric)
+		if !ok {
+			continue
+		}
+
+		fmt.Fprintf(&buffer, "nagocheck_metric{%s,metric=\"%s\",unit=\"%s\"} %s\n",
+			labels, escapePrometheusLabel(metric.Name()), escapePrometheusLabel(metric.ValueUnit()),
+			strconv.FormatFloat(metric.Value(), 'g', -1, 64))
+	}
+
+	fmt.Fprintf(&buffer, "# TYPE nagocheck_state gauge\n")
+	fmt.Fprintf(&buffer, "nagocheck_state{%s} %d\n", labels, result.ExitCode)
+	fmt.Fprintf(&buffer, "# TYPE nagocheck_last_run_timestamp_seconds gauge\n")
+	fmt.Fprintf(&buffer, "nagocheck_last_run_timestamp_seconds{%s} %d\n", labels, result.Timestamp.Unix())
+	writeBuildInfoMetrics(&buffer, newBuildInfoDocument(nil))
+
+	pushURL := fmt.Sprintf("%s/metrics/job/%s/instance/%s/check/%s", s.url,
+		url.PathEscape(s.job), url.PathEscape(result.Host), url.PathEscape(result.Service))
+	request, err := http.NewRequest("PUT", pushURL, &buffer)
+	if err != nil {
+		return fmt.Errorf("could not build request: %s", err.Error())
+	}
+	request.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	logger := NewLogger("sink").WithField("sink", s.Name()).WithField("url", pushURL)
+	defer logger.Timed("metric push")()
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not push metrics: %s", err.Error())
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		responseBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("pushgateway rejected metrics with status %d: %s",
+			response.StatusCode, strings.TrimSpace(string(responseBody)))
+	}
+
+	return nil
+}
+
+func escapePrometheusLabel(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
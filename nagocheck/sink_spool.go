@@ -0,0 +1,113 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const spoolFileNameChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+type spoolSink struct {
+	directory string
+}
+
+// NewSpoolSink instantiates a Sink which writes the result as a Nagios check result file into the given directory,
+// which is usually the 'check_result_path' of Nagios. A matching '.ok' file gets created once the result file has
+// been written completely, so that Nagios never processes partial results.
+func NewSpoolSink(directory string) Sink {
+	return &spoolSink{directory: directory}
+}
+
+func (s *spoolSink) Name() string {
+	return "spool"
+}
+
+func (s *spoolSink) Emit(result SinkResult) error {
+	output := result.Output
+	if len(result.PerfData) > 0 {
+		lines := strings.SplitN(output, "\n", 2)
+		lines[0] += " | " + strings.Join(result.PerfDataStrings(), " ")
+		output = strings.Join(lines, "\n")
+	}
+
+	timestamp := fmt.Sprintf("%d.%06d", result.Timestamp.Unix(), result.Timestamp.Nanosecond()/1000)
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "### Nagios Service Check Result ###\n")
+	fmt.Fprintf(&buffer, "# Time: %s\n", result.Timestamp.Format("Mon Jan 2 15:04:05 2006"))
+	fmt.Fprintf(&buffer, "host_name=%s\n", result.Host)
+	if result.Service != "" {
+		fmt.Fprintf(&buffer, "service_description=%s\n", result.Service)
+	}
+	fmt.Fprintf(&buffer, "check_type=1\ncheck_options=0\nscheduled_check=0\nreschedule_check=0\nlatency=0\n")
+	fmt.Fprintf(&buffer, "start_time=%s\nfinish_time=%s\n", timestamp, timestamp)
+	fmt.Fprintf(&buffer, "early_timeout=0\nexited_ok=1\nreturn_code=%d\n", result.ExitCode)
+	fmt.Fprintf(&buffer, "output=%s\n", strings.Replace(output, "\n", `\n`, -1))
+
+	file, err := s.createResultFile()
+	if err != nil {
+		return fmt.Errorf("could not create check result file: %s", err.Error())
+	}
+
+	if _, err := file.Write(buffer.Bytes()); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return fmt.Errorf("could not write check result file: %s", err.Error())
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return fmt.Errorf("could not write check result file: %s", err.Error())
+	}
+
+	okFile, err := os.Create(file.Name() + ".ok")
+	if err != nil {
+		return fmt.Errorf("could not create check result ok file: %s", err.Error())
+	}
+
+	return okFile.Close()
+}
+
+// createResultFile creates a new check result file with a name matching 'cXXXXXX', as Nagios ignores all other files
+func (s *spoolSink) createResultFile() (*os.File, error) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(os.Getpid())))
+
+	for attempt := 0; attempt < 100; attempt++ {
+		name := make([]byte, 6)
+		for key := range name {
+			name[key] = spoolFileNameChars[random.Intn(len(spoolFileNameChars))]
+		}
+
+		path := filepath.Join(s.directory, "c"+string(name))
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+
+		return file, err
+	}
+
+	return nil, fmt.Errorf("could not find unused file name in %s", s.directory)
+}
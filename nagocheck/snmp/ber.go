@@ -0,0 +1,385 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ASN.1 BER tags of the universal and application types used by SNMP
+const (
+	tagInteger        byte = 0x02
+	tagOctetString    byte = 0x04
+	tagNull           byte = 0x05
+	tagOID            byte = 0x06
+	tagSequence       byte = 0x30
+	tagIPAddress      byte = 0x40
+	tagCounter32      byte = 0x41
+	tagGauge32        byte = 0x42
+	tagTimeTicks      byte = 0x43
+	tagOpaque         byte = 0x44
+	tagCounter64      byte = 0x46
+	tagNoSuchObject   byte = 0x80
+	tagNoSuchInstance byte = 0x81
+	tagEndOfMibView   byte = 0x82
+)
+
+var errTruncated = errors.New("truncated BER data")
+
+// Variable represents a single variable binding as returned by a SNMP agent. The value is either an int64 (INTEGER),
+// uint64 (Counter32, Gauge32, TimeTicks, Counter64), []byte (OCTET STRING, Opaque), string (OBJECT IDENTIFIER),
+// net.IP (IpAddress) or nil (NULL and all exceptions).
+type Variable struct {
+	OID   string
+	Type  byte
+	Value interface{}
+}
+
+// Exists returns false in case the agent responded with one of the SNMP v2 exceptions or a NULL value
+func (v Variable) Exists() bool {
+	switch v.Type {
+	case tagNull, tagNoSuchObject, tagNoSuchInstance, tagEndOfMibView:
+		return false
+	}
+
+	return true
+}
+
+// Int returns the numeric value of the variable or an error, in case the variable does not contain a number
+func (v Variable) Int() (int64, error) {
+	switch value := v.Value.(type) {
+	case int64:
+		return value, nil
+	case uint64:
+		return int64(value), nil
+	case []byte:
+		// Some MIBs (e.g. UCD-SNMP-MIB::laLoad) expose numbers as display strings
+		number, err := strconv.ParseInt(strings.TrimSpace(string(value)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("variable %s does not contain a number", v.OID)
+		}
+		return number, nil
+	}
+
+	return 0, fmt.Errorf("variable %s does not contain a number", v.OID)
+}
+
+// Float returns the numeric value of the variable as float64, which also allows parsing decimal display strings
+func (v Variable) Float() (float64, error) {
+	if value, ok := v.Value.([]byte); ok {
+		number, err := strconv.ParseFloat(strings.TrimSpace(string(value)), 64)
+		if err != nil {
+			return 0, fmt.Errorf("variable %s does not contain a number", v.OID)
+		}
+		return number, nil
+	}
+
+	number, err := v.Int()
+	return float64(number), err
+}
+
+// String returns a human-readable representation of the variable value
+func (v Variable) String() string {
+	switch value := v.Value.(type) {
+	case []byte:
+		return string(value)
+	case nil:
+		return ""
+	}
+
+	return fmt.Sprintf("%v", v.Value)
+}
+
+// HasPrefix returns true in case the given OID is equal to or located below the given root OID
+func HasPrefix(oid string, root string) bool {
+	oid, root = normalizeOID(oid), normalizeOID(root)
+	return oid == root || strings.HasPrefix(oid, root+".")
+}
+
+func normalizeOID(oid string) string {
+	return strings.TrimPrefix(strings.TrimSpace(oid), ".")
+}
+
+func parseOID(oid string) ([]uint64, error) {
+	fields := strings.Split(normalizeOID(oid), ".")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid object identifier: %s", oid)
+	}
+
+	parts := make([]uint64, len(fields))
+	for index, field := range fields {
+		value, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object identifier: %s", oid)
+		}
+		parts[index] = value
+	}
+
+	if parts[0] > 2 || (parts[0] < 2 && parts[1] >= 40) {
+		return nil, fmt.Errorf("invalid object identifier: %s", oid)
+	}
+
+	return parts, nil
+}
+
+// compareOID returns -1, 0 or +1 depending on the lexicographical order of both object identifiers
+func compareOID(left string, right string) int {
+	leftParts, _ := parseOID(left)
+	rightParts, _ := parseOID(right)
+
+	for index := 0; index < len(leftParts) && index < len(rightParts); index++ {
+		if leftParts[index] < rightParts[index] {
+			return -1
+		} else if leftParts[index] > rightParts[index] {
+			return 1
+		}
+	}
+
+	switch {
+	case len(leftParts) < len(rightParts):
+		return -1
+	case len(leftParts) > len(rightParts):
+		return 1
+	}
+
+	return 0
+}
+
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+
+	var buffer []byte
+	for ; length > 0; length >>= 8 {
+		buffer = append([]byte{byte(length)}, buffer...)
+	}
+
+	return append([]byte{0x80 | byte(len(buffer))}, buffer...)
+}
+
+func encodeTLV(tag byte, values ...[]byte) []byte {
+	var content []byte
+	for _, value := range values {
+		content = append(content, value...)
+	}
+
+	result := append([]byte{tag}, encodeLength(len(content))...)
+	return append(result, content...)
+}
+
+func encodeInteger(value int64) []byte {
+	var buffer []byte
+	for {
+		buffer = append([]byte{byte(value)}, buffer...)
+		value >>= 8
+
+		if (value == 0 && buffer[0]&0x80 == 0) || (value == -1 && buffer[0]&0x80 != 0) {
+			break
+		}
+	}
+
+	return encodeTLV(tagInteger, buffer)
+}
+
+func encodeOctetString(value []byte) []byte {
+	return encodeTLV(tagOctetString, value)
+}
+
+func encodeNull() []byte {
+	return []byte{tagNull, 0x00}
+}
+
+func encodeOID(oid string) ([]byte, error) {
+	parts, err := parseOID(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	content := encodeSubidentifier(parts[0]*40 + parts[1])
+	for _, part := range parts[2:] {
+		content = append(content, encodeSubidentifier(part)...)
+	}
+
+	return encodeTLV(tagOID, content), nil
+}
+
+func encodeSubidentifier(value uint64) []byte {
+	buffer := []byte{byte(value & 0x7f)}
+	for value >>= 7; value > 0; value >>= 7 {
+		buffer = append([]byte{byte(value&0x7f) | 0x80}, buffer...)
+	}
+
+	return buffer
+}
+
+// decodeTLV splits the given data into tag, content and remaining bytes. The returned slices share the backing array
+// of the input, which allows modifying the content in place (e.g. for calculating message digests).
+func decodeTLV(data []byte) (tag byte, content []byte, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errTruncated
+	}
+
+	tag, length, offset := data[0], int(data[1]), 2
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 4 || len(data) < offset+size {
+			return 0, nil, nil, errTruncated
+		}
+
+		length = 0
+		for _, value := range data[offset : offset+size] {
+			length = length<<8 | int(value)
+		}
+		offset += size
+	}
+
+	if length < 0 || len(data)-offset < length {
+		return 0, nil, nil, errTruncated
+	}
+
+	return tag, data[offset : offset+length], data[offset+length:], nil
+}
+
+func decodeExpected(data []byte, expectedTag byte) (content []byte, rest []byte, err error) {
+	tag, content, rest, err := decodeTLV(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tag != expectedTag {
+		return nil, nil, fmt.Errorf("unexpected BER tag 0x%02x, expected 0x%02x", tag, expectedTag)
+	}
+
+	return content, rest, nil
+}
+
+func decodeIntegerTLV(data []byte) (int64, []byte, error) {
+	content, rest, err := decodeExpected(data, tagInteger)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	value, err := decodeInteger(content)
+	return value, rest, err
+}
+
+func decodeInteger(content []byte) (int64, error) {
+	if len(content) == 0 || len(content) > 8 {
+		return 0, fmt.Errorf("invalid BER integer length: %d", len(content))
+	}
+
+	value := int64(int8(content[0]))
+	for _, part := range content[1:] {
+		value = value<<8 | int64(part)
+	}
+
+	return value, nil
+}
+
+func decodeUnsigned(content []byte) (uint64, error) {
+	if len(content) == 0 || len(content) > 9 || (len(content) == 9 && content[0] != 0) {
+		return 0, fmt.Errorf("invalid BER unsigned integer length: %d", len(content))
+	}
+
+	var value uint64
+	for _, part := range content {
+		value = value<<8 | uint64(part)
+	}
+
+	return value, nil
+}
+
+func decodeOID(content []byte) (string, error) {
+	var parts []string
+	var value uint64
+
+	for index, part := range content {
+		value = value<<7 | uint64(part&0x7f)
+		if part&0x80 != 0 {
+			if index == len(content)-1 {
+				return "", errTruncated
+			}
+			continue
+		}
+
+		if len(parts) == 0 {
+			first := value / 40
+			if first > 2 {
+				first = 2
+			}
+			parts = append(parts, strconv.FormatUint(first, 10), strconv.FormatUint(value-first*40, 10))
+		} else {
+			parts = append(parts, strconv.FormatUint(value, 10))
+		}
+		value = 0
+	}
+
+	if len(parts) == 0 {
+		return "", errTruncated
+	}
+
+	return strings.Join(parts, "."), nil
+}
+
+func decodeVariable(data []byte) (variable Variable, rest []byte, err error) {
+	var content []byte
+	if content, rest, err = decodeExpected(data, tagSequence); err != nil {
+		return variable, nil, err
+	}
+
+	oidContent, valueData, err := decodeExpected(content, tagOID)
+	if err != nil {
+		return variable, nil, err
+	}
+	if variable.OID, err = decodeOID(oidContent); err != nil {
+		return variable, nil, err
+	}
+
+	tag, valueContent, _, err := decodeTLV(valueData)
+	if err != nil {
+		return variable, nil, err
+	}
+
+	variable.Type = tag
+	switch tag {
+	case tagInteger:
+		variable.Value, err = decodeInteger(valueContent)
+	case tagCounter32, tagGauge32, tagTimeTicks, tagCounter64:
+		variable.Value, err = decodeUnsigned(valueContent)
+	case tagOctetString, tagOpaque:
+		variable.Value = append([]byte(nil), valueContent...)
+	case tagOID:
+		variable.Value, err = decodeOID(valueContent)
+	case tagIPAddress:
+		if len(valueContent) != net.IPv4len {
+			err = fmt.Errorf("invalid IpAddress length: %d", len(valueContent))
+		}
+		variable.Value = net.IP(append([]byte(nil), valueContent...))
+	case tagNull, tagNoSuchObject, tagNoSuchInstance, tagEndOfMibView:
+		variable.Value = nil
+	default:
+		err = fmt.Errorf("unsupported BER tag 0x%02x for variable %s", tag, variable.OID)
+	}
+
+	return variable, rest, err
+}
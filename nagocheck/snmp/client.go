@@ -0,0 +1,394 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package snmp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Version represents the SNMP protocol version used by a client
+type Version int
+
+// Supported SNMP protocol versions, using their on-the-wire representation
+const (
+	Version2c Version = 1
+	Version3  Version = 3
+)
+
+// PDU types as defined by RFC 3416
+const (
+	pduGetRequest     byte = 0xa0
+	pduGetNextRequest byte = 0xa1
+	pduResponse       byte = 0xa2
+	pduGetBulkRequest byte = 0xa5
+	pduReport         byte = 0xa8
+)
+
+// maxMessageSize is the largest message size announced to and accepted from agents, which equals the maximum UDP
+// payload size
+const maxMessageSize = 65507
+
+// walkRepetitions specifies the amount of variables requested at once when walking a subtree using GETBULK
+const walkRepetitions = 16
+
+var errorStatusNames = []string{
+	"noError", "tooBig", "noSuchName", "badValue", "readOnly", "genErr", "noAccess", "wrongType", "wrongLength",
+	"wrongEncoding", "wrongValue", "noCreation", "inconsistentValue", "resourceUnavailable", "commitFailed",
+	"undoFailed", "authorizationError", "notWritable", "inconsistentName",
+}
+
+// Client is a minimal SNMP manager, which supports retrieving single variables and walking subtrees of remote agents
+// using SNMP v2c or SNMP v3 with the user-based security model (USM)
+type Client struct {
+	target    string
+	port      uint16
+	version   Version
+	community string
+	security  *SecurityParameters
+	timeout   time.Duration
+	retries   int
+
+	conn      net.Conn
+	requestID int32
+	engine    *engineState
+}
+
+// ClientOpt is a type alias for functional options used by NewClient()
+type ClientOpt func(*Client)
+
+type pdu struct {
+	pduType     byte
+	requestID   int32
+	errorStatus int64
+	errorIndex  int64
+	variables   []Variable
+}
+
+// NewClient instantiates a new SNMP client for the given target, which defaults to SNMP v2c with community 'public'
+func NewClient(target string, options ...ClientOpt) *Client {
+	client := &Client{
+		target:    target,
+		port:      161,
+		version:   Version2c,
+		community: "public",
+		timeout:   5 * time.Second,
+		retries:   1,
+		requestID: int32(randomUint64() & 0x7fffffff),
+	}
+
+	for _, option := range options {
+		option(client)
+	}
+
+	return client
+}
+
+// ClientPort is a functional option for NewClient(), which sets the UDP port of the remote agent
+func ClientPort(port uint16) ClientOpt {
+	return func(c *Client) {
+		c.port = port
+	}
+}
+
+// ClientCommunity is a functional option for NewClient(), which sets the community used for SNMP v2c
+func ClientCommunity(community string) ClientOpt {
+	return func(c *Client) {
+		c.version = Version2c
+		c.community = community
+	}
+}
+
+// ClientSecurity is a functional option for NewClient(), which switches the client to SNMP v3 using the given USM
+// security parameters
+func ClientSecurity(security SecurityParameters) ClientOpt {
+	return func(c *Client) {
+		c.version = Version3
+		c.security = &security
+	}
+}
+
+// ClientTimeout is a functional option for NewClient(), which sets the timeout for each request attempt
+func ClientTimeout(timeout time.Duration) ClientOpt {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// ClientRetries is a functional option for NewClient(), which sets the amount of retries for unanswered requests
+func ClientRetries(retries int) ClientOpt {
+	return func(c *Client) {
+		c.retries = retries
+	}
+}
+
+// Connect opens the UDP socket towards the remote agent. For SNMP v3, the authoritative engine is being discovered
+// lazily as part of the first request.
+func (c *Client) Connect() error {
+	if c.version == Version3 {
+		if err := c.security.validate(); err != nil {
+			return err
+		}
+	}
+
+	conn, err := net.DialTimeout("udp", c.Address(), c.timeout)
+	if err != nil {
+		return fmt.Errorf("could not connect to %s: %s", c.Address(), err.Error())
+	}
+
+	c.conn = conn
+	return nil
+}
+
+// Close closes the UDP socket of the client
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Address returns the address of the remote agent formatted as host:port
+func (c *Client) Address() string {
+	return net.JoinHostPort(c.target, strconv.Itoa(int(c.port)))
+}
+
+// Get retrieves the variables with the given object identifiers. Missing variables are returned as well and can be
+// detected by calling Exists().
+func (c *Client) Get(oids ...string) ([]Variable, error) {
+	return c.request(pduGetRequest, oids, 0, 0)
+}
+
+// Walk retrieves all variables located within the subtree of the given root object identifier
+func (c *Client) Walk(root string) (result []Variable, _ error) {
+	root = normalizeOID(root)
+	current := root
+
+	for {
+		variables, err := c.request(pduGetBulkRequest, []string{current}, 0, walkRepetitions)
+		if err != nil {
+			return nil, err
+		}
+		if len(variables) == 0 {
+			return result, nil
+		}
+
+		for _, variable := range variables {
+			if variable.Type == tagEndOfMibView || !HasPrefix(variable.OID, root) {
+				return result, nil
+			}
+			if compareOID(variable.OID, current) <= 0 {
+				return nil, fmt.Errorf("agent returned non-increasing object identifier: %s", variable.OID)
+			}
+
+			result = append(result, variable)
+			current = variable.OID
+		}
+	}
+}
+
+func (c *Client) request(pduType byte, oids []string, field1 int64, field2 int64) ([]Variable, error) {
+	if c.conn == nil {
+		return nil, errors.New("client is not connected")
+	}
+
+	var response *pdu
+	var err error
+
+	if c.version == Version3 {
+		response, err = c.requestV3(pduType, oids, field1, field2)
+	} else {
+		response, err = c.requestV2c(pduType, oids, field1, field2)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if response.errorStatus != 0 {
+		errorStatus := strconv.FormatInt(response.errorStatus, 10)
+		if response.errorStatus > 0 && response.errorStatus < int64(len(errorStatusNames)) {
+			errorStatus = errorStatusNames[response.errorStatus]
+		}
+
+		if response.errorIndex > 0 && response.errorIndex <= int64(len(oids)) {
+			return nil, fmt.Errorf("agent returned error %s for %s", errorStatus, oids[response.errorIndex-1])
+		}
+		return nil, fmt.Errorf("agent returned error %s", errorStatus)
+	}
+
+	return response.variables, nil
+}
+
+func (c *Client) requestV2c(pduType byte, oids []string, field1 int64, field2 int64) (*pdu, error) {
+	requestID := c.nextID()
+	pduData, err := encodePDU(pduType, requestID, field1, field2, oids)
+	if err != nil {
+		return nil, err
+	}
+
+	packet := encodeTLV(tagSequence,
+		encodeInteger(int64(Version2c)),
+		encodeOctetString([]byte(c.community)),
+		pduData,
+	)
+
+	var response *pdu
+	err = c.roundTrip(packet, func(data []byte) (bool, error) {
+		content, _, err := decodeExpected(data, tagSequence)
+		if err != nil {
+			return false, nil
+		}
+
+		version, rest, err := decodeIntegerTLV(content)
+		if err != nil || version != int64(Version2c) {
+			return false, nil
+		}
+		if _, rest, err = decodeExpected(rest, tagOctetString); err != nil {
+			return false, nil
+		}
+
+		message, err := decodePDU(rest)
+		if err != nil || message.requestID != requestID {
+			return false, nil
+		}
+
+		response = message
+		return true, nil
+	})
+
+	return response, err
+}
+
+// roundTrip sends the given packet to the agent and passes all received datagrams to the given handler, until it
+// either signals completion or returns an error. Requests are being retransmitted when running into a timeout.
+func (c *Client) roundTrip(packet []byte, handler func(data []byte) (bool, error)) error {
+	buffer := make([]byte, maxMessageSize)
+
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if _, err := c.conn.Write(packet); err != nil {
+			return fmt.Errorf("could not send request to %s: %s", c.Address(), err.Error())
+		}
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+			return err
+		}
+
+		for {
+			length, err := c.conn.Read(buffer)
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					break
+				}
+				return fmt.Errorf("could not receive response from %s: %s", c.Address(), err.Error())
+			}
+
+			done, err := handler(append([]byte(nil), buffer[:length]...))
+			if err != nil {
+				return err
+			}
+			if done {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("no response from %s after %d attempt(s)", c.Address(), c.retries+1)
+}
+
+func (c *Client) nextID() int32 {
+	c.requestID = (c.requestID + 1) & 0x7fffffff
+	return c.requestID
+}
+
+// randomUint64 returns a cryptographically secure random number, which is used for request ids and privacy salts, as
+// the default source of math/rand is not being seeded automatically
+func randomUint64() uint64 {
+	var buffer [8]byte
+	if _, err := rand.Read(buffer[:]); err != nil {
+		return uint64(time.Now().UnixNano())
+	}
+
+	return binary.BigEndian.Uint64(buffer[:])
+}
+
+func encodePDU(pduType byte, requestID int32, field1 int64, field2 int64, oids []string) ([]byte, error) {
+	var variables [][]byte
+	for _, oid := range oids {
+		encodedOID, err := encodeOID(oid)
+		if err != nil {
+			return nil, err
+		}
+
+		variables = append(variables, encodeTLV(tagSequence, encodedOID, encodeNull()))
+	}
+
+	return encodeTLV(pduType,
+		encodeInteger(int64(requestID)),
+		encodeInteger(field1),
+		encodeInteger(field2),
+		encodeTLV(tagSequence, variables...),
+	), nil
+}
+
+func decodePDU(data []byte) (*pdu, error) {
+	pduType, content, _, err := decodeTLV(data)
+	if err != nil {
+		return nil, err
+	}
+	if pduType != pduResponse && pduType != pduReport {
+		return nil, fmt.Errorf("unexpected PDU type 0x%02x", pduType)
+	}
+
+	result := &pdu{pduType: pduType}
+	requestID, rest, err := decodeIntegerTLV(content)
+	if err != nil {
+		return nil, err
+	}
+	result.requestID = int32(requestID)
+
+	if result.errorStatus, rest, err = decodeIntegerTLV(rest); err != nil {
+		return nil, err
+	}
+	if result.errorIndex, rest, err = decodeIntegerTLV(rest); err != nil {
+		return nil, err
+	}
+
+	variableData, _, err := decodeExpected(rest, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+
+	for len(variableData) > 0 {
+		var variable Variable
+		if variable, variableData, err = decodeVariable(variableData); err != nil {
+			return nil, err
+		}
+
+		result.variables = append(result.variables, variable)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,548 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package snmp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+)
+
+// AuthProtocol represents the authentication protocol used by SNMP v3
+type AuthProtocol string
+
+// PrivProtocol represents the privacy (encryption) protocol used by SNMP v3
+type PrivProtocol string
+
+// Supported SNMP v3 authentication and privacy protocols
+const (
+	AuthNone AuthProtocol = "none"
+	AuthMD5  AuthProtocol = "md5"
+	AuthSHA  AuthProtocol = "sha"
+
+	PrivNone PrivProtocol = "none"
+	PrivDES  PrivProtocol = "des"
+	PrivAES  PrivProtocol = "aes"
+)
+
+// AuthProtocolNames and PrivProtocolNames contain the names of all supported protocols
+var (
+	AuthProtocolNames = []string{string(AuthNone), string(AuthMD5), string(AuthSHA)}
+	PrivProtocolNames = []string{string(PrivNone), string(PrivDES), string(PrivAES)}
+)
+
+const (
+	flagAuth       byte = 0x01
+	flagPriv       byte = 0x02
+	flagReportable byte = 0x04
+
+	securityModelUSM = 3
+	authParamsLength = 12
+)
+
+var (
+	errNotInTimeWindow = errors.New("not in time window")
+	errUnknownEngineID = errors.New("unknown engine id")
+)
+
+var usmReportErrors = map[string]error{
+	"1.3.6.1.6.3.15.1.1.1.0": errors.New("unsupported security level"),
+	"1.3.6.1.6.3.15.1.1.2.0": errNotInTimeWindow,
+	"1.3.6.1.6.3.15.1.1.3.0": errors.New("unknown user name"),
+	"1.3.6.1.6.3.15.1.1.4.0": errUnknownEngineID,
+	"1.3.6.1.6.3.15.1.1.5.0": errors.New("wrong digest, check authentication credentials"),
+	"1.3.6.1.6.3.15.1.1.6.0": errors.New("decryption error, check privacy credentials"),
+}
+
+// SecurityParameters contains the credentials of the user-based security model (USM) used by SNMP v3
+type SecurityParameters struct {
+	UserName     string
+	AuthProtocol AuthProtocol
+	AuthPassword string
+	PrivProtocol PrivProtocol
+	PrivPassword string
+	ContextName  string
+}
+
+// engineState contains the discovered parameters of the authoritative SNMP engine and the localized keys
+type engineState struct {
+	id          []byte
+	boots       int64
+	time        int64
+	timeUpdated time.Time
+	authKey     []byte
+	privKey     []byte
+	saltCounter uint64
+}
+
+type v3Message struct {
+	msgID      int32
+	flags      byte
+	engineID   []byte
+	boots      int64
+	time       int64
+	authParams []byte
+	privParams []byte
+	msgData    []byte
+}
+
+func (p *SecurityParameters) validate() error {
+	if p.UserName == "" {
+		return errors.New("SNMP v3 requires a user name")
+	}
+
+	switch p.AuthProtocol {
+	case "", AuthNone:
+		if p.PrivProtocol != "" && p.PrivProtocol != PrivNone {
+			return errors.New("SNMP v3 privacy requires an authentication protocol")
+		}
+	case AuthMD5, AuthSHA:
+		if len(p.AuthPassword) < 8 {
+			return errors.New("SNMP v3 authentication password must be at least 8 characters long")
+		}
+	default:
+		return fmt.Errorf("unsupported SNMP v3 authentication protocol: %s", p.AuthProtocol)
+	}
+
+	switch p.PrivProtocol {
+	case "", PrivNone:
+	case PrivDES, PrivAES:
+		if len(p.PrivPassword) < 8 {
+			return errors.New("SNMP v3 privacy password must be at least 8 characters long")
+		}
+	default:
+		return fmt.Errorf("unsupported SNMP v3 privacy protocol: %s", p.PrivProtocol)
+	}
+
+	return nil
+}
+
+func (p *SecurityParameters) hasAuth() bool {
+	return p.AuthProtocol != "" && p.AuthProtocol != AuthNone
+}
+
+func (p *SecurityParameters) hasPriv() bool {
+	return p.PrivProtocol != "" && p.PrivProtocol != PrivNone
+}
+
+func (p *SecurityParameters) hashFunc() func() hash.Hash {
+	if p.AuthProtocol == AuthSHA {
+		return sha1.New
+	}
+
+	return md5.New
+}
+
+func (c *Client) requestV3(pduType byte, oids []string, field1 int64, field2 int64) (*pdu, error) {
+	if c.engine == nil {
+		if err := c.discoverEngine(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Agents reject the first authenticated request with a report in case the engine time was not known yet, which
+	// contains the current engine time and allows retrying the request once
+	response, err := c.exchangeV3(pduType, oids, field1, field2, true)
+	if err == errNotInTimeWindow {
+		response, err = c.exchangeV3(pduType, oids, field1, field2, true)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("SNMP v3 request failed: %s", err.Error())
+	}
+
+	return response, nil
+}
+
+func (c *Client) discoverEngine() error {
+	c.engine = &engineState{}
+
+	if _, err := c.exchangeV3(pduGetRequest, nil, 0, 0, false); err != nil && err != errUnknownEngineID {
+		c.engine = nil
+		return fmt.Errorf("could not discover SNMP v3 engine: %s", err.Error())
+	}
+	if len(c.engine.id) == 0 {
+		c.engine = nil
+		return errors.New("could not discover SNMP v3 engine: agent did not report its engine id")
+	}
+
+	if c.security.hasAuth() {
+		c.engine.authKey = localizeKey(c.security.hashFunc(), c.security.AuthPassword, c.engine.id)
+	}
+	if c.security.hasPriv() {
+		c.engine.privKey = localizeKey(c.security.hashFunc(), c.security.PrivPassword, c.engine.id)
+	}
+
+	return nil
+}
+
+func (c *Client) exchangeV3(pduType byte, oids []string, field1 int64, field2 int64, secure bool) (*pdu, error) {
+	msgID := c.nextID()
+	pduData, err := encodePDU(pduType, c.nextID(), field1, field2, oids)
+	if err != nil {
+		return nil, err
+	}
+
+	packet, err := c.encodeV3(msgID, pduData, secure)
+	if err != nil {
+		return nil, err
+	}
+
+	var message *v3Message
+	var response *pdu
+	err = c.roundTrip(packet, func(data []byte) (bool, error) {
+		var err error
+		if message, err = decodeV3Message(data); err != nil || message.msgID != msgID {
+			return false, nil
+		}
+
+		scopedPDU, err := c.openV3Message(message, data)
+		if err != nil {
+			return false, err
+		}
+
+		_, rest, err := decodeExpected(scopedPDU, tagOctetString)
+		if err == nil {
+			_, rest, err = decodeExpected(rest, tagOctetString)
+		}
+		if err == nil {
+			response, err = decodePDU(rest)
+		}
+		if err != nil {
+			return false, fmt.Errorf("could not decode scoped PDU: %s", err.Error())
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep track of the authoritative engine, which is mandatory for the discovery and time synchronization
+	if len(c.engine.id) == 0 {
+		c.engine.id = message.engineID
+	}
+	if response.pduType == pduReport || message.flags&flagAuth != 0 {
+		c.engine.boots, c.engine.time, c.engine.timeUpdated = message.boots, message.time, time.Now()
+	}
+
+	if response.pduType == pduReport {
+		for _, variable := range response.variables {
+			if reportErr, ok := usmReportErrors[variable.OID]; ok {
+				return nil, reportErr
+			}
+		}
+		return nil, errors.New("agent returned unknown report")
+	}
+
+	return response, nil
+}
+
+func (c *Client) encodeV3(msgID int32, pduData []byte, secure bool) ([]byte, error) {
+	var userName, authParams, privParams []byte
+	var engineBoots, engineTime int64
+	flags := flagReportable
+
+	if secure {
+		userName = []byte(c.security.UserName)
+		engineBoots = c.engine.boots
+		engineTime = c.engine.time + int64(time.Since(c.engine.timeUpdated).Seconds())
+
+		if c.security.hasAuth() {
+			flags |= flagAuth
+			authParams = make([]byte, authParamsLength)
+		}
+		if c.security.hasPriv() {
+			flags |= flagPriv
+		}
+	}
+
+	contextName := []byte(nil)
+	if secure {
+		contextName = []byte(c.security.ContextName)
+	}
+	msgData := encodeTLV(tagSequence, encodeOctetString(c.engine.id), encodeOctetString(contextName), pduData)
+
+	if flags&flagPriv != 0 {
+		var err error
+		var encryptedData []byte
+		if encryptedData, privParams, err = c.encrypt(msgData, engineBoots, engineTime); err != nil {
+			return nil, err
+		}
+		msgData = encodeOctetString(encryptedData)
+	}
+
+	message := encodeTLV(tagSequence,
+		encodeInteger(int64(Version3)),
+		encodeTLV(tagSequence,
+			encodeInteger(int64(msgID)),
+			encodeInteger(maxMessageSize),
+			encodeOctetString([]byte{flags}),
+			encodeInteger(securityModelUSM),
+		),
+		encodeOctetString(encodeTLV(tagSequence,
+			encodeOctetString(c.engine.id),
+			encodeInteger(engineBoots),
+			encodeInteger(engineTime),
+			encodeOctetString(userName),
+			encodeOctetString(authParams),
+			encodeOctetString(privParams),
+		)),
+		msgData,
+	)
+
+	if flags&flagAuth != 0 {
+		// Decode the message again to locate the authentication parameters, which share the backing array
+		decodedMessage, err := decodeV3Message(message)
+		if err != nil {
+			return nil, err
+		}
+		copy(decodedMessage.authParams, c.digest(message))
+	}
+
+	return message, nil
+}
+
+// openV3Message verifies the digest of the given message if authentication was used and returns the decrypted scoped
+// PDU. The raw message data gets modified in place while verifying the digest.
+func (c *Client) openV3Message(message *v3Message, data []byte) ([]byte, error) {
+	if message.flags&flagAuth != 0 && len(c.engine.authKey) > 0 {
+		receivedDigest := append([]byte(nil), message.authParams...)
+		for index := range message.authParams {
+			message.authParams[index] = 0
+		}
+
+		if !hmac.Equal(receivedDigest, c.digest(data)) {
+			return nil, errors.New("response has invalid authentication digest")
+		}
+	}
+
+	if message.flags&flagPriv == 0 {
+		content, _, err := decodeExpected(message.msgData, tagSequence)
+		return content, err
+	}
+
+	if len(c.engine.privKey) == 0 {
+		return nil, errors.New("response is encrypted, but no privacy protocol was configured")
+	}
+
+	encryptedData, _, err := decodeExpected(message.msgData, tagOctetString)
+	if err != nil {
+		return nil, err
+	}
+
+	plainData, err := c.decrypt(encryptedData, message.privParams, message.boots, message.time)
+	if err != nil {
+		return nil, err
+	}
+
+	content, _, err := decodeExpected(plainData, tagSequence)
+	return content, err
+}
+
+func (c *Client) digest(message []byte) []byte {
+	mac := hmac.New(c.security.hashFunc(), c.engine.authKey)
+	mac.Write(message)
+	return mac.Sum(nil)[:authParamsLength]
+}
+
+func (c *Client) encrypt(data []byte, engineBoots int64, engineTime int64) (encryptedData []byte, salt []byte, _ error) {
+	if c.engine.saltCounter == 0 {
+		c.engine.saltCounter = randomUint64()
+	}
+	c.engine.saltCounter++
+	salt = make([]byte, 8)
+
+	switch c.security.PrivProtocol {
+	case PrivDES:
+		binary.BigEndian.PutUint32(salt, uint32(engineBoots))
+		binary.BigEndian.PutUint32(salt[4:], uint32(c.engine.saltCounter))
+
+		block, err := des.NewCipher(c.engine.privKey[:8])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// DES-CBC requires padding to the block size, the trailing bytes are being ignored by the BER decoder
+		plainData := append([]byte(nil), data...)
+		if remainder := len(plainData) % des.BlockSize; remainder != 0 {
+			plainData = append(plainData, make([]byte, des.BlockSize-remainder)...)
+		}
+
+		encryptedData = make([]byte, len(plainData))
+		cipher.NewCBCEncrypter(block, xorBytes(c.engine.privKey[8:16], salt)).CryptBlocks(encryptedData, plainData)
+		return encryptedData, salt, nil
+
+	case PrivAES:
+		binary.BigEndian.PutUint64(salt, c.engine.saltCounter)
+
+		block, err := aes.NewCipher(c.engine.privKey[:16])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		encryptedData = make([]byte, len(data))
+		cipher.NewCFBEncrypter(block, aesIV(engineBoots, engineTime, salt)).XORKeyStream(encryptedData, data)
+		return encryptedData, salt, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported SNMP v3 privacy protocol: %s", c.security.PrivProtocol)
+}
+
+func (c *Client) decrypt(data []byte, salt []byte, engineBoots int64, engineTime int64) ([]byte, error) {
+	if len(salt) != 8 {
+		return nil, errors.New("response has invalid privacy parameters")
+	}
+
+	switch c.security.PrivProtocol {
+	case PrivDES:
+		if len(data)%des.BlockSize != 0 {
+			return nil, errors.New("response has invalid encrypted data length")
+		}
+
+		block, err := des.NewCipher(c.engine.privKey[:8])
+		if err != nil {
+			return nil, err
+		}
+
+		plainData := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, xorBytes(c.engine.privKey[8:16], salt)).CryptBlocks(plainData, data)
+		return plainData, nil
+
+	case PrivAES:
+		block, err := aes.NewCipher(c.engine.privKey[:16])
+		if err != nil {
+			return nil, err
+		}
+
+		plainData := make([]byte, len(data))
+		cipher.NewCFBDecrypter(block, aesIV(engineBoots, engineTime, salt)).XORKeyStream(plainData, data)
+		return plainData, nil
+	}
+
+	return nil, fmt.Errorf("unsupported SNMP v3 privacy protocol: %s", c.security.PrivProtocol)
+}
+
+func decodeV3Message(data []byte) (*v3Message, error) {
+	message := &v3Message{}
+
+	content, _, err := decodeExpected(data, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+
+	version, rest, err := decodeIntegerTLV(content)
+	if err != nil {
+		return nil, err
+	}
+	if version != int64(Version3) {
+		return nil, fmt.Errorf("unexpected SNMP version: %d", version)
+	}
+
+	globalData, rest, err := decodeExpected(rest, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	msgID, globalData, err := decodeIntegerTLV(globalData)
+	if err != nil {
+		return nil, err
+	}
+	message.msgID = int32(msgID)
+	if _, globalData, err = decodeIntegerTLV(globalData); err != nil {
+		return nil, err
+	}
+	flags, _, err := decodeExpected(globalData, tagOctetString)
+	if err != nil || len(flags) != 1 {
+		return nil, errors.New("invalid SNMP v3 message flags")
+	}
+	message.flags = flags[0]
+
+	securityData, rest, err := decodeExpected(rest, tagOctetString)
+	if err != nil {
+		return nil, err
+	}
+	securityData, _, err = decodeExpected(securityData, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.engineID, securityData, err = decodeExpected(securityData, tagOctetString); err != nil {
+		return nil, err
+	}
+	if message.boots, securityData, err = decodeIntegerTLV(securityData); err != nil {
+		return nil, err
+	}
+	if message.time, securityData, err = decodeIntegerTLV(securityData); err != nil {
+		return nil, err
+	}
+	if _, securityData, err = decodeExpected(securityData, tagOctetString); err != nil {
+		return nil, err
+	}
+	if message.authParams, securityData, err = decodeExpected(securityData, tagOctetString); err != nil {
+		return nil, err
+	}
+	if message.privParams, _, err = decodeExpected(securityData, tagOctetString); err != nil {
+		return nil, err
+	}
+
+	message.engineID = append([]byte(nil), message.engineID...)
+	message.msgData = rest
+	return message, nil
+}
+
+// localizeKey derives the localized key from the given password and engine id as specified by RFC 3414 A.2
+func localizeKey(hashFunc func() hash.Hash, password string, engineID []byte) []byte {
+	const expandedLength = 1048576
+
+	hasher := hashFunc()
+	expandedPassword := bytes.Repeat([]byte(password), expandedLength/len(password)+1)
+	hasher.Write(expandedPassword[:expandedLength])
+	passwordKey := hasher.Sum(nil)
+
+	hasher.Reset()
+	hasher.Write(passwordKey)
+	hasher.Write(engineID)
+	hasher.Write(passwordKey)
+	return hasher.Sum(nil)
+}
+
+func aesIV(engineBoots int64, engineTime int64, salt []byte) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv, uint32(engineBoots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(engineTime))
+	copy(iv[8:], salt)
+	return iv
+}
+
+func xorBytes(left []byte, right []byte) []byte {
+	result := make([]byte, len(left))
+	for index := range left {
+		result[index] = left[index] ^ right[index]
+	}
+
+	return result
+}
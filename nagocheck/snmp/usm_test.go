@@ -0,0 +1,156 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package snmp
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hash"
+	"strings"
+	"testing"
+)
+
+func decodeHex(t *testing.T, value string) []byte {
+	data, err := hex.DecodeString(value)
+	require.NoError(t, err, value)
+	return data
+}
+
+func TestLocalizeKey(t *testing.T) {
+	// given: RFC 3414 A.3.1 and A.3.2
+	testCases := []struct {
+		name     string
+		hashFunc func() hash.Hash
+		expected string
+	}{
+		{"md5", md5.New, "526f5eed9fcce26f8964c2930787d82b"},
+		{"sha", sha1.New, "6695febc9288e36282235fc7151f128497b38f3f"},
+	}
+	engineID := decodeHex(t, "000000000000000000000002")
+
+	for _, testCase := range testCases {
+		// when
+		key := localizeKey(testCase.hashFunc, "maplesyrup", engineID)
+
+		// then
+		assert.Equal(t, testCase.expected, hex.EncodeToString(key), testCase.name)
+	}
+}
+
+func TestClient_Digest(t *testing.T) {
+	// given: RFC 2202 test case 1, truncated to 96 bits as specified by RFC 3414
+	testCases := []struct {
+		protocol AuthProtocol
+		authKey  string
+		expected string
+	}{
+		{AuthMD5, strings.Repeat("0b", 16), "9294727a3638bb1c13f48ef8"},
+		{AuthSHA, strings.Repeat("0b", 20), "b617318655057264e28bc0b6"},
+	}
+
+	for _, testCase := range testCases {
+		client := &Client{
+			security: &SecurityParameters{AuthProtocol: testCase.protocol},
+			engine:   &engineState{authKey: decodeHex(t, testCase.authKey)},
+		}
+
+		// when
+		digest := client.digest([]byte("Hi There"))
+
+		// then
+		assert.Equal(t, testCase.expected, hex.EncodeToString(digest), string(testCase.protocol))
+	}
+}
+
+func TestClient_EncryptDecrypt(t *testing.T) {
+	// given: NIST SP 800-38A F.3.13 for AES-128-CFB, with the IV 000102030405060708090a0b0c0d0e0f being composed of
+	// the engine boots, engine time and salt as specified by RFC 3826. DES uses the classic single block example with
+	// the pre-IV of the key cancelling out the salt, as specified by RFC 3414 8.1.1.1.
+	testCases := []struct {
+		protocol    PrivProtocol
+		privKey     string
+		boots       int64
+		time        int64
+		saltCounter uint64
+		salt        string
+		plainData   string
+		expected    string
+	}{
+		{
+			protocol:    PrivAES,
+			privKey:     "2b7e151628aed2a6abf7158809cf4f3c",
+			boots:       0x00010203,
+			time:        0x04050607,
+			saltCounter: 0x08090a0b0c0d0e0e,
+			salt:        "08090a0b0c0d0e0f",
+			plainData:   "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51",
+			expected:    "3b3fd92eb72dad20333449f8e83cfb4ac8a64537a0b3a93fcde3cdad9f1ce58b",
+		},
+		{
+			protocol:    PrivDES,
+			privKey:     "133457799bbcdff10000000100000002",
+			boots:       1,
+			time:        0,
+			saltCounter: 1,
+			salt:        "0000000100000002",
+			plainData:   "0123456789abcdef",
+			expected:    "85e813540f0ab405",
+		},
+	}
+
+	for _, testCase := range testCases {
+		client := &Client{
+			security: &SecurityParameters{PrivProtocol: testCase.protocol},
+			engine:   &engineState{privKey: decodeHex(t, testCase.privKey), saltCounter: testCase.saltCounter},
+		}
+
+		// when
+		encryptedData, salt, err := client.encrypt(decodeHex(t, testCase.plainData), testCase.boots, testCase.time)
+		require.NoError(t, err, string(testCase.protocol))
+		plainData, err := client.decrypt(encryptedData, salt, testCase.boots, testCase.time)
+		require.NoError(t, err, string(testCase.protocol))
+
+		// then
+		assert.Equal(t, testCase.salt, hex.EncodeToString(salt), string(testCase.protocol))
+		assert.Equal(t, testCase.expected, hex.EncodeToString(encryptedData), string(testCase.protocol))
+		assert.Equal(t, testCase.plainData, hex.EncodeToString(plainData), string(testCase.protocol))
+	}
+}
+
+func TestClient_EncryptDES_Padding(t *testing.T) {
+	// given
+	client := &Client{
+		security: &SecurityParameters{PrivProtocol: PrivDES},
+		engine:   &engineState{privKey: decodeHex(t, strings.Repeat("01", 16)), saltCounter: 1},
+	}
+	data := []byte("hello")
+
+	// when
+	encryptedData, salt, err := client.encrypt(data, 7, 0)
+	require.NoError(t, err)
+	plainData, err := client.decrypt(encryptedData, salt, 7, 0)
+	require.NoError(t, err)
+
+	// then
+	assert.Len(t, encryptedData, 8)
+	assert.Equal(t, append(data, 0, 0, 0), plainData)
+}
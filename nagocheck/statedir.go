@@ -0,0 +1,95 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// StateDirectory returns the directory in which lock files and file-based persistent data are being stored. Unless
+// specified by --state-dir, privileged users keep using the temporary directory of the operating system, while
+// unprivileged users get a private directory per user, so that multiple monitoring users on one host never collide.
+func StateDirectory() string {
+	if globals.stateDirectory != "" {
+		return globals.stateDirectory
+	}
+
+	if uid := os.Getuid(); uid > 0 {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("nagocheck-%d", uid))
+	}
+
+	return os.TempDir()
+}
+
+// stateNamespace returns the namespace for state which can not be stored within the state directory, e.g. shared
+// memory objects. It is empty for privileged users without --state-dir to keep the names of previous versions.
+func stateNamespace() string {
+	if globals.stateDirectory != "" {
+		absolutePath, err := filepath.Abs(globals.stateDirectory)
+		if err != nil {
+			absolutePath = globals.stateDirectory
+		}
+
+		checksum := sha256.Sum256([]byte(absolutePath))
+		return hex.EncodeToString(checksum[:4])
+	}
+
+	if uid := os.Getuid(); uid > 0 {
+		return fmt.Sprintf("u%d", uid)
+	}
+
+	return ""
+}
+
+// ensureStateDirectory creates the given directory if it does not exist yet. The per-user fallback directories are
+// located within the world-writable temporary directory, which is why they must neither be a symlink nor accessible
+// by other users.
+func ensureStateDirectory(directory string) error {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return fmt.Errorf("could not create state directory: %s", err.Error())
+	}
+
+	if globals.stateDirectory != "" || directory != StateDirectory() || directory == os.TempDir() {
+		return nil
+	}
+
+	fileInfo, err := os.Lstat(directory)
+	if err != nil {
+		return fmt.Errorf("could not inspect state directory: %s", err.Error())
+	}
+	if !fileInfo.IsDir() || fileInfo.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("state directory [%s] must be a directory only accessible by its owner", directory)
+	}
+
+	return nil
+}
+
+// OverrideStateDirectory replaces the state directory given by --state-dir until the returned function gets called,
+// e.g. for isolating file-based persistent data like the history of plugins within tests
+func OverrideStateDirectory(directory string) (restore func()) {
+	previous := globals.stateDirectory
+	globals.stateDirectory = directory
+
+	return func() {
+		globals.stateDirectory = previous
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+)
+
+// StateNames contains the names of all final check states, which can be passed to ParseState()
+var StateNames = []string{"ok", "warning", "critical", "unknown"}
+
+// StateMapping remaps the final state of a check to another state, e.g. UNKNOWN to WARNING
+type StateMapping map[nagopher.State]nagopher.State
+
+type stateMappedCheck struct {
+	nagopher.Check
+	mapping StateMapping
+}
+
+// ParseState returns the nagopher state with the given name
+func ParseState(name string) (nagopher.State, error) {
+	for _, state := range []nagopher.State{
+		nagopher.StateOk(), nagopher.StateWarning(), nagopher.StateCritical(), nagopher.StateUnknown(),
+	} {
+		if state.Description() == name {
+			return state, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown state: %s", name)
+}
+
+// NewStateMapping builds a StateMapping out of the global --<state>-as flags
+func NewStateMapping() (StateMapping, error) {
+	return newStateMapping(globals)
+}
+
+func newStateMapping(options globalOptions) (StateMapping, error) {
+	mapping := make(StateMapping)
+	sources := map[nagopher.State]string{
+		nagopher.StateWarning():  options.warningAs,
+		nagopher.StateCritical(): options.criticalAs,
+		nagopher.StateUnknown():  options.unknownAs,
+	}
+
+	for source, targetName := range sources {
+		if targetName == "" {
+			continue
+		}
+
+		target, err := ParseState(targetName)
+		if err != nil {
+			return nil, err
+		}
+		mapping[source] = target
+	}
+
+	return mapping, nil
+}
+
+// Apply wraps the given check, so that its final state gets remapped according to the mapping. The check is being
+// returned as-is if the mapping is empty.
+func (m StateMapping) Apply(check nagopher.Check) nagopher.Check {
+	if len(m) == 0 {
+		return check
+	}
+
+	return &stateMappedCheck{Check: check, mapping: m}
+}
+
+func (c *stateMappedCheck) State() nagopher.State {
+	state := c.Check.State()
+	if mappedState, ok := c.mapping[state]; ok {
+		return mappedState
+	}
+
+	return state
+}
@@ -0,0 +1,121 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SudoTemplate describes an allow-listed external command, consisting of the command with its fixed arguments and an
+// optional sudoers wildcard pattern for the variable arguments appended at runtime. The same template is used for
+// building the actual invocation as well as for generating the matching sudoers entries, so that plugins are only
+// granted the privileges they really need.
+type SudoTemplate struct {
+	Name         string
+	Command      []string
+	VariableArgs string
+}
+
+// SudoProvider is implemented by modules and plugins which execute external commands that may require elevated
+// privileges, so that `generate sudoers` can document the required sudoers entries
+type SudoProvider interface {
+	SudoTemplates() []SudoTemplate
+}
+
+// NewSudoTemplate instantiates a SudoTemplate for the given command with fixed arguments. When variableArgs is empty,
+// no additional arguments may be passed to the command, otherwise they must match the given sudoers wildcard pattern.
+func NewSudoTemplate(name string, command []string, variableArgs string) SudoTemplate {
+	return SudoTemplate{
+		Name:         name,
+		Command:      command,
+		VariableArgs: variableArgs,
+	}
+}
+
+// Build returns the command line for executing the template with the given variable arguments, prefixed with a
+// non-interactive sudo invocation when --sudo was specified. Arguments which would not be allowed by the generated
+// sudoers entries are rejected, regardless of whether sudo is being used or not.
+func (t SudoTemplate) Build(args ...string) ([]string, error) {
+	if len(t.Command) == 0 {
+		return nil, fmt.Errorf("could not build %s command: empty command", t.Name)
+	}
+
+	if len(args) > 0 {
+		joinedArgs := strings.Join(args, " ")
+		if t.VariableArgs == "" {
+			return nil, fmt.Errorf("could not build %s command: no arguments allowed", t.Name)
+		}
+		if strings.HasPrefix(joinedArgs, "-") || sudoWildcardMatch(t.VariableArgs+" -*", joinedArgs) ||
+			!sudoWildcardMatch(t.VariableArgs, joinedArgs) {
+			return nil, fmt.Errorf("could not build %s command: arguments [%s] do not match [%s]",
+				t.Name, joinedArgs, t.VariableArgs)
+		}
+	}
+
+	var command []string
+	if globals.sudo {
+		command = append(command, strings.Split(globals.sudoCommand, ",")...)
+		command = append(command, "-n", "--")
+	}
+	command = append(command, t.Command...)
+	command = append(command, args...)
+
+	return command, nil
+}
+
+// SudoersEntries returns the sudoers lines which allow the given user to execute the template as root without a
+// password. Variable arguments are restricted by negated entries, so that they can not inject further options.
+func (t SudoTemplate) SudoersEntries(user string) []string {
+	fixed := make([]string, len(t.Command))
+	for key, arg := range t.Command {
+		fixed[key] = sudoersEscape(arg)
+	}
+	command := strings.Join(fixed, " ")
+
+	if t.VariableArgs == "" {
+		return []string{fmt.Sprintf(`%s ALL=(root) NOPASSWD: %s ""`, user, command)}
+	}
+
+	words := strings.Fields(t.VariableArgs)
+	for key, word := range words {
+		words[key] = sudoersEscape(word)
+	}
+	pattern := strings.Join(words, " ")
+
+	return []string{fmt.Sprintf("%s ALL=(root) NOPASSWD: %s %s, !%s -*, !%s %s -*",
+		user, command, pattern, command, command, pattern)}
+}
+
+// sudoersEscape escapes all characters which have a special meaning within sudoers command specifications, except for
+// the asterisk and question mark which are used as wildcards
+func sudoersEscape(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `,`, `\,`, `:`, `\:`, `=`, `\=`, ` `, `\ `, `"`, `\"`)
+	return replacer.Replace(value)
+}
+
+// sudoWildcardMatch mimics the wildcard matching of sudo for command line arguments, where '*' matches any sequence of
+// characters including spaces and '?' matches any single character
+func sudoWildcardMatch(pattern string, value string) bool {
+	expression := regexp.QuoteMeta(pattern)
+	expression = strings.Replace(expression, `\*`, ".*", -1)
+	expression = strings.Replace(expression, `\?`, ".", -1)
+
+	return regexp.MustCompile("^" + expression + "$").MatchString(value)
+}
@@ -18,7 +18,17 @@
 
 package nagocheck
 
-import "github.com/snapserv/nagopher"
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultProblemListLength is the recommended maximum length of problem summaries created by SummarizerListProblems()
+const DefaultProblemListLength = 200
 
 // Summarizer provides a base type for nagocheck summarizers, which embeds nagopher.Summarizer
 type Summarizer interface {
@@ -32,6 +42,17 @@ type SummarizerOpt func(*baseSummarizer)
 type baseSummarizer struct {
 	nagopher.Summarizer
 	plugin Plugin
+
+	listProblems      bool
+	problemListLength int
+}
+
+type neighborSummarizer struct {
+	Summarizer
+}
+
+type neighborUptimeContext struct {
+	nagopher.Context
 }
 
 // NewSummarizer instantiates baseSummarizer with the given functional options
@@ -48,6 +69,146 @@ func NewSummarizer(plugin Plugin, options ...SummarizerOpt) Summarizer {
 	return summarizer
 }
 
+// SummarizerListProblems is a functional option for NewSummarizer(), which changes the problem summary to enumerate
+// all violating results instead of only the most significant one. The summary gets truncated after maxLength
+// characters, which is useful to keep the status line readable within monitoring interfaces.
+func SummarizerListProblems(maxLength int) SummarizerOpt {
+	return func(s *baseSummarizer) {
+		s.listProblems = true
+		s.problemListLength = maxLength
+	}
+}
+
+func (s *baseSummarizer) Problem(check nagopher.Check) string {
+	if !s.listProblems {
+		return s.Summarizer.Problem(check)
+	}
+
+	var problems []nagopher.Result
+	for _, result := range check.Results().Get() {
+		state, err := result.State().Get()
+		if err != nil || state == nagopher.StateOk() || state == nagopher.StateInfo() {
+			continue
+		}
+
+		problems = append(problems, result)
+	}
+
+	if len(problems) == 0 {
+		return s.Summarizer.Problem(check)
+	}
+
+	// Sort problems by significance while retaining their original order within the same state
+	sort.SliceStable(problems, func(i, j int) bool {
+		stateA, _ := problems[i].State().Get()
+		stateB, _ := problems[j].State().Get()
+		return exitCodeSignificance(int(stateA.ExitCode())) > exitCodeSignificance(int(stateB.ExitCode()))
+	})
+
+	messages := make([]string, len(problems))
+	for key, problem := range problems {
+		messages[key] = problem.String()
+	}
+
+	return truncateString(strings.Join(messages, ", "), s.problemListLength)
+}
+
+// Verbose behaves like the nagopher summarizer, but groups all results belonging to a section of a resource under a
+// titled header. Results without any section are listed first without a header. Sorting, grouping and the maximum
+// amount of lines are controlled by the verbose output policy of the plugin.
+func (s *baseSummarizer) Verbose(check nagopher.Check) []string {
+	var lines []verboseLine
+
+	for _, result := range check.Results().Get() {
+		line := verboseLine{section: resultSectionTitle(result)}
+		state, err := result.State().Get()
+		if err != nil || state == nagopher.StateInfo() {
+			line.message = fmt.Sprintf("info: %s", result)
+		} else if state != nagopher.StateOk() {
+			line.message = fmt.Sprintf("%s: %s", state.Description(), result)
+			line.significance = exitCodeSignificance(int(state.ExitCode()))
+		} else {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	policy := VerboseOutputPolicy{Group: true}
+	if s.plugin != nil {
+		policy = s.plugin.VerboseOutputPolicy()
+	}
+
+	return policy.render(lines)
+}
+
 func (s *baseSummarizer) Plugin() Plugin {
 	return s.plugin
 }
+
+// NewNeighborSummarizer instantiates a Summarizer for plugins checking the session with a single neighbor, e.g. a BGP
+// peer, which summarizes the 'state' metric together with the 'last_state_change' metric given in seconds. Sharing it
+// across all backends ensures identical output for the same neighbor state, regardless of how it was collected.
+func NewNeighborSummarizer(plugin Plugin) Summarizer {
+	return &neighborSummarizer{
+		Summarizer: NewSummarizer(plugin),
+	}
+}
+
+// NewNeighborUptimeContext instantiates a scalar context for the uptime of a neighbor session, which is being evaluated
+// against the given thresholds without emitting performance data. It is shared by all plugins using
+// NewNeighborSummarizer().
+func NewNeighborUptimeContext(name string, warningThreshold *nagopher.Bounds, criticalThreshold *nagopher.Bounds) nagopher.Context {
+	return &neighborUptimeContext{nagopher.NewScalarContext(name, warningThreshold, criticalThreshold)}
+}
+
+func (c *neighborUptimeContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	return nagopher.OptionalPerfData{}, nil
+}
+
+func (s *neighborSummarizer) Ok(check nagopher.Check) string {
+	resultCollection := check.Results()
+
+	lastStateChange := resultCollection.GetNumericMetricValue("last_state_change").OrElse(math.NaN())
+	lastStateChangeString := "N/A"
+	if !math.IsNaN(lastStateChange) {
+		if lastStateChange > 0 {
+			lastStateChangeString = DurationString(time.Duration(lastStateChange) * time.Second)
+		} else {
+			lastStateChangeString = "always"
+		}
+	}
+
+	return fmt.Sprintf(
+		"state is %s since %s",
+		resultCollection.GetStringMetricValue("state").OrElse("N/A"),
+		lastStateChangeString,
+	)
+}
+
+// Problem returns the same summary as Ok() if the state of the neighbor is the most significant problem
+func (s *neighborSummarizer) Problem(check nagopher.Check) string {
+	result, err := check.Results().MostSignificantResult().Get()
+	if err == nil && result != nil {
+		metric, err := result.Metric().Get()
+		if err == nil && metric != nil && metric.Name() == "state" {
+			return s.Ok(check)
+		}
+	}
+
+	return s.Summarizer.Problem(check)
+}
+
+func resultSectionTitle(result nagopher.Result) string {
+	resource, ok := result.Resource().OrElse(nil).(Resource)
+	if !ok {
+		return ""
+	}
+
+	metric, err := result.Metric().Get()
+	if err != nil || metric == nil {
+		return resource.Name()
+	}
+
+	return resource.SectionOf(metric)
+}
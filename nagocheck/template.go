@@ -0,0 +1,97 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"os"
+	"strings"
+	"text/template"
+)
+
+type templatedCheck struct {
+	nagopher.Check
+	plugin   Plugin
+	template *template.Template
+}
+
+// SummaryTemplateData contains all fields which are available when rendering a summary template
+type SummaryTemplateData struct {
+	Hostname string
+	Module   string
+	Plugin   string
+	State    string
+	Summary  string
+	Metrics  map[string]string
+	Values   map[string]interface{}
+}
+
+// NewTemplatedCheck wraps a check so that its summary gets rendered using the given Go text/template. The original
+// summary, as returned by the summarizer of the check, is available within the template as '.Summary'.
+func NewTemplatedCheck(check nagopher.Check, plugin Plugin, summaryTemplate string) (nagopher.Check, error) {
+	tmpl, err := template.New("summary").Option("missingkey=zero").Parse(summaryTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse summary template: %s", err.Error())
+	}
+
+	return &templatedCheck{
+		Check:    check,
+		plugin:   plugin,
+		template: tmpl,
+	}, nil
+}
+
+func (c *templatedCheck) Summary() string {
+	hostname, _ := os.Hostname()
+	data := SummaryTemplateData{
+		Hostname: hostname,
+		Plugin:   c.plugin.Name(),
+		State:    c.Check.State().Description(),
+		Summary:  c.Check.Summary(),
+		Metrics:  make(map[string]string),
+		Values:   make(map[string]interface{}),
+	}
+	if module := c.plugin.Module(); module != nil {
+		data.Module = module.Name()
+	}
+
+	for _, result := range c.Check.Results().Get() {
+		metric, err := result.Metric().Get()
+		if err != nil || metric == nil {
+			continue
+		}
+
+		data.Metrics[metric.Name()] = metric.ValueString() + metric.ValueUnit()
+		switch typedMetric := metric.(type) {
+		case nagopher.NumericMetric:
+			data.Values[metric.Name()] = typedMetric.Value()
+		case nagopher.StringMetric:
+			data.Values[metric.Name()] = typedMetric.Value()
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := c.template.Execute(&buffer, data); err != nil {
+		return fmt.Sprintf("%s (could not render summary template: %s)", data.Summary, err.Error())
+	}
+
+	return strings.TrimSpace(buffer.String())
+}
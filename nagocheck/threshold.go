@@ -0,0 +1,262 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"github.com/snapserv/nagopher"
+	"regexp"
+	"strings"
+)
+
+// ThresholdOverride contains warning and critical thresholds, which replace the evaluation of a named context
+type ThresholdOverride struct {
+	Warning  nagopher.OptionalBounds
+	Critical nagopher.OptionalBounds
+}
+
+// ThresholdOverrides maps context names to their respective threshold overrides
+type ThresholdOverrides map[string]ThresholdOverride
+
+// InstanceThresholds maps metric names of single instances to their respective thresholds, which allows plugins
+// emitting one metric per dynamic instance (e.g. temperature sensors) to use different thresholds per instance
+type InstanceThresholds map[string]ThresholdOverride
+
+type thresholdOverrideContext struct {
+	nagopher.Context
+
+	override ThresholdOverride
+}
+
+type instanceThresholdContext struct {
+	nagopher.Context
+
+	thresholds InstanceThresholds
+}
+
+var thresholdOverrideKeywordRE = regexp.MustCompile(`(warn|crit):`)
+
+// instanceThresholdKeywords maps the keywords of instance thresholds to their respective threshold
+var instanceThresholdKeywords = map[string]string{"w": "warn", "warn": "warn", "c": "crit", "crit": "crit"}
+
+// ParseThresholdOverride parses a threshold override formatted as '<context>=warn:<range>:crit:<range>', where either
+// the warning or the critical part may be omitted. Both ranges are formatted as Nagios range specifier.
+func ParseThresholdOverride(rawValue string) (string, ThresholdOverride, error) {
+	var override ThresholdOverride
+
+	parts := strings.SplitN(rawValue, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", override, fmt.Errorf("threshold override [%s] must be formatted as <context>=<thresholds>", rawValue)
+	}
+
+	contextName, specifier := strings.TrimSpace(parts[0]), parts[1]
+	matches := thresholdOverrideKeywordRE.FindAllStringSubmatchIndex(specifier, -1)
+	if len(matches) == 0 || matches[0][0] != 0 {
+		return "", override, fmt.Errorf("threshold override [%s] must start with either warn: or crit:", rawValue)
+	}
+
+	for index, match := range matches {
+		keyword := specifier[match[2]:match[3]]
+		// Only the colon separating this range from the next keyword gets stripped, as the last range might end with
+		// a colon itself, e.g. 'crit:100:' for alerting on values of 100 or more
+		rangeSpecifier := specifier[match[1]:]
+		if index+1 < len(matches) {
+			rangeSpecifier = strings.TrimSuffix(specifier[match[1]:matches[index+1][0]], ":")
+		}
+
+		bounds, err := nagopher.NewBoundsFromNagiosRange(rangeSpecifier)
+		if err != nil {
+			return "", override, fmt.Errorf("invalid %s range in threshold override [%s]: %s", keyword, rawValue, err.Error())
+		}
+
+		if keyword == "warn" {
+			override.Warning.Set(bounds)
+		} else {
+			override.Critical.Set(bounds)
+		}
+	}
+
+	return contextName, override, nil
+}
+
+// ParseInstanceThreshold parses an instance threshold formatted as '<metric>=w:<range>,c:<range>', where either the
+// warning or the critical part may be omitted. Both ranges are formatted as Nagios range specifier.
+func ParseInstanceThreshold(rawValue string) (string, ThresholdOverride, error) {
+	var thresholds ThresholdOverride
+
+	parts := strings.SplitN(rawValue, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return "", thresholds, fmt.Errorf("instance threshold [%s] must be formatted as <metric>=w:<range>,c:<range>",
+			rawValue)
+	}
+
+	metricName := strings.TrimSpace(parts[0])
+	for _, part := range strings.Split(parts[1], ",") {
+		keywordParts := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		keyword, ok := instanceThresholdKeywords[keywordParts[0]]
+		if !ok || len(keywordParts) != 2 {
+			return "", thresholds, fmt.Errorf("instance threshold [%s] must only contain w:<range> or c:<range>",
+				rawValue)
+		}
+
+		bounds, err := nagopher.NewBoundsFromNagiosRange(keywordParts[1])
+		if err != nil {
+			return "", thresholds, fmt.Errorf("invalid %s range in instance threshold [%s]: %s",
+				keyword, rawValue, err.Error())
+		}
+
+		if keyword == "warn" {
+			thresholds.Warning.Set(bounds)
+		} else {
+			thresholds.Critical.Set(bounds)
+		}
+	}
+
+	return metricName, thresholds, nil
+}
+
+func (o ThresholdOverride) String() string {
+	var parts []string
+	o.Warning.If(func(bounds nagopher.Bounds) {
+		parts = append(parts, "warn:"+bounds.ToNagiosRange())
+	})
+	o.Critical.If(func(bounds nagopher.Bounds) {
+		parts = append(parts, "crit:"+bounds.ToNagiosRange())
+	})
+
+	return strings.Join(parts, ":")
+}
+
+// Apply wraps all contexts of the given check, which have a threshold override, so that metrics are being evaluated
+// against the overridden thresholds. An error gets returned if a threshold override refers to an unknown context.
+func (o ThresholdOverrides) Apply(check nagopher.Check) error {
+	contexts := make(map[string]nagopher.Context)
+	for _, context := range check.Contexts() {
+		contexts[context.Name()] = context
+	}
+
+	for contextName, override := range o {
+		context, ok := contexts[contextName]
+		if !ok {
+			return fmt.Errorf("threshold override refers to unknown context [%s]", contextName)
+		}
+
+		check.AttachContexts(&thresholdOverrideContext{Context: context, override: override})
+	}
+
+	return nil
+}
+
+// Apply wraps all contexts of the given check, so that metrics with instance thresholds are being evaluated against
+// those instead of the thresholds of their shared context. Instances which do not exist are being ignored, as the
+// instances of most plugins can appear and disappear during runtime.
+func (t InstanceThresholds) Apply(check nagopher.Check) {
+	if len(t) == 0 {
+		return
+	}
+
+	for _, context := range check.Contexts() {
+		check.AttachContexts(&instanceThresholdContext{Context: context, thresholds: t})
+	}
+}
+
+func (c *instanceThresholdContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	if thresholds, ok := c.thresholds[metric.Name()]; ok {
+		return (&thresholdOverrideContext{Context: c.Context, override: thresholds}).Evaluate(metric, resource)
+	}
+
+	return c.Context.Evaluate(metric, resource)
+}
+
+func (c *instanceThresholdContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	if thresholds, ok := c.thresholds[metric.Name()]; ok {
+		return (&thresholdOverrideContext{Context: c.Context, override: thresholds}).Performance(metric, resource)
+	}
+
+	return c.Context.Performance(metric, resource)
+}
+
+func (c *thresholdOverrideContext) Evaluate(metric nagopher.Metric, resource nagopher.Resource) nagopher.Result {
+	// Let the original context evaluate the metric first, as it might derive a new metric (e.g. delta contexts)
+	result := c.Context.Evaluate(metric, resource)
+	if _, ok := result.(pendingResult); ok {
+		return result
+	}
+
+	state, err := result.State().Get()
+	if err != nil || state == nagopher.StateUnknown() || state == nagopher.StateInfo() {
+		return result
+	}
+
+	numericMetric, ok := result.Metric().OrElse(metric).(nagopher.NumericMetric)
+	if !ok {
+		return result
+	}
+
+	emptyBounds := nagopher.NewBounds()
+	warningThreshold := c.override.Warning.OrElse(emptyBounds)
+	criticalThreshold := c.override.Critical.OrElse(emptyBounds)
+
+	if !criticalThreshold.Match(numericMetric.Value()) {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateCritical()),
+			nagopher.ResultMetric(numericMetric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint(criticalThreshold.ViolationHint()),
+		)
+	} else if !warningThreshold.Match(numericMetric.Value()) {
+		return nagopher.NewResult(
+			nagopher.ResultState(nagopher.StateWarning()),
+			nagopher.ResultMetric(numericMetric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+			nagopher.ResultHint(warningThreshold.ViolationHint()),
+		)
+	}
+
+	return nagopher.NewResult(
+		nagopher.ResultState(nagopher.StateOk()),
+		nagopher.ResultMetric(numericMetric), nagopher.ResultContext(c), nagopher.ResultResource(resource),
+	)
+}
+
+func (c *thresholdOverrideContext) Performance(metric nagopher.Metric, resource nagopher.Resource) (nagopher.OptionalPerfData, error) {
+	optionalPerfData, err := c.Context.Performance(metric, resource)
+	if err != nil {
+		return optionalPerfData, err
+	}
+
+	// Thresholds of ratio contexts apply to the computed percentage, which is not part of the performance data
+	if _, ok := c.Context.(*ratioContext); ok {
+		return optionalPerfData, nil
+	}
+
+	originalPerfData, err := optionalPerfData.Get()
+	if err != nil || originalPerfData == nil {
+		return optionalPerfData, nil
+	}
+
+	perfData, err := nagopher.NewPerfData(
+		originalPerfData.Metric(),
+		nagopher.OptionalBoundsPtr(c.override.Warning),
+		nagopher.OptionalBoundsPtr(c.override.Critical),
+	)
+	if err != nil {
+		return nagopher.OptionalPerfData{}, err
+	}
+
+	return nagopher.NewOptionalPerfData(perfData), nil
+}
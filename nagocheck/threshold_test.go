@@ -0,0 +1,91 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"github.com/snapserv/nagopher"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestParseThresholdOverride(t *testing.T) {
+	// given
+	expectedOverrides := map[string]struct {
+		warning  string
+		critical string
+	}{
+		"load=warn:10":               {"10", ""},
+		"load=crit:100:":             {"", "100:"},
+		"load=warn:~:5":              {"~:5", ""},
+		"load=crit:@10:20":           {"", "@10:20"},
+		"load=warn:10:crit:20":       {"10", "20"},
+		"load=warn:10::crit:20:":     {"10:", "20:"},
+		"load=crit:@1:2:warn:~:0.5":  {"~:0.5", "@1:2"},
+		"load=warn:5:10:crit:@15:20": {"5:10", "@15:20"},
+	}
+
+	for rawValue, expected := range expectedOverrides {
+		// when
+		contextName, override, err := ParseThresholdOverride(rawValue)
+
+		// then
+		assert.NoError(t, err, rawValue)
+		assert.Equal(t, "load", contextName, rawValue)
+		assertOptionalBounds(t, expected.warning, override.Warning, rawValue)
+		assertOptionalBounds(t, expected.critical, override.Critical, rawValue)
+	}
+}
+
+func TestParseThresholdOverride_OpenRange(t *testing.T) {
+	// when
+	_, override, err := ParseThresholdOverride("load=crit:100:")
+	critical, _ := override.Critical.Get()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, float64(100), critical.Lower().OrElse(math.NaN()))
+	assert.Equal(t, math.Inf(1), critical.Upper().OrElse(math.NaN()))
+	assert.Equal(t, true, critical.Match(1000))
+	assert.Equal(t, false, critical.Match(50))
+}
+
+func TestParseThresholdOverride_Invalid(t *testing.T) {
+	for _, rawValue := range []string{"load", "=warn:10", "load=10", "load=foo:10", "load=warn:abc"} {
+		// when
+		_, _, err := ParseThresholdOverride(rawValue)
+
+		// then
+		assert.Error(t, err, rawValue)
+	}
+}
+
+func assertOptionalBounds(t *testing.T, expected string, actual nagopher.OptionalBounds, message string) {
+	if expected == "" {
+		assert.Equal(t, false, actual.Present(), message)
+		return
+	}
+
+	expectedBounds, err := nagopher.NewBoundsFromNagiosRange(expected)
+	assert.NoError(t, err, message)
+
+	actualBounds, err := actual.Get()
+	assert.NoError(t, err, message)
+	assert.Equal(t, expectedBounds.ToNagiosRange(), actualBounds.ToNagiosRange(), message)
+}
@@ -0,0 +1,491 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+// Package tlspsk implements a minimal TLS 1.2 client authenticating with a pre-shared key (RFC 4279), which is not
+// supported by crypto/tls. Only PSK-AES128-GCM-SHA256 is implemented, which is offered by OpenSSL based servers like
+// NSCA-ng, as CBC cipher suites using MAC-then-encrypt are prone to padding oracles. Certificates, session resumption
+// and renegotiation are not supported.
+package tlspsk
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Record content types as defined by RFC 5246
+const (
+	recordChangeCipherSpec byte = 20
+	recordAlert            byte = 21
+	recordHandshake        byte = 22
+	recordApplicationData  byte = 23
+)
+
+// Handshake message types as defined by RFC 5246
+const (
+	handshakeClientHello       byte = 1
+	handshakeServerHello       byte = 2
+	handshakeServerKeyExchange byte = 12
+	handshakeServerHelloDone   byte = 14
+	handshakeClientKeyExchange byte = 16
+	handshakeFinished          byte = 20
+)
+
+const (
+	versionTLS12          = 0x0303
+	scsvRenegotiation     = 0x00ff
+	maxPlaintextLength    = 16384
+	maxCiphertextLength   = maxPlaintextLength + 2048
+	verifyDataLength      = 12
+	masterSecretLength    = 48
+	recordHeaderLength    = 5
+	handshakeHeaderLength = 4
+)
+
+type cipherSuite struct {
+	id     uint16
+	name   string
+	keyLen int
+	ivLen  int
+}
+
+// cipherSuites contains all supported cipher suites in order of preference, which must all be AEAD suites based on
+// AES-GCM and the SHA256 based pseudorandom function
+var cipherSuites = []cipherSuite{
+	{id: 0x00a8, name: "PSK-AES128-GCM-SHA256", keyLen: 16, ivLen: 4},
+}
+
+var alertNames = map[byte]string{
+	0:   "close notify",
+	10:  "unexpected message",
+	20:  "bad record mac",
+	40:  "handshake failure",
+	47:  "illegal parameter",
+	50:  "decode error",
+	51:  "decrypt error",
+	70:  "protocol version",
+	71:  "insufficient security",
+	80:  "internal error",
+	115: "unknown psk identity",
+}
+
+// Conn is a TLS connection authenticated by a pre-shared key, which has been established using Client()
+type Conn struct {
+	conn  net.Conn
+	suite *cipherSuite
+
+	in         halfConn
+	out        halfConn
+	input      []byte
+	handshake  []byte
+	transcript bytes.Buffer
+}
+
+// halfConn contains the cipher state of one direction of a connection, which is inactive until the change cipher spec
+// message has been sent or received
+type halfConn struct {
+	active  bool
+	seq     uint64
+	aead    cipher.AEAD
+	fixedIV []byte
+}
+
+// Client performs a TLS handshake on the given connection using the given PSK identity and key. The connection gets
+// closed when closing the returned connection, but not if the handshake fails.
+func Client(conn net.Conn, identity string, key []byte) (*Conn, error) {
+	c := &Conn{conn: conn}
+	if err := c.clientHandshake(identity, key); err != nil {
+		return nil, fmt.Errorf("tls handshake failed: %s", err.Error())
+	}
+
+	return c, nil
+}
+
+// CipherSuite returns the OpenSSL name of the negotiated cipher suite
+func (c *Conn) CipherSuite() string {
+	return c.suite.name
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	for len(c.input) == 0 {
+		recordType, data, err := c.readRecord()
+		if err != nil {
+			return 0, err
+		}
+
+		// Handshake messages like hello requests for renegotiation are being ignored
+		if recordType == recordApplicationData {
+			c.input = data
+		}
+	}
+
+	n := copy(b, c.input)
+	c.input = c.input[n:]
+
+	return n, nil
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		chunk := b[written:]
+		if len(chunk) > maxPlaintextLength {
+			chunk = chunk[:maxPlaintextLength]
+		}
+
+		if err := c.writeRecord(recordApplicationData, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+
+	return written, nil
+}
+
+// Close sends a close notify alert to the server and closes the underlying connection afterwards
+func (c *Conn) Close() error {
+	_ = c.writeRecord(recordAlert, []byte{1, 0})
+	return c.conn.Close()
+}
+
+// SetDeadline sets the read and write deadline of the underlying connection
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *Conn) clientHandshake(identity string, key []byte) error {
+	clientRandom := make([]byte, 32)
+	if _, err := rand.Read(clientRandom); err != nil {
+		return err
+	}
+
+	hello := appendUint16(nil, versionTLS12)
+	hello = append(hello, clientRandom...)
+	hello = append(hello, 0)
+	hello = appendUint16(hello, uint16(2*(len(cipherSuites)+1)))
+	for _, suite := range cipherSuites {
+		hello = appendUint16(hello, suite.id)
+	}
+	hello = appendUint16(hello, scsvRenegotiation)
+	hello = append(hello, 1, 0)
+	if err := c.writeHandshake(handshakeClientHello, hello); err != nil {
+		return err
+	}
+
+	serverRandom, err := c.readServerHello()
+	if err != nil {
+		return err
+	}
+
+	// The server key exchange message only contains an optional identity hint, which is not needed by clients
+	for {
+		messageType, _, err := c.readHandshake()
+		if err != nil {
+			return err
+		}
+		if messageType == handshakeServerHelloDone {
+			break
+		} else if messageType != handshakeServerKeyExchange {
+			return fmt.Errorf("unexpected handshake message of type %d", messageType)
+		}
+	}
+
+	keyExchange := appendUint16(nil, uint16(len(identity)))
+	keyExchange = append(keyExchange, identity...)
+	if err := c.writeHandshake(handshakeClientKeyExchange, keyExchange); err != nil {
+		return err
+	}
+
+	// The premaster secret of plain PSK cipher suites consists of zeros followed by the key, both prefixed by length
+	preMasterSecret := appendUint16(nil, uint16(len(key)))
+	preMasterSecret = append(preMasterSecret, make([]byte, len(key))...)
+	preMasterSecret = appendUint16(preMasterSecret, uint16(len(key)))
+	preMasterSecret = append(preMasterSecret, key...)
+
+	masterSecret := prf(preMasterSecret, "master secret", concat(clientRandom, serverRandom), masterSecretLength)
+	keyBlock := prf(masterSecret, "key expansion", concat(serverRandom, clientRandom),
+		2*(c.suite.keyLen+c.suite.ivLen))
+
+	// AEAD cipher suites do not use any MAC keys, so the key block only consists of the keys and implicit nonces
+	clientKey, keyBlock := keyBlock[:c.suite.keyLen], keyBlock[c.suite.keyLen:]
+	serverKey, keyBlock := keyBlock[:c.suite.keyLen], keyBlock[c.suite.keyLen:]
+	clientIV, serverIV := keyBlock[:c.suite.ivLen], keyBlock[c.suite.ivLen:]
+
+	if err := c.writeRecord(recordChangeCipherSpec, []byte{1}); err != nil {
+		return err
+	}
+	if err := c.out.init(clientKey, clientIV); err != nil {
+		return err
+	}
+
+	clientVerify := prf(masterSecret, "client finished", c.transcriptHash(), verifyDataLength)
+	if err := c.writeHandshake(handshakeFinished, clientVerify); err != nil {
+		return err
+	}
+	serverVerify := prf(masterSecret, "server finished", c.transcriptHash(), verifyDataLength)
+
+	recordType, _, err := c.readRecord()
+	if err != nil {
+		return err
+	} else if recordType != recordChangeCipherSpec {
+		return fmt.Errorf("unexpected record of type %d instead of change cipher spec", recordType)
+	}
+	if err := c.in.init(serverKey, serverIV); err != nil {
+		return err
+	}
+
+	messageType, verifyData, err := c.readHandshake()
+	if err != nil {
+		return err
+	} else if messageType != handshakeFinished {
+		return fmt.Errorf("unexpected handshake message of type %d instead of finished", messageType)
+	} else if !hmac.Equal(verifyData, serverVerify) {
+		return errors.New("server finished message could not be verified")
+	}
+
+	return nil
+}
+
+// readServerHello parses the server hello message and returns the server random. Extensions are being ignored, as the
+// client hello does not offer any.
+func (c *Conn) readServerHello() ([]byte, error) {
+	messageType, body, err := c.readHandshake()
+	if err != nil {
+		return nil, err
+	} else if messageType != handshakeServerHello {
+		return nil, fmt.Errorf("unexpected handshake message of type %d instead of server hello", messageType)
+	}
+
+	if len(body) < 35 || int(body[34])+38 > len(body) {
+		return nil, errors.New("malformed server hello")
+	}
+	if version := binary.BigEndian.Uint16(body); version != versionTLS12 {
+		return nil, fmt.Errorf("unsupported protocol version 0x%04x", version)
+	}
+
+	offset := 35 + int(body[34])
+	suiteID := binary.BigEndian.Uint16(body[offset:])
+	for index := range cipherSuites {
+		if cipherSuites[index].id == suiteID {
+			c.suite = &cipherSuites[index]
+		}
+	}
+	if c.suite == nil {
+		return nil, fmt.Errorf("server selected unsupported cipher suite 0x%04x", suiteID)
+	}
+	if body[offset+2] != 0 {
+		return nil, errors.New("server selected unsupported compression method")
+	}
+
+	return body[2:34], nil
+}
+
+// readHandshake returns the next handshake message, which might be fragmented across multiple records or share a
+// record with other handshake messages
+func (c *Conn) readHandshake() (byte, []byte, error) {
+	for len(c.handshake) < handshakeHeaderLength ||
+		len(c.handshake) < handshakeHeaderLength+int(uint24(c.handshake[1:])) {
+		recordType, data, err := c.readRecord()
+		if err != nil {
+			return 0, nil, err
+		} else if recordType != recordHandshake {
+			return 0, nil, fmt.Errorf("unexpected record of type %d during handshake", recordType)
+		}
+		c.handshake = append(c.handshake, data...)
+	}
+
+	length := handshakeHeaderLength + int(uint24(c.handshake[1:]))
+	message := c.handshake[:length]
+	c.handshake = c.handshake[length:]
+	c.transcript.Write(message)
+
+	return message[0], message[handshakeHeaderLength:], nil
+}
+
+func (c *Conn) writeHandshake(messageType byte, body []byte) error {
+	message := []byte{messageType, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	message = append(message, body...)
+	c.transcript.Write(message)
+
+	return c.writeRecord(recordHandshake, message)
+}
+
+// readRecord reads and decrypts the next record. Received alerts are returned as error, where a close notify alert
+// results in io.EOF.
+func (c *Conn) readRecord() (byte, []byte, error) {
+	header := make([]byte, recordHeaderLength)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return 0, nil, err
+	}
+
+	length := int(binary.BigEndian.Uint16(header[3:]))
+	if length > maxCiphertextLength {
+		return 0, nil, fmt.Errorf("record of %d bytes exceeds maximum length", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		return 0, nil, err
+	}
+
+	data, err := c.in.decrypt(header[0], data)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if header[0] == recordAlert {
+		if len(data) != 2 {
+			return 0, nil, errors.New("malformed alert")
+		} else if data[1] == 0 {
+			return 0, nil, io.EOF
+		}
+
+		name, ok := alertNames[data[1]]
+		if !ok {
+			name = fmt.Sprintf("alert %d", data[1])
+		}
+		return 0, nil, fmt.Errorf("received alert from server: %s", name)
+	}
+
+	return header[0], data, nil
+}
+
+func (c *Conn) writeRecord(recordType byte, data []byte) error {
+	data, err := c.out.encrypt(recordType, data)
+	if err != nil {
+		return err
+	}
+
+	record := []byte{recordType, versionTLS12 >> 8, versionTLS12 & 0xff, byte(len(data) >> 8), byte(len(data))}
+	_, err = c.conn.Write(append(record, data...))
+
+	return err
+}
+
+func (c *Conn) transcriptHash() []byte {
+	hash := sha256.Sum256(c.transcript.Bytes())
+	return hash[:]
+}
+
+func (h *halfConn) init(key []byte, fixedIV []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	if h.aead, err = cipher.NewGCM(block); err != nil {
+		return err
+	}
+
+	h.active = true
+	h.fixedIV = fixedIV
+
+	return nil
+}
+
+// additionalData returns the sequence number and the header of a record, which gets authenticated by the AEAD
+func (h *halfConn) additionalData(recordType byte, length int) []byte {
+	data := make([]byte, 13)
+	binary.BigEndian.PutUint64(data, h.seq)
+	data[8] = recordType
+	binary.BigEndian.PutUint16(data[9:], versionTLS12)
+	binary.BigEndian.PutUint16(data[11:], uint16(length))
+
+	return data
+}
+
+// encrypt seals the given record using the sequence number as explicit nonce, which is unique per connection and
+// direction as required by RFC 5288
+func (h *halfConn) encrypt(recordType byte, plaintext []byte) ([]byte, error) {
+	if !h.active {
+		return plaintext, nil
+	}
+	defer func() {
+		h.seq++
+	}()
+
+	explicitNonce := make([]byte, 8)
+	binary.BigEndian.PutUint64(explicitNonce, h.seq)
+
+	nonce := concat(h.fixedIV, explicitNonce)
+	return h.aead.Seal(explicitNonce, nonce, plaintext, h.additionalData(recordType, len(plaintext))), nil
+}
+
+func (h *halfConn) decrypt(recordType byte, ciphertext []byte) ([]byte, error) {
+	if !h.active {
+		return ciphertext, nil
+	}
+	defer func() {
+		h.seq++
+	}()
+
+	if len(ciphertext) < 8+h.aead.Overhead() {
+		return nil, errors.New("bad record mac")
+	}
+
+	nonce := concat(h.fixedIV, ciphertext[:8])
+	ciphertext = ciphertext[8:]
+	additionalData := h.additionalData(recordType, len(ciphertext)-h.aead.Overhead())
+	plaintext, err := h.aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, errors.New("bad record mac")
+	}
+
+	return plaintext, nil
+}
+
+// prf implements the pseudorandom function of TLS 1.2 based on HMAC-SHA256, which is used by all supported suites
+func prf(secret []byte, label string, seed []byte, length int) []byte {
+	labelSeed := concat([]byte(label), seed)
+	result := make([]byte, 0, length+sha256.Size)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(labelSeed)
+	a := mac.Sum(nil)
+	for len(result) < length {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(labelSeed)
+		result = mac.Sum(result)
+
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+
+	return result[:length]
+}
+
+func concat(a []byte, b []byte) []byte {
+	return append(append(make([]byte, 0, len(a)+len(b)), a...), b...)
+}
+
+func appendUint16(data []byte, value uint16) []byte {
+	return append(data, byte(value>>8), byte(value))
+}
+
+func uint24(data []byte) uint32 {
+	return uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2])
+}
@@ -0,0 +1,219 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package tlspsk
+
+import (
+	"bufio"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+func TestPRF(t *testing.T) {
+	// given
+	secret, _ := hex.DecodeString("9bbe436ba940f017b17652849a71db35")
+	seed, _ := hex.DecodeString("a0ba9f936cda311827a6f796ffd5198c")
+	expected := "e3f229ba727be17b8d122620557cd453c2aab21d07c3d495329b52d4e61edb5a6b301791e90d35c9c9a46b4e14baf9af0f" +
+		"a022f7077def17abfd3797c0564bab4fbc91666e9def9b97fce34f796789baa48082d122ee42c5a72e5a5110fff70187347b66"
+
+	// when
+	output := prf(secret, "test label", seed, 100)
+
+	// then
+	assert.Equal(t, expected, hex.EncodeToString(output))
+}
+
+func TestHalfConn_RoundTrip(t *testing.T) {
+	// given
+	writer, reader := newTestHalfConns(t)
+
+	for _, plaintext := range []string{"", "first record", strings.Repeat("x", maxPlaintextLength)} {
+		// when
+		ciphertext, err := writer.encrypt(recordApplicationData, []byte(plaintext))
+		require.NoError(t, err)
+		decrypted, err := reader.decrypt(recordApplicationData, ciphertext)
+
+		// then
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, string(decrypted))
+		assert.NotContains(t, string(ciphertext), "record")
+	}
+}
+
+func TestHalfConn_Tampered(t *testing.T) {
+	// given
+	writer, reader := newTestHalfConns(t)
+	ciphertext, err := writer.encrypt(recordApplicationData, []byte("payload"))
+	require.NoError(t, err)
+
+	// when
+	ciphertext[len(ciphertext)-1] ^= 1
+	_, err = reader.decrypt(recordApplicationData, ciphertext)
+
+	// then
+	assert.EqualError(t, err, "bad record mac")
+}
+
+func TestHalfConn_WrongRecordType(t *testing.T) {
+	// given
+	writer, reader := newTestHalfConns(t)
+	ciphertext, err := writer.encrypt(recordApplicationData, []byte("payload"))
+	require.NoError(t, err)
+
+	// when
+	_, err = reader.decrypt(recordAlert, ciphertext)
+
+	// then
+	assert.EqualError(t, err, "bad record mac")
+}
+
+func TestHalfConn_Replayed(t *testing.T) {
+	// given
+	writer, reader := newTestHalfConns(t)
+	ciphertext, err := writer.encrypt(recordApplicationData, []byte("payload"))
+	require.NoError(t, err)
+
+	// when
+	_, err = reader.decrypt(recordApplicationData, ciphertext)
+	require.NoError(t, err)
+	_, err = reader.decrypt(recordApplicationData, ciphertext)
+
+	// then
+	assert.EqualError(t, err, "bad record mac")
+}
+
+func TestClient_OpenSSL(t *testing.T) {
+	// given
+	address := startOpenSSLServer(t, testKey, "PSK-AES128-GCM-SHA256")
+	conn := dialOpenSSLServer(t, address, testKey)
+	defer conn.Close()
+
+	// when
+	reader := bufio.NewReader(conn)
+	var lines []string
+	for _, line := range []string{"hello", strings.Repeat("abc", 1000)} {
+		_, err := conn.Write([]byte(line + "\n"))
+		require.NoError(t, err)
+
+		reversed, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, strings.TrimSpace(reversed))
+	}
+
+	// then
+	assert.Equal(t, "PSK-AES128-GCM-SHA256", conn.CipherSuite())
+	assert.Equal(t, []string{"olleh", strings.Repeat("cba", 1000)}, lines)
+}
+
+func TestClient_OpenSSL_WrongKey(t *testing.T) {
+	// given
+	address := startOpenSSLServer(t, testKey, "PSK-AES128-GCM-SHA256")
+	rawConn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	require.NoError(t, err)
+	defer rawConn.Close()
+
+	// when
+	key, _ := hex.DecodeString(strings.Repeat("ff", 16))
+	_, err = Client(rawConn, "nagocheck", key)
+
+	// then
+	assert.EqualError(t, err, "tls handshake failed: received alert from server: bad record mac")
+}
+
+func TestClient_OpenSSL_NoSharedCipher(t *testing.T) {
+	// given
+	address := startOpenSSLServer(t, testKey, "PSK-AES128-CBC-SHA")
+	rawConn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	require.NoError(t, err)
+	defer rawConn.Close()
+
+	// when
+	key, _ := hex.DecodeString(testKey)
+	_, err = Client(rawConn, "nagocheck", key)
+
+	// then
+	assert.EqualError(t, err, "tls handshake failed: received alert from server: handshake failure")
+}
+
+func newTestHalfConns(t *testing.T) (*halfConn, *halfConn) {
+	key, _ := hex.DecodeString(testKey)
+	fixedIV := []byte{1, 2, 3, 4}
+
+	writer, reader := &halfConn{}, &halfConn{}
+	require.NoError(t, writer.init(key, fixedIV))
+	require.NoError(t, reader.init(key, fixedIV))
+
+	return writer, reader
+}
+
+// startOpenSSLServer starts 'openssl s_server' on a free port, which echoes all received lines reversed. The test gets
+// skipped if OpenSSL is not available.
+func startOpenSSLServer(t *testing.T, key string, cipher string) string {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not available")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	cmd := exec.Command("openssl", "s_server", "-accept", address, "-nocert", "-psk", key, "-tls1_2",
+		"-cipher", cipher, "-rev")
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if scanner.Text() == "ACCEPT" {
+			go func() {
+				for scanner.Scan() {
+				}
+			}()
+			return address
+		}
+	}
+
+	t.Fatalf("openssl s_server did not start")
+	return ""
+}
+
+func dialOpenSSLServer(t *testing.T, address string, key string) *Conn {
+	rawConn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	require.NoError(t, err)
+	require.NoError(t, rawConn.SetDeadline(time.Now().Add(10*time.Second)))
+
+	rawKey, _ := hex.DecodeString(key)
+	conn, err := Client(rawConn, "nagocheck", rawKey)
+	require.NoError(t, err)
+
+	return conn
+}
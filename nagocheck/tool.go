@@ -0,0 +1,40 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Tool is a top-level command, which is not being provided by a module but by nagocheck itself, e.g. batch execution
+type Tool interface {
+	Name() string
+	DefineCommand(app *kingpin.Application)
+	Execute(modules map[string]Module) error
+}
+
+// RegisterTools returns a map of tools with their name as the respective key
+func RegisterTools(tools ...Tool) map[string]Tool {
+	result := make(map[string]Tool)
+	for _, tool := range tools {
+		result[tool.Name()] = tool
+	}
+
+	return result
+}
@@ -0,0 +1,157 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package transport
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type sshTransport struct {
+	executor Executor
+	host     string
+	user     string
+	port     uint16
+	keyFile  string
+	options  []string
+	command  []string
+}
+
+// SSHOpt is a type alias for functional options used by NewSSHTransport()
+type SSHOpt func(*sshTransport)
+
+// NewSSHTransport instantiates a Transport which executes commands on the given remote host by wrapping the OpenSSH
+// client, so that the usual client configuration (known hosts, agent, jump hosts, ...) applies. The SSH client is
+// always executed in batch mode, as there is nobody who could answer interactive prompts.
+func NewSSHTransport(executor Executor, host string, options ...SSHOpt) Transport {
+	transport := &sshTransport{
+		executor: executor,
+		host:     host,
+		command:  []string{"ssh"},
+	}
+
+	for _, option := range options {
+		option(transport)
+	}
+
+	return transport
+}
+
+// SSHUser is a functional option for NewSSHTransport(), which sets the remote user name
+func SSHUser(user string) SSHOpt {
+	return func(t *sshTransport) {
+		t.user = user
+	}
+}
+
+// SSHPort is a functional option for NewSSHTransport(), which sets the remote port
+func SSHPort(port uint16) SSHOpt {
+	return func(t *sshTransport) {
+		t.port = port
+	}
+}
+
+// SSHKeyFile is a functional option for NewSSHTransport(), which sets the private key used for authentication
+func SSHKeyFile(keyFile string) SSHOpt {
+	return func(t *sshTransport) {
+		t.keyFile = keyFile
+	}
+}
+
+// SSHOptions is a functional option for NewSSHTransport(), which passes additional options formatted as key=value
+// to the SSH client, e.g. StrictHostKeyChecking=yes
+func SSHOptions(options ...string) SSHOpt {
+	return func(t *sshTransport) {
+		t.options = append(t.options, options...)
+	}
+}
+
+// SSHCommand is a functional option for NewSSHTransport(), which sets the command with optional arguments used for
+// executing the SSH client
+func SSHCommand(command []string) SSHOpt {
+	return func(t *sshTransport) {
+		if len(command) > 0 {
+			t.command = command
+		}
+	}
+}
+
+func (t *sshTransport) Name() string {
+	return "ssh"
+}
+
+func (t *sshTransport) Execute(timeout time.Duration, command []string) (string, error) {
+	if len(command) == 0 {
+		return "", fmt.Errorf("no command given")
+	}
+
+	return t.executor(timeout, t.buildCommand(timeout, command))
+}
+
+func (t *sshTransport) buildCommand(timeout time.Duration, command []string) []string {
+	connectTimeout := int(math.Max(1, math.Ceil(timeout.Seconds())))
+	result := append(append([]string(nil), t.command...),
+		"-o", "BatchMode=yes",
+		"-o", "ConnectTimeout="+strconv.Itoa(connectTimeout),
+	)
+
+	if t.user != "" {
+		result = append(result, "-l", t.user)
+	}
+	if t.port != 0 {
+		result = append(result, "-p", strconv.Itoa(int(t.port)))
+	}
+	if t.keyFile != "" {
+		result = append(result, "-i", t.keyFile)
+	}
+	for _, option := range t.options {
+		result = append(result, "-o", option)
+	}
+
+	// The remote command gets passed as a single string and is parsed by the shell of the remote user, which
+	// requires quoting each argument to keep spaces and shell metacharacters intact
+	quotedCommand := make([]string, len(command))
+	for index, argument := range command {
+		quotedCommand[index] = shellQuote(argument)
+	}
+
+	return append(result, "--", t.host, strings.Join(quotedCommand, " "))
+}
+
+func shellQuote(value string) string {
+	if value != "" && strings.IndexFunc(value, isUnsafeShellRune) == -1 {
+		return value
+	}
+
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+func isUnsafeShellRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	case strings.ContainsRune("-_./:,=@%+", r):
+		return false
+	}
+
+	return true
+}
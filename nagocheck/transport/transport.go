@@ -0,0 +1,52 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package transport provides a remote-execution layer for plugins which shell out to external commands, so that these
+// commands can either be executed locally or on a remote host.
+package transport
+
+import "time"
+
+// Executor executes the given command locally and returns the combined output of stdout and stderr. The command must
+// be killed if it does not finish within the given timeout.
+type Executor func(timeout time.Duration, command []string) (string, error)
+
+// Transport executes commands on behalf of plugins, either locally or on a remote host
+type Transport interface {
+	Name() string
+	Execute(timeout time.Duration, command []string) (string, error)
+}
+
+type localTransport struct {
+	executor Executor
+}
+
+// NewLocalTransport instantiates a Transport which executes commands on the local host using the given executor
+func NewLocalTransport(executor Executor) Transport {
+	return &localTransport{
+		executor: executor,
+	}
+}
+
+func (t *localTransport) Name() string {
+	return "local"
+}
+
+func (t *localTransport) Execute(timeout time.Duration, command []string) (string, error) {
+	return t.executor(timeout, command)
+}
@@ -25,7 +25,9 @@ import (
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
 )
 
 // Round is a utility function which allows rounding a float64 to a given precision
@@ -92,6 +94,79 @@ func DurationString(duration time.Duration) string {
 	return duration.Truncate(time.Second).String()
 }
 
+// FormatSeconds formats the given amount of seconds as human-readable duration with millisecond precision, e.g. for
+// response times given as floating point seconds
+func FormatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+var durationPartRE = regexp.MustCompile(`^(\d+(?:\.\d+)?)(ms|s|m|h|d|w)`)
+
+var durationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+// ParseDuration parses a human-readable duration like time.ParseDuration(), with additional support for days (d) and
+// weeks (w), e.g. '7d' or '1d12h'. Plain numbers without any unit are interpreted as seconds.
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	var duration time.Duration
+	for remaining := value; remaining != ""; {
+		match := durationPartRE.FindStringSubmatch(remaining)
+		if match == nil {
+			return 0, fmt.Errorf("could not parse duration [%s]", value)
+		}
+
+		amount, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse duration [%s]: %s", value, err.Error())
+		}
+
+		duration += time.Duration(amount * float64(durationUnits[match[2]]))
+		remaining = remaining[len(match[0]):]
+	}
+
+	if value == "" {
+		return 0, fmt.Errorf("could not parse empty duration")
+	}
+
+	return duration, nil
+}
+
+var sizeRE = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([KMGTP]?)(I?)(B?)$`)
+
+var sizeExponents = map[string]float64{"": 0, "K": 1, "M": 2, "G": 3, "T": 4, "P": 5}
+
+// ParseSize parses a human-readable size in bytes like '512MB' or '2GiB'. Units with an 'i' (e.g. MiB) and units
+// without 'B' (e.g. M, as returned by FormatBinarySize) are binary, while all other units (e.g. MB) are decimal.
+func ParseSize(value string) (float64, error) {
+	match := sizeRE.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(value)))
+	if match == nil {
+		return 0, fmt.Errorf("could not parse size [%s]", value)
+	}
+
+	amount, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse size [%s]: %s", value, err.Error())
+	}
+
+	base := float64(1000)
+	if match[3] != "" || match[4] == "" {
+		base = 1024
+	}
+
+	return amount * math.Pow(base, sizeExponents[match[2]]), nil
+}
+
 // compatTimeTruncate is a compatibility function for time.Truncate(), which is not supported in Go 1.8
 func compatTimeTruncate(d time.Duration, m time.Duration) time.Duration {
 	if d <= 0 {
@@ -131,6 +206,80 @@ func FormatBinarySize(size float64) string {
 	return "N/A"
 }
 
+// SplitCommandLine splits a command line into its arguments in a similar way as a POSIX shell would, supporting single
+// quotes, double quotes and backslash escapes. No expansion of any kind is being performed.
+func SplitCommandLine(commandLine string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArgument, escaped := false, false
+
+	for _, char := range commandLine {
+		switch {
+		case escaped:
+			current.WriteRune(char)
+			escaped = false
+		case char == '\\' && quote != '\'':
+			escaped, inArgument = true, true
+		case quote != 0 && char == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(char)
+		case char == '\'' || char == '"':
+			quote, inArgument = char, true
+		case unicode.IsSpace(char):
+			if inArgument {
+				args = append(args, current.String())
+				current.Reset()
+				inArgument = false
+			}
+		default:
+			current.WriteRune(char)
+			inArgument = true
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("unterminated escape sequence in command line: %s", commandLine)
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command line: %s", commandLine)
+	}
+	if inArgument {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// truncateString shortens a string to the given maximum amount of characters, indicating the truncation with an
+// ellipsis. A maximum length of zero or less disables truncation.
+func truncateString(value string, maxLength int) string {
+	runes := []rune(value)
+	if maxLength <= 0 || len(runes) <= maxLength {
+		return value
+	}
+	if maxLength <= 3 {
+		return string(runes[:maxLength])
+	}
+
+	return string(runes[:maxLength-3]) + "..."
+}
+
+// exitCodeSignificance returns the significance of a Nagios exit code, where CRITICAL > WARNING > UNKNOWN > OK
+func exitCodeSignificance(exitCode int) int {
+	switch exitCode {
+	case 0:
+		return 0
+	case 1:
+		return 2
+	case 2:
+		return 3
+	}
+
+	return 1
+}
+
 // NewInvalidMetricTypeResult returns a new Nagopher result in case a custom context tries to convert the generic Metric
 // interface pointer into a specific type and is unable to do so. An example from Nagopher itself (which does not use
 // this helper method though, obviously) would be a ScalarContext which strictly requires a NumericMetric to properly
@@ -0,0 +1,203 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package nagocheck
+
+import (
+	"bufio"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+type validateTool struct {
+	moduleFactory func() map[string]Module
+
+	file     string
+	fileType string
+	profiles ThresholdProfiles
+}
+
+// validationError describes a problem within a single line of a validated file
+type validationError struct {
+	line    int
+	content string
+	message string
+}
+
+// NewValidateTool instantiates a Tool, which validates the files read by nagocheck without executing anything, i.e.
+// schedule files of serve, batch files, downtime files and the config file. Invocations are being parsed like on
+// execution, followed by resolving threshold profiles, threshold overrides, averaging and baseline policies against
+// the contexts of the selected plugin. The module factory must return fresh instances of all modules, as every
+// invocation gets parsed separately.
+func NewValidateTool(moduleFactory func() map[string]Module) Tool {
+	return &validateTool{moduleFactory: moduleFactory}
+}
+
+func (t *validateTool) Name() string {
+	return "validate-config"
+}
+
+func (t *validateTool) DefineCommand(app *kingpin.Application) {
+	node := app.Command(t.Name(), "Validate a schedule, batch, downtime or config file and report errors with line "+
+		"context.")
+
+	node.Arg("file", "Path to the file which should be validated.").
+		Required().ExistingFileVar(&t.file)
+
+	node.Flag("type", "Type of the file, either a schedule file of 'serve', a batch file of 'batch', a downtime "+
+		"file as given by --downtime-file or a config file declaring threshold profiles as given by --config.").
+		Short('t').Default("schedule").EnumVar(&t.fileType, "schedule", "batch", "downtime", "config")
+}
+
+func (t *validateTool) Execute(modules map[string]Module) error {
+	file, err := os.Open(t.file)
+	if err != nil {
+		return fmt.Errorf("could not open file: %s", err.Error())
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var errs []validationError
+	var entries int
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entries++
+		if err := t.validateLine(line); err != nil {
+			errs = append(errs, validationError{line: lineNumber, content: scanner.Text(), message: err.Error()})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read file: %s", err.Error())
+	}
+
+	for _, err := range errs {
+		fmt.Printf("%s:%d: %s\n", t.file, err.line, err.message)
+		fmt.Printf("  %4d | %s\n", err.line, err.content)
+	}
+
+	if len(errs) > 0 {
+		fmt.Printf("%d of %d entries are invalid\n", len(errs), entries)
+		os.Exit(1)
+	}
+
+	if entries == 1 {
+		fmt.Println("1 entry is valid")
+	} else {
+		fmt.Printf("%d entries are valid\n", entries)
+	}
+	return nil
+}
+
+func (t *validateTool) validateLine(line string) error {
+	switch t.fileType {
+	case "schedule":
+		check, err := parseScheduleEntry(line)
+		if err != nil {
+			return err
+		}
+		return t.validateInvocation(check.invocation)
+
+	case "batch":
+		return t.validateInvocation(line)
+
+	case "downtime":
+		_, err := parseDowntimeWindow(line)
+		return err
+
+	case "config":
+		if t.profiles == nil {
+			t.profiles = make(ThresholdProfiles)
+		}
+		return t.profiles.parseConfigLine(line)
+	}
+
+	return fmt.Errorf("unknown file type: %s", t.fileType)
+}
+
+// validateInvocation parses the given invocation using a dedicated kingpin application, which also contains the
+// global flags bound to separate options, and resolves the threshold profile and all threshold overrides, averaging
+// and baseline policies against the contexts of the plugin
+func (t *validateTool) validateInvocation(invocation string) error {
+	args, err := SplitCommandLine(invocation)
+	if err != nil {
+		return fmt.Errorf("invalid invocation: %s", err.Error())
+	}
+
+	modules := t.moduleFactory()
+	app := kingpin.New("nagocheck", "")
+	app.UsageWriter(ioutil.Discard)
+	app.ErrorWriter(ioutil.Discard)
+	app.Terminate(nil)
+	options := newGlobalOptions()
+	defineGlobalFlags(app, &options)
+
+	for _, module := range modules {
+		moduleNode := module.DefineCommand(app)
+		module.DefineFlags(moduleNode)
+	}
+	DefineEnvars(app, modules)
+
+	command, err := app.Parse(args)
+	if err != nil {
+		return fmt.Errorf("invalid arguments: %s", err.Error())
+	}
+	if options.configFile == "" {
+		options.configFile = globals.configFile
+	}
+
+	commandParts := strings.Split(command, " ")
+	module, ok := modules[commandParts[0]]
+	if !ok || len(commandParts) != 2 {
+		return fmt.Errorf("invocation must select a plugin like '<module> <plugin>', got [%s]", command)
+	}
+	plugin, err := module.GetPluginByName(commandParts[1])
+	if err != nil {
+		return err
+	}
+
+	check := plugin.DefineCheck()
+	if err := plugin.AveragingPolicies().Apply(check, plugin); err != nil {
+		return err
+	}
+	thresholdOverrides, err := resolveThresholdOverrides(options, plugin, check)
+	if err != nil {
+		return err
+	}
+	if err := thresholdOverrides.Apply(check); err != nil {
+		return err
+	}
+	if err := plugin.BaselinePolicies().Apply(check, plugin); err != nil {
+		return err
+	}
+	if _, err := newPartialPolicy(options); err != nil {
+		return err
+	}
+	if _, err := newStateMapping(options); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+ * nagocheck - Reliable and lightweight Nagios plugins written in Go
+ * Copyright (C) 2018-2019  Pascal Mathis
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package nagocheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VerboseOutputPolicy controls how the verbose output of a check is being rendered, which is especially useful for
+// plugins forcing verbose output with a lot of items, e.g. sessions or RAID arrays
+type VerboseOutputPolicy struct {
+	Sort     bool
+	Group    bool
+	MaxLines int
+}
+
+// verboseLine represents a single message of the verbose output together with the section it belongs to
+type verboseLine struct {
+	section      string
+	message      string
+	significance int
+}
+
+// render converts the given lines into the verbose output. Lines are optionally sorted by significance, section and
+// message, grouped under a titled header per section and truncated after MaxLines lines.
+func (p VerboseOutputPolicy) render(lines []verboseLine) []string {
+	if p.Sort {
+		sort.SliceStable(lines, func(i, j int) bool {
+			if lines[i].significance != lines[j].significance {
+				return lines[i].significance > lines[j].significance
+			}
+			if lines[i].section != lines[j].section {
+				return lines[i].section < lines[j].section
+			}
+
+			return lines[i].message < lines[j].message
+		})
+	}
+
+	var messages, sectionTitles []string
+	sections := make(map[string][]string)
+	for _, line := range lines {
+		if line.section == "" {
+			messages = append(messages, line.message)
+			continue
+		} else if !p.Group {
+			messages = append(messages, line.section+": "+line.message)
+			continue
+		}
+
+		if _, ok := sections[line.section]; !ok {
+			sectionTitles = append(sectionTitles, line.section)
+		}
+		sections[line.section] = append(sections[line.section], "  "+line.message)
+	}
+
+	for _, title := range sectionTitles {
+		messages = append(messages, title+":")
+		messages = append(messages, sections[title]...)
+	}
+
+	if p.MaxLines > 0 && len(messages) > p.MaxLines {
+		// Avoid ending with the header of a section whose lines have all been omitted
+		limit := p.MaxLines
+		if p.Group && sections[strings.TrimSuffix(messages[limit-1], ":")] != nil {
+			limit--
+		}
+
+		remaining := len(messages) - limit
+		messages = append(messages[:limit], fmt.Sprintf("… and %d more", remaining))
+	}
+
+	return messages
+}